@@ -156,6 +156,11 @@ type TLSConfig struct {
 	// Vault server SSL certificate.
 	CACert string
 
+	// CACertBytes is a PEM-encoded certificate or bundle to verify the Vault
+	// server SSL certificate with. It is used if CACert is not set, and
+	// takes precedence over CAPath.
+	CACertBytes []byte
+
 	// CAPath is the path to a directory of PEM-encoded CA cert files to verify
 	// the Vault server SSL certificate.
 	CAPath string
@@ -245,10 +250,11 @@ func (c *Config) ConfigureTLS(t *TLSConfig) error {
 		return fmt.Errorf("both client cert and client key must be provided")
 	}
 
-	if t.CACert != "" || t.CAPath != "" {
+	if len(t.CACertBytes) != 0 || t.CACert != "" || t.CAPath != "" {
 		rootConfig := &rootcerts.Config{
-			CAFile: t.CACert,
-			CAPath: t.CAPath,
+			CAFile:        t.CACert,
+			CACertificate: t.CACertBytes,
+			CAPath:        t.CAPath,
 		}
 		if err := rootcerts.ConfigureTLS(clientTLSConfig, rootConfig); err != nil {
 			return err
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/hashicorp/vault/sdk/helper/consts"
+)
+
+const (
+	// TransitDefaultMountPoint is the default path at which the transit
+	// secrets engine is mounted.
+	TransitDefaultMountPoint = "transit"
+
+	// TransitStreamErrorTrailer is the HTTP trailer in which the transit
+	// secrets engine reports errors that occur after a streamed response has
+	// started.
+	TransitStreamErrorTrailer = "X-Vault-Stream-Error"
+)
+
+// Transit is used to return a client to invoke operations on the transit
+// secrets engine.
+type Transit struct {
+	c          *Client
+	MountPoint string
+}
+
+// TransitStreamOptions holds the optional parameters of streaming
+// encryption and decryption requests.
+type TransitStreamOptions struct {
+	// Context is the key derivation context, required for derived keys.
+	Context []byte
+
+	// KeyVersion is the version of the key to encrypt with; 0 uses the
+	// latest version. Ignored when decrypting.
+	KeyVersion int
+
+	// ChunkSize is the number of plaintext bytes encrypted in each chunk of
+	// the stream; 0 uses the server default. Ignored when decrypting.
+	ChunkSize int
+}
+
+// Transit returns the client for the transit secrets engine mounted at the
+// default path.
+func (c *Client) Transit() *Transit {
+	return c.TransitWithMountPoint(TransitDefaultMountPoint)
+}
+
+// TransitWithMountPoint returns the client for the transit secrets engine
+// mounted at the given path.
+func (c *Client) TransitWithMountPoint(mountPoint string) *Transit {
+	return &Transit{
+		c:          c,
+		MountPoint: mountPoint,
+	}
+}
+
+// EncryptStream encrypts everything read from plaintext with the named key,
+// writing the encrypted stream to ciphertext. The stream can be decrypted
+// with DecryptStream.
+func (c *Transit) EncryptStream(ctx context.Context, name string, plaintext io.Reader, ciphertext io.Writer, opts *TransitStreamOptions) error {
+	r := c.c.NewRequest(http.MethodPost, fmt.Sprintf("/v1/%s/encrypt-stream/%s", c.MountPoint, name))
+	if opts != nil {
+		if len(opts.Context) != 0 {
+			r.Params.Set("context", base64.StdEncoding.EncodeToString(opts.Context))
+		}
+		if opts.KeyVersion != 0 {
+			r.Params.Set("key_version", strconv.Itoa(opts.KeyVersion))
+		}
+		if opts.ChunkSize != 0 {
+			r.Params.Set("chunk_size", strconv.Itoa(opts.ChunkSize))
+		}
+	}
+
+	return c.stream(ctx, r, plaintext, ciphertext)
+}
+
+// DecryptStream decrypts a stream produced by EncryptStream, writing the
+// plaintext to plaintext. Plaintext is written as each chunk of the stream
+// is authenticated, so if an error is returned the data already written
+// must be discarded.
+func (c *Transit) DecryptStream(ctx context.Context, name string, ciphertext io.Reader, plaintext io.Writer, opts *TransitStreamOptions) error {
+	r := c.c.NewRequest(http.MethodPost, fmt.Sprintf("/v1/%s/decrypt-stream/%s", c.MountPoint, name))
+	if opts != nil && len(opts.Context) != 0 {
+		r.Params.Set("context", base64.StdEncoding.EncodeToString(opts.Context))
+	}
+
+	return c.stream(ctx, r, ciphertext, plaintext)
+}
+
+// stream sends the body as a raw stream and copies the response to out. The
+// request is built by hand, as RawRequestWithContext buffers request bodies
+// so that they can be retried.
+func (c *Transit) stream(ctx context.Context, r *Request, body io.Reader, out io.Writer) error {
+	r.URL.RawQuery = r.Params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL.RequestURI(), body)
+	if err != nil {
+		return err
+	}
+
+	req.URL.User = r.URL.User
+	req.URL.Scheme = r.URL.Scheme
+	req.URL.Host = r.URL.Host
+	req.Host = r.URL.Host
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	if r.Headers != nil {
+		for header, vals := range r.Headers {
+			for _, val := range vals {
+				req.Header.Add(header, val)
+			}
+		}
+	}
+
+	if len(r.ClientToken) != 0 {
+		req.Header.Set(consts.AuthHeaderName, r.ClientToken)
+	}
+
+	if len(r.MFAHeaderVals) != 0 {
+		for _, mfaHeaderVal := range r.MFAHeaderVals {
+			req.Header.Add("X-Vault-MFA", mfaHeaderVal)
+		}
+	}
+
+	if r.PolicyOverride {
+		req.Header.Set("X-Vault-Policy-Override", "true")
+	}
+
+	resp, err := c.c.config.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The request body has been consumed, so redirects cannot be followed
+	if resp.StatusCode == 301 || resp.StatusCode == 302 || resp.StatusCode == 307 {
+		return fmt.Errorf("streaming requests cannot be redirected; received status %d", resp.StatusCode)
+	}
+
+	result := &Response{Response: resp}
+	if err := result.Error(); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return err
+	}
+
+	// Trailers are only available once the body has been read in full
+	if streamErr := resp.Trailer.Get(TransitStreamErrorTrailer); streamErr != "" {
+		return fmt.Errorf("error streaming data: %s", streamErr)
+	}
+
+	return nil
+}
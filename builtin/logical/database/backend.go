@@ -34,6 +34,10 @@ type dbPluginInstance struct {
 	id     string
 	name   string
 	closed bool
+
+	// credentialTypes are the types of credentials, other than passwords,
+	// which the plugin declared support for when it was initialized
+	credentialTypes []v5.CredentialType
 }
 
 func (dbi *dbPluginInstance) Close() error {
@@ -48,6 +52,20 @@ func (dbi *dbPluginInstance) Close() error {
 	return dbi.database.Close()
 }
 
+// checkCredentialType returns an error if the plugin doesn't support creating
+// users with the given type of credential.
+func (dbi *dbPluginInstance) checkCredentialType(credentialType v5.CredentialType) error {
+	if credentialType == v5.CredentialTypePassword {
+		return nil
+	}
+	for _, supported := range dbi.credentialTypes {
+		if supported == credentialType {
+			return nil
+		}
+	}
+	return fmt.Errorf("the plugin of database %q does not support the %s credential type", dbi.name, credentialType)
+}
+
 func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
 	b := Backend(conf)
 	if err := b.Setup(ctx, conf); err != nil {
@@ -76,6 +94,7 @@ func Backend(conf *logical.BackendConfig) *databaseBackend {
 			},
 			SealWrapStorage: []string{
 				"config/*",
+				"role/*",
 				"static-role/*",
 			},
 		},
@@ -268,16 +287,17 @@ func (b *databaseBackend) GetConnectionWithConfig(ctx context.Context, name stri
 		Config:           config.ConnectionDetails,
 		VerifyConnection: true,
 	}
-	_, err = dbw.Initialize(ctx, initReq)
+	initResp, err := dbw.Initialize(ctx, initReq)
 	if err != nil {
 		dbw.Close()
 		return nil, err
 	}
 
 	dbi = &dbPluginInstance{
-		database: dbw,
-		id:       id,
-		name:     name,
+		database:        dbw,
+		id:              id,
+		name:            name,
+		credentialTypes: initResp.SupportedCredentialTypes,
 	}
 	b.connections[name] = dbi
 	return dbi, nil
@@ -0,0 +1,229 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	v5 "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/template"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	// defaultCommonNameTemplate is the template of the common name of the
+	// client certificates issued for dynamic roles
+	defaultCommonNameTemplate = `{{ printf "v-%s-%s-%s-%s" (.DisplayName | truncate 8) (.RoleName | truncate 8) (random 20) (unix_time) | truncate 63 }}`
+
+	defaultRSAKeyBits = 2048
+)
+
+// parseCredentialType returns the credential type of the given name
+func parseCredentialType(name string) (v5.CredentialType, error) {
+	switch name {
+	case v5.CredentialTypePassword.String():
+		return v5.CredentialTypePassword, nil
+	case v5.CredentialTypeClientCertificate.String():
+		return v5.CredentialTypeClientCertificate, nil
+	default:
+		return 0, fmt.Errorf("invalid credential_type %q; must be %q or %q", name,
+			v5.CredentialTypePassword, v5.CredentialTypeClientCertificate)
+	}
+}
+
+// validateCredentialConfig checks that the credential config of a role is
+// valid for its credential type
+func validateCredentialConfig(credentialType v5.CredentialType, config map[string]interface{}) error {
+	var err error
+	switch credentialType {
+	case v5.CredentialTypePassword:
+		_, err = newPasswordCredentialGenerator(config)
+	case v5.CredentialTypeClientCertificate:
+		_, err = newClientCertificateGenerator(config)
+	default:
+		err = fmt.Errorf("unknown credential type %q", credentialType)
+	}
+	return err
+}
+
+// decodeCredentialConfig decodes the credential config of a role into the
+// given generator, rejecting unknown parameters
+func decodeCredentialConfig(config map[string]interface{}, generator interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           generator,
+		WeaklyTypedInput: true,
+		ErrorUnused:      true,
+	})
+	if err != nil {
+		return err
+	}
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("invalid credential_config: %w", err)
+	}
+	return nil
+}
+
+// passwordCredentialGenerator generates password credentials
+type passwordCredentialGenerator struct {
+	// PasswordPolicy is the password policy used to generate passwords,
+	// overriding the password policy of the database connection
+	PasswordPolicy string `mapstructure:"password_policy"`
+}
+
+func newPasswordCredentialGenerator(config map[string]interface{}) (passwordCredentialGenerator, error) {
+	var pg passwordCredentialGenerator
+	if err := decodeCredentialConfig(config, &pg); err != nil {
+		return pg, err
+	}
+	return pg, nil
+}
+
+// generate returns a new password, generated with the password policy of the
+// role or else of the database connection
+func (pg passwordCredentialGenerator) generate(ctx context.Context, dbw databaseVersionWrapper, generator passwordGenerator, connectionPolicy string) (string, error) {
+	policy := connectionPolicy
+	if pg.PasswordPolicy != "" {
+		policy = pg.PasswordPolicy
+	}
+	return dbw.GeneratePassword(ctx, generator, policy)
+}
+
+// clientCertificateGenerator issues client certificate credentials, signed by
+// the CA of the role
+type clientCertificateGenerator struct {
+	// CommonNameTemplate is the template of the common name of the
+	// certificates issued for dynamic roles. The common name of the
+	// certificates of static roles is the username of the static account.
+	CommonNameTemplate string `mapstructure:"common_name_template"`
+
+	// CACert is the PEM-encoded certificate of the CA signing the client
+	// certificates
+	CACert string `mapstructure:"ca_cert"`
+
+	// CAPrivateKey is the PEM-encoded private key of the CA
+	CAPrivateKey string `mapstructure:"ca_private_key"`
+
+	// KeyType is the type of key of the client certificates
+	KeyType string `mapstructure:"key_type"`
+
+	// KeyBits is the bit size of the key of the client certificates
+	KeyBits int `mapstructure:"key_bits"`
+
+	// SignatureBits is the bit size of the signature hash
+	SignatureBits int `mapstructure:"signature_bits"`
+
+	cnProducer    template.StringTemplate
+	signingBundle *certutil.CAInfoBundle
+}
+
+func newClientCertificateGenerator(config map[string]interface{}) (clientCertificateGenerator, error) {
+	cg := clientCertificateGenerator{
+		CommonNameTemplate: defaultCommonNameTemplate,
+		KeyType:            "rsa",
+	}
+	if err := decodeCredentialConfig(config, &cg); err != nil {
+		return cg, err
+	}
+
+	if cg.KeyBits == 0 {
+		switch cg.KeyType {
+		case "rsa":
+			cg.KeyBits = defaultRSAKeyBits
+		case "ec":
+			cg.KeyBits = 256
+		}
+	}
+	if err := certutil.ValidateKeyTypeSignatureLength(cg.KeyType, cg.KeyBits, &cg.SignatureBits); err != nil {
+		return cg, fmt.Errorf("invalid key for the client_certificate credential type: %w", err)
+	}
+
+	var err error
+	cg.cnProducer, err = template.NewTemplate(template.Template(cg.CommonNameTemplate))
+	if err != nil {
+		return cg, fmt.Errorf("invalid common_name_template: %w", err)
+	}
+
+	if cg.CACert == "" || cg.CAPrivateKey == "" {
+		return cg, fmt.Errorf("ca_cert and ca_private_key are required for the client_certificate credential type")
+	}
+	parsedBundle, err := certutil.ParsePEMBundle(strings.Join([]string{cg.CACert, cg.CAPrivateKey}, "\n"))
+	if err != nil {
+		return cg, fmt.Errorf("unable to parse the CA of the client_certificate credential type: %w", err)
+	}
+	if parsedBundle.Certificate == nil || parsedBundle.PrivateKey == nil {
+		return cg, fmt.Errorf("ca_cert must contain a certificate and ca_private_key its private key")
+	}
+	if !parsedBundle.Certificate.IsCA {
+		return cg, fmt.Errorf("ca_cert is not a CA certificate")
+	}
+	if err := parsedBundle.Verify(); err != nil {
+		return cg, fmt.Errorf("ca_private_key does not match ca_cert: %w", err)
+	}
+	cg.signingBundle = &certutil.CAInfoBundle{
+		ParsedCertBundle: *parsedBundle,
+		URLs:             &certutil.URLEntries{},
+	}
+
+	return cg, nil
+}
+
+// commonName returns the common name of a client certificate for a dynamic
+// role
+func (cg clientCertificateGenerator) commonName(usernameConfig v5.UsernameMetadata) (string, error) {
+	return cg.cnProducer.Generate(usernameConfig)
+}
+
+// generate issues a client certificate with the given common name, valid
+// until notAfter
+func (cg clientCertificateGenerator) generate(r io.Reader, commonName string, notAfter time.Time) (*certutil.CertBundle, string, error) {
+	if r == nil {
+		r = rand.Reader
+	}
+
+	creation := &certutil.CreationBundle{
+		Params: &certutil.CreationParameters{
+			Subject: pkix.Name{
+				CommonName: commonName,
+			},
+			KeyType:       cg.KeyType,
+			KeyBits:       cg.KeyBits,
+			SignatureBits: cg.SignatureBits,
+			NotAfter:      notAfter,
+			KeyUsage:      x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement,
+			ExtKeyUsage:   certutil.ClientAuthExtKeyUsage,
+			// Database clients commonly require the basic constraints
+			// extension of client certificates
+			BasicConstraintsValidForNonCA: true,
+			URLs:                          &certutil.URLEntries{},
+		},
+		SigningBundle: cg.signingBundle,
+	}
+
+	parsedBundle, err := certutil.CreateCertificateWithRandomSource(creation, r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	bundle, err := parsedBundle.ToCertBundle()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return bundle, parsedBundle.Certificate.Subject.String(), nil
+}
+
+// clientCertificateResponse returns the response data of the given client
+// certificate credential
+func clientCertificateResponse(certificate, privateKey, privateKeyType string) map[string]interface{} {
+	return map[string]interface{}{
+		"client_certificate": certificate,
+		"private_key":        privateKey,
+		"private_key_type":   privateKeyType,
+	}
+}
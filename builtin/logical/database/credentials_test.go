@@ -0,0 +1,444 @@
+package database
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	v5 "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCredentialTypes_RoleValidation(t *testing.T) {
+	ctx := context.Background()
+	b, storage, _ := getCredentialsBackend(t)
+	defer b.Cleanup(ctx)
+	configureDBMount(t, storage)
+
+	caCert, caKey := testCredentialsCA(t)
+
+	type testCase struct {
+		data      map[string]interface{}
+		expectErr bool
+	}
+
+	tests := map[string]testCase{
+		"default password": {
+			data: map[string]interface{}{},
+		},
+		"password with policy": {
+			data: map[string]interface{}{
+				"credential_type": "password",
+				"credential_config": map[string]interface{}{
+					"password_policy": "foo",
+				},
+			},
+		},
+		"unknown credential type": {
+			data: map[string]interface{}{
+				"credential_type": "kerberos",
+			},
+			expectErr: true,
+		},
+		"unknown config parameter": {
+			data: map[string]interface{}{
+				"credential_type": "password",
+				"credential_config": map[string]interface{}{
+					"key_bits": "2048",
+				},
+			},
+			expectErr: true,
+		},
+		"rsa private key": {
+			data: map[string]interface{}{
+				"credential_type": "rsa_private_key",
+			},
+			expectErr: true,
+		},
+		"client certificate": {
+			data: map[string]interface{}{
+				"credential_type": "client_certificate",
+				"credential_config": map[string]interface{}{
+					"ca_cert":        caCert,
+					"ca_private_key": caKey,
+					"key_type":       "ec",
+				},
+			},
+		},
+		"client certificate without CA": {
+			data: map[string]interface{}{
+				"credential_type": "client_certificate",
+			},
+			expectErr: true,
+		},
+		"client certificate with mismatched CA key": {
+			data: map[string]interface{}{
+				"credential_type": "client_certificate",
+				"credential_config": map[string]interface{}{
+					"ca_cert":        caCert,
+					"ca_private_key": func() string { _, key := testCredentialsCA(t); return key }(),
+				},
+			},
+			expectErr: true,
+		},
+		"client certificate with invalid template": {
+			data: map[string]interface{}{
+				"credential_type": "client_certificate",
+				"credential_config": map[string]interface{}{
+					"ca_cert":              caCert,
+					"ca_private_key":       caKey,
+					"common_name_template": "{{ .Missing",
+				},
+			},
+			expectErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			data := map[string]interface{}{
+				"db_name":             "mockv5",
+				"creation_statements": "CREATE USER",
+			}
+			for k, v := range test.data {
+				data[k] = v
+			}
+
+			resp, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.CreateOperation,
+				Path:      "roles/test",
+				Storage:   storage,
+				Data:      data,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.expectErr != (resp != nil && resp.IsError()) {
+				t.Fatalf("expected error: %t, got response: %#v", test.expectErr, resp)
+			}
+		})
+	}
+
+	// The private key of the CA is never returned
+	createCredentialsRole(t, b, storage, "cert", map[string]interface{}{
+		"credential_type": "client_certificate",
+		"credential_config": map[string]interface{}{
+			"ca_cert":        caCert,
+			"ca_private_key": caKey,
+		},
+	})
+	resp := readCredentials(t, b, storage, "roles/cert")
+	if resp.Data["credential_type"] != "client_certificate" {
+		t.Fatalf("unexpected credential_type: %v", resp.Data["credential_type"])
+	}
+	config := resp.Data["credential_config"].(map[string]interface{})
+	if config["ca_cert"] != caCert {
+		t.Fatalf("expected ca_cert in credential_config, got: %#v", config)
+	}
+	if _, ok := config["ca_private_key"]; ok {
+		t.Fatalf("expected no ca_private_key in credential_config, got: %#v", config)
+	}
+}
+
+func TestCredentialTypes_DynamicRoles(t *testing.T) {
+	ctx := context.Background()
+	b, storage, mockDB := getCredentialsBackend(t)
+	defer b.Cleanup(ctx)
+	configureDBMount(t, storage)
+
+	caCert, caKey := testCredentialsCA(t)
+
+	t.Run("client certificate", func(t *testing.T) {
+		createCredentialsRole(t, b, storage, "cert", map[string]interface{}{
+			"credential_type": "client_certificate",
+			"credential_config": map[string]interface{}{
+				"ca_cert":              caCert,
+				"ca_private_key":       caKey,
+				"common_name_template": "{{ .RoleName }}-user",
+			},
+		})
+
+		var newUserReq v5.NewUserRequest
+		mockDB.On("NewUser", mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				newUserReq = args.Get(1).(v5.NewUserRequest)
+			}).
+			Return(v5.NewUserResponse{Username: "cert-user"}, nil).
+			Once()
+
+		resp := readCredentials(t, b, storage, "creds/cert")
+		if resp.Secret.Renewable {
+			t.Fatalf("expected the lease of a client certificate to not be renewable")
+		}
+
+		cert := assertClientCertificate(t, resp.Data, caCert)
+		if cert.Subject.CommonName != "cert-user" {
+			t.Fatalf("unexpected common name: %q", cert.Subject.CommonName)
+		}
+		if newUserReq.CredentialType != v5.CredentialTypeClientCertificate || newUserReq.Subject != cert.Subject.String() {
+			t.Fatalf("unexpected request: %#v", newUserReq)
+		}
+	})
+}
+
+func TestCredentialTypes_StaticRoles(t *testing.T) {
+	ctx := context.Background()
+	b, storage, mockDB := getCredentialsBackend(t)
+	defer b.Cleanup(ctx)
+	configureDBMount(t, storage)
+
+	caCert, caKey := testCredentialsCA(t)
+
+	t.Run("client certificate", func(t *testing.T) {
+		// No call is made to the database
+		createCredentialsStaticRole(t, b, storage, "cert", map[string]interface{}{
+			"credential_type": "client_certificate",
+			"credential_config": map[string]interface{}{
+				"ca_cert":        caCert,
+				"ca_private_key": caKey,
+			},
+		})
+
+		resp := readCredentials(t, b, storage, "static-creds/cert")
+		cert := assertClientCertificate(t, resp.Data, caCert)
+		if cert.Subject.CommonName != "cert" {
+			t.Fatalf("expected the username as common name, got: %q", cert.Subject.CommonName)
+		}
+		if cert.NotAfter.Before(time.Now().Add(time.Hour)) || cert.NotAfter.After(time.Now().Add(maxClientCertificateRotationPeriod+time.Minute)) {
+			t.Fatalf("expected the certificate to expire shortly after the rotation period, got: %s", cert.NotAfter)
+		}
+
+		// Rotating issues a new certificate
+		rotateRole(t, b, storage, mockDB, "cert")
+		resp = readCredentials(t, b, storage, "static-creds/cert")
+		rotated := assertClientCertificate(t, resp.Data, caCert)
+		if rotated.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			t.Fatalf("expected a new certificate after rotation")
+		}
+
+		for name, data := range map[string]map[string]interface{}{
+			// The credential type of a static role can't change
+			"credential type": {
+				"credential_type": "password",
+			},
+			// Superseded certificates remain valid until they expire, so their
+			// lifetime is bounded
+			"rotation period": {
+				"rotation_period": "48h",
+			},
+		} {
+			resp, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "static-roles/cert",
+				Storage:   storage,
+				Data:      data,
+			})
+			if err != nil || resp == nil || !resp.IsError() {
+				t.Fatalf("%s: expected an error response, got: %#v, err: %v", name, resp, err)
+			}
+		}
+
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "static-roles/long-lived",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"db_name":         "mockv5",
+				"username":        "long-lived",
+				"rotation_period": "86401s",
+				"credential_type": "client_certificate",
+				"credential_config": map[string]interface{}{
+					"ca_cert":        caCert,
+					"ca_private_key": caKey,
+				},
+			},
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error response, got: %#v, err: %v", resp, err)
+		}
+	})
+
+	mockDB.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything)
+}
+
+func TestCredentialTypes_UnsupportedByPlugin(t *testing.T) {
+	ctx := context.Background()
+	b, storage, mockDB := getCredentialsBackend(t)
+	defer b.Cleanup(ctx)
+	configureDBMount(t, storage)
+
+	caCert, caKey := testCredentialsCA(t)
+	createCredentialsRole(t, b, storage, "existing", map[string]interface{}{
+		"credential_type": "client_certificate",
+		"credential_config": map[string]interface{}{
+			"ca_cert":        caCert,
+			"ca_private_key": caKey,
+		},
+	})
+
+	// The plugin no longer declares support for anything but passwords
+	b.connections["mockv5"].credentialTypes = nil
+
+	for path, data := range map[string]map[string]interface{}{
+		"roles/cert": {
+			"db_name":             "mockv5",
+			"creation_statements": "CREATE USER",
+			"credential_type":     "client_certificate",
+			"credential_config": map[string]interface{}{
+				"ca_cert":        caCert,
+				"ca_private_key": caKey,
+			},
+		},
+		"static-roles/cert": {
+			"db_name":         "mockv5",
+			"username":        "cert",
+			"rotation_period": "86400s",
+			"credential_type": "client_certificate",
+			"credential_config": map[string]interface{}{
+				"ca_cert":        caCert,
+				"ca_private_key": caKey,
+			},
+		},
+	} {
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected an error response, got: %#v, err: %v", path, resp, err)
+		}
+	}
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/existing",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error response, got: %#v, err: %v", resp, err)
+	}
+	mockDB.AssertNotCalled(t, "NewUser", mock.Anything, mock.Anything)
+	mockDB.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything)
+}
+
+// getCredentialsBackend returns a backend whose mock database plugin
+// declares support for all credential types
+func getCredentialsBackend(t *testing.T) (*databaseBackend, logical.Storage, *mockNewDatabase) {
+	t.Helper()
+	b, storage, mockDB := getBackend(t)
+	b.connections["mockv5"].credentialTypes = []v5.CredentialType{
+		v5.CredentialTypeClientCertificate,
+	}
+	return b, storage, mockDB
+}
+
+func createCredentialsRole(t *testing.T, b *databaseBackend, storage logical.Storage, roleName string, data map[string]interface{}) {
+	t.Helper()
+	data["db_name"] = "mockv5"
+	data["creation_statements"] = "CREATE USER"
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roles/" + roleName,
+		Storage:   storage,
+		Data:      data,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatal(resp, err)
+	}
+}
+
+func createCredentialsStaticRole(t *testing.T, b *databaseBackend, storage logical.Storage, roleName string, data map[string]interface{}) {
+	t.Helper()
+	data["username"] = roleName
+	data["db_name"] = "mockv5"
+	data["rotation_period"] = "86400s"
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "static-roles/" + roleName,
+		Storage:   storage,
+		Data:      data,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatal(resp, err)
+	}
+}
+
+func readCredentials(t *testing.T, b *databaseBackend, storage logical.Storage, path string) *logical.Response {
+	t.Helper()
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      path,
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatal(resp, err)
+	}
+	return resp
+}
+
+func assertClientCertificate(t *testing.T, data map[string]interface{}, caCert string) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode([]byte(data["client_certificate"].(string)))
+	if block == nil {
+		t.Fatalf("expected a PEM-encoded certificate, got: %#v", data)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM([]byte(caCert))
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Fatalf("certificate not signed by the CA: %s", err)
+	}
+
+	if data["private_key"] == "" || data["private_key_type"] != "rsa" {
+		t.Fatalf("expected an rsa private key, got: %#v", data)
+	}
+	return cert
+}
+
+// testCredentialsCA returns the PEM-encoded certificate and private key of a
+// new self-signed CA
+func testCredentialsCA(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "database CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(24 * time.Hour * 7),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(cert), string(privateKey)
+}
@@ -336,9 +336,10 @@ func (b *databaseBackend) connectionWriteHandler() framework.OperationFunc {
 		b.clearConnection(name)
 
 		b.connections[name] = &dbPluginInstance{
-			database: dbw,
-			name:     name,
-			id:       id,
+			database:        dbw,
+			name:            name,
+			id:              id,
+			credentialTypes: initResp.SupportedCredentialTypes,
 		}
 
 		err = storeConfig(ctx, req.Storage, name, config)
@@ -77,6 +77,9 @@ func (b *databaseBackend) pathCredsCreateRead() framework.OperationFunc {
 		if err != nil {
 			return nil, err
 		}
+		if err := dbi.checkCredentialType(role.CredentialType); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
 
 		dbi.RLock()
 		defer dbi.RUnlock()
@@ -90,12 +93,6 @@ func (b *databaseBackend) pathCredsCreateRead() framework.OperationFunc {
 		// to ensure the database credential does not expire before the lease
 		expiration = expiration.Add(5 * time.Second)
 
-		password, err := dbi.database.GeneratePassword(ctx, b.System(), dbConfig.PasswordPolicy)
-		if err != nil {
-			b.CloseIfShutdown(dbi, err)
-			return nil, fmt.Errorf("unable to generate password: %w", err)
-		}
-
 		newUserReq := v5.NewUserRequest{
 			UsernameConfig: v5.UsernameMetadata{
 				DisplayName: req.DisplayName,
@@ -107,8 +104,46 @@ func (b *databaseBackend) pathCredsCreateRead() framework.OperationFunc {
 			RollbackStatements: v5.Statements{
 				Commands: role.Statements.Rollback,
 			},
-			Password:   password,
-			Expiration: expiration,
+			CredentialType: role.CredentialType,
+			Expiration:     expiration,
+		}
+
+		respData := make(map[string]interface{})
+
+		// Generate the credential based on the role's credential type
+		switch role.CredentialType {
+		case v5.CredentialTypePassword:
+			generator, err := newPasswordCredentialGenerator(role.CredentialConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to construct credential generator: %s", err)
+			}
+
+			password, err := generator.generate(ctx, dbi.database, b.System(), dbConfig.PasswordPolicy)
+			if err != nil {
+				b.CloseIfShutdown(dbi, err)
+				return nil, fmt.Errorf("unable to generate password: %w", err)
+			}
+			newUserReq.Password = password
+
+		case v5.CredentialTypeClientCertificate:
+			generator, err := newClientCertificateGenerator(role.CredentialConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to construct credential generator: %s", err)
+			}
+
+			commonName, err := generator.commonName(newUserReq.UsernameConfig)
+			if err != nil {
+				return nil, fmt.Errorf("unable to generate certificate common name: %w", err)
+			}
+
+			bundle, subject, err := generator.generate(b.GetRandomReader(), commonName, expiration)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate client certificate: %w", err)
+			}
+			newUserReq.Subject = subject
+			for k, v := range clientCertificateResponse(bundle.Certificate, bundle.PrivateKey, string(bundle.PrivateKeyType)) {
+				respData[k] = v
+			}
 		}
 
 		// Overwriting the password in the event this is a legacy database plugin and the provided password is ignored
@@ -118,10 +153,11 @@ func (b *databaseBackend) pathCredsCreateRead() framework.OperationFunc {
 			return nil, err
 		}
 
-		respData := map[string]interface{}{
-			"username": newUserResp.Username,
-			"password": password,
+		respData["username"] = newUserResp.Username
+		if role.CredentialType == v5.CredentialTypePassword {
+			respData["password"] = password
 		}
+
 		internal := map[string]interface{}{
 			"username":              newUserResp.Username,
 			"role":                  name,
@@ -131,6 +167,10 @@ func (b *databaseBackend) pathCredsCreateRead() framework.OperationFunc {
 		resp := b.Secret(SecretCredsType).Response(respData, internal)
 		resp.Secret.TTL = role.DefaultTTL
 		resp.Secret.MaxTTL = role.MaxTTL
+		if role.CredentialType == v5.CredentialTypeClientCertificate {
+			// The user can't outlive its certificate
+			resp.Secret.Renewable = false
+		}
 		return resp, nil
 	}
 }
@@ -158,14 +198,24 @@ func (b *databaseBackend) pathStaticCredsRead() framework.OperationFunc {
 			return nil, fmt.Errorf("%q is not an allowed role", name)
 		}
 
+		respData := map[string]interface{}{
+			"username":            role.StaticAccount.Username,
+			"ttl":                 role.StaticAccount.PasswordTTL().Seconds(),
+			"rotation_period":     role.StaticAccount.RotationPeriod.Seconds(),
+			"last_vault_rotation": role.StaticAccount.LastVaultRotation,
+		}
+
+		switch role.CredentialType {
+		case v5.CredentialTypePassword:
+			respData["password"] = role.StaticAccount.Password
+		case v5.CredentialTypeClientCertificate:
+			for k, v := range clientCertificateResponse(role.StaticAccount.ClientCertificate, string(role.StaticAccount.PrivateKey), role.StaticAccount.PrivateKeyType) {
+				respData[k] = v
+			}
+		}
+
 		return &logical.Response{
-			Data: map[string]interface{}{
-				"username":            role.StaticAccount.Username,
-				"password":            role.StaticAccount.Password,
-				"ttl":                 role.StaticAccount.PasswordTTL().Seconds(),
-				"rotation_period":     role.StaticAccount.RotationPeriod.Seconds(),
-				"last_vault_rotation": role.StaticAccount.LastVaultRotation,
-			},
+			Data: respData,
 		}, nil
 	}
 }
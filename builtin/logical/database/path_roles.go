@@ -9,6 +9,7 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/go-secure-stdlib/strutil"
 	v4 "github.com/hashicorp/vault/sdk/database/dbplugin"
+	v5 "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -88,6 +89,17 @@ func fieldsForType(roleType string) map[string]*framework.FieldSchema {
 			Type:        framework.TypeString,
 			Description: "Name of the database this role acts on.",
 		},
+		"credential_type": {
+			Type: framework.TypeString,
+			Description: `The type of credential to manage. Options include:
+	'password', 'client_certificate'. Defaults to 'password'.`,
+			Default: v5.CredentialTypePassword.String(),
+		},
+		"credential_config": {
+			Type: framework.TypeKVPairs,
+			Description: `The configuration for the given credential_type. See the
+	API documentation of the database secrets engine for the supported parameters.`,
+		},
 	}
 
 	// Get the fields that are specific to the type of role, and add them to the
@@ -252,6 +264,8 @@ func (b *databaseBackend) pathStaticRoleRead(ctx context.Context, req *logical.R
 	data := map[string]interface{}{
 		"db_name":             role.DBName,
 		"rotation_statements": role.Statements.Rotation,
+		"credential_type":     role.CredentialType.String(),
+		"credential_config":   role.credentialConfigForResponse(),
 	}
 
 	// guard against nil StaticAccount; shouldn't happen but we'll be safe
@@ -290,6 +304,8 @@ func (b *databaseBackend) pathRoleRead(ctx context.Context, req *logical.Request
 		"renew_statements":      role.Statements.Renewal,
 		"default_ttl":           role.DefaultTTL.Seconds(),
 		"max_ttl":               role.MaxTTL.Seconds(),
+		"credential_type":       role.CredentialType.String(),
+		"credential_config":     role.credentialConfigForResponse(),
 	}
 	if len(role.Statements.Creation) == 0 {
 		data["creation_statements"] = []string{}
@@ -393,6 +409,14 @@ func (b *databaseBackend) pathRoleCreateUpdate(ctx context.Context, req *logical
 
 	role.Statements.Revocation = strutil.RemoveEmpty(role.Statements.Revocation)
 
+	// Credentials
+	if resp := role.setCredentialFields(data, createOperation); resp != nil {
+		return resp, nil
+	}
+	if resp, err := b.checkCredentialType(ctx, req.Storage, role); resp != nil || err != nil {
+		return resp, err
+	}
+
 	// TTLs
 	{
 		if defaultTTLRaw, ok := data.GetOk("default_ttl"); ok {
@@ -499,6 +523,22 @@ func (b *databaseBackend) pathStaticRoleCreateUpdate(ctx context.Context, req *l
 		role.Statements.Rotation = data.Get("rotation_statements").([]string)
 	}
 
+	// The credential of the static account is only replaced on rotation, so
+	// its type can't change
+	if credentialTypeRaw, ok := data.GetOk("credential_type"); ok && !createRole && credentialTypeRaw.(string) != role.CredentialType.String() {
+		return logical.ErrorResponse("cannot change the credential_type of a static role"), nil
+	}
+	if resp := role.setCredentialFields(data, createRole); resp != nil {
+		return resp, nil
+	}
+	if resp, err := b.checkCredentialType(ctx, req.Storage, role); resp != nil || err != nil {
+		return resp, err
+	}
+	if role.CredentialType == v5.CredentialTypeClientCertificate && role.StaticAccount.RotationPeriod > maxClientCertificateRotationPeriod {
+		return logical.ErrorResponse(fmt.Sprintf("rotation_period must be %d seconds or less for the %s credential type",
+			int(maxClientCertificateRotationPeriod.Seconds()), v5.CredentialTypeClientCertificate)), nil
+	}
+
 	// lvr represents the roles' LastVaultRotation
 	lvr := role.StaticAccount.LastVaultRotation
 
@@ -558,11 +598,74 @@ func (b *databaseBackend) pathStaticRoleCreateUpdate(ctx context.Context, req *l
 }
 
 type roleEntry struct {
-	DBName        string         `json:"db_name"`
-	Statements    v4.Statements  `json:"statements"`
-	DefaultTTL    time.Duration  `json:"default_ttl"`
-	MaxTTL        time.Duration  `json:"max_ttl"`
-	StaticAccount *staticAccount `json:"static_account" mapstructure:"static_account"`
+	DBName           string                 `json:"db_name"`
+	Statements       v4.Statements          `json:"statements"`
+	DefaultTTL       time.Duration          `json:"default_ttl"`
+	MaxTTL           time.Duration          `json:"max_ttl"`
+	CredentialType   v5.CredentialType      `json:"credential_type"`
+	CredentialConfig map[string]interface{} `json:"credential_config"`
+	StaticAccount    *staticAccount         `json:"static_account" mapstructure:"static_account"`
+}
+
+// checkCredentialType returns an error response if the plugin of the role's
+// database doesn't support the credential type of the role. Such a plugin
+// would otherwise create users without any credential.
+func (b *databaseBackend) checkCredentialType(ctx context.Context, s logical.Storage, role *roleEntry) (*logical.Response, error) {
+	if role.CredentialType == v5.CredentialTypePassword {
+		return nil, nil
+	}
+
+	dbi, err := b.GetConnection(ctx, s, role.DBName)
+	if err != nil {
+		return nil, err
+	}
+	if err := dbi.checkCredentialType(role.CredentialType); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	return nil, nil
+}
+
+// setCredentialFields sets the credential type and config of the role from
+// the request, returning an error response if they are invalid
+func (r *roleEntry) setCredentialFields(data *framework.FieldData, createOperation bool) *logical.Response {
+	if credentialTypeRaw, ok := data.GetOk("credential_type"); ok || createOperation {
+		if !ok {
+			credentialTypeRaw = data.Get("credential_type")
+		}
+		credentialType, err := parseCredentialType(credentialTypeRaw.(string))
+		if err != nil {
+			return logical.ErrorResponse(err.Error())
+		}
+		r.CredentialType = credentialType
+	}
+
+	if credentialConfigRaw, ok := data.GetOk("credential_config"); ok {
+		r.CredentialConfig = make(map[string]interface{})
+		for k, v := range credentialConfigRaw.(map[string]string) {
+			r.CredentialConfig[k] = v
+		}
+	} else if createOperation {
+		r.CredentialConfig = nil
+	}
+
+	if err := validateCredentialConfig(r.CredentialType, r.CredentialConfig); err != nil {
+		return logical.ErrorResponse(err.Error())
+	}
+
+	return nil
+}
+
+// credentialConfigForResponse returns the credential config of the role
+// without its secret parameters
+func (r *roleEntry) credentialConfigForResponse() map[string]interface{} {
+	config := make(map[string]interface{}, len(r.CredentialConfig))
+	for k, v := range r.CredentialConfig {
+		if k == "ca_private_key" {
+			continue
+		}
+		config[k] = v
+	}
+	return config
 }
 
 type staticAccount struct {
@@ -574,6 +677,18 @@ type staticAccount struct {
 	// account. Return this on credential request if it exists.
 	Password string `json:"password"`
 
+	// PrivateKey is the current PEM-encoded private key for static accounts
+	// with the client_certificate credential type.
+	PrivateKey []byte `json:"private_key"`
+
+	// PrivateKeyType is the type of the private key of the client certificate
+	// for static accounts with the client_certificate credential type.
+	PrivateKeyType string `json:"private_key_type"`
+
+	// ClientCertificate is the current PEM-encoded client certificate for
+	// static accounts with the client_certificate credential type.
+	ClientCertificate string `json:"client_certificate"`
+
 	// LastVaultRotation represents the last time Vault rotated the password
 	LastVaultRotation time.Time `json:"last_vault_rotation"`
 
@@ -657,6 +772,13 @@ The "renew_statements" parameter customizes the statement string used to renew a
 user.
 The "rollback_statements' parameter customizes the statement string used to
 rollback a change if needed.
+
+The "credential_type" parameter selects the type of credential issued for the
+role: "password" (the default) or "client_certificate". Types other than
+"password" require the plugin of the database to support them. The
+"credential_config" parameter configures the credential type, e.g. the
+"password_policy" of passwords, or the "ca_cert" and "ca_private_key" signing
+client certificates.
 `
 
 const pathStaticRoleHelpDesc = `
@@ -697,4 +819,12 @@ The "renew_statements" parameter customizes the statement string used to renew a
 user.
 The "rollback_statements' parameter customizes the statement string used to
 rollback a change if needed.
+
+The "credential_type" parameter selects the type of credential managed for the
+static account: "password" (the default) or "client_certificate", and can't
+be changed once the role is created. Client certificates are issued with the
+username of the static account as their common name, and expire 5 seconds after
+the next scheduled rotation. Rotation doesn't revoke the previous certificate,
+which remains valid until it expires, so the "rotation_period" of roles with
+the "client_certificate" credential type can't exceed 24 hours.
 `
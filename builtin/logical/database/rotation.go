@@ -26,6 +26,11 @@ const (
 
 	// WAL storage key used for static account rotations
 	staticWALKey = "staticRotationKey"
+
+	// Longest rotation period of static accounts with the client_certificate
+	// credential type. Rotation doesn't revoke the previous certificate, so
+	// this bounds how long a superseded certificate remains valid.
+	maxClientCertificateRotationPeriod = 24 * time.Hour
 )
 
 // populateQueue loads the priority queue with existing static accounts. This
@@ -287,16 +292,20 @@ type setStaticAccountOutput struct {
 	WALID string
 }
 
-// setStaticAccount sets the password for a static account associated with a
+// setStaticAccount sets the credential for a static account associated with a
 // Role. This method does many things:
 // - verifies role exists and is in the allowed roles list
 // - loads an existing WAL entry if WALID input is given, otherwise creates a
 // new WAL entry
 // - gets a database connection
-// - accepts an input password, otherwise generates a new one via gRPC to the
-// database plugin
-// - sets new password for the static account
-// - uses WAL for ensuring passwords are not lost if storage to Vault fails
+// - accepts an input credential, otherwise generates a new one for the
+// credential type of the role
+// - sets new credential for the static account
+// - uses WAL for ensuring credentials are not lost if storage to Vault fails
+//
+// Client certificates are trusted by the database through their CA, so they
+// are rotated by issuing a new certificate without a WAL or a call to the
+// database plugin.
 //
 // This method does not perform any operations on the priority queue. Those
 // tasks must be handled outside of this method.
@@ -326,13 +335,20 @@ func (b *databaseBackend) setStaticAccount(ctx context.Context, s logical.Storag
 	if err != nil {
 		return output, err
 	}
+	if err := dbi.checkCredentialType(input.Role.CredentialType); err != nil {
+		return output, err
+	}
+
+	if input.Role.CredentialType == v5.CredentialTypeClientCertificate {
+		return b.setStaticAccountClientCertificate(ctx, s, input)
+	}
 
 	dbi.RLock()
 	defer dbi.RUnlock()
 
-	// Use password from input if available. This happens if we're restoring from
-	// a WAL item or processing the rotation queue with an item that has a WAL
-	// associated with it
+	// Use credential from input if available. This happens if we're restoring
+	// from a WAL item or processing the rotation queue with an item that has a
+	// WAL associated with it
 	var newPassword string
 	if output.WALID != "" {
 		wal, err := b.findStaticWAL(ctx, s, output.WALID)
@@ -341,29 +357,39 @@ func (b *databaseBackend) setStaticAccount(ctx context.Context, s logical.Storag
 		}
 
 		switch {
-		case wal != nil && wal.NewPassword != "":
+		case wal != nil && input.Role.CredentialType == v5.CredentialTypePassword && wal.NewPassword != "":
 			newPassword = wal.NewPassword
 		default:
 			if wal == nil {
 				b.Logger().Error("expected role to have WAL, but WAL not found in storage", "role", input.RoleName, "WAL ID", output.WALID)
 			} else {
-				b.Logger().Error("expected WAL to have a new password set, but empty", "role", input.RoleName, "WAL ID", output.WALID)
+				b.Logger().Error("expected WAL to have a new credential set, but empty", "role", input.RoleName, "WAL ID", output.WALID)
 				err = framework.DeleteWAL(ctx, s, output.WALID)
 				if err != nil {
-					b.Logger().Warn("failed to delete WAL with no new password", "error", err, "WAL ID", output.WALID)
+					b.Logger().Warn("failed to delete WAL with no new credential", "error", err, "WAL ID", output.WALID)
 				}
 			}
 			// If there's anything wrong with the WAL in storage, we'll need
-			// to generate a fresh WAL and password
+			// to generate a fresh WAL and credential
 			output.WALID = ""
 		}
 	}
 
 	if output.WALID == "" {
-		newPassword, err = dbi.database.GeneratePassword(ctx, b.System(), dbConfig.PasswordPolicy)
-		if err != nil {
-			return output, err
+		switch input.Role.CredentialType {
+		case v5.CredentialTypePassword:
+			generator, err := newPasswordCredentialGenerator(input.Role.CredentialConfig)
+			if err != nil {
+				return output, fmt.Errorf("failed to construct credential generator: %s", err)
+			}
+			newPassword, err = generator.generate(ctx, dbi.database, b.System(), dbConfig.PasswordPolicy)
+			if err != nil {
+				return output, err
+			}
+		default:
+			return output, fmt.Errorf("unsupported credential type %q", input.Role.CredentialType)
 		}
+
 		output.WALID, err = framework.PutWAL(ctx, s, staticWALKey, &setCredentialsWAL{
 			RoleName:          input.RoleName,
 			Username:          input.Role.StaticAccount.Username,
@@ -377,13 +403,18 @@ func (b *databaseBackend) setStaticAccount(ctx context.Context, s logical.Storag
 	}
 
 	updateReq := v5.UpdateUserRequest{
-		Username: input.Role.StaticAccount.Username,
-		Password: &v5.ChangePassword{
+		Username:       input.Role.StaticAccount.Username,
+		CredentialType: input.Role.CredentialType,
+	}
+	statements := v5.Statements{
+		Commands: input.Role.Statements.Rotation,
+	}
+	switch input.Role.CredentialType {
+	case v5.CredentialTypePassword:
+		updateReq.Password = &v5.ChangePassword{
 			NewPassword: newPassword,
-			Statements: v5.Statements{
-				Commands: input.Role.Statements.Rotation,
-			},
-		},
+			Statements:  statements,
+		}
 	}
 	_, err = dbi.database.UpdateUser(ctx, updateReq, false)
 	if err != nil {
@@ -417,6 +448,44 @@ func (b *databaseBackend) setStaticAccount(ctx context.Context, s logical.Storag
 	return &setStaticAccountOutput{RotationTime: lvr}, nil
 }
 
+// setStaticAccountClientCertificate issues a new client certificate for a
+// static account with the client_certificate credential type. The common name
+// of the certificate is the username of the static account, and the
+// certificate expires shortly after the next rotation.
+func (b *databaseBackend) setStaticAccountClientCertificate(ctx context.Context, s logical.Storage, input *setStaticAccountInput) (*setStaticAccountOutput, error) {
+	output := &setStaticAccountOutput{WALID: input.WALID}
+
+	generator, err := newClientCertificateGenerator(input.Role.CredentialConfig)
+	if err != nil {
+		return output, fmt.Errorf("failed to construct credential generator: %s", err)
+	}
+
+	// lvr is the known LastVaultRotation
+	lvr := time.Now()
+	// Adding a small buffer since the rotation is only checked periodically
+	notAfter := lvr.Add(input.Role.StaticAccount.RotationPeriod).Add(defaultQueueTickSeconds * time.Second)
+	bundle, _, err := generator.generate(b.GetRandomReader(), input.Role.StaticAccount.Username, notAfter)
+	if err != nil {
+		return output, fmt.Errorf("error issuing client certificate: %w", err)
+	}
+
+	input.Role.StaticAccount.LastVaultRotation = lvr
+	input.Role.StaticAccount.ClientCertificate = bundle.Certificate
+	input.Role.StaticAccount.PrivateKey = []byte(bundle.PrivateKey)
+	input.Role.StaticAccount.PrivateKeyType = string(bundle.PrivateKeyType)
+	output.RotationTime = lvr
+
+	entry, err := logical.StorageEntryJSON(databaseStaticRolePath+input.RoleName, input.Role)
+	if err != nil {
+		return output, err
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return output, err
+	}
+
+	return &setStaticAccountOutput{RotationTime: lvr}, nil
+}
+
 // initQueue preforms the necessary checks and initializations needed to perform
 // automatic credential rotation for roles associated with static accounts. This
 // method verifies if a queue is needed (primary server or local mount), and if
@@ -86,6 +86,9 @@ func (d databaseVersionWrapper) NewUser(ctx context.Context, req v5.NewUserReque
 	}
 
 	// v4 Database
+	if req.CredentialType != v5.CredentialTypePassword {
+		return v5.NewUserResponse{}, "", fmt.Errorf("the %s credential type is not supported by legacy database plugins", req.CredentialType)
+	}
 	stmts := v4.Statements{
 		Creation: req.Statements.Commands,
 		Rollback: req.RollbackStatements.Commands,
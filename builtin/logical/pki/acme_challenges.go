@@ -0,0 +1,284 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// acmeValidationAttempts and acmeValidationBackoff bound how long a
+	// challenge is retried, e.g. to allow for DNS propagation.
+	acmeValidationAttempts = 3
+	acmeValidationBackoff  = 10 * time.Second
+	acmeValidationTimeout  = 10 * time.Second
+
+	acmeTLSALPNProtocol = "acme-tls/1"
+)
+
+// idPeAcmeIdentifier is the certificate extension carrying the key
+// authorization digest in tls-alpn-01 challenges, RFC 8737 Section 3.
+var idPeAcmeIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+func acmeChallengeTypes(identifier acmeIdentifier, wildcard bool) []string {
+	switch {
+	case identifier.Type == acmeIdentifierIP:
+		return []string{acmeChallengeHTTP01}
+	case wildcard:
+		return []string{acmeChallengeDNS01}
+	default:
+		return []string{acmeChallengeHTTP01, acmeChallengeDNS01, acmeChallengeTLSALPN01}
+	}
+}
+
+// validateAcmeChallenge performs a single validation attempt of the given
+// challenge, returning a problem describing why it failed, if it did.
+func validateAcmeChallenge(ctx context.Context, config *acmeConfigEntry, authz *acmeAuthorization, challenge *acmeChallenge, keyAuth string) *acmeProblem {
+	ctx, cancel := context.WithTimeout(ctx, acmeValidationTimeout)
+	defer cancel()
+
+	var err error
+	switch challenge.Type {
+	case acmeChallengeHTTP01:
+		host := authz.Identifier.Value
+		if authz.Identifier.Type == acmeIdentifierIP && strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		err = validateHTTP01Challenge(ctx, host, challenge.Token, keyAuth)
+	case acmeChallengeDNS01:
+		err = validateDNS01Challenge(ctx, acmeResolver(config), authz.Identifier.Value, keyAuth)
+	case acmeChallengeTLSALPN01:
+		err = validateTLSALPN01Challenge(ctx, net.JoinHostPort(authz.Identifier.Value, "443"), authz.Identifier.Value, keyAuth)
+	default:
+		err = fmt.Errorf("unsupported challenge type %q", challenge.Type)
+	}
+	if err == nil {
+		return nil
+	}
+
+	if problem, ok := err.(*acmeProblem); ok {
+		return problem
+	}
+	return newAcmeProblem("connection", http.StatusBadRequest, "%v", err)
+}
+
+func acmeResolver(config *acmeConfigEntry) *net.Resolver {
+	if config.DNSResolver == "" {
+		return net.DefaultResolver
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, config.DNSResolver)
+		},
+	}
+}
+
+// validateHTTP01Challenge fetches the key authorization from the well-known
+// location on the given host, RFC 8555 Section 8.3.
+func validateHTTP01Challenge(ctx context.Context, host, token, keyAuth string) error {
+	url := fmt.Sprintf("http://%s/.well-known/acme-challenge/%s", host, token)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("refusing to follow redirect to %q", req.URL.Scheme)
+			}
+			return nil
+		},
+		Transport: &http.Transport{
+			// The certificate served by the target is not yet trusted;
+			// that is what the client is trying to obtain.
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newAcmeProblem("unauthorized", http.StatusForbidden, "unexpected status %d fetching %s", resp.StatusCode, url)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", url, err)
+	}
+
+	if subtle.ConstantTimeCompare(bytes.TrimSpace(body), []byte(keyAuth)) != 1 {
+		return newAcmeProblem("unauthorized", http.StatusForbidden, "key authorization served at %s does not match", url)
+	}
+
+	return nil
+}
+
+// validateDNS01Challenge looks for the digest of the key authorization in
+// the _acme-challenge TXT record of the domain, RFC 8555 Section 8.4.
+func validateDNS01Challenge(ctx context.Context, resolver *net.Resolver, domain, keyAuth string) error {
+	digest := sha256.Sum256([]byte(keyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(digest[:])
+
+	name := "_acme-challenge." + domain
+	records, err := resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return newAcmeProblem("dns", http.StatusBadRequest, "error looking up TXT records for %s: %v", name, err)
+	}
+
+	for _, record := range records {
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(record)), []byte(expected)) == 1 {
+			return nil
+		}
+	}
+
+	return newAcmeProblem("unauthorized", http.StatusForbidden, "no TXT record for %s matches the key authorization", name)
+}
+
+// validateTLSALPN01Challenge connects to addr negotiating the acme-tls/1
+// protocol and checks the presented certificate, RFC 8737 Section 3.
+func validateTLSALPN01Challenge(ctx context.Context, addr, domain, keyAuth string) error {
+	dialer := &tls.Dialer{
+		Config: &tls.Config{
+			ServerName: domain,
+			NextProtos: []string{acmeTLSALPNProtocol},
+			// The validation certificate is self-signed by design.
+			InsecureSkipVerify: true,
+		},
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	if state.NegotiatedProtocol != acmeTLSALPNProtocol {
+		return newAcmeProblem("unauthorized", http.StatusForbidden, "%s did not negotiate the %s protocol", addr, acmeTLSALPNProtocol)
+	}
+	if len(state.PeerCertificates) == 0 {
+		return newAcmeProblem("unauthorized", http.StatusForbidden, "%s presented no certificate", addr)
+	}
+
+	return checkTLSALPN01Certificate(state.PeerCertificates[0], domain, keyAuth)
+}
+
+func checkTLSALPN01Certificate(cert *x509.Certificate, domain, keyAuth string) error {
+	if len(cert.DNSNames) != 1 || !strings.EqualFold(cert.DNSNames[0], domain) {
+		return newAcmeProblem("unauthorized", http.StatusForbidden, "validation certificate must contain exactly the name %s", domain)
+	}
+
+	digest := sha256.Sum256([]byte(keyAuth))
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(idPeAcmeIdentifier) {
+			continue
+		}
+		if !ext.Critical {
+			return newAcmeProblem("unauthorized", http.StatusForbidden, "acmeIdentifier extension must be critical")
+		}
+
+		var value []byte
+		rest, err := asn1.Unmarshal(ext.Value, &value)
+		if err != nil || len(rest) > 0 {
+			return newAcmeProblem("unauthorized", http.StatusForbidden, "malformed acmeIdentifier extension")
+		}
+		if subtle.ConstantTimeCompare(value, digest[:]) != 1 {
+			return newAcmeProblem("unauthorized", http.StatusForbidden, "acmeIdentifier extension does not match the key authorization")
+		}
+		return nil
+	}
+
+	return newAcmeProblem("unauthorized", http.StatusForbidden, "validation certificate lacks the acmeIdentifier extension")
+}
+
+// runAcmeValidation validates a challenge in the background, retrying a
+// few times before marking the challenge and its authorization invalid.
+func (b *backend) runAcmeValidation(s logical.Storage, config *acmeConfigEntry, accountID, authzID, challengeType, keyAuth string) {
+	ctx := context.Background()
+
+	var problem *acmeProblem
+	for attempt := 0; attempt < acmeValidationAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(acmeValidationBackoff)
+		}
+
+		authz, err := getAcmeAuthorization(ctx, s, accountID, authzID)
+		if err != nil || authz == nil {
+			b.Logger().Error("unable to load ACME authorization for validation", "authorization", authzID, "error", err)
+			return
+		}
+
+		challenge := findAcmeChallenge(authz, challengeType)
+		if challenge == nil || challenge.Status != acmeStatusProcessing {
+			return
+		}
+
+		problem = validateAcmeChallenge(ctx, config, authz, challenge, keyAuth)
+		if problem == nil {
+			break
+		}
+		b.Logger().Debug("ACME challenge validation failed", "authorization", authzID, "type", challengeType, "attempt", attempt+1, "error", problem)
+	}
+
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	authz, err := getAcmeAuthorization(ctx, s, accountID, authzID)
+	if err != nil || authz == nil {
+		b.Logger().Error("unable to load ACME authorization for validation", "authorization", authzID, "error", err)
+		return
+	}
+	challenge := findAcmeChallenge(authz, challengeType)
+	if challenge == nil || challenge.Status != acmeStatusProcessing {
+		return
+	}
+
+	if problem == nil {
+		challenge.Status = acmeStatusValid
+		challenge.Validated = time.Now().UTC()
+		authz.Status = acmeStatusValid
+	} else {
+		challenge.Status = acmeStatusInvalid
+		challenge.Error = problem
+		authz.Status = acmeStatusInvalid
+	}
+
+	if err := putAcmeEntry(ctx, s, acmeAuthorizationPath(accountID, authzID), authz); err != nil {
+		b.Logger().Error("unable to store ACME authorization", "authorization", authzID, "error", err)
+	}
+}
+
+func findAcmeChallenge(authz *acmeAuthorization, challengeType string) *acmeChallenge {
+	for _, challenge := range authz.Challenges {
+		if challenge.Type == challengeType {
+			return challenge
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,308 @@
+package pki
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/logical"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const (
+	acmeNonceLifetime = 30 * time.Minute
+	acmeNonceKeyPath  = "acme/nonce-key"
+
+	acmeNonceTimeSize   = 8
+	acmeNonceRandomSize = 16
+)
+
+// acmeNonces tracks the anti-replay nonces handed out to ACME clients.
+// Nonces are self-contained: they carry the time they were issued at, and
+// are authenticated with an HMAC keyed by a secret which the nodes of the
+// cluster share through storage, so that any node accepts the nonces issued
+// by another one behind a load balancer. Each node remembers the nonces
+// redeemed on it until they expire, so that they can't be replayed to it.
+type acmeNonces struct {
+	lock     sync.Mutex
+	key      []byte
+	redeemed map[string]time.Time
+}
+
+func newAcmeNonces() *acmeNonces {
+	return &acmeNonces{
+		redeemed: make(map[string]time.Time),
+	}
+}
+
+// acmeNonceKey returns the key authenticating nonces, generating it on
+// first use. Performance standbys can't persist the key, so their requests
+// are forwarded to the active node until it exists.
+func (b *backend) acmeNonceKey(ctx context.Context, s logical.Storage) ([]byte, error) {
+	n := b.acmeNonces
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.key != nil {
+		return n.key, nil
+	}
+
+	entry, err := s.Get(ctx, acmeNonceKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		n.key = entry.Value
+		return n.key, nil
+	}
+
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) {
+		return nil, logical.ErrReadOnly
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := s.Put(ctx, &logical.StorageEntry{Key: acmeNonceKeyPath, Value: key}); err != nil {
+		return nil, err
+	}
+	n.key = key
+
+	return n.key, nil
+}
+
+func acmeNonceMAC(key []byte, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (b *backend) getAcmeNonce(ctx context.Context, s logical.Storage) (string, error) {
+	key, err := b.acmeNonceKey(ctx, s)
+	if err != nil {
+		return "", err
+	}
+
+	raw := make([]byte, acmeNonceTimeSize+acmeNonceRandomSize)
+	binary.BigEndian.PutUint64(raw, uint64(time.Now().Unix()))
+	if _, err := rand.Read(raw[acmeNonceTimeSize:]); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(append(raw, acmeNonceMAC(key, raw)...)), nil
+}
+
+// redeemAcmeNonce consumes the given nonce, returning whether it was valid.
+func (b *backend) redeemAcmeNonce(ctx context.Context, s logical.Storage, nonce string) (bool, error) {
+	key, err := b.acmeNonceKey(ctx, s)
+	if err != nil {
+		return false, err
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(decoded) != acmeNonceTimeSize+acmeNonceRandomSize+sha256.Size {
+		return false, nil
+	}
+	raw, mac := decoded[:acmeNonceTimeSize+acmeNonceRandomSize], decoded[acmeNonceTimeSize+acmeNonceRandomSize:]
+	if !hmac.Equal(mac, acmeNonceMAC(key, raw)) {
+		return false, nil
+	}
+
+	now := time.Now()
+	expires := time.Unix(int64(binary.BigEndian.Uint64(raw)), 0).Add(acmeNonceLifetime)
+	if !now.Before(expires) {
+		return false, nil
+	}
+
+	n := b.acmeNonces
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for existing, existingExpires := range n.redeemed {
+		if now.After(existingExpires) {
+			delete(n.redeemed, existing)
+		}
+	}
+	if _, ok := n.redeemed[nonce]; ok {
+		return false, nil
+	}
+	n.redeemed[nonce] = expires
+
+	return true, nil
+}
+
+// acmeSignatureAlgorithms are the JWS algorithms accepted from clients;
+// RFC 8555 Section 6.2 forbids "none" and MAC-based algorithms.
+var acmeSignatureAlgorithms = map[string]bool{
+	string(jose.RS256): true,
+	string(jose.PS256): true,
+	string(jose.ES256): true,
+	string(jose.ES384): true,
+	string(jose.ES512): true,
+	string(jose.EdDSA): true,
+}
+
+// acmeRequest is a verified ACME request: the JWS payload along with the
+// key which signed it and, for requests using "kid", the owning account.
+type acmeRequest struct {
+	Payload []byte
+	JWK     *jose.JSONWebKey
+	Account *acmeAccount
+}
+
+// IsPostAsGet reports whether this is a POST-as-GET request, RFC 8555
+// Section 6.3.
+func (r *acmeRequest) IsPostAsGet() bool {
+	return len(r.Payload) == 0
+}
+
+func (r *acmeRequest) decodePayload(out interface{}) error {
+	if r.IsPostAsGet() {
+		return acmeMalformed("request payload is empty")
+	}
+	if err := json.Unmarshal(r.Payload, out); err != nil {
+		return acmeMalformed("unable to parse request payload: %v", err)
+	}
+
+	return nil
+}
+
+func addAcmeJWSFields(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["protected"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `ACME JWS protected header.`,
+	}
+	fields["payload"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `ACME JWS payload.`,
+	}
+	fields["signature"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `ACME JWS signature.`,
+	}
+	return fields
+}
+
+// acmeKeyMode specifies how an ACME request identifies its signing key.
+type acmeKeyMode int
+
+const (
+	// acmeKeyID requests reference an existing account through "kid".
+	acmeKeyID acmeKeyMode = iota
+	// acmeKeyJWK requests carry their public key in the "jwk" header.
+	acmeKeyJWK
+	// acmeKeyAny requests may use either; only revokeCert allows this.
+	acmeKeyAny
+)
+
+// verifyAcmeJWS verifies the flattened JWS making up the body of an ACME
+// request, per RFC 8555 Section 6.2.
+func (b *backend) verifyAcmeJWS(ctx context.Context, acmeCtx *acmeContext, req *logical.Request, data *framework.FieldData, mode acmeKeyMode) (*acmeRequest, error) {
+	rawJWS, err := json.Marshal(map[string]string{
+		"protected": data.Get("protected").(string),
+		"payload":   data.Get("payload").(string),
+		"signature": data.Get("signature").(string),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := jose.ParseSigned(string(rawJWS))
+	if err != nil {
+		return nil, acmeMalformed("unable to parse JWS: %v", err)
+	}
+	if len(sig.Signatures) != 1 {
+		return nil, acmeMalformed("JWS must carry exactly one signature")
+	}
+	header := sig.Signatures[0].Protected
+
+	if !acmeSignatureAlgorithms[header.Algorithm] {
+		return nil, newAcmeProblem("badSignatureAlgorithm", http.StatusBadRequest, "unsupported JWS algorithm %q", header.Algorithm)
+	}
+
+	validNonce, err := b.redeemAcmeNonce(ctx, req.Storage, header.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	if !validNonce {
+		return nil, newAcmeProblem("badNonce", http.StatusBadRequest, "invalid or expired nonce")
+	}
+
+	url, _ := header.ExtraHeaders["url"].(string)
+	if url == "" || url != acmeCtx.baseURL+"/"+strings.TrimPrefix(req.Path, acmeCtx.pathPrefix) {
+		return nil, newAcmeProblem("unauthorized", http.StatusUnauthorized, "JWS url header %q does not match the request URL", url)
+	}
+
+	result := &acmeRequest{}
+	switch {
+	case mode != acmeKeyID && header.JSONWebKey != nil && header.KeyID == "":
+		if !header.JSONWebKey.Valid() || !header.JSONWebKey.IsPublic() {
+			return nil, acmeMalformed("invalid JWK in request")
+		}
+		result.JWK = header.JSONWebKey
+
+	case mode != acmeKeyJWK && header.KeyID != "" && header.JSONWebKey == nil:
+		accountURLPrefix := acmeCtx.baseURL + "/account/"
+		if !strings.HasPrefix(header.KeyID, accountURLPrefix) {
+			return nil, newAcmeProblem("accountDoesNotExist", http.StatusBadRequest, "unknown account %q", header.KeyID)
+		}
+
+		account, err := getAcmeAccount(ctx, req.Storage, strings.TrimPrefix(header.KeyID, accountURLPrefix))
+		if err != nil {
+			return nil, err
+		}
+		if account == nil {
+			return nil, newAcmeProblem("accountDoesNotExist", http.StatusBadRequest, "unknown account %q", header.KeyID)
+		}
+		if account.Status != acmeStatusValid {
+			return nil, acmeUnauthorized("account is %s", account.Status)
+		}
+
+		var jwk jose.JSONWebKey
+		if err := jwk.UnmarshalJSON(account.JWK); err != nil {
+			return nil, err
+		}
+		result.JWK = &jwk
+		result.Account = account
+
+	case mode == acmeKeyJWK:
+		return nil, acmeMalformed("request must be signed with a \"jwk\" header and no \"kid\"")
+
+	case mode == acmeKeyID:
+		return nil, acmeMalformed("request must be signed with a \"kid\" header and no \"jwk\"")
+
+	default:
+		return nil, acmeMalformed("request must be signed with exactly one of a \"jwk\" or \"kid\" header")
+	}
+
+	payload, err := sig.Verify(result.JWK)
+	if err != nil {
+		return nil, acmeMalformed("JWS signature verification failed")
+	}
+	result.Payload = payload
+
+	return result, nil
+}
+
+// acmeThumbprint returns the RFC 7638 thumbprint of the key, which doubles
+// as the identifier of the account using it.
+func acmeThumbprint(jwk *jose.JSONWebKey) (string, error) {
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
@@ -0,0 +1,244 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	acmeAccountPrefix = "acme/accounts/"
+	acmeCertPrefix    = "acme/certs/"
+
+	// Lifetimes of pending ACME objects; once expired, clients have to
+	// start over with a new order.
+	acmeOrderLifetime         = 24 * time.Hour
+	acmeAuthorizationLifetime = 24 * time.Hour
+)
+
+// ACME object statuses, RFC 8555 Section 7.1.6.
+const (
+	acmeStatusPending     = "pending"
+	acmeStatusProcessing  = "processing"
+	acmeStatusReady       = "ready"
+	acmeStatusValid       = "valid"
+	acmeStatusInvalid     = "invalid"
+	acmeStatusDeactivated = "deactivated"
+	acmeStatusExpired     = "expired"
+	acmeStatusRevoked     = "revoked"
+)
+
+// ACME identifier and challenge types.
+const (
+	acmeIdentifierDNS = "dns"
+	acmeIdentifierIP  = "ip"
+
+	acmeChallengeHTTP01    = "http-01"
+	acmeChallengeDNS01     = "dns-01"
+	acmeChallengeTLSALPN01 = "tls-alpn-01"
+)
+
+// acmeProblem is an RFC 7807 problem document, as used by ACME to report
+// errors to clients.
+type acmeProblem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+func (p *acmeProblem) Error() string {
+	return fmt.Sprintf("%s: %s", p.Type, p.Detail)
+}
+
+func newAcmeProblem(errType string, status int, format string, args ...interface{}) *acmeProblem {
+	return &acmeProblem{
+		Type:   "urn:ietf:params:acme:error:" + errType,
+		Detail: fmt.Sprintf(format, args...),
+		Status: status,
+	}
+}
+
+func acmeMalformed(format string, args ...interface{}) *acmeProblem {
+	return newAcmeProblem("malformed", http.StatusBadRequest, format, args...)
+}
+
+func acmeUnauthorized(format string, args ...interface{}) *acmeProblem {
+	return newAcmeProblem("unauthorized", http.StatusForbidden, format, args...)
+}
+
+func acmeNotFound(format string, args ...interface{}) *acmeProblem {
+	return newAcmeProblem("malformed", http.StatusNotFound, format, args...)
+}
+
+type acmeAccount struct {
+	ID                   string    `json:"id"`
+	Status               string    `json:"status"`
+	Contact              []string  `json:"contact"`
+	TermsOfServiceAgreed bool      `json:"terms_of_service_agreed"`
+	JWK                  []byte    `json:"jwk"`
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+type acmeIdentifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type acmeOrder struct {
+	ID                string           `json:"id"`
+	AccountID         string           `json:"account_id"`
+	Role              string           `json:"role"`
+	Status            string           `json:"status"`
+	Expires           time.Time        `json:"expires"`
+	Identifiers       []acmeIdentifier `json:"identifiers"`
+	AuthorizationIDs  []string         `json:"authorization_ids"`
+	CertificateSerial string           `json:"certificate_serial"`
+	Certificate       string           `json:"certificate"`
+	Error             *acmeProblem     `json:"error,omitempty"`
+}
+
+type acmeChallenge struct {
+	Type      string       `json:"type"`
+	Status    string       `json:"status"`
+	Token     string       `json:"token"`
+	Validated time.Time    `json:"validated"`
+	Error     *acmeProblem `json:"error,omitempty"`
+}
+
+type acmeAuthorization struct {
+	ID         string           `json:"id"`
+	AccountID  string           `json:"account_id"`
+	Identifier acmeIdentifier   `json:"identifier"`
+	Wildcard   bool             `json:"wildcard"`
+	Status     string           `json:"status"`
+	Expires    time.Time        `json:"expires"`
+	Challenges []*acmeChallenge `json:"challenges"`
+}
+
+// acmeCertEntry records which account requested a certificate, so that the
+// account may later revoke it.
+type acmeCertEntry struct {
+	AccountID string `json:"account_id"`
+	OrderID   string `json:"order_id"`
+}
+
+func acmeAccountPath(accountID string) string {
+	return acmeAccountPrefix + accountID
+}
+
+func acmeOrderPath(accountID, orderID string) string {
+	return acmeAccountPrefix + accountID + "/orders/" + orderID
+}
+
+func acmeAuthorizationPath(accountID, authzID string) string {
+	return acmeAccountPrefix + accountID + "/authorizations/" + authzID
+}
+
+func getAcmeEntry(ctx context.Context, s logical.Storage, path string, out interface{}) (bool, error) {
+	entry, err := s.Get(ctx, path)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		return false, nil
+	}
+
+	if err := entry.DecodeJSON(out); err != nil {
+		return false, fmt.Errorf("unable to decode ACME entry %q: %w", path, err)
+	}
+
+	return true, nil
+}
+
+func putAcmeEntry(ctx context.Context, s logical.Storage, path string, in interface{}) error {
+	entry, err := logical.StorageEntryJSON(path, in)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+func getAcmeAccount(ctx context.Context, s logical.Storage, accountID string) (*acmeAccount, error) {
+	var account acmeAccount
+	found, err := getAcmeEntry(ctx, s, acmeAccountPath(accountID), &account)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+func getAcmeOrder(ctx context.Context, s logical.Storage, accountID, orderID string) (*acmeOrder, error) {
+	var order acmeOrder
+	found, err := getAcmeEntry(ctx, s, acmeOrderPath(accountID, orderID), &order)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+func getAcmeAuthorization(ctx context.Context, s logical.Storage, accountID, authzID string) (*acmeAuthorization, error) {
+	var authz acmeAuthorization
+	found, err := getAcmeEntry(ctx, s, acmeAuthorizationPath(accountID, authzID), &authz)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	return &authz, nil
+}
+
+// refreshAcmeOrderStatus updates the status of a pending or ready order
+// from the statuses of its authorizations.
+func refreshAcmeOrderStatus(ctx context.Context, s logical.Storage, order *acmeOrder) error {
+	if order.Status != acmeStatusPending && order.Status != acmeStatusReady {
+		return nil
+	}
+
+	newStatus := acmeStatusReady
+	if time.Now().After(order.Expires) {
+		newStatus = acmeStatusInvalid
+	} else {
+		for _, authzID := range order.AuthorizationIDs {
+			authz, err := getAcmeAuthorization(ctx, s, order.AccountID, authzID)
+			if err != nil {
+				return err
+			}
+			if authz == nil {
+				newStatus = acmeStatusInvalid
+				break
+			}
+
+			refreshAcmeAuthorizationStatus(authz)
+			switch authz.Status {
+			case acmeStatusValid:
+			case acmeStatusPending:
+				newStatus = acmeStatusPending
+			default:
+				newStatus = acmeStatusInvalid
+			}
+			if newStatus == acmeStatusInvalid {
+				break
+			}
+		}
+	}
+
+	if newStatus == order.Status {
+		return nil
+	}
+
+	order.Status = newStatus
+	return putAcmeEntry(ctx, s, acmeOrderPath(order.AccountID, order.ID), order)
+}
+
+// refreshAcmeAuthorizationStatus expires pending authorizations past their
+// expiry time. Expired authorizations are persisted on their next write.
+func refreshAcmeAuthorizationStatus(authz *acmeAuthorization) {
+	if authz.Status == acmeStatusPending && time.Now().After(authz.Expires) {
+		authz.Status = acmeStatusExpired
+	}
+}
@@ -0,0 +1,590 @@
+package pki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/logical"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const acmeTestBaseURL = "https://vault.example.com/v1/pki"
+
+type acmeTestClient struct {
+	t       *testing.T
+	b       *backend
+	storage logical.Storage
+	key     *ecdsa.PrivateKey
+	kid     string
+}
+
+func (c *acmeTestClient) nonce() string {
+	resp, err := c.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "acme/new-nonce",
+		Storage:   c.storage,
+	})
+	if err != nil || resp == nil {
+		c.t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data[logical.HTTPStatusCode] != http.StatusNoContent {
+		c.t.Fatalf("unexpected new-nonce response: %#v", resp.Data)
+	}
+	return resp.Headers["Replay-Nonce"][0]
+}
+
+// sign returns the flattened JWS making up the body of a request to the
+// given ACME path.
+func (c *acmeTestClient) sign(path, nonce string, payload interface{}) map[string]interface{} {
+	var rawPayload []byte
+	if payload != nil {
+		var err error
+		rawPayload, err = json.Marshal(payload)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+	}
+
+	opts := &jose.SignerOptions{}
+	opts.WithHeader("url", acmeTestBaseURL+"/"+path)
+	opts.WithHeader("nonce", nonce)
+
+	signingKey := jose.JSONWebKey{Key: c.key}
+	if c.kid != "" {
+		signingKey.KeyID = c.kid
+	} else {
+		opts.EmbedJWK = true
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: signingKey}, opts)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	jws, err := signer.Sign(rawPayload)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(jws.FullSerialize()), &data); err != nil {
+		c.t.Fatal(err)
+	}
+	return data
+}
+
+// post sends a JWS-signed request to the given ACME path, returning the
+// response status, decoded body and the response itself.
+func (c *acmeTestClient) post(path string, payload interface{}) (int, map[string]interface{}, *logical.Response) {
+	data := c.sign(path, c.nonce(), payload)
+
+	resp, err := c.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      path,
+		Storage:   c.storage,
+		Data:      data,
+	})
+	if err != nil || resp == nil {
+		c.t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if len(resp.Headers["Replay-Nonce"]) != 1 {
+		c.t.Fatalf("expected a Replay-Nonce header: %#v", resp.Headers)
+	}
+
+	var body map[string]interface{}
+	if raw, ok := resp.Data[logical.HTTPRawBody].([]byte); ok && resp.Data[logical.HTTPContentType] != "application/pem-certificate-chain" {
+		if err := json.Unmarshal(raw, &body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+
+	return resp.Data[logical.HTTPStatusCode].(int), body, resp
+}
+
+func setupAcmeBackend(t *testing.T) (*backend, logical.Storage) {
+	b, storage := createBackendWithStorage(t)
+
+	requests := []*logical.Request{
+		{
+			Path: "root/generate/internal",
+			Data: map[string]interface{}{
+				"common_name": "root.example.com",
+				"ttl":         "48h",
+			},
+		},
+		{
+			Path: "roles/acme",
+			Data: map[string]interface{}{
+				"allowed_domains":  "example.com",
+				"allow_subdomains": true,
+				"key_type":         "ec",
+				"key_bits":         256,
+				"ttl":              "1h",
+			},
+		},
+		{
+			Path: "config/acme",
+			Data: map[string]interface{}{
+				"enabled":      true,
+				"base_url":     acmeTestBaseURL + "/",
+				"default_role": "acme",
+			},
+		},
+	}
+	for _, req := range requests {
+		req.Operation = logical.UpdateOperation
+		req.Storage = storage
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %s: err: %v resp: %#v", req.Path, err, resp)
+		}
+	}
+
+	return b, storage
+}
+
+func TestPki_AcmeDirectory(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	// ACME is disabled until configured
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "acme/directory",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data[logical.HTTPStatusCode] != http.StatusForbidden {
+		t.Fatalf("expected ACME to be disabled: %#v", resp.Data)
+	}
+
+	b, storage = setupAcmeBackend(t)
+
+	for path, base := range map[string]string{
+		"acme/directory":            acmeTestBaseURL + "/acme",
+		"roles/acme/acme/directory": acmeTestBaseURL + "/roles/acme/acme",
+	} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      path,
+			Storage:   storage,
+		})
+		if err != nil || resp == nil {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+
+		var directory map[string]interface{}
+		if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &directory); err != nil {
+			t.Fatal(err)
+		}
+		if directory["newAccount"] != base+"/new-account" || directory["newOrder"] != base+"/new-order" {
+			t.Fatalf("unexpected directory for %s: %#v", path, directory)
+		}
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roles/missing/acme/directory",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data[logical.HTTPStatusCode] != http.StatusNotFound {
+		t.Fatalf("expected unknown role to be rejected: %#v", resp.Data)
+	}
+
+	// Clients may fetch nonces with HEAD requests
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.HeaderOperation,
+		Path:      "acme/new-nonce",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || len(resp.Headers["Replay-Nonce"]) != 1 {
+		t.Fatalf("expected a nonce: err: %v resp: %#v", err, resp)
+	}
+}
+
+func TestPki_AcmeOrderFlow(t *testing.T) {
+	b, storage := setupAcmeBackend(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &acmeTestClient{t: t, b: b, storage: storage, key: key}
+
+	// Unknown accounts are not created when only looking them up
+	status, body, _ := client.post("acme/new-account", map[string]interface{}{
+		"onlyReturnExisting": true,
+	})
+	if status != http.StatusBadRequest || body["type"] != "urn:ietf:params:acme:error:accountDoesNotExist" {
+		t.Fatalf("unexpected response: %d %#v", status, body)
+	}
+
+	status, body, resp := client.post("acme/new-account", map[string]interface{}{
+		"contact":              []string{"mailto:admin@example.com"},
+		"termsOfServiceAgreed": true,
+	})
+	if status != http.StatusCreated || body["status"] != acmeStatusValid {
+		t.Fatalf("unexpected response: %d %#v", status, body)
+	}
+	client.kid = resp.Headers["Location"][0]
+
+	// Registering the same key again returns the existing account
+	kid := client.kid
+	client.kid = ""
+	status, _, resp = client.post("acme/new-account", map[string]interface{}{})
+	if status != http.StatusOK || resp.Headers["Location"][0] != kid {
+		t.Fatalf("unexpected response: %d %#v", status, resp.Headers)
+	}
+	client.kid = kid
+
+	// Names outside of the role are rejected upfront
+	status, body, _ = client.post("acme/new-order", map[string]interface{}{
+		"identifiers": []acmeIdentifier{{Type: "dns", Value: "www.example.org"}},
+	})
+	if status != http.StatusBadRequest || body["type"] != "urn:ietf:params:acme:error:rejectedIdentifier" {
+		t.Fatalf("unexpected response: %d %#v", status, body)
+	}
+
+	status, order, resp := client.post("acme/new-order", map[string]interface{}{
+		"identifiers": []acmeIdentifier{{Type: "dns", Value: "www.example.com"}},
+	})
+	if status != http.StatusCreated || order["status"] != acmeStatusPending {
+		t.Fatalf("unexpected response: %d %#v", status, order)
+	}
+	orderPath := strings.TrimPrefix(resp.Headers["Location"][0], acmeTestBaseURL+"/")
+
+	authzURLs := order["authorizations"].([]interface{})
+	if len(authzURLs) != 1 {
+		t.Fatalf("expected a single authorization: %#v", order)
+	}
+	authzPath := strings.TrimPrefix(authzURLs[0].(string), acmeTestBaseURL+"/")
+	status, authz, _ := client.post(authzPath, nil)
+	if status != http.StatusOK || len(authz["challenges"].([]interface{})) != 3 {
+		t.Fatalf("unexpected response: %d %#v", status, authz)
+	}
+
+	// Finalizing before the authorization is valid fails
+	csr := acmeTestCSR(t, "www.example.com")
+	status, body, _ = client.post(orderPath+"/finalize", map[string]interface{}{"csr": csr})
+	if status != http.StatusForbidden || body["type"] != "urn:ietf:params:acme:error:orderNotReady" {
+		t.Fatalf("unexpected response: %d %#v", status, body)
+	}
+
+	// Mark the authorization as validated, as background validation would
+	authzID := authzPath[strings.LastIndex(authzPath, "/")+1:]
+	authzEntry, err := getAcmeAuthorization(context.Background(), storage, strings.TrimPrefix(kid, acmeTestBaseURL+"/acme/account/"), authzID)
+	if err != nil || authzEntry == nil {
+		t.Fatalf("bad: err: %v authz: %#v", err, authzEntry)
+	}
+	authzEntry.Status = acmeStatusValid
+	authzEntry.Challenges[0].Status = acmeStatusValid
+	if err := putAcmeEntry(context.Background(), storage, acmeAuthorizationPath(authzEntry.AccountID, authzEntry.ID), authzEntry); err != nil {
+		t.Fatal(err)
+	}
+
+	status, order, _ = client.post(orderPath, nil)
+	if status != http.StatusOK || order["status"] != acmeStatusReady {
+		t.Fatalf("unexpected response: %d %#v", status, order)
+	}
+
+	// The CSR must match the identifiers of the order
+	status, body, _ = client.post(orderPath+"/finalize", map[string]interface{}{"csr": acmeTestCSR(t, "api.example.com")})
+	if status != http.StatusBadRequest || body["type"] != "urn:ietf:params:acme:error:badCSR" {
+		t.Fatalf("unexpected response: %d %#v", status, body)
+	}
+
+	status, order, _ = client.post(orderPath+"/finalize", map[string]interface{}{"csr": csr})
+	if status != http.StatusOK || order["status"] != acmeStatusValid {
+		t.Fatalf("unexpected response: %d %#v", status, order)
+	}
+
+	status, _, resp = client.post(strings.TrimPrefix(order["certificate"].(string), acmeTestBaseURL+"/"), nil)
+	if status != http.StatusOK || resp.Data[logical.HTTPContentType] != "application/pem-certificate-chain" {
+		t.Fatalf("unexpected response: %d %#v", status, resp.Data)
+	}
+	block, _ := pem.Decode(resp.Data[logical.HTTPRawBody].([]byte))
+	if block == nil {
+		t.Fatal("expected a PEM certificate chain")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "www.example.com" {
+		t.Fatalf("unexpected certificate subject: %v", cert.Subject)
+	}
+
+	status, body, _ = client.post("acme/revoke-cert", map[string]interface{}{
+		"certificate": base64.RawURLEncoding.EncodeToString(cert.Raw),
+	})
+	if status != http.StatusOK {
+		t.Fatalf("unexpected response: %d %#v", status, body)
+	}
+
+	revoked, err := fetchCertBySerial(context.Background(), &logical.Request{Storage: storage}, "revoked/", certutil.GetHexFormatted(cert.SerialNumber.Bytes(), ":"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked == nil {
+		t.Fatal("expected certificate to be revoked")
+	}
+}
+
+func TestPki_AcmeBadNonce(t *testing.T) {
+	b, storage := setupAcmeBackend(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &jose.SignerOptions{EmbedJWK: true}
+	opts.WithHeader("url", acmeTestBaseURL+"/acme/new-account")
+	opts.WithHeader("nonce", "unknown")
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jws, err := signer.Sign([]byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(jws.FullSerialize()), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "acme/new-account",
+		Storage:   storage,
+		Data:      data,
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data[logical.HTTPStatusCode] != http.StatusBadRequest || !strings.Contains(string(resp.Data[logical.HTTPRawBody].([]byte)), "badNonce") {
+		t.Fatalf("expected badNonce problem: %#v", resp.Data)
+	}
+	if len(resp.Headers["Replay-Nonce"]) != 1 {
+		t.Fatalf("expected a fresh nonce alongside the problem: %#v", resp.Headers)
+	}
+}
+
+// readOnlyStorage rejects writes, like the storage of a performance standby.
+type readOnlyStorage struct {
+	logical.Storage
+}
+
+func (s readOnlyStorage) Put(context.Context, *logical.StorageEntry) error {
+	return logical.ErrReadOnly
+}
+
+func (s readOnlyStorage) Delete(context.Context, string) error {
+	return logical.ErrReadOnly
+}
+
+func TestPki_AcmePerformanceStandby(t *testing.T) {
+	ctx := context.Background()
+
+	newStandby := func(storage logical.Storage) *backend {
+		t.Helper()
+		config := logical.TestBackendConfig()
+		config.StorageView = readOnlyStorage{storage}
+		sys := logical.TestSystemView()
+		sys.ReplicationStateVal = consts.ReplicationPerformanceStandby
+		config.System = sys
+		b := Backend(config)
+		if err := b.Setup(ctx, config); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	newNonce := func(b *backend, storage logical.Storage) (string, error) {
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "acme/new-nonce",
+			Storage:   storage,
+		})
+		if err != nil {
+			return "", err
+		}
+		return resp.Headers["Replay-Nonce"][0], nil
+	}
+
+	b, storage := setupAcmeBackend(t)
+	standby := newStandby(storage)
+	standbyStorage := readOnlyStorage{storage}
+
+	// Until the active node generated the nonce key, standbys forward
+	// requests for nonces
+	if _, err := newNonce(standby, standbyStorage); err != logical.ErrReadOnly {
+		t.Fatalf("expected the request to be forwarded, got: %v", err)
+	}
+
+	// Nonces issued by one node are accepted by the others
+	nonce, err := newNonce(b, storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	standbyNonce, err := newNonce(standby, standbyStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := b.redeemAcmeNonce(ctx, storage, standbyNonce); err != nil || !ok {
+		t.Fatalf("expected the nonce of the standby to be valid: %v", err)
+	}
+
+	// Writes on the standby are forwarded to the active node rather than
+	// reported to the client as a server error
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &acmeTestClient{t: t, b: b, storage: storage, key: key}
+	data := client.sign("acme/new-account", nonce, map[string]interface{}{"termsOfServiceAgreed": true})
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "acme/new-account",
+		Storage:   standbyStorage,
+		Data:      data,
+	}
+	if _, err := standby.HandleRequest(ctx, req); err != logical.ErrReadOnly {
+		t.Fatalf("expected the request to be forwarded, got: %v", err)
+	}
+
+	// The forwarded request is handled by the active node with the same
+	// nonce, which can't be replayed afterwards
+	req.Storage = storage
+	resp, err := b.HandleRequest(ctx, req)
+	if err != nil || resp.Data[logical.HTTPStatusCode] != http.StatusCreated {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = b.HandleRequest(ctx, req)
+	if err != nil || !strings.Contains(string(resp.Data[logical.HTTPRawBody].([]byte)), "badNonce") {
+		t.Fatalf("expected badNonce problem: err: %v resp: %#v", err, resp)
+	}
+
+	// Nonces are authenticated
+	raw, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[len(raw)-1] ^= 1
+	if ok, err := b.redeemAcmeNonce(ctx, storage, base64.RawURLEncoding.EncodeToString(raw)); err != nil || ok {
+		t.Fatalf("expected a tampered nonce to be rejected: %v", err)
+	}
+}
+
+func TestPki_AcmeHTTP01Validation(t *testing.T) {
+	token := "token"
+	keyAuth := "token.thumbprint"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/acme-challenge/"+token {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintln(w, keyAuth)
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	if err := validateHTTP01Challenge(context.Background(), host, token, keyAuth); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateHTTP01Challenge(context.Background(), host, token, "token.other"); err == nil {
+		t.Fatal("expected mismatched key authorization to fail validation")
+	}
+	if err := validateHTTP01Challenge(context.Background(), host, "missing", keyAuth); err == nil {
+		t.Fatal("expected missing token to fail validation")
+	}
+}
+
+func TestPki_AcmeTLSALPN01Certificate(t *testing.T) {
+	keyAuth := "token.thumbprint"
+	digest := sha256.Sum256([]byte(keyAuth))
+
+	buildCert := func(domain string, critical bool, value []byte) *x509.Certificate {
+		extValue, err := asn1.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: domain},
+			DNSNames:     []string{domain},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtraExtensions: []pkix.Extension{
+				{Id: idPeAcmeIdentifier, Critical: critical, Value: extValue},
+			},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	if err := checkTLSALPN01Certificate(buildCert("www.example.com", true, digest[:]), "www.example.com", keyAuth); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkTLSALPN01Certificate(buildCert("www.example.com", false, digest[:]), "www.example.com", keyAuth); err == nil {
+		t.Fatal("expected non-critical extension to fail validation")
+	}
+	if err := checkTLSALPN01Certificate(buildCert("api.example.com", true, digest[:]), "www.example.com", keyAuth); err == nil {
+		t.Fatal("expected mismatched name to fail validation")
+	}
+	if err := checkTLSALPN01Certificate(buildCert("www.example.com", true, []byte("wrong")), "www.example.com", keyAuth); err == nil {
+		t.Fatal("expected mismatched digest to fail validation")
+	}
+}
+
+func acmeTestCSR(t *testing.T, commonName string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName},
+		DNSNames: []string{commonName},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(der)
+}
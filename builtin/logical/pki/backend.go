@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	multierror "github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -33,21 +34,52 @@ func Backend(conf *logical.BackendConfig) *backend {
 				"ca",
 				"crl/pem",
 				"crl",
+				"crl/delta",
+				"crl/delta/pem",
+				"issuer/+/crl/der",
+				"issuer/+/crl/pem",
+				"issuer/+/crl",
+				"issuer/+/crl/delta/der",
+				"issuer/+/crl/delta/pem",
+				"issuer/+/crl/delta",
+				"issuer/+/chains",
+				"issuer/+/pem",
+				"issuer/+/der",
+				"issuer/+/json",
+				"ocsp",
+				"ocsp/*",
+				"acme/*",
+				"roles/+/acme/*",
+				"est/cacerts",
+				"est/+/cacerts",
+				"est/csrattrs",
+				"est/+/csrattrs",
+				"est/simpleenroll",
+				"est/+/simpleenroll",
+				"est/simplereenroll",
+				"est/+/simplereenroll",
 			},
 
 			LocalStorage: []string{
 				"revoked/",
 				"crl",
 				"certs/",
+				"crls/",
+				"delta-wal/",
+				"cert-metadata/",
+				"acme/",
 			},
 
 			Root: []string{
 				"root",
 				"root/sign-self-issued",
+				"issuer/+/sign-self-issued",
+				"keys/managed",
 			},
 
 			SealWrapStorage: []string{
 				"config/ca_bundle",
+				"config/key/",
 			},
 		},
 
@@ -73,22 +105,63 @@ func Backend(conf *logical.BackendConfig) *backend {
 			pathFetchCRLViaCertPath(&b),
 			pathFetchValid(&b),
 			pathFetchListCerts(&b),
+			pathListCertMetadata(&b),
+			pathCertMetadata(&b),
 			pathRevoke(&b),
 			pathTidy(&b),
 			pathTidyStatus(&b),
+			pathTidyCancel(&b),
+			pathConfigAutoTidy(&b),
+			pathOcspGet(&b),
+			pathOcspPost(&b),
+
+			// Issuer and key management
+			pathListIssuers(&b),
+			pathIssuerGenerateRoot(&b),
+			pathIssuerGenerateIntermediate(&b),
+			pathGetIssuer(&b),
+			pathGetIssuerCRL(&b),
+			pathGetIssuerChains(&b),
+			pathImportIssuer(&b),
+			pathConfigIssuers(&b),
+			pathListKeys(&b),
+			pathKey(&b),
+			pathImportManagedKey(&b),
+			pathConfigKeys(&b),
+			pathIssuerIssue(&b),
+			pathIssuerSign(&b),
+			pathIssuerSignVerbatim(&b),
+			pathIssuerSignIntermediate(&b),
+			pathIssuerSignSelfIssued(&b),
+			pathIssuerCrossSign(&b),
+
+			// ACME
+			pathConfigAcme(&b),
+			pathConfigEst(&b),
 		},
 
 		Secrets: []*framework.Secret{
 			secretCerts(&b),
 		},
 
+		InitializeFunc: b.initialize,
+		PeriodicFunc:   b.periodicFunc,
+
 		BackendType: logical.TypeLogical,
 	}
 
 	b.crlLifetime = time.Hour * 72
 	b.tidyCASGuard = new(uint32)
+	b.tidyCancelCASGuard = new(uint32)
+	// Auto-tidy first runs a full interval after the mount is loaded
+	b.lastTidy = time.Now()
 	b.tidyStatus = &tidyStatus{state: tidyStatusInactive}
 	b.storage = conf.StorageView
+	b.acmeNonces = newAcmeNonces()
+	setPKCS11Libraries(conf.System)
+
+	b.Backend.Paths = append(b.Backend.Paths, pathAcme(&b)...)
+	b.Backend.Paths = append(b.Backend.Paths, pathEst(&b)...)
 
 	return &b
 }
@@ -96,13 +169,37 @@ func Backend(conf *logical.BackendConfig) *backend {
 type backend struct {
 	*framework.Backend
 
-	storage           logical.Storage
-	crlLifetime       time.Duration
-	revokeStorageLock sync.RWMutex
-	tidyCASGuard      *uint32
+	storage            logical.Storage
+	crlLifetime        time.Duration
+	revokeStorageLock  sync.RWMutex
+	tidyCASGuard       *uint32
+	tidyCancelCASGuard *uint32
 
 	tidyStatusLock sync.RWMutex
 	tidyStatus     *tidyStatus
+	// lastTidy is the time the last tidy operation finished, guarded by
+	// tidyStatusLock; auto-tidy runs are scheduled relative to it.
+	lastTidy time.Time
+
+	// issuersLock guards modifications to the set of issuers and keys
+	// and to the issuer and key configuration.
+	issuersLock sync.RWMutex
+
+	// acmeLock serializes updates to ACME orders and authorizations,
+	// which are also written by background challenge validation.
+	acmeLock   sync.Mutex
+	acmeNonces *acmeNonces
+}
+
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	var result error
+	if err := b.rebuildCRLsIfNeeded(ctx, req); err != nil {
+		result = multierror.Append(result, err)
+	}
+	if err := b.runAutoTidyIfNeeded(ctx, req); err != nil {
+		result = multierror.Append(result, err)
+	}
+	return result
 }
 
 type tidyStatusState int
@@ -112,13 +209,18 @@ const (
 	tidyStatusStarted
 	tidyStatusFinished
 	tidyStatusError
+	tidyStatusCancelling
+	tidyStatusCancelled
 )
 
 type tidyStatus struct {
 	// Parameters used to initiate the operation
-	safetyBuffer     int
-	tidyCertStore    bool
-	tidyRevokedCerts bool
+	safetyBuffer       int
+	issuerSafetyBuffer int
+	tidyCertStore      bool
+	tidyRevokedCerts   bool
+	tidyExpiredIssuers bool
+	autoTidy           bool
 
 	// Status
 	state                   tidyStatusState
@@ -126,8 +228,11 @@ type tidyStatus struct {
 	timeStarted             time.Time
 	timeFinished            time.Time
 	message                 string
+	certStoreTotalCount     uint
+	revokedCertTotalCount   uint
 	certStoreDeletedCount   uint
 	revokedCertDeletedCount uint
+	issuerDeletedCount      uint
 }
 
 const backendHelp = `
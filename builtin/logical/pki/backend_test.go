@@ -525,6 +525,9 @@ func generateURLSteps(t *testing.T, caCert, caKey string, intdata, reqdata map[s
 			"http://example.com/ocsp1",
 			"http://example.com/ocsp2",
 		},
+		DeltaCRLDistributionPoints: []string{
+			"http://example.com/delta-crl1",
+		},
 	}
 	csrTemplate := x509.CertificateRequest{
 		Subject: pkix.Name{
@@ -566,9 +569,10 @@ func generateURLSteps(t *testing.T, caCert, caKey string, intdata, reqdata map[s
 			Operation: logical.UpdateOperation,
 			Path:      "config/urls",
 			Data: map[string]interface{}{
-				"issuing_certificates":    strings.Join(expected.IssuingCertificates, ","),
-				"crl_distribution_points": strings.Join(expected.CRLDistributionPoints, ","),
-				"ocsp_servers":            strings.Join(expected.OCSPServers, ","),
+				"issuing_certificates":          strings.Join(expected.IssuingCertificates, ","),
+				"crl_distribution_points":       strings.Join(expected.CRLDistributionPoints, ","),
+				"ocsp_servers":                  strings.Join(expected.OCSPServers, ","),
+				"delta_crl_distribution_points": strings.Join(expected.DeltaCRLDistributionPoints, ","),
 			},
 		},
 
@@ -2337,7 +2341,7 @@ func TestBackend_SignSelfIssued(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	signingBundle, err := fetchCAInfo(context.Background(), &logical.Request{Storage: storage})
+	signingBundle, err := fetchCAInfo(context.Background(), &logical.Request{Storage: storage}, defaultRef)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -3397,15 +3401,21 @@ func TestBackend_RevokePlusTidy_Intermediate(t *testing.T) {
 		}
 		expectedData := map[string]interface{}{
 			"safety_buffer":              json.Number("1"),
+			"issuer_safety_buffer":       json.Number("31536000"),
 			"tidy_cert_store":            true,
 			"tidy_revoked_certs":         true,
+			"tidy_expired_issuers":       false,
+			"auto_tidy":                  false,
 			"state":                      "Finished",
 			"error":                      nil,
 			"time_started":               nil,
 			"time_finished":              nil,
 			"message":                    nil,
+			"cert_store_total_count":     nil,
+			"revoked_cert_total_count":   json.Number("1"),
 			"cert_store_deleted_count":   json.Number("1"),
 			"revoked_cert_deleted_count": json.Number("1"),
+			"issuer_deleted_count":       json.Number("0"),
 		}
 		// Let's copy the times from the response so that we can use deep.Equal()
 		timeStarted, ok := tidyStatus.Data["time_started"]
@@ -3418,6 +3428,12 @@ func TestBackend_RevokePlusTidy_Intermediate(t *testing.T) {
 			t.Fatal("Expected tidy status response to include a value for time_finished")
 		}
 		expectedData["time_finished"] = timeFinished
+		// The certificate store also holds the CA certificates
+		certStoreTotal, ok := tidyStatus.Data["cert_store_total_count"]
+		if !ok || certStoreTotal == nil {
+			t.Fatal("Expected tidy status response to include a value for cert_store_total_count")
+		}
+		expectedData["cert_store_total_count"] = certStoreTotal
 
 		if diff := deep.Equal(expectedData, tidyStatus.Data); diff != nil {
 			t.Fatal(diff)
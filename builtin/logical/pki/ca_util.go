@@ -1,10 +1,14 @@
 package pki
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
@@ -16,9 +20,10 @@ func (b *backend) getGenerationParams(
 	case "exported":
 		exported = true
 	case "internal":
+	case "existing":
 	default:
 		errorResp = logical.ErrorResponse(
-			`the "exported" path parameter must be "internal" or "exported"`)
+			`the "exported" path parameter must be "internal", "exported" or "existing"`)
 		return
 	}
 
@@ -61,3 +66,70 @@ func (b *backend) getGenerationParams(
 
 	return
 }
+
+// existingKeyRequested reports whether a CA generation request asked to
+// use an existing key, such as a managed one, rather than a new key.
+func existingKeyRequested(input *inputBundle) bool {
+	if input.apiData == nil {
+		return false
+	}
+	exportedRaw, ok := input.apiData.GetOk("exported")
+	return ok && exportedRaw.(string) == "existing"
+}
+
+// fetchExistingKey returns the key referenced by key_ref for generation
+// requests using an existing key.
+func fetchExistingKey(ctx context.Context, input *inputBundle) (*keyEntry, error) {
+	keyRef := input.apiData.Get(keyRefParam).(string)
+	id, err := resolveKeyReference(ctx, input.req.Storage, keyRef)
+	if err != nil {
+		return nil, asTypedError(err, "unable to resolve key reference")
+	}
+	key, err := fetchKeyByID(ctx, input.req.Storage, id)
+	if err != nil {
+		return nil, asTypedError(err, "unable to fetch key")
+	}
+
+	return key, nil
+}
+
+// getKeyGenerator returns the KeyGenerator used to obtain the key of a new
+// CA. When an existing key was requested, the key referenced by key_ref is
+// loaded and the key type and size of the role are updated to match it.
+func getKeyGenerator(ctx context.Context, input *inputBundle) (certutil.KeyGenerator, error) {
+	if !existingKeyRequested(input) {
+		return certutil.DefaultGenerator, nil
+	}
+
+	key, err := fetchExistingKey(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := key.GetSigner()
+	if err != nil {
+		return nil, asTypedError(err, fmt.Sprintf("unable to load key %s", key.ID))
+	}
+
+	switch parsed.PrivateKeyType {
+	case certutil.RSAPrivateKey:
+		input.role.KeyType = "rsa"
+	case certutil.ECPrivateKey:
+		input.role.KeyType = "ec"
+	case certutil.Ed25519PrivateKey:
+		input.role.KeyType = "ed25519"
+	default:
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unknown type of key %s", key.ID)}
+	}
+	input.role.KeyBits = certutil.GetPublicKeySize(parsed.PrivateKey.Public())
+	input.role.SignatureBits = input.apiData.Get("signature_bits").(int)
+	if err := certutil.ValidateKeyTypeSignatureLength(input.role.KeyType, input.role.KeyBits, &input.role.SignatureBits); err != nil {
+		return nil, errutil.UserError{Err: err.Error()}
+	}
+
+	// The private key bytes are left out so that the key, which is already
+	// stored, is never returned or imported again.
+	return func(_ string, _ int, container certutil.ParsedPrivateKeyContainer, _ io.Reader) error {
+		container.SetParsedPrivateKey(parsed.PrivateKey, parsed.PrivateKeyType, nil)
+		return nil
+	}, nil
+}
@@ -0,0 +1,317 @@
+package pki
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+)
+
+// subjectTemplateFields are the subject fields which may be derived from
+// identity templates through a role's subject_templates.
+var subjectTemplateFields = []string{
+	"common_name",
+	"serial_number",
+	"ou",
+	"organization",
+	"country",
+	"locality",
+	"province",
+	"street_address",
+	"postal_code",
+}
+
+var (
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+// extKeyUsageOIDs maps the extended key usages Vault can issue to their
+// OIDs, so that the extended key usages requested in a CSR can be compared
+// against those of the role.
+var extKeyUsageOIDs = map[x509.ExtKeyUsage]asn1.ObjectIdentifier{
+	x509.ExtKeyUsageAny:                            {2, 5, 29, 37, 0},
+	x509.ExtKeyUsageServerAuth:                     {1, 3, 6, 1, 5, 5, 7, 3, 1},
+	x509.ExtKeyUsageClientAuth:                     {1, 3, 6, 1, 5, 5, 7, 3, 2},
+	x509.ExtKeyUsageCodeSigning:                    {1, 3, 6, 1, 5, 5, 7, 3, 3},
+	x509.ExtKeyUsageEmailProtection:                {1, 3, 6, 1, 5, 5, 7, 3, 4},
+	x509.ExtKeyUsageIPSECEndSystem:                 {1, 3, 6, 1, 5, 5, 7, 3, 5},
+	x509.ExtKeyUsageIPSECTunnel:                    {1, 3, 6, 1, 5, 5, 7, 3, 6},
+	x509.ExtKeyUsageIPSECUser:                      {1, 3, 6, 1, 5, 5, 7, 3, 7},
+	x509.ExtKeyUsageTimeStamping:                   {1, 3, 6, 1, 5, 5, 7, 3, 8},
+	x509.ExtKeyUsageOCSPSigning:                    {1, 3, 6, 1, 5, 5, 7, 3, 9},
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     {1, 3, 6, 1, 4, 1, 311, 10, 3, 3},
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      {2, 16, 840, 1, 113730, 4, 1},
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: {1, 3, 6, 1, 4, 1, 311, 2, 1, 22},
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     {1, 3, 6, 1, 4, 1, 311, 61, 1, 1},
+}
+
+// validateRoleTemplates checks the subject and SAN templates of a role
+// before it is stored.
+func validateRoleTemplates(role *roleEntry) error {
+	for field, tpl := range role.SubjectTemplates {
+		if !strutil.StrListContains(subjectTemplateFields, field) {
+			return fmt.Errorf("unknown subject_templates field %q; must be one of %s", field, strings.Join(subjectTemplateFields, ", "))
+		}
+		if _, err := framework.ValidateIdentityTemplate(tpl); err != nil {
+			return fmt.Errorf("invalid template for subject field %q: %w", field, err)
+		}
+	}
+
+	for _, tpl := range role.AltNamesTemplates {
+		if _, err := framework.ValidateIdentityTemplate(tpl); err != nil {
+			return fmt.Errorf("invalid alt_names_templates entry %q: %w", tpl, err)
+		}
+	}
+
+	return nil
+}
+
+// renderRoleTemplate populates a subject or SAN template of the role with
+// the identity of the requester. Templates without identity references are
+// returned as is.
+func renderRoleTemplate(b *backend, data *inputBundle, tpl string) (string, error) {
+	isTemplate, err := framework.ValidateIdentityTemplate(tpl)
+	if err != nil {
+		return "", errutil.InternalError{Err: err.Error()}
+	}
+	if !isTemplate {
+		return tpl, nil
+	}
+
+	if data.req == nil || data.req.EntityID == "" {
+		return "", errutil.UserError{Err: "this role derives certificate fields from the requester's identity, but the request has no associated entity"}
+	}
+
+	out, err := framework.PopulateIdentityTemplate(tpl, data.req.EntityID, b.System())
+	if err != nil {
+		return "", errutil.UserError{Err: fmt.Sprintf("unable to populate template %q from the requester's identity: %v", tpl, err)}
+	}
+	if out == "" {
+		return "", errutil.UserError{Err: fmt.Sprintf("template %q populated to an empty value", tpl)}
+	}
+
+	return out, nil
+}
+
+// renderSubjectTemplates returns the subject fields derived from the role's
+// subject_templates, keyed by field name.
+func renderSubjectTemplates(b *backend, data *inputBundle) (map[string]string, error) {
+	derived := make(map[string]string, len(data.role.SubjectTemplates))
+	for field, tpl := range data.role.SubjectTemplates {
+		value, err := renderRoleTemplate(b, data, tpl)
+		if err != nil {
+			return nil, err
+		}
+		derived[field] = value
+	}
+
+	return derived, nil
+}
+
+// applyDerivedSubject replaces the subject fields configured on the role with
+// those derived from its subject_templates. The common name and serial
+// number are handled along with the names of the request.
+func applyDerivedSubject(subject *pkix.Name, derived map[string]string) {
+	for field, value := range derived {
+		switch field {
+		case "ou":
+			subject.OrganizationalUnit = []string{value}
+		case "organization":
+			subject.Organization = []string{value}
+		case "country":
+			subject.Country = []string{value}
+		case "locality":
+			subject.Locality = []string{value}
+		case "province":
+			subject.Province = []string{value}
+		case "street_address":
+			subject.StreetAddress = []string{value}
+		case "postal_code":
+			subject.PostalCode = []string{value}
+		}
+	}
+}
+
+// renderAltNamesTemplates returns the DNS names and email addresses derived
+// from the role's alt_names_templates.
+func renderAltNamesTemplates(b *backend, data *inputBundle) ([]string, []string, error) {
+	var dnsNames, emailAddresses []string
+	for _, tpl := range data.role.AltNamesTemplates {
+		value, err := renderRoleTemplate(b, data, tpl)
+		if err != nil {
+			return nil, nil, err
+		}
+		if strings.Contains(value, "@") {
+			emailAddresses = append(emailAddresses, value)
+		} else {
+			dnsNames = append(dnsNames, strings.ToLower(value))
+		}
+	}
+
+	return dnsNames, emailAddresses, nil
+}
+
+// excludeNames returns the names not present in exclude. It is used to skip
+// the allowed domain checks for names derived from the role's templates,
+// which the role itself vouches for.
+func excludeNames(names []string, exclude []string) []string {
+	if len(exclude) == 0 {
+		return names
+	}
+
+	var ret []string
+	for _, name := range names {
+		if !strutil.StrListContainsCaseInsensitive(exclude, name) {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+// checkCSRProfile verifies that everything requested by a CSR matches what
+// the role will issue, as computed in params: every subject field and SAN
+// present in the CSR must appear in the certificate, and requested key
+// usages and extended key usages must be allowed by the role. It is only
+// enforced for roles with enforce_csr_profile set.
+func checkCSRProfile(csr *x509.CertificateRequest, params *certutil.CreationParameters) error {
+	subject := params.Subject
+
+	if csr.Subject.CommonName != "" && !strings.EqualFold(csr.Subject.CommonName, subject.CommonName) {
+		return errutil.UserError{Err: fmt.Sprintf("CSR common name %q does not match the role's profile", csr.Subject.CommonName)}
+	}
+	if csr.Subject.SerialNumber != "" && csr.Subject.SerialNumber != subject.SerialNumber {
+		return errutil.UserError{Err: fmt.Sprintf("CSR serial number %q does not match the role's profile", csr.Subject.SerialNumber)}
+	}
+
+	subjectFields := []struct {
+		name      string
+		requested []string
+		issued    []string
+	}{
+		{"organizational unit", csr.Subject.OrganizationalUnit, subject.OrganizationalUnit},
+		{"organization", csr.Subject.Organization, subject.Organization},
+		{"country", csr.Subject.Country, subject.Country},
+		{"locality", csr.Subject.Locality, subject.Locality},
+		{"province", csr.Subject.Province, subject.Province},
+		{"street address", csr.Subject.StreetAddress, subject.StreetAddress},
+		{"postal code", csr.Subject.PostalCode, subject.PostalCode},
+	}
+	for _, field := range subjectFields {
+		for _, value := range field.requested {
+			if !strutil.StrListContains(field.issued, value) {
+				return errutil.UserError{Err: fmt.Sprintf("CSR %s %q does not match the role's profile", field.name, value)}
+			}
+		}
+	}
+
+	for _, name := range csr.DNSNames {
+		if !strutil.StrListContainsCaseInsensitive(params.DNSNames, name) {
+			return errutil.UserError{Err: fmt.Sprintf("CSR DNS name %q does not match the role's profile", name)}
+		}
+	}
+	for _, email := range csr.EmailAddresses {
+		if !strutil.StrListContainsCaseInsensitive(params.EmailAddresses, email) {
+			return errutil.UserError{Err: fmt.Sprintf("CSR email address %q does not match the role's profile", email)}
+		}
+	}
+	for _, ip := range csr.IPAddresses {
+		if !containsIP(params.IPAddresses, ip) {
+			return errutil.UserError{Err: fmt.Sprintf("CSR IP address %s does not match the role's profile", ip)}
+		}
+	}
+	for _, uri := range csr.URIs {
+		found := false
+		for _, issued := range params.URIs {
+			if issued.String() == uri.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errutil.UserError{Err: fmt.Sprintf("CSR URI %s does not match the role's profile", uri)}
+		}
+	}
+
+	for _, ext := range csr.Extensions {
+		switch {
+		case ext.Id.Equal(oidExtensionKeyUsage):
+			var bits asn1.BitString
+			if rest, err := asn1.Unmarshal(ext.Value, &bits); err != nil || len(rest) != 0 {
+				return errutil.UserError{Err: "CSR contains a malformed key usage extension"}
+			}
+			var requested x509.KeyUsage
+			for i := 0; i < 9; i++ {
+				if bits.At(i) != 0 {
+					requested |= 1 << uint(i)
+				}
+			}
+			if requested&^params.KeyUsage != 0 {
+				return errutil.UserError{Err: "CSR requests key usages not allowed by the role's profile"}
+			}
+
+		case ext.Id.Equal(oidExtensionExtendedKeyUsage):
+			var requested []asn1.ObjectIdentifier
+			if rest, err := asn1.Unmarshal(ext.Value, &requested); err != nil || len(rest) != 0 {
+				return errutil.UserError{Err: "CSR contains a malformed extended key usage extension"}
+			}
+			allowed, err := roleExtKeyUsageOIDs(params)
+			if err != nil {
+				return err
+			}
+			for _, oid := range requested {
+				found := false
+				for _, allowedOID := range allowed {
+					if oid.Equal(allowedOID) {
+						found = true
+						break
+					}
+				}
+				if !found {
+					return errutil.UserError{Err: fmt.Sprintf("CSR requests extended key usage %s not allowed by the role's profile", oid)}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// roleExtKeyUsageOIDs returns the OIDs of the extended key usages which will
+// be placed in the certificate described by params.
+func roleExtKeyUsageOIDs(params *certutil.CreationParameters) ([]asn1.ObjectIdentifier, error) {
+	template := &x509.Certificate{}
+	certutil.AddKeyUsages(&certutil.CreationBundle{Params: params}, template)
+
+	var oids []asn1.ObjectIdentifier
+	for _, usage := range template.ExtKeyUsage {
+		if oid, ok := extKeyUsageOIDs[usage]; ok {
+			oids = append(oids, oid)
+		}
+	}
+	for _, oidStr := range params.ExtKeyUsageOIDs {
+		oid, err := certutil.StringToOid(oidStr)
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("unable to parse extended key usage OID %q of the role: %v", oidStr, err)}
+		}
+		oids = append(oids, oid)
+	}
+
+	return oids, nil
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, candidate := range ips {
+		if candidate.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
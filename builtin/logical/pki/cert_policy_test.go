@@ -0,0 +1,163 @@
+package pki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestPki_RoleTemplatesAndCSRProfile(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	system := logical.TestSystemView()
+	system.EntityVal = &logical.Entity{
+		ID:       "entity-1",
+		Name:     "alice",
+		Metadata: map[string]string{"team": "payments"},
+	}
+	config.System = system
+
+	b := Backend(config)
+	if err := b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	storage := config.StorageView
+
+	request := func(path string, entityID string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+			EntityID:  entityID,
+		})
+	}
+	write := func(path string, entityID string, data map[string]interface{}) *logical.Response {
+		resp, err := request(path, entityID, data)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %s: err: %v resp: %#v", path, err, resp)
+		}
+		return resp
+	}
+	expectError := func(path string, entityID string, data map[string]interface{}) {
+		resp, err := request(path, entityID, data)
+		if err == nil && (resp == nil || !resp.IsError()) {
+			t.Fatalf("expected error for %s: resp: %#v", path, resp)
+		}
+	}
+
+	write("root/generate/internal", "", map[string]interface{}{
+		"common_name": "root.example.com",
+		"ttl":         "48h",
+	})
+
+	// Templates are validated when the role is written
+	expectError("roles/users", "", map[string]interface{}{
+		"subject_templates": map[string]interface{}{"title": "{{identity.entity.name}}"},
+	})
+	expectError("roles/users", "", map[string]interface{}{
+		"alt_names_templates": "{{identity.entity.name",
+	})
+
+	write("roles/users", "", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"key_bits":         256,
+		"server_flag":      false,
+		"client_flag":      true,
+		"key_usage":        "DigitalSignature",
+		"subject_templates": map[string]interface{}{
+			"common_name": "{{identity.entity.name}}",
+			"ou":          "{{identity.entity.metadata.team}}",
+		},
+		"alt_names_templates": "{{identity.entity.name}}@users.internal",
+		"enforce_csr_profile": true,
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roles/users",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.Data["enforce_csr_profile"] != true {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	// Templated fields need an identity and can't be overridden
+	expectError("issue/users", "", map[string]interface{}{})
+	expectError("issue/users", "entity-1", map[string]interface{}{"common_name": "bob"})
+
+	issued := write("issue/users", "entity-1", map[string]interface{}{})
+	cert, err := parseCertificateFromPEM(issued.Data["certificate"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "alice" {
+		t.Fatalf("expected derived common name, got %q", cert.Subject.CommonName)
+	}
+	if len(cert.Subject.OrganizationalUnit) != 1 || cert.Subject.OrganizationalUnit[0] != "payments" {
+		t.Fatalf("expected derived OU, got %v", cert.Subject.OrganizationalUnit)
+	}
+	if len(cert.EmailAddresses) != 1 || cert.EmailAddresses[0] != "alice@users.internal" {
+		t.Fatalf("expected derived email SAN, got %v", cert.EmailAddresses)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	makeCsr := func(template *x509.CertificateRequest) string {
+		csr, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+	}
+
+	serverAuth, err := asn1.Marshal([]asn1.ObjectIdentifier{{1, 3, 6, 1, 5, 5, 7, 3, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// CSRs asking for anything outside of the profile are rejected
+	expectError("sign/users", "entity-1", map[string]interface{}{
+		"csr": makeCsr(&x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "alice", Organization: []string{"Evil Corp"}},
+		}),
+	})
+	expectError("sign/users", "entity-1", map[string]interface{}{
+		"csr": makeCsr(&x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: "alice"},
+			DNSNames: []string{"www.example.com"},
+		}),
+	})
+	expectError("sign/users", "entity-1", map[string]interface{}{
+		"csr": makeCsr(&x509.CertificateRequest{
+			Subject:         pkix.Name{CommonName: "alice"},
+			ExtraExtensions: []pkix.Extension{{Id: oidExtensionExtendedKeyUsage, Value: serverAuth}},
+		}),
+	})
+
+	signed := write("sign/users", "entity-1", map[string]interface{}{
+		"csr": makeCsr(&x509.CertificateRequest{
+			Subject:        pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"payments"}},
+			EmailAddresses: []string{"alice@users.internal"},
+		}),
+	})
+	cert, err = parseCertificateFromPEM(signed.Data["certificate"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "alice" || len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+		t.Fatalf("unexpected signed certificate: %v %v", cert.Subject, cert.ExtKeyUsage)
+	}
+}
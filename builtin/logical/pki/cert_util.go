@@ -68,25 +68,18 @@ func getFormat(data *framework.FieldData) string {
 	return format
 }
 
-// Fetches the CA info. Unlike other certificates, the CA info is stored
-// in the backend as a CertBundle, because we are storing its private key
-func fetchCAInfo(ctx context.Context, req *logical.Request) (*certutil.CAInfoBundle, error) {
-	bundleEntry, err := req.Storage.Get(ctx, "config/ca_bundle")
+// Fetches the CA info for the given issuer reference. Unlike other
+// certificates, the CA info is stored in the backend as an issuer and a key,
+// because we are storing its private key
+func fetchCAInfo(ctx context.Context, req *logical.Request, issuerRef string) (*certutil.CAInfoBundle, error) {
+	id, err := resolveIssuerReference(ctx, req.Storage, issuerRef)
 	if err != nil {
-		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch local CA certificate/key: %v", err)}
-	}
-	if bundleEntry == nil {
-		return nil, errutil.UserError{Err: "backend must be configured with a CA certificate/key"}
-	}
-
-	var bundle certutil.CertBundle
-	if err := bundleEntry.DecodeJSON(&bundle); err != nil {
-		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to decode local CA certificate/key: %v", err)}
+		return nil, asTypedError(err, "unable to resolve issuer reference")
 	}
 
-	parsedBundle, err := bundle.ToParsedCertBundle()
+	_, parsedBundle, err := fetchParsedCertBundleByIssuerID(ctx, req.Storage, id)
 	if err != nil {
-		return nil, errutil.InternalError{Err: err.Error()}
+		return nil, asTypedError(err, "unable to fetch local CA certificate/key")
 	}
 
 	if parsedBundle.Certificate == nil {
@@ -111,6 +104,54 @@ func fetchCAInfo(ctx context.Context, req *logical.Request) (*certutil.CAInfoBun
 	return caInfo, nil
 }
 
+// asTypedError ensures callers switching on the error type always see either
+// a UserError or an InternalError.
+func asTypedError(err error, context string) error {
+	switch err.(type) {
+	case errutil.UserError, errutil.InternalError:
+		return err
+	default:
+		return errutil.InternalError{Err: fmt.Sprintf("%s: %v", context, err)}
+	}
+}
+
+// fetchIssuerCertEntry returns the DER-encoded certificate of the referenced
+// issuer as a storage entry, or nil if no such issuer exists.
+func fetchIssuerCertEntry(ctx context.Context, s logical.Storage, issuerRef string) (*logical.StorageEntry, error) {
+	id, err := resolveIssuerReference(ctx, s, issuerRef)
+	if err != nil {
+		if _, ok := err.(errutil.UserError); !ok {
+			return nil, asTypedError(err, "unable to resolve issuer reference")
+		}
+		if issuerRef != defaultRef {
+			return nil, nil
+		}
+
+		// Mounts which have not been migrated yet still keep the CA
+		// certificate at the legacy location.
+		certEntry, err := s.Get(ctx, legacyCertPath)
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("error fetching CA certificate: %s", err)}
+		}
+		return certEntry, nil
+	}
+
+	issuer, err := fetchIssuerByID(ctx, s, id)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := issuer.GetCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.StorageEntry{
+		Key:   issuerPrefix + id.String(),
+		Value: cert.Raw,
+	}, nil
+}
+
 // Allows fetching certificates from the backend; it handles the slightly
 // separate pathing for CA, CRL, and revoked certificates.
 func fetchCertBySerial(ctx context.Context, req *logical.Request, prefix, serial string) (*logical.StorageEntry, error) {
@@ -128,9 +169,11 @@ func fetchCertBySerial(ctx context.Context, req *logical.Request, prefix, serial
 		legacyPath = "revoked/" + colonSerial
 		path = "revoked/" + hyphenSerial
 	case serial == "ca":
-		path = "ca"
+		return fetchIssuerCertEntry(ctx, req.Storage, defaultRef)
 	case serial == "crl":
-		path = "crl"
+		return fetchIssuerCRLEntry(ctx, req.Storage, defaultRef)
+	case serial == "delta_crl":
+		return fetchIssuerDeltaCRLEntry(ctx, req.Storage, defaultRef)
 	default:
 		legacyPath = "certs/" + colonSerial
 		path = "certs/" + hyphenSerial
@@ -147,11 +190,6 @@ func fetchCertBySerial(ctx context.Context, req *logical.Request, prefix, serial
 		return certEntry, nil
 	}
 
-	// If legacyPath is unset, it's going to be a CA or CRL; return immediately
-	if legacyPath == "" {
-		return nil, nil
-	}
-
 	// Retrieve the old-style path.  We disregard errors here because they
 	// always manifest on windows, and thus the initial check for a revoked
 	// cert fails would return an error when the cert isn't revoked, preventing
@@ -460,6 +498,11 @@ func generateCert(ctx context.Context,
 		return nil, errutil.InternalError{Err: "no role found in data bundle"}
 	}
 
+	keyGenerator, err := getKeyGenerator(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
 	if input.role.KeyType == "rsa" && input.role.KeyBits < 2048 {
 		return nil, errutil.UserError{Err: "RSA keys < 2048 bits are unsafe and not supported"}
 	}
@@ -499,7 +542,7 @@ func generateCert(ctx context.Context,
 		}
 	}
 
-	parsedBundle, err := certutil.CreateCertificateWithRandomSource(data, randomSource)
+	parsedBundle, err := certutil.CreateCertificateWithKeyGenerator(data, randomSource, keyGenerator)
 	if err != nil {
 		return nil, err
 	}
@@ -509,7 +552,12 @@ func generateCert(ctx context.Context,
 
 // N.B.: This is only meant to be used for generating intermediate CAs.
 // It skips some sanity checks.
-func generateIntermediateCSR(b *backend, input *inputBundle, randomSource io.Reader) (*certutil.ParsedCSRBundle, error) {
+func generateIntermediateCSR(ctx context.Context, b *backend, input *inputBundle, randomSource io.Reader) (*certutil.ParsedCSRBundle, error) {
+	keyGenerator, err := getKeyGenerator(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
 	creation, err := generateCreationBundle(b, input, nil, nil)
 	if err != nil {
 		return nil, err
@@ -519,7 +567,7 @@ func generateIntermediateCSR(b *backend, input *inputBundle, randomSource io.Rea
 	}
 
 	addBasicConstraints := input.apiData != nil && input.apiData.Get("add_basic_constraints").(bool)
-	parsedBundle, err := certutil.CreateCSRWithRandomSource(creation, addBasicConstraints, randomSource)
+	parsedBundle, err := certutil.CreateCSRWithKeyGenerator(creation, addBasicConstraints, randomSource, keyGenerator)
 	if err != nil {
 		return nil, err
 	}
@@ -636,6 +684,12 @@ func signCert(b *backend,
 		return nil, errutil.InternalError{Err: "nil parameters received from parameter bundle generation"}
 	}
 
+	if data.role.EnforceCSRProfile {
+		if err := checkCSRProfile(csr, creation.Params); err != nil {
+			return nil, err
+		}
+	}
+
 	creation.Params.IsCA = isCA
 	creation.Params.UseCSRValues = useCSRValues
 
@@ -768,15 +822,37 @@ func generateCreationBundle(b *backend, data *inputBundle, caSign *certutil.CAIn
 	var ridSerialNumber string
 	dnsNames := []string{}
 	emailAddresses := []string{}
+	// Names derived from the role's templates are vouched for by the role
+	// itself, so they are not checked against its allowed domains
+	var derivedSubject map[string]string
+	var derivedNames []string
 	{
+		var err error
+		derivedSubject, err = renderSubjectTemplates(b, data)
+		if err != nil {
+			return nil, err
+		}
+		derivedDNSNames, derivedEmailAddresses, err := renderAltNamesTemplates(b, data)
+		if err != nil {
+			return nil, err
+		}
+
 		if csr != nil && data.role.UseCSRCommonName {
 			cn = csr.Subject.CommonName
 		}
 		if cn == "" {
 			cn = data.apiData.Get("common_name").(string)
-			if cn == "" && data.role.RequireCN {
-				return nil, errutil.UserError{Err: `the common_name field is required, or must be provided in a CSR with "use_csr_common_name" set to true, unless "require_cn" is set to false`}
+		}
+		if derivedCN, ok := derivedSubject["common_name"]; ok {
+			if cn != "" && !strings.EqualFold(cn, derivedCN) {
+				return nil, errutil.UserError{Err: fmt.Sprintf(
+					"common name %s does not match the common name %s derived by this role", cn, derivedCN)}
 			}
+			cn = derivedCN
+			derivedNames = append(derivedNames, derivedCN)
+		}
+		if cn == "" && data.role.RequireCN {
+			return nil, errutil.UserError{Err: `the common_name field is required, or must be provided in a CSR with "use_csr_common_name" set to true, unless "require_cn" is set to false`}
 		}
 
 		ridSerialNumber = data.apiData.Get("serial_number").(string)
@@ -786,7 +862,19 @@ func generateCreationBundle(b *backend, data *inputBundle, caSign *certutil.CAIn
 			ridSerialNumber = csr.Subject.SerialNumber
 		}
 
-		if csr != nil && data.role.UseCSRSANs {
+		derivedSerialNumber, hasDerivedSerialNumber := derivedSubject["serial_number"]
+		if hasDerivedSerialNumber {
+			if ridSerialNumber != "" && ridSerialNumber != derivedSerialNumber {
+				return nil, errutil.UserError{Err: fmt.Sprintf(
+					"serial_number %s does not match the serial number %s derived by this role", ridSerialNumber, derivedSerialNumber)}
+			}
+			ridSerialNumber = derivedSerialNumber
+		}
+
+		// A role enforcing a CSR profile with templated SANs issues only the
+		// SANs it derives, so that checkCSRProfile rejects any others
+		profileSANs := data.role.EnforceCSRProfile && len(data.role.AltNamesTemplates) > 0
+		if csr != nil && data.role.UseCSRSANs && !profileSANs {
 			dnsNames = csr.DNSNames
 			emailAddresses = csr.EmailAddresses
 		}
@@ -842,17 +930,22 @@ func generateCreationBundle(b *backend, data *inputBundle, caSign *certutil.CAIn
 			}
 		}
 
+		dnsNames = append(dnsNames, derivedDNSNames...)
+		emailAddresses = append(emailAddresses, derivedEmailAddresses...)
+		derivedNames = append(derivedNames, derivedDNSNames...)
+		derivedNames = append(derivedNames, derivedEmailAddresses...)
+
 		// Check the CN. This ensures that the CN is checked even if it's
 		// excluded from SANs.
 		if cn != "" {
-			badName := validateNames(b, data, []string{cn})
+			badName := validateNames(b, data, excludeNames([]string{cn}, derivedNames))
 			if len(badName) != 0 {
 				return nil, errutil.UserError{Err: fmt.Sprintf(
 					"common name %s not allowed by this role", badName)}
 			}
 		}
 
-		if ridSerialNumber != "" {
+		if ridSerialNumber != "" && !hasDerivedSerialNumber {
 			badName := validateSerialNumber(data, ridSerialNumber)
 			if len(badName) != 0 {
 				return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -861,13 +954,13 @@ func generateCreationBundle(b *backend, data *inputBundle, caSign *certutil.CAIn
 		}
 
 		// Check for bad email and/or DNS names
-		badName := validateNames(b, data, dnsNames)
+		badName := validateNames(b, data, excludeNames(dnsNames, derivedNames))
 		if len(badName) != 0 {
 			return nil, errutil.UserError{Err: fmt.Sprintf(
 				"subject alternate name %s not allowed by this role", badName)}
 		}
 
-		badName = validateNames(b, data, emailAddresses)
+		badName = validateNames(b, data, excludeNames(emailAddresses, derivedNames))
 		if len(badName) != 0 {
 			return nil, errutil.UserError{Err: fmt.Sprintf(
 				"email address %s not allowed by this role", badName)}
@@ -1029,6 +1122,7 @@ func generateCreationBundle(b *backend, data *inputBundle, caSign *certutil.CAIn
 		StreetAddress:      strutil.RemoveDuplicatesStable(data.role.StreetAddress, false),
 		PostalCode:         strutil.RemoveDuplicatesStable(data.role.PostalCode, false),
 	}
+	applyDerivedSubject(&subject, derivedSubject)
 
 	// Get the TTL and verify it against the max allowed
 	var ttl time.Duration
@@ -0,0 +1,215 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// maxChainLength bounds the chains returned by buildIssuerChains; mounts
+// with cycles of cross-signed issuers would otherwise yield unbounded
+// chains.
+const maxChainLength = 10
+
+// chainCert is a node in the graph of certificates chains are built from.
+type chainCert struct {
+	cert *x509.Certificate
+	pem  string
+}
+
+// isParentOf reports whether parent signed child.
+func isParentOf(parent, child *x509.Certificate) bool {
+	if bytes.Equal(parent.Raw, child.Raw) {
+		return false
+	}
+	if !bytes.Equal(child.RawIssuer, parent.RawSubject) {
+		return false
+	}
+
+	return child.CheckSignatureFrom(parent) == nil
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// loadChainCerts returns the certificates of all issuers in the mount,
+// along with any certificates supplied as part of their imported chains,
+// keyed by raw certificate bytes.
+func loadChainCerts(ctx context.Context, s logical.Storage) (map[issuerID]*issuerEntry, map[string]*chainCert, error) {
+	ids, err := listIssuers(ctx, s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	issuers := make(map[issuerID]*issuerEntry, len(ids))
+	certs := make(map[string]*chainCert)
+	for _, id := range ids {
+		issuer, err := fetchIssuerByID(ctx, s, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		issuers[id] = issuer
+
+		cert, err := issuer.GetCertificate()
+		if err != nil {
+			return nil, nil, err
+		}
+		certs[string(cert.Raw)] = &chainCert{cert: cert, pem: issuer.Certificate}
+	}
+
+	for _, issuer := range issuers {
+		for _, chainPem := range issuer.CAChain {
+			cert, err := parseCertificateFromPEM(chainPem)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to parse chain of issuer %s: %w", issuer.ID, err)
+			}
+			if _, ok := certs[string(cert.Raw)]; !ok {
+				certs[string(cert.Raw)] = &chainCert{cert: cert, pem: chainPem}
+			}
+		}
+	}
+
+	return issuers, certs, nil
+}
+
+// rebuildIssuersChains recomputes the stored CA chain of every issuer: all
+// certificates, from issuers of this mount or from imported chains, through
+// which the issuer chains up to a root, ordered closest first. Issuers
+// cross-signed by several parents thus carry every path in their chain.
+func rebuildIssuersChains(ctx context.Context, s logical.Storage) error {
+	issuers, certs, err := loadChainCerts(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	for _, issuer := range issuers {
+		cert, err := issuer.GetCertificate()
+		if err != nil {
+			return err
+		}
+
+		var chain []string
+		seen := map[string]bool{string(cert.Raw): true}
+		queue := []*x509.Certificate{cert}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+
+			for _, parent := range sortedChainCerts(certs) {
+				if seen[string(parent.cert.Raw)] || !isParentOf(parent.cert, current) {
+					continue
+				}
+				seen[string(parent.cert.Raw)] = true
+				chain = append(chain, strings.TrimSpace(parent.pem))
+				queue = append(queue, parent.cert)
+			}
+		}
+
+		// Keep certificates supplied with an imported chain even when they
+		// do not verify against the certificates known to this mount.
+		for _, chainPem := range issuer.CAChain {
+			chainCert, err := parseCertificateFromPEM(chainPem)
+			if err != nil {
+				return err
+			}
+			if !seen[string(chainCert.Raw)] {
+				seen[string(chainCert.Raw)] = true
+				chain = append(chain, strings.TrimSpace(chainPem))
+			}
+		}
+
+		if (len(chain) == 0 && len(issuer.CAChain) == 0) || reflect.DeepEqual(chain, issuer.CAChain) {
+			continue
+		}
+
+		issuer.CAChain = chain
+		if err := writeIssuer(ctx, s, issuer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// buildIssuerChains returns every distinct chain from the issuer to a
+// self-signed root or to the last certificate known to the mount. Each
+// chain starts with the issuer's own certificate.
+func buildIssuerChains(ctx context.Context, s logical.Storage, id issuerID) ([][]string, error) {
+	issuers, certs, err := loadChainCerts(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer, ok := issuers[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown issuer %s", id)
+	}
+	cert, err := issuer.GetCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := sortedChainCerts(certs)
+
+	var chains [][]string
+	var walk func(path []*chainCert)
+	walk = func(path []*chainCert) {
+		current := path[len(path)-1]
+
+		extended := false
+		if !isSelfSigned(current.cert) && len(path) < maxChainLength {
+			for _, parent := range candidates {
+				if !isParentOf(parent.cert, current.cert) || chainContains(path, parent) {
+					continue
+				}
+				extended = true
+				walk(append(append([]*chainCert{}, path...), parent))
+			}
+		}
+
+		if !extended {
+			chain := make([]string, 0, len(path))
+			for _, node := range path {
+				chain = append(chain, strings.TrimSpace(node.pem))
+			}
+			chains = append(chains, chain)
+		}
+	}
+	walk([]*chainCert{certs[string(cert.Raw)]})
+
+	return chains, nil
+}
+
+func chainContains(path []*chainCert, node *chainCert) bool {
+	for _, existing := range path {
+		if existing == node {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sortedChainCerts returns the certificates in a stable order, so that
+// chains are computed deterministically.
+func sortedChainCerts(certs map[string]*chainCert) []*chainCert {
+	keys := make([]string, 0, len(certs))
+	for key := range certs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]*chainCert, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, certs[key])
+	}
+
+	return result
+}
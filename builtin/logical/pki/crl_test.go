@@ -1,7 +1,11 @@
 package pki
 
 import (
+	"context"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
 	"testing"
 
 	"github.com/hashicorp/vault/api"
@@ -122,3 +126,145 @@ func TestBackend_CRL_EnableDisable(t *testing.T) {
 	toggle(false)
 	test(6)
 }
+
+func TestBackend_CRL_DeltaAutoRebuild(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	write := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %s: err: %v resp: %#v", path, err, resp)
+		}
+		return resp
+	}
+
+	fetchCRL := func(path string) *pkix.CertificateList {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      path,
+			Storage:   storage,
+		})
+		if err != nil || resp == nil {
+			t.Fatalf("bad: %s: err: %v resp: %#v", path, err, resp)
+		}
+		crl, err := x509.ParseCRL(resp.Data[logical.HTTPRawBody].([]byte))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return crl
+	}
+
+	findExtension := func(crl *pkix.CertificateList, oid asn1.ObjectIdentifier) *pkix.Extension {
+		for _, ext := range crl.TBSCertList.Extensions {
+			if ext.Id.Equal(oid) {
+				return &ext
+			}
+		}
+		return nil
+	}
+
+	write("root/generate/internal", map[string]interface{}{
+		"common_name": "root.example.com",
+		"ttl":         "48h",
+	})
+	write("roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+	})
+	write("config/urls", map[string]interface{}{
+		"delta_crl_distribution_points": "https://vault.example.com/v1/pki/crl/delta",
+	})
+
+	// Delta CRLs are only built alongside automatic rebuilding
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/crl",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"enable_delta": true,
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error enabling delta CRLs alone: err: %v resp: %#v", err, resp)
+	}
+
+	write("config/crl", map[string]interface{}{
+		"auto_rebuild":           true,
+		"enable_delta":           true,
+		"delta_rebuild_interval": "1ns",
+	})
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "crl/rotate",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	complete := fetchCRL("crl")
+	if findExtension(complete, oidFreshestCRL) == nil {
+		t.Fatal("expected complete CRL to point to the delta CRL")
+	}
+	if len(fetchCRL("crl/delta").TBSCertList.RevokedCertificates) != 0 {
+		t.Fatal("expected empty delta CRL")
+	}
+
+	resp = write("issue/example", map[string]interface{}{
+		"common_name": "www.example.com",
+	})
+	write("revoke", map[string]interface{}{
+		"serial_number": resp.Data["serial_number"],
+	})
+
+	// Revocation no longer rebuilds the complete CRL synchronously
+	if len(fetchCRL("crl").TBSCertList.RevokedCertificates) != 0 {
+		t.Fatal("expected complete CRL to be unchanged by revocation")
+	}
+
+	if err := b.rebuildCRLsIfNeeded(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+
+	delta := fetchCRL("crl/delta")
+	if len(delta.TBSCertList.RevokedCertificates) != 1 {
+		t.Fatalf("expected the revocation on the delta CRL, found %d entries", len(delta.TBSCertList.RevokedCertificates))
+	}
+	indicator := findExtension(delta, oidDeltaCRLIndicator)
+	if indicator == nil || !indicator.Critical {
+		t.Fatal("expected a critical Delta CRL Indicator extension")
+	}
+	var baseNumber *big.Int
+	if _, err := asn1.Unmarshal(indicator.Value, &baseNumber); err != nil {
+		t.Fatal(err)
+	}
+	var completeNumber *big.Int
+	if _, err := asn1.Unmarshal(findExtension(complete, asn1.ObjectIdentifier{2, 5, 29, 20}).Value, &completeNumber); err != nil {
+		t.Fatal(err)
+	}
+	if baseNumber.Cmp(completeNumber) != 0 {
+		t.Fatalf("expected delta CRL to reference CRL number %v, got %v", completeNumber, baseNumber)
+	}
+
+	// A complete rebuild folds the revocation in and empties the delta CRL
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "crl/rotate",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if len(fetchCRL("crl").TBSCertList.RevokedCertificates) != 1 {
+		t.Fatal("expected the revocation on the complete CRL")
+	}
+	if len(fetchCRL("crl/delta").TBSCertList.RevokedCertificates) != 0 {
+		t.Fatal("expected empty delta CRL after a complete rebuild")
+	}
+}
@@ -1,24 +1,35 @@
 package pki
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"errors"
+	"encoding/asn1"
 	"fmt"
+	"math/big"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
+var (
+	// oidDeltaCRLIndicator marks a CRL as a delta CRL, RFC 5280 Section 5.2.4.
+	oidDeltaCRLIndicator = asn1.ObjectIdentifier{2, 5, 29, 27}
+	// oidFreshestCRL points to the delta CRL, RFC 5280 Section 5.2.6.
+	oidFreshestCRL = asn1.ObjectIdentifier{2, 5, 29, 46}
+)
+
 type revocationInfo struct {
 	CertificateBytes  []byte    `json:"certificate_bytes"`
 	RevocationTime    int64     `json:"revocation_time"`
 	RevocationTimeUTC time.Time `json:"revocation_time_utc"`
+	CertificateIssuer issuerID  `json:"issuer_id"`
 }
 
 // Revokes a cert, and tries to be smart about error recovery
@@ -32,19 +43,23 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 		return nil, nil
 	}
 
-	signingBundle, caErr := fetchCAInfo(ctx, req)
-	switch caErr.(type) {
-	case errutil.UserError:
-		return logical.ErrorResponse(fmt.Sprintf("could not fetch the CA certificate: %s", caErr)), nil
-	case errutil.InternalError:
-		return nil, fmt.Errorf("error fetching CA certificate: %s", caErr)
+	issuerCerts, err := fetchIssuerCertificates(ctx, req.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching CA certificates: %w", err)
 	}
-	if signingBundle == nil {
-		return nil, errors.New("CA info not found")
+	if len(issuerCerts) == 0 {
+		return logical.ErrorResponse("could not fetch the CA certificate: backend must be configured with a CA certificate/key"), nil
 	}
 	colonSerial := strings.Replace(strings.ToLower(serial), "-", ":", -1)
-	if colonSerial == certutil.GetHexFormatted(signingBundle.Certificate.SerialNumber.Bytes(), ":") {
-		return logical.ErrorResponse("adding CA to CRL is not allowed"), nil
+	for _, issuerCert := range issuerCerts {
+		if colonSerial == certutil.GetHexFormatted(issuerCert.SerialNumber.Bytes(), ":") {
+			return logical.ErrorResponse("adding CA to CRL is not allowed"), nil
+		}
+	}
+
+	crlInfo, err := b.CRL(ctx, req.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching CRL config information: %w", err)
 	}
 
 	alreadyRevoked := false
@@ -113,6 +128,7 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 		revInfo.CertificateBytes = certEntry.Value
 		revInfo.RevocationTime = currTime.Unix()
 		revInfo.RevocationTimeUTC = currTime.UTC()
+		revInfo.CertificateIssuer = findIssuerForCert(cert, issuerCerts)
 
 		revEntry, err = logical.StorageEntryJSON("revoked/"+normalizeSerial(serial), revInfo)
 		if err != nil {
@@ -124,14 +140,27 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 			return nil, fmt.Errorf("error saving revoked certificate to new location")
 		}
 
+		if crlInfo != nil && crlInfo.EnableDelta {
+			err = req.Storage.Put(ctx, &logical.StorageEntry{
+				Key:   deltaWALPrefix + normalizeSerial(serial),
+				Value: []byte{},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error saving delta WAL entry: %w", err)
+			}
+		}
 	}
 
-	crlErr := buildCRL(ctx, b, req, false)
-	switch crlErr.(type) {
-	case errutil.UserError:
-		return logical.ErrorResponse(fmt.Sprintf("Error during CRL building: %s", crlErr)), nil
-	case errutil.InternalError:
-		return nil, fmt.Errorf("error encountered during CRL building: %w", crlErr)
+	// With automatic rebuilding, the revocation is picked up by the next
+	// periodic (delta) CRL build instead.
+	if crlInfo == nil || !crlInfo.AutoRebuild {
+		crlErr := buildCRL(ctx, b, req, false)
+		switch crlErr.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(fmt.Sprintf("Error during CRL building: %s", crlErr)), nil
+		case errutil.InternalError:
+			return nil, fmt.Errorf("error encountered during CRL building: %w", crlErr)
+		}
 	}
 
 	resp := &logical.Response{
@@ -145,18 +174,162 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 	return resp, nil
 }
 
-// Builds a CRL by going through the list of revoked certificates and building
-// a new CRL with the stored revocation times and serial numbers.
+// findIssuerForCert returns the identifier of the issuer which signed the
+// given certificate, or an empty identifier if none of them did.
+func findIssuerForCert(cert *x509.Certificate, issuerCerts map[issuerID]*x509.Certificate) issuerID {
+	for id, issuerCert := range issuerCerts {
+		if !bytes.Equal(cert.RawIssuer, issuerCert.RawSubject) {
+			continue
+		}
+		if err := cert.CheckSignatureFrom(issuerCert); err == nil {
+			return id
+		}
+	}
+
+	return issuerID("")
+}
+
+// fetchIssuerCRLEntry returns the DER-encoded CRL of the referenced issuer as
+// a storage entry, or nil if no such issuer or CRL exists.
+func fetchIssuerCRLEntry(ctx context.Context, s logical.Storage, issuerRef string) (*logical.StorageEntry, error) {
+	id, err := resolveIssuerReference(ctx, s, issuerRef)
+	if err != nil {
+		if _, ok := err.(errutil.UserError); !ok {
+			return nil, asTypedError(err, "unable to resolve issuer reference")
+		}
+		if issuerRef != defaultRef {
+			return nil, nil
+		}
+	}
+
+	var crlEntry *logical.StorageEntry
+	if len(id) > 0 {
+		crlEntry, err = s.Get(ctx, crlPrefix+id.String())
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("error fetching CRL: %s", err)}
+		}
+	}
+
+	// CRLs built before the mount was migrated to multiple issuers only
+	// exist at the legacy location until the next rebuild.
+	if crlEntry == nil && issuerRef == defaultRef {
+		crlEntry, err = s.Get(ctx, legacyCRLPath)
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("error fetching CRL: %s", err)}
+		}
+	}
+
+	return crlEntry, nil
+}
+
+// fetchIssuerDeltaCRLEntry returns the DER-encoded delta CRL of the
+// referenced issuer as a storage entry, or nil if none exists.
+func fetchIssuerDeltaCRLEntry(ctx context.Context, s logical.Storage, issuerRef string) (*logical.StorageEntry, error) {
+	id, err := resolveIssuerReference(ctx, s, issuerRef)
+	if err != nil {
+		if _, ok := err.(errutil.UserError); ok {
+			return nil, nil
+		}
+		return nil, asTypedError(err, "unable to resolve issuer reference")
+	}
+
+	crlEntry, err := s.Get(ctx, deltaCRLPrefix+id.String())
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("error fetching delta CRL: %s", err)}
+	}
+
+	return crlEntry, nil
+}
+
+// crlState tracks CRL numbering and build times across the issuers of the
+// mount.
+type crlState struct {
+	// CRLNumbers holds the number of the last CRL, complete or delta,
+	// built for each issuer.
+	CRLNumbers map[issuerID]int64 `json:"crl_numbers"`
+
+	// CompleteCRLNumbers holds the number of the last complete CRL built
+	// for each issuer, which its delta CRLs reference.
+	CompleteCRLNumbers map[issuerID]int64 `json:"complete_crl_numbers"`
+
+	LastCompleteBuild time.Time `json:"last_complete_build"`
+	LastDeltaBuild    time.Time `json:"last_delta_build"`
+
+	// DeltaEntries is the number of revocations covered by the last delta
+	// CRLs; the delta CRLs are only rebuilt when this changes.
+	DeltaEntries int `json:"delta_entries"`
+}
+
+func getCRLState(ctx context.Context, s logical.Storage) (*crlState, error) {
+	entry, err := s.Get(ctx, crlStatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &crlState{}
+	if entry != nil {
+		if err := entry.DecodeJSON(state); err != nil {
+			return nil, err
+		}
+	}
+	if state.CRLNumbers == nil {
+		state.CRLNumbers = make(map[issuerID]int64)
+	}
+	if state.CompleteCRLNumbers == nil {
+		state.CompleteCRLNumbers = make(map[issuerID]int64)
+	}
+
+	return state, nil
+}
+
+func setCRLState(ctx context.Context, s logical.Storage, state *crlState) error {
+	entry, err := logical.StorageEntryJSON(crlStatePath, state)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+// nextCRLNumber allocates the next CRL number of the issuer. CRL numbers
+// are shared between complete and delta CRLs, per RFC 5280 Section 5.2.3.
+func (s *crlState) nextCRLNumber(id issuerID) int64 {
+	s.CRLNumbers[id]++
+	return s.CRLNumbers[id]
+}
+
+// Builds the CRLs of all issuers by going through the list of revoked
+// certificates and building a new CRL per issuer with the stored revocation
+// times and serial numbers. When delta CRLs are enabled, fresh (empty)
+// delta CRLs are built on top of the new complete CRLs.
 func buildCRL(ctx context.Context, b *backend, req *logical.Request, forceNew bool) error {
 	crlInfo, err := b.CRL(ctx, req.Storage)
 	if err != nil {
 		return errutil.InternalError{Err: fmt.Sprintf("error fetching CRL config information: %s", err)}
 	}
 
+	issuerCerts, err := fetchIssuerCertificates(ctx, req.Storage)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching CA certificates: %s", err)}
+	}
+	if len(issuerCerts) == 0 {
+		return errutil.UserError{Err: "could not fetch the CA certificate: backend must be configured with a CA certificate/key"}
+	}
+
+	issuerConfig, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching issuer configuration: %s", err)}
+	}
+
+	state, err := getCRLState(ctx, req.Storage)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching CRL state: %s", err)}
+	}
+
 	crlLifetime := b.crlLifetime
-	var revokedCerts []pkix.RevokedCertificate
-	var revInfo revocationInfo
-	var revokedSerials []string
+	revokedCerts := make(map[issuerID][]pkix.RevokedCertificate)
+	var revokedSerials, walSerials []string
+	enableDelta := false
 
 	if crlInfo != nil {
 		if crlInfo.Expiry != "" {
@@ -173,6 +346,15 @@ func buildCRL(ctx context.Context, b *backend, req *logical.Request, forceNew bo
 			}
 			goto WRITE
 		}
+
+		enableDelta = crlInfo.EnableDelta
+	}
+
+	// Everything in the delta WAL at this point is covered by the complete
+	// CRLs built below, so these entries are removed once they're written.
+	walSerials, err = req.Storage.List(ctx, deltaWALPrefix)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching list of delta WAL entries: %s", err)}
 	}
 
 	revokedSerials, err = req.Storage.List(ctx, "revoked/")
@@ -180,29 +362,207 @@ func buildCRL(ctx context.Context, b *backend, req *logical.Request, forceNew bo
 		return errutil.InternalError{Err: fmt.Sprintf("error fetching list of revoked certs: %s", err)}
 	}
 
-	for _, serial := range revokedSerials {
-		revokedEntry, err := req.Storage.Get(ctx, "revoked/"+serial)
+	revokedCerts, err = fetchRevokedCertsByIssuer(ctx, req.Storage, revokedSerials, issuerCerts, issuerConfig.DefaultIssuerID, false)
+	if err != nil {
+		return err
+	}
+
+WRITE:
+	now := time.Now()
+	for id := range issuerCerts {
+		signingBundle, caErr := fetchCAInfo(ctx, req, id.String())
+		switch caErr.(type) {
+		case errutil.UserError:
+			// Issuers without a key cannot sign a CRL.
+			continue
+		case errutil.InternalError:
+			return errutil.InternalError{Err: fmt.Sprintf("error fetching CA certificate: %s", caErr)}
+		}
+
+		var crlBytes []byte
+		if canNumberCRLs(signingBundle.Certificate) {
+			template := &x509.RevocationList{
+				RevokedCertificates: revokedCerts[id],
+				Number:              big.NewInt(state.nextCRLNumber(id)),
+				ThisUpdate:          now,
+				NextUpdate:          now.Add(crlLifetime),
+			}
+			if enableDelta && signingBundle.URLs != nil && len(signingBundle.URLs.DeltaCRLDistributionPoints) > 0 {
+				ext, err := freshestCRLExtension(signingBundle.URLs.DeltaCRLDistributionPoints)
+				if err != nil {
+					return errutil.InternalError{Err: fmt.Sprintf("error creating Freshest CRL extension: %s", err)}
+				}
+				template.ExtraExtensions = append(template.ExtraExtensions, ext)
+			}
+
+			crlBytes, err = x509.CreateRevocationList(rand.Reader, template, signingBundle.Certificate, signingBundle.PrivateKey)
+			state.CompleteCRLNumbers[id] = template.Number.Int64()
+		} else {
+			crlBytes, err = signingBundle.Certificate.CreateCRL(rand.Reader, signingBundle.PrivateKey, revokedCerts[id], now, now.Add(crlLifetime))
+			delete(state.CompleteCRLNumbers, id)
+		}
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error creating new CRL: %s", err)}
+		}
+
+		err = req.Storage.Put(ctx, &logical.StorageEntry{
+			Key:   crlPrefix + id.String(),
+			Value: crlBytes,
+		})
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error storing CRL: %s", err)}
+		}
+
+		// Keep the legacy location in sync with the default issuer's CRL.
+		if id == issuerConfig.DefaultIssuerID {
+			err = req.Storage.Put(ctx, &logical.StorageEntry{
+				Key:   legacyCRLPath,
+				Value: crlBytes,
+			})
+			if err != nil {
+				return errutil.InternalError{Err: fmt.Sprintf("error storing CRL: %s", err)}
+			}
+		}
+	}
+
+	state.LastCompleteBuild = now
+	if err := setCRLState(ctx, req.Storage, state); err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error storing CRL state: %s", err)}
+	}
+
+	for _, serial := range walSerials {
+		if err := req.Storage.Delete(ctx, deltaWALPrefix+serial); err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error removing delta WAL entry for serial %s: %s", serial, err)}
+		}
+	}
+
+	if enableDelta {
+		return buildDeltaCRL(ctx, b, req, crlLifetime)
+	}
+
+	return nil
+}
+
+// buildDeltaCRL builds a delta CRL for each issuer with a numbered complete
+// CRL, containing the certificates revoked since that CRL was built.
+func buildDeltaCRL(ctx context.Context, b *backend, req *logical.Request, crlLifetime time.Duration) error {
+	issuerCerts, err := fetchIssuerCertificates(ctx, req.Storage)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching CA certificates: %s", err)}
+	}
+
+	issuerConfig, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching issuer configuration: %s", err)}
+	}
+
+	state, err := getCRLState(ctx, req.Storage)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching CRL state: %s", err)}
+	}
+
+	walSerials, err := req.Storage.List(ctx, deltaWALPrefix)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching list of delta WAL entries: %s", err)}
+	}
+
+	revokedCerts, err := fetchRevokedCertsByIssuer(ctx, req.Storage, walSerials, issuerCerts, issuerConfig.DefaultIssuerID, true)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for id := range issuerCerts {
+		baseNumber, ok := state.CompleteCRLNumbers[id]
+		if !ok {
+			// Delta CRLs need a numbered complete CRL to refer to.
+			continue
+		}
+
+		signingBundle, caErr := fetchCAInfo(ctx, req, id.String())
+		switch caErr.(type) {
+		case errutil.UserError:
+			continue
+		case errutil.InternalError:
+			return errutil.InternalError{Err: fmt.Sprintf("error fetching CA certificate: %s", caErr)}
+		}
+
+		indicator, err := asn1.Marshal(big.NewInt(baseNumber))
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error creating Delta CRL Indicator extension: %s", err)}
+		}
+
+		template := &x509.RevocationList{
+			RevokedCertificates: revokedCerts[id],
+			Number:              big.NewInt(state.nextCRLNumber(id)),
+			ThisUpdate:          now,
+			NextUpdate:          now.Add(crlLifetime),
+			ExtraExtensions: []pkix.Extension{
+				{
+					Id:       oidDeltaCRLIndicator,
+					Critical: true,
+					Value:    indicator,
+				},
+			},
+		}
+
+		crlBytes, err := x509.CreateRevocationList(rand.Reader, template, signingBundle.Certificate, signingBundle.PrivateKey)
 		if err != nil {
-			return errutil.InternalError{Err: fmt.Sprintf("unable to fetch revoked cert with serial %s: %s", serial, err)}
+			return errutil.InternalError{Err: fmt.Sprintf("error creating new delta CRL: %s", err)}
+		}
+
+		err = req.Storage.Put(ctx, &logical.StorageEntry{
+			Key:   deltaCRLPrefix + id.String(),
+			Value: crlBytes,
+		})
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error storing delta CRL: %s", err)}
+		}
+	}
+
+	state.LastDeltaBuild = now
+	state.DeltaEntries = len(walSerials)
+	if err := setCRLState(ctx, req.Storage, state); err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error storing CRL state: %s", err)}
+	}
+
+	return nil
+}
+
+// fetchRevokedCertsByIssuer loads the revocation entries of the given
+// serials, grouped by the issuer whose CRL they belong on. When
+// skipMissing is set, serials without a revocation entry are ignored
+// rather than treated as an error.
+func fetchRevokedCertsByIssuer(ctx context.Context, s logical.Storage, serials []string, issuerCerts map[issuerID]*x509.Certificate, defaultID issuerID, skipMissing bool) (map[issuerID][]pkix.RevokedCertificate, error) {
+	revokedCerts := make(map[issuerID][]pkix.RevokedCertificate)
+
+	for _, serial := range serials {
+		var revInfo revocationInfo
+		revokedEntry, err := s.Get(ctx, "revoked/"+serial)
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch revoked cert with serial %s: %s", serial, err)}
 		}
 		if revokedEntry == nil {
-			return errutil.InternalError{Err: fmt.Sprintf("revoked certificate entry for serial %s is nil", serial)}
+			if skipMissing {
+				continue
+			}
+			return nil, errutil.InternalError{Err: fmt.Sprintf("revoked certificate entry for serial %s is nil", serial)}
 		}
 		if revokedEntry.Value == nil || len(revokedEntry.Value) == 0 {
 			// TODO: In this case, remove it and continue? How likely is this to
 			// happen? Alternately, could skip it entirely, or could implement a
 			// delete function so that there is a way to remove these
-			return errutil.InternalError{Err: fmt.Sprintf("found revoked serial but actual certificate is empty")}
+			return nil, errutil.InternalError{Err: fmt.Sprintf("found revoked serial but actual certificate is empty")}
 		}
 
 		err = revokedEntry.DecodeJSON(&revInfo)
 		if err != nil {
-			return errutil.InternalError{Err: fmt.Sprintf("error decoding revocation entry for serial %s: %s", serial, err)}
+			return nil, errutil.InternalError{Err: fmt.Sprintf("error decoding revocation entry for serial %s: %s", serial, err)}
 		}
 
 		revokedCert, err := x509.ParseCertificate(revInfo.CertificateBytes)
 		if err != nil {
-			return errutil.InternalError{Err: fmt.Sprintf("unable to parse stored revoked certificate with serial %s: %s", serial, err)}
+			return nil, errutil.InternalError{Err: fmt.Sprintf("unable to parse stored revoked certificate with serial %s: %s", serial, err)}
 		}
 
 		// NOTE: We have to change this to UTC time because the CRL standard
@@ -215,30 +575,137 @@ func buildCRL(ctx context.Context, b *backend, req *logical.Request, forceNew bo
 		} else {
 			newRevCert.RevocationTime = time.Unix(revInfo.RevocationTime, 0).UTC()
 		}
-		revokedCerts = append(revokedCerts, newRevCert)
+
+		// Entries written before issuers existed, or whose issuer has since
+		// been removed, are matched by signature; anything still left over
+		// is placed on the default issuer's CRL as it was previously.
+		id := revInfo.CertificateIssuer
+		if _, ok := issuerCerts[id]; !ok {
+			id = findIssuerForCert(revokedCert, issuerCerts)
+		}
+		if len(id) == 0 {
+			id = defaultID
+		}
+
+		revokedCerts[id] = append(revokedCerts[id], newRevCert)
 	}
 
-WRITE:
-	signingBundle, caErr := fetchCAInfo(ctx, req)
-	switch caErr.(type) {
-	case errutil.UserError:
-		return errutil.UserError{Err: fmt.Sprintf("could not fetch the CA certificate: %s", caErr)}
-	case errutil.InternalError:
-		return errutil.InternalError{Err: fmt.Sprintf("error fetching CA certificate: %s", caErr)}
+	return revokedCerts, nil
+}
+
+// canNumberCRLs reports whether CRLs carrying a CRL number can be built for
+// the issuer. These require the issuer to assert the cRLSign key usage and
+// to carry a subject key identifier; imported issuers lacking either get
+// unnumbered CRLs, and thus no delta CRLs.
+func canNumberCRLs(issuer *x509.Certificate) bool {
+	return issuer.KeyUsage&x509.KeyUsageCRLSign != 0 && len(issuer.SubjectKeyId) > 0
+}
+
+// freshestCRLExtension builds the Freshest CRL extension pointing relying
+// parties at the delta CRL, RFC 5280 Section 5.2.6.
+func freshestCRLExtension(urls []string) (pkix.Extension, error) {
+	type distributionPointName struct {
+		FullName []asn1.RawValue `asn1:"optional,tag:0"`
+	}
+	type distributionPoint struct {
+		DistributionPoint distributionPointName `asn1:"optional,tag:0"`
 	}
 
-	crlBytes, err := signingBundle.Certificate.CreateCRL(rand.Reader, signingBundle.PrivateKey, revokedCerts, time.Now(), time.Now().Add(crlLifetime))
+	var points []distributionPoint
+	for _, url := range urls {
+		points = append(points, distributionPoint{
+			DistributionPoint: distributionPointName{
+				FullName: []asn1.RawValue{
+					{Tag: 6, Class: asn1.ClassContextSpecific, Bytes: []byte(url)},
+				},
+			},
+		})
+	}
+
+	value, err := asn1.Marshal(points)
 	if err != nil {
-		return errutil.InternalError{Err: fmt.Sprintf("error creating new CRL: %s", err)}
+		return pkix.Extension{}, err
 	}
 
-	err = req.Storage.Put(ctx, &logical.StorageEntry{
-		Key:   "crl",
-		Value: crlBytes,
-	})
+	return pkix.Extension{
+		Id:    oidFreshestCRL,
+		Value: value,
+	}, nil
+}
+
+// rebuildCRLsIfNeeded is run periodically to rebuild complete CRLs ahead of
+// their expiry and delta CRLs when new revocations were recorded.
+func (b *backend) rebuildCRLsIfNeeded(ctx context.Context, req *logical.Request) error {
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby | consts.ReplicationDRSecondary) {
+		return nil
+	}
+
+	crlInfo, err := b.CRL(ctx, req.Storage)
 	if err != nil {
-		return errutil.InternalError{Err: fmt.Sprintf("error storing CRL: %s", err)}
+		return err
+	}
+	if crlInfo == nil || crlInfo.Disable || (!crlInfo.AutoRebuild && !crlInfo.EnableDelta) {
+		return nil
+	}
+
+	crlLifetime := b.crlLifetime
+	if crlInfo.Expiry != "" {
+		crlLifetime, err = time.ParseDuration(crlInfo.Expiry)
+		if err != nil {
+			return fmt.Errorf("error parsing CRL duration of %s: %w", crlInfo.Expiry, err)
+		}
+	}
+
+	b.revokeStorageLock.Lock()
+	defer b.revokeStorageLock.Unlock()
+
+	issuers, err := listIssuers(ctx, req.Storage)
+	if err != nil || len(issuers) == 0 {
+		return err
+	}
+
+	state, err := getCRLState(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if crlInfo.AutoRebuild {
+		gracePeriod, err := parseDurationOrDefault(crlInfo.AutoRebuildGracePeriod, defaultAutoRebuildGracePeriod)
+		if err != nil {
+			return err
+		}
+
+		if now.After(state.LastCompleteBuild.Add(crlLifetime - gracePeriod)) {
+			return buildCRL(ctx, b, req, false)
+		}
+	}
+
+	if crlInfo.EnableDelta {
+		interval, err := parseDurationOrDefault(crlInfo.DeltaRebuildInterval, defaultDeltaRebuildInterval)
+		if err != nil {
+			return err
+		}
+		if now.Before(state.LastDeltaBuild.Add(interval)) {
+			return nil
+		}
+
+		walSerials, err := req.Storage.List(ctx, deltaWALPrefix)
+		if err != nil {
+			return err
+		}
+		if len(walSerials) != state.DeltaEntries {
+			return buildDeltaCRL(ctx, b, req, crlLifetime)
+		}
 	}
 
 	return nil
 }
+
+func parseDurationOrDefault(value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	return time.ParseDuration(value)
+}
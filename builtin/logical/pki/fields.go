@@ -1,6 +1,10 @@
 package pki
 
-import "github.com/hashicorp/vault/sdk/framework"
+import (
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+)
 
 // addIssueAndSignCommonFields adds fields common to both CA and non-CA issuing
 // and signing
@@ -123,6 +127,13 @@ be larger than the role max TTL.`,
 		},
 	}
 
+	fields["cert_metadata"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Arbitrary metadata to store alongside the
+certificate, readable through cert-metadata/.
+Only accepted by roles with "store_metadata" set.`,
+	}
+
 	return fields
 }
 
@@ -242,10 +253,22 @@ the alt_names map using OID 2.5.4.5.`,
 func addCAKeyGenerationFields(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
 	fields["exported"] = &framework.FieldSchema{
 		Type: framework.TypeString,
-		Description: `Must be "internal" or "exported". If set to
+		Description: `Must be "internal", "exported" or "existing". If set to
 "exported", the generated private key will be
 returned. This is your *only* chance to retrieve
-the private key!`,
+the private key! If set to "existing", no key is
+generated; the key referenced by key_ref, which
+may be a managed key, is used instead and its
+type and size override key_type and key_bits.`,
+	}
+
+	fields[keyRefParam] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Only used when "exported" is "existing"; reference
+to the existing key to use, either by ID or name.
+The value "default" refers to the mount's default
+key.`,
+		Default: defaultRef,
 	}
 
 	fields["key_bits"] = &framework.FieldSchema{
@@ -303,3 +326,103 @@ func addCAIssueFields(fields map[string]*framework.FieldSchema) map[string]*fram
 
 	return fields
 }
+
+// issuerRefParam is the name of the path parameter and field holding a
+// reference to an issuer
+const issuerRefParam = "issuer_ref"
+
+// keyRefParam is the name of the path parameter and field holding a
+// reference to a key
+const keyRefParam = "key_ref"
+
+// addIssuerRefField adds the field used to reference an issuer by name,
+// identifier, or "default"
+func addIssuerRefField(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields[issuerRefParam] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Reference to an existing issuer, either by ID or
+name. The value "default" refers to the mount's
+default issuer.`,
+		Default: defaultRef,
+	}
+	return fields
+}
+
+// addKeyRefField adds the field used to reference a key by name, identifier,
+// or "default"
+func addKeyRefField(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields[keyRefParam] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Reference to an existing key, either by ID or
+name. The value "default" refers to the mount's
+default key.`,
+		Default: defaultRef,
+	}
+	return fields
+}
+
+// addIssuerNameField adds the field used to name a newly created issuer
+func addIssuerNameField(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["issuer_name"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Provide a name for the generated or imported
+issuer; the name must be unique across all issuers
+and may not be the reserved value "default".`,
+	}
+	return fields
+}
+
+// addKeyNameField adds the field used to name a newly created key
+func addKeyNameField(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["key_name"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Provide a name for the generated or imported
+key; the name must be unique across all keys and
+may not be the reserved value "default".`,
+	}
+	return fields
+}
+
+// addTidyFields adds the fields selecting what a tidy operation cleans up,
+// shared by the tidy and config/auto-tidy endpoints
+func addTidyFields(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["tidy_cert_store"] = &framework.FieldSchema{
+		Type: framework.TypeBool,
+		Description: `Set to true to enable tidying up
+the certificate store`,
+	}
+
+	fields["tidy_revoked_certs"] = &framework.FieldSchema{
+		Type: framework.TypeBool,
+		Description: `Set to true to expire all revoked
+and expired certificates, removing them both from the CRL and from storage. The
+CRL will be rotated if this causes any values to be removed.`,
+	}
+
+	fields["tidy_expired_issuers"] = &framework.FieldSchema{
+		Type: framework.TypeBool,
+		Description: `Set to true to remove issuers whose
+certificates expired more than issuer_safety_buffer ago. The default
+issuer is never removed. Keys are kept, as they may be in use by other
+issuers.`,
+	}
+
+	fields["safety_buffer"] = &framework.FieldSchema{
+		Type: framework.TypeDurationSecond,
+		Description: `The amount of extra time that must have passed
+beyond certificate expiration before it is removed
+from the backend storage and/or revocation list.
+Defaults to 72 hours.`,
+		Default: int(defaultTidyConfig.SafetyBuffer / time.Second), // TypeDurationSecond currently requires defaults to be int
+	}
+
+	fields["issuer_safety_buffer"] = &framework.FieldSchema{
+		Type: framework.TypeDurationSecond,
+		Description: `The amount of extra time that must have passed
+beyond issuer expiration before it is removed
+from the backend storage. Defaults to 8760 hours (1 year).`,
+		Default: int(defaultTidyConfig.IssuerSafetyBuffer / time.Second),
+	}
+
+	return fields
+}
@@ -0,0 +1,322 @@
+//go:build cgo
+// +build cgo
+
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+var (
+	pkcs11ModulesLock sync.Mutex
+
+	// pkcs11Modules holds the initialized PKCS#11 libraries, keyed by path;
+	// a library may only be initialized once per process.
+	pkcs11Modules = make(map[string]*pkcs11.Ctx)
+)
+
+var (
+	oidNamedCurveP224 = asn1.ObjectIdentifier{1, 3, 132, 0, 33}
+	oidNamedCurveP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidNamedCurveP384 = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidNamedCurveP521 = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+)
+
+// pkcs1v15HashPrefixes are the DER-encoded DigestInfo prefixes which must
+// precede the digest given to the raw CKM_RSA_PKCS mechanism, as done by
+// rsa.SignPKCS1v15.
+var pkcs1v15HashPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA224: {0x30, 0x2d, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x04, 0x05, 0x00, 0x04, 0x1c},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// pkcs11Signer signs with a private key held in a PKCS#11 token, such as an
+// HSM or SoftHSM.
+type pkcs11Signer struct {
+	entry     *managedKeyEntry
+	publicKey crypto.PublicKey
+}
+
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var mechanism *pkcs11.Mechanism
+	input := digest
+
+	switch s.publicKey.(type) {
+	case *rsa.PublicKey:
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			return nil, errors.New("RSA-PSS signatures are not supported with PKCS#11 managed keys")
+		}
+		prefix, ok := pkcs1v15HashPrefixes[opts.HashFunc()]
+		if !ok {
+			return nil, fmt.Errorf("unsupported hash function %v for PKCS#11 managed keys", opts.HashFunc())
+		}
+		input = make([]byte, 0, len(prefix)+len(digest))
+		input = append(input, prefix...)
+		input = append(input, digest...)
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
+	case *ecdsa.PublicKey:
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+	default:
+		return nil, fmt.Errorf("unsupported PKCS#11 managed key type %T", s.publicKey)
+	}
+
+	var signature []byte
+	err := withPKCS11Session(s.entry, func(module *pkcs11.Ctx, session pkcs11.SessionHandle) error {
+		handle, err := findPKCS11Object(module, session, s.entry, pkcs11.CKO_PRIVATE_KEY)
+		if err != nil {
+			return err
+		}
+		if err := module.SignInit(session, []*pkcs11.Mechanism{mechanism}, handle); err != nil {
+			return fmt.Errorf("unable to initialize PKCS#11 signing operation: %w", err)
+		}
+		signature, err = module.Sign(session, input)
+		if err != nil {
+			return fmt.Errorf("unable to sign with PKCS#11 key: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := s.publicKey.(*ecdsa.PublicKey); ok {
+		// CKM_ECDSA returns the raw concatenation of r and s, while Go
+		// expects the ASN.1 encoding.
+		if len(signature)%2 != 0 {
+			return nil, errors.New("malformed ECDSA signature returned by PKCS#11 token")
+		}
+		half := len(signature) / 2
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			R: new(big.Int).SetBytes(signature[:half]),
+			S: new(big.Int).SetBytes(signature[half:]),
+		})
+	}
+
+	return signature, nil
+}
+
+// fetchPKCS11PublicKey reads the public key object matching the entry from
+// the token.
+func fetchPKCS11PublicKey(entry *managedKeyEntry) (crypto.PublicKey, error) {
+	var publicKey crypto.PublicKey
+	err := withPKCS11Session(entry, func(module *pkcs11.Ctx, session pkcs11.SessionHandle) error {
+		handle, err := findPKCS11Object(module, session, entry, pkcs11.CKO_PUBLIC_KEY)
+		if err != nil {
+			return err
+		}
+
+		attrs, err := module.GetAttributeValue(session, handle, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil),
+		})
+		if err != nil {
+			return fmt.Errorf("unable to read PKCS#11 key type: %w", err)
+		}
+
+		switch keyType := bytesToUint(attrs[0].Value); keyType {
+		case pkcs11.CKK_RSA:
+			attrs, err := module.GetAttributeValue(session, handle, []*pkcs11.Attribute{
+				pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+				pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+			})
+			if err != nil {
+				return fmt.Errorf("unable to read PKCS#11 RSA public key: %w", err)
+			}
+			publicKey = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(attrs[0].Value),
+				E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+			}
+		case pkcs11.CKK_EC:
+			attrs, err := module.GetAttributeValue(session, handle, []*pkcs11.Attribute{
+				pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+				pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+			})
+			if err != nil {
+				return fmt.Errorf("unable to read PKCS#11 EC public key: %w", err)
+			}
+			publicKey, err = parsePKCS11ECPublicKey(attrs[0].Value, attrs[1].Value)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported PKCS#11 key type %d; only RSA and EC keys are supported", keyType)
+		}
+
+		return nil
+	})
+
+	return publicKey, err
+}
+
+func parsePKCS11ECPublicKey(params []byte, point []byte) (*ecdsa.PublicKey, error) {
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(params, &oid); err != nil {
+		return nil, fmt.Errorf("unable to parse PKCS#11 EC parameters: %w", err)
+	}
+
+	var curve elliptic.Curve
+	switch {
+	case oid.Equal(oidNamedCurveP224):
+		curve = elliptic.P224()
+	case oid.Equal(oidNamedCurveP256):
+		curve = elliptic.P256()
+	case oid.Equal(oidNamedCurveP384):
+		curve = elliptic.P384()
+	case oid.Equal(oidNamedCurveP521):
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported PKCS#11 EC curve %s", oid)
+	}
+
+	// CKA_EC_POINT is a DER-encoded octet string holding the uncompressed
+	// point.
+	var raw []byte
+	if _, err := asn1.Unmarshal(point, &raw); err != nil {
+		return nil, fmt.Errorf("unable to parse PKCS#11 EC point: %w", err)
+	}
+	x, y := elliptic.Unmarshal(curve, raw)
+	if x == nil {
+		return nil, errors.New("invalid PKCS#11 EC point")
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// withPKCS11Session runs f within a new, logged in session on the token of
+// the entry.
+func withPKCS11Session(entry *managedKeyEntry, f func(*pkcs11.Ctx, pkcs11.SessionHandle) error) error {
+	library, err := pkcs11LibraryPath(entry.LibraryName)
+	if err != nil {
+		return err
+	}
+	module, err := getPKCS11Module(library)
+	if err != nil {
+		return err
+	}
+
+	slot, err := findPKCS11Slot(module, entry)
+	if err != nil {
+		return err
+	}
+
+	session, err := module.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return fmt.Errorf("unable to open PKCS#11 session: %w", err)
+	}
+	defer module.CloseSession(session)
+
+	if entry.PIN != "" {
+		err := module.Login(session, pkcs11.CKU_USER, entry.PIN)
+		if err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN)) {
+			return fmt.Errorf("unable to log in to PKCS#11 token: %w", err)
+		}
+	}
+
+	return f(module, session)
+}
+
+func getPKCS11Module(library string) (*pkcs11.Ctx, error) {
+	pkcs11ModulesLock.Lock()
+	defer pkcs11ModulesLock.Unlock()
+
+	if module, ok := pkcs11Modules[library]; ok {
+		return module, nil
+	}
+
+	module := pkcs11.New(library)
+	if module == nil {
+		return nil, fmt.Errorf("unable to load PKCS#11 library %q", library)
+	}
+	if err := module.Initialize(); err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED)) {
+		module.Destroy()
+		return nil, fmt.Errorf("unable to initialize PKCS#11 library %q: %w", library, err)
+	}
+
+	pkcs11Modules[library] = module
+	return module, nil
+}
+
+func findPKCS11Slot(module *pkcs11.Ctx, entry *managedKeyEntry) (uint, error) {
+	if entry.Slot != nil {
+		return *entry.Slot, nil
+	}
+
+	slots, err := module.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("unable to list PKCS#11 slots: %w", err)
+	}
+	for _, slot := range slots {
+		info, err := module.GetTokenInfo(slot)
+		if err != nil {
+			return 0, fmt.Errorf("unable to read PKCS#11 token information: %w", err)
+		}
+		if info.Label == entry.TokenLabel {
+			return slot, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no PKCS#11 token with label %q found", entry.TokenLabel)
+}
+
+func findPKCS11Object(module *pkcs11.Ctx, session pkcs11.SessionHandle, entry *managedKeyEntry, class uint) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+	}
+	if entry.KeyLabel != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, entry.KeyLabel))
+	}
+	if entry.ObjectID != "" {
+		id, err := hex.DecodeString(entry.ObjectID)
+		if err != nil {
+			return 0, fmt.Errorf("unable to decode PKCS#11 key_object_id: %w", err)
+		}
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, id))
+	}
+
+	if err := module.FindObjectsInit(session, template); err != nil {
+		return 0, fmt.Errorf("unable to search PKCS#11 objects: %w", err)
+	}
+	defer module.FindObjectsFinal(session)
+
+	handles, _, err := module.FindObjects(session, 2)
+	if err != nil {
+		return 0, fmt.Errorf("unable to search PKCS#11 objects: %w", err)
+	}
+	switch len(handles) {
+	case 0:
+		return 0, errors.New("no matching PKCS#11 key found")
+	case 1:
+		return handles[0], nil
+	default:
+		return 0, errors.New("more than one matching PKCS#11 key found; set both key_label and key_object_id")
+	}
+}
+
+// bytesToUint decodes a CK_ULONG attribute value. Attributes are returned in
+// the native byte order of the platform, which is little-endian on every
+// platform with PKCS#11 support.
+func bytesToUint(value []byte) uint {
+	var ret uint
+	for i := len(value) - 1; i >= 0; i-- {
+		ret = ret<<8 | uint(value[i])
+	}
+	return ret
+}
@@ -0,0 +1,31 @@
+//go:build !cgo
+// +build !cgo
+
+package pki
+
+import (
+	"crypto"
+	"errors"
+	"io"
+)
+
+var errPKCS11Unsupported = errors.New("PKCS#11 managed keys require a build of Vault with cgo enabled")
+
+// pkcs11Signer is unavailable without cgo, as loading PKCS#11 libraries
+// requires it.
+type pkcs11Signer struct {
+	entry     *managedKeyEntry
+	publicKey crypto.PublicKey
+}
+
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+func (s *pkcs11Signer) Sign(_ io.Reader, _ []byte, _ crypto.SignerOpts) ([]byte, error) {
+	return nil, errPKCS11Unsupported
+}
+
+func fetchPKCS11PublicKey(_ *managedKeyEntry) (crypto.PublicKey, error) {
+	return nil, errPKCS11Unsupported
+}
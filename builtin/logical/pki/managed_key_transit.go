@@ -0,0 +1,168 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+)
+
+// transitHashAlgorithms maps hash functions to the names accepted by the
+// hash_algorithm parameter of transit's sign endpoint.
+var transitHashAlgorithms = map[crypto.Hash]string{
+	crypto.SHA224: "sha2-224",
+	crypto.SHA256: "sha2-256",
+	crypto.SHA384: "sha2-384",
+	crypto.SHA512: "sha2-512",
+}
+
+// transitSigner signs with a named key of a transit mount, reached through
+// the Vault API.
+type transitSigner struct {
+	entry     *managedKeyEntry
+	publicKey crypto.PublicKey
+}
+
+func (s *transitSigner) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+func (s *transitSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	data := map[string]interface{}{
+		"input":                base64.StdEncoding.EncodeToString(digest),
+		"key_version":          s.entry.KeyVersion,
+		"marshaling_algorithm": "asn1",
+	}
+
+	// Ed25519 signs the message itself; other key types sign the digest
+	// computed by the caller.
+	if _, ok := s.publicKey.(ed25519.PublicKey); !ok {
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			return nil, errors.New("RSA-PSS signatures are not supported with transit managed keys")
+		}
+		hashAlgorithm, ok := transitHashAlgorithms[opts.HashFunc()]
+		if !ok {
+			return nil, fmt.Errorf("unsupported hash function %v for transit managed keys", opts.HashFunc())
+		}
+		data["prehashed"] = true
+		data["hash_algorithm"] = hashAlgorithm
+		if _, ok := s.publicKey.(*rsa.PublicKey); ok {
+			data["signature_algorithm"] = "pkcs1v15"
+		}
+	}
+
+	client, err := s.entry.transitClient()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := client.Logical().Write(path.Join(s.entry.Mount, "sign", s.entry.TransitKey), data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to sign with transit key %q: %w", s.entry.TransitKey, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("no signature returned by transit key %q", s.entry.TransitKey)
+	}
+
+	signature, _ := secret.Data["signature"].(string)
+	parts := strings.SplitN(signature, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, fmt.Errorf("malformed signature returned by transit key %q", s.entry.TransitKey)
+	}
+
+	return base64.StdEncoding.DecodeString(parts[2])
+}
+
+// fetchTransitPublicKey reads the public key of the transit key. When no
+// version was given, the entry is pinned to the latest version of the key.
+func fetchTransitPublicKey(entry *managedKeyEntry) (crypto.PublicKey, error) {
+	client, err := entry.transitClient()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := client.Logical().Read(path.Join(entry.Mount, "keys", entry.TransitKey))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read transit key %q: %w", entry.TransitKey, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("transit key %q not found", entry.TransitKey)
+	}
+
+	if entry.KeyVersion == 0 {
+		latest, ok := secret.Data["latest_version"].(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("unable to determine the latest version of transit key %q", entry.TransitKey)
+		}
+		version, err := latest.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("unable to determine the latest version of transit key %q: %w", entry.TransitKey, err)
+		}
+		entry.KeyVersion = int(version)
+	}
+
+	keys, _ := secret.Data["keys"].(map[string]interface{})
+	version, _ := keys[strconv.Itoa(entry.KeyVersion)].(map[string]interface{})
+	publicKey, _ := version["public_key"].(string)
+	if publicKey == "" {
+		return nil, fmt.Errorf("transit key %q has no public key for version %d; only asymmetric signing keys may be used", entry.TransitKey, entry.KeyVersion)
+	}
+
+	// Ed25519 public keys are returned as base64 rather than PEM.
+	if !strings.HasPrefix(strings.TrimSpace(publicKey), "-----BEGIN") {
+		raw, err := base64.StdEncoding.DecodeString(publicKey)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unable to parse public key of transit key %q", entry.TransitKey)
+		}
+		return ed25519.PublicKey(raw), nil
+	}
+
+	parsed, err := certutil.ParsePublicKeyPEM([]byte(publicKey))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse public key of transit key %q: %w", entry.TransitKey, err)
+	}
+
+	return parsed, nil
+}
+
+func (m *managedKeyEntry) transitClient() (*api.Client, error) {
+	config := api.DefaultConfig()
+	if config.Error != nil {
+		return nil, config.Error
+	}
+	if m.Address != "" {
+		config.Address = m.Address
+	}
+
+	if m.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(m.CACert)) {
+			return nil, errors.New("unable to parse ca_cert of transit managed key")
+		}
+		transport, ok := config.HttpClient.Transport.(*http.Transport)
+		if !ok || transport.TLSClientConfig == nil {
+			return nil, errors.New("unable to configure TLS for transit managed key")
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create client for transit managed key: %w", err)
+	}
+	client.SetToken(m.Token)
+
+	return client, nil
+}
@@ -0,0 +1,193 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	managedKeyTypePKCS11  = "pkcs11"
+	managedKeyTypeTransit = "transit"
+)
+
+var (
+	pkcs11LibrariesLock sync.RWMutex
+
+	// pkcs11Libraries maps the names of the PKCS#11 libraries of the server
+	// configuration to their paths. Managed keys reference libraries by
+	// name, so that libraries are never loaded from paths given through the
+	// API.
+	pkcs11Libraries map[string]string
+)
+
+// setPKCS11Libraries records the PKCS#11 libraries of the server
+// configuration, as returned by the system view.
+func setPKCS11Libraries(sysView logical.SystemView) {
+	extendedSysView, ok := sysView.(logical.ExtendedSystemView)
+	if !ok {
+		return
+	}
+
+	pkcs11LibrariesLock.Lock()
+	defer pkcs11LibrariesLock.Unlock()
+	pkcs11Libraries = extendedSysView.PKCS11Libraries()
+}
+
+// pkcs11LibraryPath returns the path of the PKCS#11 library configured with
+// the given name.
+func pkcs11LibraryPath(name string) (string, error) {
+	pkcs11LibrariesLock.RLock()
+	defer pkcs11LibrariesLock.RUnlock()
+
+	if library, ok := pkcs11Libraries[name]; ok {
+		return library, nil
+	}
+
+	names := make([]string, 0, len(pkcs11Libraries))
+	for name := range pkcs11Libraries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "", errutil.UserError{Err: fmt.Sprintf("no PKCS#11 library named %q in the server configuration; configured libraries: [%s]", name, strings.Join(names, ", "))}
+}
+
+// managedKeyEntry references a private key held outside of Vault's storage,
+// either in a PKCS#11 token or as a named key of a transit mount. Only the
+// public key is kept in Vault; signatures are produced by the external key
+// store through a crypto.Signer.
+type managedKeyEntry struct {
+	Type string `json:"type"`
+
+	// PKCS#11 keys are located by the name of the library in the server
+	// configuration, the slot (or the label of its token) and the label
+	// and/or hex-encoded CKA_ID of the key objects.
+	LibraryName string `json:"library_name,omitempty"`
+	Slot        *uint  `json:"slot,omitempty"`
+	TokenLabel  string `json:"token_label,omitempty"`
+	PIN         string `json:"pin,omitempty"`
+	KeyLabel    string `json:"key_label,omitempty"`
+	ObjectID    string `json:"object_id,omitempty"`
+
+	// Transit keys are used through the Vault API, pinned to the key
+	// version which was the latest when the key was registered.
+	Address    string `json:"address,omitempty"`
+	Token      string `json:"token,omitempty"`
+	CACert     string `json:"ca_cert,omitempty"`
+	Mount      string `json:"mount,omitempty"`
+	TransitKey string `json:"transit_key,omitempty"`
+	KeyVersion int    `json:"key_version,omitempty"`
+
+	// PublicKey is the PEM-encoded public key, cached when the key is
+	// registered so that matching keys to certificates doesn't require
+	// contacting the external key store.
+	PublicKey string `json:"public_key"`
+}
+
+// validate checks that the fields required by the type of managed key are
+// present.
+func (m *managedKeyEntry) validate() error {
+	switch m.Type {
+	case managedKeyTypePKCS11:
+		if m.LibraryName == "" {
+			return errutil.UserError{Err: "the name of the PKCS#11 library of the server configuration must be provided in kms_library"}
+		}
+		if _, err := pkcs11LibraryPath(m.LibraryName); err != nil {
+			return err
+		}
+		if m.Slot == nil && m.TokenLabel == "" {
+			return errutil.UserError{Err: "either slot or token_label must be provided to locate the PKCS#11 token"}
+		}
+		if m.KeyLabel == "" && m.ObjectID == "" {
+			return errutil.UserError{Err: "either key_label or key_object_id must be provided to locate the PKCS#11 key"}
+		}
+	case managedKeyTypeTransit:
+		if m.Mount == "" || m.TransitKey == "" {
+			return errutil.UserError{Err: "both mount and transit_key must be provided to locate the transit key"}
+		}
+	default:
+		return errutil.UserError{Err: fmt.Sprintf("unknown managed_key_type %q; must be %q or %q", m.Type, managedKeyTypePKCS11, managedKeyTypeTransit)}
+	}
+
+	return nil
+}
+
+// fetchPublicKey retrieves the public key from the external key store and
+// caches it in the entry. It is called when the key is registered.
+func (m *managedKeyEntry) fetchPublicKey() (crypto.PublicKey, error) {
+	var publicKey crypto.PublicKey
+	var err error
+	switch m.Type {
+	case managedKeyTypePKCS11:
+		publicKey, err = fetchPKCS11PublicKey(m)
+	case managedKeyTypeTransit:
+		publicKey, err = fetchTransitPublicKey(m)
+	default:
+		err = fmt.Errorf("unknown managed key type %q", m.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal public key of managed key: %w", err)
+	}
+	m.PublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	return publicKey, nil
+}
+
+// getPublicKey parses the cached public key of the entry.
+func (m *managedKeyEntry) getPublicKey() (crypto.PublicKey, error) {
+	publicKey, err := certutil.ParsePublicKeyPEM([]byte(m.PublicKey))
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to parse cached public key of managed key: %v", err)}
+	}
+
+	return publicKey, nil
+}
+
+// getSigner returns a crypto.Signer producing signatures with the external
+// key.
+func (m *managedKeyEntry) getSigner() (crypto.Signer, error) {
+	publicKey, err := m.getPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	switch m.Type {
+	case managedKeyTypePKCS11:
+		return &pkcs11Signer{entry: m, publicKey: publicKey}, nil
+	case managedKeyTypeTransit:
+		return &transitSigner{entry: m, publicKey: publicKey}, nil
+	default:
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unknown managed key type %q", m.Type)}
+	}
+}
+
+// publicKeyPrivateKeyType returns the type of private key matching the given
+// public key.
+func publicKeyPrivateKeyType(publicKey crypto.PublicKey) (certutil.PrivateKeyType, error) {
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		return certutil.RSAPrivateKey, nil
+	case *ecdsa.PublicKey:
+		return certutil.ECPrivateKey, nil
+	case ed25519.PublicKey:
+		return certutil.Ed25519PrivateKey, nil
+	default:
+		return certutil.UnknownPrivateKey, errutil.UserError{Err: fmt.Sprintf("unsupported public key type %T", publicKey)}
+	}
+}
@@ -0,0 +1,264 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/builtin/logical/transit"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestPki_ExistingKeyGeneration(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	request := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+	}
+
+	resp, err := request("issuers/generate/root/internal", map[string]interface{}{
+		"common_name": "root.example.com",
+		"key_type":    "ec",
+		"key_bits":    384,
+		"key_name":    "shared",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	first := resp.Data["certificate"].(string)
+
+	resp, err = request("issuers/generate/root/existing", map[string]interface{}{
+		"common_name": "root-2.example.com",
+		"key_ref":     "missing",
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error referencing unknown key: err: %v resp: %#v", err, resp)
+	}
+
+	// The key type and size come from the existing key rather than the
+	// (default) key_type and key_bits.
+	resp, err = request("issuers/generate/root/existing", map[string]interface{}{
+		"common_name": "root-2.example.com",
+		"key_ref":     "shared",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data["key_name"] != "shared" || resp.Data["private_key"] != nil {
+		t.Fatalf("unexpected response: %#v", resp.Data)
+	}
+
+	firstCert, err := parseCertificateFromPEM(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondCert, err := parseCertificateFromPEM(resp.Data["certificate"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secondCert.SignatureAlgorithm != x509.ECDSAWithSHA384 {
+		t.Fatalf("expected signature algorithm of the existing key, got %v", secondCert.SignatureAlgorithm)
+	}
+	if err := secondCert.CheckSignatureFrom(secondCert); err != nil {
+		t.Fatal(err)
+	}
+	if equal, err := certutil.ComparePublicKeys(firstCert.PublicKey, secondCert.PublicKey); err != nil || !equal {
+		t.Fatalf("expected both roots to share the same key: %v", err)
+	}
+
+	resp, err = request("intermediate/generate/existing", map[string]interface{}{
+		"common_name": "int.example.com",
+		"key_ref":     "shared",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data["key_name"] != "shared" || resp.Data["csr"] == "" {
+		t.Fatalf("unexpected response: %#v", resp.Data)
+	}
+}
+
+func TestPki_ManagedPKCS11KeyLibrary(t *testing.T) {
+	sysView := logical.TestSystemView()
+	sysView.PKCS11LibrariesVal = map[string]string{"softhsm": "/nonexistent/libsofthsm2.so"}
+	config := logical.TestBackendConfig()
+	config.System = sysView
+	config.StorageView = &logical.InmemStorage{}
+	b := Backend(config)
+	if err := b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	register := func(data map[string]interface{}) *logical.Response {
+		data["key_name"] = "hsm"
+		data["managed_key_type"] = "pkcs11"
+		data["slot"] = 0
+		data["key_label"] = "issuer"
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "keys/managed",
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error: %#v", resp)
+		}
+		return resp
+	}
+
+	// Libraries can't be loaded from a path given through the API
+	resp := register(map[string]interface{}{"library": "/tmp/evil.so"})
+	if !strings.Contains(resp.Error().Error(), "kms_library") {
+		t.Fatalf("expected the library name to be required: %v", resp.Error())
+	}
+	resp = register(map[string]interface{}{"kms_library": "/tmp/evil.so"})
+	if !strings.Contains(resp.Error().Error(), "configured libraries: [softhsm]") {
+		t.Fatalf("expected only configured libraries to be accepted: %v", resp.Error())
+	}
+
+	// Configured libraries are loaded from the path of the configuration
+	resp = register(map[string]interface{}{"kms_library": "softhsm"})
+	if !strings.Contains(resp.Error().Error(), "unable to load managed key") {
+		t.Fatalf("expected loading the configured library to be attempted: %v", resp.Error())
+	}
+}
+
+func TestPki_ManagedTransitKey(t *testing.T) {
+	coreConfig := &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"pki":     Factory,
+			"transit": transit.Factory,
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	client := cluster.Cores[0].Client
+	if err := client.Sys().Mount("pki", &api.MountInput{Type: "pki"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Sys().Mount("transit", &api.MountInput{Type: "transit"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Registering managed keys requires sudo, as the transit token is sent
+	// to the given address
+	if err := client.Sys().PutPolicy("pki-keys", `path "pki/keys/managed" { capabilities = ["update"] }`); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := client.Auth().Token().Create(&api.TokenCreateRequest{Policies: []string{"pki-keys"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonRoot, err := client.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonRoot.SetToken(secret.Auth.ClientToken)
+	_, err = nonRoot.Logical().Write("pki/keys/managed", map[string]interface{}{
+		"key_name":         "attacker",
+		"managed_key_type": "transit",
+		"address":          "https://attacker.example.com",
+		"token":            cluster.RootToken,
+		"mount":            "transit",
+		"transit_key":      "attacker",
+	})
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("expected registering a managed key without sudo to be denied: %v", err)
+	}
+
+	for _, keyType := range []string{"rsa-2048", "ecdsa-p256", "ed25519"} {
+		t.Run(keyType, func(t *testing.T) {
+			if _, err := client.Logical().Write("transit/keys/"+keyType, map[string]interface{}{
+				"type": keyType,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := client.Logical().Write("pki/keys/managed", map[string]interface{}{
+				"key_name":         keyType,
+				"managed_key_type": "transit",
+				"address":          client.Address(),
+				"token":            cluster.RootToken,
+				"ca_cert":          string(cluster.CACertPEM),
+				"mount":            "transit",
+				"transit_key":      keyType,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Data["managed_key_type"] != "transit" {
+				t.Fatalf("unexpected response: %#v", resp.Data)
+			}
+
+			resp, err = client.Logical().Write("pki/issuers/generate/root/existing", map[string]interface{}{
+				"common_name": keyType + ".example.com",
+				"issuer_name": keyType,
+				"key_ref":     keyType,
+				"ttl":         "48h",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			root, err := parseCertificateFromPEM(resp.Data["certificate"].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := root.CheckSignatureFrom(root); err != nil {
+				t.Fatalf("root not signed by the transit key: %v", err)
+			}
+
+			// Leaf certificates and CRLs are signed through transit too.
+			if _, err := client.Logical().Write("pki/roles/"+keyType, map[string]interface{}{
+				"allow_any_name": true,
+				"issuer_ref":     keyType,
+				"key_type":       "ec",
+				"key_bits":       256,
+			}); err != nil {
+				t.Fatal(err)
+			}
+			resp, err = client.Logical().Write("pki/issue/"+keyType, map[string]interface{}{
+				"common_name": "leaf.example.com",
+				"ttl":         "1h",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaf, err := parseCertificateFromPEM(resp.Data["certificate"].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := leaf.CheckSignatureFrom(root); err != nil {
+				t.Fatalf("leaf not signed by the transit key: %v", err)
+			}
+
+			resp, err = client.Logical().Read("pki/issuer/" + keyType + "/crl")
+			if err != nil {
+				t.Fatal(err)
+			}
+			crl, err := x509.ParseCRL([]byte(resp.Data["crl"].(string)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := root.CheckCRLSignature(crl); err != nil {
+				t.Fatalf("CRL not signed by the transit key: %v", err)
+			}
+		})
+	}
+}
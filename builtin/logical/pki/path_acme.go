@@ -0,0 +1,1087 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/strutil"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// acmeContext carries the directory-specific state of an ACME request: the
+// role certificates are issued against and the URL prefix of the directory.
+type acmeContext struct {
+	config     *acmeConfigEntry
+	roleName   string
+	role       *roleEntry
+	pathPrefix string
+	baseURL    string
+}
+
+type acmeOperation func(ctx context.Context, acmeCtx *acmeContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error)
+
+// buildAcmePaths returns the given ACME endpoint under both the acme/
+// directory, backed by the default role, and the per-role
+// roles/:role/acme/ directory.
+func buildAcmePaths(b *backend, suffix string, fields map[string]*framework.FieldSchema, operations map[logical.Operation]acmeOperation, synopsis string) []*framework.Path {
+	var paths []*framework.Path
+	for _, prefix := range []string{"acme/", "roles/" + framework.GenericNameRegex("role") + "/acme/"} {
+		pathFields := map[string]*framework.FieldSchema{}
+		for name, schema := range fields {
+			pathFields[name] = schema
+		}
+		if strings.HasPrefix(prefix, "roles/") {
+			pathFields["role"] = &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `The role to issue certificates against.`,
+			}
+		}
+
+		callbacks := make(map[logical.Operation]framework.OperationFunc, len(operations))
+		for operation, handler := range operations {
+			callbacks[operation] = b.acmeWrapper(handler)
+		}
+
+		paths = append(paths, &framework.Path{
+			Pattern:         prefix + suffix,
+			Fields:          pathFields,
+			Callbacks:       callbacks,
+			HelpSynopsis:    synopsis,
+			HelpDescription: pathAcmeHelpDesc,
+		})
+	}
+
+	return paths
+}
+
+func pathAcme(b *backend) []*framework.Path {
+	var paths []*framework.Path
+
+	paths = append(paths, buildAcmePaths(b, "directory", map[string]*framework.FieldSchema{},
+		map[logical.Operation]acmeOperation{
+			logical.ReadOperation: b.acmeDirectoryHandler,
+		}, "ACME directory.")...)
+
+	paths = append(paths, buildAcmePaths(b, "new-nonce", map[string]*framework.FieldSchema{},
+		map[logical.Operation]acmeOperation{
+			logical.HeaderOperation: b.acmeNewNonceHandler,
+			logical.ReadOperation:   b.acmeNewNonceHandler,
+			logical.UpdateOperation: b.acmeNewNonceHandler,
+		}, "Fetch a fresh ACME anti-replay nonce.")...)
+
+	paths = append(paths, buildAcmePaths(b, "new-account", addAcmeJWSFields(map[string]*framework.FieldSchema{}),
+		map[logical.Operation]acmeOperation{
+			logical.UpdateOperation: b.acmeNewAccountHandler,
+		}, "Create or look up an ACME account.")...)
+
+	accountFields := addAcmeJWSFields(map[string]*framework.FieldSchema{
+		"account_id": {
+			Type:        framework.TypeString,
+			Description: `ACME account identifier.`,
+		},
+	})
+	paths = append(paths, buildAcmePaths(b, "account/(?P<account_id>[\\w-]+)", accountFields,
+		map[logical.Operation]acmeOperation{
+			logical.UpdateOperation: b.acmeAccountHandler,
+		}, "Read, update or deactivate an ACME account.")...)
+	paths = append(paths, buildAcmePaths(b, "account/(?P<account_id>[\\w-]+)/orders", accountFields,
+		map[logical.Operation]acmeOperation{
+			logical.UpdateOperation: b.acmeAccountOrdersHandler,
+		}, "List the orders of an ACME account.")...)
+
+	paths = append(paths, buildAcmePaths(b, "new-order", addAcmeJWSFields(map[string]*framework.FieldSchema{}),
+		map[logical.Operation]acmeOperation{
+			logical.UpdateOperation: b.acmeNewOrderHandler,
+		}, "Create an ACME order.")...)
+
+	orderFields := addAcmeJWSFields(map[string]*framework.FieldSchema{
+		"order_id": {
+			Type:        framework.TypeString,
+			Description: `ACME order identifier.`,
+		},
+	})
+	paths = append(paths, buildAcmePaths(b, "order/(?P<order_id>[\\w-]+)", orderFields,
+		map[logical.Operation]acmeOperation{
+			logical.UpdateOperation: b.acmeOrderHandler,
+		}, "Read an ACME order.")...)
+	paths = append(paths, buildAcmePaths(b, "order/(?P<order_id>[\\w-]+)/finalize", orderFields,
+		map[logical.Operation]acmeOperation{
+			logical.UpdateOperation: b.acmeFinalizeOrderHandler,
+		}, "Finalize an ACME order by submitting a CSR.")...)
+	paths = append(paths, buildAcmePaths(b, "order/(?P<order_id>[\\w-]+)/cert", orderFields,
+		map[logical.Operation]acmeOperation{
+			logical.UpdateOperation: b.acmeOrderCertHandler,
+		}, "Download the certificate of an ACME order.")...)
+
+	authzFields := addAcmeJWSFields(map[string]*framework.FieldSchema{
+		"auth_id": {
+			Type:        framework.TypeString,
+			Description: `ACME authorization identifier.`,
+		},
+		"challenge_type": {
+			Type:        framework.TypeString,
+			Description: `ACME challenge type.`,
+		},
+	})
+	paths = append(paths, buildAcmePaths(b, "authorization/(?P<auth_id>[\\w-]+)", authzFields,
+		map[logical.Operation]acmeOperation{
+			logical.UpdateOperation: b.acmeAuthorizationHandler,
+		}, "Read or deactivate an ACME authorization.")...)
+	paths = append(paths, buildAcmePaths(b, "challenge/(?P<auth_id>[\\w-]+)/(?P<challenge_type>[\\w-]+)", authzFields,
+		map[logical.Operation]acmeOperation{
+			logical.UpdateOperation: b.acmeChallengeHandler,
+		}, "Read or respond to an ACME challenge.")...)
+
+	paths = append(paths, buildAcmePaths(b, "revoke-cert", addAcmeJWSFields(map[string]*framework.FieldSchema{}),
+		map[logical.Operation]acmeOperation{
+			logical.UpdateOperation: b.acmeRevokeCertHandler,
+		}, "Revoke a certificate issued through ACME.")...)
+
+	return paths
+}
+
+// acmeWrapper loads the ACME context of the request and renders errors as
+// ACME problem documents. Every response carries a fresh nonce.
+func (b *backend) acmeWrapper(op acmeOperation) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		acmeCtx, err := b.loadAcmeContext(ctx, req, data)
+
+		var resp *logical.Response
+		if err == nil {
+			resp, err = op(ctx, acmeCtx, req, data)
+		}
+		if errors.Is(err, logical.ErrReadOnly) {
+			// Forward the request to the active node
+			return nil, err
+		}
+		if err != nil {
+			problem, ok := err.(*acmeProblem)
+			if !ok {
+				b.Logger().Error("error handling ACME request", "path", req.Path, "error", err)
+				problem = newAcmeProblem("serverInternal", http.StatusInternalServerError, "internal error handling ACME request")
+			}
+			resp = acmeProblemResponse(problem)
+		}
+
+		nonce, err := b.getAcmeNonce(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		resp.Headers["Replay-Nonce"] = []string{nonce}
+		if acmeCtx != nil {
+			resp.Headers["Link"] = append(resp.Headers["Link"], fmt.Sprintf("<%s/directory>;rel=\"index\"", acmeCtx.baseURL))
+		}
+
+		return resp, nil
+	}
+}
+
+func (b *backend) loadAcmeContext(ctx context.Context, req *logical.Request, data *framework.FieldData) (*acmeContext, error) {
+	config, err := getAcmeConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Enabled {
+		return nil, newAcmeProblem("unauthorized", http.StatusForbidden, "ACME is disabled on this mount")
+	}
+
+	acmeCtx := &acmeContext{
+		config:     config,
+		roleName:   config.DefaultRole,
+		pathPrefix: "acme/",
+	}
+	if roleRaw, ok := data.GetOk("role"); ok {
+		acmeCtx.roleName = roleRaw.(string)
+		acmeCtx.pathPrefix = "roles/" + acmeCtx.roleName + "/acme/"
+	}
+	acmeCtx.baseURL = config.BaseURL + "/" + strings.TrimSuffix(acmeCtx.pathPrefix, "/")
+
+	if acmeCtx.roleName == "" {
+		return nil, newAcmeProblem("unauthorized", http.StatusForbidden, "no default ACME role is configured on this mount")
+	}
+	acmeCtx.role, err = b.getRole(ctx, req.Storage, acmeCtx.roleName)
+	if err != nil {
+		return nil, err
+	}
+	if acmeCtx.role == nil {
+		return nil, acmeNotFound("unknown role: %s", acmeCtx.roleName)
+	}
+
+	return acmeCtx, nil
+}
+
+func acmeResponse(status int, body interface{}) (*logical.Response, error) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/json",
+			logical.HTTPRawBody:     raw,
+			logical.HTTPStatusCode:  status,
+		},
+		Headers: map[string][]string{},
+	}, nil
+}
+
+func acmeProblemResponse(problem *acmeProblem) *logical.Response {
+	raw, _ := json.Marshal(problem)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/problem+json",
+			logical.HTTPRawBody:     raw,
+			logical.HTTPStatusCode:  problem.Status,
+		},
+		Headers: map[string][]string{},
+	}
+}
+
+func (b *backend) acmeDirectoryHandler(ctx context.Context, acmeCtx *acmeContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return acmeResponse(http.StatusOK, map[string]interface{}{
+		"newNonce":   acmeCtx.baseURL + "/new-nonce",
+		"newAccount": acmeCtx.baseURL + "/new-account",
+		"newOrder":   acmeCtx.baseURL + "/new-order",
+		"revokeCert": acmeCtx.baseURL + "/revoke-cert",
+		"meta": map[string]interface{}{
+			"externalAccountRequired": false,
+		},
+	})
+}
+
+func (b *backend) acmeNewNonceHandler(ctx context.Context, acmeCtx *acmeContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode: http.StatusNoContent,
+		},
+		Headers: map[string][]string{},
+	}, nil
+}
+
+func (b *backend) acmeNewAccountHandler(ctx context.Context, acmeCtx *acmeContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	acmeReq, err := b.verifyAcmeJWS(ctx, acmeCtx, req, data, acmeKeyJWK)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		Contact              []string        `json:"contact"`
+		TermsOfServiceAgreed bool            `json:"termsOfServiceAgreed"`
+		OnlyReturnExisting   bool            `json:"onlyReturnExisting"`
+		ExternalAccount      json.RawMessage `json:"externalAccountBinding"`
+	}
+	if err := acmeReq.decodePayload(&payload); err != nil {
+		return nil, err
+	}
+
+	accountID, err := acmeThumbprint(acmeReq.JWK)
+	if err != nil {
+		return nil, err
+	}
+
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	account, err := getAcmeAccount(ctx, req.Storage, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account != nil {
+		resp, err := acmeResponse(http.StatusOK, acmeAccountObject(acmeCtx, account))
+		if err != nil {
+			return nil, err
+		}
+		resp.Headers["Location"] = []string{acmeCtx.baseURL + "/account/" + account.ID}
+		return resp, nil
+	}
+
+	if payload.OnlyReturnExisting {
+		return nil, newAcmeProblem("accountDoesNotExist", http.StatusBadRequest, "no account exists for the given key")
+	}
+	if len(payload.ExternalAccount) > 0 {
+		return nil, acmeMalformed("external account binding is not supported")
+	}
+	if err := validateAcmeContacts(payload.Contact); err != nil {
+		return nil, err
+	}
+
+	jwk, err := acmeReq.JWK.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	account = &acmeAccount{
+		ID:                   accountID,
+		Status:               acmeStatusValid,
+		Contact:              payload.Contact,
+		TermsOfServiceAgreed: payload.TermsOfServiceAgreed,
+		JWK:                  jwk,
+		CreatedAt:            time.Now().UTC(),
+	}
+	if err := putAcmeEntry(ctx, req.Storage, acmeAccountPath(account.ID), account); err != nil {
+		return nil, err
+	}
+
+	resp, err := acmeResponse(http.StatusCreated, acmeAccountObject(acmeCtx, account))
+	if err != nil {
+		return nil, err
+	}
+	resp.Headers["Location"] = []string{acmeCtx.baseURL + "/account/" + account.ID}
+
+	return resp, nil
+}
+
+func validateAcmeContacts(contacts []string) error {
+	for _, contact := range contacts {
+		if !strings.HasPrefix(contact, "mailto:") {
+			return newAcmeProblem("unsupportedContact", http.StatusBadRequest, "unsupported contact %q; only mailto: contacts are supported", contact)
+		}
+	}
+
+	return nil
+}
+
+func acmeAccountObject(acmeCtx *acmeContext, account *acmeAccount) map[string]interface{} {
+	contact := account.Contact
+	if contact == nil {
+		contact = []string{}
+	}
+
+	return map[string]interface{}{
+		"status":               account.Status,
+		"contact":              contact,
+		"termsOfServiceAgreed": account.TermsOfServiceAgreed,
+		"orders":               acmeCtx.baseURL + "/account/" + account.ID + "/orders",
+	}
+}
+
+func (b *backend) acmeAccountHandler(ctx context.Context, acmeCtx *acmeContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	acmeReq, err := b.verifyAcmeJWS(ctx, acmeCtx, req, data, acmeKeyID)
+	if err != nil {
+		return nil, err
+	}
+	if acmeReq.Account.ID != data.Get("account_id").(string) {
+		return nil, acmeUnauthorized("request was not signed by the requested account")
+	}
+
+	account := acmeReq.Account
+	if !acmeReq.IsPostAsGet() {
+		var payload struct {
+			Contact []string `json:"contact"`
+			Status  string   `json:"status"`
+		}
+		if err := acmeReq.decodePayload(&payload); err != nil {
+			return nil, err
+		}
+
+		b.acmeLock.Lock()
+		defer b.acmeLock.Unlock()
+
+		switch payload.Status {
+		case "":
+		case acmeStatusDeactivated:
+			account.Status = acmeStatusDeactivated
+		default:
+			return nil, acmeMalformed("accounts may only be updated to status %q", acmeStatusDeactivated)
+		}
+
+		if payload.Contact != nil {
+			if err := validateAcmeContacts(payload.Contact); err != nil {
+				return nil, err
+			}
+			account.Contact = payload.Contact
+		}
+
+		if err := putAcmeEntry(ctx, req.Storage, acmeAccountPath(account.ID), account); err != nil {
+			return nil, err
+		}
+	}
+
+	return acmeResponse(http.StatusOK, acmeAccountObject(acmeCtx, account))
+}
+
+func (b *backend) acmeAccountOrdersHandler(ctx context.Context, acmeCtx *acmeContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	acmeReq, err := b.verifyAcmeJWS(ctx, acmeCtx, req, data, acmeKeyID)
+	if err != nil {
+		return nil, err
+	}
+	if acmeReq.Account.ID != data.Get("account_id").(string) {
+		return nil, acmeUnauthorized("request was not signed by the requested account")
+	}
+
+	orderIDs, err := req.Storage.List(ctx, acmeAccountPrefix+acmeReq.Account.ID+"/orders/")
+	if err != nil {
+		return nil, err
+	}
+
+	orders := []string{}
+	for _, orderID := range orderIDs {
+		orders = append(orders, acmeCtx.baseURL+"/order/"+orderID)
+	}
+
+	return acmeResponse(http.StatusOK, map[string]interface{}{
+		"orders": orders,
+	})
+}
+
+func (b *backend) acmeNewOrderHandler(ctx context.Context, acmeCtx *acmeContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	acmeReq, err := b.verifyAcmeJWS(ctx, acmeCtx, req, data, acmeKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		Identifiers []acmeIdentifier `json:"identifiers"`
+		NotBefore   string           `json:"notBefore"`
+		NotAfter    string           `json:"notAfter"`
+	}
+	if err := acmeReq.decodePayload(&payload); err != nil {
+		return nil, err
+	}
+	if payload.NotBefore != "" || payload.NotAfter != "" {
+		return nil, acmeMalformed("notBefore and notAfter are not supported; certificate lifetimes are set by the role")
+	}
+
+	identifiers, err := validateAcmeIdentifiers(b, acmeCtx, req, payload.Identifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	orderID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	order := &acmeOrder{
+		ID:          orderID,
+		AccountID:   acmeReq.Account.ID,
+		Role:        acmeCtx.roleName,
+		Status:      acmeStatusPending,
+		Expires:     now.Add(acmeOrderLifetime),
+		Identifiers: identifiers,
+	}
+
+	for _, identifier := range identifiers {
+		authzID, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, err
+		}
+
+		authz := &acmeAuthorization{
+			ID:         authzID,
+			AccountID:  acmeReq.Account.ID,
+			Identifier: identifier,
+			Status:     acmeStatusPending,
+			Expires:    now.Add(acmeAuthorizationLifetime),
+		}
+		if strings.HasPrefix(identifier.Value, "*.") {
+			authz.Wildcard = true
+			authz.Identifier.Value = strings.TrimPrefix(identifier.Value, "*.")
+		}
+
+		for _, challengeType := range acmeChallengeTypes(authz.Identifier, authz.Wildcard) {
+			token, err := acmeRandomToken()
+			if err != nil {
+				return nil, err
+			}
+			authz.Challenges = append(authz.Challenges, &acmeChallenge{
+				Type:   challengeType,
+				Status: acmeStatusPending,
+				Token:  token,
+			})
+		}
+
+		if err := putAcmeEntry(ctx, req.Storage, acmeAuthorizationPath(authz.AccountID, authz.ID), authz); err != nil {
+			return nil, err
+		}
+		order.AuthorizationIDs = append(order.AuthorizationIDs, authzID)
+	}
+
+	if err := putAcmeEntry(ctx, req.Storage, acmeOrderPath(order.AccountID, order.ID), order); err != nil {
+		return nil, err
+	}
+
+	resp, err := acmeResponse(http.StatusCreated, acmeOrderObject(acmeCtx, order))
+	if err != nil {
+		return nil, err
+	}
+	resp.Headers["Location"] = []string{acmeCtx.baseURL + "/order/" + order.ID}
+
+	return resp, nil
+}
+
+// validateAcmeIdentifiers normalizes the requested identifiers and checks
+// them against the role, so that orders which can never be finalized are
+// rejected upfront.
+func validateAcmeIdentifiers(b *backend, acmeCtx *acmeContext, req *logical.Request, requested []acmeIdentifier) ([]acmeIdentifier, error) {
+	if len(requested) == 0 {
+		return nil, acmeMalformed("order must contain at least one identifier")
+	}
+
+	input := &inputBundle{
+		req:  req,
+		role: acmeCtx.role,
+	}
+
+	var identifiers []acmeIdentifier
+	seen := make(map[acmeIdentifier]bool)
+	for _, identifier := range requested {
+		switch identifier.Type {
+		case acmeIdentifierDNS:
+			identifier.Value = strings.ToLower(strings.TrimSuffix(identifier.Value, "."))
+			if identifier.Value == "" || net.ParseIP(identifier.Value) != nil {
+				return nil, newAcmeProblem("rejectedIdentifier", http.StatusBadRequest, "invalid DNS identifier %q", identifier.Value)
+			}
+			if badName := validateNames(b, input, []string{identifier.Value}); badName != "" {
+				return nil, newAcmeProblem("rejectedIdentifier", http.StatusBadRequest, "%s is not allowed by role %s", badName, acmeCtx.roleName)
+			}
+
+		case acmeIdentifierIP:
+			ip := net.ParseIP(identifier.Value)
+			if ip == nil {
+				return nil, newAcmeProblem("rejectedIdentifier", http.StatusBadRequest, "invalid IP identifier %q", identifier.Value)
+			}
+			if !acmeCtx.role.AllowIPSANs {
+				return nil, newAcmeProblem("rejectedIdentifier", http.StatusBadRequest, "IP identifiers are not allowed by role %s", acmeCtx.roleName)
+			}
+			identifier.Value = ip.String()
+
+		default:
+			return nil, newAcmeProblem("unsupportedIdentifier", http.StatusBadRequest, "unsupported identifier type %q", identifier.Type)
+		}
+
+		if !seen[identifier] {
+			seen[identifier] = true
+			identifiers = append(identifiers, identifier)
+		}
+	}
+
+	return identifiers, nil
+}
+
+func acmeRandomToken() (string, error) {
+	raw, err := uuid.GenerateRandomBytes(32)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func acmeOrderObject(acmeCtx *acmeContext, order *acmeOrder) map[string]interface{} {
+	authorizations := []string{}
+	for _, authzID := range order.AuthorizationIDs {
+		authorizations = append(authorizations, acmeCtx.baseURL+"/authorization/"+authzID)
+	}
+
+	result := map[string]interface{}{
+		"status":         order.Status,
+		"expires":        order.Expires.Format(time.RFC3339),
+		"identifiers":    order.Identifiers,
+		"authorizations": authorizations,
+		"finalize":       acmeCtx.baseURL + "/order/" + order.ID + "/finalize",
+	}
+	if order.Status == acmeStatusValid {
+		result["certificate"] = acmeCtx.baseURL + "/order/" + order.ID + "/cert"
+	}
+	if order.Error != nil {
+		result["error"] = order.Error
+	}
+
+	return result
+}
+
+// loadAcmeOrder fetches the order referenced by the request path, ensuring
+// it belongs to the requesting account and was placed in this directory.
+func loadAcmeOrder(ctx context.Context, acmeCtx *acmeContext, req *logical.Request, data *framework.FieldData, account *acmeAccount) (*acmeOrder, error) {
+	orderID := data.Get("order_id").(string)
+	order, err := getAcmeOrder(ctx, req.Storage, account.ID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil || order.Role != acmeCtx.roleName {
+		return nil, acmeNotFound("unknown order %q", orderID)
+	}
+
+	if err := refreshAcmeOrderStatus(ctx, req.Storage, order); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (b *backend) acmeOrderHandler(ctx context.Context, acmeCtx *acmeContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	acmeReq, err := b.verifyAcmeJWS(ctx, acmeCtx, req, data, acmeKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := loadAcmeOrder(ctx, acmeCtx, req, data, acmeReq.Account)
+	if err != nil {
+		return nil, err
+	}
+
+	return acmeResponse(http.StatusOK, acmeOrderObject(acmeCtx, order))
+}
+
+func (b *backend) acmeFinalizeOrderHandler(ctx context.Context, acmeCtx *acmeContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	acmeReq, err := b.verifyAcmeJWS(ctx, acmeCtx, req, data, acmeKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	if err := acmeReq.decodePayload(&payload); err != nil {
+		return nil, err
+	}
+
+	csrBytes, err := base64.RawURLEncoding.DecodeString(payload.CSR)
+	if err != nil {
+		return nil, newAcmeProblem("badCSR", http.StatusBadRequest, "unable to decode CSR: %v", err)
+	}
+	csr, err := x509.ParseCertificateRequest(csrBytes)
+	if err != nil {
+		return nil, newAcmeProblem("badCSR", http.StatusBadRequest, "unable to parse CSR: %v", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, newAcmeProblem("badCSR", http.StatusBadRequest, "invalid CSR signature: %v", err)
+	}
+
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	order, err := loadAcmeOrder(ctx, acmeCtx, req, data, acmeReq.Account)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != acmeStatusReady {
+		return nil, newAcmeProblem("orderNotReady", http.StatusForbidden, "order is %s, not %s", order.Status, acmeStatusReady)
+	}
+
+	commonName, dnsNames, ipSANs, err := matchAcmeCSR(csr, order.Identifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, chain, err := b.issueAcmeCertificate(ctx, acmeCtx, req, csrBytes, commonName, dnsNames, ipSANs)
+	if err != nil {
+		if problem, ok := err.(*acmeProblem); ok {
+			order.Status = acmeStatusInvalid
+			order.Error = problem
+			if err := putAcmeEntry(ctx, req.Storage, acmeOrderPath(order.AccountID, order.ID), order); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	order.Status = acmeStatusValid
+	order.CertificateSerial = serial
+	order.Certificate = chain
+	if err := putAcmeEntry(ctx, req.Storage, acmeOrderPath(order.AccountID, order.ID), order); err != nil {
+		return nil, err
+	}
+	if err := putAcmeEntry(ctx, req.Storage, acmeCertPrefix+normalizeSerial(serial), &acmeCertEntry{
+		AccountID: order.AccountID,
+		OrderID:   order.ID,
+	}); err != nil {
+		return nil, err
+	}
+
+	resp, err := acmeResponse(http.StatusOK, acmeOrderObject(acmeCtx, order))
+	if err != nil {
+		return nil, err
+	}
+	resp.Headers["Location"] = []string{acmeCtx.baseURL + "/order/" + order.ID}
+
+	return resp, nil
+}
+
+// matchAcmeCSR ensures that the CSR requests exactly the identifiers of
+// the order, returning the names to place in the certificate.
+func matchAcmeCSR(csr *x509.CertificateRequest, identifiers []acmeIdentifier) (string, []string, []string, error) {
+	var orderDNS, orderIPs []string
+	for _, identifier := range identifiers {
+		switch identifier.Type {
+		case acmeIdentifierDNS:
+			orderDNS = append(orderDNS, identifier.Value)
+		case acmeIdentifierIP:
+			orderIPs = append(orderIPs, identifier.Value)
+		}
+	}
+
+	var csrDNS, csrIPs []string
+	for _, name := range csr.DNSNames {
+		csrDNS = append(csrDNS, strings.ToLower(name))
+	}
+	for _, ip := range csr.IPAddresses {
+		csrIPs = append(csrIPs, ip.String())
+	}
+
+	commonName := strings.ToLower(csr.Subject.CommonName)
+	if commonName != "" {
+		if ip := net.ParseIP(commonName); ip != nil {
+			csrIPs = append(csrIPs, ip.String())
+		} else {
+			csrDNS = append(csrDNS, commonName)
+		}
+	}
+
+	if !strutil.EquivalentSlices(strutil.RemoveDuplicates(csrDNS, false), strutil.RemoveDuplicates(orderDNS, true)) ||
+		!strutil.EquivalentSlices(strutil.RemoveDuplicates(csrIPs, false), strutil.RemoveDuplicates(orderIPs, false)) {
+		return "", nil, nil, newAcmeProblem("badCSR", http.StatusBadRequest, "CSR names do not match the order identifiers")
+	}
+	if len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0 {
+		return "", nil, nil, newAcmeProblem("badCSR", http.StatusBadRequest, "CSR may only contain DNS names and IP addresses")
+	}
+
+	if commonName == "" && len(orderDNS) > 0 {
+		commonName = orderDNS[0]
+	}
+
+	var altNames []string
+	for _, name := range orderDNS {
+		if name != commonName {
+			altNames = append(altNames, name)
+		}
+	}
+
+	return commonName, altNames, orderIPs, nil
+}
+
+// issueAcmeCertificate signs the CSR of a finalized order against the role
+// of the directory, returning the serial and the PEM certificate chain.
+func (b *backend) issueAcmeCertificate(ctx context.Context, acmeCtx *acmeContext, req *logical.Request, csrBytes []byte, commonName string, dnsNames, ipSANs []string) (string, string, error) {
+	// Names come from the validated order, never from the CSR itself.
+	role := *acmeCtx.role
+	role.UseCSRCommonName = false
+	role.UseCSRSANs = false
+	role.RequireCN = false
+
+	fields := addNonCACommonFields(map[string]*framework.FieldSchema{})
+	fields["csr"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+	}
+	apiData := &framework.FieldData{
+		Schema: fields,
+		Raw: map[string]interface{}{
+			"csr":         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes})),
+			"common_name": commonName,
+			"alt_names":   strings.Join(dnsNames, ","),
+			"ip_sans":     ipSANs,
+		},
+	}
+
+	issuerRef := role.IssuerRef
+	if issuerRef == "" {
+		issuerRef = defaultRef
+	}
+	signingBundle, err := fetchCAInfo(ctx, req, issuerRef)
+	if err != nil {
+		return "", "", err
+	}
+
+	input := &inputBundle{
+		req:     req,
+		apiData: apiData,
+		role:    &role,
+	}
+	parsedBundle, err := signCert(b, input, signingBundle, false, false)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return "", "", newAcmeProblem("badCSR", http.StatusBadRequest, "%v", err)
+		default:
+			return "", "", err
+		}
+	}
+
+	cb, err := parsedBundle.ToCertBundle()
+	if err != nil {
+		return "", "", fmt.Errorf("error converting raw cert bundle to cert bundle: %w", err)
+	}
+
+	if !role.NoStore {
+		err = req.Storage.Put(ctx, &logical.StorageEntry{
+			Key:   "certs/" + normalizeSerial(cb.SerialNumber),
+			Value: parsedBundle.CertificateBytes,
+		})
+		if err != nil {
+			return "", "", fmt.Errorf("unable to store certificate locally: %w", err)
+		}
+
+		issuerID, err := resolveIssuerReference(ctx, req.Storage, issuerRef)
+		if err != nil {
+			return "", "", err
+		}
+		if err := storeCertMetadata(ctx, req, parsedBundle.Certificate, acmeCtx.roleName, issuerID, ""); err != nil {
+			return "", "", fmt.Errorf("unable to store certificate metadata: %w", err)
+		}
+	}
+
+	chain := []string{cb.Certificate}
+	if len(cb.CAChain) > 0 {
+		chain = append(chain, cb.CAChain...)
+	} else {
+		signingCB, err := signingBundle.ToCertBundle()
+		if err != nil {
+			return "", "", fmt.Errorf("error converting raw signing bundle to cert bundle: %w", err)
+		}
+		chain = append(chain, signingCB.Certificate)
+	}
+
+	return cb.SerialNumber, strings.Join(chain, "\n") + "\n", nil
+}
+
+func (b *backend) acmeOrderCertHandler(ctx context.Context, acmeCtx *acmeContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	acmeReq, err := b.verifyAcmeJWS(ctx, acmeCtx, req, data, acmeKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := loadAcmeOrder(ctx, acmeCtx, req, data, acmeReq.Account)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != acmeStatusValid {
+		return nil, newAcmeProblem("orderNotReady", http.StatusForbidden, "order has not been finalized")
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/pem-certificate-chain",
+			logical.HTTPRawBody:     []byte(order.Certificate),
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+		Headers: map[string][]string{},
+	}, nil
+}
+
+func acmeAuthorizationObject(acmeCtx *acmeContext, authz *acmeAuthorization) map[string]interface{} {
+	challenges := []map[string]interface{}{}
+	for _, challenge := range authz.Challenges {
+		challenges = append(challenges, acmeChallengeObject(acmeCtx, authz, challenge))
+	}
+
+	result := map[string]interface{}{
+		"identifier": authz.Identifier,
+		"status":     authz.Status,
+		"expires":    authz.Expires.Format(time.RFC3339),
+		"challenges": challenges,
+	}
+	if authz.Wildcard {
+		result["wildcard"] = true
+	}
+
+	return result
+}
+
+func acmeChallengeObject(acmeCtx *acmeContext, authz *acmeAuthorization, challenge *acmeChallenge) map[string]interface{} {
+	result := map[string]interface{}{
+		"type":   challenge.Type,
+		"url":    acmeCtx.baseURL + "/challenge/" + authz.ID + "/" + challenge.Type,
+		"status": challenge.Status,
+		"token":  challenge.Token,
+	}
+	if !challenge.Validated.IsZero() {
+		result["validated"] = challenge.Validated.Format(time.RFC3339)
+	}
+	if challenge.Error != nil {
+		result["error"] = challenge.Error
+	}
+
+	return result
+}
+
+func loadAcmeAuthorization(ctx context.Context, req *logical.Request, data *framework.FieldData, account *acmeAccount) (*acmeAuthorization, error) {
+	authzID := data.Get("auth_id").(string)
+	authz, err := getAcmeAuthorization(ctx, req.Storage, account.ID, authzID)
+	if err != nil {
+		return nil, err
+	}
+	if authz == nil {
+		return nil, acmeNotFound("unknown authorization %q", authzID)
+	}
+
+	refreshAcmeAuthorizationStatus(authz)
+	return authz, nil
+}
+
+func (b *backend) acmeAuthorizationHandler(ctx context.Context, acmeCtx *acmeContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	acmeReq, err := b.verifyAcmeJWS(ctx, acmeCtx, req, data, acmeKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	authz, err := loadAcmeAuthorization(ctx, req, data, acmeReq.Account)
+	if err != nil {
+		return nil, err
+	}
+
+	if !acmeReq.IsPostAsGet() {
+		var payload struct {
+			Status string `json:"status"`
+		}
+		if err := acmeReq.decodePayload(&payload); err != nil {
+			return nil, err
+		}
+		if payload.Status != acmeStatusDeactivated {
+			return nil, acmeMalformed("authorizations may only be updated to status %q", acmeStatusDeactivated)
+		}
+		if authz.Status != acmeStatusPending && authz.Status != acmeStatusValid {
+			return nil, acmeMalformed("authorization is %s and cannot be deactivated", authz.Status)
+		}
+
+		authz.Status = acmeStatusDeactivated
+		if err := putAcmeEntry(ctx, req.Storage, acmeAuthorizationPath(authz.AccountID, authz.ID), authz); err != nil {
+			return nil, err
+		}
+	}
+
+	return acmeResponse(http.StatusOK, acmeAuthorizationObject(acmeCtx, authz))
+}
+
+func (b *backend) acmeChallengeHandler(ctx context.Context, acmeCtx *acmeContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	acmeReq, err := b.verifyAcmeJWS(ctx, acmeCtx, req, data, acmeKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	authz, err := loadAcmeAuthorization(ctx, req, data, acmeReq.Account)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := findAcmeChallenge(authz, data.Get("challenge_type").(string))
+	if challenge == nil {
+		return nil, acmeNotFound("unknown challenge %q", data.Get("challenge_type").(string))
+	}
+
+	// Any non-empty payload (normally "{}") asks the server to validate
+	// the challenge; POST-as-GET merely fetches it.
+	if !acmeReq.IsPostAsGet() && challenge.Status == acmeStatusPending {
+		if authz.Status != acmeStatusPending {
+			return nil, acmeMalformed("authorization is %s", authz.Status)
+		}
+
+		keyAuth, err := acmeThumbprint(acmeReq.JWK)
+		if err != nil {
+			return nil, err
+		}
+		keyAuth = challenge.Token + "." + keyAuth
+
+		challenge.Status = acmeStatusProcessing
+		if err := putAcmeEntry(ctx, req.Storage, acmeAuthorizationPath(authz.AccountID, authz.ID), authz); err != nil {
+			return nil, err
+		}
+
+		go b.runAcmeValidation(req.Storage, acmeCtx.config, authz.AccountID, authz.ID, challenge.Type, keyAuth)
+	}
+
+	resp, err := acmeResponse(http.StatusOK, acmeChallengeObject(acmeCtx, authz, challenge))
+	if err != nil {
+		return nil, err
+	}
+	resp.Headers["Link"] = []string{fmt.Sprintf("<%s/authorization/%s>;rel=\"up\"", acmeCtx.baseURL, authz.ID)}
+
+	return resp, nil
+}
+
+func (b *backend) acmeRevokeCertHandler(ctx context.Context, acmeCtx *acmeContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	acmeReq, err := b.verifyAcmeJWS(ctx, acmeCtx, req, data, acmeKeyAny)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		Certificate string `json:"certificate"`
+		Reason      int    `json:"reason"`
+	}
+	if err := acmeReq.decodePayload(&payload); err != nil {
+		return nil, err
+	}
+
+	certBytes, err := base64.RawURLEncoding.DecodeString(payload.Certificate)
+	if err != nil {
+		return nil, acmeMalformed("unable to decode certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return nil, acmeMalformed("unable to parse certificate: %v", err)
+	}
+	serial := certutil.GetHexFormatted(cert.SerialNumber.Bytes(), ":")
+
+	// Either the account which ordered the certificate or the holder of the
+	// certificate's private key may revoke it, RFC 8555 Section 7.6.
+	if acmeReq.Account != nil {
+		var certEntry acmeCertEntry
+		found, err := getAcmeEntry(ctx, req.Storage, acmeCertPrefix+normalizeSerial(serial), &certEntry)
+		if err != nil {
+			return nil, err
+		}
+		if !found || certEntry.AccountID != acmeReq.Account.ID {
+			return nil, acmeUnauthorized("account is not authorized to revoke this certificate")
+		}
+	} else {
+		equal, err := certutil.ComparePublicKeys(acmeReq.JWK.Key, cert.PublicKey)
+		if err != nil || !equal {
+			return nil, acmeUnauthorized("request was not signed by the certificate's key")
+		}
+	}
+
+	storedCert, err := fetchCertBySerial(ctx, req, "certs/", serial)
+	if err != nil {
+		return nil, err
+	}
+	if storedCert == nil || string(storedCert.Value) != string(certBytes) {
+		return nil, acmeUnauthorized("certificate was not issued by this mount")
+	}
+
+	b.revokeStorageLock.Lock()
+	defer b.revokeStorageLock.Unlock()
+
+	resp, err := revokeCert(ctx, b, req, serial, false)
+	if err != nil {
+		return nil, err
+	}
+	if resp != nil && resp.IsError() {
+		return nil, acmeMalformed("%v", resp.Error())
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode: http.StatusOK,
+		},
+		Headers: map[string][]string{},
+	}, nil
+}
+
+const pathAcmeHelpDesc = `
+This path is part of the RFC 8555 ACME server of this mount. ACME clients
+authenticate with JWS-signed requests rather than Vault tokens; see
+config/acme to enable the server.
+`
@@ -0,0 +1,279 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	certMetadataPrefix = "cert-metadata/"
+
+	// maxCertMetadataSize bounds the request metadata stored alongside each
+	// certificate.
+	maxCertMetadataSize = 16 * 1024
+)
+
+// certMetadataEntry indexes an issued certificate so that it can be found
+// without fetching and parsing every stored certificate.
+type certMetadataEntry struct {
+	SerialNumber string    `json:"serial_number"`
+	Role         string    `json:"role"`
+	IssuerID     issuerID  `json:"issuer_id"`
+	CommonName   string    `json:"common_name"`
+	SANs         []string  `json:"sans"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	EntityID     string    `json:"entity_id"`
+	Metadata     string    `json:"metadata,omitempty"`
+}
+
+func certificateSANs(cert *x509.Certificate) []string {
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+
+	return sans
+}
+
+func storeCertMetadata(ctx context.Context, req *logical.Request, cert *x509.Certificate, roleName string, id issuerID, metadata string) error {
+	serial := certutil.GetHexFormatted(cert.SerialNumber.Bytes(), ":")
+	entry, err := logical.StorageEntryJSON(certMetadataPrefix+normalizeSerial(serial), &certMetadataEntry{
+		SerialNumber: serial,
+		Role:         roleName,
+		IssuerID:     id,
+		CommonName:   cert.Subject.CommonName,
+		SANs:         certificateSANs(cert),
+		NotBefore:    cert.NotBefore.UTC(),
+		NotAfter:     cert.NotAfter.UTC(),
+		EntityID:     req.EntityID,
+		Metadata:     metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	return req.Storage.Put(ctx, entry)
+}
+
+func fetchCertMetadata(ctx context.Context, s logical.Storage, serial string) (*certMetadataEntry, error) {
+	entry, err := s.Get(ctx, certMetadataPrefix+normalizeSerial(serial))
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("error fetching certificate metadata: %v", err)}
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result certMetadataEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("error decoding certificate metadata for serial %s: %v", serial, err)}
+	}
+
+	return &result, nil
+}
+
+func pathListCertMetadata(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "cert-metadata/?$",
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Description: `Only list certificates issued against this role.`,
+			},
+			issuerRefParam: {
+				Type: framework.TypeString,
+				Description: `Only list certificates issued by this issuer,
+referenced by ID, name or "default".`,
+			},
+			"common_name": {
+				Type:        framework.TypeString,
+				Description: `Only list certificates with this common name.`,
+			},
+			"san": {
+				Type: framework.TypeString,
+				Description: `Only list certificates with this DNS, email,
+IP or URI Subject Alternative Name.`,
+			},
+			"entity_id": {
+				Type:        framework.TypeString,
+				Description: `Only list certificates requested by this entity.`,
+			},
+			"expires_after": {
+				Type: framework.TypeTime,
+				Description: `Only list certificates expiring after this
+time, given as RFC 3339 or seconds since the epoch.`,
+			},
+			"expires_before": {
+				Type: framework.TypeTime,
+				Description: `Only list certificates expiring before this
+time, given as RFC 3339 or seconds since the epoch.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathListCertMetadataHandler,
+		},
+
+		HelpSynopsis:    pathListCertMetadataHelpSyn,
+		HelpDescription: pathListCertMetadataHelpDesc,
+	}
+}
+
+func pathCertMetadata(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `cert-metadata/(?P<serial>[0-9A-Fa-f-:]+)`,
+		Fields: map[string]*framework.FieldSchema{
+			"serial": {
+				Type: framework.TypeString,
+				Description: `Certificate serial number, in colon- or
+hyphen-separated octal`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathReadCertMetadataHandler,
+		},
+
+		HelpSynopsis:    pathCertMetadataHelpSyn,
+		HelpDescription: pathCertMetadataHelpDesc,
+	}
+}
+
+func (b *backend) pathListCertMetadataHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+	commonName := data.Get("common_name").(string)
+	san := data.Get("san").(string)
+	entityID := data.Get("entity_id").(string)
+	expiresAfter := data.Get("expires_after").(time.Time)
+	expiresBefore := data.Get("expires_before").(time.Time)
+
+	var id issuerID
+	if ref := data.Get(issuerRefParam).(string); ref != "" {
+		var err error
+		id, err = resolveIssuerReference(ctx, req.Storage, ref)
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				return logical.ErrorResponse(err.Error()), nil
+			default:
+				return nil, err
+			}
+		}
+	}
+
+	serials, err := req.Storage.List(ctx, certMetadataPrefix)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(serials)
+
+	var keys []string
+	keyInfo := make(map[string]interface{})
+	for _, serial := range serials {
+		entry, err := fetchCertMetadata(ctx, req.Storage, serial)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+
+		switch {
+		case roleName != "" && entry.Role != roleName:
+			continue
+		case id != "" && entry.IssuerID != id:
+			continue
+		case commonName != "" && !strings.EqualFold(entry.CommonName, commonName):
+			continue
+		case san != "" && !containsFold(entry.SANs, san):
+			continue
+		case entityID != "" && entry.EntityID != entityID:
+			continue
+		case !expiresAfter.IsZero() && !entry.NotAfter.After(expiresAfter):
+			continue
+		case !expiresBefore.IsZero() && !entry.NotAfter.Before(expiresBefore):
+			continue
+		}
+
+		keys = append(keys, serial)
+		keyInfo[serial] = map[string]interface{}{
+			"role":        entry.Role,
+			"issuer_id":   entry.IssuerID,
+			"common_name": entry.CommonName,
+			"not_after":   entry.NotAfter.Format(time.RFC3339),
+		}
+	}
+
+	return logical.ListResponseWithInfo(keys, keyInfo), nil
+}
+
+func (b *backend) pathReadCertMetadataHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entry, err := fetchCertMetadata(ctx, req.Storage, data.Get("serial").(string))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"serial_number": entry.SerialNumber,
+			"role":          entry.Role,
+			"issuer_id":     entry.IssuerID,
+			"common_name":   entry.CommonName,
+			"sans":          entry.SANs,
+			"not_before":    entry.NotBefore.Format(time.RFC3339),
+			"not_after":     entry.NotAfter.Format(time.RFC3339),
+			"entity_id":     entry.EntityID,
+			"cert_metadata": entry.Metadata,
+		},
+	}, nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+const pathListCertMetadataHelpSyn = `List issued certificates matching the given filters.`
+
+const pathListCertMetadataHelpDesc = `
+This endpoint lists the serial numbers of stored certificates along with
+their role, issuer, common name and expiration. Results may be filtered by
+role, issuer_ref, common_name, san, entity_id, and by expiration through
+expires_after and expires_before; for instance, certificates of a role
+expiring within the next week are listed with role=<role> and
+expires_before=<now + 7 days>.
+
+Only certificates issued or signed after the index was introduced, and not
+issued with "no_store", are listed.
+`
+
+const pathCertMetadataHelpSyn = `Fetch the indexed metadata of an issued certificate.`
+
+const pathCertMetadataHelpDesc = `
+This endpoint returns the indexed fields of a stored certificate, including
+the identity of the requester and, for roles with "store_metadata" set, the
+"cert_metadata" supplied with the request.
+`
@@ -0,0 +1,111 @@
+package pki
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestPki_CertMetadata(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	write := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+			EntityID:  "entity-1",
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %s: err: %v resp: %#v", path, err, resp)
+		}
+		return resp
+	}
+
+	list := func(data map[string]interface{}) []string {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ListOperation,
+			Path:      "cert-metadata/",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		keys, _ := resp.Data["keys"].([]string)
+		return keys
+	}
+
+	write("root/generate/internal", map[string]interface{}{
+		"common_name": "root.example.com",
+		"ttl":         "720h",
+	})
+	write("roles/web", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"store_metadata":   true,
+		"ttl":              "24h",
+	})
+	write("roles/short", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"ttl":              "1h",
+	})
+
+	// Roles which don't store metadata refuse it
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "issue/short",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"common_name":   "short.example.com",
+			"cert_metadata": "ticket=1234",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error supplying metadata to a role without store_metadata: err: %v resp: %#v", err, resp)
+	}
+
+	web := write("issue/web", map[string]interface{}{
+		"common_name":   "www.example.com",
+		"alt_names":     "api.example.com",
+		"cert_metadata": "ticket=1234",
+	})
+	write("issue/short", map[string]interface{}{
+		"common_name": "short.example.com",
+	})
+	webSerial := normalizeSerial(web.Data["serial_number"].(string))
+
+	if keys := list(nil); len(keys) != 2 {
+		t.Fatalf("expected both certificates to be indexed, got %v", keys)
+	}
+	if keys := list(map[string]interface{}{"role": "web"}); len(keys) != 1 || keys[0] != webSerial {
+		t.Fatalf("expected only the web certificate, got %v", keys)
+	}
+	if keys := list(map[string]interface{}{"san": "API.example.com"}); len(keys) != 1 || keys[0] != webSerial {
+		t.Fatalf("expected SAN search to find the web certificate, got %v", keys)
+	}
+	if keys := list(map[string]interface{}{
+		"expires_before": time.Now().Add(2 * time.Hour).Format(time.RFC3339),
+	}); len(keys) != 1 || keys[0] == webSerial {
+		t.Fatalf("expected only the short-lived certificate, got %v", keys)
+	}
+	if keys := list(map[string]interface{}{"entity_id": "entity-2"}); len(keys) != 0 {
+		t.Fatalf("expected no certificates for another entity, got %v", keys)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "cert-metadata/" + webSerial,
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data["cert_metadata"] != "ticket=1234" || resp.Data["role"] != "web" || resp.Data["entity_id"] != "entity-1" {
+		t.Fatalf("unexpected metadata: %#v", resp.Data)
+	}
+}
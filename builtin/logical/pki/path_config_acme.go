@@ -0,0 +1,157 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const storageAcmeConfig = "config/acme"
+
+type acmeConfigEntry struct {
+	Enabled     bool   `json:"enabled"`
+	BaseURL     string `json:"base_url"`
+	DefaultRole string `json:"default_role"`
+	DNSResolver string `json:"dns_resolver"`
+}
+
+func pathConfigAcme(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/acme",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": {
+				Type:        framework.TypeBool,
+				Description: `Whether the ACME server is enabled on this mount.`,
+				Default:     false,
+			},
+			"base_url": {
+				Type: framework.TypeString,
+				Description: `The externally reachable URL of this mount,
+such as "https://vault.example.com:8200/v1/pki".
+ACME clients are handed absolute URLs derived
+from this value. Required to enable ACME.`,
+			},
+			"default_role": {
+				Type: framework.TypeString,
+				Description: `The role used by the acme/ directory. Roles
+are always reachable through the
+roles/:role/acme/ directory.`,
+			},
+			"dns_resolver": {
+				Type: framework.TypeString,
+				Description: `Optional host:port of the DNS resolver used
+when validating dns-01 challenges. Defaults to
+the system resolver.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathAcmeConfigRead,
+			logical.UpdateOperation: b.pathAcmeConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigAcmeHelpSyn,
+		HelpDescription: pathConfigAcmeHelpDesc,
+	}
+}
+
+func getAcmeConfig(ctx context.Context, s logical.Storage) (*acmeConfigEntry, error) {
+	entry, err := s.Get(ctx, storageAcmeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &acmeConfigEntry{}
+	if entry != nil {
+		if err := entry.DecodeJSON(config); err != nil {
+			return nil, fmt.Errorf("unable to decode ACME configuration: %w", err)
+		}
+	}
+
+	return config, nil
+}
+
+func (b *backend) pathAcmeConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getAcmeConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":      config.Enabled,
+			"base_url":     config.BaseURL,
+			"default_role": config.DefaultRole,
+			"dns_resolver": config.DNSResolver,
+		},
+	}, nil
+}
+
+func (b *backend) pathAcmeConfigWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getAcmeConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+	if baseURLRaw, ok := data.GetOk("base_url"); ok {
+		config.BaseURL = strings.TrimSuffix(baseURLRaw.(string), "/")
+	}
+	if roleRaw, ok := data.GetOk("default_role"); ok {
+		config.DefaultRole = roleRaw.(string)
+	}
+	if resolverRaw, ok := data.GetOk("dns_resolver"); ok {
+		config.DNSResolver = resolverRaw.(string)
+	}
+
+	if config.BaseURL != "" && !govalidator.IsURL(config.BaseURL) {
+		return logical.ErrorResponse(fmt.Sprintf("invalid base_url: %q", config.BaseURL)), nil
+	}
+	if config.Enabled && config.BaseURL == "" {
+		return logical.ErrorResponse("base_url must be set to enable ACME"), nil
+	}
+	if config.DNSResolver != "" {
+		if _, _, err := net.SplitHostPort(config.DNSResolver); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid dns_resolver: %v", err)), nil
+		}
+	}
+	if config.DefaultRole != "" {
+		role, err := b.getRole(ctx, req.Storage, config.DefaultRole)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return logical.ErrorResponse(fmt.Sprintf("unknown role: %s", config.DefaultRole)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(storageAcmeConfig, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+const pathConfigAcmeHelpSyn = `Configure the ACME server of this mount.`
+
+const pathConfigAcmeHelpDesc = `
+This path configures the RFC 8555 ACME server exposed by this mount. Once
+enabled, ACME clients may use the directory at acme/directory (issuing
+against "default_role") or roles/:role/acme/directory (issuing against the
+given role) without a Vault token.
+
+ACME relies on the Replay-Nonce, Location, Link and Retry-After response
+headers; these must be listed in the mount's "allowed_response_headers"
+tuning parameter.
+`
@@ -0,0 +1,172 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const storageAutoTidyConfig = "config/auto-tidy"
+
+func pathConfigAutoTidy(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/auto-tidy",
+		Fields: addTidyFields(map[string]*framework.FieldSchema{
+			"enabled": {
+				Type:        framework.TypeBool,
+				Description: `Set to true to enable automatic tidy operations.`,
+			},
+			"interval_duration": {
+				Type: framework.TypeDurationSecond,
+				Description: `Interval at which to run an auto-tidy operation. This is the time
+between the end of one tidy operation and the start of the next.
+Defaults to 12 hours.`,
+				Default: int(defaultTidyConfig.Interval / time.Second),
+			},
+		}),
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathConfigAutoTidyRead,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                    b.pathConfigAutoTidyWrite,
+				ForwardPerformanceStandby:   true,
+				ForwardPerformanceSecondary: true,
+			},
+		},
+
+		HelpSynopsis:    pathConfigAutoTidySyn,
+		HelpDescription: pathConfigAutoTidyDesc,
+	}
+}
+
+func getAutoTidyConfig(ctx context.Context, s logical.Storage) (*tidyConfig, error) {
+	entry, err := s.Get(ctx, storageAutoTidyConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	config := defaultTidyConfig
+	if entry != nil {
+		if err := entry.DecodeJSON(&config); err != nil {
+			return nil, fmt.Errorf("unable to decode auto-tidy configuration: %w", err)
+		}
+	}
+
+	return &config, nil
+}
+
+func (b *backend) pathConfigAutoTidyRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	config, err := getAutoTidyConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":              config.Enabled,
+			"interval_duration":    int(config.Interval / time.Second),
+			"tidy_cert_store":      config.CertStore,
+			"tidy_revoked_certs":   config.RevokedCerts,
+			"tidy_expired_issuers": config.ExpiredIssuers,
+			"safety_buffer":        int(config.SafetyBuffer / time.Second),
+			"issuer_safety_buffer": int(config.IssuerSafetyBuffer / time.Second),
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigAutoTidyWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := getAutoTidyConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := d.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+	if intervalRaw, ok := d.GetOk("interval_duration"); ok {
+		config.Interval = time.Duration(intervalRaw.(int)) * time.Second
+		if config.Interval < 0 {
+			return logical.ErrorResponse(fmt.Sprintf("given interval_duration must be greater than or equal to zero seconds; got: %v", intervalRaw)), nil
+		}
+	}
+	if certStoreRaw, ok := d.GetOk("tidy_cert_store"); ok {
+		config.CertStore = certStoreRaw.(bool)
+	}
+	if revokedRaw, ok := d.GetOk("tidy_revoked_certs"); ok {
+		config.RevokedCerts = revokedRaw.(bool)
+	}
+	if issuersRaw, ok := d.GetOk("tidy_expired_issuers"); ok {
+		config.ExpiredIssuers = issuersRaw.(bool)
+	}
+	if bufferRaw, ok := d.GetOk("safety_buffer"); ok {
+		config.SafetyBuffer = time.Duration(bufferRaw.(int)) * time.Second
+		if config.SafetyBuffer < 1*time.Second {
+			return logical.ErrorResponse(fmt.Sprintf("given safety_buffer must be greater than zero seconds; got: %v", bufferRaw)), nil
+		}
+	}
+	if bufferRaw, ok := d.GetOk("issuer_safety_buffer"); ok {
+		config.IssuerSafetyBuffer = time.Duration(bufferRaw.(int)) * time.Second
+		if config.IssuerSafetyBuffer < 1*time.Second {
+			return logical.ErrorResponse(fmt.Sprintf("given issuer_safety_buffer must be greater than zero seconds; got: %v", bufferRaw)), nil
+		}
+	}
+
+	if config.Enabled && !config.CertStore && !config.RevokedCerts && !config.ExpiredIssuers {
+		return logical.ErrorResponse("auto-tidy enabled but no tidy operations were requested; enable at least one tidy operation to be run (tidy_cert_store / tidy_revoked_certs / tidy_expired_issuers)"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(storageAutoTidyConfig, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return b.pathConfigAutoTidyRead(ctx, req, d)
+}
+
+// runAutoTidyIfNeeded is called from the periodic function and starts a
+// tidy operation with the auto-tidy configuration once its interval has
+// passed since the last tidy operation finished.
+func (b *backend) runAutoTidyIfNeeded(ctx context.Context, req *logical.Request) error {
+	config, err := getAutoTidyConfig(ctx, req.Storage)
+	if err != nil {
+		return fmt.Errorf("error fetching auto-tidy configuration: %w", err)
+	}
+	if !config.Enabled {
+		return nil
+	}
+
+	b.tidyStatusLock.RLock()
+	nextTidy := b.lastTidy.Add(config.Interval)
+	b.tidyStatusLock.RUnlock()
+	if time.Now().Before(nextTidy) {
+		return nil
+	}
+
+	// A tidy operation may already be running, manual or automatic; the
+	// next check will start one once it has finished.
+	b.startTidyOperation(req, config)
+	return nil
+}
+
+const pathConfigAutoTidySyn = `
+Modifies the current configuration for automatic tidy execution.
+`
+
+const pathConfigAutoTidyDesc = `
+This endpoint accepts parameters to a tidy operation (see /tidy) that
+will be used for automatic tidy execution. This takes two extra parameters,
+enabled (to enable or disable auto-tidy) and interval_duration (which
+controls the frequency of auto-tidy execution).
+
+Once enabled, a tidy operation will be kicked off automatically, as if it
+were executed with the posted configuration. Its progress is reported by
+tidy-status, and it may be stopped with tidy-cancel.
+`
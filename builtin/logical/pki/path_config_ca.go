@@ -68,21 +68,22 @@ func (b *backend) pathCAWrite(ctx context.Context, req *logical.Request, data *f
 		return nil, fmt.Errorf("error converting raw values into cert bundle: %w", err)
 	}
 
-	entry, err := logical.StorageEntryJSON("config/ca_bundle", cb)
-	if err != nil {
-		return nil, err
-	}
-	err = req.Storage.Put(ctx, entry)
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	myIssuer, _, err := writeCaBundle(ctx, req.Storage, cb, "", "")
 	if err != nil {
-		return nil, err
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
 	}
 
-	// For ease of later use, also store just the certificate at a known
-	// location, plus a fresh CRL
-	entry.Key = "ca"
-	entry.Value = parsedBundle.CertificateBytes
-	err = req.Storage.Put(ctx, entry)
-	if err != nil {
+	// This path historically replaced the mount's CA, so the imported CA
+	// becomes the default issuer.
+	if err := setIssuersConfig(ctx, req.Storage, &issuerConfigEntry{DefaultIssuerID: myIssuer.ID}); err != nil {
 		return nil, err
 	}
 
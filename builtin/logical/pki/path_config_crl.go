@@ -10,10 +10,26 @@ import (
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
+// defaultOcspExpiry is how long OCSP responses are valid for when not
+// configured otherwise.
+const defaultOcspExpiry = 12 * time.Hour
+
+const (
+	defaultAutoRebuildGracePeriod = 12 * time.Hour
+	defaultDeltaRebuildInterval   = 15 * time.Minute
+)
+
 // CRLConfig holds basic CRL configuration information
 type crlConfig struct {
-	Expiry  string `json:"expiry" mapstructure:"expiry"`
-	Disable bool   `json:"disable"`
+	Expiry      string `json:"expiry" mapstructure:"expiry"`
+	Disable     bool   `json:"disable"`
+	OcspDisable bool   `json:"ocsp_disable"`
+	OcspExpiry  string `json:"ocsp_expiry"`
+
+	AutoRebuild            bool   `json:"auto_rebuild"`
+	AutoRebuildGracePeriod string `json:"auto_rebuild_grace_period"`
+	EnableDelta            bool   `json:"enable_delta"`
+	DeltaRebuildInterval   string `json:"delta_rebuild_interval"`
 }
 
 func pathConfigCRL(b *backend) *framework.Path {
@@ -30,6 +46,42 @@ valid; defaults to 72 hours`,
 				Type:        framework.TypeBool,
 				Description: `If set to true, disables generating the CRL entirely.`,
 			},
+			"ocsp_disable": {
+				Type:        framework.TypeBool,
+				Description: `If set to true, the OCSP responder refuses all requests.`,
+			},
+			"ocsp_expiry": {
+				Type: framework.TypeString,
+				Description: `The amount of time an OCSP response should be
+considered valid; defaults to 12 hours. Set to "0s" to
+omit the next update time from responses.`,
+				Default: "12h",
+			},
+			"auto_rebuild": {
+				Type: framework.TypeBool,
+				Description: `If set to true, CRLs are rebuilt periodically
+ahead of their expiry, and revocations no longer
+rebuild the CRL synchronously; they are picked up by
+the next delta or complete CRL instead.`,
+			},
+			"auto_rebuild_grace_period": {
+				Type: framework.TypeString,
+				Description: `How long before the CRL expires it is rebuilt
+when auto_rebuild is enabled; defaults to 12 hours.`,
+				Default: "12h",
+			},
+			"enable_delta": {
+				Type: framework.TypeBool,
+				Description: `If set to true, delta CRLs containing the
+certificates revoked since the last complete CRL
+are built. Requires auto_rebuild.`,
+			},
+			"delta_rebuild_interval": {
+				Type: framework.TypeString,
+				Description: `How often delta CRLs are rebuilt when new
+revocations exist; defaults to 15 minutes.`,
+				Default: "15m",
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -70,8 +122,15 @@ func (b *backend) pathCRLRead(ctx context.Context, req *logical.Request, data *f
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"expiry":  config.Expiry,
-			"disable": config.Disable,
+			"expiry":       config.Expiry,
+			"disable":      config.Disable,
+			"ocsp_disable": config.OcspDisable,
+			"ocsp_expiry":  config.OcspExpiry,
+
+			"auto_rebuild":              config.AutoRebuild,
+			"auto_rebuild_grace_period": config.AutoRebuildGracePeriod,
+			"enable_delta":              config.EnableDelta,
+			"delta_rebuild_interval":    config.DeltaRebuildInterval,
 		},
 	}, nil
 }
@@ -94,6 +153,65 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 		config.Expiry = expiry
 	}
 
+	if ocspDisableRaw, ok := d.GetOk("ocsp_disable"); ok {
+		config.OcspDisable = ocspDisableRaw.(bool)
+	}
+
+	if ocspExpiryRaw, ok := d.GetOk("ocsp_expiry"); ok {
+		ocspExpiry := ocspExpiryRaw.(string)
+		duration, err := time.ParseDuration(ocspExpiry)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("given ocsp_expiry could not be decoded: %s", err)), nil
+		}
+		if duration < 0 {
+			return logical.ErrorResponse("ocsp_expiry must not be negative"), nil
+		}
+		config.OcspExpiry = ocspExpiry
+	}
+
+	if autoRebuildRaw, ok := d.GetOk("auto_rebuild"); ok {
+		config.AutoRebuild = autoRebuildRaw.(bool)
+	}
+
+	if gracePeriodRaw, ok := d.GetOk("auto_rebuild_grace_period"); ok {
+		gracePeriod := gracePeriodRaw.(string)
+		if _, err := time.ParseDuration(gracePeriod); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("given auto_rebuild_grace_period could not be decoded: %s", err)), nil
+		}
+		config.AutoRebuildGracePeriod = gracePeriod
+	}
+
+	if enableDeltaRaw, ok := d.GetOk("enable_delta"); ok {
+		config.EnableDelta = enableDeltaRaw.(bool)
+	}
+
+	if intervalRaw, ok := d.GetOk("delta_rebuild_interval"); ok {
+		interval := intervalRaw.(string)
+		duration, err := time.ParseDuration(interval)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("given delta_rebuild_interval could not be decoded: %s", err)), nil
+		}
+		if duration <= 0 {
+			return logical.ErrorResponse("delta_rebuild_interval must be positive"), nil
+		}
+		config.DeltaRebuildInterval = interval
+	}
+
+	if config.EnableDelta && !config.AutoRebuild {
+		return logical.ErrorResponse("enable_delta requires auto_rebuild to be enabled"), nil
+	}
+
+	if config.AutoRebuild {
+		expiry := b.crlLifetime
+		if config.Expiry != "" {
+			expiry, _ = time.ParseDuration(config.Expiry)
+		}
+		gracePeriod, _ := parseDurationOrDefault(config.AutoRebuildGracePeriod, defaultAutoRebuildGracePeriod)
+		if gracePeriod >= expiry {
+			return logical.ErrorResponse(fmt.Sprintf("auto_rebuild_grace_period (%s) must be less than the CRL expiry (%s)", gracePeriod, expiry)), nil
+		}
+	}
+
 	var oldDisable bool
 	if disableRaw, ok := d.GetOk("disable"); ok {
 		oldDisable = config.Disable
@@ -124,9 +242,19 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 }
 
 const pathConfigCRLHelpSyn = `
-Configure the CRL expiration.
+Configure the CRL and OCSP expiration.
 `
 
 const pathConfigCRLHelpDesc = `
-This endpoint allows configuration of the CRL lifetime.
+This endpoint allows configuration of the CRL lifetime and of the OCSP
+responder.
+
+By default, every revocation rebuilds the complete CRL of every issuer. With
+"auto_rebuild", CRLs are instead rebuilt periodically before they expire, and
+revocations only become visible on the CRL at the next rebuild. Enabling
+"enable_delta" additionally builds delta CRLs (served at crl/delta and
+issuer/:issuer_ref/crl/delta) every "delta_rebuild_interval", listing the
+certificates revoked since the last complete CRL. Set
+"delta_crl_distribution_points" in config/urls to advertise them through the
+Freshest CRL extension of complete CRLs.
 `
@@ -0,0 +1,187 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const storageEstConfig = "config/est"
+
+type estConfigEntry struct {
+	Enabled              bool              `json:"enabled"`
+	DefaultRole          string            `json:"default_role"`
+	LabelToRole          map[string]string `json:"label_to_role"`
+	UserpassAuthAccessor string            `json:"userpass_auth_accessor"`
+	CertAuthAccessor     string            `json:"cert_auth_accessor"`
+	CertAuthRole         string            `json:"cert_auth_role"`
+}
+
+func pathConfigEst(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/est",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": {
+				Type:        framework.TypeBool,
+				Description: `Whether the EST server is enabled on this mount.`,
+				Default:     false,
+			},
+			"default_role": {
+				Type: framework.TypeString,
+				Description: `The role used by the est/ directory when no
+label is given.`,
+			},
+			"label_to_role": {
+				Type: framework.TypeKVPairs,
+				Description: `A map of EST labels to roles. Each label is
+served under est/:label/.`,
+			},
+			"userpass_auth_accessor": {
+				Type: framework.TypeString,
+				Description: `Accessor of the userpass auth mount EST clients
+log in against using HTTP Basic authentication.`,
+			},
+			"cert_auth_accessor": {
+				Type: framework.TypeString,
+				Description: `Accessor of the cert auth mount EST clients log
+in against using their TLS client certificate.`,
+			},
+			"cert_auth_role": {
+				Type: framework.TypeString,
+				Description: `The role of the cert auth mount to log in
+against. If unset, all the roles of the mount are
+tried.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathEstConfigRead,
+			logical.UpdateOperation: b.pathEstConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigEstHelpSyn,
+		HelpDescription: pathConfigEstHelpDesc,
+	}
+}
+
+func getEstConfig(ctx context.Context, s logical.Storage) (*estConfigEntry, error) {
+	entry, err := s.Get(ctx, storageEstConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &estConfigEntry{}
+	if entry != nil {
+		if err := entry.DecodeJSON(config); err != nil {
+			return nil, fmt.Errorf("unable to decode EST configuration: %w", err)
+		}
+	}
+
+	return config, nil
+}
+
+func (b *backend) pathEstConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getEstConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":                config.Enabled,
+			"default_role":           config.DefaultRole,
+			"label_to_role":          config.LabelToRole,
+			"userpass_auth_accessor": config.UserpassAuthAccessor,
+			"cert_auth_accessor":     config.CertAuthAccessor,
+			"cert_auth_role":         config.CertAuthRole,
+		},
+	}, nil
+}
+
+func (b *backend) pathEstConfigWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getEstConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+	if roleRaw, ok := data.GetOk("default_role"); ok {
+		config.DefaultRole = roleRaw.(string)
+	}
+	if labelsRaw, ok := data.GetOk("label_to_role"); ok {
+		config.LabelToRole = labelsRaw.(map[string]string)
+	}
+	if accessorRaw, ok := data.GetOk("userpass_auth_accessor"); ok {
+		config.UserpassAuthAccessor = accessorRaw.(string)
+	}
+	if accessorRaw, ok := data.GetOk("cert_auth_accessor"); ok {
+		config.CertAuthAccessor = accessorRaw.(string)
+	}
+	if roleRaw, ok := data.GetOk("cert_auth_role"); ok {
+		config.CertAuthRole = roleRaw.(string)
+	}
+
+	if config.CertAuthRole != "" && config.CertAuthAccessor == "" {
+		return logical.ErrorResponse("cert_auth_role requires cert_auth_accessor"), nil
+	}
+
+	if config.Enabled && config.DefaultRole == "" && len(config.LabelToRole) == 0 {
+		return logical.ErrorResponse("default_role or label_to_role must be set to enable EST"), nil
+	}
+
+	roles := make([]string, 0, len(config.LabelToRole)+1)
+	if config.DefaultRole != "" {
+		roles = append(roles, config.DefaultRole)
+	}
+	for label, roleName := range config.LabelToRole {
+		if !estLabelRegex.MatchString(label) || isEstOperation(label) {
+			return logical.ErrorResponse(fmt.Sprintf("invalid EST label: %q", label)), nil
+		}
+		roles = append(roles, roleName)
+	}
+	for _, roleName := range roles {
+		role, err := b.getRole(ctx, req.Storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return logical.ErrorResponse(fmt.Sprintf("unknown role: %s", roleName)), nil
+		}
+		if role.NoStore {
+			return logical.ErrorResponse(fmt.Sprintf("role %s has no_store set; EST re-enrollment requires stored certificates", roleName)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(storageEstConfig, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+const pathConfigEstHelpSyn = `Configure the EST server of this mount.`
+
+const pathConfigEstHelpDesc = `
+This path configures the RFC 7030 EST server exposed by this mount. Once
+enabled, EST clients may use est/cacerts, est/csrattrs, est/simpleenroll and
+est/simplereenroll, issuing against "default_role", or the same operations
+under est/:label/ to issue against the role mapped to the label.
+
+EST clients don't use Vault tokens; instead, this mount logs them in on
+their behalf against the configured auth mounts. Clients using HTTP Basic
+authentication log in against the userpass mount of "userpass_auth_accessor",
+and clients presenting a TLS client certificate against the cert mount of
+"cert_auth_accessor". The resulting token must be allowed to update the EST
+path being requested, and is revoked once the client has been authorized;
+issued certificates are attributed to the entity of the client. This applies
+to re-enrollment as well, which in addition requires the certificate being
+renewed to be presented as the TLS client certificate.
+`
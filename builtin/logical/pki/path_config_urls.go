@@ -27,10 +27,19 @@ for the issuing certificate attribute`,
 for the CRL distribution points attribute`,
 			},
 
+			"delta_crl_distribution_points": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of URLs of the delta CRL,
+advertised in the Freshest CRL extension of complete
+CRLs when delta CRLs are enabled in config/crl`,
+			},
+
 			"ocsp_servers": {
 				Type: framework.TypeCommaStringSlice,
 				Description: `Comma-separated list of URLs to be used
-for the OCSP servers attribute`,
+for the OCSP servers attribute. To use this mount's
+responder, set this to the externally reachable URL
+of its ocsp endpoint.`,
 			},
 		},
 
@@ -111,9 +120,10 @@ func (b *backend) pathWriteURL(ctx context.Context, req *logical.Request, data *
 	}
 	if entries == nil {
 		entries = &certutil.URLEntries{
-			IssuingCertificates:   []string{},
-			CRLDistributionPoints: []string{},
-			OCSPServers:           []string{},
+			IssuingCertificates:        []string{},
+			CRLDistributionPoints:      []string{},
+			OCSPServers:                []string{},
+			DeltaCRLDistributionPoints: []string{},
 		}
 	}
 
@@ -131,6 +141,13 @@ func (b *backend) pathWriteURL(ctx context.Context, req *logical.Request, data *
 				"invalid URL found in CRL distribution points: %s", badURL)), nil
 		}
 	}
+	if urlsInt, ok := data.GetOk("delta_crl_distribution_points"); ok {
+		entries.DeltaCRLDistributionPoints = urlsInt.([]string)
+		if badURL := validateURLs(entries.DeltaCRLDistributionPoints); badURL != "" {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"invalid URL found in delta CRL distribution points: %s", badURL)), nil
+		}
+	}
 	if urlsInt, ok := data.GetOk("ocsp_servers"); ok {
 		entries.OCSPServers = urlsInt.([]string)
 		if badURL := validateURLs(entries.OCSPServers); badURL != "" {
@@ -154,4 +171,8 @@ certificates. To delete URLs, simply re-set the appropriate value with an
 empty string.
 
 Multiple URLs can be specified for each type; use commas to separate them.
+
+The OCSP servers are encoded into the Authority Information Access extension
+of issued certificates. This mount serves an OCSP responder at
+<mount>/ocsp, e.g. "https://vault.example.com:8200/v1/pki/ocsp".
 `
@@ -0,0 +1,181 @@
+package pki
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathIssuerCrossSign(b *backend) *framework.Path {
+	pattern := "issuer/" + framework.GenericNameRegex(issuerRefParam) + "/cross-sign"
+
+	fields := addIssuerRefField(map[string]*framework.FieldSchema{})
+	fields = addIssuerNameField(fields)
+	fields["subject_issuer_ref"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Reference to the existing issuer, by ID or name,
+whose subject and key are to be cross-signed.`,
+		Required: true,
+	}
+	fields["ttl"] = &framework.FieldSchema{
+		Type: framework.TypeDurationSecond,
+		Description: `The requested Time To Live for the cross-signed
+certificate. Defaults to the expiration of the
+cross-signed issuer's certificate. May not extend
+past the expiration of the signing issuer.`,
+	}
+
+	return &framework.Path{
+		Pattern: pattern,
+		Fields:  fields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathIssuerCrossSignHandler,
+		},
+
+		HelpSynopsis:    pathIssuerCrossSignHelpSyn,
+		HelpDescription: pathIssuerCrossSignHelpDesc,
+	}
+}
+
+func (b *backend) pathIssuerCrossSignHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuerName := data.Get("issuer_name").(string)
+	if err := validateName(issuerName); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	subjectRef := data.Get("subject_issuer_ref").(string)
+	if subjectRef == "" {
+		return logical.ErrorResponse("missing subject_issuer_ref"), nil
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	signingBundle, err := fetchCAInfo(ctx, req, getIssuerRef(data))
+	if err != nil {
+		return handleImportError(err)
+	}
+
+	subjectID, err := resolveIssuerReference(ctx, req.Storage, subjectRef)
+	if err != nil {
+		return handleImportError(err)
+	}
+	subjectIssuer, err := fetchIssuerByID(ctx, req.Storage, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	subjectCert, err := subjectIssuer.GetCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	sameKey, err := samePublicKey(signingBundle.Certificate.PublicKey, subjectCert.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if sameKey {
+		return logical.ErrorResponse("the signing issuer and the subject issuer share a key; an issuer cannot cross-sign its own key"), nil
+	}
+
+	notAfter := subjectCert.NotAfter
+	if ttl := data.Get("ttl").(int); ttl > 0 {
+		notAfter = time.Now().Add(time.Duration(ttl) * time.Second)
+	}
+	if notAfter.After(signingBundle.Certificate.NotAfter) {
+		return logical.ErrorResponse(fmt.Sprintf("cannot satisfy request, as the cross-signed certificate would expire (%s) after the signing issuer (%s); set a shorter ttl", notAfter.Format(time.RFC3339), signingBundle.Certificate.NotAfter.Format(time.RFC3339))), nil
+	}
+
+	serialNumber, err := certutil.GenerateSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	// The cross-signed certificate carries the subject and key identifier of
+	// the existing issuer, so that certificates it issued chain through
+	// either.
+	template := &x509.Certificate{
+		SerialNumber:                serialNumber,
+		Subject:                     subjectCert.Subject,
+		RawSubject:                  subjectCert.RawSubject,
+		SubjectKeyId:                subjectCert.SubjectKeyId,
+		NotBefore:                   time.Now().Add(-30 * time.Second),
+		NotAfter:                    notAfter,
+		KeyUsage:                    subjectCert.KeyUsage,
+		ExtKeyUsage:                 subjectCert.ExtKeyUsage,
+		BasicConstraintsValid:       true,
+		IsCA:                        true,
+		MaxPathLen:                  subjectCert.MaxPathLen,
+		MaxPathLenZero:              subjectCert.MaxPathLenZero,
+		PermittedDNSDomainsCritical: subjectCert.PermittedDNSDomainsCritical,
+		PermittedDNSDomains:         subjectCert.PermittedDNSDomains,
+		ExcludedDNSDomains:          subjectCert.ExcludedDNSDomains,
+	}
+	if signingBundle.URLs != nil {
+		template.IssuingCertificateURL = signingBundle.URLs.IssuingCertificates
+		template.CRLDistributionPoints = signingBundle.URLs.CRLDistributionPoints
+		template.OCSPServer = signingBundle.URLs.OCSPServers
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, signingBundle.Certificate, subjectCert.PublicKey, signingBundle.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("error cross-signing issuer: %w", err)
+	}
+
+	err = req.Storage.Put(ctx, &logical.StorageEntry{
+		Key:   "certs/" + normalizeSerial(certutil.GetHexFormatted(serialNumber.Bytes(), ":")),
+		Value: certBytes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to store certificate locally: %w", err)
+	}
+
+	issuer, _, err := importIssuer(ctx, req.Storage, certToPEM(certBytes), issuerName)
+	if err != nil {
+		return handleImportError(err)
+	}
+
+	if err := rebuildIssuersChains(ctx, req.Storage); err != nil {
+		return nil, err
+	}
+	issuer, err = fetchIssuerByID(ctx, req.Storage, issuer.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := buildCRL(ctx, b, req, true); err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: respondReadIssuer(issuer),
+	}
+	resp.Data["expiration"] = notAfter.Unix()
+
+	if len(issuer.KeyID) == 0 {
+		resp.AddWarning("The key of the cross-signed issuer is not present in this mount; the new issuer cannot be used for signing.")
+	}
+
+	return resp, nil
+}
+
+const pathIssuerCrossSignHelpSyn = `Cross-sign an existing issuer with this issuer.`
+
+const pathIssuerCrossSignHelpDesc = `
+This path issues a new certificate for the subject and public key of the
+issuer referenced by "subject_issuer_ref", signed by the issuer in the
+path. The resulting certificate is imported as a new issuer sharing the
+subject issuer's key.
+
+This is useful when rotating roots: cross-signing the new root (or an
+intermediate under it) with the old root lets clients which only trust the
+old root validate certificates issued under the new one. The CA chains of
+all issuers in the mount are recomputed to include every path to a root;
+use issuer/:issuer_ref/chains to fetch each path separately.
+`
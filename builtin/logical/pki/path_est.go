@@ -0,0 +1,545 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/credential/aws/pkcs7"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	estCertsOnlyContentType = "application/pkcs7-mime; smime-type=certs-only"
+	estCsrAttrsContentType  = "application/csrattrs"
+	maxEstRequestSize       = 64 * 1024
+)
+
+var (
+	estLabelRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_\-]*$`)
+
+	estOperations = []string{"cacerts", "csrattrs", "simpleenroll", "simplereenroll"}
+
+	oidPublicKeyRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidPublicKeyECDSA   = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidPublicKeyEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+func isEstOperation(name string) bool {
+	for _, op := range estOperations {
+		if name == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+// estContext carries the role an EST request issues against, as selected
+// by the label of the request.
+type estContext struct {
+	config   *estConfigEntry
+	roleName string
+	role     *roleEntry
+}
+
+type estOperation func(ctx context.Context, estCtx *estContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error)
+
+// buildEstPaths returns the given EST operation under both the est/
+// directory, backed by the default role, and the labeled est/:label/
+// directories.
+func buildEstPaths(b *backend, op string, operation logical.Operation, handler estOperation, synopsis string) []*framework.Path {
+	var paths []*framework.Path
+	for _, prefix := range []string{"est/", "est/" + framework.GenericNameRegex("label") + "/"} {
+		fields := map[string]*framework.FieldSchema{}
+		if prefix != "est/" {
+			fields["label"] = &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `The EST label selecting the role to issue against.`,
+			}
+		}
+
+		paths = append(paths, &framework.Path{
+			Pattern: prefix + op,
+			Fields:  fields,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				operation: b.estWrapper(handler),
+			},
+			HelpSynopsis:    synopsis,
+			HelpDescription: pathEstHelpDesc,
+		})
+	}
+
+	return paths
+}
+
+func pathEst(b *backend) []*framework.Path {
+	var paths []*framework.Path
+
+	paths = append(paths, buildEstPaths(b, "cacerts", logical.ReadOperation, b.estCACertsHandler,
+		"Fetch the CA certificates of an EST directory.")...)
+	paths = append(paths, buildEstPaths(b, "csrattrs", logical.ReadOperation, b.estCsrAttrsHandler,
+		"Fetch the CSR attributes of an EST directory.")...)
+	paths = append(paths, buildEstPaths(b, "simpleenroll", logical.UpdateOperation, b.estSimpleEnrollHandler,
+		"Enroll a new certificate through EST.")...)
+	paths = append(paths, buildEstPaths(b, "simplereenroll", logical.UpdateOperation, b.estSimpleReenrollHandler,
+		"Renew a certificate through EST.")...)
+
+	return paths
+}
+
+// estWrapper loads the EST context of the request and renders errors as
+// plain text responses, as expected by EST clients.
+func (b *backend) estWrapper(op estOperation) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		estCtx, err := b.loadEstContext(ctx, req, data)
+		if err != nil {
+			return estErrorResponse(err)
+		}
+
+		resp, err := op(ctx, estCtx, req, data)
+		if err != nil {
+			return estErrorResponse(err)
+		}
+
+		return resp, nil
+	}
+}
+
+func estErrorResponse(err error) (*logical.Response, error) {
+	var status int
+	switch err.(type) {
+	case errutil.UserError:
+		status = http.StatusBadRequest
+	case estNotFoundError:
+		status = http.StatusNotFound
+	case estUnauthorizedError:
+		status = http.StatusUnauthorized
+	default:
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "text/plain",
+			logical.HTTPRawBody:     []byte(err.Error() + "\n"),
+			logical.HTTPStatusCode:  status,
+		},
+	}
+	if status == http.StatusUnauthorized {
+		resp.Data[logical.HTTPWWWAuthenticateHeader] = `Basic realm="est"`
+	}
+
+	return resp, nil
+}
+
+type estNotFoundError string
+
+func (e estNotFoundError) Error() string {
+	return string(e)
+}
+
+type estUnauthorizedError string
+
+func (e estUnauthorizedError) Error() string {
+	return string(e)
+}
+
+func (b *backend) loadEstContext(ctx context.Context, req *logical.Request, data *framework.FieldData) (*estContext, error) {
+	config, err := getEstConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Enabled {
+		return nil, estNotFoundError("EST is disabled on this mount")
+	}
+
+	estCtx := &estContext{
+		config:   config,
+		roleName: config.DefaultRole,
+	}
+	if labelRaw, ok := data.GetOk("label"); ok {
+		roleName, ok := config.LabelToRole[labelRaw.(string)]
+		if !ok {
+			return nil, estNotFoundError(fmt.Sprintf("unknown EST label: %s", labelRaw.(string)))
+		}
+		estCtx.roleName = roleName
+	}
+	if estCtx.roleName == "" {
+		return nil, estNotFoundError("no default EST role is configured")
+	}
+
+	role, err := b.getRole(ctx, req.Storage, estCtx.roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("EST role %s no longer exists", estCtx.roleName)
+	}
+	estCtx.role = role
+
+	return estCtx, nil
+}
+
+func (b *backend) estCACertsHandler(ctx context.Context, estCtx *estContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	id, err := resolveIssuerReference(ctx, req.Storage, estIssuerRef(estCtx.role))
+	if err != nil {
+		return nil, asTypedError(err, "unable to resolve issuer reference")
+	}
+
+	_, bundle, err := fetchCertBundleByIssuerID(ctx, req.Storage, id, false)
+	if err != nil {
+		return nil, asTypedError(err, "unable to fetch CA certificate")
+	}
+
+	parsedBundle, err := bundle.ToParsedCertBundle()
+	if err != nil {
+		return nil, errutil.InternalError{Err: err.Error()}
+	}
+
+	// Unlike the ca_chain endpoint, EST clients are given the issuing CA
+	// even when it is a self-signed root (RFC 7030, section 4.1.3).
+	certs := append([]byte{}, parsedBundle.CertificateBytes...)
+	for _, block := range parsedBundle.CAChain {
+		if !bytes.Equal(block.Bytes, parsedBundle.CertificateBytes) {
+			certs = append(certs, block.Bytes...)
+		}
+	}
+
+	return estCertsOnlyResponse(certs)
+}
+
+func (b *backend) estCsrAttrsHandler(ctx context.Context, estCtx *estContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	var keyOID asn1.ObjectIdentifier
+	switch estCtx.role.KeyType {
+	case "rsa":
+		keyOID = oidPublicKeyRSA
+	case "ec":
+		keyOID = oidPublicKeyECDSA
+	case "ed25519":
+		keyOID = oidPublicKeyEd25519
+	default:
+		// Nothing is required of the CSR.
+		return &logical.Response{
+			Data: map[string]interface{}{
+				logical.HTTPStatusCode: http.StatusNoContent,
+				logical.HTTPRawBody:    []byte{},
+			},
+		}, nil
+	}
+
+	attrs, err := asn1.Marshal([]asn1.ObjectIdentifier{keyOID})
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: estCsrAttrsContentType,
+			logical.HTTPRawBody:     []byte(base64.StdEncoding.EncodeToString(attrs)),
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+	}, nil
+}
+
+func (b *backend) estSimpleEnrollHandler(ctx context.Context, estCtx *estContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Forward to the primary before the request body is consumed
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby | consts.ReplicationPerformanceSecondary) {
+		return nil, logical.ErrReadOnly
+	}
+
+	if err := b.authenticateEstClient(ctx, estCtx.config, req); err != nil {
+		return nil, err
+	}
+
+	csr, err := readEstCsr(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.issueEstCertificate(ctx, estCtx, req, csr)
+}
+
+// estSimpleReenrollHandler renews the certificate presented as the TLS
+// client certificate. As required by RFC 7030 Section 4.2.2, the subject
+// and subject alternative names of the request must match the certificate
+// being renewed.
+func (b *backend) estSimpleReenrollHandler(ctx context.Context, estCtx *estContext, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Forward to the primary before the request body is consumed
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby | consts.ReplicationPerformanceSecondary) {
+		return nil, logical.ErrReadOnly
+	}
+
+	if err := b.authenticateEstClient(ctx, estCtx.config, req); err != nil {
+		return nil, err
+	}
+
+	csr, err := readEstCsr(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Connection == nil || req.Connection.ConnState == nil || len(req.Connection.ConnState.PeerCertificates) == 0 {
+		return nil, errutil.UserError{Err: "re-enrollment requires the certificate being renewed to be presented as the TLS client certificate"}
+	}
+	current := req.Connection.ConnState.PeerCertificates[0]
+	if time.Now().After(current.NotAfter) {
+		return nil, errutil.UserError{Err: "the presented certificate has expired"}
+	}
+
+	serial := certutil.GetHexFormatted(current.SerialNumber.Bytes(), ":")
+	certEntry, err := fetchCertBySerial(ctx, req, "certs/", serial)
+	if err != nil {
+		return nil, err
+	}
+	if certEntry == nil || !bytes.Equal(certEntry.Value, current.Raw) {
+		return nil, errutil.UserError{Err: "the presented certificate was not issued by this mount"}
+	}
+	revokedEntry, err := fetchCertBySerial(ctx, req, "revoked/", serial)
+	if err != nil {
+		return nil, err
+	}
+	if revokedEntry != nil {
+		return nil, errutil.UserError{Err: "the presented certificate has been revoked"}
+	}
+
+	if !bytes.Equal(csr.RawSubject, current.RawSubject) {
+		return nil, errutil.UserError{Err: "the subject of the request does not match the certificate being renewed"}
+	}
+	if !equalStringSets(certificateSANs(current), csrSANs(csr)) {
+		return nil, errutil.UserError{Err: "the subject alternative names of the request do not match the certificate being renewed"}
+	}
+
+	return b.issueEstCertificate(ctx, estCtx, req, csr)
+}
+
+// authenticateEstClient logs an EST client in against the auth mounts of
+// the EST configuration (RFC 7030, section 3.2.3): through userpass with its
+// HTTP Basic credentials, or through cert auth with its TLS client
+// certificate. The policies of the client must allow the request, which is
+// then attributed to the entity of the client.
+func (b *backend) authenticateEstClient(ctx context.Context, config *estConfigEntry, req *logical.Request) error {
+	var accessor string
+	var login *logical.Request
+	if req.HTTPRequest != nil {
+		if username, password, ok := req.HTTPRequest.BasicAuth(); ok {
+			if config.UserpassAuthAccessor == "" {
+				return estUnauthorizedError("HTTP Basic authentication is not enabled")
+			}
+			if username == "" || strings.Contains(username, "/") {
+				return estUnauthorizedError("invalid credentials")
+			}
+			accessor = config.UserpassAuthAccessor
+			login = &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "login/" + username,
+				Data: map[string]interface{}{
+					"password": password,
+				},
+				Connection: req.Connection,
+			}
+		}
+	}
+	if login == nil && config.CertAuthAccessor != "" && req.Connection != nil && req.Connection.ConnState != nil && len(req.Connection.ConnState.PeerCertificates) > 0 {
+		accessor = config.CertAuthAccessor
+		login = &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "login",
+			Data: map[string]interface{}{
+				"name": config.CertAuthRole,
+			},
+			Connection: req.Connection,
+		}
+	}
+	if login == nil {
+		return estUnauthorizedError("enrollment requires HTTP Basic credentials or a TLS client certificate")
+	}
+
+	sysView, ok := b.System().(logical.ExtendedSystemView)
+	if !ok {
+		return fmt.Errorf("EST authentication is not supported by this system view")
+	}
+	auth, err := sysView.DelegatedLogin(ctx, accessor, login, req)
+	if err == logical.ErrPermissionDenied {
+		return estUnauthorizedError("authentication failed")
+	}
+	if err != nil {
+		return err
+	}
+	req.EntityID = auth.EntityID
+
+	return nil
+}
+
+// readEstCsr decodes the base64-encoded PKCS#10 body of an enrollment
+// request.
+func readEstCsr(req *logical.Request) (*x509.CertificateRequest, error) {
+	if req.HTTPRequest == nil || req.HTTPRequest.Body == nil {
+		return nil, errutil.UserError{Err: `enrollment requests must carry a base64-encoded CSR with a Content-Type of "application/pkcs10"`}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.HTTPRequest.Body, maxEstRequestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxEstRequestSize {
+		return nil, errutil.UserError{Err: fmt.Sprintf("request exceeds %d bytes", maxEstRequestSize)}
+	}
+
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(body)), ""))
+	if err != nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("unable to decode CSR: %v", err)}
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("unable to parse CSR: %v", err)}
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("invalid CSR signature: %v", err)}
+	}
+
+	return csr, nil
+}
+
+// issueEstCertificate signs the CSR against the role of the EST directory;
+// the names of the certificate are taken from the CSR, subject to the
+// role's policy.
+func (b *backend) issueEstCertificate(ctx context.Context, estCtx *estContext, req *logical.Request, csr *x509.CertificateRequest) (*logical.Response, error) {
+	role := *estCtx.role
+	role.UseCSRCommonName = true
+	role.UseCSRSANs = true
+
+	fields := addNonCACommonFields(map[string]*framework.FieldSchema{})
+	fields["csr"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+	}
+	apiData := &framework.FieldData{
+		Schema: fields,
+		Raw: map[string]interface{}{
+			"csr": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw})),
+		},
+	}
+
+	issuerRef := estIssuerRef(&role)
+	signingBundle, err := fetchCAInfo(ctx, req, issuerRef)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &inputBundle{
+		req:     req,
+		apiData: apiData,
+		role:    &role,
+	}
+	parsedBundle, err := signCert(b, input, signingBundle, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if !role.NoStore {
+		err = req.Storage.Put(ctx, &logical.StorageEntry{
+			Key:   "certs/" + normalizeSerial(certutil.GetHexFormatted(parsedBundle.Certificate.SerialNumber.Bytes(), ":")),
+			Value: parsedBundle.CertificateBytes,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to store certificate locally: %w", err)
+		}
+
+		issuerID, err := resolveIssuerReference(ctx, req.Storage, issuerRef)
+		if err != nil {
+			return nil, err
+		}
+		if err := storeCertMetadata(ctx, req, parsedBundle.Certificate, estCtx.roleName, issuerID, ""); err != nil {
+			return nil, fmt.Errorf("unable to store certificate metadata: %w", err)
+		}
+	}
+
+	return estCertsOnlyResponse(parsedBundle.CertificateBytes)
+}
+
+func estIssuerRef(role *roleEntry) string {
+	if role.IssuerRef == "" {
+		return defaultRef
+	}
+
+	return role.IssuerRef
+}
+
+// estCertsOnlyResponse wraps the given concatenated DER certificates in a
+// base64-encoded, degenerate certs-only PKCS#7 structure.
+func estCertsOnlyResponse(certs []byte) (*logical.Response, error) {
+	p7, err := pkcs7.DegenerateCertificate(certs)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding certificates: %w", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: estCertsOnlyContentType,
+			logical.HTTPRawBody:     []byte(base64.StdEncoding.EncodeToString(p7)),
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+	}, nil
+}
+
+func csrSANs(csr *x509.CertificateRequest) []string {
+	var sans []string
+	sans = append(sans, csr.DNSNames...)
+	sans = append(sans, csr.EmailAddresses...)
+	for _, ip := range csr.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range csr.URIs {
+		sans = append(sans, uri.String())
+	}
+
+	return sans
+}
+
+func equalStringSets(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	counts := make(map[string]int, len(a))
+	for _, value := range a {
+		counts[strings.ToLower(value)]++
+	}
+	for _, value := range b {
+		counts[strings.ToLower(value)]--
+	}
+	for _, count := range counts {
+		if count != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+const pathEstHelpDesc = `
+These paths implement the RFC 7030 EST enrollment protocol. The est/
+directory issues against the default role of config/est; est/:label/
+directories issue against the role mapped to the label.
+
+cacerts and csrattrs are open to all. simpleenroll authenticates clients
+with the HTTP Basic credentials or the client CA certificates configured in
+config/est; simplereenroll with the certificate being renewed, presented as
+the TLS client certificate. Enrollment requests carry a base64-encoded PKCS#10 CSR with a Content-Type of
+"application/pkcs10"; issued certificates are returned as base64-encoded
+certs-only PKCS#7.
+`
@@ -0,0 +1,448 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/builtin/credential/aws/pkcs7"
+	"github.com/hashicorp/vault/builtin/credential/userpass"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault"
+)
+
+// testEstSystemView stands in for the userpass and cert auth mounts EST
+// clients are logged in against
+type testEstSystemView struct {
+	*logical.StaticSystemView
+	trusted []*x509.Certificate
+}
+
+func (s *testEstSystemView) DelegatedLogin(ctx context.Context, mountAccessor string, login *logical.Request, req *logical.Request) (*logical.Auth, error) {
+	if req.Operation != logical.UpdateOperation {
+		return nil, logical.ErrPermissionDenied
+	}
+	switch mountAccessor {
+	case "auth_userpass_est":
+		if login.Path == "login/device" && login.Data["password"] == "enroll-secret" {
+			return &logical.Auth{EntityID: "device-entity"}, nil
+		}
+	case "auth_cert_est":
+		if login.Path != "login" || login.Data["name"] != "devices" || login.Connection == nil || login.Connection.ConnState == nil {
+			break
+		}
+		for _, ca := range s.trusted {
+			if login.Connection.ConnState.PeerCertificates[0].CheckSignatureFrom(ca) == nil {
+				return &logical.Auth{EntityID: "cert-entity"}, nil
+			}
+		}
+	}
+	return nil, logical.ErrPermissionDenied
+}
+
+func TestPki_EstEnrollment(t *testing.T) {
+	sysView := &testEstSystemView{StaticSystemView: logical.TestSystemView()}
+	config := logical.TestBackendConfig()
+	config.System = sysView
+	config.StorageView = &logical.InmemStorage{}
+	b := Backend(config)
+	if err := b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	storage := config.StorageView
+
+	write := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %s: err: %v resp: %#v", path, err, resp)
+		}
+		return resp
+	}
+
+	root := write("root/generate/internal", map[string]interface{}{
+		"common_name": "root.example.com",
+		"ttl":         "48h",
+	})
+	write("roles/devices", map[string]interface{}{
+		"allowed_domains":  "devices.example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"key_bits":         256,
+		"ttl":              "1h",
+	})
+
+	// EST directories are hidden until enabled
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "est/cacerts",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.Data[logical.HTTPStatusCode] != http.StatusNotFound {
+		t.Fatalf("expected EST to be disabled: err: %v resp: %#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/est",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"enabled":        true,
+			"default_role":   "devices",
+			"cert_auth_role": "devices",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected a cert auth role without a mount to be rejected: err: %v resp: %#v", err, resp)
+	}
+
+	clientCA, clientCAKey := testEstClientCA(t)
+	write("config/est", map[string]interface{}{
+		"enabled":                true,
+		"label_to_role":          map[string]interface{}{"routers": "devices"},
+		"userpass_auth_accessor": "auth_userpass_est",
+		"cert_auth_accessor":     "auth_cert_est",
+		"cert_auth_role":         "devices",
+	})
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/est",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.Data["userpass_auth_accessor"] != "auth_userpass_est" || resp.Data["cert_auth_role"] != "devices" {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	// estRequest sends an EST request, with the given password as HTTP Basic
+	// credentials when enrolling, unless empty
+	estRequest := func(op logical.Operation, path string, body []byte, conn *logical.Connection, password string) *logical.Response {
+		req := &logical.Request{
+			Operation:  op,
+			Path:       path,
+			Storage:    storage,
+			Connection: conn,
+		}
+		if body != nil {
+			httpReq := httptest.NewRequest(http.MethodPost, "/v1/pki/"+path, bytes.NewReader(body))
+			httpReq.Header.Set("Content-Type", "application/pkcs10")
+			if password != "" {
+				httpReq.SetBasicAuth("device", password)
+			}
+			req.HTTPRequest = httpReq
+		}
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil || resp == nil {
+			t.Fatalf("bad: %s: err: %v resp: %#v", path, err, resp)
+		}
+		return resp
+	}
+
+	parseCerts := func(resp *logical.Response) []*x509.Certificate {
+		if resp.Data[logical.HTTPStatusCode] != http.StatusOK || resp.Data[logical.HTTPContentType] != estCertsOnlyContentType {
+			t.Fatalf("unexpected EST response: %#v", resp.Data)
+		}
+		der, err := base64.StdEncoding.DecodeString(string(resp.Data[logical.HTTPRawBody].([]byte)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p7, err := pkcs7.Parse(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p7.Certificates
+	}
+
+	// Unknown labels and the unconfigured default directory are not found
+	if resp := estRequest(logical.ReadOperation, "est/cacerts", nil, nil, ""); resp.Data[logical.HTTPStatusCode] != http.StatusNotFound {
+		t.Fatalf("expected no default EST directory: %#v", resp.Data)
+	}
+
+	caCerts := parseCerts(estRequest(logical.ReadOperation, "est/routers/cacerts", nil, nil, ""))
+	rootCert, err := parseCertificateFromPEM(root.Data["certificate"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(caCerts) != 1 || !caCerts[0].Equal(rootCert) {
+		t.Fatalf("expected the root in cacerts, got %d certificates", len(caCerts))
+	}
+
+	if resp := estRequest(logical.ReadOperation, "est/routers/csrattrs", nil, nil, ""); resp.Data[logical.HTTPContentType] != estCsrAttrsContentType {
+		t.Fatalf("expected CSR attributes for an EC role: %#v", resp.Data)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	makeCsr := func(commonName string) []byte {
+		csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject:  pkix.Name{CommonName: commonName},
+			DNSNames: []string{commonName},
+		}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []byte(base64.StdEncoding.EncodeToString(csr))
+	}
+
+	// Enrollment requires the configured credentials
+	if resp := estRequest(logical.UpdateOperation, "est/routers/simpleenroll", makeCsr("r1.devices.example.com"), nil, ""); resp.Data[logical.HTTPStatusCode] != http.StatusUnauthorized || resp.Data[logical.HTTPWWWAuthenticateHeader] == nil {
+		t.Fatalf("expected enrollment without credentials to be unauthorized: %#v", resp.Data)
+	}
+	if resp := estRequest(logical.UpdateOperation, "est/routers/simpleenroll", makeCsr("r1.devices.example.com"), nil, "wrong"); resp.Data[logical.HTTPStatusCode] != http.StatusUnauthorized {
+		t.Fatalf("expected enrollment with a wrong password to be unauthorized: %#v", resp.Data)
+	}
+	untrusted := &logical.Connection{ConnState: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{rootCert}}}
+	if resp := estRequest(logical.UpdateOperation, "est/routers/simpleenroll", makeCsr("r1.devices.example.com"), untrusted, ""); resp.Data[logical.HTTPStatusCode] != http.StatusUnauthorized {
+		t.Fatalf("expected enrollment with an untrusted client certificate to be unauthorized: %#v", resp.Data)
+	}
+
+	// The role's policy still applies to names taken from the CSR
+	if resp := estRequest(logical.UpdateOperation, "est/routers/simpleenroll", makeCsr("www.example.com"), nil, "enroll-secret"); resp.Data[logical.HTTPStatusCode] != http.StatusBadRequest {
+		t.Fatalf("expected enrollment outside the role's domains to fail: %#v", resp.Data)
+	}
+
+	issued := parseCerts(estRequest(logical.UpdateOperation, "est/routers/simpleenroll", makeCsr("r1.devices.example.com"), nil, "enroll-secret"))
+	if len(issued) != 1 || issued[0].Subject.CommonName != "r1.devices.example.com" {
+		t.Fatalf("unexpected enrolled certificate: %#v", issued)
+	}
+	if err := issued[0].CheckSignatureFrom(rootCert); err != nil {
+		t.Fatal(err)
+	}
+
+	// Issued certificates are attributed to the entity of the client
+	entityOf := func(cert *x509.Certificate) interface{} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "cert-metadata/" + certutil.GetHexFormatted(cert.SerialNumber.Bytes(), ":"),
+			Storage:   storage,
+		})
+		if err != nil || resp == nil {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		return resp.Data["entity_id"]
+	}
+	if entity := entityOf(issued[0]); entity != "device-entity" {
+		t.Fatalf("expected the userpass entity, got %v", entity)
+	}
+
+	// Clients holding a certificate trusted by the cert auth mount may enroll
+	// as well
+	sysView.trusted = []*x509.Certificate{clientCA}
+	clientConn := &logical.Connection{ConnState: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{testEstClientCert(t, clientCA, clientCAKey)}}}
+	certs := parseCerts(estRequest(logical.UpdateOperation, "est/routers/simpleenroll", makeCsr("r3.devices.example.com"), clientConn, ""))
+	if len(certs) != 1 {
+		t.Fatalf("unexpected enrolled certificates: %#v", certs)
+	}
+	if entity := entityOf(certs[0]); entity != "cert-entity" {
+		t.Fatalf("expected the cert auth entity, got %v", entity)
+	}
+
+	// Re-enrollment requires the client to log in, the current certificate
+	// and identical names
+	conn := &logical.Connection{ConnState: &tls.ConnectionState{PeerCertificates: issued}}
+	if resp := estRequest(logical.UpdateOperation, "est/routers/simplereenroll", makeCsr("r1.devices.example.com"), conn, ""); resp.Data[logical.HTTPStatusCode] != http.StatusUnauthorized {
+		t.Fatalf("expected re-enrollment with a certificate unknown to cert auth to be unauthorized: %#v", resp.Data)
+	}
+	if resp := estRequest(logical.UpdateOperation, "est/routers/simplereenroll", makeCsr("r1.devices.example.com"), nil, "enroll-secret"); resp.Data[logical.HTTPStatusCode] != http.StatusBadRequest {
+		t.Fatalf("expected re-enrollment without a client certificate to fail: %#v", resp.Data)
+	}
+	sysView.trusted = append(sysView.trusted, rootCert)
+	if resp := estRequest(logical.UpdateOperation, "est/routers/simplereenroll", makeCsr("r2.devices.example.com"), conn, ""); resp.Data[logical.HTTPStatusCode] != http.StatusBadRequest {
+		t.Fatalf("expected re-enrollment with a different subject to fail: %#v", resp.Data)
+	}
+
+	renewed := parseCerts(estRequest(logical.UpdateOperation, "est/routers/simplereenroll", makeCsr("r1.devices.example.com"), conn, ""))
+	if len(renewed) != 1 || renewed[0].SerialNumber.Cmp(issued[0].SerialNumber) == 0 {
+		t.Fatalf("expected a new certificate on re-enrollment: %#v", renewed)
+	}
+}
+
+// testEstClientCA returns a self-signed CA issuing the TLS client
+// certificates of EST clients
+func testEstClientCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "EST client CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func testEstClientCert(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "device"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestPki_EstUserpassLogin(t *testing.T) {
+	coreConfig := &vault.CoreConfig{
+		CredentialBackends: map[string]logical.Factory{
+			"userpass": userpass.Factory,
+		},
+		LogicalBackends: map[string]logical.Factory{
+			"pki": Factory,
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+	client := cluster.Cores[0].Client
+
+	if err := client.Sys().Mount("pki", &api.MountInput{Type: "pki"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Sys().EnableAuth("userpass", "userpass", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Sys().PutPolicy("est", `path "pki/est/+/simpleenroll" { capabilities = ["update"] }`); err != nil {
+		t.Fatal(err)
+	}
+	for user, policy := range map[string]string{"device": "est", "other": "default"} {
+		if _, err := client.Logical().Write("auth/userpass/users/"+user, map[string]interface{}{
+			"password": "enroll-secret",
+			"policies": policy,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	auths, err := client.Sys().ListAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Logical().Write("pki/root/generate/internal", map[string]interface{}{
+		"common_name": "root.example.com",
+		"ttl":         "48h",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Logical().Write("pki/roles/devices", map[string]interface{}{
+		"allowed_domains":  "devices.example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"key_bits":         256,
+		"ttl":              "1h",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Logical().Write("pki/config/est", map[string]interface{}{
+		"enabled":                true,
+		"label_to_role":          map[string]interface{}{"routers": "devices"},
+		"userpass_auth_accessor": auths["userpass/"].Accessor,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "r1.devices.example.com"},
+		DNSNames: []string{"r1.devices.example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	estClient, err := client.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	estClient.ClearToken()
+	enroll := func(username, password string) int {
+		req := estClient.NewRequest(http.MethodPost, "/v1/pki/est/routers/simpleenroll")
+		req.BodyBytes = []byte(base64.StdEncoding.EncodeToString(csr))
+		req.Headers = http.Header{"Content-Type": []string{"application/pkcs10"}}
+		httpReq, err := http.NewRequest(http.MethodPost, "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpReq.SetBasicAuth(username, password)
+		req.Headers.Set("Authorization", httpReq.Header.Get("Authorization"))
+
+		resp, err := estClient.RawRequest(req)
+		if resp == nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// The client logs in through userpass, and its policies must grant the
+	// EST path
+	if status := enroll("device", "wrong"); status != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong password to be unauthorized, got %d", status)
+	}
+	if status := enroll("other", "enroll-secret"); status != http.StatusUnauthorized {
+		t.Fatalf("expected a user without the EST policy to be unauthorized, got %d", status)
+	}
+	if status := enroll("device", "enroll-secret"); status != http.StatusOK {
+		t.Fatalf("expected enrollment to succeed, got %d", status)
+	}
+
+	// The tokens of the logins don't outlive the requests
+	tokens, err := client.Logical().List("auth/token/accessors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := tokens.Data["keys"].([]interface{}); len(keys) != 1 {
+		t.Fatalf("expected only the root token to remain, got %d tokens", len(keys))
+	}
+}
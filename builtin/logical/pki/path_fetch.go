@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
 	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -42,7 +43,7 @@ func pathFetchCAChain(b *backend) *framework.Path {
 // Returns the CRL in raw format
 func pathFetchCRL(b *backend) *framework.Path {
 	return &framework.Path{
-		Pattern: `crl(/pem)?`,
+		Pattern: `crl(/delta)?(/pem)?`,
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.ReadOperation: b.pathFetchRead,
@@ -145,6 +146,12 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 		if req.Path == "crl/pem" {
 			pemType = "X509 CRL"
 		}
+	case req.Path == "crl/delta" || req.Path == "crl/delta/pem":
+		serial = "delta_crl"
+		contentType = "application/pkix-crl"
+		if req.Path == "crl/delta/pem" {
+			pemType = "X509 CRL"
+		}
 	case req.Path == "cert/crl":
 		serial = "crl"
 		pemType = "X509 CRL"
@@ -158,7 +165,7 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 	}
 
 	if serial == "ca_chain" {
-		caInfo, err := fetchCAInfo(ctx, req)
+		caChain, err := fetchCAChain(ctx, req.Storage, defaultRef)
 		switch err.(type) {
 		case errutil.UserError:
 			response = logical.ErrorResponse(err.Error())
@@ -168,7 +175,6 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 			goto reply
 		}
 
-		caChain := caInfo.GetCAChain()
 		var certStr string
 		for _, ca := range caChain {
 			block := pem.Block{
@@ -264,6 +270,28 @@ reply:
 	return
 }
 
+// fetchCAChain returns the CA chain of the referenced issuer. Unlike
+// fetchCAInfo, this does not require the issuer to have a private key.
+func fetchCAChain(ctx context.Context, s logical.Storage, issuerRef string) ([]*certutil.CertBlock, error) {
+	id, err := resolveIssuerReference(ctx, s, issuerRef)
+	if err != nil {
+		return nil, asTypedError(err, "unable to resolve issuer reference")
+	}
+
+	_, bundle, err := fetchCertBundleByIssuerID(ctx, s, id, false)
+	if err != nil {
+		return nil, asTypedError(err, "unable to fetch CA certificate")
+	}
+
+	parsedBundle, err := bundle.ToParsedCertBundle()
+	if err != nil {
+		return nil, errutil.InternalError{Err: err.Error()}
+	}
+
+	caInfo := &certutil.CAInfoBundle{ParsedCertBundle: *parsedBundle}
+	return caInfo.GetCAChain(), nil
+}
+
 const pathFetchHelpSyn = `
 Fetch a CA, CRL, CA Chain, or non-revoked certificate.
 `
@@ -274,4 +302,6 @@ This allows certificates to be fetched. If using the fetch/ prefix any non-revok
 Using "ca" or "crl" as the value fetches the appropriate information in DER encoding. Add "/pem" to either to get PEM encoding.
 
 Using "ca_chain" as the value fetches the certificate authority trust chain in PEM encoding.
+
+Using "crl/delta" fetches the delta CRL of the default issuer, if delta CRLs are enabled.
 `
@@ -0,0 +1,366 @@
+package pki
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathListIssuers(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuers/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathListIssuersHandler,
+		},
+
+		HelpSynopsis:    pathListIssuersHelpSyn,
+		HelpDescription: pathListIssuersHelpDesc,
+	}
+}
+
+func (b *backend) pathListIssuersHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	var responseKeys []string
+	responseInfo := make(map[string]interface{})
+
+	entries, err := listIssuers(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, identifier := range entries {
+		issuer, err := fetchIssuerByID(ctx, req.Storage, identifier)
+		if err != nil {
+			return nil, err
+		}
+
+		responseKeys = append(responseKeys, identifier.String())
+		responseInfo[identifier.String()] = map[string]interface{}{
+			"issuer_name": issuer.Name,
+			"key_id":      issuer.KeyID,
+			"is_default":  identifier == config.DefaultIssuerID,
+		}
+	}
+
+	return logical.ListResponseWithInfo(responseKeys, responseInfo), nil
+}
+
+func pathGetIssuer(b *backend) *framework.Path {
+	pattern := "issuer/" + framework.GenericNameRegex(issuerRefParam) + "(/der|/pem|/json)?$"
+
+	fields := addIssuerRefField(map[string]*framework.FieldSchema{})
+	fields["issuer_name"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Provide a name for the issuer; the name must be
+unique across all issuers and may not be the
+reserved value "default".`,
+	}
+
+	return &framework.Path{
+		Pattern: pattern,
+		Fields:  fields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathGetIssuerHandler,
+			logical.UpdateOperation: b.pathUpdateIssuerHandler,
+			logical.DeleteOperation: b.pathDeleteIssuerHandler,
+		},
+
+		HelpSynopsis:    pathGetIssuerHelpSyn,
+		HelpDescription: pathGetIssuerHelpDesc,
+	}
+}
+
+func (b *backend) pathGetIssuerHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuerName := getIssuerRef(data)
+
+	id, err := resolveIssuerReference(ctx, req.Storage, issuerName)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
+	}
+
+	issuer, err := fetchIssuerByID(ctx, req.Storage, id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasSuffix(req.Path, "/der"):
+		cert, err := issuer.GetCertificate()
+		if err != nil {
+			return nil, err
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				logical.HTTPContentType: "application/pkix-cert",
+				logical.HTTPRawBody:     cert.Raw,
+				logical.HTTPStatusCode:  200,
+			},
+		}, nil
+
+	case strings.HasSuffix(req.Path, "/pem"):
+		return &logical.Response{
+			Data: map[string]interface{}{
+				logical.HTTPContentType: "application/pem-certificate-chain",
+				logical.HTTPRawBody:     []byte(strings.TrimSpace(issuer.Certificate)),
+				logical.HTTPStatusCode:  200,
+			},
+		}, nil
+	}
+
+	return &logical.Response{
+		Data: respondReadIssuer(issuer),
+	}, nil
+}
+
+func respondReadIssuer(issuer *issuerEntry) map[string]interface{} {
+	caChain := []string{issuer.Certificate}
+	caChain = append(caChain, issuer.CAChain...)
+
+	return map[string]interface{}{
+		"issuer_id":     issuer.ID,
+		"issuer_name":   issuer.Name,
+		"key_id":        issuer.KeyID,
+		"certificate":   issuer.Certificate,
+		"ca_chain":      caChain,
+		"serial_number": issuer.SerialNumber,
+	}
+}
+
+func (b *backend) pathUpdateIssuerHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	id, err := resolveIssuerReference(ctx, req.Storage, getIssuerRef(data))
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
+	}
+
+	issuer, err := fetchIssuerByID(ctx, req.Storage, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if rawName, ok := data.GetOk("issuer_name"); ok {
+		newName := rawName.(string)
+		if err := checkIssuerNameAvailable(ctx, req.Storage, newName, issuer.ID); err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				return logical.ErrorResponse(err.Error()), nil
+			default:
+				return nil, err
+			}
+		}
+		issuer.Name = newName
+	}
+
+	if err := writeIssuer(ctx, req.Storage, issuer); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: respondReadIssuer(issuer),
+	}, nil
+}
+
+func (b *backend) pathDeleteIssuerHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	id, err := resolveIssuerReference(ctx, req.Storage, getIssuerRef(data))
+	if err != nil {
+		// Deleting a non-existent issuer is not an error.
+		if _, ok := err.(errutil.UserError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	wasDefault, err := deleteIssuer(ctx, req.Storage, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *logical.Response
+	if wasDefault {
+		resp = &logical.Response{}
+		resp.AddWarning(fmt.Sprintf("Deleted issuer %v was the default issuer; a new default issuer has not been set on this mount. Use %sconfig/issuers to set one.", id, req.MountPoint))
+	}
+
+	return resp, nil
+}
+
+func pathGetIssuerChains(b *backend) *framework.Path {
+	pattern := "issuer/" + framework.GenericNameRegex(issuerRefParam) + "/chains$"
+
+	return &framework.Path{
+		Pattern: pattern,
+		Fields:  addIssuerRefField(map[string]*framework.FieldSchema{}),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathGetIssuerChainsHandler,
+		},
+
+		HelpSynopsis:    pathGetIssuerChainsHelpSyn,
+		HelpDescription: pathGetIssuerChainsHelpDesc,
+	}
+}
+
+func (b *backend) pathGetIssuerChainsHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	id, err := resolveIssuerReference(ctx, req.Storage, getIssuerRef(data))
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
+	}
+
+	chains, err := buildIssuerChains(ctx, req.Storage, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"issuer_id": id,
+			"chains":    chains,
+		},
+	}, nil
+}
+
+func pathGetIssuerCRL(b *backend) *framework.Path {
+	pattern := "issuer/" + framework.GenericNameRegex(issuerRefParam) + "/crl(/delta)?(/pem|/der)?$"
+
+	return &framework.Path{
+		Pattern: pattern,
+		Fields:  addIssuerRefField(map[string]*framework.FieldSchema{}),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathGetIssuerCRLHandler,
+		},
+
+		HelpSynopsis:    pathGetIssuerCRLHelpSyn,
+		HelpDescription: pathGetIssuerCRLHelpDesc,
+	}
+}
+
+func (b *backend) pathGetIssuerCRLHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	fetchCRL := fetchIssuerCRLEntry
+	if strings.Contains(req.Path, "/crl/delta") {
+		fetchCRL = fetchIssuerDeltaCRLEntry
+	}
+
+	crlEntry, err := fetchCRL(ctx, req.Storage, getIssuerRef(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var crlBytes []byte
+	if crlEntry != nil {
+		crlBytes = crlEntry.Value
+	}
+
+	switch {
+	case strings.HasSuffix(req.Path, "/der"):
+		return rawCRLResponse("application/pkix-crl", crlBytes), nil
+	case strings.HasSuffix(req.Path, "/pem"):
+		return rawCRLResponse("application/x-pem-file", crlToPEM(crlBytes)), nil
+	}
+
+	if crlEntry == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"crl": string(crlToPEM(crlBytes)),
+		},
+	}, nil
+}
+
+func crlToPEM(crlBytes []byte) []byte {
+	if len(crlBytes) == 0 {
+		return nil
+	}
+
+	block := pem.Block{
+		Type:  "X509 CRL",
+		Bytes: crlBytes,
+	}
+
+	return []byte(strings.TrimSpace(string(pem.EncodeToMemory(&block))))
+}
+
+func rawCRLResponse(contentType string, body []byte) *logical.Response {
+	statusCode := 200
+	if len(body) == 0 {
+		statusCode = 204
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: contentType,
+			logical.HTTPRawBody:     body,
+			logical.HTTPStatusCode:  statusCode,
+		},
+	}
+}
+
+const pathListIssuersHelpSyn = `Fetch a list of CA certificates.`
+
+const pathListIssuersHelpDesc = `
+This endpoint allows listing of known issuing certificates, returning
+their identifier, name, key and whether they are the default issuer.
+`
+
+const pathGetIssuerHelpSyn = `Fetch a single issuer certificate.`
+
+const pathGetIssuerHelpDesc = `
+This allows fetching information associated with the underlying issuer
+certificate. Appending "/pem" or "/der" returns the raw certificate in the
+respective encoding without authentication.
+
+Writing the "issuer_name" parameter renames the issuer. Deleting the issuer
+removes it and its CRL from the mount; its key is kept.
+`
+
+const pathGetIssuerChainsHelpSyn = `Fetch every certificate chain of an issuer.`
+
+const pathGetIssuerChainsHelpDesc = `
+This returns each distinct path from the issuer to a root, or to the last
+certificate known to the mount, as a list of PEM certificates starting with
+the issuer's own. Issuers which have been cross-signed have one chain per
+signing issuer, letting clients pick the path matching the roots they trust.
+`
+
+const pathGetIssuerCRLHelpSyn = `Fetch an issuer's Certificate Revocation Log (CRL).`
+
+const pathGetIssuerCRLHelpDesc = `
+This allows fetching the specified issuer's CRL. Note that this is different
+than the legacy path (/crl and /certs/crl) in that this is per-issuer and not
+just the default issuer's CRL. Appending "/delta" fetches the issuer's delta
+CRL, if delta CRLs are enabled.
+`
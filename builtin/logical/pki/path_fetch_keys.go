@@ -0,0 +1,190 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathListKeys(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathListKeysHandler,
+		},
+
+		HelpSynopsis:    pathListKeysHelpSyn,
+		HelpDescription: pathListKeysHelpDesc,
+	}
+}
+
+func (b *backend) pathListKeysHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	var responseKeys []string
+	responseInfo := make(map[string]interface{})
+
+	entries, err := listKeys(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := getKeysConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, identifier := range entries {
+		key, err := fetchKeyByID(ctx, req.Storage, identifier)
+		if err != nil {
+			return nil, err
+		}
+
+		responseKeys = append(responseKeys, identifier.String())
+		responseInfo[identifier.String()] = map[string]interface{}{
+			"key_name":   key.Name,
+			"is_default": identifier == config.DefaultKeyID,
+		}
+	}
+
+	return logical.ListResponseWithInfo(responseKeys, responseInfo), nil
+}
+
+func pathKey(b *backend) *framework.Path {
+	pattern := "key/" + framework.GenericNameRegex(keyRefParam)
+
+	fields := addKeyRefField(map[string]*framework.FieldSchema{})
+	fields["key_name"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Provide a name for the key; the name must be
+unique across all keys and may not be the
+reserved value "default".`,
+	}
+
+	return &framework.Path{
+		Pattern: pattern,
+		Fields:  fields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathGetKeyHandler,
+			logical.UpdateOperation: b.pathUpdateKeyHandler,
+			logical.DeleteOperation: b.pathDeleteKeyHandler,
+		},
+
+		HelpSynopsis:    pathKeyHelpSyn,
+		HelpDescription: pathKeyHelpDesc,
+	}
+}
+
+func (b *backend) pathGetKeyHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	keyRef := data.Get(keyRefParam).(string)
+	if len(keyRef) == 0 {
+		return logical.ErrorResponse("missing key reference"), nil
+	}
+
+	id, err := resolveKeyReference(ctx, req.Storage, keyRef)
+	if err != nil {
+		return handleImportError(err)
+	}
+
+	key, err := fetchKeyByID(ctx, req.Storage, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: keyResponseData(key),
+	}, nil
+}
+
+func (b *backend) pathUpdateKeyHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	keyRef := data.Get(keyRefParam).(string)
+	if len(keyRef) == 0 {
+		return logical.ErrorResponse("missing key reference"), nil
+	}
+
+	id, err := resolveKeyReference(ctx, req.Storage, keyRef)
+	if err != nil {
+		return handleImportError(err)
+	}
+
+	key, err := fetchKeyByID(ctx, req.Storage, id)
+	if err != nil {
+		return nil, err
+	}
+
+	newName := data.Get("key_name").(string)
+	if err := checkKeyNameAvailable(ctx, req.Storage, newName, key.ID); err != nil {
+		return handleImportError(err)
+	}
+
+	if newName != key.Name {
+		key.Name = newName
+		if err := writeKey(ctx, req.Storage, key); err != nil {
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: keyResponseData(key),
+	}, nil
+}
+
+func (b *backend) pathDeleteKeyHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	keyRef := data.Get(keyRefParam).(string)
+	if len(keyRef) == 0 {
+		return logical.ErrorResponse("missing key reference"), nil
+	}
+
+	id, err := resolveKeyReference(ctx, req.Storage, keyRef)
+	if err != nil {
+		// Deleting a non-existent key is not an error.
+		if _, ok := err.(errutil.UserError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	inUse, issuer, err := isKeyInUse(ctx, req.Storage, id)
+	if err != nil {
+		return nil, err
+	}
+	if inUse {
+		return logical.ErrorResponse(fmt.Sprintf("Failed to delete key: key is in use by issuer %v", issuer)), nil
+	}
+
+	wasDefault, err := deleteKey(ctx, req.Storage, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *logical.Response
+	if wasDefault {
+		resp = &logical.Response{}
+		resp.AddWarning(fmt.Sprintf("Deleted key %v was the default key; a new default key has not been set on this mount. Use %sconfig/keys to set one.", id, req.MountPoint))
+	}
+
+	return resp, nil
+}
+
+const pathListKeysHelpSyn = `Fetch a list of all issuer keys`
+
+const pathListKeysHelpDesc = `This endpoint allows listing of known backing keys, returning
+their identifier and their name (if set).`
+
+const pathKeyHelpSyn = `Fetch a single issuer key`
+
+const pathKeyHelpDesc = `
+This allows fetching information associated with the underlying key.
+
+Writing the "key_name" parameter renames the key. A key may only be deleted
+once no issuer references it.
+`
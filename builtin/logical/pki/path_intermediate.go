@@ -12,8 +12,19 @@ import (
 )
 
 func pathGenerateIntermediate(b *backend) *framework.Path {
+	return buildPathGenerateIntermediate(b, "intermediate/generate/"+framework.GenericNameRegex("exported"))
+}
+
+func pathIssuerGenerateIntermediate(b *backend) *framework.Path {
+	ret := buildPathGenerateIntermediate(b, "issuers/generate/intermediate/"+framework.GenericNameRegex("exported"))
+	ret.Fields = addKeyNameField(ret.Fields)
+
+	return ret
+}
+
+func buildPathGenerateIntermediate(b *backend, pattern string) *framework.Path {
 	ret := &framework.Path{
-		Pattern: "intermediate/generate/" + framework.GenericNameRegex("exported"),
+		Pattern: pattern,
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.UpdateOperation: b.pathGenerateIntermediate,
@@ -69,13 +80,21 @@ func (b *backend) pathGenerateIntermediate(ctx context.Context, req *logical.Req
 		return errorResp, nil
 	}
 
+	_, keyName, errorResp := getIssuerAndKeyNames(data)
+	if errorResp != nil {
+		return errorResp, nil
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
 	var resp *logical.Response
 	input := &inputBundle{
 		role:    role,
 		req:     req,
 		apiData: data,
 	}
-	parsedBundle, err := generateIntermediateCSR(b, input, b.Backend.GetRandomReader())
+	parsedBundle, err := generateIntermediateCSR(ctx, b, input, b.Backend.GetRandomReader())
 	if err != nil {
 		switch err.(type) {
 		case errutil.UserError:
@@ -125,18 +144,25 @@ func (b *backend) pathGenerateIntermediate(ctx context.Context, req *logical.Req
 		}
 	}
 
-	cb := &certutil.CertBundle{}
-	cb.PrivateKey = csrb.PrivateKey
-	cb.PrivateKeyType = csrb.PrivateKeyType
-
-	entry, err := logical.StorageEntryJSON("config/ca_bundle", cb)
-	if err != nil {
-		return nil, err
+	// Keep the key around so that the signed certificate can later be
+	// matched against it by intermediate/set-signed. An existing key is
+	// already stored.
+	var myKey *keyEntry
+	if existingKeyRequested(input) {
+		myKey, err = fetchExistingKey(ctx, input)
+	} else {
+		myKey, _, err = importKey(ctx, req.Storage, csrb.PrivateKey, keyName)
 	}
-	err = req.Storage.Put(ctx, entry)
 	if err != nil {
-		return nil, err
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
 	}
+	resp.Data["key_id"] = myKey.ID
+	resp.Data["key_name"] = myKey.Name
 
 	return resp, nil
 }
@@ -162,70 +188,47 @@ func (b *backend) pathSetSignedIntermediate(ctx context.Context, req *logical.Re
 		return logical.ErrorResponse("supplied certificate could not be successfully parsed"), nil
 	}
 
-	cb := &certutil.CertBundle{}
-	entry, err := req.Storage.Get(ctx, "config/ca_bundle")
-	if err != nil {
-		return nil, err
-	}
-	if entry == nil {
-		return logical.ErrorResponse("could not find any existing entry with a private key"), nil
-	}
-
-	err = entry.DecodeJSON(cb)
-	if err != nil {
-		return nil, err
+	if !inputBundle.Certificate.IsCA {
+		return logical.ErrorResponse("the given certificate is not marked for CA use and cannot be used with this backend"), nil
 	}
 
-	if len(cb.PrivateKey) == 0 || cb.PrivateKeyType == "" {
-		return logical.ErrorResponse("could not find an existing private key"), nil
-	}
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
 
-	parsedCB, err := cb.ToParsedCertBundle()
+	myKey, err := findKeyForCertificate(ctx, req.Storage, inputBundle.Certificate)
 	if err != nil {
 		return nil, err
 	}
-	if parsedCB.PrivateKey == nil {
-		return nil, fmt.Errorf("saved key could not be parsed successfully")
-	}
-
-	inputBundle.PrivateKey = parsedCB.PrivateKey
-	inputBundle.PrivateKeyType = parsedCB.PrivateKeyType
-	inputBundle.PrivateKeyBytes = parsedCB.PrivateKeyBytes
-
-	if !inputBundle.Certificate.IsCA {
-		return logical.ErrorResponse("the given certificate is not marked for CA use and cannot be used with this backend"), nil
-	}
-
-	if err := inputBundle.Verify(); err != nil {
-		return nil, fmt.Errorf("verification of parsed bundle failed: %w", err)
+	if myKey == nil {
+		return logical.ErrorResponse("could not find an existing private key matching the given certificate"), nil
 	}
 
-	cb, err = inputBundle.ToCertBundle()
+	cb, err := inputBundle.ToCertBundle()
 	if err != nil {
 		return nil, fmt.Errorf("error converting raw values into cert bundle: %w", err)
 	}
 
-	entry, err = logical.StorageEntryJSON("config/ca_bundle", cb)
-	if err != nil {
-		return nil, err
-	}
-	err = req.Storage.Put(ctx, entry)
+	myIssuer, _, err := writeCaBundle(ctx, req.Storage, cb, "", "")
 	if err != nil {
-		return nil, err
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
 	}
 
-	entry.Key = "certs/" + normalizeSerial(cb.SerialNumber)
-	entry.Value = inputBundle.CertificateBytes
-	err = req.Storage.Put(ctx, entry)
-	if err != nil {
+	// This path historically replaced the mount's CA, so the newly set
+	// intermediate becomes the default issuer; previous issuers are kept
+	// so that they can continue to serve their CRLs.
+	if err := setIssuersConfig(ctx, req.Storage, &issuerConfigEntry{DefaultIssuerID: myIssuer.ID}); err != nil {
 		return nil, err
 	}
 
-	// For ease of later use, also store just the certificate at a known
-	// location
-	entry.Key = "ca"
-	entry.Value = inputBundle.CertificateBytes
-	err = req.Storage.Put(ctx, entry)
+	err = req.Storage.Put(ctx, &logical.StorageEntry{
+		Key:   "certs/" + normalizeSerial(cb.SerialNumber),
+		Value: inputBundle.CertificateBytes,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -15,8 +15,20 @@ import (
 )
 
 func pathIssue(b *backend) *framework.Path {
+	pattern := "issue/" + framework.GenericNameRegex("role")
+	return buildPathIssue(b, pattern)
+}
+
+func pathIssuerIssue(b *backend) *framework.Path {
+	pattern := "issuer/" + framework.GenericNameRegex(issuerRefParam) + "/issue/" + framework.GenericNameRegex("role")
+	ret := buildPathIssue(b, pattern)
+	ret.Fields = addIssuerRefField(ret.Fields)
+	return ret
+}
+
+func buildPathIssue(b *backend, pattern string) *framework.Path {
 	ret := &framework.Path{
-		Pattern: "issue/" + framework.GenericNameRegex("role"),
+		Pattern: pattern,
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.UpdateOperation: b.pathIssue,
@@ -31,8 +43,20 @@ func pathIssue(b *backend) *framework.Path {
 }
 
 func pathSign(b *backend) *framework.Path {
+	pattern := "sign/" + framework.GenericNameRegex("role")
+	return buildPathSign(b, pattern)
+}
+
+func pathIssuerSign(b *backend) *framework.Path {
+	pattern := "issuer/" + framework.GenericNameRegex(issuerRefParam) + "/sign/" + framework.GenericNameRegex("role")
+	ret := buildPathSign(b, pattern)
+	ret.Fields = addIssuerRefField(ret.Fields)
+	return ret
+}
+
+func buildPathSign(b *backend, pattern string) *framework.Path {
 	ret := &framework.Path{
-		Pattern: "sign/" + framework.GenericNameRegex("role"),
+		Pattern: pattern,
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.UpdateOperation: b.pathSign,
@@ -54,8 +78,20 @@ func pathSign(b *backend) *framework.Path {
 }
 
 func pathSignVerbatim(b *backend) *framework.Path {
+	pattern := "sign-verbatim" + framework.OptionalParamRegex("role")
+	return buildPathSignVerbatim(b, pattern)
+}
+
+func pathIssuerSignVerbatim(b *backend) *framework.Path {
+	pattern := "issuer/" + framework.GenericNameRegex(issuerRefParam) + "/sign-verbatim" + framework.OptionalParamRegex("role")
+	ret := buildPathSignVerbatim(b, pattern)
+	ret.Fields = addIssuerRefField(ret.Fields)
+	return ret
+}
+
+func buildPathSignVerbatim(b *backend, pattern string) *framework.Path {
 	ret := &framework.Path{
-		Pattern: "sign-verbatim" + framework.OptionalParamRegex("role"),
+		Pattern: pattern,
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.UpdateOperation: b.pathSignVerbatim,
@@ -182,6 +218,8 @@ func (b *backend) pathSignVerbatim(ctx context.Context, req *logical.Request, da
 			*entry.GenerateLease = *role.GenerateLease
 		}
 		entry.NoStore = role.NoStore
+		entry.StoreMetadata = role.StoreMetadata
+		entry.IssuerRef = role.IssuerRef
 	}
 
 	return b.pathIssueSignCert(ctx, req, data, entry, true, true)
@@ -199,8 +237,28 @@ func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, d
 			`the "format" path parameter must be "pem", "der", or "pem_bundle"`), nil
 	}
 
+	certMetadata := data.Get("cert_metadata").(string)
+	if certMetadata != "" {
+		if !role.StoreMetadata {
+			return logical.ErrorResponse(`"cert_metadata" was provided but the role does not have "store_metadata" set`), nil
+		}
+		if len(certMetadata) > maxCertMetadataSize {
+			return logical.ErrorResponse(fmt.Sprintf(`"cert_metadata" exceeds the maximum size of %d bytes`, maxCertMetadataSize)), nil
+		}
+	}
+
+	// The issuer given in the request path, if any, takes precedence over
+	// the one configured on the role.
+	issuerName := role.IssuerRef
+	if rawRef, ok := data.GetOk(issuerRefParam); ok {
+		issuerName = rawRef.(string)
+	}
+	if len(issuerName) == 0 {
+		issuerName = defaultRef
+	}
+
 	var caErr error
-	signingBundle, caErr := fetchCAInfo(ctx, req)
+	signingBundle, caErr := fetchCAInfo(ctx, req, issuerName)
 	switch caErr.(type) {
 	case errutil.UserError:
 		return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -323,6 +381,14 @@ func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, d
 		if err != nil {
 			return nil, fmt.Errorf("unable to store certificate locally: %w", err)
 		}
+
+		issuerID, err := resolveIssuerReference(ctx, req.Storage, issuerName)
+		if err != nil {
+			return nil, err
+		}
+		if err := storeCertMetadata(ctx, req, parsedBundle.Certificate, data.Get("role").(string), issuerID, certMetadata); err != nil {
+			return nil, fmt.Errorf("unable to store certificate metadata: %w", err)
+		}
 	}
 
 	if useCSR {
@@ -0,0 +1,299 @@
+package pki
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathImportIssuer(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuers/import/(cert|bundle)",
+		Fields: map[string]*framework.FieldSchema{
+			"pem_bundle": {
+				Type: framework.TypeString,
+				Description: `PEM-format, concatenated unencrypted
+secret-key (optional) and certificates.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportIssuers,
+		},
+
+		HelpSynopsis:    pathImportIssuersHelpSyn,
+		HelpDescription: pathImportIssuersHelpDesc,
+	}
+}
+
+func (b *backend) pathImportIssuers(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	keysAllowed := strings.HasSuffix(req.Path, "bundle")
+
+	pemBundle := data.Get("pem_bundle").(string)
+	if pemBundle == "" {
+		return logical.ErrorResponse("'pem_bundle' was empty"), nil
+	}
+
+	var keys []string
+	var certs []string
+
+	// Split the bundle into its individual PEM blocks, so that keys and
+	// certificates can be imported independently of their order.
+	pemBytes := []byte(pemBundle)
+	var pemBlock *pem.Block
+	for len(strings.TrimSpace(string(pemBytes))) > 0 {
+		pemBlock, pemBytes = pem.Decode(pemBytes)
+		if pemBlock == nil {
+			return logical.ErrorResponse("provided PEM block contained no data"), nil
+		}
+
+		pemBlockString := string(pem.EncodeToMemory(pemBlock))
+		if strings.Contains(pemBlock.Type, "PRIVATE KEY") {
+			keys = append(keys, pemBlockString)
+		} else if pemBlock.Type == "CERTIFICATE" {
+			certs = append(certs, pemBlockString)
+		} else {
+			return logical.ErrorResponse(fmt.Sprintf("unknown PEM block type %q in bundle", pemBlock.Type)), nil
+		}
+	}
+
+	if len(keys) > 0 && !keysAllowed {
+		return logical.ErrorResponse("private keys found in the PEM bundle but not allowed by the path; use /issuers/import/bundle"), nil
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	var createdKeys []string
+	var createdIssuers []string
+
+	for _, keyPem := range keys {
+		key, existing, err := importKey(ctx, req.Storage, keyPem, "")
+		if err != nil {
+			return handleImportError(err)
+		}
+		if !existing {
+			createdKeys = append(createdKeys, key.ID.String())
+		}
+	}
+
+	for index, certPem := range certs {
+		issuer, existing, err := importIssuer(ctx, req.Storage, certPem, "")
+		if err != nil {
+			return handleImportError(err)
+		}
+		if existing {
+			continue
+		}
+
+		// As with the legacy config/ca path, any certificates following
+		// a certificate in the bundle form its chain.
+		if index+1 < len(certs) {
+			for _, chainPem := range certs[index+1:] {
+				issuer.CAChain = append(issuer.CAChain, strings.TrimSpace(chainPem))
+			}
+			if err := writeIssuer(ctx, req.Storage, issuer); err != nil {
+				return nil, err
+			}
+		}
+
+		createdIssuers = append(createdIssuers, issuer.ID.String())
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"imported_keys":    createdKeys,
+			"imported_issuers": createdIssuers,
+		},
+	}
+
+	if len(createdIssuers) > 0 {
+		if err := rebuildIssuersChains(ctx, req.Storage); err != nil {
+			return nil, err
+		}
+		if err := buildCRL(ctx, b, req, true); err != nil {
+			return nil, err
+		}
+	} else if len(createdKeys) == 0 {
+		resp.AddWarning("All keys and certificates in the bundle already exist in this mount; nothing was imported.")
+	}
+
+	return resp, nil
+}
+
+func handleImportError(err error) (*logical.Response, error) {
+	switch err.(type) {
+	case errutil.UserError:
+		return logical.ErrorResponse(err.Error()), nil
+	default:
+		return nil, err
+	}
+}
+
+func pathConfigIssuers(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/issuers",
+		Fields: map[string]*framework.FieldSchema{
+			defaultRef: {
+				Type:        framework.TypeString,
+				Description: `Reference (name or identifier) to the default issuer.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathCAIssuersRead,
+			logical.UpdateOperation: b.pathCAIssuersWrite,
+		},
+
+		HelpSynopsis:    pathConfigIssuersHelpSyn,
+		HelpDescription: pathConfigIssuersHelpDesc,
+	}
+}
+
+func (b *backend) pathCAIssuersRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return logical.ErrorResponse("Error loading issuers configuration: " + err.Error()), nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			defaultRef: config.DefaultIssuerID,
+		},
+	}, nil
+}
+
+func (b *backend) pathCAIssuersWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	newDefault := data.Get(defaultRef).(string)
+	if len(newDefault) == 0 || newDefault == defaultRef {
+		return logical.ErrorResponse("Invalid issuer specification; must be non-empty and can't be 'default'."), nil
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	parsedIssuer, err := resolveIssuerReference(ctx, req.Storage, newDefault)
+	if err != nil {
+		return handleImportError(err)
+	}
+
+	issuer, err := fetchIssuerByID(ctx, req.Storage, parsedIssuer)
+	if err != nil {
+		return nil, err
+	}
+	if len(issuer.KeyID) == 0 {
+		return logical.ErrorResponse("Issuer has no associated key and cannot be the default issuer."), nil
+	}
+
+	if err := setIssuersConfig(ctx, req.Storage, &issuerConfigEntry{DefaultIssuerID: parsedIssuer}); err != nil {
+		return nil, err
+	}
+
+	// The legacy CRL location serves the default issuer's CRL.
+	if err := buildCRL(ctx, b, req, true); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			defaultRef: parsedIssuer,
+		},
+	}, nil
+}
+
+func pathConfigKeys(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/keys",
+		Fields: map[string]*framework.FieldSchema{
+			defaultRef: {
+				Type:        framework.TypeString,
+				Description: `Reference (name or identifier) of the default key.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathKeyDefaultRead,
+			logical.UpdateOperation: b.pathKeyDefaultWrite,
+		},
+
+		HelpSynopsis:    pathConfigKeysHelpSyn,
+		HelpDescription: pathConfigKeysHelpDesc,
+	}
+}
+
+func (b *backend) pathKeyDefaultRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getKeysConfig(ctx, req.Storage)
+	if err != nil {
+		return logical.ErrorResponse("Error loading keys configuration: " + err.Error()), nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			defaultRef: config.DefaultKeyID,
+		},
+	}, nil
+}
+
+func (b *backend) pathKeyDefaultWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	newDefault := data.Get(defaultRef).(string)
+	if len(newDefault) == 0 || newDefault == defaultRef {
+		return logical.ErrorResponse("Invalid key specification; must be non-empty and can't be 'default'."), nil
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	parsedKey, err := resolveKeyReference(ctx, req.Storage, newDefault)
+	if err != nil {
+		return handleImportError(err)
+	}
+
+	if err := setKeysConfig(ctx, req.Storage, &keyConfigEntry{DefaultKeyID: parsedKey}); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			defaultRef: parsedKey,
+		},
+	}, nil
+}
+
+const pathImportIssuersHelpSyn = `Import the specified issuing certificates.`
+
+const pathImportIssuersHelpDesc = `
+This endpoint allows importing the specified issuer certificates.
+
+:type is either the literal value "cert", to only allow importing
+certificates, else "bundle" to allow importing keys as well as
+certificates.
+
+Each certificate becomes a new issuer and each key a new key; duplicates of
+existing issuers or keys are skipped. Unlike config/ca, importing does not
+change the default issuer unless the mount had none.
+`
+
+const pathConfigIssuersHelpSyn = `Read and set the default issuer certificate for signing.`
+
+const pathConfigIssuersHelpDesc = `
+This path allows configuration of issuer parameters.
+
+Presently, the "default" parameter controls which issuer is the default,
+accessible by the existing signing paths (/root/sign-intermediate,
+/root/sign-self-issued, /sign-verbatim, /sign/:role, and /issue/:role),
+by roles referencing the "default" issuer, and by the legacy ca, ca_chain
+and crl paths.
+`
+
+const pathConfigKeysHelpSyn = `Read and set the default key used for signing.`
+
+const pathConfigKeysHelpDesc = `
+This path allows configuration of key parameters.
+
+The "default" parameter controls which key is the default used by signing paths.
+`
@@ -0,0 +1,333 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestPki_MultipleIssuers(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	generateRoot := func(issuerName, commonName string) map[string]interface{} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issuers/generate/root/internal",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"common_name": commonName,
+				"issuer_name": issuerName,
+				"key_name":    issuerName + "-key",
+				"ttl":         "48h",
+			},
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		return resp.Data
+	}
+
+	first := generateRoot("root-a", "root-a.example.com")
+	second := generateRoot("root-b", "root-b.example.com")
+
+	if first["issuer_id"] == second["issuer_id"] || first["key_id"] == second["key_id"] {
+		t.Fatalf("expected distinct issuers and keys: %#v / %#v", first, second)
+	}
+
+	// The first issuer remains the default
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "issuers",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if len(resp.Data["keys"].([]string)) != 2 {
+		t.Fatalf("expected two issuers, got: %#v", resp.Data["keys"])
+	}
+	firstInfo := resp.Data["key_info"].(map[string]interface{})[string(first["issuer_id"].(issuerID))].(map[string]interface{})
+	if !firstInfo["is_default"].(bool) {
+		t.Fatalf("expected first issuer to be the default: %#v", firstInfo)
+	}
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/example",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"allowed_domains":  "example.com",
+			"allow_subdomains": true,
+			"issuer_ref":       "root-b",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issueAndCheck := func(path, expectedIssuer string) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"common_name": "test.example.com",
+			},
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+
+		block, _ := pem.Decode([]byte(resp.Data["certificate"].(string)))
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.Issuer.CommonName != expectedIssuer {
+			t.Fatalf("%s: expected issuer %s, got %s", path, expectedIssuer, cert.Issuer.CommonName)
+		}
+	}
+
+	// The role's issuer is used unless the path names one
+	issueAndCheck("issue/example", "root-b.example.com")
+	issueAndCheck("issuer/root-a/issue/example", "root-a.example.com")
+
+	// Changing the default issuer switches the legacy CA path
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/issuers",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"default": "root-b",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caEntry, err := fetchCertBySerial(context.Background(), &logical.Request{Storage: storage}, "", "ca")
+	if err != nil || caEntry == nil {
+		t.Fatalf("bad: err: %v entry: %v", err, caEntry)
+	}
+	caCert, err := x509.ParseCertificate(caEntry.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caCert.Subject.CommonName != "root-b.example.com" {
+		t.Fatalf("expected default CA to be root-b, got %s", caCert.Subject.CommonName)
+	}
+
+	// Each issuer has its own CRL
+	for _, name := range []string{"root-a", "root-b"} {
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "issuer/" + name + "/crl/der",
+			Storage:   storage,
+		})
+		if err != nil || resp == nil {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		crl, err := x509.ParseCRL(resp.Data[logical.HTTPRawBody].([]byte))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if crl.TBSCertList.Issuer.String() != "CN="+name+".example.com" {
+			t.Fatalf("unexpected CRL issuer: %v", crl.TBSCertList.Issuer)
+		}
+	}
+
+	// A key in use by an issuer can't be removed
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "key/root-a-key",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error deleting in-use key: err: %v resp: %#v", err, resp)
+	}
+}
+
+func TestPki_MigrateLegacyCABundle(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "root/generate/exported",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"common_name": "legacy.example.com",
+		},
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	// Rewrite the mount's storage as a previous version would have left it
+	bundle := &certutil.CertBundle{
+		Certificate:    resp.Data["certificate"].(string),
+		PrivateKey:     resp.Data["private_key"].(string),
+		PrivateKeyType: resp.Data["private_key_type"].(certutil.PrivateKeyType),
+		SerialNumber:   resp.Data["serial_number"].(string),
+	}
+	legacyStorage := &logical.InmemStorage{}
+	entry, err := logical.StorageEntryJSON(legacyCertBundlePath, bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := legacyStorage.Put(context.Background(), entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.initialize(context.Background(), &logical.InitializationRequest{Storage: legacyStorage}); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry, _ := legacyStorage.Get(context.Background(), legacyCertBundlePath); entry != nil {
+		t.Fatal("expected legacy CA bundle to be removed after migration")
+	}
+
+	id, err := resolveIssuerReference(context.Background(), legacyStorage, defaultRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := fetchIssuerByID(context.Background(), legacyStorage, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issuer.SerialNumber != bundle.SerialNumber || len(issuer.KeyID) == 0 {
+		t.Fatalf("unexpected migrated issuer: %#v", issuer)
+	}
+
+	// Migration is idempotent
+	if err := b.initialize(context.Background(), &logical.InitializationRequest{Storage: legacyStorage}); err != nil {
+		t.Fatal(err)
+	}
+	issuers, err := listIssuers(context.Background(), legacyStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issuers) != 1 {
+		t.Fatalf("expected a single issuer, got %v", issuers)
+	}
+}
+
+func TestPki_CrossSignIssuer(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	write := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %s: err: %v resp: %#v", path, err, resp)
+		}
+		return resp
+	}
+
+	read := func(path string) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      path,
+			Storage:   storage,
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: %s: err: %v resp: %#v", path, err, resp)
+		}
+		return resp
+	}
+
+	oldRoot := write("issuers/generate/root/internal", map[string]interface{}{
+		"common_name": "old-root.example.com",
+		"issuer_name": "old-root",
+		"ttl":         "48h",
+	})
+	newRoot := write("issuers/generate/root/internal", map[string]interface{}{
+		"common_name": "new-root.example.com",
+		"issuer_name": "new-root",
+		"ttl":         "24h",
+	})
+
+	// An issuer can't cross-sign its own key
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "issuer/new-root/cross-sign",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"subject_issuer_ref": "new-root",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error cross-signing an issuer with itself: err: %v resp: %#v", err, resp)
+	}
+
+	crossSigned := write("issuer/old-root/cross-sign", map[string]interface{}{
+		"subject_issuer_ref": "new-root",
+		"issuer_name":        "new-root-cross-signed",
+	})
+	if crossSigned.Data["key_id"] != newRoot.Data["key_id"] {
+		t.Fatalf("expected the cross-signed issuer to share the new root's key: %#v", crossSigned.Data)
+	}
+
+	crossCert, err := parseCertificateFromPEM(crossSigned.Data["certificate"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldCert, err := parseCertificateFromPEM(oldRoot.Data["certificate"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newCert, err := parseCertificateFromPEM(newRoot.Data["certificate"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crossCert.CheckSignatureFrom(oldCert); err != nil {
+		t.Fatalf("expected the cross-signed certificate to be signed by the old root: %v", err)
+	}
+	if crossCert.Subject.String() != newCert.Subject.String() {
+		t.Fatalf("expected the cross-signed certificate to carry the new root's subject, got %v", crossCert.Subject)
+	}
+	if chain := crossSigned.Data["ca_chain"].([]string); len(chain) != 2 {
+		t.Fatalf("expected the cross-signed issuer to chain to the old root: %v", chain)
+	}
+
+	// An intermediate under the new root chains through both paths
+	csr := write("issuers/generate/intermediate/internal", map[string]interface{}{
+		"common_name": "intermediate.example.com",
+	})
+	signed := write("issuer/new-root/sign-intermediate", map[string]interface{}{
+		"csr":    csr.Data["csr"],
+		"format": "pem_bundle",
+		"ttl":    "12h",
+	})
+	imported := write("issuers/import/cert", map[string]interface{}{
+		"pem_bundle": signed.Data["certificate"],
+	})
+	intermediateID := imported.Data["imported_issuers"].([]string)[0]
+
+	caChain := read("issuer/" + intermediateID).Data["ca_chain"].([]string)
+	if len(caChain) != 4 {
+		t.Fatalf("expected the intermediate, both new root certificates and the old root in ca_chain, got %d entries", len(caChain))
+	}
+
+	chains := read("issuer/" + intermediateID + "/chains").Data["chains"].([][]string)
+	if len(chains) != 2 {
+		t.Fatalf("expected two chains, got %d", len(chains))
+	}
+	terminals := map[string]bool{}
+	for _, chain := range chains {
+		root, err := parseCertificateFromPEM(chain[len(chain)-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		terminals[root.Subject.CommonName] = true
+	}
+	if !terminals["old-root.example.com"] || !terminals["new-root.example.com"] {
+		t.Fatalf("expected chains to the old and new roots, got %v", terminals)
+	}
+}
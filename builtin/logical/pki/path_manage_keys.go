@@ -0,0 +1,184 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathImportManagedKey(b *backend) *framework.Path {
+	fields := addKeyNameField(map[string]*framework.FieldSchema{})
+	fields["managed_key_type"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Where the private key is held: "pkcs11" for a key
+in a PKCS#11 token, or "transit" for a named key of a transit mount.`,
+		AllowedValues: []interface{}{managedKeyTypePKCS11, managedKeyTypeTransit},
+	}
+
+	fields["kms_library"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `PKCS#11 only; the name of the kms_library "pkcs11"
+block of the server configuration giving the PKCS#11 library to load.`,
+	}
+	fields["slot"] = &framework.FieldSchema{
+		Type:        framework.TypeInt,
+		Description: `PKCS#11 only; the slot holding the token. Either slot or token_label is required.`,
+	}
+	fields["token_label"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `PKCS#11 only; the label of the token holding the key.`,
+	}
+	fields["pin"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `PKCS#11 only; the user PIN used to log in to the token.`,
+	}
+	fields["key_label"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `PKCS#11 only; the label (CKA_LABEL) of the key objects.
+Either key_label or key_object_id is required.`,
+	}
+	fields["key_object_id"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `PKCS#11 only; the hex-encoded identifier (CKA_ID) of the key objects.`,
+	}
+
+	fields["address"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Transit only; the address of the Vault server hosting
+the transit mount. Defaults to the VAULT_ADDR of the server.`,
+	}
+	fields["token"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Transit only; the token used to read the transit key
+and sign with it.`,
+	}
+	fields["ca_cert"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `Transit only; PEM-encoded CA certificate used to verify the Vault server.`,
+	}
+	fields["mount"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `Transit only; the path of the transit mount, e.g. "transit".`,
+	}
+	fields["transit_key"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: `Transit only; the name of the asymmetric transit key.`,
+	}
+	fields["transit_key_version"] = &framework.FieldSchema{
+		Type: framework.TypeInt,
+		Description: `Transit only; the version of the transit key to sign
+with. Defaults to the latest version at the time of registration; later
+rotations of the transit key do not affect the issuer.`,
+	}
+
+	return &framework.Path{
+		Pattern: "keys/managed",
+		Fields:  fields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportManagedKey,
+		},
+
+		HelpSynopsis:    pathImportManagedKeyHelpSyn,
+		HelpDescription: pathImportManagedKeyHelpDesc,
+	}
+}
+
+func (b *backend) pathImportManagedKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	_, keyName, errorResp := getIssuerAndKeyNames(data)
+	if errorResp != nil {
+		return errorResp, nil
+	}
+
+	managed := &managedKeyEntry{
+		Type:        data.Get("managed_key_type").(string),
+		LibraryName: data.Get("kms_library").(string),
+		TokenLabel:  data.Get("token_label").(string),
+		PIN:         data.Get("pin").(string),
+		KeyLabel:    data.Get("key_label").(string),
+		ObjectID:    strings.ToLower(strings.ReplaceAll(data.Get("key_object_id").(string), ":", "")),
+		Address:     data.Get("address").(string),
+		Token:       data.Get("token").(string),
+		CACert:      data.Get("ca_cert").(string),
+		Mount:       strings.Trim(data.Get("mount").(string), "/"),
+		TransitKey:  data.Get("transit_key").(string),
+		KeyVersion:  data.Get("transit_key_version").(int),
+	}
+	if slotRaw, ok := data.GetOk("slot"); ok {
+		if slotRaw.(int) < 0 {
+			return logical.ErrorResponse("slot must not be negative"), nil
+		}
+		slot := uint(slotRaw.(int))
+		managed.Slot = &slot
+	}
+	if managed.KeyVersion < 0 {
+		return logical.ErrorResponse("transit_key_version must not be negative"), nil
+	}
+
+	// Pick up changes to the server configuration since the mount was set up
+	setPKCS11Libraries(b.System())
+
+	if err := managed.validate(); err != nil {
+		return handleImportError(err)
+	}
+
+	publicKey, err := managed.fetchPublicKey()
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("unable to load managed key: %v", err)), nil
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	key, existing, err := importManagedKey(ctx, req.Storage, managed, publicKey, keyName)
+	if err != nil {
+		return handleImportError(err)
+	}
+
+	resp := &logical.Response{
+		Data: keyResponseData(key),
+	}
+	if existing {
+		resp.AddWarning(fmt.Sprintf("A key with the same public key already exists as key %v; no new key was registered.", key.ID))
+	}
+
+	return resp, nil
+}
+
+// keyResponseData returns the information about a key returned by the key
+// endpoints; the location of managed keys is never returned, as it may
+// include credentials.
+func keyResponseData(key *keyEntry) map[string]interface{} {
+	data := map[string]interface{}{
+		"key_id":   key.ID,
+		"key_name": key.Name,
+		"key_type": key.PrivateKeyType,
+	}
+	if key.isManaged() {
+		data["managed_key_type"] = key.ManagedKey.Type
+	}
+
+	return data
+}
+
+const pathImportManagedKeyHelpSyn = `Register a key held outside of Vault for use by issuers`
+
+const pathImportManagedKeyHelpDesc = `
+This endpoint registers a private key held in a PKCS#11 token (such as an
+HSM or SoftHSM) or as an asymmetric key of a transit mount. Only the public
+key is stored; every signature made with the key, whether for certificates,
+CRLs or OCSP responses, is produced by the external key store.
+
+PKCS#11 libraries are only loaded from the paths of the kms_library "pkcs11"
+blocks of the server configuration, referenced by name in "kms_library".
+As transit keys are used with the given token against the given address,
+this endpoint requires a root token or sudo capability.
+
+Certificates whose public key matches the registered key, whether imported
+earlier or later, are linked to it. To create a new root or intermediate
+with the key, use the "existing" generation type and reference the key with
+"key_ref", e.g. issuers/generate/root/existing.
+`
@@ -0,0 +1,286 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	ocspReqParam            = "req"
+	ocspResponseContentType = "application/ocsp-response"
+	maxOcspRequestSize      = 2048
+)
+
+var errOcspUnknownIssuer = errutil.UserError{Err: "request does not reference an issuer of this mount"}
+
+func pathOcspGet(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "ocsp/" + framework.MatchAllRegex(ocspReqParam),
+		Fields: map[string]*framework.FieldSchema{
+			ocspReqParam: {
+				Type:        framework.TypeString,
+				Description: `Base64-encoded DER OCSP request, per RFC 6960 Appendix A.1.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathOcspHandler,
+		},
+
+		HelpSynopsis:    pathOcspHelpSyn,
+		HelpDescription: pathOcspHelpDesc,
+	}
+}
+
+func pathOcspPost(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "ocsp",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathOcspHandler,
+		},
+
+		HelpSynopsis:    pathOcspHelpSyn,
+		HelpDescription: pathOcspHelpDesc,
+	}
+}
+
+func (b *backend) pathOcspHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.CRL(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil && config.OcspDisable {
+		return ocspErrorResponse(http.StatusUnauthorized, ocsp.UnauthorizedErrorResponse), nil
+	}
+
+	derReq, err := fetchDerEncodedOcspRequest(req, data)
+	if err != nil {
+		return ocspErrorResponse(http.StatusBadRequest, ocsp.MalformedRequestErrorResponse), nil
+	}
+
+	ocspReq, err := ocsp.ParseRequest(derReq)
+	if err != nil {
+		return ocspErrorResponse(http.StatusBadRequest, ocsp.MalformedRequestErrorResponse), nil
+	}
+
+	respBytes, err := b.buildOcspResponse(ctx, req.Storage, config, ocspReq)
+	if err != nil {
+		if err == errOcspUnknownIssuer {
+			return ocspErrorResponse(http.StatusUnauthorized, ocsp.UnauthorizedErrorResponse), nil
+		}
+
+		b.Logger().Warn("error building OCSP response", "serial", ocspReq.SerialNumber, "error", err)
+		return ocspErrorResponse(http.StatusInternalServerError, ocsp.InternalErrorErrorResponse), nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: ocspResponseContentType,
+			logical.HTTPStatusCode:  http.StatusOK,
+			logical.HTTPRawBody:     respBytes,
+		},
+	}, nil
+}
+
+func ocspErrorResponse(status int, body []byte) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: ocspResponseContentType,
+			logical.HTTPStatusCode:  status,
+			logical.HTTPRawBody:     body,
+		},
+	}
+}
+
+// fetchDerEncodedOcspRequest returns the DER request, either from the URL
+// of a GET request or from the raw body of a POST request.
+func fetchDerEncodedOcspRequest(req *logical.Request, data *framework.FieldData) ([]byte, error) {
+	switch req.Operation {
+	case logical.ReadOperation:
+		// Some clients URL-encode the request and some do not; spaces are
+		// what remains of an unescaped '+'.
+		base64Req := strings.ReplaceAll(data.Get(ocspReqParam).(string), " ", "+")
+		return base64.StdEncoding.DecodeString(base64Req)
+
+	case logical.UpdateOperation:
+		if req.HTTPRequest == nil || req.HTTPRequest.Body == nil {
+			return nil, fmt.Errorf("no data in request")
+		}
+
+		derReq, err := io.ReadAll(io.LimitReader(req.HTTPRequest.Body, maxOcspRequestSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(derReq) > maxOcspRequestSize {
+			return nil, fmt.Errorf("request exceeds %d bytes", maxOcspRequestSize)
+		}
+		return derReq, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", req.Operation)
+	}
+}
+
+func (b *backend) buildOcspResponse(ctx context.Context, s logical.Storage, config *crlConfig, ocspReq *ocsp.Request) ([]byte, error) {
+	issuerCerts, err := fetchIssuerCertificates(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	id, issuerCert, err := findOcspIssuer(ocspReq, issuerCerts)
+	if err != nil {
+		return nil, err
+	}
+
+	_, parsedBundle, err := fetchParsedCertBundleByIssuerID(ctx, s, id)
+	if err != nil {
+		if _, ok := err.(errutil.UserError); ok {
+			// Issuers without a key cannot sign responses.
+			return nil, errOcspUnknownIssuer
+		}
+		return nil, err
+	}
+
+	template, err := ocspCertStatus(ctx, s, id, issuerCert, ocspReq.SerialNumber.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template.SerialNumber = ocspReq.SerialNumber
+	template.IssuerHash = ocspReq.HashAlgorithm
+	template.ThisUpdate = now
+
+	expiry := defaultOcspExpiry
+	if config != nil && config.OcspExpiry != "" {
+		expiry, err = time.ParseDuration(config.OcspExpiry)
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("error parsing OCSP expiry: %s", err)}
+		}
+	}
+	if expiry > 0 {
+		template.NextUpdate = now.Add(expiry)
+	}
+
+	return ocsp.CreateResponse(issuerCert, issuerCert, *template, parsedBundle.PrivateKey)
+}
+
+// findOcspIssuer locates the issuer referenced by the name and key hashes of
+// the request.
+func findOcspIssuer(ocspReq *ocsp.Request, issuerCerts map[issuerID]*x509.Certificate) (issuerID, *x509.Certificate, error) {
+	if !ocspReq.HashAlgorithm.Available() {
+		return "", nil, errOcspUnknownIssuer
+	}
+
+	for id, issuerCert := range issuerCerts {
+		var spki struct {
+			Algorithm pkix.AlgorithmIdentifier
+			PublicKey asn1.BitString
+		}
+		if _, err := asn1.Unmarshal(issuerCert.RawSubjectPublicKeyInfo, &spki); err != nil {
+			continue
+		}
+
+		if bytes.Equal(ocspHash(ocspReq.HashAlgorithm, issuerCert.RawSubject), ocspReq.IssuerNameHash) &&
+			bytes.Equal(ocspHash(ocspReq.HashAlgorithm, spki.PublicKey.RightAlign()), ocspReq.IssuerKeyHash) {
+			return id, issuerCert, nil
+		}
+	}
+
+	return "", nil, errOcspUnknownIssuer
+}
+
+func ocspHash(hash crypto.Hash, value []byte) []byte {
+	h := hash.New()
+	h.Write(value)
+	return h.Sum(nil)
+}
+
+// ocspCertStatus looks the serial up in revocation storage and the issued
+// certificate store. Certificates issued by a different issuer of this mount
+// are reported as unknown.
+func ocspCertStatus(ctx context.Context, s logical.Storage, id issuerID, issuerCert *x509.Certificate, serialBytes []byte) (*ocsp.Response, error) {
+	serial := certutil.GetHexFormatted(serialBytes, ":")
+	req := &logical.Request{Storage: s}
+
+	revEntry, err := fetchCertBySerial(ctx, req, "revoked/", serial)
+	if err != nil {
+		return nil, err
+	}
+	if revEntry != nil {
+		var revInfo revocationInfo
+		if err := revEntry.DecodeJSON(&revInfo); err != nil {
+			return nil, fmt.Errorf("error decoding revocation entry for serial %s: %w", serial, err)
+		}
+
+		if revInfo.CertificateIssuer == id || (revInfo.CertificateIssuer == "" && isIssuedBy(revInfo.CertificateBytes, issuerCert)) {
+			revokedAt := revInfo.RevocationTimeUTC
+			if revokedAt.IsZero() {
+				revokedAt = time.Unix(revInfo.RevocationTime, 0).UTC()
+			}
+
+			return &ocsp.Response{
+				Status:           ocsp.Revoked,
+				RevokedAt:        revokedAt,
+				RevocationReason: ocsp.Unspecified,
+			}, nil
+		}
+
+		return &ocsp.Response{Status: ocsp.Unknown}, nil
+	}
+
+	certEntry, err := fetchCertBySerial(ctx, req, "certs/", serial)
+	if err != nil {
+		return nil, err
+	}
+	if certEntry != nil && isIssuedBy(certEntry.Value, issuerCert) {
+		return &ocsp.Response{Status: ocsp.Good}, nil
+	}
+
+	return &ocsp.Response{Status: ocsp.Unknown}, nil
+}
+
+func isIssuedBy(certBytes []byte, issuerCert *x509.Certificate) bool {
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(cert.RawIssuer, issuerCert.RawSubject) && cert.CheckSignatureFrom(issuerCert) == nil
+}
+
+const pathOcspHelpSyn = `
+Query the revocation status of a certificate through OCSP.
+`
+
+const pathOcspHelpDesc = `
+This endpoint implements an RFC 6960 OCSP responder for certificates issued
+by this mount. Requests may be sent either as a DER-encoded body with a
+Content-Type of "application/ocsp-request" to the ocsp endpoint, or base64
+encoded in the URL of a GET request to ocsp/<request>.
+
+Responses are signed by the issuer named in the request. Certificates which
+were not issued by that issuer, or which were issued without being stored
+("no_store"), are reported as unknown.
+
+To advertise this responder in issued certificates, add its URL (e.g.
+"https://vault.example.com:8200/v1/pki/ocsp") to "ocsp_servers" in
+config/urls.
+`
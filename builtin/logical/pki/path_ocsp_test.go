@@ -0,0 +1,184 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestPki_OcspResponder(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	requests := []*logical.Request{
+		{
+			Path: "root/generate/internal",
+			Data: map[string]interface{}{
+				"common_name": "root.example.com",
+				"ttl":         "48h",
+			},
+		},
+		{
+			Path: "config/urls",
+			Data: map[string]interface{}{
+				"ocsp_servers": "https://vault.example.com/v1/pki/ocsp",
+			},
+		},
+		{
+			Path: "roles/example",
+			Data: map[string]interface{}{
+				"allowed_domains":  "example.com",
+				"allow_subdomains": true,
+				"ttl":              "1h",
+			},
+		},
+	}
+	for _, req := range requests {
+		req.Operation = logical.UpdateOperation
+		req.Storage = storage
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %s: err: %v resp: %#v", req.Path, err, resp)
+		}
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "issue/example",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"common_name": "www.example.com",
+		},
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	cert, err := parseCertificateFromPEM(resp.Data["certificate"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := parseCertificateFromPEM(resp.Data["issuing_ca"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial := resp.Data["serial_number"].(string)
+
+	if len(cert.OCSPServer) != 1 || cert.OCSPServer[0] != "https://vault.example.com/v1/pki/ocsp" {
+		t.Fatalf("expected the OCSP responder in the AIA extension: %v", cert.OCSPServer)
+	}
+
+	queryGet := func(cert *x509.Certificate) *logical.Response {
+		der, err := ocsp.CreateRequest(cert, issuer, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "ocsp/" + base64.StdEncoding.EncodeToString(der),
+			Storage:   storage,
+		})
+		if err != nil || resp == nil {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		return resp
+	}
+
+	queryPost := func(cert *x509.Certificate) *logical.Response {
+		der, err := ocsp.CreateRequest(cert, issuer, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpReq := httptest.NewRequest(http.MethodPost, "/v1/pki/ocsp", bytes.NewReader(der))
+		httpReq.Header.Set("Content-Type", "application/ocsp-request")
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation:   logical.UpdateOperation,
+			Path:        "ocsp",
+			Storage:     storage,
+			HTTPRequest: httpReq,
+		})
+		if err != nil || resp == nil {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		return resp
+	}
+
+	parseResponse := func(resp *logical.Response, cert *x509.Certificate) *ocsp.Response {
+		if resp.Data[logical.HTTPStatusCode] != http.StatusOK || resp.Data[logical.HTTPContentType] != ocspResponseContentType {
+			t.Fatalf("unexpected OCSP response: %#v", resp.Data)
+		}
+		ocspResp, err := ocsp.ParseResponseForCert(resp.Data[logical.HTTPRawBody].([]byte), cert, issuer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ocspResp
+	}
+
+	if status := parseResponse(queryGet(cert), cert).Status; status != ocsp.Good {
+		t.Fatalf("expected good status, got %d", status)
+	}
+	if status := parseResponse(queryPost(cert), cert).Status; status != ocsp.Good {
+		t.Fatalf("expected good status, got %d", status)
+	}
+
+	// Serials this mount never issued are unknown
+	unknown := *cert
+	unknown.SerialNumber = big.NewInt(42)
+	if status := parseResponse(queryGet(&unknown), &unknown).Status; status != ocsp.Unknown {
+		t.Fatalf("expected unknown status, got %d", status)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "revoke",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"serial_number": serial,
+		},
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	ocspResp := parseResponse(queryPost(cert), cert)
+	if ocspResp.Status != ocsp.Revoked || ocspResp.RevokedAt.IsZero() {
+		t.Fatalf("expected revoked status, got %#v", ocspResp)
+	}
+	if ocspResp.NextUpdate.IsZero() {
+		t.Fatal("expected the response to carry a next update time")
+	}
+
+	// Garbage requests are malformed
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "ocsp/bm90IGFuIE9DU1AgcmVxdWVzdA==",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data[logical.HTTPStatusCode] != http.StatusBadRequest {
+		t.Fatalf("expected malformed request response: %#v", resp.Data)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/crl",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"ocsp_disable": true,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp := queryGet(cert); resp.Data[logical.HTTPStatusCode] != http.StatusUnauthorized {
+		t.Fatalf("expected disabled responder to refuse requests: %#v", resp.Data)
+	}
+}
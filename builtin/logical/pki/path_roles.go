@@ -11,6 +11,7 @@ import (
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/certutil"
 	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
@@ -349,6 +350,41 @@ non-sensitive, or extremely short-lived. This option implies a value of "false"
 for "generate_lease".`,
 			},
 
+			"store_metadata": {
+				Type: framework.TypeBool,
+				Description: `
+If set, the "cert_metadata" supplied when issuing or signing against this role
+is stored in the certificate index and returned by cert-metadata/<serial>.
+Cannot be combined with "no_store".`,
+			},
+
+			"subject_templates": {
+				Type: framework.TypeKVPairs,
+				Description: `
+A map of subject fields to identity templates, such as
+common_name={{identity.entity.aliases.<mount accessor>.name}}. Valid fields
+are common_name, serial_number, ou, organization, country, locality, province,
+street_address and postal_code. Derived values are populated from the
+requester's entity and replace the role's configured values; a requested
+common name or serial number which differs from the derived one is rejected.`,
+			},
+
+			"alt_names_templates": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `
+Identity templates for DNS or email Subject Alternative Names which are added
+to every certificate issued against this role. Names derived from templates
+are not checked against "allowed_domains".`,
+			},
+
+			"enforce_csr_profile": {
+				Type: framework.TypeBool,
+				Description: `
+If set, CSRs signed against this role are rejected unless every subject field,
+Subject Alternative Name, key usage and extended key usage they request
+matches the certificate the role will issue.`,
+			},
+
 			"require_cn": {
 				Type:        framework.TypeBool,
 				Default:     true,
@@ -383,6 +419,12 @@ for "generate_lease".`,
 				Description: `Set the not after field of the certificate with specified date value.
                               The value format should be given in UTC format YYYY-MM-ddTHH:MM:SSZ`,
 			},
+			issuerRefParam: {
+				Type:    framework.TypeString,
+				Default: defaultRef,
+				Description: `Reference to the issuer used to sign requests
+serviced by this role.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -496,6 +538,13 @@ func (b *backend) getRole(ctx context.Context, s logical.Storage, n string) (*ro
 		modified = true
 	}
 
+	// Roles created before multiple issuers were supported always signed
+	// with the mount's CA, which is now the default issuer.
+	if len(result.IssuerRef) == 0 {
+		result.IssuerRef = defaultRef
+		modified = true
+	}
+
 	if modified && (b.System().LocalMount() || !b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary)) {
 		jsonEntry, err := logical.StorageEntryJSON("role/"+n, &result)
 		if err != nil {
@@ -588,12 +637,17 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 		PostalCode:                    data.Get("postal_code").([]string),
 		GenerateLease:                 new(bool),
 		NoStore:                       data.Get("no_store").(bool),
+		StoreMetadata:                 data.Get("store_metadata").(bool),
+		SubjectTemplates:              data.Get("subject_templates").(map[string]string),
+		AltNamesTemplates:             data.Get("alt_names_templates").([]string),
+		EnforceCSRProfile:             data.Get("enforce_csr_profile").(bool),
 		RequireCN:                     data.Get("require_cn").(bool),
 		AllowedSerialNumbers:          data.Get("allowed_serial_numbers").([]string),
 		PolicyIdentifiers:             data.Get("policy_identifiers").([]string),
 		BasicConstraintsValidForNonCA: data.Get("basic_constraints_valid_for_non_ca").(bool),
 		NotBeforeDuration:             time.Duration(data.Get("not_before_duration").(int)) * time.Second,
 		NotAfter:                      data.Get("not_after").(string),
+		IssuerRef:                     data.Get(issuerRefParam).(string),
 	}
 
 	allowedOtherSANs := data.Get("allowed_other_sans").([]string)
@@ -615,6 +669,14 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 		*entry.GenerateLease = data.Get("generate_lease").(bool)
 	}
 
+	if entry.NoStore && entry.StoreMetadata {
+		return logical.ErrorResponse(`"store_metadata" cannot be set when "no_store" is set`), nil
+	}
+
+	if err := validateRoleTemplates(entry); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
 	if entry.KeyType == "rsa" && entry.KeyBits < 2048 {
 		return logical.ErrorResponse("RSA keys < 2048 bits are unsafe and not supported"), nil
 	}
@@ -647,6 +709,20 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 		}
 	}
 
+	if len(entry.IssuerRef) == 0 {
+		entry.IssuerRef = defaultRef
+	}
+	if entry.IssuerRef != defaultRef {
+		if _, err := resolveIssuerReference(ctx, req.Storage, entry.IssuerRef); err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				return logical.ErrorResponse(fmt.Sprintf("unable to resolve issuer_ref %q: %v", entry.IssuerRef, err)), nil
+			default:
+				return nil, err
+			}
+		}
+	}
+
 	// Store it
 	jsonEntry, err := logical.StorageEntryJSON("role/"+name, entry)
 	if err != nil {
@@ -739,58 +815,63 @@ func parseExtKeyUsages(role *roleEntry) certutil.CertExtKeyUsage {
 }
 
 type roleEntry struct {
-	LeaseMax                      string        `json:"lease_max"`
-	Lease                         string        `json:"lease"`
-	DeprecatedMaxTTL              string        `json:"max_ttl" mapstructure:"max_ttl"`
-	DeprecatedTTL                 string        `json:"ttl" mapstructure:"ttl"`
-	TTL                           time.Duration `json:"ttl_duration" mapstructure:"ttl_duration"`
-	MaxTTL                        time.Duration `json:"max_ttl_duration" mapstructure:"max_ttl_duration"`
-	AllowLocalhost                bool          `json:"allow_localhost" mapstructure:"allow_localhost"`
-	AllowedBaseDomain             string        `json:"allowed_base_domain" mapstructure:"allowed_base_domain"`
-	AllowedDomainsOld             string        `json:"allowed_domains,omitempty"`
-	AllowedDomains                []string      `json:"allowed_domains_list" mapstructure:"allowed_domains"`
-	AllowedDomainsTemplate        bool          `json:"allowed_domains_template"`
-	AllowBaseDomain               bool          `json:"allow_base_domain"`
-	AllowBareDomains              bool          `json:"allow_bare_domains" mapstructure:"allow_bare_domains"`
-	AllowTokenDisplayName         bool          `json:"allow_token_displayname" mapstructure:"allow_token_displayname"`
-	AllowSubdomains               bool          `json:"allow_subdomains" mapstructure:"allow_subdomains"`
-	AllowGlobDomains              bool          `json:"allow_glob_domains" mapstructure:"allow_glob_domains"`
-	AllowAnyName                  bool          `json:"allow_any_name" mapstructure:"allow_any_name"`
-	EnforceHostnames              bool          `json:"enforce_hostnames" mapstructure:"enforce_hostnames"`
-	AllowIPSANs                   bool          `json:"allow_ip_sans" mapstructure:"allow_ip_sans"`
-	ServerFlag                    bool          `json:"server_flag" mapstructure:"server_flag"`
-	ClientFlag                    bool          `json:"client_flag" mapstructure:"client_flag"`
-	CodeSigningFlag               bool          `json:"code_signing_flag" mapstructure:"code_signing_flag"`
-	EmailProtectionFlag           bool          `json:"email_protection_flag" mapstructure:"email_protection_flag"`
-	UseCSRCommonName              bool          `json:"use_csr_common_name" mapstructure:"use_csr_common_name"`
-	UseCSRSANs                    bool          `json:"use_csr_sans" mapstructure:"use_csr_sans"`
-	KeyType                       string        `json:"key_type" mapstructure:"key_type"`
-	KeyBits                       int           `json:"key_bits" mapstructure:"key_bits"`
-	SignatureBits                 int           `json:"signature_bits" mapstructure:"signature_bits"`
-	MaxPathLength                 *int          `json:",omitempty" mapstructure:"max_path_length"`
-	KeyUsageOld                   string        `json:"key_usage,omitempty"`
-	KeyUsage                      []string      `json:"key_usage_list" mapstructure:"key_usage"`
-	ExtKeyUsage                   []string      `json:"extended_key_usage_list" mapstructure:"extended_key_usage"`
-	OUOld                         string        `json:"ou,omitempty"`
-	OU                            []string      `json:"ou_list" mapstructure:"ou"`
-	OrganizationOld               string        `json:"organization,omitempty"`
-	Organization                  []string      `json:"organization_list" mapstructure:"organization"`
-	Country                       []string      `json:"country" mapstructure:"country"`
-	Locality                      []string      `json:"locality" mapstructure:"locality"`
-	Province                      []string      `json:"province" mapstructure:"province"`
-	StreetAddress                 []string      `json:"street_address" mapstructure:"street_address"`
-	PostalCode                    []string      `json:"postal_code" mapstructure:"postal_code"`
-	GenerateLease                 *bool         `json:"generate_lease,omitempty"`
-	NoStore                       bool          `json:"no_store" mapstructure:"no_store"`
-	RequireCN                     bool          `json:"require_cn" mapstructure:"require_cn"`
-	AllowedOtherSANs              []string      `json:"allowed_other_sans" mapstructure:"allowed_other_sans"`
-	AllowedSerialNumbers          []string      `json:"allowed_serial_numbers" mapstructure:"allowed_serial_numbers"`
-	AllowedURISANs                []string      `json:"allowed_uri_sans" mapstructure:"allowed_uri_sans"`
-	PolicyIdentifiers             []string      `json:"policy_identifiers" mapstructure:"policy_identifiers"`
-	ExtKeyUsageOIDs               []string      `json:"ext_key_usage_oids" mapstructure:"ext_key_usage_oids"`
-	BasicConstraintsValidForNonCA bool          `json:"basic_constraints_valid_for_non_ca" mapstructure:"basic_constraints_valid_for_non_ca"`
-	NotBeforeDuration             time.Duration `json:"not_before_duration" mapstructure:"not_before_duration"`
-	NotAfter                      string        `json:"not_after" mapstructure:"not_after"`
+	LeaseMax                      string            `json:"lease_max"`
+	Lease                         string            `json:"lease"`
+	DeprecatedMaxTTL              string            `json:"max_ttl" mapstructure:"max_ttl"`
+	DeprecatedTTL                 string            `json:"ttl" mapstructure:"ttl"`
+	TTL                           time.Duration     `json:"ttl_duration" mapstructure:"ttl_duration"`
+	MaxTTL                        time.Duration     `json:"max_ttl_duration" mapstructure:"max_ttl_duration"`
+	AllowLocalhost                bool              `json:"allow_localhost" mapstructure:"allow_localhost"`
+	AllowedBaseDomain             string            `json:"allowed_base_domain" mapstructure:"allowed_base_domain"`
+	AllowedDomainsOld             string            `json:"allowed_domains,omitempty"`
+	AllowedDomains                []string          `json:"allowed_domains_list" mapstructure:"allowed_domains"`
+	AllowedDomainsTemplate        bool              `json:"allowed_domains_template"`
+	AllowBaseDomain               bool              `json:"allow_base_domain"`
+	AllowBareDomains              bool              `json:"allow_bare_domains" mapstructure:"allow_bare_domains"`
+	AllowTokenDisplayName         bool              `json:"allow_token_displayname" mapstructure:"allow_token_displayname"`
+	AllowSubdomains               bool              `json:"allow_subdomains" mapstructure:"allow_subdomains"`
+	AllowGlobDomains              bool              `json:"allow_glob_domains" mapstructure:"allow_glob_domains"`
+	AllowAnyName                  bool              `json:"allow_any_name" mapstructure:"allow_any_name"`
+	EnforceHostnames              bool              `json:"enforce_hostnames" mapstructure:"enforce_hostnames"`
+	AllowIPSANs                   bool              `json:"allow_ip_sans" mapstructure:"allow_ip_sans"`
+	ServerFlag                    bool              `json:"server_flag" mapstructure:"server_flag"`
+	ClientFlag                    bool              `json:"client_flag" mapstructure:"client_flag"`
+	CodeSigningFlag               bool              `json:"code_signing_flag" mapstructure:"code_signing_flag"`
+	EmailProtectionFlag           bool              `json:"email_protection_flag" mapstructure:"email_protection_flag"`
+	UseCSRCommonName              bool              `json:"use_csr_common_name" mapstructure:"use_csr_common_name"`
+	UseCSRSANs                    bool              `json:"use_csr_sans" mapstructure:"use_csr_sans"`
+	KeyType                       string            `json:"key_type" mapstructure:"key_type"`
+	KeyBits                       int               `json:"key_bits" mapstructure:"key_bits"`
+	SignatureBits                 int               `json:"signature_bits" mapstructure:"signature_bits"`
+	MaxPathLength                 *int              `json:",omitempty" mapstructure:"max_path_length"`
+	KeyUsageOld                   string            `json:"key_usage,omitempty"`
+	KeyUsage                      []string          `json:"key_usage_list" mapstructure:"key_usage"`
+	ExtKeyUsage                   []string          `json:"extended_key_usage_list" mapstructure:"extended_key_usage"`
+	OUOld                         string            `json:"ou,omitempty"`
+	OU                            []string          `json:"ou_list" mapstructure:"ou"`
+	OrganizationOld               string            `json:"organization,omitempty"`
+	Organization                  []string          `json:"organization_list" mapstructure:"organization"`
+	Country                       []string          `json:"country" mapstructure:"country"`
+	Locality                      []string          `json:"locality" mapstructure:"locality"`
+	Province                      []string          `json:"province" mapstructure:"province"`
+	StreetAddress                 []string          `json:"street_address" mapstructure:"street_address"`
+	PostalCode                    []string          `json:"postal_code" mapstructure:"postal_code"`
+	GenerateLease                 *bool             `json:"generate_lease,omitempty"`
+	NoStore                       bool              `json:"no_store" mapstructure:"no_store"`
+	StoreMetadata                 bool              `json:"store_metadata" mapstructure:"store_metadata"`
+	SubjectTemplates              map[string]string `json:"subject_templates" mapstructure:"subject_templates"`
+	AltNamesTemplates             []string          `json:"alt_names_templates" mapstructure:"alt_names_templates"`
+	EnforceCSRProfile             bool              `json:"enforce_csr_profile" mapstructure:"enforce_csr_profile"`
+	RequireCN                     bool              `json:"require_cn" mapstructure:"require_cn"`
+	AllowedOtherSANs              []string          `json:"allowed_other_sans" mapstructure:"allowed_other_sans"`
+	AllowedSerialNumbers          []string          `json:"allowed_serial_numbers" mapstructure:"allowed_serial_numbers"`
+	AllowedURISANs                []string          `json:"allowed_uri_sans" mapstructure:"allowed_uri_sans"`
+	PolicyIdentifiers             []string          `json:"policy_identifiers" mapstructure:"policy_identifiers"`
+	ExtKeyUsageOIDs               []string          `json:"ext_key_usage_oids" mapstructure:"ext_key_usage_oids"`
+	BasicConstraintsValidForNonCA bool              `json:"basic_constraints_valid_for_non_ca" mapstructure:"basic_constraints_valid_for_non_ca"`
+	NotBeforeDuration             time.Duration     `json:"not_before_duration" mapstructure:"not_before_duration"`
+	NotAfter                      string            `json:"not_after" mapstructure:"not_after"`
+	IssuerRef                     string            `json:"issuer_ref" mapstructure:"issuer_ref"`
 	// Used internally for signing intermediates
 	AllowExpirationPastCA bool
 }
@@ -829,6 +910,10 @@ func (r *roleEntry) ToResponseData() map[string]interface{} {
 		"street_address":                     r.StreetAddress,
 		"postal_code":                        r.PostalCode,
 		"no_store":                           r.NoStore,
+		"store_metadata":                     r.StoreMetadata,
+		"subject_templates":                  r.SubjectTemplates,
+		"alt_names_templates":                r.AltNamesTemplates,
+		"enforce_csr_profile":                r.EnforceCSRProfile,
 		"allowed_other_sans":                 r.AllowedOtherSANs,
 		"allowed_serial_numbers":             r.AllowedSerialNumbers,
 		"allowed_uri_sans":                   r.AllowedURISANs,
@@ -837,6 +922,7 @@ func (r *roleEntry) ToResponseData() map[string]interface{} {
 		"basic_constraints_valid_for_non_ca": r.BasicConstraintsValidForNonCA,
 		"not_before_duration":                int64(r.NotBeforeDuration.Seconds()),
 		"not_after":                          r.NotAfter,
+		"issuer_ref":                         r.IssuerRef,
 	}
 	if r.MaxPathLength != nil {
 		responseData["max_path_length"] = r.MaxPathLength
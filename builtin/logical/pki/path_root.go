@@ -25,8 +25,22 @@ import (
 )
 
 func pathGenerateRoot(b *backend) *framework.Path {
+	return buildPathGenerateRoot(b, "root/generate/"+framework.GenericNameRegex("exported"))
+}
+
+func pathIssuerGenerateRoot(b *backend) *framework.Path {
+	ret := buildPathGenerateRoot(b, "issuers/generate/root/"+framework.GenericNameRegex("exported"))
+	ret.Fields = addIssuerNameField(ret.Fields)
+	ret.Fields = addKeyNameField(ret.Fields)
+	ret.HelpSynopsis = pathIssuerGenerateRootHelpSyn
+	ret.HelpDescription = pathIssuerGenerateRootHelpDesc
+
+	return ret
+}
+
+func buildPathGenerateRoot(b *backend, pattern string) *framework.Path {
 	ret := &framework.Path{
-		Pattern: "root/generate/" + framework.GenericNameRegex("exported"),
+		Pattern: pattern,
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.UpdateOperation: b.pathCAGenerateRoot,
@@ -59,8 +73,19 @@ func pathDeleteRoot(b *backend) *framework.Path {
 }
 
 func pathSignIntermediate(b *backend) *framework.Path {
+	return buildPathSignIntermediate(b, "root/sign-intermediate")
+}
+
+func pathIssuerSignIntermediate(b *backend) *framework.Path {
+	ret := buildPathSignIntermediate(b, "issuer/"+framework.GenericNameRegex(issuerRefParam)+"/sign-intermediate")
+	ret.Fields = addIssuerRefField(ret.Fields)
+
+	return ret
+}
+
+func buildPathSignIntermediate(b *backend, pattern string) *framework.Path {
 	ret := &framework.Path{
-		Pattern: "root/sign-intermediate",
+		Pattern: pattern,
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.UpdateOperation: b.pathCASignIntermediate,
@@ -97,8 +122,19 @@ the non-repudiation flag.`,
 }
 
 func pathSignSelfIssued(b *backend) *framework.Path {
+	return buildPathSignSelfIssued(b, "root/sign-self-issued")
+}
+
+func pathIssuerSignSelfIssued(b *backend) *framework.Path {
+	ret := buildPathSignSelfIssued(b, "issuer/"+framework.GenericNameRegex(issuerRefParam)+"/sign-self-issued")
+	ret.Fields = addIssuerRefField(ret.Fields)
+
+	return ret
+}
+
+func buildPathSignSelfIssued(b *backend, pattern string) *framework.Path {
 	ret := &framework.Path{
-		Pattern: "root/sign-self-issued",
+		Pattern: pattern,
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.UpdateOperation: b.pathCASignSelfIssued,
@@ -124,20 +160,62 @@ func pathSignSelfIssued(b *backend) *framework.Path {
 }
 
 func (b *backend) pathCADeleteRoot(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return nil, req.Storage.Delete(ctx, "config/ca_bundle")
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	issuers, err := listIssuers(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range issuers {
+		if _, err := deleteIssuer(ctx, req.Storage, id); err != nil {
+			return nil, err
+		}
+	}
+
+	keys, err := listKeys(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range keys {
+		if _, err := deleteKey(ctx, req.Storage, id); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, legacyPath := range []string{legacyCertPath, legacyCRLPath} {
+		if err := req.Storage.Delete(ctx, legacyPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, req.Storage.Delete(ctx, legacyCertBundlePath)
 }
 
 func (b *backend) pathCAGenerateRoot(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	var err error
 
-	entry, err := req.Storage.Get(ctx, "config/ca_bundle")
-	if err != nil {
-		return nil, err
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	// The legacy path only ever manages a single root; the issuers/ path
+	// adds a new issuer alongside any existing ones.
+	isLegacyPath := strings.HasPrefix(req.Path, "root/generate/")
+	if isLegacyPath {
+		config, err := getIssuersConfig(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		if len(config.DefaultIssuerID) > 0 {
+			resp := &logical.Response{}
+			resp.AddWarning(fmt.Sprintf("Refusing to generate a root certificate over an existing root certificate. If you really want to destroy the original root certificate, please issue a delete against %sroot. To add another root alongside the existing one, use %sissuers/generate/root.", req.MountPoint, req.MountPoint))
+			return resp, nil
+		}
 	}
-	if entry != nil {
-		resp := &logical.Response{}
-		resp.AddWarning(fmt.Sprintf("Refusing to generate a root certificate over an existing root certificate. If you really want to destroy the original root certificate, please issue a delete against %sroot.", req.MountPoint))
-		return resp, nil
+
+	issuerName, keyName, errorResp := getIssuerAndKeyNames(data)
+	if errorResp != nil {
+		return errorResp, nil
 	}
 
 	exported, format, role, errorResp := b.getGenerationParams(data)
@@ -214,15 +292,28 @@ func (b *backend) pathCAGenerateRoot(ctx context.Context, req *logical.Request,
 		}
 	}
 
-	// Store it as the CA bundle
-	entry, err = logical.StorageEntryJSON("config/ca_bundle", cb)
+	// Store it as a new issuer and key
+	myIssuer, myKey, err := writeCaBundle(ctx, req.Storage, cb, issuerName, keyName)
 	if err != nil {
-		return nil, err
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
 	}
-	err = req.Storage.Put(ctx, entry)
-	if err != nil {
-		return nil, err
+	if myKey == nil {
+		// An existing key isn't imported again, but was linked to the
+		// issuer when it was stored.
+		myKey, err = fetchKeyByID(ctx, req.Storage, myIssuer.KeyID)
+		if err != nil {
+			return nil, err
+		}
 	}
+	resp.Data["issuer_id"] = myIssuer.ID
+	resp.Data["issuer_name"] = myIssuer.Name
+	resp.Data["key_id"] = myKey.ID
+	resp.Data["key_name"] = myKey.Name
 
 	// Also store it as just the certificate identified by serial number, so it
 	// can be revoked
@@ -234,15 +325,6 @@ func (b *backend) pathCAGenerateRoot(ctx context.Context, req *logical.Request,
 		return nil, fmt.Errorf("unable to store certificate locally: %w", err)
 	}
 
-	// For ease of later use, also store just the certificate at a known
-	// location
-	entry.Key = "ca"
-	entry.Value = parsedBundle.CertificateBytes
-	err = req.Storage.Put(ctx, entry)
-	if err != nil {
-		return nil, err
-	}
-
 	// Build a fresh CRL
 	err = buildCRL(ctx, b, req, true)
 	if err != nil {
@@ -291,7 +373,7 @@ func (b *backend) pathCASignIntermediate(ctx context.Context, req *logical.Reque
 	}
 
 	var caErr error
-	signingBundle, caErr := fetchCAInfo(ctx, req)
+	signingBundle, caErr := fetchCAInfo(ctx, req, getIssuerRef(data))
 	switch caErr.(type) {
 	case errutil.UserError:
 		return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -417,7 +499,7 @@ func (b *backend) pathCASignSelfIssued(ctx context.Context, req *logical.Request
 	}
 
 	var caErr error
-	signingBundle, caErr := fetchCAInfo(ctx, req)
+	signingBundle, caErr := fetchCAInfo(ctx, req, getIssuerRef(data))
 	switch caErr.(type) {
 	case errutil.UserError:
 		return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -518,12 +600,23 @@ const pathGenerateRootHelpDesc = `
 See the API documentation for more information.
 `
 
+const pathIssuerGenerateRootHelpSyn = `
+Generate a new root CA certificate and private key, adding them as a new issuer and key.
+`
+
+const pathIssuerGenerateRootHelpDesc = `
+Unlike root/generate, this path does not refuse to run when the mount already
+has a CA; the new root is added alongside any existing issuers, allowing roots
+to be rotated in place. The new issuer becomes the default only if there was
+no default issuer previously; use config/issuers to change the default.
+`
+
 const pathDeleteRootHelpSyn = `
 Deletes the root CA key to allow a new one to be generated.
 `
 
 const pathDeleteRootHelpDesc = `
-See the API documentation for more information.
+Deletes all issuers and keys of this mount. See the API documentation for more information.
 `
 
 const pathSignIntermediateHelpSyn = `
@@ -3,48 +3,55 @@ package pki
 import (
 	"context"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync/atomic"
 	"time"
 
 	"github.com/armon/go-metrics"
+	hclog "github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
+// errTidyCancelled is returned by the tidy phases once a running tidy
+// operation has been cancelled through tidy-cancel.
+var errTidyCancelled = errors.New("tidy operation cancelled")
+
+// tidyConfig describes what a tidy operation cleans up. It is built from the
+// request for manual tidies, and stored at config/auto-tidy for automatic
+// ones.
+type tidyConfig struct {
+	Enabled            bool          `json:"enabled"`
+	Interval           time.Duration `json:"interval_duration"`
+	CertStore          bool          `json:"tidy_cert_store"`
+	RevokedCerts       bool          `json:"tidy_revoked_certs"`
+	ExpiredIssuers     bool          `json:"tidy_expired_issuers"`
+	SafetyBuffer       time.Duration `json:"safety_buffer"`
+	IssuerSafetyBuffer time.Duration `json:"issuer_safety_buffer"`
+}
+
+var defaultTidyConfig = tidyConfig{
+	Enabled:            false,
+	Interval:           12 * time.Hour,
+	CertStore:          false,
+	RevokedCerts:       false,
+	ExpiredIssuers:     false,
+	SafetyBuffer:       72 * time.Hour,
+	IssuerSafetyBuffer: 365 * 24 * time.Hour,
+}
+
 func pathTidy(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "tidy$",
-		Fields: map[string]*framework.FieldSchema{
-			"tidy_cert_store": {
-				Type: framework.TypeBool,
-				Description: `Set to true to enable tidying up
-the certificate store`,
-			},
-
+		Fields: addTidyFields(map[string]*framework.FieldSchema{
 			"tidy_revocation_list": {
 				Type:        framework.TypeBool,
 				Description: `Deprecated; synonym for 'tidy_revoked_certs`,
 			},
-
-			"tidy_revoked_certs": {
-				Type: framework.TypeBool,
-				Description: `Set to true to expire all revoked
-and expired certificates, removing them both from the CRL and from storage. The
-CRL will be rotated if this causes any values to be removed.`,
-			},
-
-			"safety_buffer": {
-				Type: framework.TypeDurationSecond,
-				Description: `The amount of extra time that must have passed
-beyond certificate expiration before it is removed
-from the backend storage and/or revocation list.
-Defaults to 72 hours.`,
-				Default: 259200, // 72h, but TypeDurationSecond currently requires defaults to be int
-			},
-		},
+		}),
 
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.UpdateOperation: &framework.PathOperation{
@@ -72,24 +79,62 @@ func pathTidyStatus(b *backend) *framework.Path {
 	}
 }
 
+func pathTidyCancel(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "tidy-cancel$",
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                  b.pathTidyCancelWrite,
+				ForwardPerformanceStandby: true,
+			},
+		},
+		HelpSynopsis:    pathTidyCancelHelpSyn,
+		HelpDescription: pathTidyCancelHelpDesc,
+	}
+}
+
 func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	safetyBuffer := d.Get("safety_buffer").(int)
+	issuerSafetyBuffer := d.Get("issuer_safety_buffer").(int)
 	tidyCertStore := d.Get("tidy_cert_store").(bool)
 	tidyRevokedCerts := d.Get("tidy_revoked_certs").(bool)
 	tidyRevocationList := d.Get("tidy_revocation_list").(bool)
+	tidyExpiredIssuers := d.Get("tidy_expired_issuers").(bool)
 
 	if safetyBuffer < 1 {
 		return logical.ErrorResponse("safety_buffer must be greater than zero"), nil
 	}
+	if issuerSafetyBuffer < 1 {
+		return logical.ErrorResponse("issuer_safety_buffer must be greater than zero"), nil
+	}
 
-	bufferDuration := time.Duration(safetyBuffer) * time.Second
+	config := &tidyConfig{
+		CertStore:          tidyCertStore,
+		RevokedCerts:       tidyRevokedCerts || tidyRevocationList,
+		ExpiredIssuers:     tidyExpiredIssuers,
+		SafetyBuffer:       time.Duration(safetyBuffer) * time.Second,
+		IssuerSafetyBuffer: time.Duration(issuerSafetyBuffer) * time.Second,
+	}
 
-	if !atomic.CompareAndSwapUint32(b.tidyCASGuard, 0, 1) {
+	if !b.startTidyOperation(req, config) {
 		resp := &logical.Response{}
 		resp.AddWarning("Tidy operation already in progress.")
 		return resp, nil
 	}
 
+	resp := &logical.Response{}
+	resp.AddWarning("Tidy operation successfully started. Any information from the operation will be printed to Vault's server logs.")
+	return logical.RespondWithStatusCode(resp, req, http.StatusAccepted)
+}
+
+// startTidyOperation runs a tidy operation with the given configuration in
+// the background, returning false if one is already running.
+func (b *backend) startTidyOperation(req *logical.Request, config *tidyConfig) bool {
+	if !atomic.CompareAndSwapUint32(b.tidyCASGuard, 0, 1) {
+		return false
+	}
+	atomic.StoreUint32(b.tidyCancelCASGuard, 0)
+
 	// Tests using framework will screw up the storage so make a locally
 	// scoped req to hold a reference
 	req = &logical.Request{
@@ -99,135 +144,29 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 	go func() {
 		defer atomic.StoreUint32(b.tidyCASGuard, 0)
 
-		b.tidyStatusStart(safetyBuffer, tidyCertStore, tidyRevokedCerts || tidyRevocationList)
+		b.tidyStatusStart(config)
 
 		// Don't cancel when the original client request goes away
-		ctx = context.Background()
+		ctx := context.Background()
 
 		logger := b.Logger().Named("tidy")
 
 		doTidy := func() error {
-			if tidyCertStore {
-				serials, err := req.Storage.List(ctx, "certs/")
-				if err != nil {
-					return fmt.Errorf("error fetching list of certs: %w", err)
-				}
-
-				serialCount := len(serials)
-				metrics.SetGauge([]string{"secrets", "pki", "tidy", "cert_store_total_entries"}, float32(serialCount))
-				for i, serial := range serials {
-					b.tidyStatusMessage(fmt.Sprintf("Tidying certificate store: checking entry %d of %d", i, serialCount))
-					metrics.SetGauge([]string{"secrets", "pki", "tidy", "cert_store_current_entry"}, float32(i))
-
-					certEntry, err := req.Storage.Get(ctx, "certs/"+serial)
-					if err != nil {
-						return fmt.Errorf("error fetching certificate %q: %w", serial, err)
-					}
-
-					if certEntry == nil {
-						logger.Warn("certificate entry is nil; tidying up since it is no longer useful for any server operations", "serial", serial)
-						if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
-							return fmt.Errorf("error deleting nil entry with serial %s: %w", serial, err)
-						}
-						b.tidyStatusIncCertStoreCount()
-						continue
-					}
-
-					if certEntry.Value == nil || len(certEntry.Value) == 0 {
-						logger.Warn("certificate entry has no value; tidying up since it is no longer useful for any server operations", "serial", serial)
-						if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
-							return fmt.Errorf("error deleting entry with nil value with serial %s: %w", serial, err)
-						}
-						b.tidyStatusIncCertStoreCount()
-						continue
-					}
-
-					cert, err := x509.ParseCertificate(certEntry.Value)
-					if err != nil {
-						return fmt.Errorf("unable to parse stored certificate with serial %q: %w", serial, err)
-					}
-
-					if time.Now().After(cert.NotAfter.Add(bufferDuration)) {
-						if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
-							return fmt.Errorf("error deleting serial %q from storage: %w", serial, err)
-						}
-						b.tidyStatusIncCertStoreCount()
-					}
+			if config.CertStore {
+				if err := b.doTidyCertStore(ctx, req, logger, config); err != nil {
+					return err
 				}
 			}
 
-			if tidyRevokedCerts || tidyRevocationList {
-				b.revokeStorageLock.Lock()
-				defer b.revokeStorageLock.Unlock()
-
-				rebuildCRL := false
-
-				revokedSerials, err := req.Storage.List(ctx, "revoked/")
-				if err != nil {
-					return fmt.Errorf("error fetching list of revoked certs: %w", err)
-				}
-
-				revokedSerialsCount := len(revokedSerials)
-				metrics.SetGauge([]string{"secrets", "pki", "tidy", "revoked_cert_total_entries"}, float32(revokedSerialsCount))
-
-				var revInfo revocationInfo
-				for i, serial := range revokedSerials {
-					b.tidyStatusMessage(fmt.Sprintf("Tidying revoked certificates: checking certificate %d of %d", i, len(revokedSerials)))
-					metrics.SetGauge([]string{"secrets", "pki", "tidy", "revoked_cert_current_entry"}, float32(i))
-
-					revokedEntry, err := req.Storage.Get(ctx, "revoked/"+serial)
-					if err != nil {
-						return fmt.Errorf("unable to fetch revoked cert with serial %q: %w", serial, err)
-					}
-
-					if revokedEntry == nil {
-						logger.Warn("revoked entry is nil; tidying up since it is no longer useful for any server operations", "serial", serial)
-						if err := req.Storage.Delete(ctx, "revoked/"+serial); err != nil {
-							return fmt.Errorf("error deleting nil revoked entry with serial %s: %w", serial, err)
-						}
-						b.tidyStatusIncRevokedCertCount()
-						continue
-					}
-
-					if revokedEntry.Value == nil || len(revokedEntry.Value) == 0 {
-						logger.Warn("revoked entry has nil value; tidying up since it is no longer useful for any server operations", "serial", serial)
-						if err := req.Storage.Delete(ctx, "revoked/"+serial); err != nil {
-							return fmt.Errorf("error deleting revoked entry with nil value with serial %s: %w", serial, err)
-						}
-						b.tidyStatusIncRevokedCertCount()
-						continue
-					}
-
-					err = revokedEntry.DecodeJSON(&revInfo)
-					if err != nil {
-						return fmt.Errorf("error decoding revocation entry for serial %q: %w", serial, err)
-					}
-
-					revokedCert, err := x509.ParseCertificate(revInfo.CertificateBytes)
-					if err != nil {
-						return fmt.Errorf("unable to parse stored revoked certificate with serial %q: %w", serial, err)
-					}
-
-					// Only remove the entries from revoked/ and certs/ if we're
-					// past its NotAfter value. This is because we use the
-					// information on revoked/ to build the CRL and the
-					// information on certs/ for lookup.
-					if time.Now().After(revokedCert.NotAfter.Add(bufferDuration)) {
-						if err := req.Storage.Delete(ctx, "revoked/"+serial); err != nil {
-							return fmt.Errorf("error deleting serial %q from revoked list: %w", serial, err)
-						}
-						if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
-							return fmt.Errorf("error deleting serial %q from store when tidying revoked: %w", serial, err)
-						}
-						rebuildCRL = true
-						b.tidyStatusIncRevokedCertCount()
-					}
+			if config.RevokedCerts {
+				if err := b.doTidyRevocationStore(ctx, req, logger, config); err != nil {
+					return err
 				}
+			}
 
-				if rebuildCRL {
-					if err := buildCRL(ctx, b, req, false); err != nil {
-						return err
-					}
+			if config.ExpiredIssuers {
+				if err := b.doTidyExpiredIssuers(ctx, req, logger, config); err != nil {
+					return err
 				}
 			}
 
@@ -235,16 +174,259 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 		}
 
 		if err := doTidy(); err != nil {
-			logger.Error("error running tidy", "error", err)
+			if err == errTidyCancelled {
+				logger.Info("tidy operation cancelled")
+			} else {
+				logger.Error("error running tidy", "error", err)
+			}
 			b.tidyStatusStop(err)
 		} else {
 			b.tidyStatusStop(nil)
 		}
 	}()
 
-	resp := &logical.Response{}
-	resp.AddWarning("Tidy operation successfully started. Any information from the operation will be printed to Vault's server logs.")
-	return logical.RespondWithStatusCode(resp, req, http.StatusAccepted)
+	return true
+}
+
+// tidyCancelled reports whether the running tidy operation has been asked to
+// stop; the tidy phases check it before each storage entry.
+func (b *backend) tidyCancelled() bool {
+	return atomic.LoadUint32(b.tidyCancelCASGuard) == 1
+}
+
+func (b *backend) doTidyCertStore(ctx context.Context, req *logical.Request, logger hclog.Logger, config *tidyConfig) error {
+	serials, err := req.Storage.List(ctx, "certs/")
+	if err != nil {
+		return fmt.Errorf("error fetching list of certs: %w", err)
+	}
+
+	serialCount := len(serials)
+	metrics.SetGauge([]string{"secrets", "pki", "tidy", "cert_store_total_entries"}, float32(serialCount))
+	b.tidyStatusSetCertStoreTotal(serialCount)
+	for i, serial := range serials {
+		if b.tidyCancelled() {
+			return errTidyCancelled
+		}
+
+		b.tidyStatusMessage(fmt.Sprintf("Tidying certificate store: checking entry %d of %d", i, serialCount))
+		metrics.SetGauge([]string{"secrets", "pki", "tidy", "cert_store_current_entry"}, float32(i))
+
+		certEntry, err := req.Storage.Get(ctx, "certs/"+serial)
+		if err != nil {
+			return fmt.Errorf("error fetching certificate %q: %w", serial, err)
+		}
+
+		if certEntry == nil {
+			logger.Warn("certificate entry is nil; tidying up since it is no longer useful for any server operations", "serial", serial)
+			if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
+				return fmt.Errorf("error deleting nil entry with serial %s: %w", serial, err)
+			}
+			b.tidyStatusIncCertStoreCount()
+			continue
+		}
+
+		if certEntry.Value == nil || len(certEntry.Value) == 0 {
+			logger.Warn("certificate entry has no value; tidying up since it is no longer useful for any server operations", "serial", serial)
+			if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
+				return fmt.Errorf("error deleting entry with nil value with serial %s: %w", serial, err)
+			}
+			b.tidyStatusIncCertStoreCount()
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(certEntry.Value)
+		if err != nil {
+			return fmt.Errorf("unable to parse stored certificate with serial %q: %w", serial, err)
+		}
+
+		if time.Now().After(cert.NotAfter.Add(config.SafetyBuffer)) {
+			if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
+				return fmt.Errorf("error deleting serial %q from storage: %w", serial, err)
+			}
+			if err := req.Storage.Delete(ctx, certMetadataPrefix+serial); err != nil {
+				return fmt.Errorf("error deleting metadata of serial %q from storage: %w", serial, err)
+			}
+			b.tidyStatusIncCertStoreCount()
+		}
+	}
+
+	return nil
+}
+
+func (b *backend) doTidyRevocationStore(ctx context.Context, req *logical.Request, logger hclog.Logger, config *tidyConfig) error {
+	b.revokeStorageLock.Lock()
+	defer b.revokeStorageLock.Unlock()
+
+	rebuildCRL := false
+
+	revokedSerials, err := req.Storage.List(ctx, "revoked/")
+	if err != nil {
+		return fmt.Errorf("error fetching list of revoked certs: %w", err)
+	}
+
+	revokedSerialsCount := len(revokedSerials)
+	metrics.SetGauge([]string{"secrets", "pki", "tidy", "revoked_cert_total_entries"}, float32(revokedSerialsCount))
+	b.tidyStatusSetRevokedCertTotal(revokedSerialsCount)
+
+	var revInfo revocationInfo
+	for i, serial := range revokedSerials {
+		if b.tidyCancelled() {
+			// Entries removed so far must still be dropped from the CRL
+			break
+		}
+
+		b.tidyStatusMessage(fmt.Sprintf("Tidying revoked certificates: checking certificate %d of %d", i, len(revokedSerials)))
+		metrics.SetGauge([]string{"secrets", "pki", "tidy", "revoked_cert_current_entry"}, float32(i))
+
+		revokedEntry, err := req.Storage.Get(ctx, "revoked/"+serial)
+		if err != nil {
+			return fmt.Errorf("unable to fetch revoked cert with serial %q: %w", serial, err)
+		}
+
+		if revokedEntry == nil {
+			logger.Warn("revoked entry is nil; tidying up since it is no longer useful for any server operations", "serial", serial)
+			if err := req.Storage.Delete(ctx, "revoked/"+serial); err != nil {
+				return fmt.Errorf("error deleting nil revoked entry with serial %s: %w", serial, err)
+			}
+			b.tidyStatusIncRevokedCertCount()
+			continue
+		}
+
+		if revokedEntry.Value == nil || len(revokedEntry.Value) == 0 {
+			logger.Warn("revoked entry has nil value; tidying up since it is no longer useful for any server operations", "serial", serial)
+			if err := req.Storage.Delete(ctx, "revoked/"+serial); err != nil {
+				return fmt.Errorf("error deleting revoked entry with nil value with serial %s: %w", serial, err)
+			}
+			b.tidyStatusIncRevokedCertCount()
+			continue
+		}
+
+		err = revokedEntry.DecodeJSON(&revInfo)
+		if err != nil {
+			return fmt.Errorf("error decoding revocation entry for serial %q: %w", serial, err)
+		}
+
+		revokedCert, err := x509.ParseCertificate(revInfo.CertificateBytes)
+		if err != nil {
+			return fmt.Errorf("unable to parse stored revoked certificate with serial %q: %w", serial, err)
+		}
+
+		// Only remove the entries from revoked/ and certs/ if we're
+		// past its NotAfter value. This is because we use the
+		// information on revoked/ to build the CRL and the
+		// information on certs/ for lookup.
+		if time.Now().After(revokedCert.NotAfter.Add(config.SafetyBuffer)) {
+			if err := req.Storage.Delete(ctx, "revoked/"+serial); err != nil {
+				return fmt.Errorf("error deleting serial %q from revoked list: %w", serial, err)
+			}
+			if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
+				return fmt.Errorf("error deleting serial %q from store when tidying revoked: %w", serial, err)
+			}
+			if err := req.Storage.Delete(ctx, certMetadataPrefix+serial); err != nil {
+				return fmt.Errorf("error deleting metadata of serial %q when tidying revoked: %w", serial, err)
+			}
+			rebuildCRL = true
+			b.tidyStatusIncRevokedCertCount()
+		}
+	}
+
+	if rebuildCRL {
+		if err := buildCRL(ctx, b, req, false); err != nil {
+			return err
+		}
+	}
+
+	if b.tidyCancelled() {
+		return errTidyCancelled
+	}
+
+	return nil
+}
+
+func (b *backend) doTidyExpiredIssuers(ctx context.Context, req *logical.Request, logger hclog.Logger, config *tidyConfig) error {
+	// Issuers are shared across a performance replication cluster, so only
+	// the primary may remove them.
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary) && !b.System().LocalMount() {
+		logger.Debug("skipping expired issuer cleanup on performance secondary")
+		return nil
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	issuersConfig, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return fmt.Errorf("error fetching issuers configuration: %w", err)
+	}
+
+	issuers, err := listIssuers(ctx, req.Storage)
+	if err != nil {
+		return fmt.Errorf("error fetching list of issuers: %w", err)
+	}
+
+	issuerCount := len(issuers)
+	deletedIssuers := false
+	for i, id := range issuers {
+		if b.tidyCancelled() {
+			break
+		}
+
+		b.tidyStatusMessage(fmt.Sprintf("Tidying issuers: checking issuer %d of %d", i, issuerCount))
+
+		issuer, err := fetchIssuerByID(ctx, req.Storage, id)
+		if err != nil {
+			return fmt.Errorf("error fetching issuer %v: %w", id, err)
+		}
+
+		cert, err := issuer.GetCertificate()
+		if err != nil {
+			return fmt.Errorf("unable to parse certificate of issuer %v: %w", id, err)
+		}
+
+		if !time.Now().After(cert.NotAfter.Add(config.IssuerSafetyBuffer)) {
+			continue
+		}
+
+		if id == issuersConfig.DefaultIssuerID {
+			logger.Warn("default issuer has expired; not removing it", "issuer_id", id)
+			continue
+		}
+
+		if _, err := deleteIssuer(ctx, req.Storage, id); err != nil {
+			return fmt.Errorf("error deleting expired issuer %v: %w", id, err)
+		}
+		deletedIssuers = true
+		b.tidyStatusIncIssuerCount()
+	}
+
+	if deletedIssuers {
+		if err := rebuildIssuersChains(ctx, req.Storage); err != nil {
+			return err
+		}
+		if err := buildCRL(ctx, b, req, false); err != nil {
+			return err
+		}
+	}
+
+	if b.tidyCancelled() {
+		return errTidyCancelled
+	}
+
+	return nil
+}
+
+func (b *backend) pathTidyCancelWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if atomic.LoadUint32(b.tidyCASGuard) == 0 {
+		return logical.ErrorResponse("Tidy operation cannot be cancelled as none is currently running."), nil
+	}
+
+	// The tidy operation checks this flag before each entry and stops
+	// once it is set.
+	if atomic.CompareAndSwapUint32(b.tidyCancelCASGuard, 0, 1) {
+		b.tidyStatusCancelling()
+	}
+
+	return b.pathTidyStatusRead(ctx, req, d)
 }
 
 func (b *backend) pathTidyStatusRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
@@ -260,15 +442,21 @@ func (b *backend) pathTidyStatusRead(ctx context.Context, req *logical.Request,
 	resp := &logical.Response{
 		Data: map[string]interface{}{
 			"safety_buffer":              nil,
+			"issuer_safety_buffer":       nil,
 			"tidy_cert_store":            nil,
 			"tidy_revoked_certs":         nil,
+			"tidy_expired_issuers":       nil,
+			"auto_tidy":                  nil,
 			"state":                      "Inactive",
 			"error":                      nil,
 			"time_started":               nil,
 			"time_finished":              nil,
 			"message":                    nil,
+			"cert_store_total_count":     nil,
+			"revoked_cert_total_count":   nil,
 			"cert_store_deleted_count":   nil,
 			"revoked_cert_deleted_count": nil,
+			"issuer_deleted_count":       nil,
 		},
 	}
 
@@ -277,16 +465,27 @@ func (b *backend) pathTidyStatusRead(ctx context.Context, req *logical.Request,
 	}
 
 	resp.Data["safety_buffer"] = b.tidyStatus.safetyBuffer
+	resp.Data["issuer_safety_buffer"] = b.tidyStatus.issuerSafetyBuffer
 	resp.Data["tidy_cert_store"] = b.tidyStatus.tidyCertStore
 	resp.Data["tidy_revoked_certs"] = b.tidyStatus.tidyRevokedCerts
+	resp.Data["tidy_expired_issuers"] = b.tidyStatus.tidyExpiredIssuers
+	resp.Data["auto_tidy"] = b.tidyStatus.autoTidy
 	resp.Data["time_started"] = b.tidyStatus.timeStarted
 	resp.Data["message"] = b.tidyStatus.message
+	resp.Data["cert_store_total_count"] = b.tidyStatus.certStoreTotalCount
+	resp.Data["revoked_cert_total_count"] = b.tidyStatus.revokedCertTotalCount
 	resp.Data["cert_store_deleted_count"] = b.tidyStatus.certStoreDeletedCount
 	resp.Data["revoked_cert_deleted_count"] = b.tidyStatus.revokedCertDeletedCount
+	resp.Data["issuer_deleted_count"] = b.tidyStatus.issuerDeletedCount
 
 	switch(b.tidyStatus.state) {
 	case tidyStatusStarted:
 		resp.Data["state"] = "Running"
+	case tidyStatusCancelling:
+		resp.Data["state"] = "Cancelling"
+	case tidyStatusCancelled:
+		resp.Data["state"] = "Cancelled"
+		resp.Data["time_finished"] = b.tidyStatus.timeFinished
 	case tidyStatusFinished:
 		resp.Data["state"] = "Finished"
 		resp.Data["time_finished"] = b.tidyStatus.timeFinished
@@ -302,16 +501,19 @@ func (b *backend) pathTidyStatusRead(ctx context.Context, req *logical.Request,
 	return resp, nil
 }
 
-func (b *backend) tidyStatusStart(safetyBuffer int, tidyCertStore, tidyRevokedCerts bool) {
+func (b *backend) tidyStatusStart(config *tidyConfig) {
 	b.tidyStatusLock.Lock()
 	defer b.tidyStatusLock.Unlock()
 
 	b.tidyStatus = &tidyStatus{
-		safetyBuffer:     safetyBuffer,
-		tidyCertStore:    tidyCertStore,
-		tidyRevokedCerts: tidyRevokedCerts,
-		state:            tidyStatusStarted,
-		timeStarted:      time.Now(),
+		safetyBuffer:       int(config.SafetyBuffer / time.Second),
+		issuerSafetyBuffer: int(config.IssuerSafetyBuffer / time.Second),
+		tidyCertStore:      config.CertStore,
+		tidyRevokedCerts:   config.RevokedCerts,
+		tidyExpiredIssuers: config.ExpiredIssuers,
+		autoTidy:           config.Enabled,
+		state:              tidyStatusStarted,
+		timeStarted:        time.Now(),
 	}
 
 	metrics.SetGauge([]string{"secrets", "pki", "tidy", "start_time_epoch"}, float32(b.tidyStatus.timeStarted.Unix()))
@@ -322,10 +524,14 @@ func (b *backend) tidyStatusStop(err error) {
 	defer b.tidyStatusLock.Unlock()
 
 	b.tidyStatus.timeFinished = time.Now()
-	b.tidyStatus.err = err
-	if err == nil {
+	b.lastTidy = b.tidyStatus.timeFinished
+	switch {
+	case err == nil:
 		b.tidyStatus.state = tidyStatusFinished
-	} else {
+	case err == errTidyCancelled:
+		b.tidyStatus.state = tidyStatusCancelled
+	default:
+		b.tidyStatus.err = err
 		b.tidyStatus.state = tidyStatusError
 	}
 
@@ -333,14 +539,26 @@ func (b *backend) tidyStatusStop(err error) {
 	metrics.SetGauge([]string{"secrets", "pki", "tidy", "start_time_epoch"}, 0)
 	metrics.IncrCounter([]string{"secrets", "pki", "tidy", "cert_store_deleted_count"}, float32(b.tidyStatus.certStoreDeletedCount))
 	metrics.IncrCounter([]string{"secrets", "pki", "tidy", "revoked_cert_deleted_count"}, float32(b.tidyStatus.revokedCertDeletedCount))
+	metrics.IncrCounter([]string{"secrets", "pki", "tidy", "issuer_deleted_count"}, float32(b.tidyStatus.issuerDeletedCount))
 
-	if err != nil {
+	if err == errTidyCancelled {
+		metrics.IncrCounter([]string{"secrets", "pki", "tidy", "cancelled"}, 1)
+	} else if err != nil {
 		metrics.IncrCounter([]string{"secrets", "pki", "tidy", "failure"}, 1)
 	} else {
 		metrics.IncrCounter([]string{"secrets", "pki", "tidy", "success"}, 1)
 	}
 }
 
+func (b *backend) tidyStatusCancelling() {
+	b.tidyStatusLock.Lock()
+	defer b.tidyStatusLock.Unlock()
+
+	if b.tidyStatus.state == tidyStatusStarted {
+		b.tidyStatus.state = tidyStatusCancelling
+	}
+}
+
 func (b *backend) tidyStatusMessage(msg string) {
 	b.tidyStatusLock.Lock()
 	defer b.tidyStatusLock.Unlock()
@@ -362,9 +580,30 @@ func (b *backend) tidyStatusIncRevokedCertCount() {
 	b.tidyStatus.revokedCertDeletedCount++
 }
 
+func (b *backend) tidyStatusIncIssuerCount() {
+	b.tidyStatusLock.Lock()
+	defer b.tidyStatusLock.Unlock()
+
+	b.tidyStatus.issuerDeletedCount++
+}
+
+func (b *backend) tidyStatusSetCertStoreTotal(count int) {
+	b.tidyStatusLock.Lock()
+	defer b.tidyStatusLock.Unlock()
+
+	b.tidyStatus.certStoreTotalCount = uint(count)
+}
+
+func (b *backend) tidyStatusSetRevokedCertTotal(count int) {
+	b.tidyStatusLock.Lock()
+	defer b.tidyStatusLock.Unlock()
+
+	b.tidyStatus.revokedCertTotalCount = uint(count)
+}
+
 const pathTidyHelpSyn = `
-Tidy up the backend by removing expired certificates, revocation information,
-or both.
+Tidy up the backend by removing expired certificates, revocation information
+and issuers.
 `
 
 const pathTidyHelpDesc = `
@@ -372,8 +611,9 @@ This endpoint allows expired certificates and/or revocation information to be
 removed from the backend, freeing up storage and shortening CRLs.
 
 For safety, this function is a noop if called without parameters; cleanup from
-normal certificate storage must be enabled with 'tidy_cert_store' and cleanup
-from revocation information must be enabled with 'tidy_revocation_list'.
+normal certificate storage must be enabled with 'tidy_cert_store', cleanup
+from revocation information must be enabled with 'tidy_revoked_certs' and
+cleanup of expired issuers must be enabled with 'tidy_expired_issuers'.
 
 The 'safety_buffer' parameter is useful to ensure that clock skew amongst your
 hosts cannot lead to a certificate being removed from the CRL while it is still
@@ -386,7 +626,12 @@ will be checked when this endpoint is hit. The expiration of the
 certificate/revocation information of each certificate being held in
 certificate storage or in revocation information will then be checked. If the
 current time, minus the value of 'safety_buffer', is greater than the
-expiration, it will be removed.
+expiration, it will be removed. Issuers are removed in the same way once their
+certificate expired more than 'issuer_safety_buffer' ago, unless they are the
+default issuer of the mount.
+
+A running tidy operation can be stopped with the tidy-cancel endpoint. To run
+tidy periodically, see config/auto-tidy.
 `
 
 const pathTidyStatusHelpSyn = `
@@ -401,12 +646,31 @@ The result includes the following fields:
 * 'safety_buffer': the value of this parameter when initiating the tidy operation
 * 'tidy_cert_store': the value of this parameter when initiating the tidy operation
 * 'tidy_revoked_certs': the value of this parameter when initiating the tidy operation
-* 'state': one of "Inactive", "Running", "Finished", "Error"
+* 'tidy_expired_issuers': the value of this parameter when initiating the tidy operation
+* 'issuer_safety_buffer': the value of this parameter when initiating the tidy operation
+* 'auto_tidy': whether the operation was started by config/auto-tidy
+* 'state': one of "Inactive", "Running", "Cancelling", "Cancelled", "Finished", "Error"
 * 'error': the error message, if the operation ran into an error
 * 'time_started': the time the operation started
 * 'time_finished': the time the operation finished
-* 'message': One of "Tidying certificate store: checking entry N of TOTAL" or
-  "Tidying revoked certificates: checking certificate N of TOTAL"
+* 'message': One of "Tidying certificate store: checking entry N of TOTAL",
+  "Tidying revoked certificates: checking certificate N of TOTAL" or
+  "Tidying issuers: checking issuer N of TOTAL"
+* 'cert_store_total_count': The number of certificate storage entries to check
+* 'revoked_cert_total_count': The number of revoked certificate entries to check
 * 'cert_store_deleted_count': The number of certificate storage entries deleted
 * 'revoked_cert_deleted_count': The number of revoked certificate entries deleted
+* 'issuer_deleted_count': The number of expired issuers deleted
+`
+
+const pathTidyCancelHelpSyn = `
+Cancels the running tidy operation.
+`
+
+const pathTidyCancelHelpDesc = `
+This endpoint asks the running tidy operation, whether started manually or by
+auto-tidy, to stop after the entry it is currently checking. Entries removed
+so far stay removed, and the CRL is rebuilt if revoked entries were removed.
+The current tidy status is returned; its state becomes "Cancelled" once the
+operation has stopped.
 `
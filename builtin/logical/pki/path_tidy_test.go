@@ -0,0 +1,133 @@
+package pki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestPki_AutoTidyExpiredIssuers(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+	}
+	write := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := request(logical.UpdateOperation, path, data)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %s: err: %v resp: %#v", path, err, resp)
+		}
+		return resp
+	}
+	waitForTidy := func() map[string]interface{} {
+		for i := 0; i < 50; i++ {
+			resp, err := request(logical.ReadOperation, "tidy-status", nil)
+			if err != nil || resp == nil {
+				t.Fatalf("bad: err: %v resp: %#v", err, resp)
+			}
+			switch resp.Data["state"] {
+			case "Finished":
+				return resp.Data
+			case "Error":
+				t.Fatalf("tidy failed: %#v", resp.Data)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatal("timed out waiting for tidy to finish")
+		return nil
+	}
+
+	// Nothing to cancel yet
+	resp, err := request(logical.UpdateOperation, "tidy-cancel", nil)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error cancelling without a running tidy: err: %v resp: %#v", err, resp)
+	}
+
+	write("root/generate/internal", map[string]interface{}{
+		"common_name": "root.example.com",
+		"ttl":         "48h",
+	})
+
+	// Import an expired root alongside the default issuer
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "expired.example.com"},
+		NotBefore:             time.Now().Add(-2 * time.Hour),
+		NotAfter:              time.Now().Add(-1 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("issuers/import/cert", map[string]interface{}{
+		"pem_bundle": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	})
+
+	// Auto-tidy must be asked to do something
+	resp, err = request(logical.UpdateOperation, "config/auto-tidy", map[string]interface{}{
+		"enabled": true,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error enabling auto-tidy without operations: err: %v resp: %#v", err, resp)
+	}
+
+	config := write("config/auto-tidy", map[string]interface{}{
+		"enabled":              true,
+		"interval_duration":    "1h",
+		"tidy_expired_issuers": true,
+		"issuer_safety_buffer": "1s",
+	})
+	if config.Data["interval_duration"] != 3600 || config.Data["safety_buffer"] != 259200 {
+		t.Fatalf("unexpected auto-tidy config: %#v", config.Data)
+	}
+
+	// The interval hasn't passed since the mount was loaded
+	if err := b.runAutoTidyIfNeeded(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = request(logical.ReadOperation, "tidy-status", nil)
+	if err != nil || resp.Data["state"] != "Inactive" {
+		t.Fatalf("expected auto-tidy not to have run yet: err: %v resp: %#v", err, resp)
+	}
+
+	b.tidyStatusLock.Lock()
+	b.lastTidy = time.Now().Add(-2 * time.Hour)
+	b.tidyStatusLock.Unlock()
+	if err := b.runAutoTidyIfNeeded(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+
+	status := waitForTidy()
+	if status["auto_tidy"] != true || status["tidy_expired_issuers"] != true || status["issuer_deleted_count"] != uint(1) {
+		t.Fatalf("unexpected tidy status: %#v", status)
+	}
+
+	resp, err = request(logical.ListOperation, "issuers", nil)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 {
+		t.Fatalf("expected only the default issuer to remain, got %v", keys)
+	}
+}
@@ -0,0 +1,867 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	storageKeyConfig    = "config/keys"
+	storageIssuerConfig = "config/issuers"
+	keyPrefix           = "config/key/"
+	issuerPrefix        = "config/issuer/"
+	crlPrefix           = "crls/"
+	deltaCRLPrefix      = "crls/delta/"
+	crlStatePath        = "crls/state"
+	deltaWALPrefix      = "delta-wal/"
+
+	legacyCertBundlePath = "config/ca_bundle"
+	legacyCertPath       = "ca"
+	legacyCRLPath        = "crl"
+
+	// defaultRef is the reference which always resolves to the current
+	// default issuer or key of the mount.
+	defaultRef = "default"
+)
+
+// nameRegex restricts issuer and key names so that they can never be
+// mistaken for an identifier or for the default reference.
+var nameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_\-]*$`)
+
+type keyID string
+
+func (k keyID) String() string {
+	return string(k)
+}
+
+type issuerID string
+
+func (i issuerID) String() string {
+	return string(i)
+}
+
+type keyEntry struct {
+	ID             keyID                   `json:"id"`
+	Name           string                  `json:"name"`
+	PrivateKeyType certutil.PrivateKeyType `json:"private_key_type"`
+	PrivateKey     string                  `json:"private_key"`
+	ManagedKey     *managedKeyEntry        `json:"managed_key,omitempty"`
+}
+
+type issuerEntry struct {
+	ID           issuerID `json:"id"`
+	Name         string   `json:"name"`
+	KeyID        keyID    `json:"key_id"`
+	Certificate  string   `json:"certificate"`
+	CAChain      []string `json:"ca_chain"`
+	SerialNumber string   `json:"serial_number"`
+}
+
+type keyConfigEntry struct {
+	DefaultKeyID keyID `json:"default"`
+}
+
+type issuerConfigEntry struct {
+	DefaultIssuerID issuerID `json:"default"`
+}
+
+// GetCertificate parses the PEM-encoded certificate of the issuer.
+func (i issuerEntry) GetCertificate() (*x509.Certificate, error) {
+	cert, err := parseCertificateFromPEM(i.Certificate)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to parse certificate of issuer %s: %v", i.ID, err)}
+	}
+
+	return cert, nil
+}
+
+// isManaged reports whether the private key of the entry is held outside
+// of Vault, in which case only its public key is stored.
+func (k keyEntry) isManaged() bool {
+	return k.ManagedKey != nil
+}
+
+// GetSigner parses the PEM-encoded private key of the key entry. For managed
+// keys, the returned bundle holds a signer backed by the external key.
+func (k keyEntry) GetSigner() (*certutil.ParsedCertBundle, error) {
+	if k.isManaged() {
+		signer, err := k.ManagedKey.getSigner()
+		if err != nil {
+			return nil, err
+		}
+		return &certutil.ParsedCertBundle{
+			PrivateKeyType: k.PrivateKeyType,
+			PrivateKey:     signer,
+		}, nil
+	}
+
+	cb := &certutil.CertBundle{
+		PrivateKeyType: k.PrivateKeyType,
+		PrivateKey:     k.PrivateKey,
+	}
+	return cb.ToParsedCertBundle()
+}
+
+// GetPublicKey returns the public key of the key entry without contacting
+// the external key store of managed keys.
+func (k keyEntry) GetPublicKey() (crypto.PublicKey, error) {
+	if k.isManaged() {
+		return k.ManagedKey.getPublicKey()
+	}
+
+	parsed, err := k.GetSigner()
+	if err != nil {
+		return nil, err
+	}
+	return parsed.PrivateKey.Public(), nil
+}
+
+func validateName(name string) error {
+	if name == "" {
+		return nil
+	}
+	if name == defaultRef {
+		return errutil.UserError{Err: fmt.Sprintf("the name %q is reserved", defaultRef)}
+	}
+	if !nameRegex.MatchString(name) {
+		return errutil.UserError{Err: fmt.Sprintf("invalid name %q: names may only contain alphanumeric characters, dashes and underscores", name)}
+	}
+	if _, err := uuid.ParseUUID(name); err == nil {
+		return errutil.UserError{Err: fmt.Sprintf("invalid name %q: names may not be formatted as identifiers", name)}
+	}
+	return nil
+}
+
+func listKeys(ctx context.Context, s logical.Storage) ([]keyID, error) {
+	strList, err := s.List(ctx, keyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keyIds := make([]keyID, 0, len(strList))
+	for _, entry := range strList {
+		keyIds = append(keyIds, keyID(entry))
+	}
+
+	return keyIds, nil
+}
+
+func fetchKeyByID(ctx context.Context, s logical.Storage, id keyID) (*keyEntry, error) {
+	if len(id) == 0 {
+		return nil, errutil.InternalError{Err: "unable to fetch pki key: empty key identifier"}
+	}
+
+	entry, err := s.Get(ctx, keyPrefix+id.String())
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch pki key: %v", err)}
+	}
+	if entry == nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("pki key id %s does not exist", id)}
+	}
+
+	var key keyEntry
+	if err := entry.DecodeJSON(&key); err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to decode pki key with id %s: %v", id, err)}
+	}
+
+	return &key, nil
+}
+
+func writeKey(ctx context.Context, s logical.Storage, key *keyEntry) error {
+	json, err := logical.StorageEntryJSON(keyPrefix+key.ID.String(), key)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, json)
+}
+
+func deleteKey(ctx context.Context, s logical.Storage, id keyID) (bool, error) {
+	config, err := getKeysConfig(ctx, s)
+	if err != nil {
+		return false, err
+	}
+
+	wasDefault := false
+	if config.DefaultKeyID == id {
+		wasDefault = true
+		config.DefaultKeyID = keyID("")
+		if err := setKeysConfig(ctx, s, config); err != nil {
+			return wasDefault, err
+		}
+	}
+
+	return wasDefault, s.Delete(ctx, keyPrefix+id.String())
+}
+
+// importKey stores the given PEM-encoded private key, unless a key with the
+// same public key already exists, in which case the existing entry is
+// returned along with a true value.
+func importKey(ctx context.Context, s logical.Storage, keyValue string, keyName string) (*keyEntry, bool, error) {
+	parsed, err := certutil.ParsePEMBundle(keyValue)
+	if err != nil {
+		return nil, false, err
+	}
+	if parsed.PrivateKey == nil || parsed.PrivateKeyType == certutil.UnknownPrivateKey {
+		return nil, false, errutil.UserError{Err: "unable to parse private key"}
+	}
+
+	cb, err := parsed.ToCertBundle()
+	if err != nil {
+		return nil, false, err
+	}
+
+	result := &keyEntry{
+		Name:           keyName,
+		PrivateKeyType: parsed.PrivateKeyType,
+		PrivateKey:     strings.TrimSpace(cb.PrivateKey) + "\n",
+	}
+	return importKeyEntry(ctx, s, result, parsed.PrivateKey.Public())
+}
+
+// importManagedKey stores a reference to the given externally held key,
+// unless a key with the same public key already exists, in which case the
+// existing entry is returned along with a true value.
+func importManagedKey(ctx context.Context, s logical.Storage, managed *managedKeyEntry, publicKey crypto.PublicKey, keyName string) (*keyEntry, bool, error) {
+	keyType, err := publicKeyPrivateKeyType(publicKey)
+	if err != nil {
+		return nil, false, err
+	}
+
+	result := &keyEntry{
+		Name:           keyName,
+		PrivateKeyType: keyType,
+		ManagedKey:     managed,
+	}
+	return importKeyEntry(ctx, s, result, publicKey)
+}
+
+// importKeyEntry assigns an identifier to and stores the new key entry with
+// the given public key, after checking it isn't a duplicate of an existing
+// key.
+func importKeyEntry(ctx context.Context, s logical.Storage, result *keyEntry, publicKey crypto.PublicKey) (*keyEntry, bool, error) {
+	knownKeys, err := listKeys(ctx, s)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, existingID := range knownKeys {
+		existing, err := fetchKeyByID(ctx, s, existingID)
+		if err != nil {
+			return nil, false, err
+		}
+
+		existingPublicKey, err := existing.GetPublicKey()
+		if err != nil {
+			return nil, false, err
+		}
+
+		equal, err := samePublicKey(publicKey, existingPublicKey)
+		if err != nil {
+			return nil, false, err
+		}
+		if equal {
+			return existing, true, nil
+		}
+	}
+
+	if err := checkKeyNameAvailable(ctx, s, result.Name, keyID("")); err != nil {
+		return nil, false, err
+	}
+
+	newID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, false, err
+	}
+	result.ID = keyID(newID)
+
+	if err := writeKey(ctx, s, result); err != nil {
+		return nil, false, err
+	}
+
+	// If this is the first key, make it the default.
+	config, err := getKeysConfig(ctx, s)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(config.DefaultKeyID) == 0 {
+		config.DefaultKeyID = result.ID
+		if err := setKeysConfig(ctx, s, config); err != nil {
+			return nil, false, err
+		}
+	}
+
+	// Link any previously imported issuers that were waiting on this key,
+	// e.g., a CA certificate imported before its private key.
+	if err := linkIssuersToKey(ctx, s, result, publicKey); err != nil {
+		return nil, false, err
+	}
+
+	return result, false, nil
+}
+
+// samePublicKey reports whether the two public keys are equal; keys of
+// different types are never equal.
+func samePublicKey(key1, key2 crypto.PublicKey) (bool, error) {
+	if reflect.TypeOf(key1) != reflect.TypeOf(key2) {
+		return false, nil
+	}
+	return certutil.ComparePublicKeys(key1, key2)
+}
+
+func linkIssuersToKey(ctx context.Context, s logical.Storage, key *keyEntry, publicKey crypto.PublicKey) error {
+	knownIssuers, err := listIssuers(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range knownIssuers {
+		issuer, err := fetchIssuerByID(ctx, s, id)
+		if err != nil {
+			return err
+		}
+		if len(issuer.KeyID) > 0 {
+			continue
+		}
+
+		cert, err := issuer.GetCertificate()
+		if err != nil {
+			return err
+		}
+
+		equal, err := samePublicKey(publicKey, cert.PublicKey)
+		if err != nil {
+			return err
+		}
+		if !equal {
+			continue
+		}
+
+		issuer.KeyID = key.ID
+		if err := writeIssuer(ctx, s, issuer); err != nil {
+			return err
+		}
+
+		config, err := getIssuersConfig(ctx, s)
+		if err != nil {
+			return err
+		}
+		if len(config.DefaultIssuerID) == 0 {
+			config.DefaultIssuerID = issuer.ID
+			if err := setIssuersConfig(ctx, s, config); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func listIssuers(ctx context.Context, s logical.Storage) ([]issuerID, error) {
+	strList, err := s.List(ctx, issuerPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	issuerIds := make([]issuerID, 0, len(strList))
+	for _, entry := range strList {
+		issuerIds = append(issuerIds, issuerID(entry))
+	}
+
+	return issuerIds, nil
+}
+
+func fetchIssuerByID(ctx context.Context, s logical.Storage, id issuerID) (*issuerEntry, error) {
+	if len(id) == 0 {
+		return nil, errutil.InternalError{Err: "unable to fetch pki issuer: empty issuer identifier"}
+	}
+
+	entry, err := s.Get(ctx, issuerPrefix+id.String())
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch pki issuer: %v", err)}
+	}
+	if entry == nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("pki issuer id %s does not exist", id)}
+	}
+
+	var issuer issuerEntry
+	if err := entry.DecodeJSON(&issuer); err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to decode pki issuer with id %s: %v", id, err)}
+	}
+
+	return &issuer, nil
+}
+
+func writeIssuer(ctx context.Context, s logical.Storage, issuer *issuerEntry) error {
+	json, err := logical.StorageEntryJSON(issuerPrefix+issuer.ID.String(), issuer)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, json)
+}
+
+func deleteIssuer(ctx context.Context, s logical.Storage, id issuerID) (bool, error) {
+	config, err := getIssuersConfig(ctx, s)
+	if err != nil {
+		return false, err
+	}
+
+	wasDefault := false
+	if config.DefaultIssuerID == id {
+		wasDefault = true
+		config.DefaultIssuerID = issuerID("")
+		if err := setIssuersConfig(ctx, s, config); err != nil {
+			return wasDefault, err
+		}
+	}
+
+	if err := s.Delete(ctx, crlPrefix+id.String()); err != nil {
+		return wasDefault, err
+	}
+	if err := s.Delete(ctx, deltaCRLPrefix+id.String()); err != nil {
+		return wasDefault, err
+	}
+
+	return wasDefault, s.Delete(ctx, issuerPrefix+id.String())
+}
+
+// importIssuer stores the given PEM-encoded certificate as a new issuer,
+// unless an issuer with the same certificate already exists, in which case
+// the existing entry is returned along with a true value. The issuer is
+// linked to any existing key matching its public key.
+func importIssuer(ctx context.Context, s logical.Storage, certValue string, issuerName string) (*issuerEntry, bool, error) {
+	issuerCert, err := parseCertificateFromPEM(certValue)
+	if err != nil {
+		return nil, false, errutil.UserError{Err: fmt.Sprintf("unable to parse certificate: %v", err)}
+	}
+	if !issuerCert.IsCA {
+		return nil, false, errutil.UserError{Err: "the given certificate is not marked for CA use and cannot be used with this backend"}
+	}
+
+	knownIssuers, err := listIssuers(ctx, s)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, existingID := range knownIssuers {
+		existing, err := fetchIssuerByID(ctx, s, existingID)
+		if err != nil {
+			return nil, false, err
+		}
+
+		existingCert, err := existing.GetCertificate()
+		if err != nil {
+			return nil, false, err
+		}
+
+		if bytes.Equal(existingCert.Raw, issuerCert.Raw) {
+			return existing, true, nil
+		}
+	}
+
+	if err := checkIssuerNameAvailable(ctx, s, issuerName, issuerID("")); err != nil {
+		return nil, false, err
+	}
+
+	newID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, false, err
+	}
+
+	result := &issuerEntry{
+		ID:           issuerID(newID),
+		Name:         issuerName,
+		Certificate:  certToPEM(issuerCert.Raw),
+		SerialNumber: certutil.GetHexFormatted(issuerCert.SerialNumber.Bytes(), ":"),
+	}
+
+	matchingKey, err := findKeyForCertificate(ctx, s, issuerCert)
+	if err != nil {
+		return nil, false, err
+	}
+	if matchingKey != nil {
+		result.KeyID = matchingKey.ID
+	}
+
+	if err := writeIssuer(ctx, s, result); err != nil {
+		return nil, false, err
+	}
+
+	// If there is no default issuer yet and this one can sign, make it the
+	// default.
+	config, err := getIssuersConfig(ctx, s)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(config.DefaultIssuerID) == 0 && len(result.KeyID) > 0 {
+		config.DefaultIssuerID = result.ID
+		if err := setIssuersConfig(ctx, s, config); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return result, false, nil
+}
+
+// writeCaBundle stores the private key (if any) and certificate of the given
+// bundle as a key and issuer, along with the bundle's chain.
+func writeCaBundle(ctx context.Context, s logical.Storage, caBundle *certutil.CertBundle, issuerName string, keyName string) (*issuerEntry, *keyEntry, error) {
+	var myKey *keyEntry
+	var err error
+	if len(caBundle.PrivateKey) > 0 {
+		myKey, _, err = importKey(ctx, s, caBundle.PrivateKey, keyName)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	myIssuer, existing, err := importIssuer(ctx, s, caBundle.Certificate, issuerName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !existing && len(caBundle.CAChain) > 0 {
+		myIssuer.CAChain = caBundle.CAChain
+		if err := writeIssuer(ctx, s, myIssuer); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := rebuildIssuersChains(ctx, s); err != nil {
+		return nil, nil, err
+	}
+
+	myIssuer, err = fetchIssuerByID(ctx, s, myIssuer.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return myIssuer, myKey, nil
+}
+
+// findKeyForCertificate returns the stored key whose public key matches the
+// given certificate, or nil if no such key exists.
+func findKeyForCertificate(ctx context.Context, s logical.Storage, cert *x509.Certificate) (*keyEntry, error) {
+	knownKeys, err := listKeys(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range knownKeys {
+		key, err := fetchKeyByID(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+
+		publicKey, err := key.GetPublicKey()
+		if err != nil {
+			return nil, err
+		}
+
+		equal, err := samePublicKey(publicKey, cert.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if equal {
+			return key, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// isKeyInUse reports whether any issuer references the given key.
+func isKeyInUse(ctx context.Context, s logical.Storage, id keyID) (bool, issuerID, error) {
+	knownIssuers, err := listIssuers(ctx, s)
+	if err != nil {
+		return false, issuerID(""), err
+	}
+
+	for _, existingID := range knownIssuers {
+		existing, err := fetchIssuerByID(ctx, s, existingID)
+		if err != nil {
+			return false, issuerID(""), err
+		}
+		if existing.KeyID == id {
+			return true, existing.ID, nil
+		}
+	}
+
+	return false, issuerID(""), nil
+}
+
+func getKeysConfig(ctx context.Context, s logical.Storage) (*keyConfigEntry, error) {
+	entry, err := s.Get(ctx, storageKeyConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	keyConfig := &keyConfigEntry{}
+	if entry != nil {
+		if err := entry.DecodeJSON(keyConfig); err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("unable to decode key configuration: %v", err)}
+		}
+	}
+
+	return keyConfig, nil
+}
+
+func setKeysConfig(ctx context.Context, s logical.Storage, config *keyConfigEntry) error {
+	json, err := logical.StorageEntryJSON(storageKeyConfig, config)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, json)
+}
+
+func getIssuersConfig(ctx context.Context, s logical.Storage) (*issuerConfigEntry, error) {
+	entry, err := s.Get(ctx, storageIssuerConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	issuerConfig := &issuerConfigEntry{}
+	if entry != nil {
+		if err := entry.DecodeJSON(issuerConfig); err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("unable to decode issuer configuration: %v", err)}
+		}
+	}
+
+	return issuerConfig, nil
+}
+
+func setIssuersConfig(ctx context.Context, s logical.Storage, config *issuerConfigEntry) error {
+	json, err := logical.StorageEntryJSON(storageIssuerConfig, config)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, json)
+}
+
+// resolveKeyReference resolves a key reference, which may be "default", a
+// key identifier or a key name, to a key identifier.
+func resolveKeyReference(ctx context.Context, s logical.Storage, reference string) (keyID, error) {
+	if reference == defaultRef {
+		config, err := getKeysConfig(ctx, s)
+		if err != nil {
+			return keyID(""), err
+		}
+		if len(config.DefaultKeyID) == 0 {
+			return keyID(""), errutil.UserError{Err: "no default key currently configured"}
+		}
+
+		return config.DefaultKeyID, nil
+	}
+
+	keys, err := listKeys(ctx, s)
+	if err != nil {
+		return keyID(""), err
+	}
+
+	// Identifiers take precedence over names.
+	for _, id := range keys {
+		if id.String() == reference {
+			return id, nil
+		}
+	}
+
+	for _, id := range keys {
+		key, err := fetchKeyByID(ctx, s, id)
+		if err != nil {
+			return keyID(""), err
+		}
+		if key.Name == reference {
+			return id, nil
+		}
+	}
+
+	return keyID(""), errutil.UserError{Err: fmt.Sprintf("unable to find PKI key for reference: %v", reference)}
+}
+
+// resolveIssuerReference resolves an issuer reference, which may be
+// "default", an issuer identifier or an issuer name, to an issuer identifier.
+func resolveIssuerReference(ctx context.Context, s logical.Storage, reference string) (issuerID, error) {
+	if reference == defaultRef {
+		config, err := getIssuersConfig(ctx, s)
+		if err != nil {
+			return issuerID(""), err
+		}
+		if len(config.DefaultIssuerID) == 0 {
+			return issuerID(""), errutil.UserError{Err: "backend must be configured with a CA certificate/key"}
+		}
+
+		return config.DefaultIssuerID, nil
+	}
+
+	issuers, err := listIssuers(ctx, s)
+	if err != nil {
+		return issuerID(""), err
+	}
+
+	for _, id := range issuers {
+		if id.String() == reference {
+			return id, nil
+		}
+	}
+
+	for _, id := range issuers {
+		issuer, err := fetchIssuerByID(ctx, s, id)
+		if err != nil {
+			return issuerID(""), err
+		}
+		if issuer.Name == reference {
+			return id, nil
+		}
+	}
+
+	return issuerID(""), errutil.UserError{Err: fmt.Sprintf("unable to find PKI issuer for reference: %v", reference)}
+}
+
+// checkNameAvailable ensures that no other issuer (or key, respectively)
+// already uses the given name.
+func checkIssuerNameAvailable(ctx context.Context, s logical.Storage, name string, self issuerID) error {
+	if name == "" {
+		return nil
+	}
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	existing, err := resolveIssuerReference(ctx, s, name)
+	if err == nil && existing != self {
+		return errutil.UserError{Err: fmt.Sprintf("an issuer with the name %q already exists", name)}
+	}
+	if _, ok := err.(errutil.InternalError); ok {
+		return err
+	}
+
+	return nil
+}
+
+func checkKeyNameAvailable(ctx context.Context, s logical.Storage, name string, self keyID) error {
+	if name == "" {
+		return nil
+	}
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	existing, err := resolveKeyReference(ctx, s, name)
+	if err == nil && existing != self {
+		return errutil.UserError{Err: fmt.Sprintf("a key with the name %q already exists", name)}
+	}
+	if _, ok := err.(errutil.InternalError); ok {
+		return err
+	}
+
+	return nil
+}
+
+// fetchCertBundleByIssuerID returns the issuer entry along with a cert
+// bundle built from it. When loadKey is set, the issuer's private key is
+// included in the bundle.
+func fetchCertBundleByIssuerID(ctx context.Context, s logical.Storage, id issuerID, loadKey bool) (*issuerEntry, *certutil.CertBundle, error) {
+	issuer, err := fetchIssuerByID(ctx, s, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bundle := &certutil.CertBundle{
+		Certificate:  issuer.Certificate,
+		CAChain:      issuer.CAChain,
+		SerialNumber: issuer.SerialNumber,
+	}
+
+	if !loadKey {
+		return issuer, bundle, nil
+	}
+
+	if len(issuer.KeyID) == 0 {
+		return nil, nil, errutil.UserError{Err: fmt.Sprintf("issuer %s has no associated key and cannot be used for signing", issuer.ID)}
+	}
+
+	key, err := fetchKeyByID(ctx, s, issuer.KeyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bundle.PrivateKeyType = key.PrivateKeyType
+	bundle.PrivateKey = key.PrivateKey
+
+	return issuer, bundle, nil
+}
+
+// fetchParsedCertBundleByIssuerID returns the issuer entry along with a
+// parsed bundle of its certificate, chain and signer. Unlike the key in the
+// bundle of fetchCertBundleByIssuerID, the signer may be a managed key.
+func fetchParsedCertBundleByIssuerID(ctx context.Context, s logical.Storage, id issuerID) (*issuerEntry, *certutil.ParsedCertBundle, error) {
+	issuer, bundle, err := fetchCertBundleByIssuerID(ctx, s, id, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(issuer.KeyID) == 0 {
+		return nil, nil, errutil.UserError{Err: fmt.Sprintf("issuer %s has no associated key and cannot be used for signing", issuer.ID)}
+	}
+
+	key, err := fetchKeyByID(ctx, s, issuer.KeyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parsedBundle, err := bundle.ToParsedCertBundle()
+	if err != nil {
+		return nil, nil, errutil.InternalError{Err: err.Error()}
+	}
+
+	signer, err := key.GetSigner()
+	if err != nil {
+		return nil, nil, asTypedError(err, fmt.Sprintf("unable to load key %s of issuer %s", key.ID, issuer.ID))
+	}
+	parsedBundle.PrivateKeyType = signer.PrivateKeyType
+	parsedBundle.PrivateKeyFormat = signer.PrivateKeyFormat
+	parsedBundle.PrivateKeyBytes = signer.PrivateKeyBytes
+	parsedBundle.PrivateKey = signer.PrivateKey
+
+	return issuer, parsedBundle, nil
+}
+
+// fetchIssuerCertificates returns the parsed certificates of all issuers
+// in the mount, keyed by identifier.
+func fetchIssuerCertificates(ctx context.Context, s logical.Storage) (map[issuerID]*x509.Certificate, error) {
+	issuers, err := listIssuers(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[issuerID]*x509.Certificate, len(issuers))
+	for _, id := range issuers {
+		issuer, err := fetchIssuerByID(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+
+		cert, err := issuer.GetCertificate()
+		if err != nil {
+			return nil, err
+		}
+
+		result[id] = cert
+	}
+
+	return result, nil
+}
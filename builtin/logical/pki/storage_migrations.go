@@ -0,0 +1,84 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// initialize migrates any legacy single CA bundle stored by previous versions
+// of this backend into the issuer and key storage layout.
+func (b *backend) initialize(ctx context.Context, req *logical.InitializationRequest) error {
+	// On standbys and DR secondaries we do not want to run any kind of
+	// upgrade logic; the active node will take care of it.
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby | consts.ReplicationDRSecondary) {
+		return nil
+	}
+
+	// Replicated mounts are migrated on the performance primary.
+	if !b.System().LocalMount() && b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary) {
+		return nil
+	}
+
+	migrated, err := migrateLegacyCABundle(ctx, req.Storage)
+	if err != nil {
+		b.Logger().Error("error migrating legacy CA bundle", "error", err)
+		return err
+	}
+	if migrated {
+		b.Logger().Info("migrated legacy CA bundle to issuer storage")
+	}
+
+	return nil
+}
+
+func migrateLegacyCABundle(ctx context.Context, s logical.Storage) (bool, error) {
+	entry, err := s.Get(ctx, legacyCertBundlePath)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		return false, nil
+	}
+
+	var bundle certutil.CertBundle
+	if err := entry.DecodeJSON(&bundle); err != nil {
+		return false, fmt.Errorf("unable to decode legacy CA bundle: %w", err)
+	}
+
+	switch {
+	case len(bundle.Certificate) > 0:
+		issuer, _, err := writeCaBundle(ctx, s, &bundle, "", "")
+		if err != nil {
+			return false, err
+		}
+
+		// The legacy bundle was, by definition, the mount's CA, so make
+		// sure it remains the default after migration.
+		if len(issuer.KeyID) > 0 {
+			if err := setIssuersConfig(ctx, s, &issuerConfigEntry{DefaultIssuerID: issuer.ID}); err != nil {
+				return false, err
+			}
+		}
+	case len(bundle.PrivateKey) > 0:
+		// An intermediate CSR was generated but the signed certificate
+		// was never set; keep the key around for intermediate/set-signed.
+		if _, _, err := importKey(ctx, s, bundle.PrivateKey, ""); err != nil {
+			return false, err
+		}
+	}
+
+	// The CRL of the legacy CA lives on under the issuer's CRL path once
+	// it is rebuilt; the bundle and the copy of its certificate are no
+	// longer needed.
+	for _, legacyPath := range []string{legacyCertPath, legacyCertBundlePath} {
+		if err := s.Delete(ctx, legacyPath); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
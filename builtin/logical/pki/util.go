@@ -1,7 +1,66 @@
 package pki
 
-import "strings"
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
 
 func normalizeSerial(serial string) string {
 	return strings.Replace(strings.ToLower(serial), ":", "-", -1)
 }
+
+// parseCertificateFromPEM parses the first certificate found in the given
+// PEM-encoded input.
+func parseCertificateFromPEM(pemCert string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(pemCert))
+	if block == nil || len(block.Bytes) == 0 {
+		return nil, errors.New("unable to PEM decode certificate")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// certToPEM encodes the given DER certificate as PEM, with a single trailing
+// newline.
+func certToPEM(der []byte) string {
+	block := pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: der,
+	}
+
+	return strings.TrimSpace(string(pem.EncodeToMemory(&block))) + "\n"
+}
+
+// getIssuerRef returns the issuer reference given in the request, falling
+// back to the default issuer when none was provided.
+func getIssuerRef(data *framework.FieldData) string {
+	if ref, ok := data.GetOk(issuerRefParam); ok && len(ref.(string)) > 0 {
+		return ref.(string)
+	}
+	return defaultRef
+}
+
+// getIssuerAndKeyNames returns the names requested for a new issuer and key,
+// if the request's path supports naming them.
+func getIssuerAndKeyNames(data *framework.FieldData) (string, string, *logical.Response) {
+	var issuerName, keyName string
+	if name, ok := data.GetOk("issuer_name"); ok {
+		issuerName = name.(string)
+		if err := validateName(issuerName); err != nil {
+			return "", "", logical.ErrorResponse(err.Error())
+		}
+	}
+	if name, ok := data.GetOk("key_name"); ok {
+		keyName = name.(string)
+		if err := validateName(keyName); err != nil {
+			return "", "", logical.ErrorResponse(err.Error())
+		}
+	}
+
+	return issuerName, keyName, nil
+}
@@ -15,6 +15,12 @@ type backend struct {
 	view      logical.Storage
 	salt      *salt.Salt
 	saltMutex sync.RWMutex
+
+	// issuersLock serializes changes to the issuers and their configuration
+	issuersLock sync.Mutex
+
+	// tidyCASGuard is set while a tidy operation is running
+	tidyCASGuard uint32
 }
 
 func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
@@ -38,15 +44,21 @@ func Backend(conf *logical.BackendConfig) (*backend, error) {
 			Unauthenticated: []string{
 				"verify",
 				"public_key",
+				"known_hosts",
+				"krl",
+				"renew/*",
 			},
 
 			LocalStorage: []string{
 				"otp/",
+				certStoragePrefix,
+				revokedStoragePrefix,
 			},
 
 			SealWrapStorage: []string{
 				caPrivateKey,
 				caPrivateKeyStoragePath,
+				issuerPrefix,
 				"keys/",
 			},
 		},
@@ -62,6 +74,17 @@ func Backend(conf *logical.BackendConfig) (*backend, error) {
 			pathConfigCA(&b),
 			pathSign(&b),
 			pathFetchPublicKey(&b),
+			pathFetchKnownHosts(&b),
+			pathRenew(&b),
+			pathListCerts(&b),
+			pathFetchCert(&b),
+			pathRevoke(&b),
+			pathFetchKRL(&b),
+			pathTidy(&b),
+			pathListIssuers(&b),
+			pathImportIssuer(&b),
+			pathGetIssuer(&b),
+			pathConfigIssuers(&b),
 		},
 
 		Secrets: []*framework.Secret{
@@ -69,8 +92,9 @@ func Backend(conf *logical.BackendConfig) (*backend, error) {
 			secretOTP(&b),
 		},
 
-		Invalidate:  b.invalidate,
-		BackendType: logical.TypeLogical,
+		Invalidate:     b.invalidate,
+		InitializeFunc: b.initialize,
+		BackendType:    logical.TypeLogical,
 	}
 	return &b, nil
 }
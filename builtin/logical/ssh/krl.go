@@ -0,0 +1,111 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Constants of the OpenSSH KRL format, as described in PROTOCOL.krl of
+// OpenSSH
+const (
+	krlMagic         uint64 = 0x5353484b524c0a00
+	krlFormatVersion uint32 = 1
+
+	krlSectionCertificates byte = 1
+	krlSectionCertSerials  byte = 0x20
+)
+
+// buildKRL returns the OpenSSH KRL of the certificates revoked at the given
+// time, which are grouped by issuer. Revoked certificates which have expired
+// or whose issuer has been deleted are left out.
+func buildKRL(ctx context.Context, s logical.Storage, now time.Time) ([]byte, error) {
+	serials, err := s.List(ctx, revokedStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var krlVersion uint64
+	revokedByIssuer := make(map[issuerID][]uint64)
+	for _, serial := range serials {
+		revocation, err := fetchRevocation(ctx, s, serial)
+		if err != nil {
+			return nil, err
+		}
+		if revocation == nil {
+			continue
+		}
+
+		// The KRL changes with every revocation
+		if version := uint64(revocation.RevocationTime.UnixNano()); version > krlVersion {
+			krlVersion = version
+		}
+		if !revocation.Expiration.After(now) {
+			continue
+		}
+
+		serialNumber, err := parseSerial(revocation.SerialNumber)
+		if err != nil {
+			return nil, err
+		}
+		revokedByIssuer[revocation.IssuerID] = append(revokedByIssuer[revocation.IssuerID], serialNumber)
+	}
+
+	var krl bytes.Buffer
+	binary.Write(&krl, binary.BigEndian, krlMagic)
+	binary.Write(&krl, binary.BigEndian, krlFormatVersion)
+	binary.Write(&krl, binary.BigEndian, krlVersion)
+	binary.Write(&krl, binary.BigEndian, uint64(now.Unix()))
+	binary.Write(&krl, binary.BigEndian, uint64(0)) // flags
+	writeKRLString(&krl, nil)                       // reserved
+	writeKRLString(&krl, nil)                       // comment
+
+	issuers, err := listIssuers(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range issuers {
+		revoked := revokedByIssuer[id]
+		if len(revoked) == 0 {
+			continue
+		}
+		sort.Slice(revoked, func(i, j int) bool { return revoked[i] < revoked[j] })
+
+		issuer, err := fetchIssuerByID(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+		caKey, err := parsePublicSSHKey(issuer.PublicKey)
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("unable to parse public key of issuer %s: %v", id, err)}
+		}
+
+		var serialList bytes.Buffer
+		for _, serial := range revoked {
+			binary.Write(&serialList, binary.BigEndian, serial)
+		}
+
+		var section bytes.Buffer
+		writeKRLString(&section, caKey.Marshal())
+		writeKRLString(&section, nil) // reserved
+		section.WriteByte(krlSectionCertSerials)
+		writeKRLString(&section, serialList.Bytes())
+
+		krl.WriteByte(krlSectionCertificates)
+		writeKRLString(&krl, section.Bytes())
+	}
+
+	return krl.Bytes(), nil
+}
+
+// writeKRLString writes data as an SSH string, prefixed by its length
+func writeKRLString(buf *bytes.Buffer, data []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+}
@@ -0,0 +1,361 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	certStoragePrefix    = "certs/"
+	revokedStoragePrefix = "revoked/"
+)
+
+// certEntry is the record of a certificate issued by the backend
+type certEntry struct {
+	SerialNumber    string    `json:"serial_number"`
+	KeyID           string    `json:"key_id"`
+	CertificateType string    `json:"cert_type"`
+	ValidPrincipals []string  `json:"valid_principals"`
+	Role            string    `json:"role"`
+	IssuerID        issuerID  `json:"issuer_id"`
+	IssuedAt        time.Time `json:"issued_at"`
+	Expiration      time.Time `json:"expiration"`
+	Certificate     string    `json:"certificate"`
+}
+
+// revocationEntry records the revocation of an issued certificate; these
+// entries make up the KRL
+type revocationEntry struct {
+	SerialNumber   string    `json:"serial_number"`
+	IssuerID       issuerID  `json:"issuer_id"`
+	KeyID          string    `json:"key_id"`
+	Expiration     time.Time `json:"expiration"`
+	RevocationTime time.Time `json:"revocation_time"`
+}
+
+func pathListCerts(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "certs/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathListCerts,
+		},
+
+		HelpSynopsis:    pathListCertsHelpSyn,
+		HelpDescription: pathListCertsHelpDesc,
+	}
+}
+
+func pathFetchCert(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `cert/(?P<serial_number>[0-9A-Fa-f]+)`,
+		Fields: map[string]*framework.FieldSchema{
+			"serial_number": {
+				Type:        framework.TypeString,
+				Description: `Certificate serial number, in hex.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathFetchCert,
+		},
+
+		HelpSynopsis:    pathFetchCertHelpSyn,
+		HelpDescription: pathFetchCertHelpDesc,
+	}
+}
+
+func pathRevoke(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "revoke",
+		Fields: map[string]*framework.FieldSchema{
+			"serial_number": {
+				Type:        framework.TypeString,
+				Description: `Serial number of the certificate to revoke, in hex.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRevoke,
+		},
+
+		HelpSynopsis:    pathRevokeHelpSyn,
+		HelpDescription: pathRevokeHelpDesc,
+	}
+}
+
+func pathFetchKRL(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "krl",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathFetchKRL,
+		},
+
+		HelpSynopsis:    pathFetchKRLHelpSyn,
+		HelpDescription: pathFetchKRLHelpDesc,
+	}
+}
+
+func (b *backend) pathListCerts(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	serials, err := req.Storage.List(ctx, certStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := req.Storage.List(ctx, revokedStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+	isRevoked := make(map[string]bool, len(revoked))
+	for _, serial := range revoked {
+		isRevoked[serial] = true
+	}
+
+	keyInfo := make(map[string]interface{}, len(serials))
+	for _, serial := range serials {
+		record, err := fetchCertRecord(ctx, req.Storage, serial)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			continue
+		}
+
+		keyInfo[serial] = map[string]interface{}{
+			"key_id":     record.KeyID,
+			"cert_type":  record.CertificateType,
+			"role":       record.Role,
+			"expiration": record.Expiration,
+			"revoked":    isRevoked[serial],
+		}
+	}
+
+	return logical.ListResponseWithInfo(serials, keyInfo), nil
+}
+
+func (b *backend) pathFetchCert(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	serial, err := normalizeSerial(data.Get("serial_number").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	record, err := fetchCertRecord(ctx, req.Storage, serial)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, nil
+	}
+
+	revocation, err := fetchRevocation(ctx, req.Storage, serial)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"serial_number":    record.SerialNumber,
+			"key_id":           record.KeyID,
+			"cert_type":        record.CertificateType,
+			"valid_principals": record.ValidPrincipals,
+			"role":             record.Role,
+			"issuer_id":        record.IssuerID,
+			"issued_at":        record.IssuedAt,
+			"expiration":       record.Expiration,
+			"certificate":      record.Certificate,
+			"revoked":          revocation != nil,
+		},
+	}
+	if revocation != nil {
+		resp.Data["revocation_time"] = revocation.RevocationTime
+	}
+
+	return resp, nil
+}
+
+func (b *backend) pathRevoke(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	serialRaw := data.Get("serial_number").(string)
+	if serialRaw == "" {
+		return logical.ErrorResponse("missing serial_number"), nil
+	}
+	serial, err := normalizeSerial(serialRaw)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) {
+		return nil, logical.ErrReadOnly
+	}
+
+	record, err := fetchCertRecord(ctx, req.Storage, serial)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return logical.ErrorResponse(fmt.Sprintf("certificate with serial %s not found", serial)), nil
+	}
+
+	revocation, err := fetchRevocation(ctx, req.Storage, serial)
+	if err != nil {
+		return nil, err
+	}
+	if revocation == nil {
+		revocation = &revocationEntry{
+			SerialNumber:   record.SerialNumber,
+			IssuerID:       record.IssuerID,
+			KeyID:          record.KeyID,
+			Expiration:     record.Expiration,
+			RevocationTime: time.Now().UTC(),
+		}
+
+		entry, err := logical.StorageEntryJSON(revokedStoragePrefix+serial, revocation)
+		if err != nil {
+			return nil, err
+		}
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"revocation_time": revocation.RevocationTime,
+		},
+	}, nil
+}
+
+func (b *backend) pathFetchKRL(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	krl, err := buildKRL(ctx, req.Storage, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/octet-stream",
+			logical.HTTPRawBody:     krl,
+			logical.HTTPStatusCode:  200,
+		},
+	}, nil
+}
+
+// storeCertRecord records a certificate signed by the issuer for the role
+func storeCertRecord(ctx context.Context, s logical.Storage, roleName string, issuer *issuerEntry, certificate *ssh.Certificate) error {
+	certType := "user"
+	if certificate.CertType == ssh.HostCert {
+		certType = "host"
+	}
+
+	serial := strconv.FormatUint(certificate.Serial, 16)
+	record := &certEntry{
+		SerialNumber:    serial,
+		KeyID:           certificate.KeyId,
+		CertificateType: certType,
+		ValidPrincipals: certificate.ValidPrincipals,
+		Role:            roleName,
+		IssuerID:        issuer.ID,
+		IssuedAt:        time.Now().UTC(),
+		Expiration:      time.Unix(int64(certificate.ValidBefore), 0).UTC(),
+		Certificate:     string(ssh.MarshalAuthorizedKey(certificate)),
+	}
+
+	entry, err := logical.StorageEntryJSON(certStoragePrefix+serial, record)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+func fetchCertRecord(ctx context.Context, s logical.Storage, serial string) (*certEntry, error) {
+	entry, err := s.Get(ctx, certStoragePrefix+serial)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var record certEntry
+	if err := entry.DecodeJSON(&record); err != nil {
+		return nil, fmt.Errorf("error decoding certificate record: %w", err)
+	}
+
+	return &record, nil
+}
+
+func fetchRevocation(ctx context.Context, s logical.Storage, serial string) (*revocationEntry, error) {
+	entry, err := s.Get(ctx, revokedStoragePrefix+serial)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var revocation revocationEntry
+	if err := entry.DecodeJSON(&revocation); err != nil {
+		return nil, fmt.Errorf("error decoding revocation entry: %w", err)
+	}
+
+	return &revocation, nil
+}
+
+// normalizeSerial returns the serial number in the lowercase hex format used
+// to store it, as returned when signing
+func normalizeSerial(serial string) (string, error) {
+	parsed, err := parseSerial(serial)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(parsed, 16), nil
+}
+
+func parseSerial(serial string) (uint64, error) {
+	parsed, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(serial), "0x"), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid serial_number %q: must be a 64-bit hex number", serial)
+	}
+	return parsed, nil
+}
+
+const pathListCertsHelpSyn = `List the certificates issued by this mount.`
+
+const pathListCertsHelpDesc = `
+This endpoint lists the serial numbers of the certificates issued by this
+mount, along with their key IDs, types, roles, expirations and whether they
+have been revoked.
+`
+
+const pathFetchCertHelpSyn = `Fetch the record of an issued certificate.`
+
+const pathFetchCertHelpDesc = `
+This endpoint returns the record of the certificate with the given serial
+number: the certificate along with its key ID, principals, role, issuer and
+revocation status.
+`
+
+const pathRevokeHelpSyn = `Revoke an issued certificate.`
+
+const pathRevokeHelpDesc = `
+This endpoint revokes the certificate with the given serial number, adding
+it to the KRL served by the 'krl' endpoint until it expires. Revoking a
+certificate which is already revoked returns its original revocation time.
+`
+
+const pathFetchKRLHelpSyn = `Fetch the OpenSSH Key Revocation List of this mount.`
+
+const pathFetchKRLHelpDesc = `
+This endpoint returns, in binary OpenSSH KRL format, the revoked
+certificates of this mount which have not yet expired, for use with the
+'RevokedKeys' option of sshd.
+`
@@ -0,0 +1,149 @@
+package ssh
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestSSH_CertificateRevocation(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Cannot create backend: %s", err)
+	}
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %s %s: err: %v, resp: %v", operation, path, err, resp)
+		}
+		return resp
+	}
+
+	request(logical.UpdateOperation, "config/ca", map[string]interface{}{
+		"public_key":  testCAPublicKey,
+		"private_key": testCAPrivateKey,
+	})
+	request(logical.UpdateOperation, "roles/users", map[string]interface{}{
+		"key_type":                "ca",
+		"allow_user_certificates": true,
+		"allowed_users":           "*",
+		"allow_user_key_ids":      true,
+	})
+
+	sign := func(keyID string) (string, string) {
+		t.Helper()
+		resp := request(logical.UpdateOperation, "sign/users", map[string]interface{}{
+			"public_key":       publicKey2,
+			"valid_principals": "tuser",
+			"key_id":           keyID,
+		})
+		return resp.Data["serial_number"].(string), resp.Data["signed_key"].(string)
+	}
+	stolenSerial, stolenCert := sign("stolen-laptop")
+	_, otherCert := sign("other-laptop")
+
+	resp := request(logical.ListOperation, "certs", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 2 {
+		t.Fatalf("expected two certificates, got %v", keys)
+	}
+	info := resp.Data["key_info"].(map[string]interface{})[stolenSerial].(map[string]interface{})
+	if info["key_id"] != "stolen-laptop" || info["role"] != "users" || info["revoked"] != false {
+		t.Fatalf("bad key info: %#v", info)
+	}
+
+	resp = request(logical.ReadOperation, "cert/"+stolenSerial, nil)
+	if resp.Data["certificate"] != stolenCert || resp.Data["cert_type"] != "user" || resp.Data["revoked"] != false {
+		t.Fatalf("bad certificate record: %#v", resp.Data)
+	}
+
+	// The KRL is empty until a certificate is revoked
+	resp = request(logical.ReadOperation, "krl", nil)
+	emptyKRL := resp.Data[logical.HTTPRawBody].([]byte)
+	if binary.BigEndian.Uint64(emptyKRL) != krlMagic {
+		t.Fatalf("bad KRL magic: %x", emptyKRL)
+	}
+
+	resp = request(logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": strings.ToUpper(stolenSerial),
+	})
+	revocationTime := resp.Data["revocation_time"]
+	resp = request(logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": stolenSerial,
+	})
+	if resp.Data["revocation_time"] != revocationTime {
+		t.Fatalf("expected revoking again to be a no-op")
+	}
+
+	resp = request(logical.ReadOperation, "cert/"+stolenSerial, nil)
+	if resp.Data["revoked"] != true {
+		t.Fatalf("expected the certificate to be revoked: %#v", resp.Data)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "revoke",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"serial_number": "abcdef",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected revoking an unknown certificate to fail, got err: %v, resp: %v", err, resp)
+	}
+
+	resp = request(logical.ReadOperation, "krl", nil)
+	krl := resp.Data[logical.HTTPRawBody].([]byte)
+	if len(krl) <= len(emptyKRL) {
+		t.Fatalf("expected the KRL to contain the revoked certificate")
+	}
+
+	// Check the KRL with OpenSSH, if available
+	sshKeygen, err := exec.LookPath("ssh-keygen")
+	if err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+	dir := t.TempDir()
+	krlPath := filepath.Join(dir, "krl")
+	if err := os.WriteFile(krlPath, krl, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	checkRevoked := func(cert string) bool {
+		t.Helper()
+		certPath := filepath.Join(dir, "key-cert.pub")
+		if err := os.WriteFile(certPath, []byte(cert), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		out, err := exec.Command(sshKeygen, "-Q", "-f", krlPath, certPath).CombinedOutput()
+		switch {
+		case err == nil:
+			return false
+		case strings.Contains(string(out), "REVOKED"):
+			return true
+		default:
+			t.Fatalf("ssh-keygen failed: %v: %s", err, out)
+			return false
+		}
+	}
+	if !checkRevoked(stolenCert) {
+		t.Fatal("expected the revoked certificate to be in the KRL")
+	}
+	if checkRevoked(otherCert) {
+		t.Fatal("expected the other certificate not to be in the KRL")
+	}
+}
@@ -2,6 +2,10 @@ package ssh
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -9,8 +13,8 @@ import (
 	"fmt"
 	"io"
 
-	multierror "github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/logical"
 	"golang.org/x/crypto/ssh"
 )
@@ -31,21 +35,7 @@ type keyStorageEntry struct {
 func pathConfigCA(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "config/ca",
-		Fields: map[string]*framework.FieldSchema{
-			"private_key": {
-				Type:        framework.TypeString,
-				Description: `Private half of the SSH key that will be used to sign certificates.`,
-			},
-			"public_key": {
-				Type:        framework.TypeString,
-				Description: `Public half of the SSH key that will be used to sign certificates.`,
-			},
-			"generate_signing_key": {
-				Type:        framework.TypeBool,
-				Description: `Generate SSH key pair internally rather than use the private_key and public_key fields.`,
-				Default:     true,
-			},
-		},
+		Fields:  caKeyPairFields(),
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.UpdateOperation: b.pathConfigCAUpdate,
@@ -57,25 +47,66 @@ func pathConfigCA(b *backend) *framework.Path {
 		HelpDescription: `This sets the CA information used for certificates generated by this
 by this mount. The fields must be in the standard private and public SSH format.
 
+The keys are stored as the default issuer of the mount; additional
+issuers can be managed using the 'issuers/' endpoints.
+
 For security reasons, the private key cannot be retrieved later.
 
 Read operations will return the public key, if already stored/generated.`,
 	}
 }
 
+// caKeyPairFields returns the fields used to provide or generate a CA key
+// pair.
+func caKeyPairFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"private_key": {
+			Type:        framework.TypeString,
+			Description: `Private half of the SSH key that will be used to sign certificates.`,
+		},
+		"public_key": {
+			Type:        framework.TypeString,
+			Description: `Public half of the SSH key that will be used to sign certificates.`,
+		},
+		"generate_signing_key": {
+			Type:        framework.TypeBool,
+			Description: `Generate SSH key pair internally rather than use the private_key and public_key fields.`,
+			Default:     true,
+		},
+		"key_type": {
+			Type: framework.TypeString,
+			Description: `Specifies the desired key type when generating; could be an OpenSSH key type identifier
+(ssh-rsa, ecdsa-sha2-nistp256, ecdsa-sha2-nistp384, ecdsa-sha2-nistp521, or ssh-ed25519) or
+an algorithm (rsa, ec, ed25519).`,
+			Default: ssh.KeyAlgoRSA,
+		},
+		"key_bits": {
+			Type: framework.TypeInt,
+			Description: `Specifies the desired key bits when generating variable-length keys (such as when
+key_type="ssh-rsa") or which NIST P-curve to use when key_type="ec" (256, 384, or 521).`,
+			Default: 0,
+		},
+	}
+}
+
 func (b *backend) pathConfigCARead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	publicKeyEntry, err := caKey(ctx, req.Storage, caPublicKey)
+	config, err := getIssuersConfig(ctx, req.Storage)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read CA public key: %w", err)
+		return nil, fmt.Errorf("failed to read issuers configuration: %w", err)
 	}
 
-	if publicKeyEntry == nil {
+	if len(config.DefaultIssuerID) == 0 {
 		return logical.ErrorResponse("keys haven't been configured yet"), nil
 	}
 
+	issuer, err := fetchIssuerByID(ctx, req.Storage, config.DefaultIssuerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA public key: %w", err)
+	}
+
 	response := &logical.Response{
 		Data: map[string]interface{}{
-			"public_key": publicKeyEntry.Key,
+			"public_key": issuer.PublicKey,
 		},
 	}
 
@@ -83,6 +114,19 @@ func (b *backend) pathConfigCARead(ctx context.Context, req *logical.Request, da
 }
 
 func (b *backend) pathConfigCADelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	config, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.DefaultIssuerID) != 0 {
+		if _, err := deleteIssuer(ctx, req.Storage, config.DefaultIssuerID); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := req.Storage.Delete(ctx, caPrivateKeyStoragePath); err != nil {
 		return nil, err
 	}
@@ -145,18 +189,59 @@ func caKey(ctx context.Context, storage logical.Storage, keyType string) (*keySt
 }
 
 func (b *backend) pathConfigCAUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	publicKey, privateKey, generated, errResp, err := b.caKeyPairFromRequest(data)
+	if errResp != nil || err != nil {
+		return errResp, err
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	config, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read issuers configuration: %w", err)
+	}
+
+	if len(config.DefaultIssuerID) != 0 {
+		return logical.ErrorResponse("keys are already configured; delete them before reconfiguring"), nil
+	}
+
+	if _, err := createIssuer(ctx, req.Storage, publicKey, privateKey, ""); err != nil {
+		return nil, fmt.Errorf("failed to store CA keys: %w", err)
+	}
+
+	if generated {
+		response := &logical.Response{
+			Data: map[string]interface{}{
+				"public_key": publicKey,
+			},
+		}
+
+		return response, nil
+	}
+
+	return nil, nil
+}
+
+// caKeyPairFromRequest returns the CA key pair given by the public_key and
+// private_key fields, or a newly generated one, along with whether it was
+// generated.
+func (b *backend) caKeyPairFromRequest(data *framework.FieldData) (string, string, bool, *logical.Response, error) {
 	var err error
 	publicKey := data.Get("public_key").(string)
 	privateKey := data.Get("private_key").(string)
 
 	var generateSigningKey bool
 
+	_, keyTypeSet := data.GetOk("key_type")
+	_, keyBitsSet := data.GetOk("key_bits")
+
 	generateSigningKeyRaw, ok := data.GetOk("generate_signing_key")
 	switch {
 	// explicitly set true
 	case ok && generateSigningKeyRaw.(bool):
 		if publicKey != "" || privateKey != "" {
-			return logical.ErrorResponse("public_key and private_key must not be set when generate_signing_key is set to true"), nil
+			return "", "", false, logical.ErrorResponse("public_key and private_key must not be set when generate_signing_key is set to true"), nil
 		}
 
 		generateSigningKey = true
@@ -164,21 +249,21 @@ func (b *backend) pathConfigCAUpdate(ctx context.Context, req *logical.Request,
 	// explicitly set to false, or not set and we have both a public and private key
 	case ok, publicKey != "" && privateKey != "":
 		if publicKey == "" {
-			return logical.ErrorResponse("missing public_key"), nil
+			return "", "", false, logical.ErrorResponse("missing public_key"), nil
 		}
 
 		if privateKey == "" {
-			return logical.ErrorResponse("missing private_key"), nil
+			return "", "", false, logical.ErrorResponse("missing private_key"), nil
 		}
 
 		_, err := ssh.ParsePrivateKey([]byte(privateKey))
 		if err != nil {
-			return logical.ErrorResponse(fmt.Sprintf("Unable to parse private_key as an SSH private key: %v", err)), nil
+			return "", "", false, logical.ErrorResponse(fmt.Sprintf("Unable to parse private_key as an SSH private key: %v", err)), nil
 		}
 
 		_, err = parsePublicSSHKey(publicKey)
 		if err != nil {
-			return logical.ErrorResponse(fmt.Sprintf("Unable to parse public_key as an SSH public key: %v", err)), nil
+			return "", "", false, logical.ErrorResponse(fmt.Sprintf("Unable to parse public_key as an SSH public key: %v", err)), nil
 		}
 
 	// not set and no public/private key provided so generate
@@ -187,100 +272,117 @@ func (b *backend) pathConfigCAUpdate(ctx context.Context, req *logical.Request,
 
 	// not set, but one or the other supplied
 	default:
-		return logical.ErrorResponse("only one of public_key and private_key set; both must be set to use, or both must be blank to auto-generate"), nil
+		return "", "", false, logical.ErrorResponse("only one of public_key and private_key set; both must be set to use, or both must be blank to auto-generate"), nil
 	}
 
 	if generateSigningKey {
-		publicKey, privateKey, err = generateSSHKeyPair(b.Backend.GetRandomReader())
+		publicKey, privateKey, err = generateSSHKeyPair(b.Backend.GetRandomReader(), data.Get("key_type").(string), data.Get("key_bits").(int))
 		if err != nil {
-			return nil, err
+			if _, ok := err.(errutil.UserError); ok {
+				return "", "", false, logical.ErrorResponse(err.Error()), nil
+			}
+			return "", "", false, nil, err
 		}
+	} else if keyTypeSet || keyBitsSet {
+		return "", "", false, logical.ErrorResponse("key_type and key_bits can only be set when generating the signing key"), nil
 	}
 
 	if publicKey == "" || privateKey == "" {
-		return nil, fmt.Errorf("failed to generate or parse the keys")
+		return "", "", false, nil, fmt.Errorf("failed to generate or parse the keys")
 	}
 
-	publicKeyEntry, err := caKey(ctx, req.Storage, caPublicKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CA public key: %w", err)
-	}
-
-	privateKeyEntry, err := caKey(ctx, req.Storage, caPrivateKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CA private key: %w", err)
-	}
+	return publicKey, privateKey, generateSigningKey, nil, nil
+}
 
-	if (publicKeyEntry != nil && publicKeyEntry.Key != "") || (privateKeyEntry != nil && privateKeyEntry.Key != "") {
-		return logical.ErrorResponse("keys are already configured; delete them before reconfiguring"), nil
+func generateSSHKeyPair(randomSource io.Reader, keyType string, keyBits int) (string, string, error) {
+	if randomSource == nil {
+		randomSource = rand.Reader
 	}
 
-	entry, err := logical.StorageEntryJSON(caPublicKeyStoragePath, &keyStorageEntry{
-		Key: publicKey,
-	})
-	if err != nil {
-		return nil, err
-	}
+	var publicKey crypto.PublicKey
+	var privateBlock *pem.Block
 
-	// Save the public key
-	err = req.Storage.Put(ctx, entry)
-	if err != nil {
-		return nil, err
-	}
+	switch keyType {
+	case ssh.KeyAlgoRSA, "rsa":
+		if keyBits == 0 {
+			keyBits = 4096
+		}
+		if keyBits < 2048 {
+			return "", "", errutil.UserError{Err: fmt.Sprintf("refusing to generate weak %v key: %v bits < 2048 bits", keyType, keyBits)}
+		}
 
-	entry, err = logical.StorageEntryJSON(caPrivateKeyStoragePath, &keyStorageEntry{
-		Key: privateKey,
-	})
-	if err != nil {
-		return nil, err
-	}
+		privateSeed, err := rsa.GenerateKey(randomSource, keyBits)
+		if err != nil {
+			return "", "", err
+		}
 
-	// Save the private key
-	err = req.Storage.Put(ctx, entry)
-	if err != nil {
-		var mErr *multierror.Error
+		privateBlock = &pem.Block{
+			Type:    "RSA PRIVATE KEY",
+			Headers: nil,
+			Bytes:   x509.MarshalPKCS1PrivateKey(privateSeed),
+		}
+		publicKey = &privateSeed.PublicKey
+
+	case ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521, "ec":
+		var curve elliptic.Curve
+		switch {
+		case keyType == ssh.KeyAlgoECDSA256, keyType == "ec" && (keyBits == 0 || keyBits == 256):
+			curve = elliptic.P256()
+		case keyType == ssh.KeyAlgoECDSA384, keyType == "ec" && keyBits == 384:
+			curve = elliptic.P384()
+		case keyType == ssh.KeyAlgoECDSA521, keyType == "ec" && keyBits == 521:
+			curve = elliptic.P521()
+		default:
+			return "", "", errutil.UserError{Err: fmt.Sprintf("unknown ECDSA key pair algorithm: %v with %v bits", keyType, keyBits)}
+		}
+		if keyType != "ec" && keyBits != 0 && keyBits != curve.Params().BitSize {
+			return "", "", errutil.UserError{Err: fmt.Sprintf("key_bits %v does not match key_type %v", keyBits, keyType)}
+		}
 
-		mErr = multierror.Append(mErr, fmt.Errorf("failed to store CA private key: %w", err))
+		privateSeed, err := ecdsa.GenerateKey(curve, randomSource)
+		if err != nil {
+			return "", "", err
+		}
 
-		// If storing private key fails, the corresponding public key should be
-		// removed
-		if delErr := req.Storage.Delete(ctx, caPublicKeyStoragePath); delErr != nil {
-			mErr = multierror.Append(mErr, fmt.Errorf("failed to cleanup CA public key: %w", delErr))
-			return nil, mErr
+		marshalled, err := x509.MarshalECPrivateKey(privateSeed)
+		if err != nil {
+			return "", "", err
 		}
 
-		return nil, err
-	}
+		privateBlock = &pem.Block{
+			Type:    "EC PRIVATE KEY",
+			Headers: nil,
+			Bytes:   marshalled,
+		}
+		publicKey = &privateSeed.PublicKey
 
-	if generateSigningKey {
-		response := &logical.Response{
-			Data: map[string]interface{}{
-				"public_key": publicKey,
-			},
+	case ssh.KeyAlgoED25519, "ed25519":
+		if keyBits != 0 {
+			return "", "", errutil.UserError{Err: fmt.Sprintf("key_bits cannot be set for key_type %v", keyType)}
 		}
 
-		return response, nil
-	}
+		public, privateSeed, err := ed25519.GenerateKey(randomSource)
+		if err != nil {
+			return "", "", err
+		}
 
-	return nil, nil
-}
+		marshalled, err := x509.MarshalPKCS8PrivateKey(privateSeed)
+		if err != nil {
+			return "", "", err
+		}
 
-func generateSSHKeyPair(randomSource io.Reader) (string, string, error) {
-	if randomSource == nil {
-		randomSource = rand.Reader
-	}
-	privateSeed, err := rsa.GenerateKey(randomSource, 4096)
-	if err != nil {
-		return "", "", err
-	}
+		privateBlock = &pem.Block{
+			Type:    "PRIVATE KEY",
+			Headers: nil,
+			Bytes:   marshalled,
+		}
+		publicKey = public
 
-	privateBlock := &pem.Block{
-		Type:    "RSA PRIVATE KEY",
-		Headers: nil,
-		Bytes:   x509.MarshalPKCS1PrivateKey(privateSeed),
+	default:
+		return "", "", errutil.UserError{Err: fmt.Sprintf("unknown ssh key pair algorithm: %v", keyType)}
 	}
 
-	public, err := ssh.NewPublicKey(&privateSeed.PublicKey)
+	public, err := ssh.NewPublicKey(publicKey)
 	if err != nil {
 		return "", "", err
 	}
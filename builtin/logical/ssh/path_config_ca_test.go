@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestSSH_ConfigCAStorageUpgrade(t *testing.T) {
@@ -168,3 +169,126 @@ func TestSSH_ConfigCAUpdateDelete(t *testing.T) {
 		t.Fatalf("bad: err: %v, resp:%v", err, resp)
 	}
 }
+
+func TestSSH_ConfigCAKeyTypes(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Cannot create backend: %s", err)
+	}
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+	}
+
+	cases := []struct {
+		keyType       string
+		keyBits       int
+		expectedType  string
+		roleAlgorithm string
+	}{
+		{"rsa", 2048, ssh.KeyAlgoRSA, ssh.SigAlgoRSASHA2256},
+		{"ssh-ed25519", 0, ssh.KeyAlgoED25519, ""},
+		{"ed25519", 0, ssh.KeyAlgoED25519, ssh.KeyAlgoED25519},
+		{"ec", 0, ssh.KeyAlgoECDSA256, ""},
+		{"ec", 384, ssh.KeyAlgoECDSA384, ""},
+		{"ecdsa-sha2-nistp521", 521, ssh.KeyAlgoECDSA521, ssh.KeyAlgoECDSA521},
+	}
+	var lastIssuerID issuerID
+	for _, tc := range cases {
+		resp, err := request(logical.UpdateOperation, "issuers/import", map[string]interface{}{
+			"generate_signing_key": true,
+			"key_type":             tc.keyType,
+			"key_bits":             tc.keyBits,
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("failed to generate %s key: err: %v, resp: %v", tc.keyType, err, resp)
+		}
+		if resp.Data["key_type"] != tc.expectedType {
+			t.Fatalf("expected a %s key, got %v", tc.expectedType, resp.Data["key_type"])
+		}
+		lastIssuerID = resp.Data["issuer_id"].(issuerID)
+
+		resp, err = request(logical.UpdateOperation, "roles/test", map[string]interface{}{
+			"key_type":                "ca",
+			"allow_user_certificates": true,
+			"allowed_users":           "*",
+			"issuer_ref":              lastIssuerID.String(),
+			"algorithm_signer":        tc.roleAlgorithm,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("failed to write role: err: %v, resp: %v", err, resp)
+		}
+
+		resp, err = request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+			"public_key":       publicKey2,
+			"valid_principals": "tuser",
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("failed to sign with %s key: err: %v, resp: %v", tc.keyType, err, resp)
+		}
+
+		parsedKey, err := parsePublicSSHKey(resp.Data["signed_key"].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert := parsedKey.(*ssh.Certificate)
+		if cert.SignatureKey.Type() != tc.expectedType {
+			t.Fatalf("expected a certificate signed by a %s key, got %s", tc.expectedType, cert.SignatureKey.Type())
+		}
+		expectedFormat := tc.expectedType
+		if tc.roleAlgorithm != "" {
+			expectedFormat = tc.roleAlgorithm
+		}
+		if cert.Signature.Format != expectedFormat {
+			t.Fatalf("expected a %s signature, got %s", expectedFormat, cert.Signature.Format)
+		}
+		checker := &ssh.CertChecker{
+			IsUserAuthority: func(ssh.PublicKey) bool { return true },
+		}
+		if err := checker.CheckCert("tuser", cert); err != nil {
+			t.Fatalf("invalid certificate signature: %v", err)
+		}
+	}
+
+	// RSA signature algorithms can't be used with other CA keys
+	resp, err := request(logical.UpdateOperation, "roles/test", map[string]interface{}{
+		"key_type":                "ca",
+		"allow_user_certificates": true,
+		"allowed_users":           "*",
+		"issuer_ref":              lastIssuerID.String(),
+		"algorithm_signer":        ssh.SigAlgoRSASHA2512,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write role: err: %v, resp: %v", err, resp)
+	}
+	resp, err = request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+		"public_key":       publicKey2,
+		"valid_principals": "tuser",
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected signing with an ECDSA key and an RSA algorithm to fail, got: %v", resp)
+	}
+
+	invalid := []map[string]interface{}{
+		{"generate_signing_key": true, "key_type": "rsa", "key_bits": 1024},
+		{"generate_signing_key": true, "key_type": "ec", "key_bits": 300},
+		{"generate_signing_key": true, "key_type": "ecdsa-sha2-nistp256", "key_bits": 384},
+		{"generate_signing_key": true, "key_type": "ed25519", "key_bits": 256},
+		{"generate_signing_key": true, "key_type": "dsa"},
+		{"public_key": testCAPublicKey, "private_key": testCAPrivateKey, "key_type": "ed25519"},
+	}
+	for _, data := range invalid {
+		resp, err := request(logical.UpdateOperation, "issuers/import", data)
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected %v to be rejected, got err: %v, resp: %v", data, err, resp)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package ssh
 
 import (
 	"context"
+	"strings"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -15,27 +16,116 @@ func pathFetchPublicKey(b *backend) *framework.Path {
 			logical.ReadOperation: b.pathFetchPublicKey,
 		},
 
-		HelpSynopsis:    `Retrieve the public key.`,
-		HelpDescription: `This allows the public key, that this backend has been configured with, to be fetched.`,
+		HelpSynopsis: `Retrieve the public key.`,
+		HelpDescription: `This allows the public keys of the issuers this backend has been configured with
+to be fetched, one per line and starting with the default issuer, so that hosts
+can trust all of them while the CA is being rotated.`,
 	}
 }
 
 func (b *backend) pathFetchPublicKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	publicKeyEntry, err := caKey(ctx, req.Storage, caPublicKey)
+	publicKeys, err := fetchIssuerPublicKeys(ctx, req.Storage)
 	if err != nil {
 		return nil, err
 	}
-	if publicKeyEntry == nil || publicKeyEntry.Key == "" {
+	if len(publicKeys) == 0 {
 		return nil, nil
 	}
 
 	response := &logical.Response{
 		Data: map[string]interface{}{
 			logical.HTTPContentType: "text/plain",
-			logical.HTTPRawBody:     []byte(publicKeyEntry.Key),
+			logical.HTTPRawBody:     []byte(strings.Join(publicKeys, "")),
 			logical.HTTPStatusCode:  200,
 		},
 	}
 
 	return response, nil
 }
+
+func pathFetchKnownHosts(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `known_hosts`,
+		Fields: map[string]*framework.FieldSchema{
+			"host_pattern": {
+				Type: framework.TypeString,
+				Description: `The known_hosts host pattern the CA is trusted for,
+for instance "*.example.com". Defaults to "*".`,
+				Default: "*",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathFetchKnownHosts,
+		},
+
+		HelpSynopsis: `Retrieve the known_hosts lines trusting the CA for host certificates.`,
+		HelpDescription: `This allows the '@cert-authority' known_hosts lines of the issuers this backend
+has been configured with to be fetched, one per issuer and starting with the
+default issuer, so that clients can verify host certificates signed by them.`,
+	}
+}
+
+func (b *backend) pathFetchKnownHosts(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	hostPattern := strings.TrimSpace(data.Get("host_pattern").(string))
+	if hostPattern == "" || strings.ContainsAny(hostPattern, " \t\r\n") {
+		return logical.ErrorResponse("host_pattern must be non-empty and may not contain whitespace"), nil
+	}
+
+	publicKeys, err := fetchIssuerPublicKeys(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if len(publicKeys) == 0 {
+		return nil, nil
+	}
+
+	var knownHosts strings.Builder
+	for _, publicKey := range publicKeys {
+		knownHosts.WriteString("@cert-authority " + hostPattern + " " + publicKey)
+	}
+
+	response := &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "text/plain",
+			logical.HTTPRawBody:     []byte(knownHosts.String()),
+			logical.HTTPStatusCode:  200,
+		},
+	}
+
+	return response, nil
+}
+
+// fetchIssuerPublicKeys returns the public keys of all issuers in
+// authorized_keys format, starting with the default issuer.
+func fetchIssuerPublicKeys(ctx context.Context, s logical.Storage) ([]string, error) {
+	issuers, err := listIssuers(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := getIssuersConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	var publicKeys []string
+	for _, id := range issuers {
+		issuer, err := fetchIssuerByID(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+
+		publicKey := issuer.PublicKey
+		if !strings.HasSuffix(publicKey, "\n") {
+			publicKey += "\n"
+		}
+		if id == config.DefaultIssuerID {
+			publicKeys = append([]string{publicKey}, publicKeys...)
+		} else {
+			publicKeys = append(publicKeys, publicKey)
+		}
+	}
+
+	return publicKeys, nil
+}
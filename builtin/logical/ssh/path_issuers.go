@@ -0,0 +1,307 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const issuerRefParam = "issuer_ref"
+
+func pathListIssuers(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuers/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathListIssuersHandler,
+		},
+
+		HelpSynopsis:    pathListIssuersHelpSyn,
+		HelpDescription: pathListIssuersHelpDesc,
+	}
+}
+
+func pathImportIssuer(b *backend) *framework.Path {
+	fields := caKeyPairFields()
+	fields["issuer_name"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Provide a name for the issuer; the name must be
+unique across all issuers and may not be the
+reserved value "default".`,
+	}
+
+	return &framework.Path{
+		Pattern: "issuers/import",
+		Fields:  fields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportIssuerHandler,
+		},
+
+		HelpSynopsis:    pathImportIssuerHelpSyn,
+		HelpDescription: pathImportIssuerHelpDesc,
+	}
+}
+
+func pathGetIssuer(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuer/" + framework.GenericNameRegex(issuerRefParam),
+		Fields: map[string]*framework.FieldSchema{
+			issuerRefParam: {
+				Type: framework.TypeString,
+				Description: `Reference to an issuer, either "default", the
+name of an issuer or its identifier.`,
+			},
+			"issuer_name": {
+				Type: framework.TypeString,
+				Description: `Provide a name for the issuer; the name must be
+unique across all issuers and may not be the
+reserved value "default".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathGetIssuerHandler,
+			logical.UpdateOperation: b.pathUpdateIssuerHandler,
+			logical.DeleteOperation: b.pathDeleteIssuerHandler,
+		},
+
+		HelpSynopsis:    pathGetIssuerHelpSyn,
+		HelpDescription: pathGetIssuerHelpDesc,
+	}
+}
+
+func pathConfigIssuers(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/issuers",
+		Fields: map[string]*framework.FieldSchema{
+			defaultRef: {
+				Type:        framework.TypeString,
+				Description: `Reference (name or identifier) to the default issuer.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigIssuersRead,
+			logical.UpdateOperation: b.pathConfigIssuersWrite,
+		},
+
+		HelpSynopsis:    pathConfigIssuersHelpSyn,
+		HelpDescription: pathConfigIssuersHelpDesc,
+	}
+}
+
+func (b *backend) pathListIssuersHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	var responseKeys []string
+	responseInfo := make(map[string]interface{})
+
+	entries, err := listIssuers(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, identifier := range entries {
+		issuer, err := fetchIssuerByID(ctx, req.Storage, identifier)
+		if err != nil {
+			return nil, err
+		}
+
+		responseKeys = append(responseKeys, identifier.String())
+		responseInfo[identifier.String()] = map[string]interface{}{
+			"issuer_name": issuer.Name,
+			"is_default":  identifier == config.DefaultIssuerID,
+		}
+	}
+
+	return logical.ListResponseWithInfo(responseKeys, responseInfo), nil
+}
+
+func (b *backend) pathImportIssuerHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuerName := data.Get("issuer_name").(string)
+
+	publicKey, privateKey, _, errResp, err := b.caKeyPairFromRequest(data)
+	if errResp != nil || err != nil {
+		return errResp, err
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	issuer, err := createIssuer(ctx, req.Storage, publicKey, privateKey, issuerName)
+	if err != nil {
+		return handleStorageError(err)
+	}
+
+	return &logical.Response{
+		Data: respondReadIssuer(issuer),
+	}, nil
+}
+
+func (b *backend) pathGetIssuerHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuer, err := fetchIssuerByRef(ctx, req.Storage, data.Get(issuerRefParam).(string))
+	if err != nil {
+		return handleStorageError(err)
+	}
+
+	return &logical.Response{
+		Data: respondReadIssuer(issuer),
+	}, nil
+}
+
+func (b *backend) pathUpdateIssuerHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	issuer, err := fetchIssuerByRef(ctx, req.Storage, data.Get(issuerRefParam).(string))
+	if err != nil {
+		return handleStorageError(err)
+	}
+
+	if newName, ok := data.GetOk("issuer_name"); ok && newName.(string) != issuer.Name {
+		if err := checkIssuerNameAvailable(ctx, req.Storage, newName.(string), issuer.ID); err != nil {
+			return handleStorageError(err)
+		}
+
+		issuer.Name = newName.(string)
+		if err := writeIssuer(ctx, req.Storage, issuer); err != nil {
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: respondReadIssuer(issuer),
+	}, nil
+}
+
+func (b *backend) pathDeleteIssuerHandler(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	id, err := resolveIssuerReference(ctx, req.Storage, data.Get(issuerRefParam).(string))
+	if err != nil {
+		if _, ok := err.(errutil.UserError); ok {
+			// Deleting an issuer which doesn't exist is a no-op.
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	wasDefault, err := deleteIssuer(ctx, req.Storage, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *logical.Response
+	if wasDefault {
+		resp = &logical.Response{}
+		resp.AddWarning(fmt.Sprintf("Deleted issuer %v was the default issuer; roles using the default issuer can no longer sign certificates until a new default issuer is set.", id))
+	}
+
+	return resp, nil
+}
+
+func (b *backend) pathConfigIssuersRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			defaultRef: config.DefaultIssuerID,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigIssuersWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	newDefault := data.Get(defaultRef).(string)
+	if len(newDefault) == 0 || newDefault == defaultRef {
+		return logical.ErrorResponse("Invalid issuer specification; must be non-empty and can't be 'default'."), nil
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	id, err := resolveIssuerReference(ctx, req.Storage, newDefault)
+	if err != nil {
+		return handleStorageError(err)
+	}
+
+	if err := setIssuersConfig(ctx, req.Storage, &issuerConfigEntry{DefaultIssuerID: id}); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			defaultRef: id,
+		},
+	}, nil
+}
+
+func respondReadIssuer(issuer *issuerEntry) map[string]interface{} {
+	resp := map[string]interface{}{
+		"issuer_id":   issuer.ID,
+		"issuer_name": issuer.Name,
+		"public_key":  issuer.PublicKey,
+	}
+	if publicKey, err := parsePublicSSHKey(issuer.PublicKey); err == nil {
+		resp["key_type"] = publicKey.Type()
+	}
+	return resp
+}
+
+func handleStorageError(err error) (*logical.Response, error) {
+	switch err.(type) {
+	case errutil.UserError:
+		return logical.ErrorResponse(err.Error()), nil
+	default:
+		return nil, err
+	}
+}
+
+const pathListIssuersHelpSyn = `List the CA issuers of this mount.`
+
+const pathListIssuersHelpDesc = `
+This endpoint lists the identifiers of the issuers of this mount, along with
+their names and whether they are the default issuer.
+`
+
+const pathImportIssuerHelpSyn = `Add a CA issuer to this mount.`
+
+const pathImportIssuerHelpDesc = `
+This endpoint stores the given CA key pair as a new issuer, or generates a
+new key pair when public_key and private_key are not provided. The first
+issuer of the mount becomes its default issuer.
+
+Roles sign certificates with the issuer referenced by their issuer_ref,
+and the public keys of all issuers are served by the 'public_key' endpoint.
+To rotate the CA, add a new issuer, distribute the public keys, make the new
+issuer the default using 'config/issuers', and delete the old issuer once
+no certificates signed by it remain in use.
+
+For security reasons, the private key cannot be retrieved later.
+`
+
+const pathGetIssuerHelpSyn = `Fetch, rename or delete a CA issuer.`
+
+const pathGetIssuerHelpDesc = `
+This endpoint returns the identifier, name and public key of an issuer. The
+issuer can be renamed by updating its issuer_name, and deleted; roles
+referencing a deleted issuer can no longer sign certificates.
+`
+
+const pathConfigIssuersHelpSyn = `Read and set the default issuer of this mount.`
+
+const pathConfigIssuersHelpDesc = `
+This endpoint allows getting and setting the default issuer, which signs
+certificates for roles using the "default" issuer_ref and whose key is
+returned by the 'config/ca' endpoint.
+`
@@ -0,0 +1,251 @@
+package ssh
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSH_Issuers(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Cannot create backend: %s", err)
+	}
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %s %s: err: %v, resp: %v", operation, path, err, resp)
+		}
+		return resp
+	}
+
+	// The legacy endpoint creates the default issuer
+	request(logical.UpdateOperation, "config/ca", map[string]interface{}{
+		"public_key":  testCAPublicKey,
+		"private_key": testCAPrivateKey,
+	})
+	resp := request(logical.ReadOperation, "config/issuers", nil)
+	oldID := resp.Data["default"].(issuerID)
+	if oldID == "" {
+		t.Fatal("expected a default issuer")
+	}
+
+	// Add a second issuer, which does not become the default
+	resp = request(logical.UpdateOperation, "issuers/import", map[string]interface{}{
+		"issuer_name": "next",
+	})
+	newID := resp.Data["issuer_id"].(issuerID)
+	newPublicKey := resp.Data["public_key"].(string)
+	if newID == "" || newPublicKey == "" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = request(logical.ReadOperation, "issuer/default", nil)
+	if resp.Data["issuer_id"] != oldID {
+		t.Fatalf("expected the default issuer to be unchanged, got %v", resp.Data["issuer_id"])
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "issuers/import",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"issuer_name": "next",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected duplicate issuer name to be rejected, got err: %v, resp: %v", err, resp)
+	}
+
+	resp = request(logical.ListOperation, "issuers", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 2 {
+		t.Fatalf("expected two issuers, got %v", keys)
+	}
+
+	// The public keys of both issuers are served, the default one first
+	resp = request(logical.ReadOperation, "public_key", nil)
+	publicKeys := string(resp.Data[logical.HTTPRawBody].([]byte))
+	if publicKeys != testCAPublicKey+newPublicKey {
+		t.Fatalf("bad public keys: %q", publicKeys)
+	}
+
+	signingKey := func(role string) ssh.PublicKey {
+		t.Helper()
+		resp := request(logical.UpdateOperation, "sign/"+role, map[string]interface{}{
+			"public_key":       publicKey2,
+			"valid_principals": "tuser",
+		})
+		parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(resp.Data["signed_key"].(string)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsedKey.(*ssh.Certificate).SignatureKey
+	}
+	parsePublicKey := func(key string) ssh.PublicKey {
+		t.Helper()
+		parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsedKey
+	}
+	sameKey := func(a, b ssh.PublicKey) bool {
+		return string(a.Marshal()) == string(b.Marshal())
+	}
+
+	roleData := map[string]interface{}{
+		"key_type":                "ca",
+		"allow_user_certificates": true,
+		"allowed_users":           "*",
+	}
+	request(logical.UpdateOperation, "roles/default", roleData)
+	roleData["issuer_ref"] = "next"
+	request(logical.UpdateOperation, "roles/pinned", roleData)
+
+	resp = request(logical.ReadOperation, "roles/default", nil)
+	if resp.Data["issuer_ref"] != defaultRef {
+		t.Fatalf("bad issuer_ref: %v", resp.Data["issuer_ref"])
+	}
+
+	if !sameKey(signingKey("default"), parsePublicKey(testCAPublicKey)) {
+		t.Fatal("expected the default role to sign with the default issuer")
+	}
+	if !sameKey(signingKey("pinned"), parsePublicKey(newPublicKey)) {
+		t.Fatal("expected the pinned role to sign with its issuer")
+	}
+
+	// Rotate the default issuer
+	request(logical.UpdateOperation, "config/issuers", map[string]interface{}{
+		"default": "next",
+	})
+	if !sameKey(signingKey("default"), parsePublicKey(newPublicKey)) {
+		t.Fatal("expected the default role to sign with the new default issuer")
+	}
+	resp = request(logical.ReadOperation, "config/ca", nil)
+	if resp.Data["public_key"] != newPublicKey {
+		t.Fatalf("bad config/ca public key: %v", resp.Data["public_key"])
+	}
+
+	// Retire the old issuer
+	request(logical.DeleteOperation, "issuer/"+oldID.String(), nil)
+	resp = request(logical.ReadOperation, "public_key", nil)
+	if publicKeys := string(resp.Data[logical.HTTPRawBody].([]byte)); publicKeys != newPublicKey {
+		t.Fatalf("bad public keys: %q", publicKeys)
+	}
+
+	// Roles can't reference missing issuers
+	roleData["issuer_ref"] = oldID.String()
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/missing",
+		Storage:   config.StorageView,
+		Data:      roleData,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected missing issuer to be rejected, got err: %v, resp: %v", err, resp)
+	}
+}
+
+func TestSSH_IssuersLegacyMigration(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	ctx := context.Background()
+
+	for path, key := range map[string]string{
+		caPublicKeyStoragePathDeprecated:  testCAPublicKey,
+		caPrivateKeyStoragePathDeprecated: testCAPrivateKey,
+	} {
+		if err := config.StorageView.Put(ctx, &logical.StorageEntry{
+			Key:   path,
+			Value: []byte(key),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := Factory(ctx, config)
+	if err != nil {
+		t.Fatalf("Cannot create backend: %s", err)
+	}
+	if err := b.Initialize(ctx, &logical.InitializationRequest{Storage: config.StorageView}); err != nil {
+		t.Fatal(err)
+	}
+
+	issuer, err := fetchIssuerByRef(ctx, config.StorageView, defaultRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issuer.PublicKey != testCAPublicKey || issuer.PrivateKey != testCAPrivateKey {
+		t.Fatalf("bad migrated issuer: %#v", issuer)
+	}
+
+	for _, path := range []string{
+		caPublicKeyStoragePath, caPublicKeyStoragePathDeprecated,
+		caPrivateKeyStoragePath, caPrivateKeyStoragePathDeprecated,
+	} {
+		entry, err := config.StorageView.Get(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry != nil {
+			t.Fatalf("expected legacy entry %q to be removed", path)
+		}
+	}
+
+	// Migrating again is a no-op
+	if err := b.Initialize(ctx, &logical.InitializationRequest{Storage: config.StorageView}); err != nil {
+		t.Fatal(err)
+	}
+	issuers, err := listIssuers(ctx, config.StorageView)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issuers) != 1 || issuers[0] != issuer.ID {
+		t.Fatalf("bad issuers after migration: %v", issuers)
+	}
+
+	// A migration interrupted before removing the legacy entries reuses
+	// the issuer it created
+	for path, key := range map[string]string{
+		caPublicKeyStoragePath:  testCAPublicKey,
+		caPrivateKeyStoragePath: testCAPrivateKey,
+	} {
+		entry, err := logical.StorageEntryJSON(path, keyStorageEntry{Key: key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := config.StorageView.Put(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Initialize(ctx, &logical.InitializationRequest{Storage: config.StorageView}); err != nil {
+		t.Fatal(err)
+	}
+	issuers, err = listIssuers(ctx, config.StorageView)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issuers) != 1 || issuers[0] != issuer.ID {
+		t.Fatalf("bad issuers after resumed migration: %v", issuers)
+	}
+	for _, path := range []string{caPublicKeyStoragePath, caPrivateKeyStoragePath} {
+		entry, err := config.StorageView.Get(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry != nil {
+			t.Fatalf("expected legacy entry %q to be removed", path)
+		}
+	}
+}
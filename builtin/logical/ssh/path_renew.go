@@ -0,0 +1,268 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// renewSignaturePrefix is prepended to the data signed by hosts to renew
+	// their certificate, so that the signature can't be used for anything
+	// else
+	renewSignaturePrefix = "vault-ssh-host-certificate-renewal"
+
+	// renewTimestampSkew is how far the timestamp of a renewal request may be
+	// from the current time
+	renewTimestampSkew = 5 * time.Minute
+)
+
+func pathRenew(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "renew/" + framework.GenericNameWithAtRegex("role"),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRenew,
+		},
+
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type: framework.TypeString,
+				Description: `The role the host certificate was signed with; certificates
+can only be renewed by the role that issued them.`,
+			},
+			"certificate": {
+				Type:        framework.TypeString,
+				Description: `The current host certificate, signed by an issuer of this mount.`,
+			},
+			"timestamp": {
+				Type: framework.TypeInt64,
+				Description: `The Unix time at which the signature was made; it must be
+within five minutes of the time of the request.`,
+			},
+			"signature": {
+				Type: framework.TypeString,
+				Description: `The base64-encoded SSH signature, made with the private key of
+the certified host key, of the renewal payload. The payload is the
+string "vault-ssh-host-certificate-renewal", the role name, the
+timestamp and the certificate as given, each followed by a newline.`,
+			},
+			"ttl": {
+				Type: framework.TypeDurationSecond,
+				Description: `The requested Time To Live for the renewed certificate.
+Defaults to the TTL of the role.`,
+			},
+		},
+
+		HelpSynopsis:    pathRenewHelpSyn,
+		HelpDescription: pathRenewHelpDesc,
+	}
+}
+
+func (b *backend) pathRenew(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+	certificate := strings.TrimSpace(data.Get("certificate").(string))
+	timestamp := data.Get("timestamp").(int64)
+
+	// The errors below don't disclose why the proof of possession was
+	// rejected, as the endpoint is unauthenticated
+	role, err := b.getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil || role.KeyType != KeyTypeCA || !role.AllowHostRenewal {
+		return logical.ErrorResponse(fmt.Sprintf("role %q does not allow host certificate renewal", roleName)), nil
+	}
+
+	if certificate == "" {
+		return logical.ErrorResponse("missing certificate"), nil
+	}
+	parsedKey, err := parsePublicSSHKey(certificate)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("failed to parse certificate: %v", err)), nil
+	}
+	cert, ok := parsedKey.(*ssh.Certificate)
+	if !ok || cert.CertType != ssh.HostCert {
+		return logical.ErrorResponse("certificate is not an SSH host certificate"), nil
+	}
+
+	if err := b.checkHostCertificate(ctx, req.Storage, cert); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid certificate: %v", err)), nil
+	}
+
+	// Certificates are only renewed by the role that issued them, as
+	// recorded when signing, so that renewal can't be used to move a host
+	// key to a role with more lenient options
+	serial := strconv.FormatUint(cert.Serial, 16)
+	record, err := fetchCertRecord(ctx, req.Storage, serial)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil || record.Role != roleName || !sameCertificate(record.Certificate, cert) {
+		return logical.ErrorResponse(fmt.Sprintf("invalid certificate: certificate was not issued by role %q", roleName)), nil
+	}
+
+	revocation, err := fetchRevocation(ctx, req.Storage, serial)
+	if err != nil {
+		return nil, err
+	}
+	if revocation != nil {
+		return logical.ErrorResponse("invalid certificate: certificate has been revoked"), nil
+	}
+
+	signedAt := time.Unix(timestamp, 0)
+	if timestamp == 0 || time.Since(signedAt) > renewTimestampSkew || time.Until(signedAt) > renewTimestampSkew {
+		return logical.ErrorResponse("timestamp is missing or too far from the current time"), nil
+	}
+
+	signature, err := parseSSHSignature(data.Get("signature").(string))
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("failed to parse signature: %v", err)), nil
+	}
+	if err := cert.Key.Verify(renewSignaturePayload(roleName, timestamp, certificate), signature); err != nil {
+		return logical.ErrorResponse("signature verification failed"), nil
+	}
+
+	// The certificate is renewed as if it was signed again for the same
+	// principals, which must still be allowed by the role
+	signData := &framework.FieldData{
+		Raw: map[string]interface{}{
+			"valid_principals": strings.Join(cert.ValidPrincipals, ","),
+		},
+		Schema: pathSign(b).Fields,
+	}
+	if ttl, ok := data.GetOk("ttl"); ok {
+		signData.Raw["ttl"] = ttl
+	}
+
+	parsedPrincipals, err := b.calculateValidPrincipals(signData, req, role, "", role.AllowedDomains, validateValidPrincipalForHosts(role))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	ttl, err := b.calculateTTL(signData, role)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	criticalOptions, err := b.calculateCriticalOptions(signData, role)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	extensions, err := b.calculateExtensions(signData, req, role)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	cBundle := creationBundle{
+		KeyID:           cert.KeyId,
+		PublicKey:       cert.Key,
+		ValidPrincipals: parsedPrincipals,
+		TTL:             ttl,
+		CertificateType: ssh.HostCert,
+		Role:            role,
+		RoleName:        roleName,
+		CriticalOptions: criticalOptions,
+		Extensions:      extensions,
+	}
+
+	return b.issueCertificate(ctx, req, &cBundle)
+}
+
+// checkHostCertificate verifies that the host certificate is currently valid
+// and signed by one of the issuers of the mount.
+func (b *backend) checkHostCertificate(ctx context.Context, s logical.Storage, cert *ssh.Certificate) error {
+	publicKeys, err := fetchIssuerPublicKeys(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	var authorities [][]byte
+	for _, publicKey := range publicKeys {
+		authority, err := parsePublicSSHKey(strings.TrimSpace(publicKey))
+		if err != nil {
+			return err
+		}
+		authorities = append(authorities, authority.Marshal())
+	}
+
+	checker := &ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, _ string) bool {
+			for _, authority := range authorities {
+				if bytes.Equal(auth.Marshal(), authority) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+
+	principal := ""
+	if len(cert.ValidPrincipals) != 0 {
+		principal = cert.ValidPrincipals[0]
+	}
+	if err := checker.CheckCert(principal, cert); err != nil {
+		return err
+	}
+	if !checker.IsHostAuthority(cert.SignatureKey, "") {
+		return fmt.Errorf("certificate signed by unrecognized authority")
+	}
+
+	return nil
+}
+
+// sameCertificate returns whether the recorded certificate is the given one
+func sameCertificate(recorded string, cert *ssh.Certificate) bool {
+	parsed, err := parsePublicSSHKey(strings.TrimSpace(recorded))
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(parsed.Marshal(), cert.Marshal())
+}
+
+// renewSignaturePayload returns the data signed by the host to renew its
+// certificate
+func renewSignaturePayload(role string, timestamp int64, certificate string) []byte {
+	return []byte(renewSignaturePrefix + "\n" + role + "\n" + strconv.FormatInt(timestamp, 10) + "\n" + certificate + "\n")
+}
+
+func parseSSHSignature(signature string) (*ssh.Signature, error) {
+	if signature == "" {
+		return nil, fmt.Errorf("missing signature")
+	}
+
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed ssh.Signature
+	if err := ssh.Unmarshal(signatureBytes, &parsed); err != nil {
+		return nil, err
+	}
+
+	return &parsed, nil
+}
+
+const pathRenewHelpSyn = `Renew an SSH host certificate using proof of possession of the host key.`
+
+const pathRenewHelpDesc = `
+This unauthenticated path allows hosts to renew a currently valid host
+certificate signed by an issuer of this mount, for roles with
+'allow_host_renewal' set. Certificates can only be renewed with the role
+that issued them. The request is authenticated by a signature of the
+renewal payload made with the private key of the certified host key.
+
+The renewed certificate has the key, key ID and principals of the current
+certificate, which must still be allowed by the role, and the options and
+TTL of the role; this allows host certificates to be short-lived.
+`
@@ -0,0 +1,222 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSH_KnownHosts(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Cannot create backend: %s", err)
+	}
+
+	knownHostsReq := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "known_hosts",
+		Storage:   config.StorageView,
+	}
+
+	resp, err := b.HandleRequest(context.Background(), knownHostsReq)
+	if err != nil || resp != nil {
+		t.Fatalf("expected no response without issuers, got err: %v, resp: %v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/ca",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"public_key":  testCAPublicKey,
+			"private_key": testCAPrivateKey,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v, resp: %v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), knownHostsReq)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v, resp: %v", err, resp)
+	}
+	if knownHosts := string(resp.Data[logical.HTTPRawBody].([]byte)); knownHosts != "@cert-authority * "+testCAPublicKey {
+		t.Fatalf("bad known_hosts: %q", knownHosts)
+	}
+
+	knownHostsReq.Data = map[string]interface{}{
+		"host_pattern": "*.example.com",
+	}
+	resp, err = b.HandleRequest(context.Background(), knownHostsReq)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v, resp: %v", err, resp)
+	}
+	if knownHosts := string(resp.Data[logical.HTTPRawBody].([]byte)); knownHosts != "@cert-authority *.example.com "+testCAPublicKey {
+		t.Fatalf("bad known_hosts: %q", knownHosts)
+	}
+
+	knownHostsReq.Data["host_pattern"] = "a b"
+	resp, err = b.HandleRequest(context.Background(), knownHostsReq)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an invalid host_pattern to be rejected, got err: %v, resp: %v", err, resp)
+	}
+}
+
+func TestSSH_RenewHostCertificate(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Cannot create backend: %s", err)
+	}
+
+	request := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+	}
+	mustRequest := func(path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := request(path, data)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %s: err: %v, resp: %v", path, err, resp)
+		}
+		return resp
+	}
+
+	mustRequest("config/ca", map[string]interface{}{
+		"public_key":  testCAPublicKey,
+		"private_key": testCAPrivateKey,
+	})
+	hostRole := map[string]interface{}{
+		"key_type":                "ca",
+		"allow_host_certificates": true,
+		"allowed_domains":         "example.com",
+		"allow_subdomains":        true,
+		"allow_host_renewal":      true,
+		"ttl":                     "10m",
+	}
+	mustRequest("roles/hosts", hostRole)
+	mustRequest("roles/otherhosts", hostRole)
+	hostRole["allow_host_renewal"] = false
+	mustRequest("roles/norenew", hostRole)
+
+	_, hostPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := mustRequest("sign/hosts", map[string]interface{}{
+		"public_key":       string(ssh.MarshalAuthorizedKey(hostSigner.PublicKey())),
+		"cert_type":        "host",
+		"valid_principals": "host.example.com",
+	})
+	certificate := resp.Data["signed_key"].(string)
+	parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(certificate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := parsedKey.(*ssh.Certificate)
+
+	renewData := func(role string, signer ssh.Signer, timestamp time.Time) map[string]interface{} {
+		t.Helper()
+		certificate := strings.TrimSpace(certificate)
+		signature, err := signer.Sign(rand.Reader, renewSignaturePayload(role, timestamp.Unix(), certificate))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return map[string]interface{}{
+			"certificate": certificate,
+			"timestamp":   timestamp.Unix(),
+			"signature":   base64.StdEncoding.EncodeToString(ssh.Marshal(signature)),
+		}
+	}
+
+	resp = mustRequest("renew/hosts", renewData("hosts", hostSigner, time.Now()))
+	parsedKey, _, _, _, err = ssh.ParseAuthorizedKey([]byte(resp.Data["signed_key"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	renewed := parsedKey.(*ssh.Certificate)
+	switch {
+	case renewed.CertType != ssh.HostCert:
+		t.Fatalf("bad certificate type: %v", renewed.CertType)
+	case renewed.KeyId != cert.KeyId:
+		t.Fatalf("bad key id: %v", renewed.KeyId)
+	case string(renewed.Key.Marshal()) != string(hostSigner.PublicKey().Marshal()):
+		t.Fatal("renewed certificate is not for the host key")
+	case len(renewed.ValidPrincipals) != 1 || renewed.ValidPrincipals[0] != "host.example.com":
+		t.Fatalf("bad principals: %v", renewed.ValidPrincipals)
+	case renewed.Serial == cert.Serial:
+		t.Fatal("expected a new serial number")
+	}
+
+	_, otherPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSigner, err := ssh.NewSignerFromKey(otherPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		path string
+		data map[string]interface{}
+	}{
+		"wrong key":            {"renew/hosts", renewData("hosts", otherSigner, time.Now())},
+		"stale timestamp":      {"renew/hosts", renewData("hosts", hostSigner, time.Now().Add(-time.Hour))},
+		"other role":           {"renew/hosts", renewData("norenew", hostSigner, time.Now())},
+		"renewal not allowed":  {"renew/norenew", renewData("norenew", hostSigner, time.Now())},
+		"issued by other role": {"renew/otherhosts", renewData("otherhosts", hostSigner, time.Now())},
+	} {
+		resp, err := request(tc.path, tc.data)
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected renewal to be rejected, got err: %v, resp: %v", name, err, resp)
+		}
+	}
+
+	// Revoked certificates can't be renewed
+	mustRequest("revoke", map[string]interface{}{
+		"serial_number": strconv.FormatUint(cert.Serial, 16),
+	})
+	resp, err = request("renew/hosts", renewData("hosts", hostSigner, time.Now()))
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected renewal of a revoked certificate to be rejected, got err: %v, resp: %v", err, resp)
+	}
+
+	// Certificates from another CA can't be renewed, even with a valid
+	// signature
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "config/ca",
+		Storage:   config.StorageView,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v, resp: %v", err, resp)
+	}
+	mustRequest("config/ca", nil)
+	resp, err = request("renew/hosts", renewData("hosts", hostSigner, time.Now()))
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected renewal to be rejected, got err: %v, resp: %v", err, resp)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/hashicorp/go-secure-stdlib/parseutil"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/cidrutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/logical"
 	"golang.org/x/crypto/ssh"
 )
@@ -54,6 +55,9 @@ type sshRole struct {
 	KeyIDFormat               string            `mapstructure:"key_id_format" json:"key_id_format"`
 	AllowedUserKeyLengths     map[string]int    `mapstructure:"allowed_user_key_lengths" json:"allowed_user_key_lengths"`
 	AlgorithmSigner           string            `mapstructure:"algorithm_signer" json:"algorithm_signer"`
+	IssuerRef                 string            `mapstructure:"issuer_ref" json:"issuer_ref"`
+	AllowHostRenewal          bool              `mapstructure:"allow_host_renewal" json:"allow_host_renewal"`
+	NoStore                   bool              `mapstructure:"no_store" json:"no_store"`
 }
 
 func pathListRoles(b *backend) *framework.Path {
@@ -294,6 +298,27 @@ func pathRoles(b *backend) *framework.Path {
 				`,
 				Default: false,
 			},
+			"allow_host_renewal": {
+				Type: framework.TypeBool,
+				Description: `
+				[Not applicable for Dynamic type] [Not applicable for OTP type] [Optional for CA type]
+				If set, host certificates signed for this role can be renewed using the unauthenticated
+				'renew/' endpoint by proving possession of the private key of the certified host key.
+				`,
+				Default: false,
+			},
+			"no_store": {
+				Type: framework.TypeBool,
+				Description: `
+				[Not applicable for Dynamic type] [Not applicable for OTP type] [Optional for CA type]
+				If set, certificates signed against this role will not be recorded in the storage
+				backend. This can improve performance when signing large numbers of certificates.
+				However, certificates signed in this way cannot be listed, revoked or renewed, so
+				this option is recommended only for short-lived certificates. Cannot be combined
+				with 'allow_host_renewal'.
+				`,
+				Default: false,
+			},
 			"allow_bare_domains": {
 				Type: framework.TypeBool,
 				Description: `
@@ -346,12 +371,26 @@ func pathRoles(b *backend) *framework.Path {
 				Type: framework.TypeString,
 				Description: `
 				When supplied, this value specifies a signing algorithm for the key. Possible values:
-				ssh-rsa, rsa-sha2-256, rsa-sha2-512.
+				ssh-rsa, rsa-sha2-256, rsa-sha2-512 for RSA CA keys. ECDSA and Ed25519 CA keys always
+				sign with the algorithm of their key type (ecdsa-sha2-nistp256, ecdsa-sha2-nistp384,
+				ecdsa-sha2-nistp521 or ssh-ed25519), which may also be given.
 				`,
 				DisplayAttrs: &framework.DisplayAttributes{
 					Name: "Signing Algorithm",
 				},
 			},
+			issuerRefParam: {
+				Type: framework.TypeString,
+				Description: `
+				[Not applicable for Dynamic type] [Not applicable for OTP type] [Optional for CA type]
+				Reference to the issuer used to sign certificates, either "default", the name
+				of an issuer or its identifier. Defaults to the default issuer of the mount.
+				`,
+				Default: defaultRef,
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name: "Issuer Reference",
+				},
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -492,6 +531,9 @@ func (b *backend) pathRoleWrite(ctx context.Context, req *logical.Request, d *fr
 			algorithmSigner = algorithmSignerRaw.(string)
 			switch algorithmSigner {
 			case ssh.SigAlgoRSA, ssh.SigAlgoRSASHA2256, ssh.SigAlgoRSASHA2512:
+			case ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521, ssh.KeyAlgoED25519:
+				// These are only supported by CA keys of the same type, which
+				// is checked when signing as the issuer may change.
 			case "":
 				// This case is valid, and the sign operation will use the signer's
 				// default algorithm.
@@ -504,6 +546,17 @@ func (b *backend) pathRoleWrite(ctx context.Context, req *logical.Request, d *fr
 		if errorResponse != nil {
 			return errorResponse, nil
 		}
+
+		// Make sure the issuer exists, unless it is the default issuer which
+		// may be configured later on
+		if role.IssuerRef != defaultRef {
+			if _, err := resolveIssuerReference(ctx, req.Storage, role.IssuerRef); err != nil {
+				if _, ok := err.(errutil.UserError); ok {
+					return logical.ErrorResponse(fmt.Sprintf("unable to resolve issuer_ref %q: %v", role.IssuerRef, err)), nil
+				}
+				return nil, err
+			}
+		}
 		roleEntry = *role
 	} else {
 		return logical.ErrorResponse("invalid key type"), nil
@@ -528,6 +581,8 @@ func (b *backend) createCARole(allowedUsers, defaultUser, signer string, data *f
 		AllowedExtensions:         data.Get("allowed_extensions").(string),
 		AllowUserCertificates:     data.Get("allow_user_certificates").(bool),
 		AllowHostCertificates:     data.Get("allow_host_certificates").(bool),
+		AllowHostRenewal:          data.Get("allow_host_renewal").(bool),
+		NoStore:                   data.Get("no_store").(bool),
 		AllowedUsers:              allowedUsers,
 		AllowedUsersTemplate:      data.Get("allowed_users_template").(bool),
 		AllowedDomains:            data.Get("allowed_domains").(string),
@@ -539,12 +594,25 @@ func (b *backend) createCARole(allowedUsers, defaultUser, signer string, data *f
 		KeyIDFormat:               data.Get("key_id_format").(string),
 		KeyType:                   KeyTypeCA,
 		AlgorithmSigner:           signer,
+		IssuerRef:                 data.Get(issuerRefParam).(string),
+	}
+	if role.IssuerRef == "" {
+		role.IssuerRef = defaultRef
 	}
 
 	if !role.AllowUserCertificates && !role.AllowHostCertificates {
 		return nil, logical.ErrorResponse("Either 'allow_user_certificates' or 'allow_host_certificates' must be set to 'true'")
 	}
 
+	if role.AllowHostRenewal && !role.AllowHostCertificates {
+		return nil, logical.ErrorResponse("'allow_host_renewal' requires 'allow_host_certificates' to be set to 'true'")
+	}
+
+	// Renewal relies on the record of the certificate to tie it to the role
+	if role.AllowHostRenewal && role.NoStore {
+		return nil, logical.ErrorResponse("'allow_host_renewal' cannot be combined with 'no_store'")
+	}
+
 	defaultCriticalOptions := convertMapToStringValue(data.Get("default_critical_options").(map[string]interface{}))
 	defaultExtensions := convertMapToStringValue(data.Get("default_extensions").(map[string]interface{}))
 	allowedUserKeyLengths, err := convertMapToIntValue(data.Get("allowed_user_key_lengths").(map[string]interface{}))
@@ -581,6 +649,11 @@ func (b *backend) getRole(ctx context.Context, s logical.Storage, n string) (*ss
 		return nil, err
 	}
 
+	// Roles created before issuers were introduced use the default issuer
+	if result.KeyType == KeyTypeCA && result.IssuerRef == "" {
+		result.IssuerRef = defaultRef
+	}
+
 	return &result, nil
 }
 
@@ -621,6 +694,8 @@ func (b *backend) parseRole(role *sshRole) (map[string]interface{}, error) {
 			"allowed_extensions":          role.AllowedExtensions,
 			"allow_user_certificates":     role.AllowUserCertificates,
 			"allow_host_certificates":     role.AllowHostCertificates,
+			"allow_host_renewal":          role.AllowHostRenewal,
+			"no_store":                    role.NoStore,
 			"allow_bare_domains":          role.AllowBareDomains,
 			"allow_subdomains":            role.AllowSubdomains,
 			"allow_user_key_ids":          role.AllowUserKeyIDs,
@@ -632,6 +707,7 @@ func (b *backend) parseRole(role *sshRole) (map[string]interface{}, error) {
 			"default_extensions_template": role.DefaultExtensionsTemplate,
 			"allowed_user_key_lengths":    role.AllowedUserKeyLengths,
 			"algorithm_signer":            role.AlgorithmSigner,
+			"issuer_ref":                  role.IssuerRef,
 		}
 	case KeyTypeDynamic:
 		result = map[string]interface{}{
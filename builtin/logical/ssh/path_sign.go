@@ -19,6 +19,7 @@ import (
 	"github.com/hashicorp/go-secure-stdlib/strutil"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/logical"
 	"golang.org/x/crypto/ed25519"
 	"golang.org/x/crypto/ssh"
@@ -32,6 +33,7 @@ type creationBundle struct {
 	TTL             time.Duration
 	Signer          ssh.Signer
 	Role            *sshRole
+	RoleName        string
 	CriticalOptions map[string]string
 	Extensions      map[string]string
 }
@@ -160,31 +162,39 @@ func (b *backend) pathSignCertificate(ctx context.Context, req *logical.Request,
 		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	privateKeyEntry, err := caKey(ctx, req.Storage, caPrivateKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CA private key: %w", err)
-	}
-	if privateKeyEntry == nil || privateKeyEntry.Key == "" {
-		return nil, fmt.Errorf("failed to read CA private key")
-	}
-
-	signer, err := ssh.ParsePrivateKey([]byte(privateKeyEntry.Key))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse stored CA private key: %w", err)
-	}
-
 	cBundle := creationBundle{
 		KeyID:           keyID,
 		PublicKey:       userPublicKey,
-		Signer:          signer,
 		ValidPrincipals: parsedPrincipals,
 		TTL:             ttl,
 		CertificateType: certificateType,
 		Role:            role,
+		RoleName:        data.Get("role").(string),
 		CriticalOptions: criticalOptions,
 		Extensions:      extensions,
 	}
 
+	return b.issueCertificate(ctx, req, &cBundle)
+}
+
+// issueCertificate signs the certificate described by the bundle with the
+// issuer of its role, records it and returns it in the response.
+func (b *backend) issueCertificate(ctx context.Context, req *logical.Request, cBundle *creationBundle) (*logical.Response, error) {
+	issuer, err := fetchIssuerByRef(ctx, req.Storage, cBundle.Role.IssuerRef)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(fmt.Sprintf("unable to fetch issuer %q of role: %v", cBundle.Role.IssuerRef, err)), nil
+		default:
+			return nil, fmt.Errorf("failed to read CA private key: %w", err)
+		}
+	}
+
+	cBundle.Signer, err = issuer.GetSigner()
+	if err != nil {
+		return nil, err
+	}
+
 	certificate, err := cBundle.sign()
 	if err != nil {
 		return nil, err
@@ -195,10 +205,17 @@ func (b *backend) pathSignCertificate(ctx context.Context, req *logical.Request,
 		return nil, fmt.Errorf("error marshaling signed certificate")
 	}
 
+	if !cBundle.Role.NoStore {
+		if err := storeCertRecord(ctx, req.Storage, cBundle.RoleName, issuer, certificate); err != nil {
+			return nil, fmt.Errorf("unable to store certificate record: %w", err)
+		}
+	}
+
 	response := &logical.Response{
 		Data: map[string]interface{}{
 			"serial_number": strconv.FormatUint(certificate.Serial, 16),
 			"signed_key":    string(signedSSHCertificate),
+			"issuer_id":     issuer.ID,
 		},
 	}
 
@@ -554,7 +571,10 @@ func (b *creationBundle) sign() (retCert *ssh.Certificate, retErr error) {
 	// Drop trailing signature length.
 	certificateBytes := out[:len(out)-4]
 
-	algo := b.Role.AlgorithmSigner
+	algo, err := signatureAlgorithm(b.Role.AlgorithmSigner, sshAlgorithmSigner.PublicKey())
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signed SSH key: %w", err)
+	}
 	sig, err := sshAlgorithmSigner.SignWithAlgorithm(rand.Reader, certificateBytes, algo)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate signed SSH key: sign error: %w", err)
@@ -564,3 +584,20 @@ func (b *creationBundle) sign() (retCert *ssh.Certificate, retErr error) {
 
 	return certificate, nil
 }
+
+// signatureAlgorithm returns the algorithm used to sign certificates with the
+// CA key. RSA keys support several algorithms, selected by the role's
+// algorithm_signer, while ECDSA and Ed25519 keys only support the algorithm
+// of their key type.
+func signatureAlgorithm(algorithmSigner string, caKey ssh.PublicKey) (string, error) {
+	if caKey.Type() == ssh.KeyAlgoRSA {
+		// An empty algorithm selects the signer's default algorithm
+		return algorithmSigner, nil
+	}
+
+	if algorithmSigner != "" && algorithmSigner != caKey.Type() {
+		return "", fmt.Errorf("algorithm_signer %q is not supported by the %s CA key", algorithmSigner, caKey.Type())
+	}
+
+	return caKey.Type(), nil
+}
@@ -0,0 +1,179 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathTidy(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "tidy$",
+		Fields: map[string]*framework.FieldSchema{
+			"tidy_cert_store": {
+				Type: framework.TypeBool,
+				Description: `Set to true to remove the records of certificates that
+have expired, from the certificate store.`,
+			},
+			"tidy_revoked_certs": {
+				Type: framework.TypeBool,
+				Description: `Set to true to remove expired certificates from the
+revocation list, along with their records.`,
+			},
+			"safety_buffer": {
+				Type: framework.TypeDurationSecond,
+				Description: `The amount of extra time that must have passed beyond
+certificate expiration before it is removed from the backend storage.
+Defaults to 72 hours.`,
+				Default: 259200, // 72h
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback:                  b.pathTidyWrite,
+				ForwardPerformanceStandby: true,
+			},
+		},
+
+		HelpSynopsis:    pathTidyHelpSyn,
+		HelpDescription: pathTidyHelpDesc,
+	}
+}
+
+func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	safetyBuffer := time.Duration(d.Get("safety_buffer").(int)) * time.Second
+	tidyCertStore := d.Get("tidy_cert_store").(bool)
+	tidyRevokedCerts := d.Get("tidy_revoked_certs").(bool)
+
+	if safetyBuffer < time.Second {
+		return logical.ErrorResponse("safety_buffer must be greater than zero"), nil
+	}
+
+	if !atomic.CompareAndSwapUint32(&b.tidyCASGuard, 0, 1) {
+		resp := &logical.Response{}
+		resp.AddWarning("Tidy operation already in progress.")
+		return resp, nil
+	}
+
+	// The request's storage is kept, as the request may be gone by the time
+	// the tidy operation runs
+	s := req.Storage
+
+	go func() {
+		defer atomic.StoreUint32(&b.tidyCASGuard, 0)
+
+		// Don't cancel when the original client request goes away
+		ctx := context.Background()
+
+		logger := b.Logger().Named("tidy")
+
+		doTidy := func() error {
+			if tidyCertStore {
+				if err := b.doTidyCertStore(ctx, s, safetyBuffer); err != nil {
+					return err
+				}
+			}
+
+			if tidyRevokedCerts {
+				if err := b.doTidyRevocationStore(ctx, s, safetyBuffer); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		if err := doTidy(); err != nil {
+			logger.Error("error running tidy", "error", err)
+			return
+		}
+		logger.Info("tidy operation completed")
+	}()
+
+	resp := &logical.Response{}
+	resp.AddWarning("Tidy operation successfully started. Any information from the operation will be printed to Vault's server logs.")
+	return logical.RespondWithStatusCode(resp, req, http.StatusAccepted)
+}
+
+// doTidyCertStore removes the records of expired certificates which have
+// not been revoked; those of revoked certificates are removed with their
+// revocation entries.
+func (b *backend) doTidyCertStore(ctx context.Context, s logical.Storage, safetyBuffer time.Duration) error {
+	serials, err := s.List(ctx, certStoragePrefix)
+	if err != nil {
+		return fmt.Errorf("error fetching list of certs: %w", err)
+	}
+
+	for _, serial := range serials {
+		record, err := fetchCertRecord(ctx, s, serial)
+		if err != nil {
+			return fmt.Errorf("error fetching certificate %q: %w", serial, err)
+		}
+		if record == nil || time.Now().Before(record.Expiration.Add(safetyBuffer)) {
+			continue
+		}
+
+		revocation, err := fetchRevocation(ctx, s, serial)
+		if err != nil {
+			return err
+		}
+		if revocation != nil {
+			continue
+		}
+
+		if err := s.Delete(ctx, certStoragePrefix+serial); err != nil {
+			return fmt.Errorf("error deleting serial %q from storage: %w", serial, err)
+		}
+	}
+
+	return nil
+}
+
+// doTidyRevocationStore removes expired certificates from the revocation
+// list, which only needs to cover certificates that are still valid.
+func (b *backend) doTidyRevocationStore(ctx context.Context, s logical.Storage, safetyBuffer time.Duration) error {
+	serials, err := s.List(ctx, revokedStoragePrefix)
+	if err != nil {
+		return fmt.Errorf("error fetching list of revoked certs: %w", err)
+	}
+
+	for _, serial := range serials {
+		revocation, err := fetchRevocation(ctx, s, serial)
+		if err != nil {
+			return fmt.Errorf("unable to fetch revoked cert with serial %q: %w", serial, err)
+		}
+		if revocation == nil || time.Now().Before(revocation.Expiration.Add(safetyBuffer)) {
+			continue
+		}
+
+		if err := s.Delete(ctx, revokedStoragePrefix+serial); err != nil {
+			return fmt.Errorf("error deleting serial %q from revoked list: %w", serial, err)
+		}
+		if err := s.Delete(ctx, certStoragePrefix+serial); err != nil {
+			return fmt.Errorf("error deleting serial %q from store when tidying revoked: %w", serial, err)
+		}
+	}
+
+	return nil
+}
+
+const pathTidyHelpSyn = `
+Tidy up the backend by removing expired certificates.
+`
+
+const pathTidyHelpDesc = `
+This endpoint allows expired certificates to be removed from the backend,
+freeing up storage. The 'tidy_cert_store' parameter removes the records of
+expired certificates, and 'tidy_revoked_certs' removes expired certificates
+from the revocation list, which no longer needs to include them.
+
+All certificates that have expired for longer than the 'safety_buffer' are
+removed. The operation runs in the background; any information from it is
+printed to Vault's server logs.
+`
@@ -0,0 +1,153 @@
+package ssh
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestSSH_Tidy(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	ctx := context.Background()
+
+	backend, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Setup(ctx, config); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := backend.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %s: err: %v, resp: %v", path, err, resp)
+		}
+		return resp
+	}
+
+	request("config/ca", map[string]interface{}{
+		"public_key":  testCAPublicKey,
+		"private_key": testCAPrivateKey,
+	})
+	request("roles/users", map[string]interface{}{
+		"key_type":                "ca",
+		"allow_user_certificates": true,
+		"allowed_users":           "*",
+	})
+	request("roles/unstored", map[string]interface{}{
+		"key_type":                "ca",
+		"allow_user_certificates": true,
+		"allowed_users":           "*",
+		"no_store":                true,
+	})
+
+	// Certificates signed against no_store roles are not recorded
+	resp := request("sign/unstored", map[string]interface{}{
+		"public_key":       publicKey2,
+		"valid_principals": "tuser",
+	})
+	if resp.Data["serial_number"] == "" {
+		t.Fatalf("expected a serial number: %#v", resp.Data)
+	}
+	serials, err := config.StorageView.List(ctx, certStoragePrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serials) != 0 {
+		t.Fatalf("expected no certificate records, got %v", serials)
+	}
+
+	// Renewal relies on the records of certificates
+	resp, err = backend.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/hosts",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"key_type":                "ca",
+			"allow_host_certificates": true,
+			"allow_host_renewal":      true,
+			"no_store":                true,
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected no_store to be rejected with allow_host_renewal, got err: %v, resp: %v", err, resp)
+	}
+
+	put := func(key string, value interface{}) {
+		t.Helper()
+		entry, err := logical.StorageEntryJSON(key, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := config.StorageView.Put(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expired := time.Now().Add(-time.Hour)
+	valid := time.Now().Add(time.Hour)
+	put(certStoragePrefix+"1", &certEntry{SerialNumber: "1", Expiration: expired})
+	put(certStoragePrefix+"2", &certEntry{SerialNumber: "2", Expiration: valid})
+	put(certStoragePrefix+"3", &certEntry{SerialNumber: "3", Expiration: expired})
+	put(revokedStoragePrefix+"3", &revocationEntry{SerialNumber: "3", Expiration: expired})
+	put(certStoragePrefix+"4", &certEntry{SerialNumber: "4", Expiration: valid})
+	put(revokedStoragePrefix+"4", &revocationEntry{SerialNumber: "4", Expiration: valid})
+
+	tidy := func(data map[string]interface{}) {
+		t.Helper()
+		resp := request("tidy", data)
+		if resp.Data[logical.HTTPStatusCode] != http.StatusAccepted {
+			t.Fatalf("bad response: %#v", resp)
+		}
+		for atomic.LoadUint32(&backend.tidyCASGuard) != 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	list := func(prefix string) []string {
+		t.Helper()
+		keys, err := config.StorageView.List(ctx, prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return keys
+	}
+
+	// Nothing has been expired for longer than the default safety buffer
+	tidy(map[string]interface{}{
+		"tidy_cert_store":    true,
+		"tidy_revoked_certs": true,
+	})
+	if certs, revoked := list(certStoragePrefix), list(revokedStoragePrefix); len(certs) != 4 || len(revoked) != 2 {
+		t.Fatalf("unexpected entries after tidy: certs: %v, revoked: %v", certs, revoked)
+	}
+
+	// Records of revoked certificates are kept until they are removed from
+	// the revocation list
+	tidy(map[string]interface{}{
+		"tidy_cert_store": true,
+		"safety_buffer":   "1s",
+	})
+	if certs, revoked := list(certStoragePrefix), list(revokedStoragePrefix); len(certs) != 3 || len(revoked) != 2 {
+		t.Fatalf("unexpected entries after tidy: certs: %v, revoked: %v", certs, revoked)
+	}
+
+	tidy(map[string]interface{}{
+		"tidy_revoked_certs": true,
+		"safety_buffer":      "1s",
+	})
+	certs, revoked := list(certStoragePrefix), list(revokedStoragePrefix)
+	if len(certs) != 2 || certs[0] != "2" || certs[1] != "4" || len(revoked) != 1 || revoked[0] != "4" {
+		t.Fatalf("unexpected entries after tidy: certs: %v, revoked: %v", certs, revoked)
+	}
+}
@@ -0,0 +1,356 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	storageIssuerConfig = "config/issuers"
+	issuerPrefix        = "config/issuer/"
+
+	// defaultRef is the reference which always resolves to the current
+	// default issuer of the mount.
+	defaultRef = "default"
+)
+
+// nameRegex restricts issuer names so that they can never be mistaken for
+// an identifier or for the default reference.
+var nameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_\-]*$`)
+
+type issuerID string
+
+func (i issuerID) String() string {
+	return string(i)
+}
+
+// issuerEntry is a CA key pair of the mount used to sign certificates
+type issuerEntry struct {
+	ID         issuerID `json:"id"`
+	Name       string   `json:"name"`
+	PublicKey  string   `json:"public_key"`
+	PrivateKey string   `json:"private_key"`
+}
+
+type issuerConfigEntry struct {
+	DefaultIssuerID issuerID `json:"default"`
+}
+
+// GetSigner parses the private key of the issuer.
+func (i issuerEntry) GetSigner() (ssh.Signer, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(i.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse stored CA private key: %w", err)
+	}
+	return signer, nil
+}
+
+func validateName(name string) error {
+	if name == "" {
+		return nil
+	}
+	if name == defaultRef {
+		return errutil.UserError{Err: fmt.Sprintf("the name %q is reserved", defaultRef)}
+	}
+	if !nameRegex.MatchString(name) {
+		return errutil.UserError{Err: fmt.Sprintf("invalid name %q: names may only contain alphanumeric characters, dashes and underscores", name)}
+	}
+	if _, err := uuid.ParseUUID(name); err == nil {
+		return errutil.UserError{Err: fmt.Sprintf("invalid name %q: names may not be formatted as identifiers", name)}
+	}
+	return nil
+}
+
+func listIssuers(ctx context.Context, s logical.Storage) ([]issuerID, error) {
+	strList, err := s.List(ctx, issuerPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	issuerIds := make([]issuerID, 0, len(strList))
+	for _, entry := range strList {
+		issuerIds = append(issuerIds, issuerID(entry))
+	}
+
+	return issuerIds, nil
+}
+
+func fetchIssuerByID(ctx context.Context, s logical.Storage, id issuerID) (*issuerEntry, error) {
+	if len(id) == 0 {
+		return nil, errutil.InternalError{Err: "unable to fetch ssh issuer: empty issuer identifier"}
+	}
+
+	entry, err := s.Get(ctx, issuerPrefix+id.String())
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch ssh issuer: %v", err)}
+	}
+	if entry == nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("ssh issuer id %s does not exist", id)}
+	}
+
+	var issuer issuerEntry
+	if err := entry.DecodeJSON(&issuer); err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to decode ssh issuer with id %s: %v", id, err)}
+	}
+
+	return &issuer, nil
+}
+
+// fetchIssuerByRef resolves the reference and fetches the issuer it refers
+// to.
+func fetchIssuerByRef(ctx context.Context, s logical.Storage, reference string) (*issuerEntry, error) {
+	id, err := resolveIssuerReference(ctx, s, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	return fetchIssuerByID(ctx, s, id)
+}
+
+func writeIssuer(ctx context.Context, s logical.Storage, issuer *issuerEntry) error {
+	json, err := logical.StorageEntryJSON(issuerPrefix+issuer.ID.String(), issuer)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, json)
+}
+
+func deleteIssuer(ctx context.Context, s logical.Storage, id issuerID) (bool, error) {
+	config, err := getIssuersConfig(ctx, s)
+	if err != nil {
+		return false, err
+	}
+
+	wasDefault := false
+	if config.DefaultIssuerID == id {
+		wasDefault = true
+		config.DefaultIssuerID = issuerID("")
+		if err := setIssuersConfig(ctx, s, config); err != nil {
+			return wasDefault, err
+		}
+	}
+
+	return wasDefault, s.Delete(ctx, issuerPrefix+id.String())
+}
+
+// createIssuer stores the given key pair as a new issuer, which becomes the
+// default issuer of the mount if there is none yet.
+func createIssuer(ctx context.Context, s logical.Storage, publicKey, privateKey, issuerName string) (*issuerEntry, error) {
+	if err := checkIssuerNameAvailable(ctx, s, issuerName, ""); err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := &issuerEntry{
+		ID:         issuerID(id),
+		Name:       issuerName,
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+	}
+	if err := writeIssuer(ctx, s, issuer); err != nil {
+		return nil, err
+	}
+
+	config, err := getIssuersConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.DefaultIssuerID) == 0 {
+		config.DefaultIssuerID = issuer.ID
+		if err := setIssuersConfig(ctx, s, config); err != nil {
+			return nil, err
+		}
+	}
+
+	return issuer, nil
+}
+
+func getIssuersConfig(ctx context.Context, s logical.Storage) (*issuerConfigEntry, error) {
+	entry, err := s.Get(ctx, storageIssuerConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	issuerConfig := &issuerConfigEntry{}
+	if entry != nil {
+		if err := entry.DecodeJSON(issuerConfig); err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("unable to decode issuer configuration: %v", err)}
+		}
+	}
+
+	return issuerConfig, nil
+}
+
+func setIssuersConfig(ctx context.Context, s logical.Storage, config *issuerConfigEntry) error {
+	json, err := logical.StorageEntryJSON(storageIssuerConfig, config)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, json)
+}
+
+// resolveIssuerReference resolves an issuer reference, which may be
+// "default", an issuer identifier or an issuer name, to an issuer
+// identifier.
+func resolveIssuerReference(ctx context.Context, s logical.Storage, reference string) (issuerID, error) {
+	if reference == defaultRef {
+		config, err := getIssuersConfig(ctx, s)
+		if err != nil {
+			return issuerID(""), err
+		}
+		if len(config.DefaultIssuerID) == 0 {
+			return issuerID(""), errutil.UserError{Err: "backend must be configured with a CA public/private key"}
+		}
+
+		return config.DefaultIssuerID, nil
+	}
+
+	issuers, err := listIssuers(ctx, s)
+	if err != nil {
+		return issuerID(""), err
+	}
+
+	for _, id := range issuers {
+		if id.String() == reference {
+			return id, nil
+		}
+	}
+
+	for _, id := range issuers {
+		issuer, err := fetchIssuerByID(ctx, s, id)
+		if err != nil {
+			return issuerID(""), err
+		}
+		if issuer.Name == reference {
+			return id, nil
+		}
+	}
+
+	return issuerID(""), errutil.UserError{Err: fmt.Sprintf("unable to find SSH issuer for reference: %v", reference)}
+}
+
+// checkIssuerNameAvailable ensures that no other issuer already uses the
+// given name.
+func checkIssuerNameAvailable(ctx context.Context, s logical.Storage, name string, self issuerID) error {
+	if name == "" {
+		return nil
+	}
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	existing, err := resolveIssuerReference(ctx, s, name)
+	if err == nil && existing != self {
+		return errutil.UserError{Err: fmt.Sprintf("an issuer with the name %q already exists", name)}
+	}
+	if _, ok := err.(errutil.InternalError); ok {
+		return err
+	}
+
+	return nil
+}
+
+// findIssuerByPublicKey returns the issuer with the given public key, if any.
+func findIssuerByPublicKey(ctx context.Context, s logical.Storage, publicKey string) (*issuerEntry, error) {
+	issuers, err := listIssuers(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range issuers {
+		issuer, err := fetchIssuerByID(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(issuer.PublicKey) == strings.TrimSpace(publicKey) {
+			return issuer, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// initialize migrates the single CA key pair stored by previous versions of
+// this backend into the issuer storage layout.
+func (b *backend) initialize(ctx context.Context, req *logical.InitializationRequest) error {
+	// On standbys and DR secondaries we do not want to run any kind of
+	// upgrade logic; the active node will take care of it.
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby | consts.ReplicationDRSecondary) {
+		return nil
+	}
+
+	// Replicated mounts are migrated on the performance primary.
+	if !b.System().LocalMount() && b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary) {
+		return nil
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	migrated, err := migrateLegacyCAKeys(ctx, req.Storage)
+	if err != nil {
+		b.Logger().Error("error migrating legacy CA keys", "error", err)
+		return err
+	}
+	if migrated {
+		b.Logger().Info("migrated legacy CA keys to issuer storage")
+	}
+
+	return nil
+}
+
+func migrateLegacyCAKeys(ctx context.Context, s logical.Storage) (bool, error) {
+	privateKeyEntry, err := caKey(ctx, s, caPrivateKey)
+	if err != nil {
+		return false, err
+	}
+	publicKeyEntry, err := caKey(ctx, s, caPublicKey)
+	if err != nil {
+		return false, err
+	}
+	if privateKeyEntry == nil || privateKeyEntry.Key == "" || publicKeyEntry == nil || publicKeyEntry.Key == "" {
+		return false, nil
+	}
+
+	// A previous migration may have been interrupted after creating the
+	// issuer but before removing the legacy entries, so reuse the issuer
+	// created then rather than adding a duplicate.
+	issuer, err := findIssuerByPublicKey(ctx, s, publicKeyEntry.Key)
+	if err != nil {
+		return false, err
+	}
+	if issuer == nil {
+		issuer, err = createIssuer(ctx, s, publicKeyEntry.Key, privateKeyEntry.Key, "")
+		if err != nil {
+			return false, err
+		}
+	}
+
+	// The legacy key pair was, by definition, the mount's CA, so make sure
+	// it remains the default after migration.
+	if err := setIssuersConfig(ctx, s, &issuerConfigEntry{DefaultIssuerID: issuer.ID}); err != nil {
+		return false, err
+	}
+
+	for _, legacyPath := range []string{caPrivateKeyStoragePath, caPublicKeyStoragePath} {
+		if err := s.Delete(ctx, legacyPath); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
@@ -2,12 +2,17 @@ package transit
 
 import (
 	"context"
+	"crypto/rsa"
 	"fmt"
 	"io"
+	"path"
 	"strings"
 	"sync"
+	"time"
 
+	multierror "github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/hashicorp/vault/sdk/helper/keysutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -15,6 +20,14 @@ import (
 // Minimum cache size for transit backend
 const minCacheSize = 10
 
+const (
+	// minAutoRotatePeriod is the shortest auto rotate period of a key
+	minAutoRotatePeriod = time.Hour
+
+	// autoRotateCheckInterval is how often keys are checked for rotation
+	autoRotateCheckInterval = time.Hour
+)
+
 func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
 	b, err := Backend(ctx, conf)
 	if err != nil {
@@ -33,6 +46,13 @@ func Backend(ctx context.Context, conf *logical.BackendConfig) (*backend, error)
 			SealWrapStorage: []string{
 				"archive/",
 				"policy/",
+				"import/",
+				"replication/config",
+			},
+
+			// Key usage is tracked by each cluster
+			LocalStorage: []string{
+				"usage/",
 			},
 		},
 
@@ -42,26 +62,49 @@ func Backend(ctx context.Context, conf *logical.BackendConfig) (*backend, error)
 			b.pathConfig(),
 			b.pathRotate(),
 			b.pathRewrap(),
+			b.pathImport(),
+			b.pathImportVersion(),
 			b.pathKeys(),
 			b.pathListKeys(),
 			b.pathExportKeys(),
+			b.pathWrappedExportKeys(),
 			b.pathEncrypt(),
 			b.pathDecrypt(),
+			b.pathEncryptStream(),
+			b.pathDecryptStream(),
 			b.pathDatakey(),
 			b.pathRandom(),
 			b.pathHash(),
 			b.pathHMAC(),
+			b.pathCMAC(),
+			b.pathDerive(),
+			b.pathFPEAlphabets(),
+			b.pathListFPEAlphabets(),
+			b.pathFPETemplates(),
+			b.pathListFPETemplates(),
+			b.pathFPEEncode(),
+			b.pathFPEDecode(),
+			b.pathTokenize(),
+			b.pathDetokenize(),
+			b.pathRevokeToken(),
+			b.pathBatch(),
+			b.pathReplicationConfig(),
+			b.pathReplicationReceive(),
+			b.pathReplicationSync(),
+			b.pathReplicationStatus(),
 			b.pathSign(),
 			b.pathVerify(),
 			b.pathBackup(),
 			b.pathRestore(),
 			b.pathTrim(),
 			b.pathCacheConfig(),
+			b.pathWrappingKey(),
 		},
 
-		Secrets:     []*framework.Secret{},
-		Invalidate:  b.invalidate,
-		BackendType: logical.TypeLogical,
+		Secrets:      []*framework.Secret{},
+		Invalidate:   b.invalidate,
+		PeriodicFunc: b.periodicFunc,
+		BackendType:  logical.TypeLogical,
 	}
 
 	// determine cacheSize to use. Defaults to 0 which means unlimited
@@ -95,6 +138,17 @@ type backend struct {
 	// Lock to make changes to any of the backend's cache configuration.
 	configMutex sync.RWMutex
 	cacheSizeChanged bool
+
+	// wrappingKeyLock guards the cached wrapping key used for key imports
+	wrappingKeyLock sync.Mutex
+	wrappingKey     *rsa.PrivateKey
+
+	// checkAutoRotateAfter is the time after which the periodic function
+	// next checks keys for automatic rotation.
+	checkAutoRotateAfter time.Time
+
+	// replicationLock serializes pushing keys to the remote mount
+	replicationLock sync.Mutex
 }
 
 func GetCacheSizeFromStorage(ctx context.Context, s logical.Storage) (int, error) {
@@ -147,6 +201,66 @@ func (b *backend) GetPolicy(ctx context.Context, polReq keysutil.PolicyRequest,
 	return p, true, nil
 }
 
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	var errs error
+	if err := b.autoRotateKeys(ctx, req); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if err := b.persistKeyUsage(ctx, req); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if err := b.periodicReplicateKeys(ctx, req); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	return errs
+}
+
+// persistKeyUsage persists the usage of keys recorded since the last call,
+// bounding how much of it is lost when the node stops. Performance standbys
+// can't write to storage: the uses they record are persisted by the active
+// node, see syncKeyUsage.
+func (b *backend) persistKeyUsage(ctx context.Context, req *logical.Request) error {
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) {
+		return nil
+	}
+	return b.lm.PersistUsage(ctx, req.Storage)
+}
+
+// syncKeyUsage makes sure that the use of the named key by a request is
+// persisted. The active node persists the usage of the key if the persisted
+// usage lags behind. A performance standby returns logical.ErrReadOnly if
+// the request used a key version whose persisted last use is outdated, so
+// that the request is forwarded to the active node and its use persisted
+// there; the usage of key versions is thereby known cluster-wide.
+func (b *backend) syncKeyUsage(ctx context.Context, req *logical.Request, name string) error {
+	readOnly := b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby)
+	err := b.lm.SyncUsage(ctx, req.Storage, name, readOnly)
+	switch {
+	case err == logical.ErrReadOnly:
+		return err
+	case err != nil:
+		// The usage is persisted again by the next request or the
+		// periodic function
+		b.Logger().Warn("error persisting key usage", "key", name, "error", err)
+	}
+	return nil
+}
+
+// withKeyUsage wraps the handler of a path using the key given by the "name"
+// field so that the use of the key is synced once the request is served.
+func (b *backend) withKeyUsage(handler framework.OperationFunc) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		resp, err := handler(ctx, req, d)
+		if err != nil {
+			return resp, err
+		}
+		if err := b.syncKeyUsage(ctx, req, d.Get("name").(string)); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
 func (b *backend) invalidate(ctx context.Context, key string) {
 	if b.Logger().IsDebug() {
 		b.Logger().Debug("invalidating key", "key", key)
@@ -155,6 +269,12 @@ func (b *backend) invalidate(ctx context.Context, key string) {
 	case strings.HasPrefix(key, "policy/"):
 		name := strings.TrimPrefix(key, "policy/")
 		b.lm.InvalidatePolicy(name)
+	case key == path.Join(wrappingKeyStoragePrefix, "policy", wrappingKeyName):
+		b.wrappingKeyLock.Lock()
+		defer b.wrappingKeyLock.Unlock()
+		b.wrappingKey = nil
+	case strings.HasPrefix(key, "usage/"):
+		b.lm.InvalidateUsage(strings.TrimPrefix(key, "usage/"))
 	case strings.HasPrefix(key, "cache-config/"):
 		// Acquire the lock to set the flag to indicate that cache size needs to be refreshed from storage
 		b.configMutex.Lock()
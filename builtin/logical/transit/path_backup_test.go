@@ -20,6 +20,7 @@ func TestTransit_BackupRestore(t *testing.T) {
 	testBackupRestore(t, "ecdsa-p256", "sign-verify")
 	testBackupRestore(t, "ecdsa-p384", "sign-verify")
 	testBackupRestore(t, "ecdsa-p521", "sign-verify")
+	testBackupRestore(t, "ecdsa-secp256k1", "sign-verify")
 	testBackupRestore(t, "ed25519", "sign-verify")
 	testBackupRestore(t, "rsa-2048", "sign-verify")
 	testBackupRestore(t, "rsa-3072", "sign-verify")
@@ -0,0 +1,227 @@
+package transit
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+// batchOperation is an operation of the batch endpoint, performed by the
+// handler of the path with the given fields
+type batchOperation struct {
+	fields  map[string]*framework.FieldSchema
+	handler framework.OperationFunc
+}
+
+// batchResponseItem represents the result of an item of the batch endpoint
+type batchResponseItem struct {
+	// Operation and Name identify the item
+	Operation string `json:"operation" mapstructure:"operation"`
+	Name      string `json:"name" mapstructure:"name"`
+
+	// Data is the response data of the operation
+	Data map[string]interface{} `json:"data,omitempty" mapstructure:"data"`
+
+	// Error, if set represents a failure encountered while performing the
+	// operation of the item
+	Error string `json:"error,omitempty" mapstructure:"error"`
+}
+
+func (b *backend) pathBatch() *framework.Path {
+	return &framework.Path{
+		Pattern: "batch/?$",
+		Fields: map[string]*framework.FieldSchema{
+			"batch_input": {
+				Type: framework.TypeSlice,
+				Description: `The items to process. Each item names an
+"operation", one of "encrypt", "decrypt", "sign",
+"verify" and "hmac", and the key to use as "name",
+along with the parameters of the operation's endpoint.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathBatchWrite,
+		},
+
+		HelpSynopsis:    pathBatchHelpSyn,
+		HelpDescription: pathBatchHelpDesc,
+	}
+}
+
+// batchOperations returns the operations supported by the batch endpoint
+func (b *backend) batchOperations() map[string]batchOperation {
+	return map[string]batchOperation{
+		"encrypt": {fields: b.pathEncrypt().Fields, handler: b.pathEncryptWrite},
+		"decrypt": {fields: b.pathDecrypt().Fields, handler: b.pathDecryptWrite},
+		"sign":    {fields: b.pathSign().Fields, handler: b.pathSignWrite},
+		"verify":  {fields: b.pathVerify().Fields, handler: b.pathVerifyWrite},
+		"hmac":    {fields: b.pathHMAC().Fields, handler: b.pathHMACWrite},
+	}
+}
+
+func (b *backend) pathBatchWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	var items []map[string]interface{}
+	if err := mapstructure.Decode(d.Get("batch_input"), &items); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("failed to parse batch input: %v", err)), logical.ErrInvalidRequest
+	}
+	if len(items) == 0 {
+		return logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
+	}
+
+	operations := b.batchOperations()
+	results := make([]batchResponseItem, len(items))
+
+	// Each item is authorized against the path of its operation, as if it
+	// had been sent on its own
+	sysView, ok := b.System().(logical.ExtendedSystemView)
+	if !ok {
+		return nil, fmt.Errorf("batch requests are not supported by this system view")
+	}
+	itemReqs := make([]*logical.Request, len(items))
+	for i, item := range items {
+		opName, _ := item["operation"].(string)
+		name, _ := item["name"].(string)
+		data := make(map[string]interface{}, len(item))
+		for k, v := range item {
+			if k != "operation" {
+				data[k] = v
+			}
+		}
+		itemReqs[i] = &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      opName + "/" + name,
+			Data:      data,
+		}
+	}
+	allowed, err := sysView.AllowOperations(ctx, itemReqs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Items are independent, so they are spread over a bounded number of
+	// workers; the keys they use are only read-locked
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(items) {
+		workers = len(items)
+	}
+	itemCh := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range itemCh {
+				results[i] = b.processBatchItem(ctx, req.Storage, operations, items[i], allowed[i])
+			}
+		}()
+	}
+	for i := range items {
+		itemCh <- i
+	}
+	close(itemCh)
+	wg.Wait()
+
+	synced := map[string]bool{}
+	for _, result := range results {
+		if result.Error != "" || synced[result.Name] {
+			continue
+		}
+		if err := b.syncKeyUsage(ctx, req, result.Name); err != nil {
+			return nil, err
+		}
+		synced[result.Name] = true
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"batch_results": results,
+		},
+	}, nil
+}
+
+// processBatchItem performs the operation of a batch item with the handler
+// of the operation's endpoint, if the client is allowed to use the endpoint
+func (b *backend) processBatchItem(ctx context.Context, s logical.Storage, operations map[string]batchOperation, item map[string]interface{}, allowed bool) batchResponseItem {
+	opName, _ := item["operation"].(string)
+	name, _ := item["name"].(string)
+	result := batchResponseItem{
+		Operation: opName,
+		Name:      name,
+	}
+
+	operation, ok := operations[opName]
+	switch {
+	case !ok:
+		result.Error = fmt.Sprintf("unsupported operation %q", opName)
+		return result
+	case name == "":
+		result.Error = "missing name"
+		return result
+	case strings.Contains(name, "/"):
+		result.Error = "invalid name"
+		return result
+	case !allowed:
+		result.Error = logical.ErrPermissionDenied.Error()
+		return result
+	}
+
+	raw := make(map[string]interface{}, len(item))
+	for k, v := range item {
+		switch k {
+		case "operation":
+		case "batch_input":
+			result.Error = "batch_input is not supported in batch items"
+			return result
+		default:
+			raw[k] = v
+		}
+	}
+
+	fd := &framework.FieldData{
+		Raw:    raw,
+		Schema: operation.fields,
+	}
+	if err := fd.Validate(); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	resp, err := operation.handler(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      opName + "/" + name,
+		Storage:   s,
+		Data:      raw,
+	}, fd)
+	switch {
+	case resp != nil && resp.IsError():
+		result.Error = resp.Error().Error()
+	case err != nil:
+		result.Error = err.Error()
+	case resp != nil:
+		result.Data = resp.Data
+	}
+
+	return result
+}
+
+const pathBatchHelpSyn = `Perform operations with multiple keys in a single request`
+
+const pathBatchHelpDesc = `
+This path performs a batch of encrypt, decrypt, sign, verify and hmac
+operations, each with its own key and parameters, in a single request.
+Items are processed concurrently, and the result or error of each item is
+returned in the order of the input.
+
+Each item takes the parameters of the endpoint of its operation; keys are
+not created on demand, and items can't themselves use batch_input. Items
+are authorized against the endpoint of their operation and key, e.g.
+"update" on encrypt/<name>, with the policies of the client; items the
+client isn't allowed to perform fail with a permission denied error.
+`
@@ -0,0 +1,228 @@
+package transit
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault"
+)
+
+// testBatchSystemView denies the client of batch requests the paths in denied
+type testBatchSystemView struct {
+	*logical.StaticSystemView
+	denied map[string]bool
+}
+
+func (s *testBatchSystemView) AllowOperations(ctx context.Context, reqs []*logical.Request) ([]bool, error) {
+	allowed := make([]bool, len(reqs))
+	for i, req := range reqs {
+		allowed[i] = req.Operation == logical.UpdateOperation && !s.denied[req.Path]
+	}
+	return allowed, nil
+}
+
+func TestTransit_Batch(t *testing.T) {
+	sysView := &testBatchSystemView{StaticSystemView: logical.TestSystemView()}
+	storage := &logical.InmemStorage{}
+	conf := &logical.BackendConfig{
+		StorageView: storage,
+		System:      sysView,
+	}
+	b, err := Backend(context.Background(), conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Backend.Setup(context.Background(), conf); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	for name, keyType := range map[string]string{
+		"aes":     "aes256-gcm96",
+		"ed25519": "ed25519",
+		"ecdsa":   "ecdsa-p256",
+	} {
+		resp, err := request(logical.UpdateOperation, "keys/"+name, map[string]interface{}{
+			"type": keyType,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+	}
+
+	input := base64.StdEncoding.EncodeToString([]byte("the quick brown fox"))
+
+	// Many items across keys, so that items are processed concurrently
+	var batchInput []interface{}
+	for i := 0; i < 50; i++ {
+		batchInput = append(batchInput,
+			map[string]interface{}{"operation": "encrypt", "name": "aes", "plaintext": input},
+			map[string]interface{}{"operation": "sign", "name": "ed25519", "input": input},
+			map[string]interface{}{"operation": "sign", "name": "ecdsa", "input": input, "hash_algorithm": "sha2-384"},
+			map[string]interface{}{"operation": "hmac", "name": "aes", "input": input},
+		)
+	}
+	batchInput = append(batchInput,
+		map[string]interface{}{"operation": "decrypt", "name": "aes", "ciphertext": "vault:v1:bad"},
+		map[string]interface{}{"operation": "encrypt", "name": "missing", "plaintext": input},
+		map[string]interface{}{"operation": "rotate", "name": "aes"},
+		map[string]interface{}{"operation": "encrypt", "plaintext": input},
+		map[string]interface{}{"operation": "encrypt", "name": "aes", "batch_input": []interface{}{}},
+		map[string]interface{}{"operation": "encrypt", "name": "aes/../denied", "plaintext": input},
+		map[string]interface{}{"operation": "sign", "name": "denied", "input": input},
+	)
+	sysView.denied = map[string]bool{"sign/denied": true}
+
+	resp, err := request(logical.UpdateOperation, "batch", map[string]interface{}{
+		"batch_input": batchInput,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	results := resp.Data["batch_results"].([]batchResponseItem)
+	if len(results) != len(batchInput) {
+		t.Fatalf("expected %d results, got %d", len(batchInput), len(results))
+	}
+
+	// Verify the results of the first round in a second batch
+	item := batchInput[0].(map[string]interface{})
+	if results[0].Operation != "encrypt" || results[0].Name != "aes" || results[0].Error != "" {
+		t.Fatalf("bad result: %#v", results[0])
+	}
+	verifyInput := []interface{}{
+		map[string]interface{}{"operation": "decrypt", "name": "aes", "ciphertext": results[0].Data["ciphertext"]},
+		map[string]interface{}{"operation": "verify", "name": "ed25519", "input": input, "signature": results[1].Data["signature"]},
+		map[string]interface{}{"operation": "verify", "name": "ecdsa", "input": input, "signature": results[2].Data["signature"], "hash_algorithm": "sha2-384"},
+		map[string]interface{}{"operation": "verify", "name": "aes", "input": input, "hmac": results[3].Data["hmac"]},
+		map[string]interface{}{"operation": "verify", "name": "ecdsa", "input": input, "signature": results[2].Data["signature"]},
+	}
+	resp, err = request(logical.UpdateOperation, "batch", map[string]interface{}{
+		"batch_input": verifyInput,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	verifyResults := resp.Data["batch_results"].([]batchResponseItem)
+	if verifyResults[0].Error != "" || verifyResults[0].Data["plaintext"] != item["plaintext"] {
+		t.Fatalf("bad decrypt result: %#v", verifyResults[0])
+	}
+	for i, result := range verifyResults[1:] {
+		expected := i < 3
+		if result.Error != "" || result.Data["valid"] != expected {
+			t.Fatalf("bad verify result %d: %#v", i+1, result)
+		}
+	}
+
+	// Per-item errors
+	for i, result := range results[200:] {
+		if result.Error == "" {
+			t.Fatalf("expected error for item %d, got %#v", i, result)
+		}
+	}
+	if result := results[len(results)-1]; result.Error != logical.ErrPermissionDenied.Error() {
+		t.Fatalf("expected items on denied paths to fail, got %#v", result)
+	}
+	for i, result := range results[:200] {
+		if result.Error != "" {
+			t.Fatalf("unexpected error for item %d: %s", i, result.Error)
+		}
+	}
+
+	resp, err = request(logical.UpdateOperation, "batch", map[string]interface{}{
+		"batch_input": []interface{}{},
+	})
+	if err == nil {
+		t.Fatalf("expected error for empty batch, got resp: %#v", resp)
+	}
+
+	// Keys restricted from an operation are also restricted in batches
+	resp, err = request(logical.UpdateOperation, "keys/aes/config", map[string]interface{}{
+		"allowed_operations": "decrypt",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = request(logical.UpdateOperation, "batch", map[string]interface{}{
+		"batch_input": batchInput[:1],
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if result := resp.Data["batch_results"].([]batchResponseItem)[0]; result.Error != fmt.Sprintf("key %q does not allow the %q operation", "aes", "encrypt") {
+		t.Fatalf("bad result: %#v", result)
+	}
+}
+
+func TestTransit_BatchPolicies(t *testing.T) {
+	coreConfig := &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"transit": Factory,
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	client := cluster.Cores[0].Client
+	if err := client.Sys().Mount("transit", &api.MountInput{Type: "transit"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"allowed", "other"} {
+		if _, err := client.Logical().Write("transit/keys/"+name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Access to the batch endpoint doesn't grant access to the keys
+	if err := client.Sys().PutPolicy("batch", `
+path "transit/batch" { capabilities = ["update"] }
+path "transit/encrypt/allowed" { capabilities = ["update"] }
+`); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := client.Auth().Token().Create(&api.TokenCreateRequest{Policies: []string{"batch"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	batchClient, err := client.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	batchClient.SetToken(secret.Auth.ClientToken)
+
+	input := base64.StdEncoding.EncodeToString([]byte("the quick brown fox"))
+	resp, err := batchClient.Logical().Write("transit/batch", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"operation": "encrypt", "name": "allowed", "plaintext": input},
+			map[string]interface{}{"operation": "encrypt", "name": "other", "plaintext": input},
+			map[string]interface{}{"operation": "decrypt", "name": "allowed", "ciphertext": "vault:v1:bad"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := resp.Data["batch_results"].([]interface{})
+	if result := results[0].(map[string]interface{}); result["error"] != nil || result["data"] == nil {
+		t.Fatalf("expected the allowed item to succeed: %#v", result)
+	}
+	for _, raw := range results[1:] {
+		if result := raw.(map[string]interface{}); result["error"] != logical.ErrPermissionDenied.Error() {
+			t.Fatalf("expected the item to be denied: %#v", result)
+		}
+	}
+}
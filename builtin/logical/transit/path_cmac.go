@@ -0,0 +1,375 @@
+package transit
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	// minCMACLength is the shortest CMAC that can be requested. Truncated
+	// CMACs are common with payment card protocols.
+	minCMACLength = 4
+
+	// maxCMACLength is the full length of an AES-CMAC
+	maxCMACLength = 16
+)
+
+// batchRequestCMACItem represents a request item for batch processing.
+// A map type allows us to distinguish between empty and missing values.
+type batchRequestCMACItem map[string]string
+
+// batchResponseCMACItem represents a response item for batch processing
+type batchResponseCMACItem struct {
+	// CMAC for the input present in the corresponding batch request item
+	CMAC string `json:"cmac,omitempty" mapstructure:"cmac"`
+
+	// Valid indicates whether the given CMAC matches the CMAC of the input
+	Valid bool `json:"valid,omitempty" mapstructure:"valid"`
+
+	// Error, if set represents a failure encountered while computing the
+	// CMAC of a corresponding batch request item
+	Error string `json:"error,omitempty" mapstructure:"error"`
+
+	// As for HMACs, both the error message and the error are needed to
+	// mimic the handling of requests that do not use batch_input.
+	err error
+}
+
+func (b *backend) pathCMAC() *framework.Path {
+	return &framework.Path{
+		Pattern: "cmac/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "The key to use for the CMAC function",
+			},
+
+			"input": {
+				Type:        framework.TypeString,
+				Description: "The base64-encoded input data",
+			},
+
+			"context": {
+				Type:        framework.TypeString,
+				Description: "Base64 encoded context for key derivation. Required if key derivation is enabled",
+			},
+
+			"key_version": {
+				Type: framework.TypeInt,
+				Description: `The version of the key to use for generating the CMAC.
+Must be 0 (for latest) or a value greater than or equal
+to the min_encryption_version configured on the key.`,
+			},
+
+			"mac_length": {
+				Type:    framework.TypeInt,
+				Default: maxCMACLength,
+				Description: `The length in bytes of the CMAC to return; CMACs
+are truncated to this length. Must be between 4 and 16.
+Defaults to 16.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.withKeyUsage(b.pathCMACWrite),
+		},
+
+		HelpSynopsis:    pathCMACHelpSyn,
+		HelpDescription: pathCMACHelpDesc,
+	}
+}
+
+func (b *backend) pathCMACWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	ver := d.Get("key_version").(int)
+
+	macLength := d.Get("mac_length").(int)
+	if macLength < minCMACLength || macLength > maxCMACLength {
+		return logical.ErrorResponse(fmt.Sprintf("mac_length must be between %d and %d", minCMACLength, maxCMACLength)), logical.ErrInvalidRequest
+	}
+
+	// Get the policy
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	if resp, err := checkKeyOperation(p, keyOperationCMAC); err != nil {
+		return resp, err
+	}
+
+	switch {
+	case ver == 0:
+		ver = p.LatestVersion
+	case ver == p.LatestVersion:
+		// Allowed
+	case p.MinEncryptionVersion > 0 && ver < p.MinEncryptionVersion:
+		return logical.ErrorResponse("cannot generate CMAC: version is too old (disallowed by policy)"), logical.ErrInvalidRequest
+	}
+
+	batchInputRaw := d.Raw["batch_input"]
+	var batchInputItems []batchRequestCMACItem
+	if batchInputRaw != nil {
+		err = mapstructure.Decode(batchInputRaw, &batchInputItems)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse batch input: %w", err)
+		}
+
+		if len(batchInputItems) == 0 {
+			return logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
+		}
+	} else {
+		valueRaw, ok := d.GetOk("input")
+		if !ok {
+			return logical.ErrorResponse("missing input for CMAC"), logical.ErrInvalidRequest
+		}
+
+		batchInputItems = make([]batchRequestCMACItem, 1)
+		batchInputItems[0] = batchRequestCMACItem{
+			"input":   valueRaw.(string),
+			"context": d.Get("context").(string),
+		}
+	}
+
+	response := make([]batchResponseCMACItem, len(batchInputItems))
+
+	for i, item := range batchInputItems {
+		rawInput, ok := item["input"]
+		if !ok {
+			response[i].Error = "missing input for CMAC"
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		mac, err := computeCMAC(p, ver, item["context"], rawInput)
+		if err != nil {
+			response[i].Error = err.Error()
+			response[i].err = cmacErrorType(err)
+			continue
+		}
+
+		response[i].CMAC = "vault:v" + strconv.Itoa(ver) + ":" + base64.StdEncoding.EncodeToString(mac[:macLength])
+	}
+
+	// Generate the response
+	resp := &logical.Response{}
+	if batchInputRaw != nil {
+		resp.Data = map[string]interface{}{
+			"batch_results": response,
+		}
+	} else {
+		if response[0].err != nil {
+			if response[0].err == logical.ErrInvalidRequest {
+				return logical.ErrorResponse(response[0].Error), response[0].err
+			}
+			return nil, response[0].err
+		}
+		resp.Data = map[string]interface{}{
+			"cmac": response[0].CMAC,
+		}
+	}
+
+	return resp, nil
+}
+
+func (b *backend) pathCMACVerify(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	// Get the policy
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	if resp, err := checkKeyOperation(p, keyOperationVerify); err != nil {
+		return resp, err
+	}
+
+	batchInputRaw := d.Raw["batch_input"]
+	var batchInputItems []batchRequestCMACItem
+	if batchInputRaw != nil {
+		err := mapstructure.Decode(batchInputRaw, &batchInputItems)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse batch input: %w", err)
+		}
+
+		if len(batchInputItems) == 0 {
+			return logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
+		}
+	} else {
+		// use empty string if input is missing - not an error
+		batchInputItems = make([]batchRequestCMACItem, 1)
+		batchInputItems[0] = batchRequestCMACItem{
+			"input":   d.Get("input").(string),
+			"cmac":    d.Get("cmac").(string),
+			"context": d.Get("context").(string),
+		}
+	}
+
+	response := make([]batchResponseCMACItem, len(batchInputItems))
+
+	for i, item := range batchInputItems {
+		rawInput, ok := item["input"]
+		if !ok {
+			response[i].Error = "missing input"
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		verificationCMAC, ok := item["cmac"]
+		if !ok {
+			response[i].Error = "missing cmac"
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		ver, verBytes, err := parseVersionedCMAC(verificationCMAC)
+		if err != nil {
+			response[i].Error = err.Error()
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		if ver > p.LatestVersion {
+			response[i].Error = "invalid CMAC: version is too new"
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		if p.MinDecryptionVersion > 0 && ver < p.MinDecryptionVersion {
+			response[i].Error = "cannot verify CMAC: version is too old (disallowed by policy)"
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		mac, err := computeCMAC(p, ver, item["context"], rawInput)
+		if err != nil {
+			response[i].Error = err.Error()
+			response[i].err = cmacErrorType(err)
+			continue
+		}
+
+		response[i].Valid = subtle.ConstantTimeCompare(mac[:len(verBytes)], verBytes) == 1
+	}
+
+	// Generate the response
+	resp := &logical.Response{}
+	if batchInputRaw != nil {
+		resp.Data = map[string]interface{}{
+			"batch_results": response,
+		}
+	} else {
+		if response[0].err != nil {
+			if response[0].err == logical.ErrInvalidRequest {
+				return logical.ErrorResponse(response[0].Error), response[0].err
+			}
+			return nil, response[0].err
+		}
+		resp.Data = map[string]interface{}{
+			"valid": response[0].Valid,
+		}
+	}
+
+	return resp, nil
+}
+
+// computeCMAC returns the full-length CMAC of the base64-encoded input with
+// the given version of the key.
+func computeCMAC(p *keysutil.Policy, ver int, contextRaw, inputRaw string) ([]byte, error) {
+	input, err := base64.StdEncoding.DecodeString(inputRaw)
+	if err != nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("unable to decode input as base64: %s", err)}
+	}
+
+	var context []byte
+	if len(contextRaw) != 0 {
+		context, err = base64.StdEncoding.DecodeString(contextRaw)
+		if err != nil {
+			return nil, errutil.UserError{Err: "failed to base64-decode context"}
+		}
+	}
+
+	key, err := p.CMACKey(ver, context)
+	if err != nil {
+		return nil, err
+	}
+
+	return keysutil.CMAC(key, input)
+}
+
+// parseVersionedCMAC splits a CMAC of the form "vault:v<version>:<base64>"
+// into its key version and the decoded CMAC.
+func parseVersionedCMAC(versionedCMAC string) (int, []byte, error) {
+	if !strings.HasPrefix(versionedCMAC, "vault:v") {
+		return 0, nil, fmt.Errorf("invalid CMAC to verify: no prefix")
+	}
+
+	splitCMAC := strings.SplitN(strings.TrimPrefix(versionedCMAC, "vault:v"), ":", 2)
+	if len(splitCMAC) != 2 {
+		return 0, nil, fmt.Errorf("invalid CMAC: wrong number of fields")
+	}
+
+	ver, err := strconv.Atoi(splitCMAC[0])
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid CMAC: version number could not be decoded")
+	}
+
+	mac, err := base64.StdEncoding.DecodeString(splitCMAC[1])
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to decode verification CMAC as base64: %s", err)
+	}
+	if len(mac) < minCMACLength || len(mac) > maxCMACLength {
+		return 0, nil, fmt.Errorf("invalid CMAC: length must be between %d and %d bytes", minCMACLength, maxCMACLength)
+	}
+
+	return ver, mac, nil
+}
+
+// cmacErrorType returns ErrInvalidRequest for user errors, so that they are
+// returned as error responses, and the error itself otherwise.
+func cmacErrorType(err error) error {
+	if _, ok := err.(errutil.UserError); ok {
+		return logical.ErrInvalidRequest
+	}
+	return err
+}
+
+const pathCMACHelpSyn = `Generate an AES-CMAC for input data using the named key`
+
+const pathCMACHelpDesc = `
+Generates an AES-CMAC (NIST SP 800-38B) of the given input data with the
+named key, which must be an "aes128-gcm96" or "aes256-gcm96" key. The CMAC
+is computed with the key material itself, so that CMACs can be verified by
+other systems holding the same key, for instance one imported into Vault.
+CMACs can be verified with the "verify" endpoint.
+`
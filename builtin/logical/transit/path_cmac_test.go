@@ -0,0 +1,227 @@
+package transit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestTransit_CMAC(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	// Import the AES-128 key from RFC 4493 so that the CMAC can be checked
+	// against its test vectors
+	resp, err := request(logical.ReadOperation, "wrapping_key", nil)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	wrappingKey, err := parseTransportPublicKey(resp.Data["public_key"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	wrappedKey, err := wrapKeyToPublicKey(rand.Reader, wrappingKey, sha256.New(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = request(logical.UpdateOperation, "keys/rfc4493/import", map[string]interface{}{
+		"type":       "aes128-gcm96",
+		"ciphertext": base64.StdEncoding.EncodeToString(wrappedKey),
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	message, _ := hex.DecodeString("6bc1bee22e409f96e93d7e117393172a")
+	expected, _ := hex.DecodeString("070a16b46b4d4144f79bdd9dd04a287c")
+	input := base64.StdEncoding.EncodeToString(message)
+
+	resp, err = request(logical.UpdateOperation, "cmac/rfc4493", map[string]interface{}{
+		"input": input,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	cmac := resp.Data["cmac"].(string)
+	if cmac != "vault:v1:"+base64.StdEncoding.EncodeToString(expected) {
+		t.Fatalf("unexpected CMAC %q", cmac)
+	}
+
+	verify := func(input, cmac string) bool {
+		t.Helper()
+		resp, err := request(logical.UpdateOperation, "verify/rfc4493", map[string]interface{}{
+			"input": input,
+			"cmac":  cmac,
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		return resp.Data["valid"].(bool)
+	}
+
+	if !verify(input, cmac) {
+		t.Fatal("expected CMAC to verify")
+	}
+	if verify(base64.StdEncoding.EncodeToString([]byte("other")), cmac) {
+		t.Fatal("expected CMAC of other input not to verify")
+	}
+
+	// Truncated CMACs are prefixes of the full CMAC
+	resp, err = request(logical.UpdateOperation, "cmac/rfc4493", map[string]interface{}{
+		"input":      input,
+		"mac_length": 8,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	truncated := resp.Data["cmac"].(string)
+	if truncated != "vault:v1:"+base64.StdEncoding.EncodeToString(expected[:8]) {
+		t.Fatalf("unexpected truncated CMAC %q", truncated)
+	}
+	if !verify(input, truncated) {
+		t.Fatal("expected truncated CMAC to verify")
+	}
+
+	for _, macLength := range []int{3, 17} {
+		resp, err = request(logical.UpdateOperation, "cmac/rfc4493", map[string]interface{}{
+			"input":      input,
+			"mac_length": macLength,
+		})
+		if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for mac_length %d: err: %v resp: %#v", macLength, err, resp)
+		}
+	}
+
+	// Batch requests
+	resp, err = request(logical.UpdateOperation, "cmac/rfc4493", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"input": input},
+			map[string]interface{}{"input": "not base64"},
+		},
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	batchResults := resp.Data["batch_results"].([]batchResponseCMACItem)
+	if batchResults[0].CMAC != cmac || batchResults[1].Error == "" {
+		t.Fatalf("unexpected batch results: %#v", batchResults)
+	}
+
+	resp, err = request(logical.UpdateOperation, "verify/rfc4493", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"input": input, "cmac": cmac},
+			map[string]interface{}{"input": input, "cmac": "vault:v1:" + base64.StdEncoding.EncodeToString(make([]byte, 16))},
+		},
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	batchResults = resp.Data["batch_results"].([]batchResponseCMACItem)
+	if !batchResults[0].Valid || batchResults[1].Valid {
+		t.Fatalf("unexpected batch results: %#v", batchResults)
+	}
+
+	// CMACs and HMACs can't be mixed
+	resp, err = request(logical.UpdateOperation, "verify/rfc4493", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"input": input, "cmac": cmac},
+			map[string]interface{}{"input": input, "hmac": cmac},
+		},
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error mixing CMACs and HMACs: err: %v resp: %#v", err, resp)
+	}
+
+	// A version that doesn't exist can't be verified
+	resp, err = request(logical.UpdateOperation, "verify/rfc4493", map[string]interface{}{
+		"input": input,
+		"cmac":  "vault:v2:" + base64.StdEncoding.EncodeToString(expected),
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error verifying a future version: err: %v resp: %#v", err, resp)
+	}
+
+	// Only AES keys support CMAC
+	resp, err = request(logical.UpdateOperation, "keys/rsa", map[string]interface{}{
+		"type": "rsa-2048",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = request(logical.UpdateOperation, "cmac/rsa", map[string]interface{}{
+		"input": input,
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for RSA key: err: %v resp: %#v", err, resp)
+	}
+}
+
+func TestTransit_CMAC_Derived(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	resp, err := request(logical.UpdateOperation, "keys/derived", map[string]interface{}{
+		"derived": true,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	input := base64.StdEncoding.EncodeToString([]byte("the quick brown fox"))
+	cmacWithContext := func(context string) (*logical.Response, error) {
+		return request(logical.UpdateOperation, "cmac/derived", map[string]interface{}{
+			"input":   input,
+			"context": base64.StdEncoding.EncodeToString([]byte(context)),
+		})
+	}
+
+	resp, err = request(logical.UpdateOperation, "cmac/derived", map[string]interface{}{
+		"input": input,
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error without context: err: %v resp: %#v", err, resp)
+	}
+
+	resp1, err := cmacWithContext("one")
+	if err != nil || resp1 == nil || resp1.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp1)
+	}
+	resp2, err := cmacWithContext("two")
+	if err != nil || resp2 == nil || resp2.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp2)
+	}
+	if resp1.Data["cmac"] == resp2.Data["cmac"] {
+		t.Fatal("expected CMACs with different contexts to differ")
+	}
+
+	resp, err = request(logical.UpdateOperation, "verify/derived", map[string]interface{}{
+		"input":   input,
+		"cmac":    resp1.Data["cmac"],
+		"context": base64.StdEncoding.EncodeToString([]byte("one")),
+	})
+	if err != nil || resp == nil || resp.IsError() || !resp.Data["valid"].(bool) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+}
@@ -3,12 +3,44 @@ package transit
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
+// The operations keys can be restricted to with allowed_operations
+const (
+	keyOperationEncrypt = "encrypt"
+	keyOperationDecrypt = "decrypt"
+	keyOperationRewrap  = "rewrap"
+	keyOperationDatakey = "datakey"
+	keyOperationSign    = "sign"
+	keyOperationVerify  = "verify"
+	keyOperationHMAC    = "hmac"
+	keyOperationCMAC    = "cmac"
+	keyOperationDerive  = "derive"
+
+	keyOperationTokenize   = "tokenize"
+	keyOperationDetokenize = "detokenize"
+)
+
+var keyOperations = []string{
+	keyOperationEncrypt,
+	keyOperationDecrypt,
+	keyOperationRewrap,
+	keyOperationDatakey,
+	keyOperationSign,
+	keyOperationVerify,
+	keyOperationHMAC,
+	keyOperationCMAC,
+	keyOperationDerive,
+	keyOperationTokenize,
+	keyOperationDetokenize,
+}
+
 func (b *backend) pathConfig() *framework.Path {
 	return &framework.Path{
 		Pattern: "keys/" + framework.GenericNameRegex("name") + "/config",
@@ -47,6 +79,31 @@ the latest version of the key is allowed.`,
 				Type:        framework.TypeBool,
 				Description: `Enables taking a backup of the named key in plaintext format. Once set, this cannot be disabled.`,
 			},
+
+			"allow_wrapped_export": {
+				Type:        framework.TypeBool,
+				Description: `Enables exporting the named key wrapped to a public key. Once set, this cannot be disabled.`,
+			},
+
+			"allowed_operations": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `The operations the key may be used for, out of
+"encrypt", "decrypt", "rewrap", "datakey", "sign",
+"verify", "hmac", "cmac", "derive", "tokenize" and
+"detokenize". "verify" covers the verification of
+signatures, HMACs and CMACs, and "encrypt" and
+"decrypt" cover format-preserving encryption. If
+empty (default), the key may be used
+for all operations its type supports.`,
+			},
+
+			"auto_rotate_period": {
+				Type: framework.TypeDurationSecond,
+				Description: `Amount of time the key should live before
+being automatically rotated. A value of 0
+(default) disables automatic rotation for the
+key. Otherwise it must be at least an hour.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -84,6 +141,9 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *
 	originalDeletionAllowed := p.DeletionAllowed
 	originalExportable := p.Exportable
 	originalAllowPlaintextBackup := p.AllowPlaintextBackup
+	originalAllowWrappedExport := p.AllowWrappedExport
+	originalAutoRotatePeriod := p.AutoRotatePeriod
+	originalAllowedOperations := p.AllowedOperations
 
 	defer func() {
 		if retErr != nil || (resp != nil && resp.IsError()) {
@@ -92,6 +152,9 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *
 			p.DeletionAllowed = originalDeletionAllowed
 			p.Exportable = originalExportable
 			p.AllowPlaintextBackup = originalAllowPlaintextBackup
+			p.AllowWrappedExport = originalAllowWrappedExport
+			p.AutoRotatePeriod = originalAutoRotatePeriod
+			p.AllowedOperations = originalAllowedOperations
 		}
 	}()
 
@@ -185,6 +248,47 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *
 		}
 	}
 
+	allowWrappedExportRaw, ok := d.GetOk("allow_wrapped_export")
+	if ok {
+		allowWrappedExport := allowWrappedExportRaw.(bool)
+		// Don't unset the already set value
+		if allowWrappedExport && !p.AllowWrappedExport {
+			p.AllowWrappedExport = allowWrappedExport
+			persistNeeded = true
+		}
+	}
+
+	autoRotatePeriodRaw, ok := d.GetOk("auto_rotate_period")
+	if ok {
+		autoRotatePeriod := time.Second * time.Duration(autoRotatePeriodRaw.(int))
+		switch {
+		case autoRotatePeriod < 0:
+			return logical.ErrorResponse("auto rotate period cannot be negative"), nil
+		case autoRotatePeriod != 0 && autoRotatePeriod < minAutoRotatePeriod:
+			return logical.ErrorResponse(fmt.Sprintf("auto rotate period must be 0 to disable or at least %s", minAutoRotatePeriod)), nil
+		case autoRotatePeriod != 0 && p.Imported && !p.AllowImportedKeyRotation:
+			return logical.ErrorResponse("auto rotation cannot be enabled for imported keys that do not allow rotation"), nil
+		}
+		if autoRotatePeriod != p.AutoRotatePeriod {
+			p.AutoRotatePeriod = autoRotatePeriod
+			persistNeeded = true
+		}
+	}
+
+	allowedOperationsRaw, ok := d.GetOk("allowed_operations")
+	if ok {
+		allowedOperations := strutil.RemoveDuplicates(allowedOperationsRaw.([]string), true)
+		for _, operation := range allowedOperations {
+			if !strutil.StrListContains(keyOperations, operation) {
+				return logical.ErrorResponse(fmt.Sprintf("unknown operation %q in allowed_operations", operation)), nil
+			}
+		}
+		if !strutil.EquivalentSlices(allowedOperations, p.AllowedOperations) {
+			p.AllowedOperations = allowedOperations
+			persistNeeded = true
+		}
+	}
+
 	if !persistNeeded {
 		return nil, nil
 	}
@@ -203,10 +307,22 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *
 	return resp, p.Persist(ctx, req.Storage)
 }
 
+// checkKeyOperation returns an error response if the key may not be used for
+// the given operation.
+func checkKeyOperation(p *keysutil.Policy, operation string) (*logical.Response, error) {
+	if p.OperationAllowed(operation) {
+		return nil, nil
+	}
+	return logical.ErrorResponse(fmt.Sprintf("key %q does not allow the %q operation", p.Name, operation)), logical.ErrInvalidRequest
+}
+
 const pathConfigHelpSyn = `Configure a named encryption key`
 
 const pathConfigHelpDesc = `
 This path is used to configure the named key. Currently, this
 supports adjusting the minimum version of the key allowed to
-be used for decryption via the min_decryption_version parameter.
+be used for decryption via the min_decryption_version parameter,
+automatic rotation of the key via the auto_rotate_period
+parameter, and the operations the key may be used for via the
+allowed_operations parameter.
 `
@@ -2,10 +2,15 @@ package transit
 
 import (
 	"context"
+	"encoding/base64"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
@@ -283,3 +288,374 @@ func TestTransit_ConfigSettings(t *testing.T) {
 	testHMAC(3, true)
 	testHMAC(2, false)
 }
+
+func TestTransit_AutoRotate(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	for _, name := range []string{"manual", "auto"} {
+		if _, err := request(logical.UpdateOperation, "keys/"+name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, period := range []string{"-1h", "30m"} {
+		resp, err := request(logical.UpdateOperation, "keys/auto/config", map[string]interface{}{
+			"auto_rotate_period": period,
+		})
+		if err == nil && (resp == nil || !resp.IsError()) {
+			t.Fatalf("expected error setting auto rotate period of %s", period)
+		}
+	}
+
+	resp, err := request(logical.UpdateOperation, "keys/auto/config", map[string]interface{}{
+		"auto_rotate_period": "24h",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = request(logical.ReadOperation, "keys/auto", nil)
+	if err != nil || resp == nil || resp.Data["auto_rotate_period"] != int64(24*3600) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	latestVersion := func(name string) int {
+		resp, err := request(logical.ReadOperation, "keys/"+name, nil)
+		if err != nil || resp == nil {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		return resp.Data["latest_version"].(int)
+	}
+
+	// A fresh key is not rotated
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	if latestVersion("auto") != 1 {
+		t.Fatal("expected key not to be rotated")
+	}
+
+	// Age both keys past the period; only the key with auto rotation
+	// enabled is rotated, and only once the check interval has passed
+	for _, name := range []string{"manual", "auto"} {
+		p, _, err := b.GetPolicy(context.Background(), keysutil.PolicyRequest{
+			Storage: storage,
+			Name:    name,
+		}, b.GetRandomReader())
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry := p.Keys["1"]
+		entry.CreationTime = time.Now().Add(-48 * time.Hour)
+		p.Keys["1"] = entry
+		if err := p.Persist(context.Background(), storage); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	if latestVersion("auto") != 1 {
+		t.Fatal("expected keys to be checked at most once per interval")
+	}
+
+	b.checkAutoRotateAfter = time.Now()
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	if latestVersion("auto") != 2 {
+		t.Fatal("expected key to be rotated")
+	}
+	if latestVersion("manual") != 1 {
+		t.Fatal("expected key without auto rotate period not to be rotated")
+	}
+
+	// The new version resets the period
+	b.checkAutoRotateAfter = time.Now()
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	if latestVersion("auto") != 2 {
+		t.Fatal("expected key not to be rotated again")
+	}
+}
+
+func TestTransit_AllowedOperations(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	resp, err := request(logical.UpdateOperation, "keys/aes", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	plaintext := base64.StdEncoding.EncodeToString([]byte("the quick brown fox"))
+	encrypt := func() (*logical.Response, error) {
+		return request(logical.UpdateOperation, "encrypt/aes", map[string]interface{}{
+			"plaintext": plaintext,
+		})
+	}
+
+	resp, err = encrypt()
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	ciphertext := resp.Data["ciphertext"].(string)
+
+	resp, err = request(logical.UpdateOperation, "keys/aes/config", map[string]interface{}{
+		"allowed_operations": "encrypt,unknown",
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error setting unknown operation: err: %v resp: %#v", err, resp)
+	}
+
+	resp, err = request(logical.UpdateOperation, "keys/aes/config", map[string]interface{}{
+		"allowed_operations": []string{"encrypt", "hmac"},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = request(logical.ReadOperation, "keys/aes", nil)
+	if err != nil || resp == nil || !reflect.DeepEqual(resp.Data["allowed_operations"], []string{"encrypt", "hmac"}) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	// The key may only encrypt and HMAC
+	resp, err = encrypt()
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = request(logical.UpdateOperation, "hmac/aes", map[string]interface{}{
+		"input": plaintext,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	hmac := resp.Data["hmac"].(string)
+
+	for path, data := range map[string]map[string]interface{}{
+		"decrypt/aes":           {"ciphertext": ciphertext},
+		"rewrap/aes":            {"ciphertext": ciphertext},
+		"datakey/plaintext/aes": {},
+		"cmac/aes":              {"input": plaintext},
+		"verify/aes":            {"input": plaintext, "hmac": hmac},
+		"derive/aes":            {},
+	} {
+		resp, err := request(logical.UpdateOperation, path, data)
+		if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "does not allow") {
+			t.Fatalf("%s: expected error: err: %v resp: %#v", path, err, resp)
+		}
+	}
+
+	// Clearing the restriction allows all operations again
+	resp, err = request(logical.UpdateOperation, "keys/aes/config", map[string]interface{}{
+		"allowed_operations": "",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = request(logical.UpdateOperation, "decrypt/aes", map[string]interface{}{
+		"ciphertext": ciphertext,
+	})
+	if err != nil || resp == nil || resp.IsError() || resp.Data["plaintext"] != plaintext {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+}
+
+func TestTransit_KeyUsage(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	readUsage := func() map[string]map[string]interface{} {
+		t.Helper()
+		resp, err := request(logical.ReadOperation, "keys/signing", nil)
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		return resp.Data["usage"].(map[string]map[string]interface{})
+	}
+
+	resp, err := request(logical.UpdateOperation, "keys/signing", map[string]interface{}{
+		"type": "ecdsa-p256",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if usage := readUsage(); len(usage) != 0 {
+		t.Fatalf("expected no usage: %#v", usage)
+	}
+
+	input := base64.StdEncoding.EncodeToString([]byte("the quick brown fox"))
+	before := time.Now()
+	resp, err = request(logical.UpdateOperation, "sign/signing", map[string]interface{}{
+		"input": input,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	signature := resp.Data["signature"]
+	for i := 0; i < 2; i++ {
+		resp, err = request(logical.UpdateOperation, "verify/signing", map[string]interface{}{
+			"input":     input,
+			"signature": signature,
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+	}
+
+	// Rotate and trim the first version, whose usage is no longer reported
+	resp, err = request(logical.UpdateOperation, "keys/signing/rotate", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = request(logical.UpdateOperation, "sign/signing", map[string]interface{}{
+		"input": input,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	usage := readUsage()
+	if len(usage) != 2 || usage["1"]["count"] != uint64(3) || usage["2"]["count"] != uint64(1) {
+		t.Fatalf("unexpected usage: %#v", usage)
+	}
+	if lastUsed := usage["1"]["last_used"].(time.Time); lastUsed.Before(before.Add(-time.Second)) {
+		t.Fatalf("unexpected last used time %v", lastUsed)
+	}
+
+	// Usage is persisted periodically
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := storage.Get(context.Background(), "usage/signing")
+	if err != nil || entry == nil {
+		t.Fatalf("expected usage to be persisted: err: %v", err)
+	}
+
+	resp, err = request(logical.UpdateOperation, "keys/signing/config", map[string]interface{}{
+		"min_decryption_version": 2,
+		"min_encryption_version": 2,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	// The first version was just used, so it can't be trimmed unless the
+	// usage window is disabled
+	resp, err = request(logical.UpdateOperation, "keys/signing/trim", map[string]interface{}{
+		"min_available_version": 2,
+	})
+	if err != nil || resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "cannot trim key versions used within the usage window: 1") {
+		t.Fatalf("expected trimming to be refused: err: %v resp: %#v", err, resp)
+	}
+	resp, err = request(logical.UpdateOperation, "keys/signing/trim", map[string]interface{}{
+		"min_available_version": 2,
+		"usage_window":          0,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if usage := readUsage(); len(usage) != 1 || usage["2"] == nil {
+		t.Fatalf("unexpected usage after trimming: %#v", usage)
+	}
+}
+
+func TestTransit_KeyUsagePerfStandby(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	active := createBackendWithSysViewWithStorage(t, storage)
+	standby := createBackendWithSysViewWithStorage(t, storage)
+	standby.System().(*logical.StaticSystemView).ReplicationStateVal = consts.ReplicationPerformanceStandby
+
+	request := func(b *backend, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+	encrypt := map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString([]byte("the quick brown fox")),
+	}
+
+	resp, err := request(active, "keys/foo", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	// The first use of a version is persisted by the active node...
+	resp, err = request(active, "encrypt/foo", encrypt)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if entry, err := storage.Get(context.Background(), "usage/foo"); err != nil || entry == nil {
+		t.Fatalf("expected usage to be persisted: err: %v", err)
+	}
+
+	// ...so the standby serves the version itself
+	resp, err = request(standby, "encrypt/foo", encrypt)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	// A version the persisted usage does not show as used is not served by
+	// the standby, but forwarded to the active node
+	resp, err = request(active, "keys/foo/rotate", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	standby.invalidate(context.Background(), "policy/foo")
+	if _, err := request(standby, "encrypt/foo", encrypt); err != logical.ErrReadOnly {
+		t.Fatalf("expected a read-only error, got: %v", err)
+	}
+
+	resp, err = request(active, "encrypt/foo", encrypt)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	standby.invalidate(context.Background(), "usage/foo")
+	resp, err = request(standby, "encrypt/foo", encrypt)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	// The standby reports the usage persisted by the active node
+	resp, err = standby.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "keys/foo",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	usage := resp.Data["usage"].(map[string]map[string]interface{})
+	if usage["1"]["count"] != uint64(1) || usage["2"]["count"] != uint64(1) {
+		t.Fatalf("unexpected usage: %#v", usage)
+	}
+}
@@ -54,7 +54,7 @@ min_encryption_version configured on the key.`,
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
-			logical.UpdateOperation: b.pathDatakeyWrite,
+			logical.UpdateOperation: b.withKeyUsage(b.pathDatakeyWrite),
 		},
 
 		HelpSynopsis:    pathDatakeyHelpSyn,
@@ -114,6 +114,10 @@ func (b *backend) pathDatakeyWrite(ctx context.Context, req *logical.Request, d
 	}
 	defer p.Unlock()
 
+	if resp, err := checkKeyOperation(p, keyOperationDatakey); err != nil {
+		return resp, err
+	}
+
 	newKey := make([]byte, 32)
 	bits := d.Get("bits").(int)
 	switch bits {
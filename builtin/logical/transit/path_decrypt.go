@@ -54,7 +54,7 @@ Vault 0.6.1. Not required for keys created in 0.6.2+.`,
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
-			logical.UpdateOperation: b.pathDecryptWrite,
+			logical.UpdateOperation: b.withKeyUsage(b.pathDecryptWrite),
 		},
 
 		HelpSynopsis:    pathDecryptHelpSyn,
@@ -142,6 +142,11 @@ func (b *backend) pathDecryptWrite(ctx context.Context, req *logical.Request, d
 		p.Lock(false)
 	}
 
+	if resp, err := checkKeyOperation(p, keyOperationDecrypt); err != nil {
+		p.Unlock()
+		return resp, err
+	}
+
 	for i, item := range batchInputItems {
 		if batchResponseItems[i].Error != "" {
 			continue
@@ -0,0 +1,194 @@
+package transit
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"fmt"
+	"hash"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func (b *backend) pathDerive() *framework.Path {
+	return &framework.Path{
+		Pattern: "derive/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "The key to derive key material from",
+			},
+
+			"salt": {
+				Type:        framework.TypeString,
+				Description: "Base64 encoded HKDF salt. Optional.",
+			},
+
+			"info": {
+				Type: framework.TypeString,
+				Description: `Base64 encoded HKDF info, binding the derived key
+material to its intended use. Optional.`,
+			},
+
+			"length": {
+				Type:        framework.TypeInt,
+				Default:     32,
+				Description: "The number of bytes of key material to derive. Defaults to 32.",
+			},
+
+			"hash_algorithm": {
+				Type:    framework.TypeString,
+				Default: "sha2-256",
+				Description: `Hash algorithm to use with HKDF. Valid values are:
+
+* sha2-224
+* sha2-256
+* sha2-384
+* sha2-512
+* sha3-224
+* sha3-256
+* sha3-384
+* sha3-512
+
+Defaults to "sha2-256".`,
+			},
+
+			"key_version": {
+				Type: framework.TypeInt,
+				Description: `The version of the key to derive from. Must be 0
+(for latest) or a value greater than or equal to the
+min_encryption_version configured on the key.`,
+			},
+
+			"public_key": {
+				Type: framework.TypeString,
+				Description: `A PEM-encoded RSA, ECDSA or X25519 public key. If
+set, the derived key material is returned wrapped for transport to the
+holder of the matching private key instead of in plaintext.`,
+			},
+
+			"hash_function": {
+				Type:    framework.TypeString,
+				Default: "SHA256",
+				Description: `The hash function used as part of the RSA-OAEP
+wrapping of the ephemeral AES key when "public_key" is set. Can be one of
+"SHA1", "SHA224", "SHA256" (default), "SHA384", or "SHA512".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.withKeyUsage(b.pathDeriveWrite),
+		},
+
+		HelpSynopsis:    pathDeriveHelpSyn,
+		HelpDescription: pathDeriveHelpDesc,
+	}
+}
+
+func (b *backend) pathDeriveWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	ver := d.Get("key_version").(int)
+	length := d.Get("length").(int)
+
+	algorithm := d.Get("hash_algorithm").(string)
+	hashAlgorithm, ok := keysutil.HashTypeMap[algorithm]
+	if !ok {
+		return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %q", algorithm)), logical.ErrInvalidRequest
+	}
+
+	var salt, info []byte
+	var err error
+	if saltB64 := d.Get("salt").(string); saltB64 != "" {
+		salt, err = base64.StdEncoding.DecodeString(saltB64)
+		if err != nil {
+			return logical.ErrorResponse("failed to base64-decode salt"), logical.ErrInvalidRequest
+		}
+	}
+	if infoB64 := d.Get("info").(string); infoB64 != "" {
+		info, err = base64.StdEncoding.DecodeString(infoB64)
+		if err != nil {
+			return logical.ErrorResponse("failed to base64-decode info"), logical.ErrInvalidRequest
+		}
+	}
+
+	var wrappingKey crypto.PublicKey
+	var hashFn hash.Hash
+	if publicKeyPEM := d.Get("public_key").(string); publicKeyPEM != "" {
+		wrappingKey, err = parseTransportPublicKey(publicKeyPEM)
+		if err != nil {
+			return handleKeysutilError(err)
+		}
+		hashFn, err = parseImportHashFunction(d.Get("hash_function").(string))
+		if err != nil {
+			return handleKeysutilError(err)
+		}
+	}
+
+	// Get the policy
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	if resp, err := checkKeyOperation(p, keyOperationDerive); err != nil {
+		return resp, err
+	}
+
+	switch {
+	case ver == 0:
+		ver = p.LatestVersion
+	case ver < 0 || ver > p.LatestVersion:
+		return logical.ErrorResponse("invalid key version"), logical.ErrInvalidRequest
+	case p.MinEncryptionVersion > 0 && ver < p.MinEncryptionVersion:
+		return logical.ErrorResponse("cannot derive key material: version is too old (disallowed by policy)"), logical.ErrInvalidRequest
+	}
+
+	derivedKey, err := p.DeriveKeyMaterial(ver, hashAlgorithm, salt, info, length)
+	if err != nil {
+		return handleKeysutilError(err)
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"key_version": ver,
+		},
+	}
+
+	if wrappingKey == nil {
+		resp.Data["derived_key"] = base64.StdEncoding.EncodeToString(derivedKey)
+		return resp, nil
+	}
+
+	wrappedKey, err := wrapKeyToPublicKey(b.GetRandomReader(), wrappingKey, hashFn, derivedKey)
+	if err != nil {
+		return handleKeysutilError(err)
+	}
+	resp.Data["wrapped_key"] = base64.StdEncoding.EncodeToString(wrappedKey)
+
+	return resp, nil
+}
+
+const pathDeriveHelpSyn = `Derive key material from the named key with HKDF`
+
+const pathDeriveHelpDesc = `
+Derives key material from the named key with HKDF (RFC 5869) for use by
+downstream systems. The named key must be an "aes128-gcm96", "aes256-gcm96"
+or "chacha20-poly1305" key. The same key version, salt, info, length and
+hash algorithm always derive the same key material.
+
+If "public_key" is set, the derived key material is wrapped to it in the
+same format as keys exported with the "wrapped_export" endpoint, and is
+returned base64-encoded as "wrapped_key".
+`
@@ -0,0 +1,157 @@
+package transit
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestTransit_Derive(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	resp, err := request(logical.UpdateOperation, "keys/root", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	derive := func(data map[string]interface{}) []byte {
+		t.Helper()
+		resp, err := request(logical.UpdateOperation, "derive/root", data)
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		if resp.Data["key_version"] != 1 {
+			t.Fatalf("unexpected key version: %#v", resp.Data)
+		}
+		derivedKey, err := base64.StdEncoding.DecodeString(resp.Data["derived_key"].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return derivedKey
+	}
+
+	salt := base64.StdEncoding.EncodeToString([]byte("salt"))
+	info := base64.StdEncoding.EncodeToString([]byte("payments"))
+
+	key1 := derive(map[string]interface{}{"salt": salt, "info": info})
+	if len(key1) != 32 {
+		t.Fatalf("expected 32 bytes of key material, got %d", len(key1))
+	}
+	if key2 := derive(map[string]interface{}{"salt": salt, "info": info}); !bytes.Equal(key1, key2) {
+		t.Fatal("expected derivation to be deterministic")
+	}
+	if key2 := derive(map[string]interface{}{"salt": salt}); bytes.Equal(key1, key2) {
+		t.Fatal("expected different info to derive different key material")
+	}
+	if key2 := derive(map[string]interface{}{"salt": salt, "info": info, "hash_algorithm": "sha2-512"}); bytes.Equal(key1, key2) {
+		t.Fatal("expected different hash algorithms to derive different key material")
+	}
+	if key2 := derive(map[string]interface{}{"salt": salt, "info": info, "length": 64}); len(key2) != 64 || !bytes.Equal(key1, key2[:32]) {
+		t.Fatal("expected longer key material to extend shorter key material")
+	}
+
+	// The derived key material must not be the key itself, nor the key
+	// used for derived encryption
+	policy, _, err := b.GetPolicy(context.Background(), keysutil.PolicyRequest{
+		Storage: storage,
+		Name:    "root",
+	}, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawKey := policy.Keys["1"].Key
+	if bytes.Equal(derive(map[string]interface{}{}), rawKey) {
+		t.Fatal("derived key material matches the key")
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"length": 0},
+		{"length": 255*32 + 1},
+		{"hash_algorithm": "sha1"},
+		{"salt": "not base64"},
+		{"key_version": 2},
+		{"public_key": "not a key"},
+	} {
+		resp, err := request(logical.UpdateOperation, "derive/root", data)
+		if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for %v: err: %v resp: %#v", data, err, resp)
+		}
+	}
+
+	// Rotating changes the derived key material of the latest version only
+	resp, err = request(logical.UpdateOperation, "keys/root/rotate", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if key2 := derive(map[string]interface{}{"salt": salt, "info": info, "key_version": 1}); !bytes.Equal(key1, key2) {
+		t.Fatal("expected key version 1 to derive the same key material")
+	}
+
+	// Wrapped key material can be unwrapped by the holder of the private key
+	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	derBytes, err := x509.MarshalPKIXPublicKey(privKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = request(logical.UpdateOperation, "derive/root", map[string]interface{}{
+		"salt":          salt,
+		"info":          info,
+		"key_version":   1,
+		"public_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: derBytes})),
+		"hash_function": "SHA512",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if _, ok := resp.Data["derived_key"]; ok {
+		t.Fatal("expected derived key material to only be returned wrapped")
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(resp.Data["wrapped_key"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ephemeralKey, err := rsa.DecryptOAEP(sha512.New(), rand.Reader, privKey, wrappedKey[:privKey.Size()], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unwrappedKey, err := keysutil.UnwrapKeyWithPadding(ephemeralKey, wrappedKey[privKey.Size():])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key1, unwrappedKey) {
+		t.Fatal("unwrapped key material does not match")
+	}
+
+	// Only symmetric keys support derivation
+	resp, err = request(logical.UpdateOperation, "keys/signing", map[string]interface{}{
+		"type": "ed25519",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = request(logical.UpdateOperation, "derive/signing", nil)
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for ed25519 key: err: %v resp: %#v", err, resp)
+	}
+}
@@ -114,8 +114,8 @@ to the min_encryption_version configured on the key.`,
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
-			logical.CreateOperation: b.pathEncryptWrite,
-			logical.UpdateOperation: b.pathEncryptWrite,
+			logical.CreateOperation: b.withKeyUsage(b.pathEncryptWrite),
+			logical.UpdateOperation: b.withKeyUsage(b.pathEncryptWrite),
 		},
 
 		ExistenceCheck: b.pathEncryptExistenceCheck,
@@ -354,6 +354,11 @@ func (b *backend) pathEncryptWrite(ctx context.Context, req *logical.Request, d
 		p.Lock(false)
 	}
 
+	if resp, err := checkKeyOperation(p, keyOperationEncrypt); err != nil {
+		p.Unlock()
+		return resp, err
+	}
+
 	// Process batch request items. If encryption of any request
 	// item fails, respectively mark the error in the response
 	// collection and continue to process other items.
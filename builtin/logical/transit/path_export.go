@@ -14,6 +14,7 @@ import (
 	"strings"
 
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/helper/keysutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -85,7 +86,7 @@ func (b *backend) pathPolicyExportRead(ctx context.Context, req *logical.Request
 
 	switch exportType {
 	case exportTypeEncryptionKey:
-		if !p.Type.EncryptionSupported() {
+		if !p.Type.EncryptionSupported() && !p.Type.FPESupported() {
 			return logical.ErrorResponse("encryption not supported for the key"), logical.ErrInvalidRequest
 		}
 	case exportTypeSigningKey:
@@ -94,43 +95,18 @@ func (b *backend) pathPolicyExportRead(ctx context.Context, req *logical.Request
 		}
 	}
 
-	retKeys := map[string]string{}
-	switch version {
-	case "":
-		for k, v := range p.Keys {
-			exportKey, err := getExportKey(p, &v, exportType)
-			if err != nil {
-				return nil, err
-			}
-			retKeys[k] = exportKey
-		}
-
-	default:
-		var versionValue int
-		if version == "latest" {
-			versionValue = p.LatestVersion
-		} else {
-			version = strings.TrimPrefix(version, "v")
-			versionValue, err = strconv.Atoi(version)
-			if err != nil {
-				return logical.ErrorResponse("invalid key version"), logical.ErrInvalidRequest
-			}
-		}
-
-		if versionValue < p.MinDecryptionVersion {
-			return logical.ErrorResponse("version for export is below minimum decryption version"), logical.ErrInvalidRequest
-		}
-		key, ok := p.Keys[strconv.Itoa(versionValue)]
-		if !ok {
-			return logical.ErrorResponse("version does not exist or cannot be found"), logical.ErrInvalidRequest
-		}
+	keys, err := getExportKeyVersions(p, version)
+	if err != nil {
+		return handleKeysutilError(err)
+	}
 
-		exportKey, err := getExportKey(p, &key, exportType)
+	retKeys := map[string]string{}
+	for k, v := range keys {
+		exportKey, err := getExportKey(p, &v, exportType)
 		if err != nil {
 			return nil, err
 		}
-
-		retKeys[strconv.Itoa(versionValue)] = exportKey
+		retKeys[k] = exportKey
 	}
 
 	resp := &logical.Response{
@@ -144,6 +120,37 @@ func (b *backend) pathPolicyExportRead(ctx context.Context, req *logical.Request
 	return resp, nil
 }
 
+// getExportKeyVersions returns the key versions to export: all versions if
+// version is empty, otherwise the requested version.
+func getExportKeyVersions(p *keysutil.Policy, version string) (map[string]keysutil.KeyEntry, error) {
+	if version == "" {
+		return p.Keys, nil
+	}
+
+	var versionValue int
+	if version == "latest" {
+		versionValue = p.LatestVersion
+	} else {
+		var err error
+		versionValue, err = strconv.Atoi(strings.TrimPrefix(version, "v"))
+		if err != nil {
+			return nil, errutil.UserError{Err: "invalid key version"}
+		}
+	}
+
+	if versionValue < p.MinDecryptionVersion {
+		return nil, errutil.UserError{Err: "version for export is below minimum decryption version"}
+	}
+	key, ok := p.Keys[strconv.Itoa(versionValue)]
+	if !ok {
+		return nil, errutil.UserError{Err: "version does not exist or cannot be found"}
+	}
+
+	return map[string]keysutil.KeyEntry{
+		strconv.Itoa(versionValue): key,
+	}, nil
+}
+
 func getExportKey(policy *keysutil.Policy, key *keysutil.KeyEntry, exportType string) (string, error) {
 	if policy == nil {
 		return "", errors.New("nil policy provided")
@@ -155,7 +162,7 @@ func getExportKey(policy *keysutil.Policy, key *keysutil.KeyEntry, exportType st
 
 	case exportTypeEncryptionKey:
 		switch policy.Type {
-		case keysutil.KeyType_AES128_GCM96, keysutil.KeyType_AES256_GCM96, keysutil.KeyType_ChaCha20_Poly1305:
+		case keysutil.KeyType_AES128_GCM96, keysutil.KeyType_AES256_GCM96, keysutil.KeyType_ChaCha20_Poly1305, keysutil.KeyType_FF3_1:
 			return strings.TrimSpace(base64.StdEncoding.EncodeToString(key.Key)), nil
 
 		case keysutil.KeyType_RSA2048, keysutil.KeyType_RSA3072, keysutil.KeyType_RSA4096:
@@ -180,6 +187,17 @@ func getExportKey(policy *keysutil.Policy, key *keysutil.KeyEntry, exportType st
 			}
 			return ecKey, nil
 
+		case keysutil.KeyType_ECDSA_SECP256K1:
+			ecder, err := keysutil.MarshalSecp256k1PrivateKey(key)
+			if err != nil {
+				return "", err
+			}
+			block := pem.Block{
+				Type:  "EC PRIVATE KEY",
+				Bytes: ecder,
+			}
+			return strings.TrimSpace(string(pem.EncodeToMemory(&block))), nil
+
 		case keysutil.KeyType_ED25519:
 			return strings.TrimSpace(base64.StdEncoding.EncodeToString(key.Key)), nil
 
@@ -0,0 +1,764 @@
+package transit
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	fpeAlphabetStoragePrefix = "fpe/alphabet/"
+	fpeTemplateStoragePrefix = "fpe/template/"
+
+	// defaultFPEAlphabet is used when neither a template nor an alphabet is
+	// given
+	defaultFPEAlphabet = "numeric"
+
+	// maxFPEAlphabetSize is the largest radix supported by FF3-1
+	maxFPEAlphabetSize = 1 << 16
+)
+
+// builtinFPEAlphabets can be used without being created
+var builtinFPEAlphabets = map[string]string{
+	"numeric":            "0123456789",
+	"alphanumeric-lower": "0123456789abcdefghijklmnopqrstuvwxyz",
+	"alphanumeric-upper": "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"alphanumeric":       "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+}
+
+// builtinFPETemplates can be used without being created
+var builtinFPETemplates = map[string]*fpeTemplate{
+	"creditcardnumber": {
+		Pattern:  `(\d{4})[- ]?(\d{4})[- ]?(\d{4})[- ]?(\d{4})`,
+		Alphabet: "numeric",
+	},
+	"socialsecuritynumber": {
+		Pattern:  `(\d{3})[- ]?(\d{2})[- ]?(\d{4})`,
+		Alphabet: "numeric",
+	},
+}
+
+// fpeAlphabet is a user-defined alphabet
+type fpeAlphabet struct {
+	Alphabet string `json:"alphabet"`
+}
+
+// fpeTemplate is a user-defined template. The characters of values captured
+// by the groups of the pattern are encrypted over the alphabet; the other
+// characters are left in place.
+type fpeTemplate struct {
+	Pattern  string `json:"pattern"`
+	Alphabet string `json:"alphabet"`
+}
+
+// fpeFormat is the format of values transformed with format-preserving
+// encryption or tokenization
+type fpeFormat struct {
+	alphabet []rune
+	template *regexp.Regexp
+}
+
+// batchRequestFPEItem represents a request item for batch processing.
+// A map type allows us to distinguish between empty and missing values.
+type batchRequestFPEItem map[string]string
+
+// batchResponseFPEItem represents a response item for batch processing
+type batchResponseFPEItem struct {
+	// Value is the encoded, decoded or detokenized value
+	Value string `json:"value,omitempty" mapstructure:"value"`
+
+	// Token is the token of the value
+	Token string `json:"token,omitempty" mapstructure:"token"`
+
+	// Error, if set represents a failure encountered while transforming a
+	// corresponding batch request item
+	Error string `json:"error,omitempty" mapstructure:"error"`
+
+	// As for encryption, both the error message and the error are needed to
+	// mimic the handling of requests that do not use batch_input.
+	err error
+}
+
+func (b *backend) pathFPEAlphabets() *framework.Path {
+	return &framework.Path{
+		Pattern: "fpe/alphabets/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the alphabet",
+			},
+
+			"alphabet": {
+				Type: framework.TypeString,
+				Description: `The characters of the alphabet. Must contain at
+least two distinct characters.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathFPEAlphabetWrite,
+			logical.ReadOperation:   b.pathFPEAlphabetRead,
+			logical.DeleteOperation: b.pathFPEAlphabetDelete,
+		},
+
+		HelpSynopsis:    pathFPEAlphabetsHelpSyn,
+		HelpDescription: pathFPEAlphabetsHelpDesc,
+	}
+}
+
+func (b *backend) pathListFPEAlphabets() *framework.Path {
+	return &framework.Path{
+		Pattern: "fpe/alphabets/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathFPEAlphabetList,
+		},
+
+		HelpSynopsis:    pathFPEAlphabetsHelpSyn,
+		HelpDescription: pathFPEAlphabetsHelpDesc,
+	}
+}
+
+func (b *backend) pathFPETemplates() *framework.Path {
+	return &framework.Path{
+		Pattern: "fpe/templates/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the template",
+			},
+
+			"pattern": {
+				Type: framework.TypeString,
+				Description: `A regular expression that values must match in
+full. The characters captured by its groups are encrypted;
+the other characters are left in place.`,
+			},
+
+			"alphabet": {
+				Type:        framework.TypeString,
+				Description: "The name of the alphabet of the captured characters",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathFPETemplateWrite,
+			logical.ReadOperation:   b.pathFPETemplateRead,
+			logical.DeleteOperation: b.pathFPETemplateDelete,
+		},
+
+		HelpSynopsis:    pathFPETemplatesHelpSyn,
+		HelpDescription: pathFPETemplatesHelpDesc,
+	}
+}
+
+func (b *backend) pathListFPETemplates() *framework.Path {
+	return &framework.Path{
+		Pattern: "fpe/templates/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathFPETemplateList,
+		},
+
+		HelpSynopsis:    pathFPETemplatesHelpSyn,
+		HelpDescription: pathFPETemplatesHelpDesc,
+	}
+}
+
+func (b *backend) pathFPEEncode() *framework.Path {
+	return &framework.Path{
+		Pattern: "fpe/encode/" + framework.GenericNameRegex("name"),
+		Fields:  fpeCryptFields("The value to encode"),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.withKeyUsage(b.pathFPEEncodeWrite),
+		},
+
+		HelpSynopsis:    pathFPEEncodeHelpSyn,
+		HelpDescription: pathFPEEncodeHelpDesc,
+	}
+}
+
+func (b *backend) pathFPEDecode() *framework.Path {
+	return &framework.Path{
+		Pattern: "fpe/decode/" + framework.GenericNameRegex("name"),
+		Fields:  fpeCryptFields("The value to decode"),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.withKeyUsage(b.pathFPEDecodeWrite),
+		},
+
+		HelpSynopsis:    pathFPEDecodeHelpSyn,
+		HelpDescription: pathFPEDecodeHelpDesc,
+	}
+}
+
+// fpeCryptFields returns the fields of the format-preserving encryption
+// endpoints
+func fpeCryptFields(valueDescription string) map[string]*framework.FieldSchema {
+	fields := fpeFields("value", valueDescription)
+	fields["tweak"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Base64 encoded 7-byte tweak. Values encrypted under
+different tweaks differ; the same tweak must be given to
+decrypt a value. Defaults to all zeros.`,
+	}
+	return fields
+}
+
+// fpeFields returns the fields shared by the format-preserving encryption
+// and tokenization endpoints
+func fpeFields(input, inputDescription string) map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"name": {
+			Type:        framework.TypeString,
+			Description: "Name of the key",
+		},
+
+		input: {
+			Type:        framework.TypeString,
+			Description: inputDescription,
+		},
+
+		"template": {
+			Type: framework.TypeString,
+			Description: `The name of the template of the value. If unset, the
+whole value is transformed over the alphabet.`,
+		},
+
+		"alphabet": {
+			Type: framework.TypeString,
+			Description: `The name of the alphabet of the value, when no
+template is given. Defaults to "numeric".`,
+		},
+
+		"context": {
+			Type:        framework.TypeString,
+			Description: "Base64 encoded context for key derivation. Required if key derivation is enabled.",
+		},
+
+		"key_version": {
+			Type: framework.TypeInt,
+			Description: `The version of the key to use. Values are not
+tagged with the version that transformed them, so the
+same version must be given to reverse the
+transformation. Defaults to the latest version.`,
+		},
+
+		"batch_input": {
+			Type: framework.TypeSlice,
+			Description: `Specifies a list of items to be transformed in a
+single batch. When this parameter is set, the top-level
+value and context parameters are ignored.`,
+		},
+	}
+}
+
+func (b *backend) pathFPEAlphabetWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if _, ok := builtinFPEAlphabets[name]; ok {
+		return logical.ErrorResponse(fmt.Sprintf("cannot overwrite built-in alphabet %q", name)), logical.ErrInvalidRequest
+	}
+
+	alphabet := d.Get("alphabet").(string)
+	if err := validateFPEAlphabet(alphabet); err != nil {
+		return handleKeysutilError(err)
+	}
+
+	entry, err := logical.StorageEntryJSON(fpeAlphabetStoragePrefix+name, &fpeAlphabet{
+		Alphabet: alphabet,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathFPEAlphabetRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	alphabet, err := getFPEAlphabet(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		if _, ok := err.(errutil.UserError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"alphabet": alphabet,
+		},
+	}, nil
+}
+
+func (b *backend) pathFPEAlphabetDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if _, ok := builtinFPEAlphabets[name]; ok {
+		return logical.ErrorResponse(fmt.Sprintf("cannot delete built-in alphabet %q", name)), logical.ErrInvalidRequest
+	}
+
+	return nil, req.Storage.Delete(ctx, fpeAlphabetStoragePrefix+name)
+}
+
+func (b *backend) pathFPEAlphabetList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, fpeAlphabetStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathFPETemplateWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if _, ok := builtinFPETemplates[name]; ok {
+		return logical.ErrorResponse(fmt.Sprintf("cannot overwrite built-in template %q", name)), logical.ErrInvalidRequest
+	}
+
+	template := &fpeTemplate{
+		Pattern:  d.Get("pattern").(string),
+		Alphabet: d.Get("alphabet").(string),
+	}
+	re, err := template.regexp()
+	if err != nil {
+		return handleKeysutilError(err)
+	}
+	if re.NumSubexp() == 0 {
+		return logical.ErrorResponse("pattern must have at least one capture group"), logical.ErrInvalidRequest
+	}
+	if template.Alphabet == "" {
+		return logical.ErrorResponse("missing alphabet"), logical.ErrInvalidRequest
+	}
+	if _, err := getFPEAlphabet(ctx, req.Storage, template.Alphabet); err != nil {
+		return handleKeysutilError(err)
+	}
+
+	entry, err := logical.StorageEntryJSON(fpeTemplateStoragePrefix+name, template)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathFPETemplateRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	template, err := getFPETemplate(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		if _, ok := err.(errutil.UserError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"pattern":  template.Pattern,
+			"alphabet": template.Alphabet,
+		},
+	}, nil
+}
+
+func (b *backend) pathFPETemplateDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if _, ok := builtinFPETemplates[name]; ok {
+		return logical.ErrorResponse(fmt.Sprintf("cannot delete built-in template %q", name)), logical.ErrInvalidRequest
+	}
+
+	return nil, req.Storage.Delete(ctx, fpeTemplateStoragePrefix+name)
+}
+
+func (b *backend) pathFPETemplateList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, fpeTemplateStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathFPEEncodeWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return b.fpeTransform(ctx, req, d, "value", keyOperationEncrypt, func(p *keysutil.Policy, ver int, format *fpeFormat, item batchRequestFPEItem, input string, result *batchResponseFPEItem) error {
+		context, tweak, err := decodeFPEItem(item)
+		if err != nil {
+			return err
+		}
+		result.Value, err = format.transform(input, func(value string) (string, error) {
+			return p.EncodeFPE(ver, context, tweak, format.alphabet, value)
+		})
+		return err
+	})
+}
+
+func (b *backend) pathFPEDecodeWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return b.fpeTransform(ctx, req, d, "value", keyOperationDecrypt, func(p *keysutil.Policy, ver int, format *fpeFormat, item batchRequestFPEItem, input string, result *batchResponseFPEItem) error {
+		context, tweak, err := decodeFPEItem(item)
+		if err != nil {
+			return err
+		}
+		result.Value, err = format.transform(input, func(value string) (string, error) {
+			return p.DecodeFPE(ver, context, tweak, format.alphabet, value)
+		})
+		return err
+	})
+}
+
+// fpeTransformFunc transforms the input of a batch item, setting the result
+// in the response item
+type fpeTransformFunc func(p *keysutil.Policy, ver int, format *fpeFormat, item batchRequestFPEItem, input string, result *batchResponseFPEItem) error
+
+// fpeTransform implements the format-preserving encryption and tokenization
+// endpoints, transforming the named input of each batch item with fn
+func (b *backend) fpeTransform(ctx context.Context, req *logical.Request, d *framework.FieldData, input, operation string, fn fpeTransformFunc) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	ver := d.Get("key_version").(int)
+
+	format, err := getFPEFormat(ctx, req.Storage, d.Get("template").(string), d.Get("alphabet").(string))
+	if err != nil {
+		return handleKeysutilError(err)
+	}
+
+	batchInputRaw := d.Raw["batch_input"]
+	var batchInputItems []batchRequestFPEItem
+	if batchInputRaw != nil {
+		err = mapstructure.Decode(batchInputRaw, &batchInputItems)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse batch input: %w", err)
+		}
+
+		if len(batchInputItems) == 0 {
+			return logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
+		}
+	} else {
+		valueRaw, ok := d.GetOk(input)
+		if !ok {
+			return logical.ErrorResponse(fmt.Sprintf("missing %s", input)), logical.ErrInvalidRequest
+		}
+
+		item := batchRequestFPEItem{
+			input:     valueRaw.(string),
+			"context": d.Get("context").(string),
+		}
+		if _, ok := d.Schema["tweak"]; ok {
+			item["tweak"] = d.Get("tweak").(string)
+		}
+		batchInputItems = []batchRequestFPEItem{item}
+	}
+
+	// Get the policy
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	if resp, err := checkKeyOperation(p, operation); err != nil {
+		return resp, err
+	}
+	if !p.Type.FPESupported() {
+		return logical.ErrorResponse(fmt.Sprintf("format-preserving encryption not supported for key type %v", p.Type)), logical.ErrInvalidRequest
+	}
+	if ver == 0 {
+		ver = p.LatestVersion
+	}
+
+	response := make([]batchResponseFPEItem, len(batchInputItems))
+	for i, item := range batchInputItems {
+		value, ok := item[input]
+		if !ok {
+			response[i].Error = fmt.Sprintf("missing %s", input)
+			response[i].err = logical.ErrInvalidRequest
+			continue
+		}
+
+		if err := fn(p, ver, format, item, value, &response[i]); err != nil {
+			response[i].Error = err.Error()
+			switch err.(type) {
+			case errutil.UserError:
+				response[i].err = logical.ErrInvalidRequest
+			default:
+				response[i].err = err
+			}
+		}
+	}
+
+	resp := &logical.Response{}
+	if batchInputRaw != nil {
+		resp.Data = map[string]interface{}{
+			"batch_results": response,
+			"key_version":   ver,
+		}
+		return resp, nil
+	}
+
+	if response[0].err != nil {
+		if response[0].err == logical.ErrInvalidRequest {
+			return logical.ErrorResponse(response[0].Error), response[0].err
+		}
+		return nil, response[0].err
+	}
+	resp.Data = map[string]interface{}{
+		"key_version": ver,
+	}
+	if response[0].Token != "" {
+		resp.Data["token"] = response[0].Token
+	} else {
+		resp.Data["value"] = response[0].Value
+	}
+
+	return resp, nil
+}
+
+// decodeFPEItem decodes the context and tweak of a batch item
+func decodeFPEItem(item batchRequestFPEItem) ([]byte, []byte, error) {
+	context, err := decodeFPEContext(item)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tweak []byte
+	if tweakB64 := item["tweak"]; tweakB64 != "" {
+		tweak, err = base64.StdEncoding.DecodeString(tweakB64)
+		if err != nil {
+			return nil, nil, errutil.UserError{Err: "failed to base64-decode tweak"}
+		}
+		if len(tweak) != keysutil.FF3TweakSize {
+			return nil, nil, errutil.UserError{Err: fmt.Sprintf("tweak must be %d bytes", keysutil.FF3TweakSize)}
+		}
+	}
+
+	return context, tweak, nil
+}
+
+func decodeFPEContext(item batchRequestFPEItem) ([]byte, error) {
+	if contextB64 := item["context"]; contextB64 != "" {
+		context, err := base64.StdEncoding.DecodeString(contextB64)
+		if err != nil {
+			return nil, errutil.UserError{Err: "failed to base64-decode context"}
+		}
+		return context, nil
+	}
+	return nil, nil
+}
+
+func validateFPEAlphabet(alphabet string) error {
+	if !utf8.ValidString(alphabet) {
+		return errutil.UserError{Err: "alphabet must be valid UTF-8"}
+	}
+
+	seen := map[rune]struct{}{}
+	for _, r := range alphabet {
+		if _, ok := seen[r]; ok {
+			return errutil.UserError{Err: fmt.Sprintf("alphabet contains duplicate character %q", r)}
+		}
+		seen[r] = struct{}{}
+	}
+
+	switch {
+	case len(seen) < 2:
+		return errutil.UserError{Err: "alphabet must contain at least two characters"}
+	case len(seen) > maxFPEAlphabetSize:
+		return errutil.UserError{Err: fmt.Sprintf("alphabet must contain at most %d characters", maxFPEAlphabetSize)}
+	}
+
+	return nil
+}
+
+// getFPEAlphabet returns the named built-in or user-defined alphabet
+func getFPEAlphabet(ctx context.Context, s logical.Storage, name string) (string, error) {
+	if alphabet, ok := builtinFPEAlphabets[name]; ok {
+		return alphabet, nil
+	}
+
+	entry, err := s.Get(ctx, fpeAlphabetStoragePrefix+name)
+	if err != nil {
+		return "", err
+	}
+	if entry == nil {
+		return "", errutil.UserError{Err: fmt.Sprintf("alphabet %q not found", name)}
+	}
+
+	var alphabet fpeAlphabet
+	if err := entry.DecodeJSON(&alphabet); err != nil {
+		return "", err
+	}
+
+	return alphabet.Alphabet, nil
+}
+
+// getFPETemplate returns the named built-in or user-defined template
+func getFPETemplate(ctx context.Context, s logical.Storage, name string) (*fpeTemplate, error) {
+	if template, ok := builtinFPETemplates[name]; ok {
+		return template, nil
+	}
+
+	entry, err := s.Get(ctx, fpeTemplateStoragePrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("template %q not found", name)}
+	}
+
+	var template fpeTemplate
+	if err := entry.DecodeJSON(&template); err != nil {
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+// getFPEFormat returns the format given by the named template, or by the
+// named alphabet if no template is given
+func getFPEFormat(ctx context.Context, s logical.Storage, templateName, alphabetName string) (*fpeFormat, error) {
+	format := &fpeFormat{}
+
+	if templateName != "" {
+		if alphabetName != "" {
+			return nil, errutil.UserError{Err: "only one of template and alphabet may be given"}
+		}
+
+		template, err := getFPETemplate(ctx, s, templateName)
+		if err != nil {
+			return nil, err
+		}
+		format.template, err = template.regexp()
+		if err != nil {
+			return nil, err
+		}
+		alphabetName = template.Alphabet
+	}
+
+	if alphabetName == "" {
+		alphabetName = defaultFPEAlphabet
+	}
+	alphabet, err := getFPEAlphabet(ctx, s, alphabetName)
+	if err != nil {
+		return nil, err
+	}
+	format.alphabet = []rune(alphabet)
+
+	return format, nil
+}
+
+// regexp compiles the pattern of the template, which must match values in
+// full
+func (t *fpeTemplate) regexp() (*regexp.Regexp, error) {
+	re, err := regexp.Compile(`^(?:` + t.Pattern + `)$`)
+	if err != nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("invalid pattern: %v", err)}
+	}
+	return re, nil
+}
+
+// transform transforms value with fn. With a template, the characters
+// captured by the template are transformed together and put back in place.
+func (f *fpeFormat) transform(value string, fn func(string) (string, error)) (string, error) {
+	if f.template == nil {
+		return fn(value)
+	}
+
+	matches := f.template.FindStringSubmatchIndex(value)
+	if matches == nil {
+		return "", errutil.UserError{Err: "value does not match the template"}
+	}
+
+	var captured strings.Builder
+	var spans [][2]int
+	prevEnd := 0
+	for i := 2; i < len(matches); i += 2 {
+		start, end := matches[i], matches[i+1]
+		if start < 0 {
+			continue
+		}
+		if start < prevEnd {
+			return "", errutil.UserError{Err: "template capture groups must not overlap"}
+		}
+		captured.WriteString(value[start:end])
+		spans = append(spans, [2]int{start, end})
+		prevEnd = end
+	}
+
+	transformed, err := fn(captured.String())
+	if err != nil {
+		return "", err
+	}
+
+	// Transformation preserves the number of characters, so each span takes
+	// back as many characters as it captured
+	transformedRunes := []rune(transformed)
+	var ret strings.Builder
+	pos := 0
+	for _, span := range spans {
+		n := utf8.RuneCountInString(value[span[0]:span[1]])
+		ret.WriteString(value[pos:span[0]])
+		ret.WriteString(string(transformedRunes[:n]))
+		transformedRunes = transformedRunes[n:]
+		pos = span[1]
+	}
+	ret.WriteString(value[pos:])
+
+	return ret.String(), nil
+}
+
+const pathFPEAlphabetsHelpSyn = `Manage the alphabets of format-preserving encryption`
+
+const pathFPEAlphabetsHelpDesc = `
+This path is used to manage the alphabets of values transformed with
+format-preserving encryption and tokenization. The built-in "numeric",
+"alphanumeric-lower", "alphanumeric-upper" and "alphanumeric" alphabets can
+be used without being created.
+`
+
+const pathFPETemplatesHelpSyn = `Manage the templates of format-preserving encryption`
+
+const pathFPETemplatesHelpDesc = `
+This path is used to manage the templates of values transformed with
+format-preserving encryption and tokenization. A template is a regular
+expression that values must match in full; the characters captured by its
+groups are transformed together over the alphabet of the template, and the
+other characters, such as separators, are left in place. The built-in
+"creditcardnumber" and "socialsecuritynumber" templates can be used without
+being created.
+`
+
+const pathFPEEncodeHelpSyn = `Encrypt a value with format-preserving encryption`
+
+const pathFPEEncodeHelpDesc = `
+This path uses the named "ff3-1" key to encrypt a value with FF3-1
+format-preserving encryption (NIST SP 800-38G Revision 1). The result has
+the same length and format as the value. A base64-encoded 7-byte tweak can
+be given for each value; the same key version, context, tweak and value
+always give the same result, so values are not tagged with the key version.
+`
+
+const pathFPEDecodeHelpSyn = `Decrypt a value encrypted with format-preserving encryption`
+
+const pathFPEDecodeHelpDesc = `
+This path uses the named "ff3-1" key to decrypt a value encrypted with the
+"fpe/encode" endpoint. The same key version, context, tweak and template or
+alphabet must be given.
+`
@@ -0,0 +1,139 @@
+package transit
+
+import (
+	"context"
+	"encoding/base64"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestTransit_FPE(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	resp, err := request(logical.UpdateOperation, "keys/fpe", map[string]interface{}{
+		"type": "ff3-1",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	// FF3-1 keys can't be used for regular encryption
+	resp, err = request(logical.UpdateOperation, "encrypt/fpe", map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString([]byte("4111111111111111")),
+	})
+	if err == nil {
+		t.Fatalf("expected error encrypting with an ff3-1 key, got resp: %#v", resp)
+	}
+
+	// Built-in template
+	tweak := base64.StdEncoding.EncodeToString([]byte("1234567"))
+	resp, err = request(logical.UpdateOperation, "fpe/encode/fpe", map[string]interface{}{
+		"value":    "4111-1111-1111-1111",
+		"template": "creditcardnumber",
+		"tweak":    tweak,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	encoded := resp.Data["value"].(string)
+	if !regexp.MustCompile(`^\d{4}-\d{4}-\d{4}-\d{4}$`).MatchString(encoded) || encoded == "4111-1111-1111-1111" {
+		t.Fatalf("bad encoded value %q", encoded)
+	}
+	if resp.Data["key_version"].(int) != 1 {
+		t.Fatalf("bad key version: %#v", resp.Data["key_version"])
+	}
+
+	resp, err = request(logical.UpdateOperation, "fpe/decode/fpe", map[string]interface{}{
+		"value":    encoded,
+		"template": "creditcardnumber",
+		"tweak":    tweak,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data["value"].(string) != "4111-1111-1111-1111" {
+		t.Fatalf("bad decoded value %q", resp.Data["value"])
+	}
+
+	// User-defined alphabet and template
+	resp, err = request(logical.UpdateOperation, "fpe/alphabets/hex", map[string]interface{}{
+		"alphabet": "0123456789abcdef",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = request(logical.UpdateOperation, "fpe/templates/account", map[string]interface{}{
+		"pattern":  `ACCT-([0-9a-f]{8})`,
+		"alphabet": "hex",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = request(logical.ListOperation, "fpe/templates", nil)
+	if err != nil || resp == nil || len(resp.Data["keys"].([]string)) != 1 {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	resp, err = request(logical.UpdateOperation, "fpe/encode/fpe", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"value": "ACCT-deadbeef"},
+			map[string]interface{}{"value": "ACCT-0000"},
+		},
+		"template": "account",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	results := resp.Data["batch_results"].([]batchResponseFPEItem)
+	if !regexp.MustCompile(`^ACCT-[0-9a-f]{8}$`).MatchString(results[0].Value) || results[0].Error != "" {
+		t.Fatalf("bad batch result %#v", results[0])
+	}
+	if results[1].Error == "" {
+		t.Fatalf("expected error for value not matching the template, got %#v", results[1])
+	}
+
+	resp, err = request(logical.UpdateOperation, "fpe/decode/fpe", map[string]interface{}{
+		"value":    results[0].Value,
+		"template": "account",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data["value"].(string) != "ACCT-deadbeef" {
+		t.Fatalf("bad decoded value %q", resp.Data["value"])
+	}
+
+	// Invalid alphabets and templates
+	for _, alphabet := range []string{"a", "abca"} {
+		resp, err = request(logical.UpdateOperation, "fpe/alphabets/bad", map[string]interface{}{
+			"alphabet": alphabet,
+		})
+		if err == nil {
+			t.Fatalf("expected error creating alphabet %q, got resp: %#v", alphabet, resp)
+		}
+	}
+	resp, err = request(logical.UpdateOperation, "fpe/templates/bad", map[string]interface{}{
+		"pattern":  `\d+`,
+		"alphabet": "numeric",
+	})
+	if err == nil {
+		t.Fatalf("expected error creating a template without capture groups, got resp: %#v", resp)
+	}
+	resp, err = request(logical.UpdateOperation, "fpe/alphabets/numeric", map[string]interface{}{
+		"alphabet": "01",
+	})
+	if err == nil {
+		t.Fatalf("expected error overwriting a built-in alphabet, got resp: %#v", resp)
+	}
+}
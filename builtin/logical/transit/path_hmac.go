@@ -78,7 +78,7 @@ to the min_encryption_version configured on the key.`,
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
-			logical.UpdateOperation: b.pathHMACWrite,
+			logical.UpdateOperation: b.withKeyUsage(b.pathHMACWrite),
 		},
 
 		HelpSynopsis:    pathHMACHelpSyn,
@@ -110,6 +110,11 @@ func (b *backend) pathHMACWrite(ctx context.Context, req *logical.Request, d *fr
 		p.Lock(false)
 	}
 
+	if resp, err := checkKeyOperation(p, keyOperationHMAC); err != nil {
+		p.Unlock()
+		return resp, err
+	}
+
 	switch {
 	case ver == 0:
 		// Allowed, will use latest; set explicitly here to ensure the string
@@ -238,6 +243,11 @@ func (b *backend) pathHMACVerify(ctx context.Context, req *logical.Request, d *f
 		p.Lock(false)
 	}
 
+	if resp, err := checkKeyOperation(p, keyOperationVerify); err != nil {
+		p.Unlock()
+		return resp, err
+	}
+
 	hashAlgorithm, ok := keysutil.HashTypeMap[algorithm]
 	if !ok {
 		p.Unlock()
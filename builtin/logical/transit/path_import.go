@@ -0,0 +1,293 @@
+package transit
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func (b *backend) pathImport() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/import",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "The name of the key",
+			},
+			"type": {
+				Type:    framework.TypeString,
+				Default: "aes256-gcm96",
+				Description: `The type of key being imported. Currently, "aes128-gcm96" (symmetric), "aes256-gcm96" (symmetric),
+"chacha20-poly1305" (symmetric), "ecdsa-p256" (asymmetric), "ecdsa-p384" (asymmetric), "ecdsa-p521" (asymmetric),
+"ed25519" (asymmetric), "rsa-2048" (asymmetric), "rsa-3072" (asymmetric), "rsa-4096" (asymmetric) are supported.
+Defaults to "aes256-gcm96".`,
+			},
+			"hash_function": {
+				Type:    framework.TypeString,
+				Default: "SHA256",
+				Description: `The hash function used as part of the RSA-OAEP
+wrapping of the ephemeral AES key. Can be one of "SHA1", "SHA224",
+"SHA256" (default), "SHA384", or "SHA512".`,
+			},
+			"ciphertext": {
+				Type: framework.TypeString,
+				Description: `The base64-encoded ciphertext of the key being
+imported: the ephemeral AES-256 key encrypted with RSA-OAEP under the
+wrapping key, followed by the key being imported wrapped with AES-KWP
+(RFC 5649) under the ephemeral key. Symmetric keys are wrapped as raw key
+bytes and asymmetric keys as PKCS#8 DER-encoded private keys.`,
+			},
+			"allow_rotation": {
+				Type: framework.TypeBool,
+				Description: `Whether Vault may rotate the imported key by
+generating new key versions. Otherwise new versions can only be added
+with the "import_version" endpoint.`,
+			},
+			"derived": {
+				Type: framework.TypeBool,
+				Description: `Enables key derivation mode. This
+allows for per-transaction unique
+keys for encryption operations.`,
+			},
+			"convergent_encryption": {
+				Type: framework.TypeBool,
+				Description: `Whether to support convergent encryption.
+This is only supported when using a key with
+key derivation enabled and will require all
+requests to carry both a context and 96-bit
+(12-byte) nonce.`,
+			},
+			"exportable": {
+				Type: framework.TypeBool,
+				Description: `Enables keys to be exportable.
+This allows for all the valid keys
+in the key ring to be exported.`,
+			},
+			"allow_plaintext_backup": {
+				Type: framework.TypeBool,
+				Description: `Enables taking a backup of the named
+key in plaintext format. Once set,
+this cannot be disabled.`,
+			},
+			"allow_wrapped_export": {
+				Type: framework.TypeBool,
+				Description: `Enables exporting the named key
+wrapped to a caller-supplied public key with
+the "wrapped_export" endpoint, even if the key
+is not exportable. Once set, this cannot be
+disabled.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportWrite,
+		},
+
+		HelpSynopsis:    pathImportWriteSyn,
+		HelpDescription: pathImportWriteDesc,
+	}
+}
+
+func (b *backend) pathImportVersion() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/import_version",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "The name of the key",
+			},
+			"ciphertext": {
+				Type: framework.TypeString,
+				Description: `The base64-encoded ciphertext of the key version
+being imported, wrapped as for the "import" endpoint.`,
+			},
+			"hash_function": {
+				Type:    framework.TypeString,
+				Default: "SHA256",
+				Description: `The hash function used as part of the RSA-OAEP
+wrapping of the ephemeral AES key. Can be one of "SHA1", "SHA224",
+"SHA256" (default), "SHA384", or "SHA512".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportVersionWrite,
+		},
+
+		HelpSynopsis:    pathImportVersionWriteSyn,
+		HelpDescription: pathImportVersionWriteDesc,
+	}
+}
+
+func (b *backend) pathImportWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	derived := d.Get("derived").(bool)
+	convergent := d.Get("convergent_encryption").(bool)
+	keyType := d.Get("type").(string)
+
+	if !derived && convergent {
+		return logical.ErrorResponse("convergent encryption requires derivation to be enabled"), nil
+	}
+
+	polReq := keysutil.PolicyRequest{
+		Storage:                  req.Storage,
+		Name:                     name,
+		Derived:                  derived,
+		Convergent:               convergent,
+		Exportable:               d.Get("exportable").(bool),
+		AllowPlaintextBackup:     d.Get("allow_plaintext_backup").(bool),
+		AllowWrappedExport:       d.Get("allow_wrapped_export").(bool),
+		AllowImportedKeyRotation: d.Get("allow_rotation").(bool),
+	}
+	var ok bool
+	polReq.KeyType, ok = keyTypeFromString(keyType)
+	if !ok {
+		return unknownKeyTypeResponse(keyType)
+	}
+
+	key, err := b.unwrapImportedKey(ctx, req.Storage, d)
+	if err != nil {
+		return handleKeysutilError(err)
+	}
+
+	if err := b.lm.ImportPolicy(ctx, polReq, key, b.GetRandomReader()); err != nil {
+		return handleKeysutilError(err)
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathImportVersionWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	key, err := b.unwrapImportedKey(ctx, req.Storage, d)
+	if err != nil {
+		return handleKeysutilError(err)
+	}
+
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(true)
+	}
+	defer p.Unlock()
+
+	if !p.Imported {
+		return logical.ErrorResponse("versions can only be imported into keys that were imported"), logical.ErrInvalidRequest
+	}
+
+	if err := p.Import(ctx, req.Storage, key, b.GetRandomReader()); err != nil {
+		return handleKeysutilError(err)
+	}
+
+	return nil, nil
+}
+
+// unwrapImportedKey decrypts the ciphertext of the request, returning the
+// key material being imported.
+func (b *backend) unwrapImportedKey(ctx context.Context, storage logical.Storage, d *framework.FieldData) ([]byte, error) {
+	hashFn, err := parseImportHashFunction(d.Get("hash_function").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(d.Get("ciphertext").(string))
+	if err != nil {
+		return nil, errutil.UserError{Err: "failed to base64-decode ciphertext"}
+	}
+
+	wrappingKey, err := b.getWrappingKey(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ephemeral key is encrypted with the wrapping key, so its
+	// ciphertext is exactly the size of the wrapping key's modulus
+	ephemeralKeySize := wrappingKey.Size()
+	if len(ciphertext) <= ephemeralKeySize {
+		return nil, errutil.UserError{Err: "ciphertext is too short to hold a wrapped key"}
+	}
+
+	ephemeralKey, err := rsa.DecryptOAEP(hashFn, b.GetRandomReader(), wrappingKey, ciphertext[:ephemeralKeySize], nil)
+	if err != nil {
+		return nil, errutil.UserError{Err: "failed to decrypt the ephemeral key with the wrapping key"}
+	}
+	if len(ephemeralKey) != 32 {
+		return nil, errutil.UserError{Err: "the ephemeral key must be a 256-bit AES key"}
+	}
+
+	key, err := keysutil.UnwrapKeyWithPadding(ephemeralKey, ciphertext[ephemeralKeySize:])
+	if err != nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("failed to unwrap the imported key with the ephemeral key: %v", err)}
+	}
+
+	return key, nil
+}
+
+func parseImportHashFunction(hashFn string) (hash.Hash, error) {
+	switch strings.ToUpper(hashFn) {
+	case "SHA1":
+		return sha1.New(), nil
+	case "SHA224":
+		return sha256.New224(), nil
+	case "SHA256":
+		return sha256.New(), nil
+	case "SHA384":
+		return sha512.New384(), nil
+	case "SHA512":
+		return sha512.New(), nil
+	default:
+		return nil, errutil.UserError{Err: fmt.Sprintf("unsupported hash function %q", hashFn)}
+	}
+}
+
+// handleKeysutilError returns user errors as error responses, and other
+// errors as internal errors.
+func handleKeysutilError(err error) (*logical.Response, error) {
+	switch err.(type) {
+	case errutil.UserError:
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	default:
+		return nil, err
+	}
+}
+
+const pathImportWriteSyn = `Imports an externally-generated key into a new transit key`
+
+const pathImportWriteDesc = `
+This path is used to import an externally-generated key into Vault. The
+key must be wrapped for transport: a fresh 256-bit AES key is used to wrap
+the key being imported with AES-KWP (RFC 5649), and is itself encrypted
+with RSA-OAEP under the public key returned by the "wrapping_key" endpoint.
+The two ciphertexts are concatenated and base64-encoded.
+
+Unless "allow_rotation" is set, the imported key can only be rotated by
+importing new versions with the "import_version" endpoint.
+`
+
+const pathImportVersionWriteSyn = `Imports an externally-generated key into an existing imported key`
+
+const pathImportVersionWriteDesc = `
+This path is used to import a new version of a key that was previously
+imported. The key is wrapped in the same way as for the "import" endpoint
+and becomes the latest version of the key.
+`
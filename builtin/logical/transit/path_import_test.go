@@ -0,0 +1,238 @@
+package transit
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestTransit_Import(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	resp, err := request(logical.ReadOperation, "wrapping_key", nil)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	block, _ := pem.Decode([]byte(resp.Data["public_key"].(string)))
+	if block == nil {
+		t.Fatal("failed to decode wrapping key")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrappingKey := parsed.(*rsa.PublicKey)
+	if wrappingKey.N.BitLen() != 4096 {
+		t.Fatalf("expected a 4096-bit wrapping key, got %d bits", wrappingKey.N.BitLen())
+	}
+
+	// The wrapping key is stable across reads
+	resp, err = request(logical.ReadOperation, "wrapping_key", nil)
+	if err != nil || resp == nil || string(pem.EncodeToMemory(block)) != resp.Data["public_key"] {
+		t.Fatalf("wrapping key changed: err: %v resp: %#v", err, resp)
+	}
+
+	wrap := func(key []byte) string {
+		ephemeralKey := make([]byte, 32)
+		if _, err := rand.Read(ephemeralKey); err != nil {
+			t.Fatal(err)
+		}
+		encryptedEphemeralKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, wrappingKey, ephemeralKey, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wrappedKey, err := keysutil.WrapKeyWithPadding(ephemeralKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(append(encryptedEphemeralKey, wrappedKey...))
+	}
+
+	exportKey := func(exportType, name, version string) string {
+		resp, err := request(logical.ReadOperation, "export/"+exportType+"/"+name+"/"+version, nil)
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		return resp.Data["keys"].(map[string]string)[version]
+	}
+
+	t.Run("aes256-gcm96", func(t *testing.T) {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := request(logical.UpdateOperation, "keys/aes/import", map[string]interface{}{
+			"ciphertext": wrap(key),
+			"exportable": true,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		if exportKey("encryption-key", "aes", "1") != base64.StdEncoding.EncodeToString(key) {
+			t.Fatal("imported key does not match")
+		}
+
+		resp, err = request(logical.ReadOperation, "keys/aes", nil)
+		if err != nil || resp == nil || resp.Data["imported_key"] != true || resp.Data["allow_rotation"] != false {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+
+		// Imported keys can't be imported again or rotated by Vault
+		resp, err = request(logical.UpdateOperation, "keys/aes/import", map[string]interface{}{
+			"ciphertext": wrap(key),
+		})
+		if err == nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error importing existing key: resp: %#v", resp)
+		}
+		resp, err = request(logical.UpdateOperation, "keys/aes/rotate", nil)
+		if err == nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error rotating imported key: resp: %#v", resp)
+		}
+
+		newKey := make([]byte, 32)
+		if _, err := rand.Read(newKey); err != nil {
+			t.Fatal(err)
+		}
+		resp, err = request(logical.UpdateOperation, "keys/aes/import_version", map[string]interface{}{
+			"ciphertext": wrap(newKey),
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		if exportKey("encryption-key", "aes", "2") != base64.StdEncoding.EncodeToString(newKey) {
+			t.Fatal("imported key version does not match")
+		}
+
+		resp, err = request(logical.UpdateOperation, "keys/aes/import_version", map[string]interface{}{
+			"ciphertext": wrap(newKey[:16]),
+		})
+		if err == nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error importing key of the wrong size: resp: %#v", resp)
+		}
+	})
+
+	t.Run("ecdsa-p256", func(t *testing.T) {
+		privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(privKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := request(logical.UpdateOperation, "keys/ec/import", map[string]interface{}{
+			"ciphertext":     wrap(der),
+			"type":           "ecdsa-p384",
+			"allow_rotation": true,
+		})
+		if err == nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error importing key of the wrong type: resp: %#v", resp)
+		}
+
+		resp, err = request(logical.UpdateOperation, "keys/ec/import", map[string]interface{}{
+			"ciphertext":     wrap(der),
+			"type":           "ecdsa-p256",
+			"allow_rotation": true,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+
+		input := []byte("imported")
+		resp, err = request(logical.UpdateOperation, "sign/ec", map[string]interface{}{
+			"input": base64.StdEncoding.EncodeToString(input),
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(resp.Data["signature"].(string), "vault:v1:"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest := sha256.Sum256(input)
+		if !ecdsa.VerifyASN1(&privKey.PublicKey, digest[:], sig) {
+			t.Fatal("signature not made with the imported key")
+		}
+
+		resp, err = request(logical.UpdateOperation, "keys/ec/rotate", nil)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		resp, err = request(logical.ReadOperation, "keys/ec", nil)
+		if err != nil || resp == nil || resp.Data["latest_version"] != 2 {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+	})
+
+	t.Run("import_version of generated key", func(t *testing.T) {
+		if _, err := request(logical.UpdateOperation, "keys/generated", nil); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := request(logical.UpdateOperation, "keys/generated/import_version", map[string]interface{}{
+			"ciphertext": wrap(bytes.Repeat([]byte{1}, 32)),
+		})
+		if err == nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error importing into generated key: resp: %#v", resp)
+		}
+	})
+}
+
+func TestTransit_WrappingKeyPerfStandby(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	standby := createBackendWithSysViewWithStorage(t, storage)
+	standby.System().(*logical.StaticSystemView).ReplicationStateVal = consts.ReplicationPerformanceStandby
+
+	// The wrapping key cannot be generated on a standby, so the request is
+	// forwarded to the active node
+	_, err := standby.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "wrapping_key",
+	})
+	if err != logical.ErrReadOnly {
+		t.Fatalf("expected a read-only error, got: %v", err)
+	}
+
+	active := createBackendWithSysViewWithStorage(t, storage)
+	resp, err := active.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "wrapping_key",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	// Once the active node has generated it, the standby serves it as well
+	standbyResp, err := standby.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "wrapping_key",
+	})
+	if err != nil || standbyResp == nil || standbyResp.Data["public_key"] != resp.Data["public_key"] {
+		t.Fatalf("bad: err: %v resp: %#v", err, standbyResp)
+	}
+}
@@ -45,8 +45,9 @@ func (b *backend) pathKeys() *framework.Path {
 				Default: "aes256-gcm96",
 				Description: `
 The type of key to create. Currently, "aes128-gcm96" (symmetric), "aes256-gcm96" (symmetric), "ecdsa-p256"
-(asymmetric), "ecdsa-p384" (asymmetric), "ecdsa-p521" (asymmetric), "ed25519" (asymmetric), "rsa-2048" (asymmetric), "rsa-3072"
-(asymmetric), "rsa-4096" (asymmetric) are supported.  Defaults to "aes256-gcm96".
+(asymmetric), "ecdsa-p384" (asymmetric), "ecdsa-p521" (asymmetric), "ecdsa-secp256k1" (asymmetric), "ed25519" (asymmetric),
+"rsa-2048" (asymmetric), "rsa-3072" (asymmetric), "rsa-4096" (asymmetric) and "ff3-1" (format-preserving) are supported.  Defaults to "aes256-gcm96".
+ML-DSA keys ("ml-dsa-44", "ml-dsa-65" and "ml-dsa-87") are not supported.
 `,
 			},
 
@@ -87,6 +88,24 @@ key in plaintext format. Once set,
 this cannot be disabled.`,
 			},
 
+			"allow_wrapped_export": {
+				Type: framework.TypeBool,
+				Description: `Enables exporting the named key
+wrapped to a caller-supplied public key with
+the "wrapped_export" endpoint, even if the key
+is not exportable. Once set, this cannot be
+disabled.`,
+			},
+
+			"token_store": {
+				Type: framework.TypeBool,
+				Description: `Records the tokens issued by the named
+key, so that only recorded tokens can be
+detokenized and tokens can be revoked. Only
+valid for "ff3-1" keys. This cannot be changed
+once the key is created.`,
+			},
+
 			"context": {
 				Type: framework.TypeString,
 				Description: `Base64 encoded context for key derivation.
@@ -123,6 +142,8 @@ func (b *backend) pathPolicyWrite(ctx context.Context, req *logical.Request, d *
 	keyType := d.Get("type").(string)
 	exportable := d.Get("exportable").(bool)
 	allowPlaintextBackup := d.Get("allow_plaintext_backup").(bool)
+	allowWrappedExport := d.Get("allow_wrapped_export").(bool)
+	tokenStore := d.Get("token_store").(bool)
 
 	if !derived && convergent {
 		return logical.ErrorResponse("convergent encryption requires derivation to be enabled"), nil
@@ -136,30 +157,16 @@ func (b *backend) pathPolicyWrite(ctx context.Context, req *logical.Request, d *
 		Convergent:           convergent,
 		Exportable:           exportable,
 		AllowPlaintextBackup: allowPlaintextBackup,
+		AllowWrappedExport:   allowWrappedExport,
+		TokenStore:           tokenStore,
 	}
-	switch keyType {
-	case "aes128-gcm96":
-		polReq.KeyType = keysutil.KeyType_AES128_GCM96
-	case "aes256-gcm96":
-		polReq.KeyType = keysutil.KeyType_AES256_GCM96
-	case "chacha20-poly1305":
-		polReq.KeyType = keysutil.KeyType_ChaCha20_Poly1305
-	case "ecdsa-p256":
-		polReq.KeyType = keysutil.KeyType_ECDSA_P256
-	case "ecdsa-p384":
-		polReq.KeyType = keysutil.KeyType_ECDSA_P384
-	case "ecdsa-p521":
-		polReq.KeyType = keysutil.KeyType_ECDSA_P521
-	case "ed25519":
-		polReq.KeyType = keysutil.KeyType_ED25519
-	case "rsa-2048":
-		polReq.KeyType = keysutil.KeyType_RSA2048
-	case "rsa-3072":
-		polReq.KeyType = keysutil.KeyType_RSA3072
-	case "rsa-4096":
-		polReq.KeyType = keysutil.KeyType_RSA4096
-	default:
-		return logical.ErrorResponse(fmt.Sprintf("unknown key type %v", keyType)), logical.ErrInvalidRequest
+	var ok bool
+	polReq.KeyType, ok = keyTypeFromString(keyType)
+	if !ok {
+		return unknownKeyTypeResponse(keyType)
+	}
+	if tokenStore && !polReq.KeyType.FPESupported() {
+		return logical.ErrorResponse(fmt.Sprintf("token store not supported for keys of type %v", polReq.KeyType)), logical.ErrInvalidRequest
 	}
 
 	p, upserted, err := b.GetPolicy(ctx, polReq, b.GetRandomReader())
@@ -181,6 +188,57 @@ func (b *backend) pathPolicyWrite(ctx context.Context, req *logical.Request, d *
 	return nil, nil
 }
 
+// keyTypeFromString returns the key type with the given name, as accepted by
+// the type parameter.
+func keyTypeFromString(keyType string) (keysutil.KeyType, bool) {
+	switch keyType {
+	case "aes128-gcm96":
+		return keysutil.KeyType_AES128_GCM96, true
+	case "aes256-gcm96":
+		return keysutil.KeyType_AES256_GCM96, true
+	case "chacha20-poly1305":
+		return keysutil.KeyType_ChaCha20_Poly1305, true
+	case "ecdsa-p256":
+		return keysutil.KeyType_ECDSA_P256, true
+	case "ecdsa-p384":
+		return keysutil.KeyType_ECDSA_P384, true
+	case "ecdsa-p521":
+		return keysutil.KeyType_ECDSA_P521, true
+	case "ecdsa-secp256k1":
+		return keysutil.KeyType_ECDSA_SECP256K1, true
+	case "ed25519":
+		return keysutil.KeyType_ED25519, true
+	case "rsa-2048":
+		return keysutil.KeyType_RSA2048, true
+	case "rsa-3072":
+		return keysutil.KeyType_RSA3072, true
+	case "rsa-4096":
+		return keysutil.KeyType_RSA4096, true
+	case "ff3-1":
+		return keysutil.KeyType_FF3_1, true
+	default:
+		return 0, false
+	}
+}
+
+// unsupportedKeyTypes are key type names that transit recognizes but cannot
+// create, mapped to the reason they are rejected. ML-DSA has no
+// implementation that builds with the Go version Vault targets.
+var unsupportedKeyTypes = map[string]string{
+	"ml-dsa-44": "ML-DSA keys are not supported",
+	"ml-dsa-65": "ML-DSA keys are not supported",
+	"ml-dsa-87": "ML-DSA keys are not supported",
+}
+
+// unknownKeyTypeResponse returns the error response for a key type name not
+// accepted by keyTypeFromString.
+func unknownKeyTypeResponse(keyType string) (*logical.Response, error) {
+	if reason, ok := unsupportedKeyTypes[keyType]; ok {
+		return logical.ErrorResponse(fmt.Sprintf("key type %v is not supported: %s", keyType, reason)), logical.ErrInvalidRequest
+	}
+	return logical.ErrorResponse(fmt.Sprintf("unknown key type %v", keyType)), logical.ErrInvalidRequest
+}
+
 // Built-in helper type for returning asymmetric keys
 type asymKey struct {
 	Name         string    `json:"name" structs:"name" mapstructure:"name"`
@@ -191,6 +249,11 @@ type asymKey struct {
 func (b *backend) pathPolicyRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	name := d.Get("name").(string)
 
+	// Load the usage of the key again if it was changed by another node
+	if err := b.syncKeyUsage(ctx, req, name); err != nil {
+		return nil, err
+	}
+
 	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
 		Storage: req.Storage,
 		Name:    name,
@@ -219,6 +282,9 @@ func (b *backend) pathPolicyRead(ctx context.Context, req *logical.Request, d *f
 			"latest_version":         p.LatestVersion,
 			"exportable":             p.Exportable,
 			"allow_plaintext_backup": p.AllowPlaintextBackup,
+			"allow_wrapped_export":   p.AllowWrappedExport,
+			"imported_key":           p.Imported,
+			"auto_rotate_period":     int64(p.AutoRotatePeriod.Seconds()),
 			"supports_encryption":    p.Type.EncryptionSupported(),
 			"supports_decryption":    p.Type.DecryptionSupported(),
 			"supports_signing":       p.Type.SigningSupported(),
@@ -226,6 +292,29 @@ func (b *backend) pathPolicyRead(ctx context.Context, req *logical.Request, d *f
 		},
 	}
 
+	if p.Imported {
+		resp.Data["allow_rotation"] = p.AllowImportedKeyRotation
+	}
+
+	if p.Type.FPESupported() {
+		resp.Data["token_store"] = p.TokenStore
+	}
+
+	allowedOperations := p.AllowedOperations
+	if allowedOperations == nil {
+		allowedOperations = []string{}
+	}
+	resp.Data["allowed_operations"] = allowedOperations
+
+	usage := map[string]map[string]interface{}{}
+	for version, versionUsage := range p.Usage() {
+		usage[strconv.Itoa(version)] = map[string]interface{}{
+			"count":     versionUsage.Count,
+			"last_used": versionUsage.LastUsed,
+		}
+	}
+	resp.Data["usage"] = usage
+
 	if p.BackupInfo != nil {
 		resp.Data["backup_info"] = map[string]interface{}{
 			"time":    p.BackupInfo.Time,
@@ -263,14 +352,15 @@ func (b *backend) pathPolicyRead(ctx context.Context, req *logical.Request, d *f
 	}
 
 	switch p.Type {
-	case keysutil.KeyType_AES128_GCM96, keysutil.KeyType_AES256_GCM96, keysutil.KeyType_ChaCha20_Poly1305:
+	case keysutil.KeyType_AES128_GCM96, keysutil.KeyType_AES256_GCM96, keysutil.KeyType_ChaCha20_Poly1305, keysutil.KeyType_FF3_1:
 		retKeys := map[string]int64{}
 		for k, v := range p.Keys {
 			retKeys[k] = v.DeprecatedCreationTime
 		}
 		resp.Data["keys"] = retKeys
 
-	case keysutil.KeyType_ECDSA_P256, keysutil.KeyType_ECDSA_P384, keysutil.KeyType_ECDSA_P521, keysutil.KeyType_ED25519, keysutil.KeyType_RSA2048, keysutil.KeyType_RSA3072, keysutil.KeyType_RSA4096:
+	case keysutil.KeyType_ECDSA_P256, keysutil.KeyType_ECDSA_P384, keysutil.KeyType_ECDSA_P521, keysutil.KeyType_ECDSA_SECP256K1, keysutil.KeyType_ED25519,
+		keysutil.KeyType_RSA2048, keysutil.KeyType_RSA3072, keysutil.KeyType_RSA4096:
 		retKeys := map[string]map[string]interface{}{}
 		for k, v := range p.Keys {
 			key := asymKey{
@@ -288,6 +378,8 @@ func (b *backend) pathPolicyRead(ctx context.Context, req *logical.Request, d *f
 				key.Name = elliptic.P384().Params().Name
 			case keysutil.KeyType_ECDSA_P521:
 				key.Name = elliptic.P521().Params().Name
+			case keysutil.KeyType_ECDSA_SECP256K1:
+				key.Name = "secp256k1"
 			case keysutil.KeyType_ED25519:
 				if p.Derived {
 					if len(context) == 0 {
@@ -350,6 +442,18 @@ func (b *backend) pathPolicyDelete(ctx context.Context, req *logical.Request, d
 		return logical.ErrorResponse(fmt.Sprintf("error deleting policy %s: %s", name, err)), err
 	}
 
+	if err := req.Storage.Delete(ctx, replicationStateStoragePrefix+name); err != nil {
+		return nil, fmt.Errorf("error deleting replication state of key %s: %w", name, err)
+	}
+	if err := req.Storage.Delete(ctx, replicationReceivedStoragePrefix+name); err != nil {
+		return nil, fmt.Errorf("error deleting replication state of key %s: %w", name, err)
+	}
+
+	// Remove the token store of the key, if any
+	if err := logical.ClearView(ctx, logical.NewStorageView(req.Storage, tokenStoragePrefix+name+"/")); err != nil {
+		return nil, fmt.Errorf("error deleting token store of key %s: %w", name, err)
+	}
+
 	return nil, nil
 }
 
@@ -359,4 +463,13 @@ const pathPolicyHelpDesc = `
 This path is used to manage the named keys that are available.
 Doing a write with no value against a new named key will create
 it using a randomly generated key.
+
+Reading a key returns, under "usage", how many times each key version has
+been used and when it was last used. The usage is persisted by the active
+node as keys are used, at least once a minute. Performance standbys forward
+requests using a key version whose persisted last use is more than a minute
+old to the active node, so the last use of each version is known
+cluster-wide to within a minute; the counts only include requests served by
+the active node, including forwarded ones. Trimming refuses to delete
+versions used within a configurable window.
 `
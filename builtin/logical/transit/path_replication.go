@@ -0,0 +1,628 @@
+package transit
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	replicationConfigPath         = "replication/config"
+	replicationStateStoragePrefix = "replication/state/"
+
+	// replicationReceivedStoragePrefix marks the keys created by receiving
+	// them from a remote mount, which are the only ones replication may
+	// replace
+	replicationReceivedStoragePrefix = "replication/received/"
+
+	// transportKeySize is the size in bytes of the AES-256 transport key
+	transportKeySize = 32
+)
+
+// errKeyNotReplicable is returned when replicating a key whose plaintext
+// may not leave the mount
+var errKeyNotReplicable = errors.New("key must be exportable and allow plaintext backup to be replicated")
+
+// replicationConfig configures the replication of keys to a remote transit
+// mount. A mount with only a transport key receives keys; a mount that also
+// has an address pushes its keys to the remote mount.
+type replicationConfig struct {
+	Address      string   `json:"address"`
+	Token        string   `json:"token"`
+	Mount        string   `json:"mount"`
+	CACert       string   `json:"ca_cert"`
+	Keys         []string `json:"keys"`
+	TransportKey []byte   `json:"transport_key"`
+}
+
+// replicationState records the latest version of a key pushed to the
+// remote mount
+type replicationState struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+}
+
+func (b *backend) pathReplicationConfig() *framework.Path {
+	return &framework.Path{
+		Pattern: "replication/config",
+		Fields: map[string]*framework.FieldSchema{
+			"transport_key": {
+				Type: framework.TypeString,
+				Description: `Base64 encoded 256-bit AES key shared by the
+sending and receiving mounts, used to encrypt keys in transit.
+Required.`,
+			},
+
+			"address": {
+				Type: framework.TypeString,
+				Description: `Address of the remote Vault cluster to push keys
+to. If unset, the mount only receives keys.`,
+			},
+
+			"token": {
+				Type: framework.TypeString,
+				Description: `Token for the remote Vault cluster, allowed to
+write to the "replication/receive" path of the remote mount.`,
+			},
+
+			"mount": {
+				Type:        framework.TypeString,
+				Default:     "transit",
+				Description: `Path of the remote transit mount. Defaults to "transit".`,
+			},
+
+			"ca_cert": {
+				Type:        framework.TypeString,
+				Description: "PEM-encoded CA certificate to verify the remote Vault cluster with",
+			},
+
+			"keys": {
+				Type: framework.TypeCommaStringSlice,
+				Description: `Names of the keys to replicate. If empty
+(default), all keys are replicated.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathReplicationConfigWrite,
+			logical.ReadOperation:   b.pathReplicationConfigRead,
+			logical.DeleteOperation: b.pathReplicationConfigDelete,
+		},
+
+		HelpSynopsis:    pathReplicationConfigHelpSyn,
+		HelpDescription: pathReplicationConfigHelpDesc,
+	}
+}
+
+func (b *backend) pathReplicationReceive() *framework.Path {
+	return &framework.Path{
+		Pattern: "replication/receive",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"ciphertext": {
+				Type:        framework.TypeString,
+				Description: "The key, encrypted with the transport key",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathReplicationReceiveWrite,
+		},
+
+		HelpSynopsis:    pathReplicationReceiveHelpSyn,
+		HelpDescription: pathReplicationReceiveHelpDesc,
+	}
+}
+
+func (b *backend) pathReplicationSync() *framework.Path {
+	return &framework.Path{
+		Pattern: "replication/sync",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathReplicationSyncWrite,
+		},
+
+		HelpSynopsis:    pathReplicationSyncHelpSyn,
+		HelpDescription: pathReplicationSyncHelpDesc,
+	}
+}
+
+func (b *backend) pathReplicationStatus() *framework.Path {
+	return &framework.Path{
+		Pattern: "replication/status",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathReplicationStatusRead,
+		},
+
+		HelpSynopsis:    pathReplicationStatusHelpSyn,
+		HelpDescription: pathReplicationStatusHelpDesc,
+	}
+}
+
+func (b *backend) pathReplicationConfigWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	transportKey, err := base64.StdEncoding.DecodeString(d.Get("transport_key").(string))
+	if err != nil {
+		return logical.ErrorResponse("failed to base64-decode transport_key"), logical.ErrInvalidRequest
+	}
+	if len(transportKey) != transportKeySize {
+		return logical.ErrorResponse(fmt.Sprintf("transport_key must be %d bytes", transportKeySize)), logical.ErrInvalidRequest
+	}
+
+	config := &replicationConfig{
+		Address:      d.Get("address").(string),
+		Token:        d.Get("token").(string),
+		Mount:        d.Get("mount").(string),
+		CACert:       d.Get("ca_cert").(string),
+		Keys:         d.Get("keys").([]string),
+		TransportKey: transportKey,
+	}
+	if config.Address != "" {
+		if config.Token == "" {
+			return logical.ErrorResponse("missing token for the remote cluster"), logical.ErrInvalidRequest
+		}
+		if config.CACert != "" {
+			if ok := x509.NewCertPool().AppendCertsFromPEM([]byte(config.CACert)); !ok {
+				return logical.ErrorResponse("failed to parse ca_cert"), logical.ErrInvalidRequest
+			}
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(replicationConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Put(ctx, entry)
+}
+
+func (b *backend) pathReplicationConfigRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := getReplicationConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The token and transport key are never returned
+	keys := config.Keys
+	if keys == nil {
+		keys = []string{}
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"address": config.Address,
+			"mount":   config.Mount,
+			"ca_cert": config.CACert,
+			"keys":    keys,
+		},
+	}, nil
+}
+
+func (b *backend) pathReplicationConfigDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete(ctx, replicationConfigPath); err != nil {
+		return nil, err
+	}
+
+	// Keys are pushed in full again if replication is configured anew
+	return nil, logical.ClearView(ctx, logical.NewStorageView(req.Storage, replicationStateStoragePrefix))
+}
+
+func (b *backend) pathReplicationReceiveWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing name"), logical.ErrInvalidRequest
+	}
+
+	config, err := getReplicationConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse("replication is not configured"), logical.ErrInvalidRequest
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(d.Get("ciphertext").(string))
+	if err != nil {
+		return logical.ErrorResponse("failed to base64-decode ciphertext"), logical.ErrInvalidRequest
+	}
+	plaintext, err := transportDecrypt(config.TransportKey, name, ciphertext)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	var keyData keysutil.KeyData
+	if err := jsonutil.DecodeJSON(plaintext, &keyData); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("failed to decode key: %v", err)), logical.ErrInvalidRequest
+	}
+	if keyData.Policy == nil || keyData.Policy.Name != name {
+		return logical.ErrorResponse("received key does not match the name"), logical.ErrInvalidRequest
+	}
+
+	// Only keys received through replication are replaced, and never with
+	// an older version
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p != nil {
+		received, err := req.Storage.Get(ctx, replicationReceivedStoragePrefix+name)
+		if err != nil {
+			return nil, err
+		}
+		if received == nil {
+			return logical.ErrorResponse(fmt.Sprintf("key %q exists locally and was not received through replication", name)), logical.ErrInvalidRequest
+		}
+
+		if !b.System().CachingDisabled() {
+			p.Lock(false)
+		}
+		latestVersion := p.LatestVersion
+		p.Unlock()
+
+		if keyData.Policy.LatestVersion < latestVersion {
+			return logical.ErrorResponse(fmt.Sprintf("received version %d of key %q is older than the local version %d", keyData.Policy.LatestVersion, name, latestVersion)), logical.ErrInvalidRequest
+		}
+	}
+
+	// The key is marked before being restored, so that it can't be left
+	// unmarked and refuse later versions
+	if err := req.Storage.Put(ctx, &logical.StorageEntry{
+		Key:   replicationReceivedStoragePrefix + name,
+		Value: []byte{1},
+	}); err != nil {
+		return nil, err
+	}
+
+	err = b.lm.RestorePolicy(ctx, req.Storage, name, base64.StdEncoding.EncodeToString(plaintext), true)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathReplicationSyncWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := getReplicationConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || config.Address == "" {
+		return logical.ErrorResponse("replication to a remote cluster is not configured"), logical.ErrInvalidRequest
+	}
+
+	synced, err := b.replicateKeys(ctx, req.Storage, config)
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"synced": synced,
+		},
+	}
+	if err != nil {
+		resp.AddWarning(err.Error())
+	}
+	return resp, nil
+}
+
+func (b *backend) pathReplicationStatusRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	names, err := req.Storage.List(ctx, replicationStateStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]interface{}{}
+	for _, name := range names {
+		state, err := getReplicationState(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if state == nil {
+			continue
+		}
+		keys[name] = map[string]interface{}{
+			"version": state.Version,
+			"time":    state.Time,
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"keys": keys,
+		},
+	}, nil
+}
+
+// periodicReplicateKeys pushes new key versions to the remote mount, if
+// replication is configured
+func (b *backend) periodicReplicateKeys(ctx context.Context, req *logical.Request) error {
+	// As for automatic rotation, keys are pushed by the active node of the
+	// primary only
+	replicationState := b.System().ReplicationState()
+	if replicationState.HasState(consts.ReplicationPerformanceStandby) ||
+		(!b.System().LocalMount() && replicationState.HasState(consts.ReplicationPerformanceSecondary)) {
+		return nil
+	}
+
+	config, err := getReplicationConfig(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+	if config == nil || config.Address == "" {
+		return nil
+	}
+
+	_, err = b.replicateKeys(ctx, req.Storage, config)
+	return err
+}
+
+// replicateKeys pushes the keys with versions newer than last pushed to the
+// remote mount, returning the versions pushed
+func (b *backend) replicateKeys(ctx context.Context, s logical.Storage, config *replicationConfig) (map[string]int, error) {
+	b.replicationLock.Lock()
+	defer b.replicationLock.Unlock()
+
+	client, err := newReplicationClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := s.List(ctx, "policy/")
+	if err != nil {
+		return nil, err
+	}
+
+	synced := map[string]int{}
+	var errs error
+	for _, name := range names {
+		if len(config.Keys) > 0 && !strutil.StrListContains(config.Keys, name) {
+			continue
+		}
+
+		version, err := b.replicateKey(ctx, s, config, client, name)
+		if errors.Is(err, errKeyNotReplicable) && len(config.Keys) == 0 {
+			// Only keys listed explicitly are reported
+			continue
+		}
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("error replicating key %q: %w", name, err))
+			continue
+		}
+		if version != 0 {
+			synced[name] = version
+		}
+	}
+
+	return synced, errs
+}
+
+// replicateKey pushes the named key to the remote mount if its latest
+// version is newer than last pushed, returning the version pushed
+func (b *backend) replicateKey(ctx context.Context, s logical.Storage, config *replicationConfig, client *api.Client, name string) (int, error) {
+	state, err := getReplicationState(ctx, s, name)
+	if err != nil {
+		return 0, err
+	}
+
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: s,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return 0, err
+	}
+	if p == nil {
+		return 0, nil
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	// Replication hands the plaintext of the key to the remote mount, so it
+	// is subject to the same restrictions as plaintext backups
+	if !p.Exportable || !p.AllowPlaintextBackup {
+		p.Unlock()
+		return 0, errKeyNotReplicable
+	}
+	if state != nil && state.Version >= p.LatestVersion {
+		p.Unlock()
+		return 0, nil
+	}
+	keyData, err := p.KeyData(ctx, s)
+	var plaintext []byte
+	if err == nil {
+		plaintext, err = json.Marshal(keyData)
+	}
+	version := p.LatestVersion
+	p.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	ciphertext, err := transportEncrypt(config.TransportKey, name, plaintext, b.GetRandomReader())
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = client.Logical().Write(path.Join(config.Mount, "replication/receive"), map[string]interface{}{
+		"name":       name,
+		"ciphertext": base64.StdEncoding.EncodeToString(ciphertext),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	entry, err := logical.StorageEntryJSON(replicationStateStoragePrefix+name, &replicationState{
+		Version: version,
+		Time:    time.Now().UTC(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func newReplicationClient(config *replicationConfig) (*api.Client, error) {
+	clientConfig := api.DefaultConfig()
+	if clientConfig.Error != nil {
+		return nil, clientConfig.Error
+	}
+	clientConfig.Address = config.Address
+
+	if config.CACert != "" {
+		if err := clientConfig.ConfigureTLS(&api.TLSConfig{
+			CACertBytes: []byte(config.CACert),
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := api.NewClient(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	client.SetToken(config.Token)
+
+	return client, nil
+}
+
+func getReplicationConfig(ctx context.Context, s logical.Storage) (*replicationConfig, error) {
+	entry, err := s.Get(ctx, replicationConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var config replicationConfig
+	if err := entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func getReplicationState(ctx context.Context, s logical.Storage, name string) (*replicationState, error) {
+	entry, err := s.Get(ctx, replicationStateStoragePrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var state replicationState
+	if err := entry.DecodeJSON(&state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// transportEncrypt encrypts a key for transport with AES-256-GCM, binding
+// the ciphertext to the name of the key. The nonce precedes the ciphertext.
+func transportEncrypt(transportKey []byte, name string, plaintext []byte, rand io.Reader) ([]byte, error) {
+	aead, err := newTransportAEAD(transportKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, []byte(name)), nil
+}
+
+func transportDecrypt(transportKey []byte, name string, ciphertext []byte) ([]byte, error) {
+	aead, err := newTransportAEAD(transportKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid ciphertext length")
+	}
+	plaintext, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+func newTransportAEAD(transportKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(transportKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+const pathReplicationConfigHelpSyn = `Configure the replication of keys to a remote transit mount`
+
+const pathReplicationConfigHelpDesc = `
+This path configures the replication of keys between transit mounts of
+different Vault clusters, for disaster recovery. Both mounts are configured
+with the same transport key. The sending mount is also configured with the
+address of the remote cluster, a token for it and the path of the remote
+mount; new key versions are then pushed to the remote mount periodically,
+or on demand with the "replication/sync" endpoint.
+
+As replication hands the plaintext of keys to the remote mount, only keys
+that are exportable and allow plaintext backup are replicated. Other keys
+are skipped, or reported as errors if listed in "keys".
+
+Replicated keys carry all their versions, including archived ones, and
+their configuration as of the last new version.
+`
+
+const pathReplicationReceiveHelpSyn = `Receive a key replicated from a remote transit mount`
+
+const pathReplicationReceiveHelpDesc = `
+This path receives a key pushed by a remote transit mount, encrypted with
+the shared transport key, and restores it in place of the local key of the
+same name. Only keys previously received through replication are replaced,
+and never with older versions; keys created locally are left untouched.
+`
+
+const pathReplicationSyncHelpSyn = `Push new key versions to the remote transit mount`
+
+const pathReplicationSyncHelpDesc = `
+This path pushes the keys with versions newer than last pushed to the
+remote transit mount immediately, returning the versions pushed. Errors
+with individual keys are returned as warnings.
+`
+
+const pathReplicationStatusHelpSyn = `Read the replication status of keys`
+
+const pathReplicationStatusHelpDesc = `
+This path returns the latest version of each key pushed to the remote
+transit mount, and when it was pushed.
+`
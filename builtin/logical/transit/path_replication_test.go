@@ -0,0 +1,210 @@
+package transit_test
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/builtin/logical/transit"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestTransit_Replication(t *testing.T) {
+	newCluster := func() *vault.TestCluster {
+		cluster := vault.NewTestCluster(t, &vault.CoreConfig{
+			LogicalBackends: map[string]logical.Factory{
+				"transit": transit.Factory,
+			},
+		}, &vault.TestClusterOptions{
+			HandlerFunc: vaulthttp.Handler,
+			NumCores:    1,
+		})
+		cluster.Start()
+		vault.TestWaitActive(t, cluster.Cores[0].Core)
+
+		err := cluster.Cores[0].Client.Sys().Mount("transit", &api.MountInput{
+			Type: "transit",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cluster
+	}
+
+	primary := newCluster()
+	defer primary.Cleanup()
+	secondary := newCluster()
+	defer secondary.Cleanup()
+
+	primaryClient := primary.Cores[0].Client
+	secondaryClient := secondary.Cores[0].Client
+
+	transportKey := make([]byte, 32)
+	if _, err := rand.Read(transportKey); err != nil {
+		t.Fatal(err)
+	}
+	transportKeyB64 := base64.StdEncoding.EncodeToString(transportKey)
+
+	_, err := secondaryClient.Logical().Write("transit/replication/config", map[string]interface{}{
+		"transport_key": transportKeyB64,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = primaryClient.Logical().Write("transit/replication/config", map[string]interface{}{
+		"transport_key": transportKeyB64,
+		"address":       secondaryClient.Address(),
+		"token":         secondary.RootToken,
+		"ca_cert":       string(secondary.CACertPEM),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := base64.StdEncoding.EncodeToString([]byte("the quick brown fox"))
+	encrypt := func(client *api.Client) string {
+		secret, err := client.Logical().Write("transit/encrypt/foo", map[string]interface{}{
+			"plaintext": plaintext,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return secret.Data["ciphertext"].(string)
+	}
+	decrypt := func(client *api.Client, ciphertext string) {
+		secret, err := client.Logical().Write("transit/decrypt/foo", map[string]interface{}{
+			"ciphertext": ciphertext,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret.Data["plaintext"].(string) != plaintext {
+			t.Fatalf("bad plaintext: %v", secret.Data["plaintext"])
+		}
+	}
+	sync := func() map[string]interface{} {
+		secret, err := primaryClient.Logical().Write("transit/replication/sync", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(secret.Warnings) != 0 {
+			t.Fatalf("unexpected warnings: %v", secret.Warnings)
+		}
+		return secret.Data["synced"].(map[string]interface{})
+	}
+
+	replicableKey := map[string]interface{}{
+		"exportable":             true,
+		"allow_plaintext_backup": true,
+	}
+	_, err = primaryClient.Logical().Write("transit/keys/foo", replicableKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertextV1 := encrypt(primaryClient)
+
+	// Keys that can't be backed up in plaintext are not replicated
+	_, err = primaryClient.Logical().Write("transit/keys/internal", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if synced := sync(); len(synced) != 1 || synced["foo"] == nil {
+		t.Fatalf("bad synced keys: %v", synced)
+	}
+	if secret, err := secondaryClient.Logical().Read("transit/keys/internal"); err != nil || secret != nil {
+		t.Fatalf("expected the non-exportable key not to be replicated: err: %v secret: %#v", err, secret)
+	}
+	decrypt(secondaryClient, ciphertextV1)
+
+	// Nothing is pushed without a new version
+	if synced := sync(); len(synced) != 0 {
+		t.Fatalf("bad synced keys: %v", synced)
+	}
+
+	// New versions are pushed along with the previous ones
+	_, err = primaryClient.Logical().Write("transit/keys/foo/rotate", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertextV2 := encrypt(primaryClient)
+	if synced := sync(); len(synced) != 1 {
+		t.Fatalf("bad synced keys: %v", synced)
+	}
+	decrypt(secondaryClient, ciphertextV1)
+	decrypt(secondaryClient, ciphertextV2)
+
+	secret, err := primaryClient.Logical().Read("transit/replication/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := secret.Data["keys"].(map[string]interface{})["foo"].(map[string]interface{})
+	if status["version"].(json.Number).String() != "2" {
+		t.Fatalf("bad status: %v", status)
+	}
+
+	// Keys encrypted with another transport key are rejected
+	otherKey := make([]byte, 32)
+	if _, err := rand.Read(otherKey); err != nil {
+		t.Fatal(err)
+	}
+	_, err = secondaryClient.Logical().Write("transit/replication/receive", map[string]interface{}{
+		"name":       "foo",
+		"ciphertext": base64.StdEncoding.EncodeToString(otherKey),
+	})
+	if err == nil {
+		t.Fatal("expected error receiving a key encrypted with another transport key")
+	}
+
+	// Keys created locally on the receiving mount are never replaced
+	_, err = secondaryClient.Logical().Write("transit/keys/local", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = primaryClient.Logical().Write("transit/keys/local", replicableKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = primaryClient.Logical().Write("transit/keys/local/rotate", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err = primaryClient.Logical().Write("transit/replication/sync", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret.Warnings) != 1 || !strings.Contains(secret.Warnings[0], "was not received through replication") {
+		t.Fatalf("expected a warning for the local key: %v", secret.Warnings)
+	}
+	secret, err = secondaryClient.Logical().Read("transit/keys/local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Data["latest_version"].(json.Number).String() != "1" || secret.Data["exportable"] != false {
+		t.Fatalf("local key was replaced: %v", secret.Data)
+	}
+
+	// Listing a key that can't be replicated explicitly reports it
+	_, err = primaryClient.Logical().Write("transit/replication/config", map[string]interface{}{
+		"transport_key": transportKeyB64,
+		"address":       secondaryClient.Address(),
+		"token":         secondary.RootToken,
+		"ca_cert":       string(secondary.CACertPEM),
+		"keys":          "foo,internal",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err = primaryClient.Logical().Write("transit/replication/sync", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret.Warnings) != 1 || !strings.Contains(secret.Warnings[0], "must be exportable") {
+		t.Fatalf("expected a warning for the non-exportable key: %v", secret.Warnings)
+	}
+}
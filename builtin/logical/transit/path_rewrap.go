@@ -45,7 +45,7 @@ to the min_encryption_version configured on the key.`,
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
-			logical.UpdateOperation: b.pathRewrapWrite,
+			logical.UpdateOperation: b.withKeyUsage(b.pathRewrapWrite),
 		},
 
 		HelpSynopsis:    pathRewrapHelpSyn,
@@ -128,6 +128,11 @@ func (b *backend) pathRewrapWrite(ctx context.Context, req *logical.Request, d *
 		p.Lock(false)
 	}
 
+	if resp, err := checkKeyOperation(p, keyOperationRewrap); err != nil {
+		p.Unlock()
+		return resp, err
+	}
+
 	for i, item := range batchInputItems {
 		if batchResponseItems[i].Error != "" {
 			continue
@@ -2,8 +2,14 @@ package transit
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"time"
 
+	multierror "github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/helper/keysutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -49,13 +55,89 @@ func (b *backend) pathRotateWrite(ctx context.Context, req *logical.Request, d *
 	err = p.Rotate(ctx, req.Storage, b.GetRandomReader())
 
 	p.Unlock()
+	if _, ok := err.(errutil.UserError); ok {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
 	return nil, err
 }
 
+// autoRotateKeys rotates every key whose latest version is older than the
+// key's auto rotate period.
+func (b *backend) autoRotateKeys(ctx context.Context, req *logical.Request) error {
+	// Rotation writes to storage; on performance standbys and secondaries it
+	// is left to the active node of the primary, which would otherwise see
+	// the key rotated twice.
+	replicationState := b.System().ReplicationState()
+	if replicationState.HasState(consts.ReplicationPerformanceStandby) ||
+		(!b.System().LocalMount() && replicationState.HasState(consts.ReplicationPerformanceSecondary)) {
+		return nil
+	}
+
+	// Only check once per interval, as every key has to be loaded
+	now := time.Now()
+	if now.Before(b.checkAutoRotateAfter) {
+		return nil
+	}
+	b.checkAutoRotateAfter = now.Add(autoRotateCheckInterval)
+
+	keys, err := req.Storage.List(ctx, "policy/")
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, key := range keys {
+		if err := b.rotateIfRequired(ctx, req, key, now); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("error auto-rotating key %q: %w", key, err))
+		}
+	}
+
+	return errs
+}
+
+func (b *backend) rotateIfRequired(ctx context.Context, req *logical.Request, name string, now time.Time) error {
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return nil
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(true)
+	}
+	defer p.Unlock()
+
+	if p.AutoRotatePeriod == 0 || (p.Imported && !p.AllowImportedKeyRotation) {
+		return nil
+	}
+
+	latestKey, ok := p.Keys[strconv.Itoa(p.LatestVersion)]
+	if !ok {
+		return nil
+	}
+	creationTime := latestKey.CreationTime
+	if creationTime.IsZero() {
+		creationTime = time.Unix(latestKey.DeprecatedCreationTime, 0)
+	}
+	if now.Before(creationTime.Add(p.AutoRotatePeriod)) {
+		return nil
+	}
+
+	b.Logger().Debug("automatically rotating key", "key", name)
+	return p.Rotate(ctx, req.Storage, b.GetRandomReader())
+}
+
 const pathRotateHelpSyn = `Rotate named encryption key`
 
 const pathRotateHelpDesc = `
 This path is used to rotate the named key. After rotation,
 new encryption requests using this name will use the new key,
 but decryption will still be supported for older versions.
+
+Keys can also be rotated automatically by setting auto_rotate_period
+on the "keys/:name/config" endpoint.
 `
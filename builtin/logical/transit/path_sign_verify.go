@@ -113,7 +113,7 @@ to the min_encryption_version configured on the key.`,
 
 			"prehashed": {
 				Type:        framework.TypeBool,
-				Description: `Set to 'true' when the input is already hashed. If the key type is 'rsa-2048', 'rsa-3072' or 'rsa-4096', then the algorithm used to hash the input should be indicated by the 'algorithm' parameter.`,
+				Description: `Set to 'true' when the input is already hashed. If the key type is 'rsa-2048', 'rsa-3072' or 'rsa-4096', then the algorithm used to hash the input should be indicated by the 'algorithm' parameter. For 'ecdsa-secp256k1' keys, this allows signing digests computed with other hash functions, such as Keccak-256.`,
 			},
 
 			"signature_algorithm": {
@@ -130,7 +130,7 @@ Options are 'pss' or 'pkcs1v15'. Defaults to 'pss'`,
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
-			logical.UpdateOperation: b.pathSignWrite,
+			logical.UpdateOperation: b.withKeyUsage(b.pathSignWrite),
 		},
 
 		HelpSynopsis:    pathSignHelpSyn,
@@ -163,6 +163,11 @@ derivation is enabled; currently only available with ed25519 keys.`,
 				Description: "The HMAC, including vault header/key version",
 			},
 
+			"cmac": {
+				Type:        framework.TypeString,
+				Description: "The CMAC, including vault header/key version",
+			},
+
 			"input": {
 				Type:        framework.TypeString,
 				Description: "The base64-encoded input data to verify",
@@ -195,7 +200,7 @@ Defaults to "sha2-256". Not valid for all key types.`,
 
 			"prehashed": {
 				Type:        framework.TypeBool,
-				Description: `Set to 'true' when the input is already hashed. If the key type is 'rsa-2048', 'rsa-3072' or 'rsa-4096', then the algorithm used to hash the input should be indicated by the 'algorithm' parameter.`,
+				Description: `Set to 'true' when the input is already hashed. If the key type is 'rsa-2048', 'rsa-3072' or 'rsa-4096', then the algorithm used to hash the input should be indicated by the 'algorithm' parameter. For 'ecdsa-secp256k1' keys, this allows signing digests computed with other hash functions, such as Keccak-256.`,
 			},
 
 			"signature_algorithm": {
@@ -212,7 +217,7 @@ Options are 'pss' or 'pkcs1v15'. Defaults to 'pss'`,
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
-			logical.UpdateOperation: b.pathVerifyWrite,
+			logical.UpdateOperation: b.withKeyUsage(b.pathVerifyWrite),
 		},
 
 		HelpSynopsis:    pathVerifyHelpSyn,
@@ -260,6 +265,11 @@ func (b *backend) pathSignWrite(ctx context.Context, req *logical.Request, d *fr
 		p.Lock(false)
 	}
 
+	if resp, err := checkKeyOperation(p, keyOperationSign); err != nil {
+		p.Unlock()
+		return resp, err
+	}
+
 	if !p.Type.SigningSupported() {
 		p.Unlock()
 		return logical.ErrorResponse(fmt.Sprintf("key type %v does not support signing", p.Type)), logical.ErrInvalidRequest
@@ -398,34 +408,48 @@ func (b *backend) pathVerifyWrite(ctx context.Context, req *logical.Request, d *
 		if hmac, ok := d.GetOk("hmac"); ok {
 			batchInputItems[0]["hmac"] = hmac.(string)
 		}
+		if cmac, ok := d.GetOk("cmac"); ok {
+			batchInputItems[0]["cmac"] = cmac.(string)
+		}
 		batchInputItems[0]["context"] = d.Get("context").(string)
 	}
 
-	// For simplicity, 'signature' and 'hmac' cannot be mixed across batch_input elements.
+	// For simplicity, 'signature', 'hmac' and 'cmac' cannot be mixed across batch_input elements.
 	// If one batch_input item is 'signature', they all must be 'signature'.
 	// If one batch_input item is 'hmac', they all must be 'hmac'.
+	// If one batch_input item is 'cmac', they all must be 'cmac'.
 	sigFound := false
 	hmacFound := false
+	cmacFound := false
 	missing := false
 	for _, v := range batchInputItems {
 		if _, ok := v["signature"]; ok {
 			sigFound = true
 		} else if _, ok := v["hmac"]; ok {
 			hmacFound = true
+		} else if _, ok := v["cmac"]; ok {
+			cmacFound = true
 		} else {
 			missing = true
 		}
 	}
 
+	kindsFound := 0
+	for _, found := range []bool{sigFound, hmacFound, cmacFound} {
+		if found {
+			kindsFound++
+		}
+	}
+
 	switch {
-	case batchInputRaw == nil && sigFound && hmacFound:
-		return logical.ErrorResponse("provide one of 'signature' or 'hmac'"), logical.ErrInvalidRequest
+	case batchInputRaw == nil && kindsFound > 1:
+		return logical.ErrorResponse("provide one of 'signature', 'hmac' or 'cmac'"), logical.ErrInvalidRequest
 
-	case batchInputRaw == nil && !sigFound && !hmacFound:
-		return logical.ErrorResponse("neither a 'signature' nor an 'hmac' were given to verify"), logical.ErrInvalidRequest
+	case batchInputRaw == nil && kindsFound == 0:
+		return logical.ErrorResponse("neither a 'signature', an 'hmac' nor a 'cmac' were given to verify"), logical.ErrInvalidRequest
 
-	case sigFound && hmacFound:
-		return logical.ErrorResponse("elements of batch_input must all provide 'signature' or all provide 'hmac'"), logical.ErrInvalidRequest
+	case kindsFound > 1:
+		return logical.ErrorResponse("elements of batch_input must all provide 'signature', all provide 'hmac' or all provide 'cmac'"), logical.ErrInvalidRequest
 
 	case missing && sigFound:
 		return logical.ErrorResponse("some elements of batch_input are missing 'signature'"), logical.ErrInvalidRequest
@@ -433,11 +457,17 @@ func (b *backend) pathVerifyWrite(ctx context.Context, req *logical.Request, d *
 	case missing && hmacFound:
 		return logical.ErrorResponse("some elements of batch_input are missing 'hmac'"), logical.ErrInvalidRequest
 
+	case missing && cmacFound:
+		return logical.ErrorResponse("some elements of batch_input are missing 'cmac'"), logical.ErrInvalidRequest
+
 	case missing:
-		return logical.ErrorResponse("no batch_input elements have 'signature' or 'hmac'"), logical.ErrInvalidRequest
+		return logical.ErrorResponse("no batch_input elements have 'signature', 'hmac' or 'cmac'"), logical.ErrInvalidRequest
 
 	case hmacFound:
 		return b.pathHMACVerify(ctx, req, d)
+
+	case cmacFound:
+		return b.pathCMACVerify(ctx, req, d)
 	}
 
 	name := d.Get("name").(string)
@@ -478,6 +508,11 @@ func (b *backend) pathVerifyWrite(ctx context.Context, req *logical.Request, d *
 		p.Lock(false)
 	}
 
+	if resp, err := checkKeyOperation(p, keyOperationVerify); err != nil {
+		p.Unlock()
+		return resp, err
+	}
+
 	if !p.Type.SigningSupported() {
 		p.Unlock()
 		return logical.ErrorResponse(fmt.Sprintf("key type %v does not support verification", p.Type)), logical.ErrInvalidRequest
@@ -2,7 +2,11 @@ package transit
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"strconv"
 	"strings"
@@ -10,6 +14,8 @@ import (
 
 	"golang.org/x/crypto/ed25519"
 
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
 	"github.com/hashicorp/vault/sdk/helper/keysutil"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/mitchellh/mapstructure"
@@ -680,3 +686,120 @@ func TestTransit_SignVerify_ED25519(t *testing.T) {
 	outcome[1].valid = false
 	verifyRequest(req, false, outcome, "bar", goodsig, true)
 }
+
+func TestTransit_SignVerify_Secp256k1(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	req := &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/foo",
+		Data: map[string]interface{}{
+			"type": "ecdsa-secp256k1",
+		},
+	}
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+
+	input := []byte("the quick brown fox")
+	digest := sha256.Sum256(input)
+
+	req.Path = "keys/foo"
+	req.Operation = logical.ReadOperation
+	req.Data = nil
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+	keyInfo := resp.Data["keys"].(map[string]map[string]interface{})["1"]
+	if keyInfo["name"] != "secp256k1" {
+		t.Fatalf("unexpected key name %v", keyInfo["name"])
+	}
+	block, _ := pem.Decode([]byte(keyInfo["public_key"].(string)))
+	if block == nil {
+		t.Fatal("failed to decode public key PEM")
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(block.Bytes, &spki); err != nil {
+		t.Fatal(err)
+	}
+	pubKey, err := secp256k1.ParsePubKey(spki.PublicKey.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, marshaling := range []string{"asn1", "jws"} {
+		req.Path = "sign/foo"
+		req.Operation = logical.UpdateOperation
+		req.Data = map[string]interface{}{
+			"input":                base64.StdEncoding.EncodeToString(input),
+			"marshaling_algorithm": marshaling,
+		}
+		resp, err = b.HandleRequest(context.Background(), req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("resp: %#v\nerr: %v", resp, err)
+		}
+		signature := resp.Data["signature"].(string)
+
+		req.Path = "verify/foo"
+		req.Data["signature"] = signature
+		resp, err = b.HandleRequest(context.Background(), req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("resp: %#v\nerr: %v", resp, err)
+		}
+		if !resp.Data["valid"].(bool) {
+			t.Fatalf("%s signature did not verify", marshaling)
+		}
+
+		req.Data["input"] = base64.StdEncoding.EncodeToString([]byte("another input"))
+		resp, err = b.HandleRequest(context.Background(), req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("resp: %#v\nerr: %v", resp, err)
+		}
+		if resp.Data["valid"].(bool) {
+			t.Fatalf("%s signature verified for the wrong input", marshaling)
+		}
+
+		// ASN.1 signatures can be verified outside of Vault
+		if marshaling == "asn1" {
+			sigBytes, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(signature, "vault:v1:"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, err := secpecdsa.ParseDERSignature(sigBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sig.Verify(digest[:], pubKey) {
+				t.Fatal("signature did not verify against the public key")
+			}
+		}
+	}
+}
+
+func TestTransit_SignVerify_MLDSAUnsupported(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	for _, keyType := range []string{"ml-dsa-44", "ml-dsa-65", "ml-dsa-87"} {
+		req := &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "keys/" + keyType,
+			Data: map[string]interface{}{
+				"type": keyType,
+			},
+		}
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != logical.ErrInvalidRequest {
+			t.Fatalf("expected invalid request for %s, got: %v", keyType, err)
+		}
+		if resp == nil || !strings.Contains(resp.Error().Error(), "ML-DSA keys are not supported") {
+			t.Fatalf("bad response for %s: %#v", keyType, resp)
+		}
+	}
+}
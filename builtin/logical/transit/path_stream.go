@@ -0,0 +1,255 @@
+package transit
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// StreamErrorTrailer is the HTTP trailer set when a stream fails after its
+// output has started being written, at which point the status code of the
+// response can no longer be changed.
+const StreamErrorTrailer = "X-Vault-Stream-Error"
+
+const errStreamRequiresRawBody = `streaming requests must carry the data as the request body with a Content-Type of "application/octet-stream"`
+
+func (b *backend) pathEncryptStream() *framework.Path {
+	return &framework.Path{
+		Pattern: "encrypt-stream/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the policy",
+			},
+
+			"context": {
+				Type:        framework.TypeString,
+				Description: "Base64 encoded context for key derivation. Required if key derivation is enabled",
+			},
+
+			"key_version": {
+				Type: framework.TypeInt,
+				Description: `The version of the key to use for encryption.
+Must be 0 (for latest) or a value greater than or equal
+to the min_encryption_version configured on the key.`,
+			},
+
+			"chunk_size": {
+				Type:    framework.TypeInt,
+				Default: keysutil.DefaultStreamChunkSize,
+				Description: `The number of plaintext bytes encrypted in each
+chunk of the stream. Defaults to 64KiB.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathEncryptStreamWrite,
+		},
+
+		HelpSynopsis:    pathEncryptStreamHelpSyn,
+		HelpDescription: pathEncryptStreamHelpDesc,
+	}
+}
+
+func (b *backend) pathDecryptStream() *framework.Path {
+	return &framework.Path{
+		Pattern: "decrypt-stream/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the policy",
+			},
+
+			"context": {
+				Type:        framework.TypeString,
+				Description: "Base64 encoded context for key derivation. Required if key derivation is enabled",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathDecryptStreamWrite,
+		},
+
+		HelpSynopsis:    pathDecryptStreamHelpSyn,
+		HelpDescription: pathDecryptStreamHelpDesc,
+	}
+}
+
+func (b *backend) pathEncryptStreamWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.HTTPRequest == nil || req.HTTPRequest.Body == nil || req.ResponseWriter == nil {
+		return logical.ErrorResponse(errStreamRequiresRawBody), logical.ErrInvalidRequest
+	}
+
+	derivationContext, err := decodeStreamContext(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    d.Get("name").(string),
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+
+	if resp, err := checkKeyOperation(p, keyOperationEncrypt); err != nil {
+		p.Unlock()
+		return resp, err
+	}
+
+	// The policy is only needed to encrypt the stream's data key, so the
+	// lock is not held while the stream itself is encrypted
+	encryptor, err := p.NewStreamEncryptor(d.Get("key_version").(int), derivationContext, d.Get("chunk_size").(int), b.GetRandomReader())
+	p.Unlock()
+	if err != nil {
+		return handleKeysutilError(err)
+	}
+
+	// The use of the key is synced before the response is written, as the
+	// request can no longer be forwarded afterwards
+	if err := b.syncKeyUsage(ctx, req, d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+
+	return b.writeStream(req, func(w io.Writer) error {
+		return encryptor.Encrypt(w, req.HTTPRequest.Body)
+	})
+}
+
+func (b *backend) pathDecryptStreamWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.HTTPRequest == nil || req.HTTPRequest.Body == nil || req.ResponseWriter == nil {
+		return logical.ErrorResponse(errStreamRequiresRawBody), logical.ErrInvalidRequest
+	}
+
+	derivationContext, err := decodeStreamContext(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	// The header is kept so that the body can be restored if the request
+	// needs to be forwarded
+	var rawHeader bytes.Buffer
+	header, err := keysutil.ReadStreamHeader(io.TeeReader(req.HTTPRequest.Body, &rawHeader))
+	if err != nil {
+		return handleKeysutilError(err)
+	}
+
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    d.Get("name").(string),
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+
+	if resp, err := checkKeyOperation(p, keyOperationDecrypt); err != nil {
+		p.Unlock()
+		return resp, err
+	}
+
+	decryptor, err := p.NewStreamDecryptor(derivationContext, header)
+	p.Unlock()
+	if err != nil {
+		return handleKeysutilError(err)
+	}
+
+	if err := b.syncKeyUsage(ctx, req, d.Get("name").(string)); err != nil {
+		body := req.HTTPRequest.Body
+		req.HTTPRequest.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(&rawHeader, body), body}
+		return nil, err
+	}
+
+	return b.writeStream(req, func(w io.Writer) error {
+		return decryptor.Decrypt(w, req.HTTPRequest.Body)
+	})
+}
+
+// writeStream writes the output of the given function as the raw body of the
+// response. Errors occurring before any output has been written are returned
+// as usual; later ones can only be reported through the StreamErrorTrailer
+// trailer.
+func (b *backend) writeStream(req *logical.Request, writeFunc func(w io.Writer) error) (*logical.Response, error) {
+	w := req.ResponseWriter
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Trailer", StreamErrorTrailer)
+
+	err := writeFunc(w)
+	if err == nil {
+		return nil, nil
+	}
+	if !w.Written() {
+		return handleKeysutilError(err)
+	}
+
+	b.Logger().Debug("stream failed after writing its output", "path", req.Path, "error", err)
+	w.Header().Set(StreamErrorTrailer, err.Error())
+	return nil, nil
+}
+
+func decodeStreamContext(d *framework.FieldData) ([]byte, error) {
+	contextRaw := d.Get("context").(string)
+	if contextRaw == "" {
+		return nil, nil
+	}
+
+	derivationContext, err := base64.StdEncoding.DecodeString(contextRaw)
+	if err != nil {
+		return nil, errutil.UserError{Err: "failed to base64-decode context"}
+	}
+	return derivationContext, nil
+}
+
+const pathEncryptStreamHelpSyn = `Encrypt a stream of data using a named key`
+
+const pathEncryptStreamHelpDesc = `
+This path encrypts a stream of data of arbitrary length. The plaintext is
+sent as the raw request body with a Content-Type of
+"application/octet-stream", and parameters are given in the query string.
+The response body is the encrypted stream.
+
+The stream is encrypted in chunks with AES-256-GCM under a random data key,
+which is encrypted with the named key and stored in an authenticated header
+along with the key version. Each chunk has its own nonce, so that chunks can
+neither be reordered nor dropped. The stream can only be decrypted with the
+"decrypt-stream" endpoint.
+
+If an error occurs once the response has started, it is reported in the
+X-Vault-Stream-Error HTTP trailer.
+`
+
+const pathDecryptStreamHelpSyn = `Decrypt a stream of data using a named key`
+
+const pathDecryptStreamHelpDesc = `
+This path decrypts a stream encrypted by the "encrypt-stream" endpoint. The
+encrypted stream is sent as the raw request body with a Content-Type of
+"application/octet-stream", and parameters are given in the query string.
+The response body is the plaintext.
+
+Every chunk is authenticated before its plaintext is returned. A stream
+that is truncated or otherwise modified after its first chunk is only
+detected once earlier chunks have been returned; the error is then reported
+in the X-Vault-Stream-Error HTTP trailer, which clients must check before
+trusting the plaintext.
+`
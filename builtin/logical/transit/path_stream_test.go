@@ -0,0 +1,93 @@
+package transit_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/builtin/logical/transit"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestTransit_Stream(t *testing.T) {
+	coreConfig := &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"transit": transit.Factory,
+		},
+	}
+
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	cores := cluster.Cores
+
+	vault.TestWaitActive(t, cores[0].Core)
+
+	client := cores[0].Client
+
+	err := client.Sys().Mount("transit", &api.MountInput{
+		Type: "transit",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Logical().Write("transit/keys/foo", map[string]interface{}{
+		"derived": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	opts := &api.TransitStreamOptions{
+		Context:   []byte("stream context"),
+		ChunkSize: 1024,
+	}
+
+	plaintext := make([]byte, 10*1024+17)
+	if _, err := rand.Read(plaintext); err != nil {
+		t.Fatal(err)
+	}
+
+	var ciphertext bytes.Buffer
+	if err := client.Transit().EncryptStream(ctx, "foo", bytes.NewReader(plaintext), &ciphertext, opts); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext.Bytes(), plaintext[:64]) {
+		t.Fatal("ciphertext contains plaintext")
+	}
+
+	var decrypted bytes.Buffer
+	if err := client.Transit().DecryptStream(ctx, "foo", bytes.NewReader(ciphertext.Bytes()), &decrypted, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, decrypted.Bytes()) {
+		t.Fatal("decrypted plaintext does not match")
+	}
+
+	// A wrong context is rejected before any output is written
+	decrypted.Reset()
+	err = client.Transit().DecryptStream(ctx, "foo", bytes.NewReader(ciphertext.Bytes()), &decrypted, &api.TransitStreamOptions{
+		Context: []byte("other context"),
+	})
+	if err == nil {
+		t.Fatal("expected error decrypting with the wrong context")
+	}
+	if decrypted.Len() != 0 {
+		t.Fatal("expected no output when decrypting with the wrong context")
+	}
+
+	// Truncation past the first chunk is reported after the fact
+	truncated := ciphertext.Bytes()[:ciphertext.Len()-100]
+	if err := client.Transit().DecryptStream(ctx, "foo", bytes.NewReader(truncated), &decrypted, opts); err == nil {
+		t.Fatal("expected error decrypting truncated stream")
+	}
+}
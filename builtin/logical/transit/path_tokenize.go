@@ -0,0 +1,262 @@
+package transit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const tokenStoragePrefix = "tokens/"
+
+// tokenEntry is the record of a token in the token store of a key
+type tokenEntry struct {
+	KeyVersion     int       `json:"key_version"`
+	CreationTime   time.Time `json:"creation_time"`
+	ExpirationTime time.Time `json:"expiration_time,omitempty"`
+}
+
+func (b *backend) pathTokenize() *framework.Path {
+	fields := fpeFields("value", "The value to tokenize")
+	fields["ttl"] = &framework.FieldSchema{
+		Type: framework.TypeDurationSecond,
+		Description: `The time after which the token can no longer be
+detokenized. Only valid for keys with a token store.
+Defaults to no expiration.`,
+	}
+
+	return &framework.Path{
+		Pattern: "tokenize/" + framework.GenericNameRegex("name"),
+		Fields:  fields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.withKeyUsage(b.pathTokenizeWrite),
+		},
+
+		HelpSynopsis:    pathTokenizeHelpSyn,
+		HelpDescription: pathTokenizeHelpDesc,
+	}
+}
+
+func (b *backend) pathDetokenize() *framework.Path {
+	return &framework.Path{
+		Pattern: "detokenize/" + framework.GenericNameRegex("name"),
+		Fields:  fpeFields("token", "The token to detokenize"),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.withKeyUsage(b.pathDetokenizeWrite),
+		},
+
+		HelpSynopsis:    pathDetokenizeHelpSyn,
+		HelpDescription: pathDetokenizeHelpDesc,
+	}
+}
+
+func (b *backend) pathRevokeToken() *framework.Path {
+	return &framework.Path{
+		Pattern: "tokens/" + framework.GenericNameRegex("name") + "/revoke",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"token": {
+				Type:        framework.TypeString,
+				Description: "The token to revoke",
+			},
+
+			"key_version": {
+				Type:        framework.TypeInt,
+				Description: "The version of the key that issued the token. Defaults to the latest version.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRevokeTokenWrite,
+		},
+
+		HelpSynopsis:    pathRevokeTokenHelpSyn,
+		HelpDescription: pathRevokeTokenHelpDesc,
+	}
+}
+
+func (b *backend) pathTokenizeWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ttl := time.Duration(d.Get("ttl").(int)) * time.Second
+	if ttl < 0 {
+		return logical.ErrorResponse("ttl cannot be negative"), logical.ErrInvalidRequest
+	}
+
+	return b.fpeTransform(ctx, req, d, "value", keyOperationTokenize, func(p *keysutil.Policy, ver int, format *fpeFormat, item batchRequestFPEItem, input string, result *batchResponseFPEItem) error {
+		if ttl != 0 && !p.TokenStore {
+			return errutil.UserError{Err: "ttl requires the key to have a token store"}
+		}
+
+		context, err := decodeFPEContext(item)
+		if err != nil {
+			return err
+		}
+		token, err := format.transform(input, func(value string) (string, error) {
+			return p.Tokenize(ver, context, format.alphabet, value)
+		})
+		if err != nil {
+			return err
+		}
+
+		if p.TokenStore {
+			if err := storeToken(ctx, req.Storage, p, ver, token, ttl); err != nil {
+				return err
+			}
+		}
+
+		result.Token = token
+		return nil
+	})
+}
+
+func (b *backend) pathDetokenizeWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return b.fpeTransform(ctx, req, d, "token", keyOperationDetokenize, func(p *keysutil.Policy, ver int, format *fpeFormat, item batchRequestFPEItem, input string, result *batchResponseFPEItem) error {
+		if p.TokenStore {
+			if err := checkToken(ctx, req.Storage, p, ver, input); err != nil {
+				return err
+			}
+		}
+
+		context, err := decodeFPEContext(item)
+		if err != nil {
+			return err
+		}
+		result.Value, err = format.transform(input, func(token string) (string, error) {
+			return p.Detokenize(ver, context, format.alphabet, token)
+		})
+		return err
+	})
+}
+
+func (b *backend) pathRevokeTokenWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	ver := d.Get("key_version").(int)
+
+	token := d.Get("token").(string)
+	if token == "" {
+		return logical.ErrorResponse("missing token"), logical.ErrInvalidRequest
+	}
+
+	// Get the policy
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	if !p.TokenStore {
+		return logical.ErrorResponse("key does not have a token store"), logical.ErrInvalidRequest
+	}
+	if ver == 0 {
+		ver = p.LatestVersion
+	}
+
+	tokenHash, err := p.TokenHash(ver, token)
+	if err != nil {
+		return handleKeysutilError(err)
+	}
+
+	return nil, req.Storage.Delete(ctx, tokenStoragePath(p.Name, tokenHash))
+}
+
+func tokenStoragePath(name, tokenHash string) string {
+	return tokenStoragePrefix + name + "/" + tokenHash
+}
+
+// storeToken records the token in the token store of the key
+func storeToken(ctx context.Context, s logical.Storage, p *keysutil.Policy, ver int, token string, ttl time.Duration) error {
+	tokenHash, err := p.TokenHash(ver, token)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	record := &tokenEntry{
+		KeyVersion:   ver,
+		CreationTime: now,
+	}
+	if ttl != 0 {
+		record.ExpirationTime = now.Add(ttl)
+	}
+
+	entry, err := logical.StorageEntryJSON(tokenStoragePath(p.Name, tokenHash), record)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// checkToken returns an error if the token is not in the token store of the
+// key or has expired
+func checkToken(ctx context.Context, s logical.Storage, p *keysutil.Policy, ver int, token string) error {
+	tokenHash, err := p.TokenHash(ver, token)
+	if err != nil {
+		return err
+	}
+
+	entry, err := s.Get(ctx, tokenStoragePath(p.Name, tokenHash))
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return errutil.UserError{Err: "token not found"}
+	}
+
+	var record tokenEntry
+	if err := entry.DecodeJSON(&record); err != nil {
+		return fmt.Errorf("error decoding token entry: %w", err)
+	}
+	if !record.ExpirationTime.IsZero() && time.Now().After(record.ExpirationTime) {
+		return errutil.UserError{Err: "token has expired"}
+	}
+
+	return nil
+}
+
+const pathTokenizeHelpSyn = `Tokenize a value with the named key`
+
+const pathTokenizeHelpDesc = `
+This path uses the named "ff3-1" key to return a token for a value. Tokens
+have the same length and format as the values, and the same key version,
+context and value always give the same token. Tokens are computed with
+FF3-1 under a tweak derived from the key version, so they differ from the
+values returned by the "fpe/encode" endpoint.
+
+If the key has a token store, the token is recorded so that it can be
+detokenized, optionally until its ttl expires, and revoked.
+`
+
+const pathDetokenizeHelpSyn = `Detokenize a token with the named key`
+
+const pathDetokenizeHelpDesc = `
+This path uses the named "ff3-1" key to return the value of a token
+returned by the "tokenize" endpoint. The same key version, context and
+template or alphabet must be given. If the key has a token store, only
+recorded tokens that have not expired or been revoked can be detokenized.
+`
+
+const pathRevokeTokenHelpSyn = `Revoke a token issued by the named key`
+
+const pathRevokeTokenHelpDesc = `
+This path removes a token from the token store of the named key, so that it
+can no longer be detokenized. Tokenizing the same value again records the
+token again.
+`
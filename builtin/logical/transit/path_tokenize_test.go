@@ -0,0 +1,139 @@
+package transit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestTransit_Tokenize(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	for _, name := range []string{"tokens", "stored"} {
+		resp, err := request(logical.UpdateOperation, "keys/"+name, map[string]interface{}{
+			"type":        "ff3-1",
+			"token_store": name == "stored",
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+	}
+
+	resp, err := request(logical.UpdateOperation, "keys/aes", map[string]interface{}{
+		"token_store": true,
+	})
+	if err == nil {
+		t.Fatalf("expected error creating an aes key with a token store, got resp: %#v", resp)
+	}
+
+	// Tokens are deterministic and differ from encoded values
+	resp, err = request(logical.UpdateOperation, "tokenize/tokens", map[string]interface{}{
+		"value":    "078-05-1120",
+		"template": "socialsecuritynumber",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	token := resp.Data["token"].(string)
+
+	resp, err = request(logical.UpdateOperation, "tokenize/tokens", map[string]interface{}{
+		"value":    "078-05-1120",
+		"template": "socialsecuritynumber",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data["token"].(string) != token {
+		t.Fatalf("tokens are not deterministic: %q, %q", token, resp.Data["token"])
+	}
+
+	resp, err = request(logical.UpdateOperation, "fpe/encode/tokens", map[string]interface{}{
+		"value":    "078-05-1120",
+		"template": "socialsecuritynumber",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data["value"].(string) == token {
+		t.Fatal("token is the same as the encoded value")
+	}
+
+	resp, err = request(logical.UpdateOperation, "detokenize/tokens", map[string]interface{}{
+		"token":    token,
+		"template": "socialsecuritynumber",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data["value"].(string) != "078-05-1120" {
+		t.Fatalf("bad detokenized value %q", resp.Data["value"])
+	}
+
+	// With a token store, only recorded tokens can be detokenized
+	resp, err = request(logical.UpdateOperation, "tokenize/stored", map[string]interface{}{
+		"value": "4111111111111111",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	token = resp.Data["token"].(string)
+
+	detokenize := func() (*logical.Response, error) {
+		return request(logical.UpdateOperation, "detokenize/stored", map[string]interface{}{
+			"token": token,
+		})
+	}
+	resp, err = detokenize()
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data["value"].(string) != "4111111111111111" {
+		t.Fatalf("bad detokenized value %q", resp.Data["value"])
+	}
+
+	resp, err = request(logical.UpdateOperation, "tokens/stored/revoke", map[string]interface{}{
+		"token": token,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = detokenize()
+	if err == nil {
+		t.Fatalf("expected error detokenizing a revoked token, got resp: %#v", resp)
+	}
+
+	// Deleting the key removes its token store
+	resp, err = request(logical.UpdateOperation, "tokenize/stored", map[string]interface{}{
+		"value": "4111111111111111",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = request(logical.UpdateOperation, "keys/stored/config", map[string]interface{}{
+		"deletion_allowed": true,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = request(logical.DeleteOperation, "keys/stored", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	keys, err := storage.List(context.Background(), tokenStoragePrefix+"stored/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("expected token store to be removed, got %v", keys)
+	}
+}
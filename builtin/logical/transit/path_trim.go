@@ -2,6 +2,11 @@ package transit
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/keysutil"
@@ -25,6 +30,14 @@ lesser of 'min_decryption_version' and 'min_encryption_version'. This is not
 allowed to be set when either 'min_encryption_version' or
 'min_decryption_version' is set to zero.`,
 			},
+			"usage_window": {
+				Type: framework.TypeDurationSecond,
+				Description: `
+Trimming is refused if a version to be deleted was used within this amount
+of time, according to the usage of the key. A value of 0 disables the check.
+Defaults to 24 hours.`,
+				Default: 86400, // 24h
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -80,6 +93,28 @@ func (b *backend) pathTrimUpdate() framework.OperationFunc {
 			return logical.ErrorResponse("minimum available version should be positive"), nil
 		}
 
+		usageWindow := time.Duration(d.Get("usage_window").(int)) * time.Second
+		if usageWindow < 0 {
+			return logical.ErrorResponse("usage window cannot be negative"), nil
+		}
+		if usageWindow > 0 {
+			cutoff := time.Now().Add(-usageWindow)
+			var used []int
+			for version, usage := range p.Usage() {
+				if version < minAvailableVersion && usage.LastUsed.After(cutoff) {
+					used = append(used, version)
+				}
+			}
+			if len(used) > 0 {
+				sort.Ints(used)
+				versions := make([]string, len(used))
+				for i, version := range used {
+					versions[i] = strconv.Itoa(version)
+				}
+				return logical.ErrorResponse(fmt.Sprintf("cannot trim key versions used within the usage window: %s", strings.Join(versions, ", "))), nil
+			}
+		}
+
 		// Ensure that cache doesn't get corrupted in error cases
 		p.MinAvailableVersion = minAvailableVersion
 		if err := p.Persist(ctx, req.Storage); err != nil {
@@ -95,5 +130,8 @@ const pathTrimHelpSyn = `Trim key versions of a named key`
 
 const pathTrimHelpDesc = `
 This path is used to trim key versions of a named key. Trimming only happens
-from the lower end of version numbers.
+from the lower end of version numbers. Trimming is refused if one of the
+versions to be deleted was used within "usage_window", which defaults to 24
+hours. The last use of each version is known cluster-wide, including uses
+on performance standbys, to within a minute.
 `
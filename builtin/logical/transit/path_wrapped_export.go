@@ -0,0 +1,345 @@
+package transit
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/kdf"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func (b *backend) pathWrappedExportKeys() *framework.Path {
+	return &framework.Path{
+		Pattern: "wrapped_export/" + framework.GenericNameRegex("type") + "/" + framework.GenericNameRegex("name") + framework.OptionalParamRegex("version"),
+		Fields: map[string]*framework.FieldSchema{
+			"type": {
+				Type:        framework.TypeString,
+				Description: "Type of key to export (encryption-key, signing-key, hmac-key)",
+			},
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+			"version": {
+				Type:        framework.TypeString,
+				Description: "Version of the key",
+			},
+			"public_key": {
+				Type: framework.TypeString,
+				Description: `The PEM-encoded public key to wrap the exported
+key material to. Can be an RSA key of at least 2048 bits, an ECDSA key on
+the P-256, P-384 or P-521 curves, or an X25519 key.`,
+			},
+			"hash_function": {
+				Type:    framework.TypeString,
+				Default: "SHA256",
+				Description: `The hash function used as part of the RSA-OAEP
+wrapping of the ephemeral AES key when wrapping to an RSA public key. Can
+be one of "SHA1", "SHA224", "SHA256" (default), "SHA384", or "SHA512".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathWrappedExportWrite,
+		},
+
+		HelpSynopsis:    pathWrappedExportHelpSyn,
+		HelpDescription: pathWrappedExportHelpDesc,
+	}
+}
+
+func (b *backend) pathWrappedExportWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	exportType := d.Get("type").(string)
+	name := d.Get("name").(string)
+	version := d.Get("version").(string)
+
+	switch exportType {
+	case exportTypeEncryptionKey:
+	case exportTypeSigningKey:
+	case exportTypeHMACKey:
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("invalid export type: %s", exportType)), logical.ErrInvalidRequest
+	}
+
+	publicKeyPEM := d.Get("public_key").(string)
+	if publicKeyPEM == "" {
+		return logical.ErrorResponse("missing public_key to wrap the exported key to"), logical.ErrInvalidRequest
+	}
+	publicKey, err := parseTransportPublicKey(publicKeyPEM)
+	if err != nil {
+		return handleKeysutilError(err)
+	}
+	hashFn, err := parseImportHashFunction(d.Get("hash_function").(string))
+	if err != nil {
+		return handleKeysutilError(err)
+	}
+
+	p, _, err := b.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	}, b.GetRandomReader())
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, nil
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	if !p.Exportable && !p.AllowWrappedExport {
+		return logical.ErrorResponse("key does not allow wrapped export"), logical.ErrInvalidRequest
+	}
+
+	switch exportType {
+	case exportTypeEncryptionKey:
+		if !p.Type.EncryptionSupported() && !p.Type.FPESupported() {
+			return logical.ErrorResponse("encryption not supported for the key"), logical.ErrInvalidRequest
+		}
+	case exportTypeSigningKey:
+		if !p.Type.SigningSupported() {
+			return logical.ErrorResponse("signing not supported for the key"), logical.ErrInvalidRequest
+		}
+	}
+
+	keys, err := getExportKeyVersions(p, version)
+	if err != nil {
+		return handleKeysutilError(err)
+	}
+
+	retKeys := map[string]string{}
+	for k, v := range keys {
+		keyBytes, err := getWrappedExportKey(p, &v, exportType)
+		if err != nil {
+			return nil, err
+		}
+
+		// Wrapping consumes the hash function, so each version gets a fresh one
+		hashFn.Reset()
+		wrappedKey, err := wrapKeyToPublicKey(b.GetRandomReader(), publicKey, hashFn, keyBytes)
+		if err != nil {
+			return handleKeysutilError(err)
+		}
+		retKeys[k] = base64.StdEncoding.EncodeToString(wrappedKey)
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"name": p.Name,
+			"type": p.Type.String(),
+			"keys": retKeys,
+		},
+	}
+
+	return resp, nil
+}
+
+// getWrappedExportKey returns the key material to wrap for export: raw key
+// bytes for symmetric keys and PKCS #8 DER-encoded private keys for
+// asymmetric keys, as accepted by the import endpoints and PKCS#11 unwrap.
+func getWrappedExportKey(policy *keysutil.Policy, key *keysutil.KeyEntry, exportType string) ([]byte, error) {
+	switch exportType {
+	case exportTypeHMACKey:
+		return key.HMACKey, nil
+
+	case exportTypeEncryptionKey:
+		switch policy.Type {
+		case keysutil.KeyType_AES128_GCM96, keysutil.KeyType_AES256_GCM96, keysutil.KeyType_ChaCha20_Poly1305, keysutil.KeyType_FF3_1:
+			return key.Key, nil
+
+		case keysutil.KeyType_RSA2048, keysutil.KeyType_RSA3072, keysutil.KeyType_RSA4096:
+			return x509.MarshalPKCS8PrivateKey(key.RSAKey)
+		}
+
+	case exportTypeSigningKey:
+		switch policy.Type {
+		case keysutil.KeyType_ECDSA_P256, keysutil.KeyType_ECDSA_P384, keysutil.KeyType_ECDSA_P521:
+			var curve elliptic.Curve
+			switch policy.Type {
+			case keysutil.KeyType_ECDSA_P384:
+				curve = elliptic.P384()
+			case keysutil.KeyType_ECDSA_P521:
+				curve = elliptic.P521()
+			default:
+				curve = elliptic.P256()
+			}
+			return x509.MarshalPKCS8PrivateKey(&ecdsa.PrivateKey{
+				PublicKey: ecdsa.PublicKey{
+					Curve: curve,
+					X:     key.EC_X,
+					Y:     key.EC_Y,
+				},
+				D: key.EC_D,
+			})
+
+		case keysutil.KeyType_ECDSA_SECP256K1:
+			return keysutil.MarshalSecp256k1PKCS8PrivateKey(key)
+
+		case keysutil.KeyType_ED25519:
+			return x509.MarshalPKCS8PrivateKey(ed25519.PrivateKey(key.Key))
+
+		case keysutil.KeyType_RSA2048, keysutil.KeyType_RSA3072, keysutil.KeyType_RSA4096:
+			return x509.MarshalPKCS8PrivateKey(key.RSAKey)
+		}
+	}
+
+	return nil, fmt.Errorf("unknown key type %v", policy.Type)
+}
+
+// x25519PublicKey is an X25519 public key supplied by a caller to wrap key
+// material to
+type x25519PublicKey []byte
+
+// oidPublicKeyX25519 identifies X25519 public keys, per RFC 8410
+var oidPublicKeyX25519 = asn1.ObjectIdentifier{1, 3, 101, 110}
+
+// parseTransportPublicKey parses a PEM-encoded public key supplied by a
+// caller to wrap key material to. RSA, NIST curve ECDSA and X25519 keys are
+// supported.
+func parseTransportPublicKey(publicKeyPEM string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, errutil.UserError{Err: "failed to decode PEM-encoded public key"}
+	}
+
+	// X25519 keys are not understood by the x509 package, so they are
+	// picked out of the SubjectPublicKeyInfo here
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if rest, err := asn1.Unmarshal(block.Bytes, &spki); err == nil && len(rest) == 0 && spki.Algorithm.Algorithm.Equal(oidPublicKeyX25519) {
+		if len(spki.Algorithm.Parameters.FullBytes) != 0 || len(spki.PublicKey.Bytes) != curve25519.PointSize || spki.PublicKey.BitLength != 8*curve25519.PointSize {
+			return nil, errutil.UserError{Err: "malformed X25519 public key"}
+		}
+		return x25519PublicKey(spki.PublicKey.Bytes), nil
+	}
+
+	parsedKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("failed to parse public key: %v", err)}
+	}
+
+	switch key := parsedKey.(type) {
+	case *rsa.PublicKey:
+		if key.Size() < 256 {
+			return nil, errutil.UserError{Err: "RSA public key must be at least 2048 bits"}
+		}
+		return key, nil
+
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return nil, errutil.UserError{Err: fmt.Sprintf("unsupported ECDSA curve %s", key.Curve.Params().Name)}
+		}
+		return key, nil
+
+	default:
+		return nil, errutil.UserError{Err: fmt.Sprintf("unsupported public key type %T", parsedKey)}
+	}
+}
+
+// wrapKeyToPublicKey wraps key material to the given public key. For RSA
+// keys the format is that of PKCS#11's CKM_RSA_AES_KEY_WRAP, also used for
+// imports. For ECDSA and X25519 keys, an ephemeral key pair on the same
+// curve is generated and the key material is wrapped with AES-KWP under a
+// 256-bit key derived from the ECDH shared secret with the ANSI X9.63 KDF
+// using SHA-256; the ephemeral public key, as an uncompressed point or
+// X25519 public key, precedes the wrapped key material.
+func wrapKeyToPublicKey(rand io.Reader, publicKey crypto.PublicKey, hashFn hash.Hash, key []byte) ([]byte, error) {
+	var ephemeralPublicKey, sharedSecret []byte
+	switch publicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return wrapKeyForTransport(rand, publicKey, hashFn, key)
+
+	case *ecdsa.PublicKey:
+		ephemeralKey, err := ecdsa.GenerateKey(publicKey.Curve, rand)
+		if err != nil {
+			return nil, fmt.Errorf("error generating ephemeral key: %w", err)
+		}
+		ephemeralPublicKey = elliptic.Marshal(publicKey.Curve, ephemeralKey.X, ephemeralKey.Y)
+
+		// The shared secret is the X coordinate of the shared point, padded
+		// to the size of the field
+		x, _ := publicKey.Curve.ScalarMult(publicKey.X, publicKey.Y, ephemeralKey.D.Bytes())
+		sharedSecret = make([]byte, (publicKey.Curve.Params().BitSize+7)/8)
+		x.FillBytes(sharedSecret)
+
+	case x25519PublicKey:
+		ephemeralKey := make([]byte, curve25519.ScalarSize)
+		if _, err := io.ReadFull(rand, ephemeralKey); err != nil {
+			return nil, fmt.Errorf("error generating ephemeral key: %w", err)
+		}
+
+		var err error
+		ephemeralPublicKey, err = curve25519.X25519(ephemeralKey, curve25519.Basepoint)
+		if err != nil {
+			return nil, fmt.Errorf("error generating ephemeral key: %w", err)
+		}
+
+		sharedSecret, err = curve25519.X25519(ephemeralKey, publicKey)
+		if err != nil {
+			return nil, errutil.UserError{Err: fmt.Sprintf("error computing shared secret: %v", err)}
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+
+	kek, err := kdf.X963(sha256.New, sharedSecret, nil, 256)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := keysutil.WrapKeyWithPadding(kek, key)
+	if err != nil {
+		return nil, fmt.Errorf("error wrapping key: %w", err)
+	}
+
+	return append(ephemeralPublicKey, wrappedKey...), nil
+}
+
+const pathWrappedExportHelpSyn = `Export named encryption or signing key wrapped to a public key`
+
+const pathWrappedExportHelpDesc = `
+This path is used to export the named keys wrapped to a caller-supplied
+public key, so that the key material is never returned in plaintext. Keys
+must be configured as exportable or with "allow_wrapped_export".
+
+Symmetric keys are wrapped as raw key bytes and asymmetric keys as PKCS #8
+DER-encoded private keys. Each version is wrapped and returned
+base64-encoded.
+
+For RSA public keys, the format is that of PKCS#11's CKM_RSA_AES_KEY_WRAP
+mechanism, as used by the import endpoints: a fresh 256-bit AES key
+encrypted with RSA-OAEP under the public key, followed by the key material
+wrapped with AES-KWP (RFC 5649) under the AES key.
+
+For ECDSA (P-256, P-384, P-521) and X25519 public keys, an ephemeral key
+pair on the same curve is generated, and a 256-bit AES key is derived from
+the ECDH shared secret with the ANSI X9.63 KDF using SHA-256 and no shared
+info. The result is the ephemeral public key, as an uncompressed point or
+a 32-byte X25519 public key, followed by the key material wrapped with
+AES-KWP under the derived AES key.
+`
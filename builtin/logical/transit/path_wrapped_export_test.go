@@ -0,0 +1,367 @@
+package transit
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"hash"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+
+	"github.com/hashicorp/vault/sdk/helper/kdf"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestTransit_WrappedExport(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: operation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	marshalPublicKey := func(pub interface{}) string {
+		derBytes, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: derBytes}))
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x25519Key := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(x25519Key); err != nil {
+		t.Fatal(err)
+	}
+	x25519PublicKey, err := curve25519.X25519(x25519Key, curve25519.Basepoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x25519PublicKeyDER, err := asn1.Marshal(struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 101, 110}},
+		PublicKey: asn1.BitString{Bytes: x25519PublicKey, BitLength: 8 * len(x25519PublicKey)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	x25519PublicKeyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: x25519PublicKeyDER}))
+
+	unwrapRSA := func(hashFn hash.Hash, wrapped []byte) []byte {
+		t.Helper()
+		ephemeralKey, err := rsa.DecryptOAEP(hashFn, rand.Reader, rsaKey, wrapped[:rsaKey.Size()], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := keysutil.UnwrapKeyWithPadding(ephemeralKey, wrapped[rsaKey.Size():])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	unwrapWithSharedSecret := func(sharedSecret, wrapped []byte) []byte {
+		t.Helper()
+		kek, err := kdf.X963(sha256.New, sharedSecret, nil, 256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := keysutil.UnwrapKeyWithPadding(kek, wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	unwrapECDSA := func(privKey *ecdsa.PrivateKey, wrapped []byte) []byte {
+		t.Helper()
+		byteLen := (privKey.Curve.Params().BitSize + 7) / 8
+		pubKeyLen := 1 + 2*byteLen
+		x, y := elliptic.Unmarshal(privKey.Curve, wrapped[:pubKeyLen])
+		if x == nil {
+			t.Fatal("failed to parse ephemeral public key")
+		}
+		sharedX, _ := privKey.Curve.ScalarMult(x, y, privKey.D.Bytes())
+		sharedSecret := make([]byte, byteLen)
+		sharedX.FillBytes(sharedSecret)
+		return unwrapWithSharedSecret(sharedSecret, wrapped[pubKeyLen:])
+	}
+
+	unwrapX25519 := func(wrapped []byte) []byte {
+		t.Helper()
+		sharedSecret, err := curve25519.X25519(x25519Key, wrapped[:curve25519.PointSize])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return unwrapWithSharedSecret(sharedSecret, wrapped[curve25519.PointSize:])
+	}
+
+	wrappedExport := func(path string, data map[string]interface{}) map[string][]byte {
+		t.Helper()
+		resp, err := request(logical.UpdateOperation, "wrapped_export/"+path, data)
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		keys := map[string][]byte{}
+		for version, wrapped := range resp.Data["keys"].(map[string]string) {
+			keys[version], err = base64.StdEncoding.DecodeString(wrapped)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return keys
+	}
+
+	plaintextExport := func(path string) map[string]string {
+		t.Helper()
+		resp, err := request(logical.ReadOperation, "export/"+path, nil)
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		return resp.Data["keys"].(map[string]string)
+	}
+
+	t.Run("not allowed", func(t *testing.T) {
+		resp, err := request(logical.UpdateOperation, "keys/private", nil)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		resp, err = request(logical.UpdateOperation, "wrapped_export/encryption-key/private", map[string]interface{}{
+			"public_key": marshalPublicKey(rsaKey.Public()),
+		})
+		if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error exporting key: err: %v resp: %#v", err, resp)
+		}
+	})
+
+	t.Run("aes256-gcm96 to RSA", func(t *testing.T) {
+		// The key is not exportable in plaintext
+		resp, err := request(logical.UpdateOperation, "keys/aes", map[string]interface{}{
+			"allow_wrapped_export": true,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		resp, err = request(logical.ReadOperation, "export/encryption-key/aes", nil)
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error exporting key in plaintext: err: %v resp: %#v", err, resp)
+		}
+
+		keys := wrappedExport("encryption-key/aes/latest", map[string]interface{}{
+			"public_key":    marshalPublicKey(rsaKey.Public()),
+			"hash_function": "SHA512",
+		})
+		if len(keys) != 1 || keys["1"] == nil {
+			t.Fatalf("unexpected keys: %#v", keys)
+		}
+		key := unwrapRSA(sha512.New(), keys["1"])
+
+		// The unwrapped key decrypts ciphertexts of the key
+		plaintext := []byte("the quick brown fox")
+		resp, err = request(logical.UpdateOperation, "encrypt/aes", map[string]interface{}{
+			"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(resp.Data["ciphertext"].(string), "vault:v1:"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decrypted, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plaintext, decrypted) {
+			t.Fatal("unwrapped key does not decrypt ciphertexts")
+		}
+
+		resp, err = request(logical.ReadOperation, "keys/aes", nil)
+		if err != nil || resp == nil || resp.Data["allow_wrapped_export"] != true || resp.Data["exportable"] != false {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+	})
+
+	t.Run("ecdsa-p256 to ECDH", func(t *testing.T) {
+		resp, err := request(logical.UpdateOperation, "keys/ecdsa", map[string]interface{}{
+			"type":       "ecdsa-p256",
+			"exportable": true,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		resp, err = request(logical.UpdateOperation, "keys/ecdsa/rotate", nil)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+
+		keys := wrappedExport("signing-key/ecdsa", map[string]interface{}{
+			"public_key": marshalPublicKey(ecKey.Public()),
+		})
+		exported := plaintextExport("signing-key/ecdsa")
+		if len(keys) != 2 || len(exported) != 2 {
+			t.Fatalf("unexpected keys: %#v", keys)
+		}
+		for version, wrapped := range keys {
+			parsed, err := x509.ParsePKCS8PrivateKey(unwrapECDSA(ecKey, wrapped))
+			if err != nil {
+				t.Fatal(err)
+			}
+			block, _ := pem.Decode([]byte(exported[version]))
+			expected, err := x509.ParseECPrivateKey(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !expected.Equal(parsed) {
+				t.Fatalf("unwrapped key for version %s does not match", version)
+			}
+		}
+	})
+
+	t.Run("ed25519 to X25519", func(t *testing.T) {
+		resp, err := request(logical.UpdateOperation, "keys/ed25519", map[string]interface{}{
+			"type": "ed25519",
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		resp, err = request(logical.UpdateOperation, "keys/ed25519/config", map[string]interface{}{
+			"allow_wrapped_export": true,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+
+		keys := wrappedExport("signing-key/ed25519/1", map[string]interface{}{
+			"public_key": x25519PublicKeyPEM,
+		})
+		parsed, err := x509.ParsePKCS8PrivateKey(unwrapX25519(keys["1"]))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err = request(logical.ReadOperation, "keys/ed25519", nil)
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		publicKey := resp.Data["keys"].(map[string]map[string]interface{})["1"]["public_key"].(string)
+		if base64.StdEncoding.EncodeToString(parsed.(ed25519.PrivateKey).Public().(ed25519.PublicKey)) != publicKey {
+			t.Fatal("unwrapped key does not match the public key")
+		}
+
+		// Wrapped export can't be disabled once enabled
+		resp, err = request(logical.UpdateOperation, "keys/ed25519/config", map[string]interface{}{
+			"allow_wrapped_export": false,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		wrappedExport("signing-key/ed25519/1", map[string]interface{}{
+			"public_key": x25519PublicKeyPEM,
+		})
+	})
+
+	t.Run("hmac-key to RSA", func(t *testing.T) {
+		resp, err := request(logical.UpdateOperation, "keys/hmac", map[string]interface{}{
+			"exportable": true,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		keys := wrappedExport("hmac-key/hmac/1", map[string]interface{}{
+			"public_key": marshalPublicKey(rsaKey.Public()),
+		})
+		if base64.StdEncoding.EncodeToString(unwrapRSA(sha256.New(), keys["1"])) != plaintextExport("hmac-key/hmac/1")["1"] {
+			t.Fatal("unwrapped key does not match")
+		}
+	})
+
+	t.Run("secp256k1", func(t *testing.T) {
+		resp, err := request(logical.UpdateOperation, "keys/secp256k1", map[string]interface{}{
+			"type":       "ecdsa-secp256k1",
+			"exportable": true,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		keys := wrappedExport("signing-key/secp256k1/1", map[string]interface{}{
+			"public_key": marshalPublicKey(rsaKey.Public()),
+		})
+
+		// The PKCS #8 encoding holds the SEC 1 encoding of the plaintext
+		// export, without the curve that is named in the algorithm instead
+		pkcs8 := unwrapRSA(sha256.New(), keys["1"])
+		block, _ := pem.Decode([]byte(plaintextExport("signing-key/secp256k1/1")["1"]))
+		if !bytes.Contains(pkcs8, block.Bytes[2:2+3+32]) {
+			t.Fatal("unwrapped key does not hold the private key")
+		}
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		smallRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, data := range map[string]map[string]interface{}{
+			"missing public key": {},
+			"invalid public key": {"public_key": "not a key"},
+			"small RSA key":      {"public_key": marshalPublicKey(smallRSAKey.Public())},
+			"ed25519 key":        {"public_key": marshalPublicKey(ed25519Key.Public())},
+			"invalid hash":       {"public_key": marshalPublicKey(rsaKey.Public()), "hash_function": "MD5"},
+		} {
+			resp, err := request(logical.UpdateOperation, "wrapped_export/hmac-key/hmac", data)
+			if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+				t.Fatalf("%s: expected error: err: %v resp: %#v", name, err, resp)
+			}
+		}
+
+		resp, err := request(logical.UpdateOperation, "wrapped_export/hmac-key/hmac/5", map[string]interface{}{
+			"public_key": marshalPublicKey(rsaKey.Public()),
+		})
+		if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for missing version: err: %v resp: %#v", err, resp)
+		}
+	})
+}
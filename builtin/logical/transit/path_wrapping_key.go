@@ -0,0 +1,134 @@
+package transit
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"strconv"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	wrappingKeyName          = "wrapping-key"
+	wrappingKeyStoragePrefix = "import/"
+)
+
+func (b *backend) pathWrappingKey() *framework.Path {
+	return &framework.Path{
+		Pattern: "wrapping_key",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathWrappingKeyRead,
+		},
+
+		HelpSynopsis:    pathWrappingKeyHelpSyn,
+		HelpDescription: pathWrappingKeyHelpDesc,
+	}
+}
+
+func (b *backend) pathWrappingKeyRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	wrappingKey, err := b.getWrappingKey(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	derBytes, err := x509.MarshalPKIXPublicKey(wrappingKey.Public())
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling RSA public key: %w", err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: derBytes,
+	})
+	if len(pemBytes) == 0 {
+		return nil, fmt.Errorf("failed to PEM-encode RSA public key")
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"public_key": string(pemBytes),
+		},
+	}, nil
+}
+
+// getWrappingKey returns the RSA key used to wrap keys being imported,
+// generating it on first use. Performance standbys and secondaries cannot
+// write the key, so requests arriving there before it exists are forwarded
+// to the active node of the primary, which generates it.
+func (b *backend) getWrappingKey(ctx context.Context, storage logical.Storage) (*rsa.PrivateKey, error) {
+	b.wrappingKeyLock.Lock()
+	defer b.wrappingKeyLock.Unlock()
+
+	if b.wrappingKey != nil {
+		return b.wrappingKey, nil
+	}
+
+	p, err := keysutil.LoadPolicy(ctx, storage, path.Join(wrappingKeyStoragePrefix, "policy", wrappingKeyName))
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		replicationState := b.System().ReplicationState()
+		if replicationState.HasState(consts.ReplicationPerformanceStandby) ||
+			(!b.System().LocalMount() && replicationState.HasState(consts.ReplicationPerformanceSecondary)) {
+			return nil, logical.ErrReadOnly
+		}
+
+		p = keysutil.NewPolicy(keysutil.PolicyConfig{
+			Name:          wrappingKeyName,
+			Type:          keysutil.KeyType_RSA4096,
+			StoragePrefix: wrappingKeyStoragePrefix,
+		})
+		if err := p.Rotate(ctx, storage, b.GetRandomReader()); err != nil {
+			return nil, fmt.Errorf("error generating wrapping key: %w", err)
+		}
+	}
+
+	key, ok := p.Keys[strconv.Itoa(p.LatestVersion)]
+	if !ok || key.RSAKey == nil {
+		return nil, fmt.Errorf("wrapping key is missing its key material")
+	}
+
+	b.wrappingKey = key.RSAKey
+	return b.wrappingKey, nil
+}
+
+// wrapKeyForTransport wraps key material for the holder of the given RSA
+// private key, in the format expected by the import endpoints: a fresh
+// AES-256 key encrypted with RSA-OAEP, followed by the key material wrapped
+// with AES-KWP under that AES key.
+func wrapKeyForTransport(rand io.Reader, wrappingKey *rsa.PublicKey, hashFn hash.Hash, key []byte) ([]byte, error) {
+	ephemeralKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand, ephemeralKey); err != nil {
+		return nil, fmt.Errorf("error generating ephemeral key: %w", err)
+	}
+
+	encryptedEphemeralKey, err := rsa.EncryptOAEP(hashFn, rand, wrappingKey, ephemeralKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting ephemeral key: %w", err)
+	}
+
+	wrappedKey, err := keysutil.WrapKeyWithPadding(ephemeralKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("error wrapping key: %w", err)
+	}
+
+	return append(encryptedEphemeralKey, wrappedKey...), nil
+}
+
+const pathWrappingKeyHelpSyn = `Returns the public key to use for wrapping imported keys`
+
+const pathWrappingKeyHelpDesc = `
+This path is used to retrieve the RSA-4096 wrapping key for wrapping keys
+that are being imported into transit with the "keys/:name/import" and
+"keys/:name/import_version" endpoints.
+`
@@ -1128,6 +1128,49 @@ func isForm(head []byte, contentType string) bool {
 	return true
 }
 
+// ocspPathRegex matches the OCSP endpoints of PKI mounts.
+var ocspPathRegex = regexp.MustCompile(`(^|/)ocsp$`)
+
+// isOcspRequest reports whether the request body is a DER-encoded OCSP
+// request sent to an OCSP endpoint, per RFC 6960 Appendix A.1.
+func isOcspRequest(path, contentType string) bool {
+	contentType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return contentType == "application/ocsp-request" && ocspPathRegex.MatchString(path)
+}
+
+// estEnrollPathRegex matches the enrollment endpoints of the EST directories
+// of PKI mounts, with or without a label.
+var estEnrollPathRegex = regexp.MustCompile(`(^|/)est/([a-zA-Z0-9][a-zA-Z0-9_\-]*/)?simple(re)?enroll$`)
+
+// isEstRequest reports whether the request body is a base64-encoded PKCS#10
+// request sent to an EST enrollment endpoint, per RFC 7030 Section 4.2.1.
+func isEstRequest(path, contentType string) bool {
+	contentType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return contentType == "application/pkcs10" && estEnrollPathRegex.MatchString(path)
+}
+
+// streamPathRegex matches the streaming endpoints of transit mounts.
+var streamPathRegex = regexp.MustCompile(`(^|/)(encrypt|decrypt)-stream/[^/]+$`)
+
+// isStreamRequest reports whether the request body is a raw stream of data
+// sent to a streaming endpoint, which reads it as it is processed.
+func isStreamRequest(path, contentType string) bool {
+	contentType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return contentType == "application/octet-stream" && streamPathRegex.MatchString(path)
+}
+
 func respondError(w http.ResponseWriter, status int, err error) {
 	logical.RespondError(w, status, err)
 }
@@ -101,12 +101,20 @@ func buildLogicalRequestNoAuth(perfStandby bool, w http.ResponseWriter, r *http.
 		bufferedBody := newBufferedReader(r.Body)
 		r.Body = bufferedBody
 
-		// If we are uploading a snapshot we don't want to parse it. Instead
+		// If we are uploading a snapshot or receiving an OCSP or EST request
+		// (which are DER or base64 encoded) we don't want to parse it. Instead
 		// we will simply add the HTTP request to the logical request object
 		// for later consumption.
-		if path == "sys/storage/raft/snapshot" || path == "sys/storage/raft/snapshot-force" {
+		if path == "sys/storage/raft/snapshot" || path == "sys/storage/raft/snapshot-force" || isOcspRequest(path, r.Header.Get("Content-Type")) || isEstRequest(path, r.Header.Get("Content-Type")) {
 			passHTTPReq = true
 			origBody = r.Body
+		} else if isStreamRequest(path, r.Header.Get("Content-Type")) {
+			// Streams are read and written by the backend as they are
+			// processed, so parameters come from the query string.
+			passHTTPReq = true
+			origBody = r.Body
+			responseWriter = w
+			data = parseQuery(r.URL.Query())
 		} else {
 			// Sample the first bytes to determine whether this should be parsed as
 			// a form or as JSON. The amount to look ahead (512 bytes) is arbitrary
@@ -176,7 +184,12 @@ func buildLogicalRequestNoAuth(perfStandby bool, w http.ResponseWriter, r *http.
 			path += "/"
 		}
 
-	case "OPTIONS", "HEAD":
+	case "HEAD":
+		// HEAD is only served by paths that handle the header operation,
+		// such as the ACME nonce endpoints; net/http discards the body.
+		op = logical.HeaderOperation
+
+	case "OPTIONS":
 	default:
 		return nil, nil, http.StatusMethodNotAllowed, nil
 	}
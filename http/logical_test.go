@@ -85,6 +85,22 @@ func TestLogical_noExist(t *testing.T) {
 	testResponseStatus(t, resp, 404)
 }
 
+func TestLogical_HeadNotRead(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/secret/foo", map[string]interface{}{
+		"data": "bar",
+	})
+	testResponseStatus(t, resp, 204)
+
+	// HEAD is not served by paths that only handle reads
+	resp = testHttpData(t, "HEAD", token, addr+"/v1/secret/foo", nil, false, 0)
+	testResponseStatus(t, resp, 405)
+}
+
 func TestLogical_StandbyRedirect(t *testing.T) {
 	ln1, addr1 := TestListener(t)
 	defer ln1.Close()
@@ -499,3 +515,52 @@ func TestLogical_ShouldParseForm(t *testing.T) {
 		}
 	}
 }
+
+func TestLogical_IsOcspRequest(t *testing.T) {
+	const ocspCT = "application/ocsp-request"
+
+	tests := map[string]struct {
+		path        string
+		contentType string
+		isOcsp      bool
+	}{
+		"OCSP":              {"pki/ocsp", ocspCT, true},
+		"OCSP in namespace": {"ns1/pki/ocsp", ocspCT, true},
+		"OCSP w/wrong CT":   {"pki/ocsp", "application/json", false},
+		"Other path":        {"secret/foo", ocspCT, false},
+		"OCSP path prefix":  {"pki/ocsp/extra", ocspCT, false},
+		"OCSP name suffix":  {"pki/notocsp", ocspCT, false},
+	}
+
+	for name, test := range tests {
+		isOcsp := isOcspRequest(test.path, test.contentType)
+
+		if isOcsp != test.isOcsp {
+			t.Fatalf("%s fail: expected isOcspRequest %t, got %t", name, test.isOcsp, isOcsp)
+		}
+	}
+}
+
+func TestLogical_IsEstRequest(t *testing.T) {
+	const estCT = "application/pkcs10"
+
+	tests := map[string]struct {
+		path        string
+		contentType string
+		isEst       bool
+	}{
+		"Enroll":             {"pki/est/simpleenroll", estCT, true},
+		"Re-enroll w/label":  {"pki/est/routers/simplereenroll", estCT, true},
+		"Enroll w/wrong CT":  {"pki/est/simpleenroll", "application/json", false},
+		"Other path":         {"secret/foo", estCT, false},
+		"Other EST endpoint": {"pki/est/cacerts", estCT, false},
+	}
+
+	for name, test := range tests {
+		isEst := isEstRequest(test.path, test.contentType)
+
+		if isEst != test.isEst {
+			t.Fatalf("%s fail: expected isEstRequest %t, got %t", name, test.isEst, isEst)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package configutil
 import (
 	"fmt"
 	"io/ioutil"
+	"sort"
 	"time"
 
 	"github.com/hashicorp/go-secure-stdlib/parseutil"
@@ -24,6 +25,8 @@ type SharedConfig struct {
 	Seals   []*KMS   `hcl:"-"`
 	Entropy *Entropy `hcl:"-"`
 
+	KMSLibraries map[string]*KMSLibrary `hcl:"-"`
+
 	DisableMlock    bool        `hcl:"-"`
 	DisableMlockRaw interface{} `hcl:"disable_mlock"`
 
@@ -125,6 +128,13 @@ func ParseConfig(d string) (*SharedConfig, error) {
 		}
 	}
 
+	if o := list.Filter("kms_library"); len(o.Items) > 0 {
+		result.found("kms_library", "KMSLibraries")
+		if err := parseKMSLibraries(&result, o); err != nil {
+			return nil, fmt.Errorf("error parsing 'kms_library': %w", err)
+		}
+	}
+
 	if o := list.Filter("listener"); len(o.Items) > 0 {
 		result.found("listener", "Listener")
 		if err := ParseListeners(&result, o); err != nil {
@@ -198,6 +208,27 @@ func (c *SharedConfig) Sanitized() map[string]interface{} {
 		result["seals"] = sanitizedSeals
 	}
 
+	// Sanitize kms_library stanza
+	if len(c.KMSLibraries) != 0 {
+		names := make([]string, 0, len(c.KMSLibraries))
+		for name := range c.KMSLibraries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var sanitizedLibraries []interface{}
+		for _, name := range names {
+			l := c.KMSLibraries[name]
+			cleanLibrary := map[string]interface{}{
+				"type":    l.Type,
+				"name":    l.Name,
+				"library": l.Library,
+			}
+			sanitizedLibraries = append(sanitizedLibraries, cleanLibrary)
+		}
+		result["kms_libraries"] = sanitizedLibraries
+	}
+
 	// Sanitize telemetry stanza
 	if c.Telemetry != nil {
 		sanitizedTelemetry := map[string]interface{}{
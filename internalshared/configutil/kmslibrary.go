@@ -0,0 +1,56 @@
+package configutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+)
+
+// KMSLibraryTypePKCS11 is the type of the kms_library blocks configuring
+// PKCS#11 libraries.
+const KMSLibraryTypePKCS11 = "pkcs11"
+
+// KMSLibrary contains the configuration of a library the server may load to
+// use keys held by an external key store, such as the PKCS#11 module of an
+// HSM. Libraries are only loaded from the paths of the server configuration;
+// mounts reference them by name.
+type KMSLibrary struct {
+	Type    string `hcl:"-"`
+	Name    string `hcl:"name"`
+	Library string `hcl:"library"`
+}
+
+func parseKMSLibraries(result *SharedConfig, list *ast.ObjectList) error {
+	result.KMSLibraries = make(map[string]*KMSLibrary, len(list.Items))
+	for _, item := range list.Items {
+		if len(item.Keys) != 1 {
+			return fmt.Errorf("kms_library blocks must be labeled with the type of the library")
+		}
+		libraryType := strings.ToLower(item.Keys[0].Token.Value().(string))
+		if libraryType != KMSLibraryTypePKCS11 {
+			return fmt.Errorf("unsupported kms_library type %q", libraryType)
+		}
+
+		var library KMSLibrary
+		if err := hcl.DecodeObject(&library, item.Val); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("kms_library.%s:", libraryType))
+		}
+		library.Type = libraryType
+
+		switch {
+		case library.Name == "":
+			return fmt.Errorf("kms_library.%s: name must be set", libraryType)
+		case library.Library == "":
+			return fmt.Errorf("kms_library.%s.%s: library must be set", libraryType, library.Name)
+		}
+		if _, ok := result.KMSLibraries[library.Name]; ok {
+			return fmt.Errorf("kms_library.%s.%s: duplicate library name", libraryType, library.Name)
+		}
+		result.KMSLibraries[library.Name] = &library
+	}
+
+	return nil
+}
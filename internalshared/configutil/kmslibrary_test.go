@@ -0,0 +1,51 @@
+package configutil
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKMSLibraries(t *testing.T) {
+	config, err := ParseConfig(`
+kms_library "pkcs11" {
+  name    = "hsm1"
+  library = "/usr/lib/softhsm/libsofthsm2.so"
+}
+
+kms_library "PKCS11" {
+  name    = "hsm2"
+  library = "/opt/hsm/libcryptoki.so"
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]*KMSLibrary{
+		"hsm1": {Type: KMSLibraryTypePKCS11, Name: "hsm1", Library: "/usr/lib/softhsm/libsofthsm2.so"},
+		"hsm2": {Type: KMSLibraryTypePKCS11, Name: "hsm2", Library: "/opt/hsm/libcryptoki.so"},
+	}
+	if !reflect.DeepEqual(config.KMSLibraries, expected) {
+		t.Fatalf("unexpected libraries: %#v", config.KMSLibraries)
+	}
+
+	merged := config.Merge(&SharedConfig{KMSLibraries: map[string]*KMSLibrary{
+		"hsm2": {Type: KMSLibraryTypePKCS11, Name: "hsm2", Library: "/opt/hsm2/libcryptoki.so"},
+	}})
+	if len(merged.KMSLibraries) != 2 || merged.KMSLibraries["hsm2"].Library != "/opt/hsm2/libcryptoki.so" {
+		t.Fatalf("unexpected merged libraries: %#v", merged.KMSLibraries)
+	}
+
+	for config, expectedErr := range map[string]string{
+		`kms_library "aws" { name = "a", library = "/a.so" }`:                                                           "unsupported kms_library type",
+		`kms_library "pkcs11" { library = "/a.so" }`:                                                                    "name must be set",
+		`kms_library "pkcs11" { name = "a" }`:                                                                           "library must be set",
+		`kms_library "pkcs11" { name = "a", library = "/a.so" } kms_library "pkcs11" { name = "a", library = "/b.so" }`: "duplicate library name",
+	} {
+		_, err := ParseConfig(config)
+		if err == nil || !strings.Contains(err.Error(), expectedErr) {
+			t.Fatalf("expected %q parsing %s, got %v", expectedErr, config, err)
+		}
+	}
+}
@@ -26,6 +26,16 @@ func (c *SharedConfig) Merge(c2 *SharedConfig) *SharedConfig {
 		result.Seals = append(result.Seals, s)
 	}
 
+	if len(c.KMSLibraries) != 0 || len(c2.KMSLibraries) != 0 {
+		result.KMSLibraries = make(map[string]*KMSLibrary)
+		for name, l := range c.KMSLibraries {
+			result.KMSLibraries[name] = l
+		}
+		for name, l := range c2.KMSLibraries {
+			result.KMSLibraries[name] = l
+		}
+	}
+
 	result.Telemetry = c.Telemetry
 	if c2.Telemetry != nil {
 		result.Telemetry = c2.Telemetry
@@ -21,6 +21,10 @@ import (
 const (
 	mongoDBTypeName = "mongodb"
 
+	// externalDB is the database of users authenticated by an external
+	// source, such as x.509 client certificates
+	externalDB = "$external"
+
 	defaultUserNameTemplate = `{{ printf "v-%s-%s-%s-%s" (.DisplayName | truncate 15) (.RoleName | truncate 15) (random 20) (unix_time) | replace "." "-" | truncate 100 }}`
 )
 
@@ -104,7 +108,8 @@ func (m *MongoDB) Initialize(ctx context.Context, req dbplugin.InitializeRequest
 	}
 
 	resp := dbplugin.InitializeResponse{
-		Config: req.Config,
+		Config:                   req.Config,
+		SupportedCredentialTypes: []dbplugin.CredentialType{dbplugin.CredentialTypeClientCertificate},
 	}
 	return resp, nil
 }
@@ -114,14 +119,9 @@ func (m *MongoDB) NewUser(ctx context.Context, req dbplugin.NewUserRequest) (dbp
 		return dbplugin.NewUserResponse{}, dbutil.ErrEmptyCreationStatement
 	}
 
-	username, err := m.usernameProducer.Generate(req.UsernameConfig)
-	if err != nil {
-		return dbplugin.NewUserResponse{}, err
-	}
-
 	// Unmarshal statements.CreationStatements into mongodbRoles
 	var mongoCS mongoDBStatement
-	err = json.Unmarshal([]byte(req.Statements.Commands[0]), &mongoCS)
+	err := json.Unmarshal([]byte(req.Statements.Commands[0]), &mongoCS)
 	if err != nil {
 		return dbplugin.NewUserResponse{}, err
 	}
@@ -135,13 +135,39 @@ func (m *MongoDB) NewUser(ctx context.Context, req dbplugin.NewUserRequest) (dbp
 		return dbplugin.NewUserResponse{}, fmt.Errorf("roles array is required in creation statement")
 	}
 
-	createUserCmd := createUserCommand{
-		Username: username,
-		Password: req.Password,
-		Roles:    mongoCS.Roles.toStandardRolesArray(),
+	var username string
+	var createUserCmd createUserCommand
+	var userDB string
+	switch req.CredentialType {
+	case dbplugin.CredentialTypePassword:
+		username, err = m.usernameProducer.Generate(req.UsernameConfig)
+		if err != nil {
+			return dbplugin.NewUserResponse{}, err
+		}
+		createUserCmd = createUserCommand{
+			Username: username,
+			Password: req.Password,
+			Roles:    mongoCS.Roles.toStandardRolesArray(),
+		}
+		userDB = mongoCS.DB
+	case dbplugin.CredentialTypeClientCertificate:
+		// x.509 users are named by the subject of their certificate and
+		// live in the $external database, so their roles must name the
+		// database they are defined in
+		if req.Subject == "" {
+			return dbplugin.NewUserResponse{}, fmt.Errorf("missing certificate subject")
+		}
+		username = req.Subject
+		createUserCmd = createUserCommand{
+			Username: username,
+			Roles:    mongoCS.Roles.toQualifiedRolesArray(mongoCS.DB),
+		}
+		userDB = externalDB
+	default:
+		return dbplugin.NewUserResponse{}, fmt.Errorf("the %s credential type is not supported", req.CredentialType)
 	}
 
-	if err := m.runCommandWithRetry(ctx, mongoCS.DB, createUserCmd); err != nil {
+	if err := m.runCommandWithRetry(ctx, userDB, createUserCmd); err != nil {
 		return dbplugin.NewUserResponse{}, err
 	}
 
@@ -152,6 +178,9 @@ func (m *MongoDB) NewUser(ctx context.Context, req dbplugin.NewUserRequest) (dbp
 }
 
 func (m *MongoDB) UpdateUser(ctx context.Context, req dbplugin.UpdateUserRequest) (dbplugin.UpdateUserResponse, error) {
+	if req.PublicKey != nil {
+		return dbplugin.UpdateUserResponse{}, fmt.Errorf("the %s credential type is not supported", dbplugin.CredentialTypeRSAPrivateKey)
+	}
 	if req.Password != nil {
 		err := m.changeUserPassword(ctx, req.Username, req.Password.NewPassword)
 		return dbplugin.UpdateUserResponse{}, err
@@ -216,8 +245,11 @@ func (m *MongoDB) DeleteUser(ctx context.Context, req dbplugin.DeleteUserRequest
 	}
 
 	err = m.runCommandWithRetry(ctx, db, dropUserCmd)
-	cErr, ok := err.(mongo.CommandError)
-	if ok && cErr.Name == "UserNotFound" { // User already removed, don't retry needlessly
+	if mongoCS.DB == "" && isUserNotFound(err) {
+		// Users of client certificate roles live in the $external database
+		err = m.runCommandWithRetry(ctx, externalDB, dropUserCmd)
+	}
+	if isUserNotFound(err) { // User already removed, don't retry needlessly
 		log.Default().Warn("MongoDB user was deleted prior to lease revocation", "user", req.Username)
 		return dbplugin.DeleteUserResponse{}, nil
 	}
@@ -225,6 +257,13 @@ func (m *MongoDB) DeleteUser(ctx context.Context, req dbplugin.DeleteUserRequest
 	return dbplugin.DeleteUserResponse{}, err
 }
 
+// isUserNotFound returns whether the error of a command reports that the
+// user does not exist
+func isUserNotFound(err error) bool {
+	cErr, ok := err.(mongo.CommandError)
+	return ok && cErr.Name == "UserNotFound"
+}
+
 // runCommandWithRetry runs a command and retries once more if there's a failure
 // on the first attempt. This should be called with the lock held
 func (m *MongoDB) runCommandWithRetry(ctx context.Context, db string, cmd interface{}) error {
@@ -177,6 +177,67 @@ func TestMongoDB_CreateUser(t *testing.T) {
 	assertCredsExist(t, createResp.Username, password, connURL)
 }
 
+func TestMongoDB_CreateUser_clientCertificate(t *testing.T) {
+	cleanup, connURL := mongodb.PrepareTestContainer(t, "latest")
+	defer cleanup()
+
+	db := new()
+	defer dbtesting.AssertClose(t, db)
+
+	initReq := dbplugin.InitializeRequest{
+		Config: map[string]interface{}{
+			"connection_url": connURL,
+		},
+		VerifyConnection: true,
+	}
+	dbtesting.AssertInitialize(t, db, initReq)
+
+	subject := "CN=v-test-test-abc123"
+	createReq := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "test",
+			RoleName:    "test",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{mongoAdminRole},
+		},
+		CredentialType: dbplugin.CredentialTypeClientCertificate,
+		Subject:        subject,
+		Expiration:     time.Now().Add(time.Minute),
+	}
+	createResp := dbtesting.AssertNewUser(t, db, createReq)
+	if createResp.Username != subject {
+		t.Fatalf("Actual username: %q Expected username: %q", createResp.Username, subject)
+	}
+	assertExternalUserExists(t, db, subject, true)
+
+	dbtesting.AssertDeleteUser(t, db, dbplugin.DeleteUserRequest{
+		Username: createResp.Username,
+	})
+	assertExternalUserExists(t, db, subject, false)
+}
+
+func TestMongoDB_CreateUser_unsupportedCredentialType(t *testing.T) {
+	db := new()
+
+	createReq := dbplugin.NewUserRequest{
+		UsernameConfig: dbplugin.UsernameMetadata{
+			DisplayName: "test",
+			RoleName:    "test",
+		},
+		Statements: dbplugin.Statements{
+			Commands: []string{mongoAdminRole},
+		},
+		CredentialType: dbplugin.CredentialTypeRSAPrivateKey,
+		PublicKey:      []byte("-----BEGIN PUBLIC KEY-----"),
+		Expiration:     time.Now().Add(time.Minute),
+	}
+	_, err := db.NewUser(context.Background(), createReq)
+	if err == nil {
+		t.Fatalf("err expected, got nil")
+	}
+}
+
 func TestMongoDB_CreateUser_writeConcern(t *testing.T) {
 	cleanup, connURL := mongodb.PrepareTestContainer(t, "latest")
 	defer cleanup()
@@ -460,6 +521,26 @@ func assertCredsDoNotExist(t testing.TB, username, password, connURL string) {
 	t.Fatalf("User %q exists and was able to authenticate", username)
 }
 
+func assertExternalUserExists(t testing.TB, db *MongoDB, username string, expected bool) {
+	t.Helper()
+
+	client, err := db.Connection(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to connect to mongo: %s", err)
+	}
+
+	var result struct {
+		Users []interface{} `bson:"users"`
+	}
+	err = client.Database(externalDB).RunCommand(context.Background(), map[string]string{"usersInfo": username}).Decode(&result)
+	if err != nil {
+		t.Fatalf("Failed to look up user %q: %s", username, err)
+	}
+	if exists := len(result.Users) > 0; exists != expected {
+		t.Fatalf("Actual user %q exists: %t Expected: %t", username, exists, expected)
+	}
+}
+
 func copyConfig(config map[string]interface{}) map[string]interface{} {
 	newConfig := map[string]interface{}{}
 	for k, v := range config {
@@ -50,3 +50,16 @@ func (roles mongodbRoles) toStandardRolesArray() []interface{} {
 	}
 	return standardRolesArray
 }
+
+// toQualifiedRolesArray returns the roles with their database, defaulting
+// to the given database
+func (roles mongodbRoles) toQualifiedRolesArray(defaultDB string) []interface{} {
+	var qualifiedRolesArray []interface{}
+	for _, role := range roles {
+		if role.DB == "" {
+			role.DB = defaultDB
+		}
+		qualifiedRolesArray = append(qualifiedRolesArray, role)
+	}
+	return qualifiedRolesArray
+}
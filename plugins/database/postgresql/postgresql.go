@@ -99,7 +99,8 @@ func (p *PostgreSQL) Initialize(ctx context.Context, req dbplugin.InitializeRequ
 	}
 
 	resp := dbplugin.InitializeResponse{
-		Config: newConf,
+		Config:                   newConf,
+		SupportedCredentialTypes: []dbplugin.CredentialType{dbplugin.CredentialTypeClientCertificate},
 	}
 	return resp, nil
 }
@@ -121,9 +122,12 @@ func (p *PostgreSQL) UpdateUser(ctx context.Context, req dbplugin.UpdateUserRequ
 	if req.Username == "" {
 		return dbplugin.UpdateUserResponse{}, fmt.Errorf("missing username")
 	}
-	if req.Password == nil && req.Expiration == nil {
+	if req.Password == nil && req.PublicKey == nil && req.Expiration == nil {
 		return dbplugin.UpdateUserResponse{}, fmt.Errorf("no changes requested")
 	}
+	if req.PublicKey != nil {
+		return dbplugin.UpdateUserResponse{}, fmt.Errorf("the %s credential type is not supported", dbplugin.CredentialTypeRSAPrivateKey)
+	}
 
 	merr := &multierror.Error{}
 	if req.Password != nil {
@@ -247,7 +251,18 @@ func (p *PostgreSQL) NewUser(ctx context.Context, req dbplugin.NewUserRequest) (
 	p.Lock()
 	defer p.Unlock()
 
-	username, err := p.usernameProducer.Generate(req.UsernameConfig)
+	var username string
+	var err error
+	switch req.CredentialType {
+	case dbplugin.CredentialTypePassword:
+		username, err = p.usernameProducer.Generate(req.UsernameConfig)
+	case dbplugin.CredentialTypeClientCertificate:
+		// PostgreSQL maps client certificates to the role named by
+		// their common name
+		username, err = commonNameFromSubject(req.Subject)
+	default:
+		err = fmt.Errorf("the %s credential type is not supported", req.CredentialType)
+	}
 	if err != nil {
 		return dbplugin.NewUserResponse{}, err
 	}
@@ -470,6 +485,75 @@ func (p *PostgreSQL) secretValues() map[string]string {
 	}
 }
 
+// commonNameFromSubject returns the common name of the given RFC 2253
+// distinguished name
+func commonNameFromSubject(subject string) (string, error) {
+	var attr strings.Builder
+	var value strings.Builder
+	inValue := false
+
+	// flush returns the value of the current attribute if it is the
+	// common name, and resets the attribute
+	flush := func() (string, bool) {
+		defer func() {
+			attr.Reset()
+			value.Reset()
+			inValue = false
+		}()
+		if inValue && strings.EqualFold(strings.TrimSpace(attr.String()), "CN") {
+			return value.String(), true
+		}
+		return "", false
+	}
+
+	for i := 0; i < len(subject); i++ {
+		c := subject[i]
+		switch {
+		case c == '\\':
+			if i+1 >= len(subject) {
+				return "", fmt.Errorf("invalid subject %q: trailing escape", subject)
+			}
+			// Either a hex encoded byte or an escaped special character
+			if i+2 < len(subject) && isHex(subject[i+1]) && isHex(subject[i+2]) {
+				value.WriteByte(unhex(subject[i+1])<<4 | unhex(subject[i+2]))
+				i += 2
+			} else {
+				value.WriteByte(subject[i+1])
+				i++
+			}
+		case c == ',' || c == '+':
+			if cn, ok := flush(); ok {
+				return cn, nil
+			}
+		case c == '=' && !inValue:
+			inValue = true
+		case inValue:
+			value.WriteByte(c)
+		default:
+			attr.WriteByte(c)
+		}
+	}
+	if cn, ok := flush(); ok {
+		return cn, nil
+	}
+	return "", fmt.Errorf("subject %q has no common name", subject)
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
 // containsMultilineStatement is a best effort to determine whether
 // a particular statement is multiline, and therefore should not be
 // split upon semicolons. If it's unsure, it defaults to false.
@@ -745,6 +745,64 @@ func TestContainsMultilineStatement(t *testing.T) {
 	}
 }
 
+func TestCommonNameFromSubject(t *testing.T) {
+	type testCase struct {
+		Input     string
+		Expected  string
+		ExpectErr bool
+	}
+
+	testCases := map[string]*testCase{
+		"common name only": {
+			Input:    "CN=v-token-role-abc123",
+			Expected: "v-token-role-abc123",
+		},
+		"common name with other attributes": {
+			Input:    "CN=someuser,OU=databases,O=HashiCorp",
+			Expected: "someuser",
+		},
+		"common name last": {
+			Input:    "OU=databases,cn=someuser",
+			Expected: "someuser",
+		},
+		"escaped characters": {
+			Input:    `CN=some\,user\+name`,
+			Expected: "some,user+name",
+		},
+		"hex escaped characters": {
+			Input:    `CN=\20someuser`,
+			Expected: " someuser",
+		},
+		"multi-valued RDN": {
+			Input:    "OU=databases+CN=someuser",
+			Expected: "someuser",
+		},
+		"no common name": {
+			Input:     "OU=databases,O=HashiCorp",
+			ExpectErr: true,
+		},
+		"trailing escape": {
+			Input:     `CN=someuser\`,
+			ExpectErr: true,
+		},
+	}
+
+	for tName, tCase := range testCases {
+		t.Run(tName, func(t *testing.T) {
+			actual, err := commonNameFromSubject(tCase.Input)
+			if tCase.ExpectErr && err == nil {
+				t.Fatalf("err expected, got nil")
+			}
+			if !tCase.ExpectErr && err != nil {
+				t.Fatalf("no error expected, got: %s", err)
+			}
+			if actual != tCase.Expected {
+				t.Fatalf("Actual: %q Expected: %q", actual, tCase.Expected)
+			}
+		})
+	}
+}
+
 func TestExtractQuotedStrings(t *testing.T) {
 	type testCase struct {
 		Input    string
@@ -60,8 +60,11 @@ func TestConversionsHaveAllFields(t *testing.T) {
 					"rollback_statement",
 				},
 			},
-			Password:   "password",
-			Expiration: time.Now(),
+			CredentialType: CredentialTypeClientCertificate,
+			Password:       "password",
+			PublicKey:      []byte("-----BEGIN PUBLIC KEY-----"),
+			Subject:        "CN=username",
+			Expiration:     time.Now(),
 		}
 
 		protoReq, err := newUserReqToProto(req)
@@ -85,7 +88,16 @@ func TestConversionsHaveAllFields(t *testing.T) {
 
 	t.Run("updateUserReqToProto", func(t *testing.T) {
 		req := UpdateUserRequest{
-			Username: "username",
+			Username:       "username",
+			CredentialType: CredentialTypeRSAPrivateKey,
+			PublicKey: &ChangePublicKey{
+				NewPublicKey: []byte("-----BEGIN PUBLIC KEY-----"),
+				Statements: Statements{
+					Commands: []string{
+						"statement",
+					},
+				},
+			},
 			Password: &ChangePassword{
 				NewPassword: "newpassword",
 				Statements: Statements{
@@ -154,7 +166,16 @@ func TestConversionsHaveAllFields(t *testing.T) {
 
 	t.Run("getUpdateUserRequest", func(t *testing.T) {
 		req := &proto.UpdateUserRequest{
-			Username: "username",
+			Username:       "username",
+			CredentialType: int32(CredentialTypeRSAPrivateKey),
+			PublicKey: &proto.ChangePublicKey{
+				NewPublicKey: []byte("-----BEGIN PUBLIC KEY-----"),
+				Statements: &proto.Statements{
+					Commands: []string{
+						"statement",
+					},
+				},
+			},
 			Password: &proto.ChangePassword{
 				NewPassword: "newpass",
 				Statements: &proto.Statements{
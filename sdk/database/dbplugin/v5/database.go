@@ -69,6 +69,11 @@ type InitializeResponse struct {
 	// but should contain everything required to Initialize the database.
 	// REQUIRED in order to save the configuration into Vault after initialization
 	Config map[string]interface{}
+
+	// SupportedCredentialTypes lists the types of credentials that users can
+	// be created with, in addition to CredentialTypePassword which all
+	// plugins must support. Vault refuses roles with any other type.
+	SupportedCredentialTypes []CredentialType
 }
 
 // ///////////////////////////////////////////////////////
@@ -90,9 +95,25 @@ type NewUserRequest struct {
 	// if the new user creation process fails.
 	RollbackStatements Statements
 
-	// Password credentials to use when creating the user
+	// CredentialType is the type of credential to use when creating a user.
+	// The field of the request corresponding to the credential type contains
+	// the credential generated by Vault.
+	CredentialType CredentialType
+
+	// Password credentials to use when creating the user. Value is set when
+	// the credential type is CredentialTypePassword.
 	Password string
 
+	// PublicKey is the PEM-encoded public key of the RSA key pair generated by
+	// Vault, in PKIX format. Value is set when the credential type is
+	// CredentialTypeRSAPrivateKey.
+	PublicKey []byte
+
+	// Subject is the distinguished name of the client certificate issued by
+	// Vault, in RFC 2253 format. Value is set when the credential type is
+	// CredentialTypeClientCertificate.
+	Subject string
+
 	// Expiration of the user. Not all database plugins will support this.
 	Expiration time.Time
 }
@@ -118,10 +139,21 @@ type UpdateUserRequest struct {
 	// Username to make changes to.
 	Username string
 
+	// CredentialType is the type of credential to use when updating a user.
+	// The field of the request corresponding to the credential type contains
+	// the credential generated by Vault.
+	CredentialType CredentialType
+
 	// Password indicates the new password to change to.
+	// The value is set when the credential type is CredentialTypePassword.
 	// If nil, no change is requested.
 	Password *ChangePassword
 
+	// PublicKey indicates the new public key to change to.
+	// The value is set when the credential type is CredentialTypeRSAPrivateKey.
+	// If nil, no change is requested.
+	PublicKey *ChangePublicKey
+
 	// Expiration indicates the new expiration date to change to.
 	// If nil, no change is requested.
 	Expiration *ChangeExpiration
@@ -137,6 +169,17 @@ type ChangePassword struct {
 	Statements Statements
 }
 
+// ChangePublicKey of a given user
+type ChangePublicKey struct {
+	// NewPublicKey is the PEM-encoded public key of the RSA key pair, in
+	// PKIX format
+	NewPublicKey []byte
+
+	// Statements is an ordered list of commands to run within the database
+	// when changing the user's public key.
+	Statements Statements
+}
+
 // ChangeExpiration of a given user
 type ChangeExpiration struct {
 	// NewExpiration of the user
@@ -168,6 +211,28 @@ type DeleteUserResponse struct{}
 // Used across multiple functions
 // ///////////////////////////////////////////////////////
 
+// CredentialType is a type of database credential.
+type CredentialType int
+
+const (
+	CredentialTypePassword CredentialType = iota
+	CredentialTypeRSAPrivateKey
+	CredentialTypeClientCertificate
+)
+
+func (k CredentialType) String() string {
+	switch k {
+	case CredentialTypePassword:
+		return "password"
+	case CredentialTypeRSAPrivateKey:
+		return "rsa_private_key"
+	case CredentialTypeClientCertificate:
+		return "client_certificate"
+	default:
+		return "unknown"
+	}
+}
+
 // Statements wraps a collection of statements to run in a database when an
 // operation is performed (create, update, etc.). This is a struct rather than
 // a string slice so we can easily add more information to this in the future.
@@ -52,8 +52,14 @@ func initReqToProto(req InitializeRequest) (*proto.InitializeRequest, error) {
 func initRespFromProto(rpcResp *proto.InitializeResponse) (InitializeResponse, error) {
 	newConfig := structToMap(rpcResp.GetConfigData())
 
+	var credentialTypes []CredentialType
+	for _, credentialType := range rpcResp.GetSupportedCredentialTypes() {
+		credentialTypes = append(credentialTypes, CredentialType(credentialType))
+	}
+
 	resp := InitializeResponse{
-		Config: newConfig,
+		Config:                   newConfig,
+		SupportedCredentialTypes: credentialTypes,
 	}
 	return resp, nil
 }
@@ -81,8 +87,21 @@ func (c gRPCClient) NewUser(ctx context.Context, req NewUserRequest) (NewUserRes
 }
 
 func newUserReqToProto(req NewUserRequest) (*proto.NewUserRequest, error) {
-	if req.Password == "" {
-		return nil, fmt.Errorf("missing password")
+	switch req.CredentialType {
+	case CredentialTypePassword:
+		if req.Password == "" {
+			return nil, fmt.Errorf("missing password credential")
+		}
+	case CredentialTypeRSAPrivateKey:
+		if len(req.PublicKey) == 0 {
+			return nil, fmt.Errorf("missing public key credential")
+		}
+	case CredentialTypeClientCertificate:
+		if req.Subject == "" {
+			return nil, fmt.Errorf("missing certificate subject")
+		}
+	default:
+		return nil, fmt.Errorf("unknown credential type")
 	}
 
 	expiration, err := ptypes.TimestampProto(req.Expiration)
@@ -95,8 +114,11 @@ func newUserReqToProto(req NewUserRequest) (*proto.NewUserRequest, error) {
 			DisplayName: req.UsernameConfig.DisplayName,
 			RoleName:    req.UsernameConfig.RoleName,
 		},
-		Password:   req.Password,
-		Expiration: expiration,
+		CredentialType: int32(req.CredentialType),
+		Password:       req.Password,
+		PublicKey:      req.PublicKey,
+		Subject:        req.Subject,
+		Expiration:     expiration,
 		Statements: &proto.Statements{
 			Commands: req.Statements.Commands,
 		},
@@ -138,6 +160,7 @@ func updateUserReqToProto(req UpdateUserRequest) (*proto.UpdateUserRequest, erro
 	}
 
 	if (req.Password == nil || req.Password.NewPassword == "") &&
+		(req.PublicKey == nil || len(req.PublicKey.NewPublicKey) == 0) &&
 		(req.Expiration == nil || req.Expiration.NewExpiration.IsZero()) {
 		return nil, fmt.Errorf("missing changes")
 	}
@@ -157,10 +180,22 @@ func updateUserReqToProto(req UpdateUserRequest) (*proto.UpdateUserRequest, erro
 		}
 	}
 
+	var publicKey *proto.ChangePublicKey
+	if req.PublicKey != nil && len(req.PublicKey.NewPublicKey) > 0 {
+		publicKey = &proto.ChangePublicKey{
+			NewPublicKey: req.PublicKey.NewPublicKey,
+			Statements: &proto.Statements{
+				Commands: req.PublicKey.Statements.Commands,
+			},
+		}
+	}
+
 	rpcReq := &proto.UpdateUserRequest{
-		Username:   req.Username,
-		Password:   password,
-		Expiration: expiration,
+		Username:       req.Username,
+		CredentialType: int32(req.CredentialType),
+		Password:       password,
+		PublicKey:      publicKey,
+		Expiration:     expiration,
 	}
 	return rpcReq, nil
 }
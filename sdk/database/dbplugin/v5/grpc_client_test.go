@@ -63,6 +63,31 @@ func TestGRPCClient_Initialize(t *testing.T) {
 			},
 			assertErr: assertErrNil,
 		},
+		"supported credential types": {
+			client: fakeClient{
+				initResp: &proto.InitializeResponse{
+					ConfigData: marshal(t, map[string]interface{}{
+						"foo": "bar",
+					}),
+					SupportedCredentialTypes: []int32{1, 2},
+				},
+			},
+			req: InitializeRequest{
+				Config: map[string]interface{}{
+					"foo": "bar",
+				},
+			},
+			expectedResp: InitializeResponse{
+				Config: map[string]interface{}{
+					"foo": "bar",
+				},
+				SupportedCredentialTypes: []CredentialType{
+					CredentialTypeRSAPrivateKey,
+					CredentialTypeClientCertificate,
+				},
+			},
+			assertErr: assertErrNil,
+		},
 		"JSON number type in initialize request": {
 			client: fakeClient{
 				initResp: &proto.InitializeResponse{
@@ -131,6 +156,35 @@ func TestGRPCClient_NewUser(t *testing.T) {
 			doneCtx:   runningCtx,
 			assertErr: assertErrNotNil,
 		},
+		"missing public key": {
+			client: fakeClient{},
+			req: NewUserRequest{
+				CredentialType: CredentialTypeRSAPrivateKey,
+				Password:       "njkvcb8y934u90grsnkjl",
+				Expiration:     time.Now(),
+			},
+			doneCtx:   runningCtx,
+			assertErr: assertErrNotNil,
+		},
+		"missing subject": {
+			client: fakeClient{},
+			req: NewUserRequest{
+				CredentialType: CredentialTypeClientCertificate,
+				Expiration:     time.Now(),
+			},
+			doneCtx:   runningCtx,
+			assertErr: assertErrNotNil,
+		},
+		"unknown credential type": {
+			client: fakeClient{},
+			req: NewUserRequest{
+				CredentialType: CredentialType(42),
+				Password:       "njkvcb8y934u90grsnkjl",
+				Expiration:     time.Now(),
+			},
+			doneCtx:   runningCtx,
+			assertErr: assertErrNotNil,
+		},
 		"bad expiration": {
 			client: fakeClient{},
 			req: NewUserRequest{
@@ -178,6 +232,40 @@ func TestGRPCClient_NewUser(t *testing.T) {
 			},
 			assertErr: assertErrNil,
 		},
+		"happy path - rsa private key": {
+			client: fakeClient{
+				newUserResp: &proto.NewUserResponse{
+					Username: "new_user",
+				},
+			},
+			req: NewUserRequest{
+				CredentialType: CredentialTypeRSAPrivateKey,
+				PublicKey:      []byte("-----BEGIN PUBLIC KEY-----"),
+				Expiration:     time.Now(),
+			},
+			doneCtx: runningCtx,
+			expectedResp: NewUserResponse{
+				Username: "new_user",
+			},
+			assertErr: assertErrNil,
+		},
+		"happy path - client certificate": {
+			client: fakeClient{
+				newUserResp: &proto.NewUserResponse{
+					Username: "new_user",
+				},
+			},
+			req: NewUserRequest{
+				CredentialType: CredentialTypeClientCertificate,
+				Subject:        "CN=new_user",
+				Expiration:     time.Now(),
+			},
+			doneCtx: runningCtx,
+			expectedResp: NewUserResponse{
+				Username: "new_user",
+			},
+			assertErr: assertErrNil,
+		},
 	}
 
 	for name, test := range tests {
@@ -296,6 +384,18 @@ func TestGRPCClient_UpdateUser(t *testing.T) {
 			doneCtx:   runningCtx,
 			assertErr: assertErrNil,
 		},
+		"happy path - change public key": {
+			client: fakeClient{},
+			req: UpdateUserRequest{
+				Username:       "user",
+				CredentialType: CredentialTypeRSAPrivateKey,
+				PublicKey: &ChangePublicKey{
+					NewPublicKey: []byte("-----BEGIN PUBLIC KEY-----"),
+				},
+			},
+			doneCtx:   runningCtx,
+			assertErr: assertErrNil,
+		},
 		"happy path - change expiration": {
 			client: fakeClient{},
 			req: UpdateUserRequest{
@@ -38,8 +38,14 @@ func (g gRPCServer) Initialize(ctx context.Context, request *proto.InitializeReq
 		return &proto.InitializeResponse{}, status.Errorf(codes.Internal, "failed to marshal new config to JSON: %s", err)
 	}
 
+	var credentialTypes []int32
+	for _, credentialType := range dbResp.SupportedCredentialTypes {
+		credentialTypes = append(credentialTypes, int32(credentialType))
+	}
+
 	resp := &proto.InitializeResponse{
-		ConfigData: newConfig,
+		ConfigData:               newConfig,
+		SupportedCredentialTypes: credentialTypes,
 	}
 
 	return resp, nil
@@ -65,7 +71,10 @@ func (g gRPCServer) NewUser(ctx context.Context, req *proto.NewUserRequest) (*pr
 			DisplayName: req.GetUsernameConfig().GetDisplayName(),
 			RoleName:    req.GetUsernameConfig().GetRoleName(),
 		},
+		CredentialType:     CredentialType(req.GetCredentialType()),
 		Password:           req.GetPassword(),
+		PublicKey:          req.GetPublicKey(),
+		Subject:            req.GetSubject(),
 		Expiration:         expiration,
 		Statements:         getStatementsFromProto(req.GetStatements()),
 		RollbackStatements: getStatementsFromProto(req.GetRollbackStatements()),
@@ -108,6 +117,14 @@ func getUpdateUserRequest(req *proto.UpdateUserRequest) (UpdateUserRequest, erro
 		}
 	}
 
+	var publicKey *ChangePublicKey
+	if req.GetPublicKey() != nil && len(req.GetPublicKey().GetNewPublicKey()) > 0 {
+		publicKey = &ChangePublicKey{
+			NewPublicKey: req.GetPublicKey().GetNewPublicKey(),
+			Statements:   getStatementsFromProto(req.GetPublicKey().GetStatements()),
+		}
+	}
+
 	var expiration *ChangeExpiration
 	if req.GetExpiration() != nil && req.GetExpiration().GetNewExpiration() != nil {
 		newExpiration, err := ptypes.Timestamp(req.GetExpiration().GetNewExpiration())
@@ -122,9 +139,11 @@ func getUpdateUserRequest(req *proto.UpdateUserRequest) (UpdateUserRequest, erro
 	}
 
 	dbReq := UpdateUserRequest{
-		Username:   req.GetUsername(),
-		Password:   password,
-		Expiration: expiration,
+		Username:       req.GetUsername(),
+		CredentialType: CredentialType(req.GetCredentialType()),
+		Password:       password,
+		PublicKey:      publicKey,
+		Expiration:     expiration,
 	}
 
 	if !hasChange(dbReq) {
@@ -138,6 +157,9 @@ func hasChange(dbReq UpdateUserRequest) bool {
 	if dbReq.Password != nil && dbReq.Password.NewPassword != "" {
 		return true
 	}
+	if dbReq.PublicKey != nil && len(dbReq.PublicKey.NewPublicKey) > 0 {
+		return true
+	}
 	if dbReq.Expiration != nil && !dbReq.Expiration.NewExpiration.IsZero() {
 		return true
 	}
@@ -73,6 +73,31 @@ func TestGRPCServer_Initialize(t *testing.T) {
 			expectErr:  false,
 			expectCode: codes.OK,
 		},
+		"happy path with supported credential types": {
+			db: fakeDatabase{
+				initResp: InitializeResponse{
+					Config: map[string]interface{}{
+						"foo": "bar",
+					},
+					SupportedCredentialTypes: []CredentialType{
+						CredentialTypeRSAPrivateKey,
+					},
+				},
+			},
+			req: &proto.InitializeRequest{
+				ConfigData: marshal(t, map[string]interface{}{
+					"foo": "bar",
+				}),
+			},
+			expectedResp: &proto.InitializeResponse{
+				ConfigData: marshal(t, map[string]interface{}{
+					"foo": "bar",
+				}),
+				SupportedCredentialTypes: []int32{1},
+			},
+			expectErr:  false,
+			expectCode: codes.OK,
+		},
 	}
 
 	for name, test := range tests {
@@ -230,6 +255,27 @@ func TestGRPCServer_NewUser(t *testing.T) {
 			expectErr:  false,
 			expectCode: codes.OK,
 		},
+		"happy path with client certificate": {
+			db: fakeDatabase{
+				newUserResp: NewUserResponse{
+					Username: "someuser_foo",
+				},
+			},
+			req: &proto.NewUserRequest{
+				UsernameConfig: &proto.UsernameConfig{
+					DisplayName: "dispname",
+					RoleName:    "rolename",
+				},
+				CredentialType: int32(CredentialTypeClientCertificate),
+				Subject:        "CN=someuser_foo",
+				Expiration:     ptypes.TimestampNow(),
+			},
+			expectedResp: &proto.NewUserResponse{
+				Username: "someuser_foo",
+			},
+			expectErr:  false,
+			expectCode: codes.OK,
+		},
 		"happy path without expiration": {
 			db: fakeDatabase{
 				newUserResp: NewUserResponse{
@@ -346,6 +392,19 @@ func TestGRPCServer_UpdateUser(t *testing.T) {
 			expectErr:    false,
 			expectCode:   codes.OK,
 		},
+		"change public key happy path": {
+			db: fakeDatabase{},
+			req: &proto.UpdateUserRequest{
+				Username:       "someuser",
+				CredentialType: int32(CredentialTypeRSAPrivateKey),
+				PublicKey: &proto.ChangePublicKey{
+					NewPublicKey: []byte("-----BEGIN PUBLIC KEY-----"),
+				},
+			},
+			expectedResp: &proto.UpdateUserResponse{},
+			expectErr:    false,
+			expectCode:   codes.OK,
+		},
 		"change expiration happy path": {
 			db: fakeDatabase{},
 			req: &proto.UpdateUserRequest{
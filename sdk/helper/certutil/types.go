@@ -19,6 +19,7 @@ import (
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"math/big"
 	"net"
 	"net/url"
@@ -635,6 +636,10 @@ type URLEntries struct {
 	IssuingCertificates   []string `json:"issuing_certificates" structs:"issuing_certificates" mapstructure:"issuing_certificates"`
 	CRLDistributionPoints []string `json:"crl_distribution_points" structs:"crl_distribution_points" mapstructure:"crl_distribution_points"`
 	OCSPServers           []string `json:"ocsp_servers" structs:"ocsp_servers" mapstructure:"ocsp_servers"`
+
+	// DeltaCRLDistributionPoints are not placed in certificates; they are
+	// advertised through the Freshest CRL extension of complete CRLs.
+	DeltaCRLDistributionPoints []string `json:"delta_crl_distribution_points" structs:"delta_crl_distribution_points" mapstructure:"delta_crl_distribution_points"`
 }
 
 type CAInfoBundle struct {
@@ -663,6 +668,11 @@ func (b *CAInfoBundle) GetCAChain() []*CertBlock {
 	return chain
 }
 
+// KeyGenerator populates container with the private key used when creating
+// a certificate or CSR. The key may be generated for the occasion or be an
+// existing, possibly externally held, crypto.Signer.
+type KeyGenerator func(keyType string, keyBits int, container ParsedPrivateKeyContainer, entropyReader io.Reader) error
+
 type CertExtKeyUsage int
 
 const (
@@ -9,7 +9,11 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"hash"
+	"io"
 	"math"
+
+	"golang.org/x/crypto/hkdf"
 )
 
 // PRF is a pseudo-random function that takes a key or seed,
@@ -80,3 +84,53 @@ func HMACSHA256PRF(key []byte, data []byte) ([]byte, error) {
 	hash.Write(data)
 	return hash.Sum(nil), nil
 }
+
+// HKDF implements the HMAC-based extract-and-expand KDF of RFC 5869 using the
+// given hash function. The KDF takes a base key, an optional salt and
+// context-specific info, and the required number of output bits, which may
+// be at most 255 times the output size of the hash function.
+func HKDF(h func() hash.Hash, key, salt, info []byte, bits uint32) ([]byte, error) {
+	// Ensure the bits required are byte aligned
+	if bits%8 != 0 {
+		return nil, fmt.Errorf("bits required must be byte aligned")
+	}
+
+	if maxBytes := 255 * h().Size(); bits/8 > uint32(maxBytes) {
+		return nil, fmt.Errorf("too many bits required; at most %d bits can be derived", maxBytes*8)
+	}
+
+	out := make([]byte, bits/8)
+	if _, err := io.ReadFull(hkdf.New(h, key, salt, info), out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// X963 implements the KDF of ANSI X9.63 (SEC 1, section 3.6.1) using the
+// given hash function, as used to derive keys from ECDH shared secrets. The
+// KDF takes a shared secret, optional shared info, and the required number
+// of output bits.
+func X963(h func() hash.Hash, z, sharedInfo []byte, bits uint32) ([]byte, error) {
+	// Ensure the bits required are byte aligned
+	if bits%8 != 0 {
+		return nil, fmt.Errorf("bits required must be byte aligned")
+	}
+
+	hashFn := h()
+	rounds := (bits/8 + uint32(hashFn.Size()) - 1) / uint32(hashFn.Size())
+
+	// The counter starts at one
+	var out []byte
+	counter := make([]byte, 4)
+	for i := uint32(1); i <= rounds; i++ {
+		binary.BigEndian.PutUint32(counter, i)
+		hashFn.Reset()
+		hashFn.Write(z)
+		hashFn.Write(counter)
+		hashFn.Write(sharedInfo)
+		out = hashFn.Sum(out)
+	}
+
+	return out[:bits/8], nil
+}
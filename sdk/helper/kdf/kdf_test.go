@@ -2,6 +2,8 @@ package kdf
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"testing"
 )
 
@@ -73,3 +75,53 @@ func TestHMACSHA256PRF(t *testing.T) {
 		t.Fatalf("mis-matched output")
 	}
 }
+
+func TestHKDF(t *testing.T) {
+	// Test case 1 of RFC 5869
+	key, _ := hex.DecodeString("0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b")
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	expect, _ := hex.DecodeString("3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865")
+
+	out, err := HKDF(sha256.New, key, salt, info, uint32(len(expect)*8))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(out, expect) {
+		t.Fatalf("mis-match: %x", out)
+	}
+
+	if _, err := HKDF(sha256.New, key, salt, info, 12); err == nil {
+		t.Fatal("expected error for unaligned length")
+	}
+	if _, err := HKDF(sha256.New, key, salt, info, 256*32*8); err == nil {
+		t.Fatal("expected error for excessive length")
+	}
+}
+
+func TestX963(t *testing.T) {
+	// From the ANSI X9.63 SHA-256 test vectors of NIST CAVS
+	z, _ := hex.DecodeString("96c05619d56c328ab95fe84b18264b08725b85e33fd34f08")
+	expect, _ := hex.DecodeString("443024c3dae66b95e6f5670601558f71")
+
+	out, err := X963(sha256.New, z, nil, uint32(len(expect)*8))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(out, expect) {
+		t.Fatalf("mis-match: %x", out)
+	}
+
+	// Longer output extends shorter output
+	long, err := X963(sha256.New, z, nil, 80*8)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(long) != 80 || !bytes.Equal(long[:len(expect)], expect) {
+		t.Fatalf("mis-match: %x", long)
+	}
+
+	if _, err := X963(sha256.New, z, nil, 12); err == nil {
+		t.Fatal("expected error for unaligned length")
+	}
+}
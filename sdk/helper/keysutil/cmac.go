@@ -0,0 +1,77 @@
+package keysutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+)
+
+// cmacRb is the constant used to generate CMAC subkeys for 128-bit block
+// ciphers
+const cmacRb = 0x87
+
+// CMAC computes the AES-CMAC (NIST SP 800-38B, RFC 4493) of the message
+// with the given AES key.
+func CMAC(key, message []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	k1, k2 := cmacSubkeys(block)
+
+	n := (len(message) + aes.BlockSize - 1) / aes.BlockSize
+	complete := n > 0 && len(message)%aes.BlockSize == 0
+	if n == 0 {
+		n = 1
+	}
+
+	// The last block is padded if incomplete, and masked with a subkey
+	last := make([]byte, aes.BlockSize)
+	lastStart := (n - 1) * aes.BlockSize
+	if complete {
+		cmacXor(last, message[lastStart:], k1)
+	} else {
+		copy(last, message[lastStart:])
+		last[len(message)-lastStart] = 0x80
+		cmacXor(last, last, k2)
+	}
+
+	x := make([]byte, aes.BlockSize)
+	for i := 0; i < n-1; i++ {
+		cmacXor(x, x, message[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		block.Encrypt(x, x)
+	}
+	cmacXor(x, x, last)
+	block.Encrypt(x, x)
+
+	return x, nil
+}
+
+func cmacSubkeys(block cipher.Block) ([]byte, []byte) {
+	l := make([]byte, aes.BlockSize)
+	block.Encrypt(l, l)
+
+	k1 := cmacDouble(l)
+	k2 := cmacDouble(k1)
+	return k1, k2
+}
+
+// cmacDouble multiplies the block by x in GF(2^128)
+func cmacDouble(in []byte) []byte {
+	out := make([]byte, len(in))
+	var carry byte
+	for i := len(in) - 1; i >= 0; i-- {
+		out[i] = in[i]<<1 | carry
+		carry = in[i] >> 7
+	}
+	// Reduce without branching on the key-dependent carry
+	out[len(out)-1] ^= cmacRb & (0 - carry)
+	return out
+}
+
+// cmacXor sets dst to the XOR of the first len(dst) bytes of a and b
+func cmacXor(dst, a, b []byte) {
+	for i := range dst {
+		dst[i] = a[i] ^ b[i]
+	}
+}
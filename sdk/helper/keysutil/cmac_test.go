@@ -0,0 +1,39 @@
+package keysutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestCMAC(t *testing.T) {
+	// Test vectors from RFC 4493
+	key, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	message, _ := hex.DecodeString("6bc1bee22e409f96e93d7e117393172a" +
+		"ae2d8a571e03ac9c9eb76fac45af8e51" +
+		"30c81c46a35ce411e5fbc1191a0a52ef" +
+		"f69f2445df4f9b17ad2b417be66c3710")
+
+	for _, tc := range []struct {
+		length int
+		mac    string
+	}{
+		{0, "bb1d6929e95937287fa37d129b756746"},
+		{16, "070a16b46b4d4144f79bdd9dd04a287c"},
+		{40, "dfa66747de9ae63030ca32611497c827"},
+		{64, "51f0bebf7e3b9d92fc49741779363cfe"},
+	} {
+		expected, _ := hex.DecodeString(tc.mac)
+		mac, err := CMAC(key, message[:tc.length])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(mac, expected) {
+			t.Fatalf("length %d: expected %x, got %x", tc.length, expected, mac)
+		}
+	}
+
+	if _, err := CMAC([]byte("short"), message); err == nil {
+		t.Fatal("expected error with an invalid key size")
+	}
+}
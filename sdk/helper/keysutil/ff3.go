@@ -0,0 +1,193 @@
+package keysutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"math/big"
+
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+)
+
+const (
+	// FF3TweakSize is the size in bytes of an FF3-1 tweak
+	FF3TweakSize = 7
+
+	// ff3MaxRadix is the largest radix supported by FF3-1
+	ff3MaxRadix = 1 << 16
+
+	// ff3MinDomainSize is the smallest number of possible inputs FF3-1
+	// allows, that is radix^minlen
+	ff3MinDomainSize = 1000000
+)
+
+// ff3Cipher implements the FF3-1 format-preserving encryption mode of NIST SP
+// 800-38G Revision 1 for numeral strings of a given radix.
+type ff3Cipher struct {
+	block  cipher.Block
+	radix  *big.Int
+	minLen int
+	maxLen int
+}
+
+func newFF3Cipher(key []byte, radix int) (*ff3Cipher, error) {
+	if radix < 2 || radix > ff3MaxRadix {
+		return nil, errutil.UserError{Err: fmt.Sprintf("radix must be between 2 and %d", ff3MaxRadix)}
+	}
+
+	// FF3-1 uses the byte-reversed key with the block cipher
+	revKey := make([]byte, len(key))
+	for i := range key {
+		revKey[i] = key[len(key)-1-i]
+	}
+	block, err := aes.NewCipher(revKey)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("error creating cipher: %v", err)}
+	}
+
+	c := &ff3Cipher{
+		block: block,
+		radix: big.NewInt(int64(radix)),
+	}
+
+	// minlen is the smallest length with radix^minlen >= 1,000,000 and
+	// maxlen is 2 * floor(log_radix(2^96))
+	domain := big.NewInt(1)
+	minDomain := big.NewInt(ff3MinDomainSize)
+	for domain.Cmp(minDomain) < 0 {
+		domain.Mul(domain, c.radix)
+		c.minLen++
+	}
+	domain.SetInt64(1)
+	maxHalfDomain := new(big.Int).Lsh(big.NewInt(1), 96)
+	halfLen := 0
+	for {
+		domain.Mul(domain, c.radix)
+		if domain.Cmp(maxHalfDomain) > 0 {
+			break
+		}
+		halfLen++
+	}
+	c.maxLen = 2 * halfLen
+	if c.minLen < 2 {
+		c.minLen = 2
+	}
+
+	return c, nil
+}
+
+// Encrypt encrypts the numeral string x under the 56-bit tweak
+func (c *ff3Cipher) Encrypt(x []int, tweak []byte) ([]int, error) {
+	return c.crypt(x, tweak, false)
+}
+
+// Decrypt decrypts the numeral string x under the 56-bit tweak
+func (c *ff3Cipher) Decrypt(x []int, tweak []byte) ([]int, error) {
+	return c.crypt(x, tweak, true)
+}
+
+func (c *ff3Cipher) crypt(x []int, tweak []byte, decrypt bool) ([]int, error) {
+	if len(tweak) != FF3TweakSize {
+		return nil, errutil.UserError{Err: fmt.Sprintf("tweak must be %d bytes", FF3TweakSize)}
+	}
+
+	// The 56-bit tweak is split into two 28-bit halves, each padded with
+	// four zero bits
+	tl := []byte{tweak[0], tweak[1], tweak[2], tweak[3] & 0xf0}
+	tr := []byte{tweak[4], tweak[5], tweak[6], tweak[3] << 4}
+
+	return c.cryptWithTweak(x, tl, tr, decrypt)
+}
+
+// cryptWithTweak runs the FF3 Feistel network with the given 32-bit tweak
+// halves
+func (c *ff3Cipher) cryptWithTweak(x []int, tl, tr []byte, decrypt bool) ([]int, error) {
+	n := len(x)
+	if n < c.minLen || n > c.maxLen {
+		return nil, errutil.UserError{Err: fmt.Sprintf("input must be between %d and %d characters long", c.minLen, c.maxLen)}
+	}
+	radix := int(c.radix.Int64())
+	for _, numeral := range x {
+		if numeral < 0 || numeral >= radix {
+			return nil, errutil.UserError{Err: "input contains a numeral outside of the radix"}
+		}
+	}
+
+	u := (n + 1) / 2
+	v := n - u
+	a := append([]int(nil), x[:u]...)
+	b := append([]int(nil), x[u:]...)
+
+	var p, s [aes.BlockSize]byte
+	y := new(big.Int)
+	modulus := new(big.Int)
+	for round := 0; round < 8; round++ {
+		i := round
+		if decrypt {
+			i = 7 - round
+		}
+
+		m, w := u, tr
+		if i%2 == 1 {
+			m, w = v, tl
+		}
+
+		// P = W xor [i]^4 || [NUM_radix(REV(B))]^12, with A in place of B
+		// when decrypting
+		src := b
+		if decrypt {
+			src = a
+		}
+		copy(p[:4], w)
+		p[3] ^= byte(i)
+		c.num(src).FillBytes(p[4:])
+
+		// S = REVB(CIPH_REVB(K)(REVB(P)))
+		reverseBytes(p[:])
+		c.block.Encrypt(s[:], p[:])
+		reverseBytes(s[:])
+		y.SetBytes(s[:])
+
+		modulus.Exp(c.radix, big.NewInt(int64(m)), nil)
+		if decrypt {
+			num := c.num(b)
+			num.Sub(num, y).Mod(num, modulus)
+			a, b = c.str(num, m), a
+		} else {
+			num := c.num(a)
+			num.Add(num, y).Mod(num, modulus)
+			a, b = b, c.str(num, m)
+		}
+	}
+
+	return append(a, b...), nil
+}
+
+// num returns NUM_radix(REV(x)), treating x as least significant numeral
+// first
+func (c *ff3Cipher) num(x []int) *big.Int {
+	ret := new(big.Int)
+	for i := len(x) - 1; i >= 0; i-- {
+		ret.Mul(ret, c.radix)
+		ret.Add(ret, big.NewInt(int64(x[i])))
+	}
+	return ret
+}
+
+// str returns REV(STR^m_radix(num)), least significant numeral first
+func (c *ff3Cipher) str(num *big.Int, m int) []int {
+	ret := make([]int, m)
+	num = new(big.Int).Set(num)
+	rem := new(big.Int)
+	for i := 0; i < m; i++ {
+		num.QuoRem(num, c.radix, rem)
+		ret[i] = int(rem.Int64())
+	}
+	return ret
+}
+
+func reverseBytes(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
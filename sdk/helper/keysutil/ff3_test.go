@@ -0,0 +1,157 @@
+package keysutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func decodeNumerals(s string) []int {
+	ret := make([]int, len(s))
+	for i, r := range s {
+		ret[i] = int(r - '0')
+	}
+	return ret
+}
+
+func TestFF3Cipher(t *testing.T) {
+	// Sample vectors for FF3, with a 64-bit tweak, and for FF3-1
+	tests := []struct {
+		key        string
+		tweak      string
+		plaintext  string
+		ciphertext string
+	}{
+		{
+			key:        "EF4359D8D580AA4F7F036D6F04FC6A94",
+			tweak:      "D8E7920AFA330A73",
+			plaintext:  "890121234567890000",
+			ciphertext: "750918814058654607",
+		},
+		{
+			key:        "EF4359D8D580AA4F7F036D6F04FC6A94",
+			tweak:      "9A768A92F60E12D8",
+			plaintext:  "890121234567890000",
+			ciphertext: "018989839189395384",
+		},
+		{
+			key:        "EF4359D8D580AA4F7F036D6F04FC6A942B7E151628AED2A6ABF7158809CF4F3C",
+			tweak:      "D8E7920AFA330A73",
+			plaintext:  "890121234567890000",
+			ciphertext: "922011205562777495",
+		},
+		{
+			key:        "2DE79D232DF5585D68CE47882AE256D6",
+			tweak:      "CBD09280979564",
+			plaintext:  "3992520240",
+			ciphertext: "8901801106",
+		},
+	}
+
+	for _, tc := range tests {
+		key, _ := hex.DecodeString(tc.key)
+		tweak, _ := hex.DecodeString(tc.tweak)
+		c, err := newFF3Cipher(key, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		plaintext := decodeNumerals(tc.plaintext)
+		expected := decodeNumerals(tc.ciphertext)
+
+		var ciphertext, decrypted []int
+		if len(tweak) == FF3TweakSize {
+			ciphertext, err = c.Encrypt(plaintext, tweak)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decrypted, err = c.Decrypt(ciphertext, tweak)
+		} else {
+			ciphertext, err = c.cryptWithTweak(plaintext, tweak[:4], tweak[4:], false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decrypted, err = c.cryptWithTweak(ciphertext, tweak[:4], tweak[4:], true)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ciphertext, expected) {
+			t.Fatalf("bad ciphertext for %s: expected %v, got %v", tc.plaintext, expected, ciphertext)
+		}
+		if !reflect.DeepEqual(decrypted, plaintext) {
+			t.Fatalf("bad decryption of %s: got %v", tc.ciphertext, decrypted)
+		}
+	}
+}
+
+func TestPolicy_FPE(t *testing.T) {
+	lm, _ := NewLockManager(true, 0)
+	p, _, err := lm.GetPolicy(context.Background(), PolicyRequest{
+		Upsert:  true,
+		Storage: &logical.InmemStorage{},
+		KeyType: KeyType_FF3_1,
+		Name:    "fpe",
+	}, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alphabet := []rune("0123456789")
+	tweak := []byte("tweak56")
+	value := "4111111111111111"
+
+	encoded, err := p.EncodeFPE(0, nil, tweak, alphabet, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encoded) != len(value) || encoded == value {
+		t.Fatalf("bad encoded value %q", encoded)
+	}
+	for _, r := range encoded {
+		if r < '0' || r > '9' {
+			t.Fatalf("encoded value %q is not numeric", encoded)
+		}
+	}
+	decoded, err := p.DecodeFPE(1, nil, tweak, alphabet, encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != value {
+		t.Fatalf("expected %q, got %q", value, decoded)
+	}
+
+	// Tokens are deterministic and differ from encoded values
+	token, err := p.Tokenize(0, nil, alphabet, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token2, err := p.Tokenize(0, nil, alphabet, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != token2 {
+		t.Fatalf("tokens are not deterministic: %q, %q", token, token2)
+	}
+	if token == encoded || len(token) != len(value) {
+		t.Fatalf("bad token %q", token)
+	}
+	detokenized, err := p.Detokenize(0, nil, alphabet, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detokenized != value {
+		t.Fatalf("expected %q, got %q", value, detokenized)
+	}
+
+	if _, err := p.EncodeFPE(0, nil, tweak, alphabet, "12345"); err == nil {
+		t.Fatal("expected error encoding a value that is too short")
+	}
+	if _, err := p.EncodeFPE(0, nil, tweak, alphabet, "4111-1111-1111-1111"); err == nil {
+		t.Fatal("expected error encoding a value outside of the alphabet")
+	}
+}
@@ -0,0 +1,175 @@
+package keysutil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+)
+
+// tokenizationTweakLabel is used to derive the tweak of tokenization, so
+// that tokens differ from the values encoded with the same key
+const tokenizationTweakLabel = "transit tokenization"
+
+// FPESupported returns whether the key type supports format-preserving
+// encryption and tokenization.
+func (kt KeyType) FPESupported() bool {
+	return kt == KeyType_FF3_1
+}
+
+// EncodeFPE encrypts value with FF3-1 under the given tweak. Every character
+// of value must be in alphabet, and so is every character of the result,
+// which has the same length as value. As for convergent encryption, the same
+// key version, context, tweak and value always give the same result.
+func (p *Policy) EncodeFPE(ver int, context, tweak []byte, alphabet []rune, value string) (string, error) {
+	switch {
+	case ver == 0:
+		ver = p.LatestVersion
+	case ver < 0:
+		return "", errutil.UserError{Err: "requested version for encryption is negative"}
+	case ver > p.LatestVersion:
+		return "", errutil.UserError{Err: "requested version for encryption is higher than the latest key version"}
+	case ver < p.MinEncryptionVersion:
+		return "", errutil.UserError{Err: "requested version for encryption is less than the minimum encryption key version"}
+	}
+
+	ret, err := p.cryptFPE(ver, context, tweak, alphabet, value, false)
+	if err != nil {
+		return "", err
+	}
+
+	p.recordUsage(ver)
+
+	return ret, nil
+}
+
+// DecodeFPE reverses EncodeFPE.
+func (p *Policy) DecodeFPE(ver int, context, tweak []byte, alphabet []rune, value string) (string, error) {
+	switch {
+	case ver == 0:
+		ver = p.LatestVersion
+	case ver < 0 || ver > p.LatestVersion:
+		return "", errutil.UserError{Err: "invalid key version"}
+	case ver < p.MinDecryptionVersion:
+		return "", errutil.UserError{Err: ErrTooOld}
+	}
+
+	ret, err := p.cryptFPE(ver, context, tweak, alphabet, value, true)
+	if err != nil {
+		return "", err
+	}
+
+	p.recordUsage(ver)
+
+	return ret, nil
+}
+
+// Tokenize returns the deterministic token of value. Tokens are encrypted
+// like EncodeFPE does, under a tweak derived from the key version rather
+// than a caller-supplied one.
+func (p *Policy) Tokenize(ver int, context []byte, alphabet []rune, value string) (string, error) {
+	if ver == 0 {
+		ver = p.LatestVersion
+	}
+	tweak, err := p.tokenizationTweak(ver)
+	if err != nil {
+		return "", err
+	}
+
+	return p.EncodeFPE(ver, context, tweak, alphabet, value)
+}
+
+// Detokenize returns the value of a token returned by Tokenize.
+func (p *Policy) Detokenize(ver int, context []byte, alphabet []rune, token string) (string, error) {
+	if ver == 0 {
+		ver = p.LatestVersion
+	}
+	tweak, err := p.tokenizationTweak(ver)
+	if err != nil {
+		return "", err
+	}
+
+	return p.DecodeFPE(ver, context, tweak, alphabet, token)
+}
+
+// TokenHash returns a hex-encoded keyed hash of the token, suitable for
+// referring to a token in storage without revealing it.
+func (p *Policy) TokenHash(ver int, token string) (string, error) {
+	keyEntry, err := p.safeGetKeyEntry(ver)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, keyEntry.HMACKey)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (p *Policy) tokenizationTweak(ver int) ([]byte, error) {
+	if ver < 0 || ver > p.LatestVersion {
+		return nil, errutil.UserError{Err: "invalid key version"}
+	}
+	keyEntry, err := p.safeGetKeyEntry(ver)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, keyEntry.HMACKey)
+	mac.Write([]byte(tokenizationTweakLabel))
+	return mac.Sum(nil)[:FF3TweakSize], nil
+}
+
+func (p *Policy) cryptFPE(ver int, context, tweak []byte, alphabet []rune, value string, decrypt bool) (string, error) {
+	if !p.Type.FPESupported() {
+		return "", errutil.UserError{Err: fmt.Sprintf("format-preserving encryption not supported for key type %v", p.Type)}
+	}
+
+	if len(tweak) == 0 {
+		tweak = make([]byte, FF3TweakSize)
+	}
+
+	indexes := make(map[rune]int, len(alphabet))
+	for i, r := range alphabet {
+		if _, ok := indexes[r]; ok {
+			return "", errutil.UserError{Err: fmt.Sprintf("alphabet contains duplicate character %q", r)}
+		}
+		indexes[r] = i
+	}
+
+	valueRunes := []rune(value)
+	numerals := make([]int, len(valueRunes))
+	for i, r := range valueRunes {
+		numeral, ok := indexes[r]
+		if !ok {
+			return "", errutil.UserError{Err: fmt.Sprintf("input contains character %q which is not in the alphabet", r)}
+		}
+		numerals[i] = numeral
+	}
+
+	key, err := p.GetKey(context, ver, 32)
+	if err != nil {
+		return "", err
+	}
+	c, err := newFF3Cipher(key, len(alphabet))
+	if err != nil {
+		return "", err
+	}
+
+	if decrypt {
+		numerals, err = c.Decrypt(numerals, tweak)
+	} else {
+		numerals, err = c.Encrypt(numerals, tweak)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	ret := make([]rune, len(numerals))
+	for i, numeral := range numerals {
+		ret[i] = alphabet[numeral]
+	}
+
+	return string(ret), nil
+}
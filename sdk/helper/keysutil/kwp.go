@@ -0,0 +1,122 @@
+package keysutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// kwpAIVPrefix is the constant half of the alternative initial value defined
+// by RFC 5649; the other half holds the length of the plaintext.
+var kwpAIVPrefix = []byte{0xA6, 0x59, 0x59, 0xA6}
+
+var errKWPUnwrapFailed = errors.New("failed to unwrap key: integrity check failed")
+
+// WrapKeyWithPadding wraps the given key with the key-encryption key kek
+// using AES Key Wrap with Padding (KWP) as defined by RFC 5649.
+func WrapKeyWithPadding(kek, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) == 0 || uint64(len(key)) > math.MaxUint32 {
+		return nil, errors.New("invalid length of key to wrap")
+	}
+
+	paddedLen := (len(key) + 7) / 8 * 8
+	out := make([]byte, 8+paddedLen)
+	copy(out, kwpAIVPrefix)
+	binary.BigEndian.PutUint32(out[4:8], uint32(len(key)))
+	copy(out[8:], key)
+
+	// A single block is encrypted directly rather than with the wrapping
+	// rounds of RFC 3394
+	if paddedLen == 8 {
+		block.Encrypt(out, out)
+		return out, nil
+	}
+
+	wrapBlocks(block, out)
+	return out, nil
+}
+
+// UnwrapKeyWithPadding unwraps a key wrapped with the key-encryption key kek
+// using AES Key Wrap with Padding (KWP) as defined by RFC 5649.
+func UnwrapKeyWithPadding(kek, wrapped []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < 16 || len(wrapped)%8 != 0 {
+		return nil, errors.New("invalid length of wrapped key")
+	}
+
+	out := make([]byte, len(wrapped))
+	copy(out, wrapped)
+	if len(out) == 16 {
+		block.Decrypt(out, out)
+	} else {
+		unwrapBlocks(block, out)
+	}
+
+	if subtle.ConstantTimeCompare(out[:4], kwpAIVPrefix) != 1 {
+		return nil, errKWPUnwrapFailed
+	}
+	paddedLen := len(out) - 8
+	keyLen := int(binary.BigEndian.Uint32(out[4:8]))
+	if keyLen <= paddedLen-8 || keyLen > paddedLen {
+		return nil, errKWPUnwrapFailed
+	}
+	for _, b := range out[8+keyLen:] {
+		if b != 0 {
+			return nil, errKWPUnwrapFailed
+		}
+	}
+
+	return out[8 : 8+keyLen], nil
+}
+
+// wrapBlocks applies the wrapping process of RFC 3394 in place to buf, which
+// holds the initial value followed by the 64-bit plaintext blocks.
+func wrapBlocks(block cipher.Block, buf []byte) {
+	n := len(buf)/8 - 1
+	b := make([]byte, 16)
+	copy(b[:8], buf[:8])
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b[8:], buf[i*8:(i+1)*8])
+			block.Encrypt(b, b)
+			xorCounter(b[:8], uint64(n*j+i))
+			copy(buf[i*8:(i+1)*8], b[8:])
+		}
+	}
+	copy(buf[:8], b[:8])
+}
+
+// unwrapBlocks applies the unwrapping process of RFC 3394 in place to buf,
+// which holds the 64-bit ciphertext blocks.
+func unwrapBlocks(block cipher.Block, buf []byte) {
+	n := len(buf)/8 - 1
+	b := make([]byte, 16)
+	copy(b[:8], buf[:8])
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			xorCounter(b[:8], uint64(n*j+i))
+			copy(b[8:], buf[i*8:(i+1)*8])
+			block.Decrypt(b, b)
+			copy(buf[i*8:(i+1)*8], b[8:])
+		}
+	}
+	copy(buf[:8], b[:8])
+}
+
+func xorCounter(a []byte, t uint64) {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], t)
+	for i := range a {
+		a[i] ^= counter[i]
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/helper/jsonutil"
 	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -50,12 +51,26 @@ type PolicyRequest struct {
 
 	// Whether to allow plaintext backup
 	AllowPlaintextBackup bool
+
+	// Whether to allow export wrapped to a public key
+	AllowWrappedExport bool
+
+	// Whether to record the tokens issued by the key in a token store
+	TokenStore bool
+
+	// Whether to allow rotation of an imported key; only used on import
+	AllowImportedKeyRotation bool
 }
 
 type LockManager struct {
 	useCache bool
 	cache    Cache
 	keyLocks []*locksutil.LockEntry
+
+	// usage holds the usage trackers of policies, by name. They are kept
+	// outside of the policies so that usage survives cache evictions and is
+	// tracked when caching is disabled.
+	usage sync.Map
 }
 
 func NewLockManager(useCache bool, cacheSize int) (*LockManager, error) {
@@ -214,6 +229,10 @@ func (lm *LockManager) RestorePolicy(ctx context.Context, storage logical.Storag
 
 	keyData.Policy.l = new(sync.RWMutex)
 
+	if err := lm.attachUsage(ctx, storage, keyData.Policy); err != nil {
+		return err
+	}
+
 	// Update the cache to contain the restored policy
 	if lm.useCache {
 		lm.cache.Store(name, keyData.Policy)
@@ -343,57 +362,12 @@ func (lm *LockManager) GetPolicy(ctx context.Context, req PolicyRequest, rand io
 		// to the user to let them know that their request can't be satisfied
 		// because we don't know if the parameters match.
 
-		switch req.KeyType {
-		case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
-			if req.Convergent && !req.Derived {
-				cleanup()
-				return nil, false, fmt.Errorf("convergent encryption requires derivation to be enabled")
-			}
-
-		case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521:
-			if req.Derived || req.Convergent {
-				cleanup()
-				return nil, false, fmt.Errorf("key derivation and convergent encryption not supported for keys of type %v", req.KeyType)
-			}
-
-		case KeyType_ED25519:
-			if req.Convergent {
-				cleanup()
-				return nil, false, fmt.Errorf("convergent encryption not supported for keys of type %v", req.KeyType)
-			}
-
-		case KeyType_RSA2048, KeyType_RSA3072, KeyType_RSA4096:
-			if req.Derived || req.Convergent {
-				cleanup()
-				return nil, false, fmt.Errorf("key derivation and convergent encryption not supported for keys of type %v", req.KeyType)
-			}
-
-		default:
+		if err := validatePolicyRequest(req); err != nil {
 			cleanup()
-			return nil, false, fmt.Errorf("unsupported key type %v", req.KeyType)
-		}
-
-		p = &Policy{
-			l:                    new(sync.RWMutex),
-			Name:                 req.Name,
-			Type:                 req.KeyType,
-			Derived:              req.Derived,
-			Exportable:           req.Exportable,
-			AllowPlaintextBackup: req.AllowPlaintextBackup,
+			return nil, false, err
 		}
 
-		if req.Derived {
-			p.KDF = Kdf_hkdf_sha256
-			if req.Convergent {
-				p.ConvergentEncryption = true
-				// As of version 3 we store the version within each key, so we
-				// set to -1 to indicate that the value in the policy has no
-				// meaning. We still, for backwards compatibility, fall back to
-				// this value if the key doesn't have one, which means it will
-				// only be -1 in the case where every key version is >= 3
-				p.ConvergentVersion = -1
-			}
-		}
+		p = newPolicyFromRequest(req)
 
 		// Performs the actual persist and does setup
 		err = p.Rotate(ctx, req.Storage, rand)
@@ -402,6 +376,11 @@ func (lm *LockManager) GetPolicy(ctx context.Context, req PolicyRequest, rand io
 			return nil, false, err
 		}
 
+		if err := lm.attachUsage(ctx, req.Storage, p); err != nil {
+			cleanup()
+			return nil, false, err
+		}
+
 		if lm.useCache {
 			lm.cache.Store(req.Name, p)
 		} else {
@@ -423,6 +402,11 @@ func (lm *LockManager) GetPolicy(ctx context.Context, req PolicyRequest, rand io
 		}
 	}
 
+	if err := lm.attachUsage(ctx, req.Storage, p); err != nil {
+		cleanup()
+		return nil, false, err
+	}
+
 	if lm.useCache {
 		lm.cache.Store(req.Name, p)
 	} else {
@@ -435,6 +419,127 @@ func (lm *LockManager) GetPolicy(ctx context.Context, req PolicyRequest, rand io
 	return
 }
 
+// ImportPolicy creates a new policy from the given request whose first
+// version is the given key material, formatted as expected by Policy.Import.
+// It fails if a policy with the same name already exists. Unlike GetPolicy,
+// no lock is held when this returns.
+func (lm *LockManager) ImportPolicy(ctx context.Context, req PolicyRequest, key []byte, rand io.Reader) error {
+	lock := locksutil.LockForKey(lm.keyLocks, req.Name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	var ok bool
+	var pRaw interface{}
+	if lm.useCache {
+		pRaw, ok = lm.cache.Load(req.Name)
+	}
+	if ok && atomic.LoadUint32(&pRaw.(*Policy).deleted) == 0 {
+		return errutil.UserError{Err: fmt.Sprintf("key %q already exists", req.Name)}
+	}
+
+	p, err := lm.getPolicyFromStorage(ctx, req.Storage, req.Name)
+	if err != nil {
+		return err
+	}
+	if p != nil {
+		return errutil.UserError{Err: fmt.Sprintf("key %q already exists", req.Name)}
+	}
+
+	if err := validatePolicyRequest(req); err != nil {
+		return errutil.UserError{Err: err.Error()}
+	}
+	if req.Derived && req.KeyType == KeyType_ED25519 {
+		// Derived ed25519 keys are never used directly, which would make
+		// importing one pointless
+		return errutil.UserError{Err: fmt.Sprintf("key derivation not supported for imported keys of type %v", req.KeyType)}
+	}
+
+	p = newPolicyFromRequest(req)
+	p.Imported = true
+	p.AllowImportedKeyRotation = req.AllowImportedKeyRotation
+
+	if err := p.Import(ctx, req.Storage, key, rand); err != nil {
+		return err
+	}
+
+	if err := lm.attachUsage(ctx, req.Storage, p); err != nil {
+		return err
+	}
+
+	if lm.useCache {
+		lm.cache.Store(req.Name, p)
+	}
+
+	return nil
+}
+
+// validatePolicyRequest checks that the options requested for a new policy
+// are supported by its key type.
+func validatePolicyRequest(req PolicyRequest) error {
+	switch req.KeyType {
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+		if req.Convergent && !req.Derived {
+			return fmt.Errorf("convergent encryption requires derivation to be enabled")
+		}
+
+	case KeyType_FF3_1:
+		// Format-preserving encryption is deterministic by design
+		if req.Convergent {
+			return fmt.Errorf("convergent encryption not supported for keys of type %v", req.KeyType)
+		}
+
+	case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521, KeyType_ECDSA_SECP256K1:
+		if req.Derived || req.Convergent {
+			return fmt.Errorf("key derivation and convergent encryption not supported for keys of type %v", req.KeyType)
+		}
+
+	case KeyType_ED25519:
+		if req.Convergent {
+			return fmt.Errorf("convergent encryption not supported for keys of type %v", req.KeyType)
+		}
+
+	case KeyType_RSA2048, KeyType_RSA3072, KeyType_RSA4096:
+		if req.Derived || req.Convergent {
+			return fmt.Errorf("key derivation and convergent encryption not supported for keys of type %v", req.KeyType)
+		}
+
+	default:
+		return fmt.Errorf("unsupported key type %v", req.KeyType)
+	}
+
+	return nil
+}
+
+// newPolicyFromRequest returns a new policy, without any key versions, with
+// the settings of the request.
+func newPolicyFromRequest(req PolicyRequest) *Policy {
+	p := &Policy{
+		l:                    new(sync.RWMutex),
+		Name:                 req.Name,
+		Type:                 req.KeyType,
+		Derived:              req.Derived,
+		Exportable:           req.Exportable,
+		AllowPlaintextBackup: req.AllowPlaintextBackup,
+		AllowWrappedExport:   req.AllowWrappedExport,
+		TokenStore:           req.TokenStore,
+	}
+
+	if req.Derived {
+		p.KDF = Kdf_hkdf_sha256
+		if req.Convergent {
+			p.ConvergentEncryption = true
+			// As of version 3 we store the version within each key, so we
+			// set to -1 to indicate that the value in the policy has no
+			// meaning. We still, for backwards compatibility, fall back to
+			// this value if the key doesn't have one, which means it will
+			// only be -1 in the case where every key version is >= 3
+			p.ConvergentVersion = -1
+		}
+	}
+
+	return p
+}
+
 func (lm *LockManager) DeletePolicy(ctx context.Context, storage logical.Storage, name string) error {
 	var p *Policy
 	var err error
@@ -487,7 +592,7 @@ func (lm *LockManager) DeletePolicy(ctx context.Context, storage logical.Storage
 		return errwrap.Wrapf(fmt.Sprintf("error deleting key %q archive: {{err}}", name), err)
 	}
 
-	return nil
+	return lm.deleteUsage(ctx, storage, name)
 }
 
 func (lm *LockManager) getPolicyFromStorage(ctx context.Context, storage logical.Storage, name string) (*Policy, error) {
@@ -32,11 +32,13 @@ import (
 	"golang.org/x/crypto/ed25519"
 	"golang.org/x/crypto/hkdf"
 
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/hashicorp/errwrap"
 	uuid "github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/helper/jsonutil"
 	"github.com/hashicorp/vault/sdk/helper/kdf"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
@@ -59,6 +61,8 @@ const (
 	KeyType_ECDSA_P521
 	KeyType_AES128_GCM96
 	KeyType_RSA3072
+	KeyType_ECDSA_SECP256K1
+	KeyType_FF3_1
 )
 
 const (
@@ -68,6 +72,10 @@ const (
 
 	// DefaultVersionTemplate is used when no version template is provided.
 	DefaultVersionTemplate = "vault:v{{version}}:"
+
+	// deriveKeyMaterialLabel separates the keys used by DeriveKeyMaterial from
+	// the keys derived for encryption operations.
+	deriveKeyMaterialLabel = "transit key derivation"
 )
 
 type RestoreInfo struct {
@@ -109,7 +117,7 @@ func (kt KeyType) DecryptionSupported() bool {
 
 func (kt KeyType) SigningSupported() bool {
 	switch kt {
-	case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521, KeyType_ED25519, KeyType_RSA2048, KeyType_RSA3072, KeyType_RSA4096:
+	case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521, KeyType_ECDSA_SECP256K1, KeyType_ED25519, KeyType_RSA2048, KeyType_RSA3072, KeyType_RSA4096:
 		return true
 	}
 	return false
@@ -117,7 +125,7 @@ func (kt KeyType) SigningSupported() bool {
 
 func (kt KeyType) HashSignatureInput() bool {
 	switch kt {
-	case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521, KeyType_RSA2048, KeyType_RSA3072, KeyType_RSA4096:
+	case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521, KeyType_ECDSA_SECP256K1, KeyType_RSA2048, KeyType_RSA3072, KeyType_RSA4096:
 		return true
 	}
 	return false
@@ -125,12 +133,34 @@ func (kt KeyType) HashSignatureInput() bool {
 
 func (kt KeyType) DerivationSupported() bool {
 	switch kt {
-	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_ED25519:
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_ED25519, KeyType_FF3_1:
 		return true
 	}
 	return false
 }
 
+func (kt KeyType) ecdsaCurve() elliptic.Curve {
+	switch kt {
+	case KeyType_ECDSA_P384:
+		return elliptic.P384()
+	case KeyType_ECDSA_P521:
+		return elliptic.P521()
+	default:
+		return elliptic.P256()
+	}
+}
+
+func (kt KeyType) rsaBits() int {
+	switch kt {
+	case KeyType_RSA3072:
+		return 3072
+	case KeyType_RSA4096:
+		return 4096
+	default:
+		return 2048
+	}
+}
+
 func (kt KeyType) String() string {
 	switch kt {
 	case KeyType_AES128_GCM96:
@@ -153,6 +183,10 @@ func (kt KeyType) String() string {
 		return "rsa-3072"
 	case KeyType_RSA4096:
 		return "rsa-4096"
+	case KeyType_ECDSA_SECP256K1:
+		return "ecdsa-secp256k1"
+	case KeyType_FF3_1:
+		return "ff3-1"
 	}
 
 	return "[unknown]"
@@ -247,6 +281,12 @@ type PolicyConfig struct {
 	// AllowPlaintextBackup allows taking backup of the policy in plaintext
 	AllowPlaintextBackup bool
 
+	// AllowWrappedExport allows exporting the key wrapped to a public key
+	AllowWrappedExport bool
+
+	// TokenStore records the tokens issued by an FF3-1 key
+	TokenStore bool
+
 	// VersionTemplate is used to prefix the ciphertext with information about
 	// the key version. It must inclide {{version}} and a delimiter between the
 	// version prefix and the ciphertext.
@@ -270,6 +310,8 @@ func NewPolicy(config PolicyConfig) *Policy {
 		Exportable:           config.Exportable,
 		DeletionAllowed:      config.DeletionAllowed,
 		AllowPlaintextBackup: config.AllowPlaintextBackup,
+		AllowWrappedExport:   config.AllowWrappedExport,
+		TokenStore:           config.TokenStore,
 		VersionTemplate:      config.VersionTemplate,
 		StoragePrefix:        config.StoragePrefix,
 	}
@@ -365,6 +407,14 @@ type Policy struct {
 	// AllowPlaintextBackup allows taking backup of the policy in plaintext
 	AllowPlaintextBackup bool `json:"allow_plaintext_backup"`
 
+	// AllowWrappedExport allows exporting the key wrapped to a public key,
+	// even if the key is not exportable in plaintext
+	AllowWrappedExport bool `json:"allow_wrapped_export"`
+
+	// TokenStore records the tokens issued by an FF3-1 key, so that only
+	// recorded tokens can be detokenized and tokens can be revoked.
+	TokenStore bool `json:"token_store"`
+
 	// VersionTemplate is used to prefix the ciphertext with information about
 	// the key version. It must inclide {{version}} and a delimiter between the
 	// version prefix and the ciphertext.
@@ -374,9 +424,39 @@ type Policy struct {
 	// policy object.
 	StoragePrefix string `json:"storage_prefix"`
 
+	// Imported indicates that the key material of the policy was imported
+	// rather than generated by Vault.
+	Imported bool `json:"imported"`
+
+	// AllowImportedKeyRotation allows Vault to rotate an imported policy by
+	// generating a new key version. Without it, new versions of an imported
+	// policy can only be imported.
+	AllowImportedKeyRotation bool `json:"allow_imported_key_rotation"`
+
+	// AutoRotatePeriod is the period after which the latest key version is
+	// rotated automatically; zero disables automatic rotation.
+	AutoRotatePeriod time.Duration `json:"auto_rotate_period"`
+
+	// AllowedOperations restricts the operations the key may be used for;
+	// if empty, all operations supported by the key type are allowed.
+	AllowedOperations []string `json:"allowed_operations,omitempty"`
+
 	// versionPrefixCache stores caches of version prefix strings and the split
 	// version template.
 	versionPrefixCache sync.Map
+
+	// usage tracks the usage of the key versions; it is set by the
+	// LockManager
+	usage *keyUsage
+}
+
+// OperationAllowed returns whether the key may be used for the given
+// operation.
+func (p *Policy) OperationAllowed(operation string) bool {
+	if len(p.AllowedOperations) == 0 {
+		return true
+	}
+	return strutil.StrListContains(p.AllowedOperations, operation)
 }
 
 func (p *Policy) Lock(exclusive bool) {
@@ -752,7 +832,7 @@ func (p *Policy) DeriveKey(context, salt []byte, ver int, numBytes int) ([]byte,
 		}
 
 		switch p.Type {
-		case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+		case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_FF3_1:
 			n, err := derBytes.ReadFrom(limReader)
 			if err != nil {
 				return nil, errutil.InternalError{Err: fmt.Sprintf("error reading returned derived bytes: %v", err)}
@@ -893,6 +973,8 @@ func (p *Policy) Encrypt(ver int, context, nonce []byte, value string) (string,
 		return "", errutil.InternalError{Err: fmt.Sprintf("unsupported key type %v", p.Type)}
 	}
 
+	p.recordUsage(ver)
+
 	// Convert to base64
 	encoded := base64.StdEncoding.EncodeToString(ciphertext)
 
@@ -993,6 +1075,8 @@ func (p *Policy) Decrypt(context, nonce []byte, value string) (string, error) {
 		return "", errutil.InternalError{Err: fmt.Sprintf("unsupported key type %v", p.Type)}
 	}
 
+	p.recordUsage(ver)
+
 	return base64.StdEncoding.EncodeToString(plain), nil
 }
 
@@ -1011,9 +1095,84 @@ func (p *Policy) HMACKey(version int) ([]byte, error) {
 		return nil, fmt.Errorf("no HMAC key exists for that key version")
 	}
 
+	p.recordUsage(version)
+
 	return keyEntry.HMACKey, nil
 }
 
+// CMACKey returns the AES key used to compute CMACs with the given version of
+// the key. For derived keys, the key for the given context is returned.
+func (p *Policy) CMACKey(version int, context []byte) ([]byte, error) {
+	numBytes := 32
+	switch p.Type {
+	case KeyType_AES128_GCM96:
+		numBytes = 16
+	case KeyType_AES256_GCM96:
+	default:
+		return nil, errutil.UserError{Err: fmt.Sprintf("CMAC is not supported for key type %v", p.Type)}
+	}
+
+	switch {
+	case version <= 0:
+		return nil, errutil.UserError{Err: "key version does not exist (must be positive)"}
+	case version > p.LatestVersion:
+		return nil, errutil.UserError{Err: fmt.Sprintf("key version does not exist; latest key version is %d", p.LatestVersion)}
+	}
+
+	key, err := p.GetKey(context, version, numBytes)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) < numBytes {
+		return nil, errutil.InternalError{Err: "could not derive key, length too small"}
+	}
+
+	p.recordUsage(version)
+
+	return key[:numBytes], nil
+}
+
+// DeriveKeyMaterial derives key material of the given length from the given
+// version of the key with HKDF (RFC 5869), using the given salt and info.
+//
+// The HKDF input key is itself derived from the key version, so that the
+// output can never match the keys used for encryption with derived keys.
+func (p *Policy) DeriveKeyMaterial(version int, hashAlgorithm HashType, salt, info []byte, numBytes int) ([]byte, error) {
+	switch p.Type {
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+	default:
+		return nil, errutil.UserError{Err: fmt.Sprintf("key derivation is not supported for key type %v", p.Type)}
+	}
+
+	hashFunc, ok := HashFuncMap[hashAlgorithm]
+	if !ok || hashAlgorithm == HashTypeSHA1 {
+		return nil, errutil.UserError{Err: "unsupported hash algorithm"}
+	}
+
+	if maxBytes := 255 * hashFunc().Size(); numBytes <= 0 || numBytes > maxBytes {
+		return nil, errutil.UserError{Err: fmt.Sprintf("the length of the derived key must be between 1 and %d bytes", maxBytes)}
+	}
+
+	keyEntry, err := p.safeGetKeyEntry(version)
+	if err != nil {
+		return nil, err
+	}
+
+	prk, err := kdf.HMACSHA256PRF(keyEntry.Key, []byte(deriveKeyMaterialLabel))
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := kdf.HKDF(hashFunc, prk, salt, info, uint32(numBytes)*8)
+	if err != nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("error deriving key: %v", err)}
+	}
+
+	p.recordUsage(version)
+
+	return out, nil
+}
+
 func (p *Policy) Sign(ver int, context, input []byte, hashAlgorithm HashType, sigAlgorithm string, marshaling MarshalingType) (*SigningResult, error) {
 	if !p.Type.SigningSupported() {
 		return nil, fmt.Errorf("message signing not supported for key type %v", p.Type)
@@ -1125,6 +1284,12 @@ func (p *Policy) Sign(ver int, context, input []byte, hashAlgorithm HashType, si
 			return nil, err
 		}
 
+	case KeyType_ECDSA_SECP256K1:
+		sig, err = signSecp256k1(&keyParams, input, marshaling)
+		if err != nil {
+			return nil, err
+		}
+
 	case KeyType_RSA2048, KeyType_RSA3072, KeyType_RSA4096:
 		key := keyParams.RSAKey
 
@@ -1180,6 +1345,8 @@ func (p *Policy) Sign(ver int, context, input []byte, hashAlgorithm HashType, si
 		PublicKey: pubKey,
 	}
 
+	p.recordUsage(ver)
+
 	return res, nil
 }
 
@@ -1216,6 +1383,8 @@ func (p *Policy) VerifySignature(context, input []byte, hashAlgorithm HashType,
 		return false, errutil.UserError{Err: ErrTooOld}
 	}
 
+	p.recordUsage(ver)
+
 	var sigBytes []byte
 	switch marshaling {
 	case MarshalingTypeASN1:
@@ -1291,6 +1460,14 @@ func (p *Policy) VerifySignature(context, input []byte, hashAlgorithm HashType,
 
 		return ed25519.Verify(key.Public().(ed25519.PublicKey), input, sigBytes), nil
 
+	case KeyType_ECDSA_SECP256K1:
+		keyEntry, err := p.safeGetKeyEntry(ver)
+		if err != nil {
+			return false, err
+		}
+
+		return verifySecp256k1(&keyEntry, input, sigBytes, marshaling)
+
 	case KeyType_RSA2048, KeyType_RSA3072, KeyType_RSA4096:
 		keyEntry, err := p.safeGetKeyEntry(ver)
 		if err != nil {
@@ -1338,6 +1515,28 @@ func (p *Policy) VerifySignature(context, input []byte, hashAlgorithm HashType,
 // Rotate rotates the policy and persists it to storage.
 // If the rotation partially fails, the policy state will be restored.
 func (p *Policy) Rotate(ctx context.Context, storage logical.Storage, randReader io.Reader) (retErr error) {
+	if p.Imported && !p.AllowImportedKeyRotation {
+		return errutil.UserError{Err: "rotation of imported keys is disallowed by policy"}
+	}
+
+	return p.persistNewVersion(ctx, storage, func() error {
+		return p.RotateInMemory(randReader)
+	})
+}
+
+// Import adds the given key material as the latest version of the policy and
+// persists it to storage. Symmetric keys must be the raw key bytes and
+// asymmetric keys PKCS#8 DER-encoded private keys of the policy's key type.
+// If the import partially fails, the policy state will be restored.
+func (p *Policy) Import(ctx context.Context, storage logical.Storage, key []byte, randReader io.Reader) error {
+	return p.persistNewVersion(ctx, storage, func() error {
+		return p.ImportInMemory(key, randReader)
+	})
+}
+
+// persistNewVersion runs the given function adding a key version in memory
+// and persists the policy, restoring the prior state on failure.
+func (p *Policy) persistNewVersion(ctx context.Context, storage logical.Storage, addVersion func() error) (retErr error) {
 	priorLatestVersion := p.LatestVersion
 	priorMinDecryptionVersion := p.MinDecryptionVersion
 	var priorKeys keyEntryMap
@@ -1357,7 +1556,7 @@ func (p *Policy) Rotate(ctx context.Context, storage logical.Storage, randReader
 		}
 	}()
 
-	if err := p.RotateInMemory(randReader); err != nil {
+	if err := addVersion(); err != nil {
 		return err
 	}
 
@@ -1366,20 +1565,13 @@ func (p *Policy) Rotate(ctx context.Context, storage logical.Storage, randReader
 
 // RotateInMemory rotates the policy but does not persist it to storage.
 func (p *Policy) RotateInMemory(randReader io.Reader) (retErr error) {
-	now := time.Now()
-	entry := KeyEntry{
-		CreationTime:           now,
-		DeprecatedCreationTime: now.Unix(),
-	}
-
-	hmacKey, err := uuid.GenerateRandomBytesWithReader(32, randReader)
+	entry, err := newKeyEntry(randReader)
 	if err != nil {
 		return err
 	}
-	entry.HMACKey = hmacKey
 
 	switch p.Type {
-	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_FF3_1:
 		// Default to 256 bit key
 		numBytes := 32
 		if p.Type == KeyType_AES128_GCM96 {
@@ -1392,36 +1584,13 @@ func (p *Policy) RotateInMemory(randReader io.Reader) (retErr error) {
 		entry.Key = newKey
 
 	case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521:
-		var curve elliptic.Curve
-		switch p.Type {
-		case KeyType_ECDSA_P384:
-			curve = elliptic.P384()
-		case KeyType_ECDSA_P521:
-			curve = elliptic.P521()
-		default:
-			curve = elliptic.P256()
-		}
-
-		privKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+		privKey, err := ecdsa.GenerateKey(p.Type.ecdsaCurve(), rand.Reader)
 		if err != nil {
 			return err
 		}
-		entry.EC_D = privKey.D
-		entry.EC_X = privKey.X
-		entry.EC_Y = privKey.Y
-		derBytes, err := x509.MarshalPKIXPublicKey(privKey.Public())
-		if err != nil {
-			return errwrap.Wrapf("error marshaling public key: {{err}}", err)
-		}
-		pemBlock := &pem.Block{
-			Type:  "PUBLIC KEY",
-			Bytes: derBytes,
-		}
-		pemBytes := pem.EncodeToMemory(pemBlock)
-		if pemBytes == nil || len(pemBytes) == 0 {
-			return fmt.Errorf("error PEM-encoding public key")
+		if err := entry.setECDSAKey(privKey); err != nil {
+			return err
 		}
-		entry.FormattedPublicKey = string(pemBytes)
 
 	case KeyType_ED25519:
 		pub, pri, err := ed25519.GenerateKey(randReader)
@@ -1431,21 +1600,132 @@ func (p *Policy) RotateInMemory(randReader io.Reader) (retErr error) {
 		entry.Key = pri
 		entry.FormattedPublicKey = base64.StdEncoding.EncodeToString(pub)
 
-	case KeyType_RSA2048, KeyType_RSA3072, KeyType_RSA4096:
-		bitSize := 2048
-		if p.Type == KeyType_RSA3072 {
-			bitSize = 3072
+	case KeyType_ECDSA_SECP256K1:
+		privKey, err := secp256k1.GeneratePrivateKeyFromRand(randReader)
+		if err != nil {
+			return err
 		}
-		if p.Type == KeyType_RSA4096 {
-			bitSize = 4096
+		if err := entry.setSecp256k1Key(privKey); err != nil {
+			return err
 		}
 
-		entry.RSAKey, err = rsa.GenerateKey(randReader, bitSize)
+	case KeyType_RSA2048, KeyType_RSA3072, KeyType_RSA4096:
+		entry.RSAKey, err = rsa.GenerateKey(randReader, p.Type.rsaBits())
 		if err != nil {
 			return err
 		}
 	}
 
+	p.addKeyEntry(entry)
+
+	return nil
+}
+
+// ImportInMemory adds the given key material as the latest version of the
+// policy but does not persist it to storage.
+func (p *Policy) ImportInMemory(key []byte, randReader io.Reader) error {
+	entry, err := newKeyEntry(randReader)
+	if err != nil {
+		return err
+	}
+
+	switch p.Type {
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_FF3_1:
+		numBytes := 32
+		if p.Type == KeyType_AES128_GCM96 {
+			numBytes = 16
+		}
+		if len(key) != numBytes {
+			return errutil.UserError{Err: fmt.Sprintf("invalid key size %d bytes for key type %v; expected %d bytes", len(key), p.Type, numBytes)}
+		}
+		entry.Key = key
+
+	case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521, KeyType_ED25519, KeyType_RSA2048, KeyType_RSA3072, KeyType_RSA4096:
+		parsedKey, err := x509.ParsePKCS8PrivateKey(key)
+		if err != nil {
+			return errutil.UserError{Err: fmt.Sprintf("error parsing PKCS#8 private key: %v", err)}
+		}
+
+		switch p.Type {
+		case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521:
+			ecKey, ok := parsedKey.(*ecdsa.PrivateKey)
+			if !ok || ecKey.Curve != p.Type.ecdsaCurve() {
+				return errutil.UserError{Err: fmt.Sprintf("imported key is not a private key of type %v", p.Type)}
+			}
+			if err := entry.setECDSAKey(ecKey); err != nil {
+				return err
+			}
+
+		case KeyType_ED25519:
+			edKey, ok := parsedKey.(ed25519.PrivateKey)
+			if !ok {
+				return errutil.UserError{Err: fmt.Sprintf("imported key is not a private key of type %v", p.Type)}
+			}
+			entry.Key = edKey
+			entry.FormattedPublicKey = base64.StdEncoding.EncodeToString(edKey.Public().(ed25519.PublicKey))
+
+		default:
+			rsaKey, ok := parsedKey.(*rsa.PrivateKey)
+			if !ok || rsaKey.N.BitLen() != p.Type.rsaBits() {
+				return errutil.UserError{Err: fmt.Sprintf("imported key is not a private key of type %v", p.Type)}
+			}
+			entry.RSAKey = rsaKey
+		}
+
+	case KeyType_ECDSA_SECP256K1:
+		return errutil.UserError{Err: fmt.Sprintf("importing keys of type %v is not supported", p.Type)}
+
+	default:
+		return errutil.InternalError{Err: fmt.Sprintf("unsupported key type %v", p.Type)}
+	}
+
+	p.addKeyEntry(entry)
+
+	return nil
+}
+
+// newKeyEntry returns a key entry with its creation time and HMAC key set.
+func newKeyEntry(randReader io.Reader) (KeyEntry, error) {
+	now := time.Now()
+	entry := KeyEntry{
+		CreationTime:           now,
+		DeprecatedCreationTime: now.Unix(),
+	}
+
+	hmacKey, err := uuid.GenerateRandomBytesWithReader(32, randReader)
+	if err != nil {
+		return entry, err
+	}
+	entry.HMACKey = hmacKey
+
+	return entry, nil
+}
+
+// setECDSAKey stores the given private key in the entry along with its
+// PEM-encoded public key.
+func (ke *KeyEntry) setECDSAKey(privKey *ecdsa.PrivateKey) error {
+	ke.EC_D = privKey.D
+	ke.EC_X = privKey.X
+	ke.EC_Y = privKey.Y
+	derBytes, err := x509.MarshalPKIXPublicKey(privKey.Public())
+	if err != nil {
+		return errwrap.Wrapf("error marshaling public key: {{err}}", err)
+	}
+	pemBlock := &pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: derBytes,
+	}
+	pemBytes := pem.EncodeToMemory(pemBlock)
+	if pemBytes == nil || len(pemBytes) == 0 {
+		return fmt.Errorf("error PEM-encoding public key")
+	}
+	ke.FormattedPublicKey = string(pemBytes)
+
+	return nil
+}
+
+// addKeyEntry adds the entry as the latest version of the policy.
+func (p *Policy) addKeyEntry(entry KeyEntry) {
 	if p.ConvergentEncryption {
 		if p.ConvergentVersion == -1 || p.ConvergentVersion > 1 {
 			entry.ConvergentVersion = currentConvergentVersion
@@ -1468,8 +1748,6 @@ func (p *Policy) RotateInMemory(randReader io.Reader) (retErr error) {
 	if p.MinDecryptionVersion == 0 {
 		p.MinDecryptionVersion = 1
 	}
-
-	return nil
 }
 
 func (p *Policy) MigrateKeyToKeysMap() {
@@ -1484,6 +1762,22 @@ func (p *Policy) MigrateKeyToKeysMap() {
 	p.Key = nil
 }
 
+// KeyData returns the policy along with its archived keys, as in a backup.
+// Unlike Backup, it doesn't record a backup in the policy nor require the
+// policy to allow plaintext backups; it is meant for transferring the policy
+// to another cluster under encryption.
+func (p *Policy) KeyData(ctx context.Context, storage logical.Storage) (*KeyData, error) {
+	archivedKeys, err := p.LoadArchive(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyData{
+		Policy:       p,
+		ArchivedKeys: archivedKeys,
+	}, nil
+}
+
 // Backup should be called with an exclusive lock held on the policy
 func (p *Policy) Backup(ctx context.Context, storage logical.Storage) (out string, retErr error) {
 	if !p.Exportable {
@@ -495,6 +495,7 @@ func Test_BadUpgrade(t *testing.T) {
 		t.Fatal(err)
 	}
 	orig.(*Policy).l = p.l
+	orig.(*Policy).usage = p.usage
 
 	p.Key = p.Keys["1"].Key
 	p.Keys = nil
@@ -0,0 +1,200 @@
+package keysutil
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+)
+
+// The Go standard library does not support secp256k1, so its keys are
+// encoded here following SEC 1 and RFC 5480.
+var (
+	oidPublicKeyECDSA      = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidNamedCurveSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+type secp256k1PublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// secp256k1PrivateKey is the ECPrivateKey structure of RFC 5915
+type secp256k1PrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// setSecp256k1Key stores the given private key in the entry along with its
+// PEM-encoded public key.
+func (ke *KeyEntry) setSecp256k1Key(privKey *secp256k1.PrivateKey) error {
+	pubKey := privKey.PubKey()
+	ke.EC_D = new(big.Int).SetBytes(privKey.Serialize())
+	ke.EC_X = pubKey.X()
+	ke.EC_Y = pubKey.Y()
+
+	curveParams, err := asn1.Marshal(oidNamedCurveSecp256k1)
+	if err != nil {
+		return errwrap.Wrapf("error marshaling curve parameters: {{err}}", err)
+	}
+	pubKeyBytes := pubKey.SerializeUncompressed()
+	derBytes, err := asn1.Marshal(secp256k1PublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: curveParams},
+		},
+		PublicKey: asn1.BitString{
+			Bytes:     pubKeyBytes,
+			BitLength: 8 * len(pubKeyBytes),
+		},
+	})
+	if err != nil {
+		return errwrap.Wrapf("error marshaling public key: {{err}}", err)
+	}
+	pemBlock := &pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: derBytes,
+	}
+	pemBytes := pem.EncodeToMemory(pemBlock)
+	if len(pemBytes) == 0 {
+		return fmt.Errorf("error PEM-encoding public key")
+	}
+	ke.FormattedPublicKey = string(pemBytes)
+
+	return nil
+}
+
+func (ke *KeyEntry) secp256k1PrivateKey() *secp256k1.PrivateKey {
+	return secp256k1.PrivKeyFromBytes(ke.EC_D.Bytes())
+}
+
+func (ke *KeyEntry) secp256k1PublicKey() (*secp256k1.PublicKey, error) {
+	var x, y secp256k1.FieldVal
+	if x.SetByteSlice(ke.EC_X.Bytes()) || y.SetByteSlice(ke.EC_Y.Bytes()) {
+		return nil, errutil.InternalError{Err: "invalid secp256k1 public key"}
+	}
+	return secp256k1.NewPublicKey(&x, &y), nil
+}
+
+// MarshalSecp256k1PrivateKey returns the SEC 1 DER encoding of the
+// secp256k1 private key held by the given key entry.
+func MarshalSecp256k1PrivateKey(ke *KeyEntry) ([]byte, error) {
+	if ke == nil || ke.EC_D == nil {
+		return nil, fmt.Errorf("key entry does not hold a secp256k1 private key")
+	}
+
+	privKey := ke.secp256k1PrivateKey()
+	pubKeyBytes := privKey.PubKey().SerializeUncompressed()
+	return asn1.Marshal(secp256k1PrivateKey{
+		Version:       1,
+		PrivateKey:    privKey.Serialize(),
+		NamedCurveOID: oidNamedCurveSecp256k1,
+		PublicKey: asn1.BitString{
+			Bytes:     pubKeyBytes,
+			BitLength: 8 * len(pubKeyBytes),
+		},
+	})
+}
+
+// pkcs8PrivateKey is the PrivateKeyInfo structure of RFC 5208
+type pkcs8PrivateKey struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// MarshalSecp256k1PKCS8PrivateKey returns the PKCS #8 DER encoding of the
+// key entry's secp256k1 private key.
+func MarshalSecp256k1PKCS8PrivateKey(ke *KeyEntry) ([]byte, error) {
+	if ke == nil || ke.EC_D == nil {
+		return nil, fmt.Errorf("key entry does not hold a secp256k1 private key")
+	}
+
+	curveParams, err := asn1.Marshal(oidNamedCurveSecp256k1)
+	if err != nil {
+		return nil, errwrap.Wrapf("error marshaling curve parameters: {{err}}", err)
+	}
+
+	// As in crypto/x509, the curve is only named in the algorithm identifier
+	privKey := ke.secp256k1PrivateKey()
+	pubKeyBytes := privKey.PubKey().SerializeUncompressed()
+	ecDER, err := asn1.Marshal(secp256k1PrivateKey{
+		Version:    1,
+		PrivateKey: privKey.Serialize(),
+		PublicKey: asn1.BitString{
+			Bytes:     pubKeyBytes,
+			BitLength: 8 * len(pubKeyBytes),
+		},
+	})
+	if err != nil {
+		return nil, errwrap.Wrapf("error marshaling private key: {{err}}", err)
+	}
+
+	return asn1.Marshal(pkcs8PrivateKey{
+		Algo: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: curveParams},
+		},
+		PrivateKey: ecDER,
+	})
+}
+
+// signSecp256k1 signs the given hash with the key entry's secp256k1 key.
+// Signatures are deterministic (RFC 6979) and use the canonical low-S form.
+func signSecp256k1(ke *KeyEntry, input []byte, marshaling MarshalingType) ([]byte, error) {
+	sig := secpecdsa.Sign(ke.secp256k1PrivateKey(), input)
+
+	switch marshaling {
+	case MarshalingTypeASN1:
+		return sig.Serialize(), nil
+
+	case MarshalingTypeJWS:
+		// As for ES256K, R and S are concatenated as 32-byte values
+		r, s := sig.R(), sig.S()
+		out := make([]byte, 64)
+		r.PutBytesUnchecked(out[:32])
+		s.PutBytesUnchecked(out[32:])
+		return out, nil
+
+	default:
+		return nil, errutil.UserError{Err: "requested marshaling type is invalid"}
+	}
+}
+
+func verifySecp256k1(ke *KeyEntry, input, sigBytes []byte, marshaling MarshalingType) (bool, error) {
+	var sig *secpecdsa.Signature
+
+	switch marshaling {
+	case MarshalingTypeASN1:
+		var err error
+		sig, err = secpecdsa.ParseDERSignature(sigBytes)
+		if err != nil {
+			return false, errutil.UserError{Err: "supplied signature is invalid"}
+		}
+
+	case MarshalingTypeJWS:
+		var r, s secp256k1.ModNScalar
+		if len(sigBytes) != 64 || r.SetByteSlice(sigBytes[:32]) || s.SetByteSlice(sigBytes[32:]) {
+			return false, errutil.UserError{Err: "supplied signature is invalid"}
+		}
+		sig = secpecdsa.NewSignature(&r, &s)
+
+	default:
+		return false, errutil.UserError{Err: "requested marshaling type is invalid"}
+	}
+
+	pubKey, err := ke.secp256k1PublicKey()
+	if err != nil {
+		return false, err
+	}
+
+	return sig.Verify(input, pubKey), nil
+}
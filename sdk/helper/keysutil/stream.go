@@ -0,0 +1,346 @@
+package keysutil
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+)
+
+const (
+	// DefaultStreamChunkSize is the default amount of plaintext encrypted in
+	// each chunk of a stream.
+	DefaultStreamChunkSize = 64 * 1024
+
+	// MaxStreamChunkSize is the largest amount of plaintext that can be
+	// encrypted in a single chunk of a stream.
+	MaxStreamChunkSize = 16 * 1024 * 1024
+
+	// streamFormatVersion is the version of the stream format, stored in the
+	// last byte of the stream's magic bytes.
+	streamFormatVersion = 1
+
+	streamNoncePrefixSize = 7
+	streamMaxWrappedKey   = 8192
+
+	// streamFixedHeaderSize is the size of the stream header, excluding the
+	// wrapped data key: the magic bytes, the key version, the chunk size,
+	// the nonce prefix and the length of the wrapped data key.
+	streamFixedHeaderSize = 4 + 4 + 4 + streamNoncePrefixSize + 2
+
+	// streamFrameHeaderSize is the size of the header of each chunk: a flag
+	// marking the final chunk and the length of the chunk's ciphertext.
+	streamFrameHeaderSize = 1 + 4
+)
+
+var streamMagic = []byte{'v', 't', 's', streamFormatVersion}
+
+// StreamHeader is the header of a stream encrypted with a policy. The
+// stream's chunks are encrypted with AES-256-GCM under a random data key,
+// which is itself encrypted with the policy and stored in the header. The
+// encoded header is authenticated as additional data of every chunk.
+//
+// Each chunk's nonce is made of the header's random nonce prefix, the
+// chunk's 32-bit counter and a byte marking the final chunk, so that chunks
+// can be neither reordered nor dropped, and the stream can't be truncated.
+type StreamHeader struct {
+	// KeyVersion is the version of the policy the data key is encrypted with
+	KeyVersion int
+
+	// ChunkSize is the size of the plaintext of every chunk but the last
+	ChunkSize int
+
+	// NoncePrefix is the random prefix of each chunk's nonce
+	NoncePrefix []byte
+
+	// WrappedKey is the data key, encrypted with the policy
+	WrappedKey string
+
+	raw []byte
+}
+
+func (h *StreamHeader) marshal() []byte {
+	buf := make([]byte, streamFixedHeaderSize, streamFixedHeaderSize+len(h.WrappedKey))
+	copy(buf, streamMagic)
+	binary.BigEndian.PutUint32(buf[4:8], uint32(h.KeyVersion))
+	binary.BigEndian.PutUint32(buf[8:12], uint32(h.ChunkSize))
+	copy(buf[12:12+streamNoncePrefixSize], h.NoncePrefix)
+	binary.BigEndian.PutUint16(buf[12+streamNoncePrefixSize:], uint16(len(h.WrappedKey)))
+	return append(buf, h.WrappedKey...)
+}
+
+// ReadStreamHeader reads the header of an encrypted stream from r, leaving r
+// positioned at the first chunk.
+func ReadStreamHeader(r io.Reader) (*StreamHeader, error) {
+	fixed := make([]byte, streamFixedHeaderSize)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errutil.UserError{Err: "invalid stream: header is truncated"}
+		}
+		return nil, err
+	}
+	if !bytes.Equal(fixed[:4], streamMagic) {
+		return nil, errutil.UserError{Err: "invalid stream: unknown format"}
+	}
+
+	h := &StreamHeader{
+		KeyVersion:  int(binary.BigEndian.Uint32(fixed[4:8])),
+		ChunkSize:   int(binary.BigEndian.Uint32(fixed[8:12])),
+		NoncePrefix: fixed[12 : 12+streamNoncePrefixSize],
+	}
+	if h.ChunkSize <= 0 || h.ChunkSize > MaxStreamChunkSize {
+		return nil, errutil.UserError{Err: "invalid stream: bad chunk size"}
+	}
+
+	wrappedKeyLen := int(binary.BigEndian.Uint16(fixed[12+streamNoncePrefixSize:]))
+	if wrappedKeyLen == 0 || wrappedKeyLen > streamMaxWrappedKey {
+		return nil, errutil.UserError{Err: "invalid stream: bad wrapped key length"}
+	}
+	wrappedKey := make([]byte, wrappedKeyLen)
+	if _, err := io.ReadFull(r, wrappedKey); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errutil.UserError{Err: "invalid stream: header is truncated"}
+		}
+		return nil, err
+	}
+	h.WrappedKey = string(wrappedKey)
+	h.raw = append(fixed, wrappedKey...)
+
+	return h, nil
+}
+
+// StreamEncryptor encrypts a stream under a data key generated for it. Once
+// created, it no longer needs the policy, so the policy lock need not be
+// held while the stream is encrypted.
+type StreamEncryptor struct {
+	header *StreamHeader
+	aead   cipher.AEAD
+}
+
+// NewStreamEncryptor generates a data key for a new stream and encrypts it
+// with the given version of the policy; ver 0 is the latest version. The
+// context is used with derived keys as it is for Encrypt.
+func (p *Policy) NewStreamEncryptor(ver int, context []byte, chunkSize int, randReader io.Reader) (*StreamEncryptor, error) {
+	if p.ConvergentEncryption {
+		return nil, errutil.UserError{Err: "stream encryption is not supported with convergent encryption"}
+	}
+	if chunkSize <= 0 || chunkSize > MaxStreamChunkSize {
+		return nil, errutil.UserError{Err: fmt.Sprintf("chunk size must be between 1 and %d bytes", MaxStreamChunkSize)}
+	}
+	if ver == 0 {
+		ver = p.LatestVersion
+	}
+
+	dataKey, err := uuid.GenerateRandomBytesWithReader(32, randReader)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := p.Encrypt(ver, context, nil, base64.StdEncoding.EncodeToString(dataKey))
+	if err != nil {
+		return nil, err
+	}
+	if len(wrappedKey) > streamMaxWrappedKey {
+		return nil, errutil.InternalError{Err: "encrypted data key is too large for the stream header"}
+	}
+
+	noncePrefix, err := uuid.GenerateRandomBytesWithReader(streamNoncePrefixSize, randReader)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newStreamAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := &StreamHeader{
+		KeyVersion:  ver,
+		ChunkSize:   chunkSize,
+		NoncePrefix: noncePrefix,
+		WrappedKey:  wrappedKey,
+	}
+	header.raw = header.marshal()
+
+	return &StreamEncryptor{
+		header: header,
+		aead:   aead,
+	}, nil
+}
+
+// Header returns the header of the stream.
+func (e *StreamEncryptor) Header() *StreamHeader {
+	return e.header
+}
+
+// Encrypt reads the plaintext from r until EOF and writes the header and
+// encrypted chunks of the stream to w.
+func (e *StreamEncryptor) Encrypt(w io.Writer, r io.Reader) error {
+	if _, err := w.Write(e.header.raw); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(r)
+	buf := make([]byte, e.header.ChunkSize)
+	frameHeader := make([]byte, streamFrameHeaderSize)
+	var out []byte
+	for counter := uint64(0); ; counter++ {
+		if counter > math.MaxUint32 {
+			return errutil.UserError{Err: "stream is too long for the chunk size"}
+		}
+
+		n, err := io.ReadFull(br, buf)
+		final := false
+		switch err {
+		case nil:
+			// Only a full chunk can be followed by more data
+			if _, err := br.Peek(1); err == io.EOF {
+				final = true
+			} else if err != nil {
+				return err
+			}
+		case io.EOF, io.ErrUnexpectedEOF:
+			final = true
+		default:
+			return err
+		}
+
+		out = e.aead.Seal(out[:0], streamNonce(e.header.NoncePrefix, uint32(counter), final), buf[:n], e.header.raw)
+
+		frameHeader[0] = 0
+		if final {
+			frameHeader[0] = 1
+		}
+		binary.BigEndian.PutUint32(frameHeader[1:], uint32(len(out)))
+		if _, err := w.Write(frameHeader); err != nil {
+			return err
+		}
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+
+		if final {
+			return nil
+		}
+	}
+}
+
+// StreamDecryptor decrypts the chunks of a stream with the stream's data
+// key. Once created, it no longer needs the policy.
+type StreamDecryptor struct {
+	header *StreamHeader
+	aead   cipher.AEAD
+}
+
+// NewStreamDecryptor decrypts the data key of the stream with the given
+// header. The context is used with derived keys as it is for Decrypt.
+func (p *Policy) NewStreamDecryptor(context []byte, header *StreamHeader) (*StreamDecryptor, error) {
+	if header.raw == nil {
+		header.raw = header.marshal()
+	}
+
+	// The key version is part of the authenticated header; make sure it is
+	// also the version the data key was actually encrypted with
+	if header.KeyVersion <= 0 || !strings.HasPrefix(header.WrappedKey, p.getVersionPrefix(header.KeyVersion)) {
+		return nil, errutil.UserError{Err: "invalid stream: key version does not match the encrypted data key"}
+	}
+
+	encodedKey, err := p.Decrypt(context, nil, header.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("failed to decode data key: %v", err)}
+	}
+
+	aead, err := newStreamAEAD(dataKey)
+	if err != nil {
+		return nil, errutil.UserError{Err: "invalid stream: bad data key"}
+	}
+
+	return &StreamDecryptor{
+		header: header,
+		aead:   aead,
+	}, nil
+}
+
+// Decrypt reads the chunks following the stream's header from r and writes
+// their plaintext to w. Every chunk is authenticated before its plaintext is
+// written, but a stream that turns out to be truncated or to have trailing
+// data only fails once the earlier chunks have been written.
+func (d *StreamDecryptor) Decrypt(w io.Writer, r io.Reader) error {
+	frameHeader := make([]byte, streamFrameHeaderSize)
+	maxLen := d.header.ChunkSize + d.aead.Overhead()
+	buf := make([]byte, maxLen)
+	var out []byte
+	for counter := uint64(0); ; counter++ {
+		if counter > math.MaxUint32 {
+			return errutil.UserError{Err: "invalid stream: too many chunks"}
+		}
+
+		if _, err := io.ReadFull(r, frameHeader); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return errutil.UserError{Err: "invalid stream: stream is truncated"}
+			}
+			return err
+		}
+		if frameHeader[0] > 1 {
+			return errutil.UserError{Err: "invalid stream: bad chunk header"}
+		}
+		final := frameHeader[0] == 1
+		chunkLen := int(binary.BigEndian.Uint32(frameHeader[1:]))
+		if chunkLen < d.aead.Overhead() || chunkLen > maxLen {
+			return errutil.UserError{Err: "invalid stream: bad chunk length"}
+		}
+
+		if _, err := io.ReadFull(r, buf[:chunkLen]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return errutil.UserError{Err: "invalid stream: stream is truncated"}
+			}
+			return err
+		}
+
+		var err error
+		out, err = d.aead.Open(out[:0], streamNonce(d.header.NoncePrefix, uint32(counter), final), buf[:chunkLen], d.header.raw)
+		if err != nil {
+			return errutil.UserError{Err: fmt.Sprintf("invalid stream: failed to authenticate chunk %d", counter)}
+		}
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+
+		if final {
+			if _, err := io.ReadFull(r, make([]byte, 1)); err == nil {
+				return errutil.UserError{Err: "invalid stream: data after the final chunk"}
+			}
+			return nil
+		}
+	}
+}
+
+func newStreamAEAD(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func streamNonce(prefix []byte, counter uint32, final bool) []byte {
+	nonce := make([]byte, streamNoncePrefixSize+4+1)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamNoncePrefixSize:], counter)
+	if final {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
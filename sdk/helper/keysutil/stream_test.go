@@ -0,0 +1,113 @@
+package keysutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestPolicy_Stream(t *testing.T) {
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+	p := NewPolicy(PolicyConfig{
+		Name: "test",
+		Type: KeyType_AES256_GCM96,
+	})
+	if err := p.Rotate(ctx, storage, rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypt := func(plaintext []byte, chunkSize int) []byte {
+		t.Helper()
+		enc, err := p.NewStreamEncryptor(0, nil, chunkSize, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if err := enc.Encrypt(&out, bytes.NewReader(plaintext)); err != nil {
+			t.Fatal(err)
+		}
+		return out.Bytes()
+	}
+	decrypt := func(ciphertext []byte) ([]byte, error) {
+		r := bytes.NewReader(ciphertext)
+		header, err := ReadStreamHeader(r)
+		if err != nil {
+			return nil, err
+		}
+		dec, err := p.NewStreamDecryptor(nil, header)
+		if err != nil {
+			return nil, err
+		}
+		var out bytes.Buffer
+		err = dec.Decrypt(&out, r)
+		return out.Bytes(), err
+	}
+
+	for _, size := range []int{0, 1, 16, 17, 64, 1000} {
+		plaintext := make([]byte, size)
+		if _, err := rand.Read(plaintext); err != nil {
+			t.Fatal(err)
+		}
+		ciphertext := encrypt(plaintext, 16)
+		decrypted, err := decrypt(ciphertext)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(plaintext, decrypted) {
+			t.Fatalf("size %d: decrypted plaintext does not match", size)
+		}
+	}
+
+	plaintext := bytes.Repeat([]byte("chunk of data..."), 4)
+	ciphertext := encrypt(plaintext, 16)
+	header, err := ReadStreamHeader(bytes.NewReader(ciphertext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.KeyVersion != 1 || header.ChunkSize != 16 {
+		t.Fatalf("unexpected header: %#v", header)
+	}
+	headerLen := len(header.raw)
+	frameLen := streamFrameHeaderSize + 16 + 16
+
+	// Modifying the header, a chunk, or the framing is detected
+	for _, offset := range []int{5, headerLen - 1, headerLen, headerLen + frameLen + 10, len(ciphertext) - 1} {
+		modified := append([]byte(nil), ciphertext...)
+		modified[offset] ^= 1
+		if _, err := decrypt(modified); err == nil {
+			t.Fatalf("expected error decrypting stream modified at offset %d", offset)
+		}
+	}
+
+	// Dropping the final chunk or swapping chunks is detected
+	truncated := ciphertext[:len(ciphertext)-frameLen]
+	if _, err := decrypt(truncated); err == nil {
+		t.Fatal("expected error decrypting truncated stream")
+	}
+	swapped := append([]byte(nil), ciphertext[:headerLen]...)
+	swapped = append(swapped, ciphertext[headerLen+frameLen:headerLen+2*frameLen]...)
+	swapped = append(swapped, ciphertext[headerLen:headerLen+frameLen]...)
+	swapped = append(swapped, ciphertext[headerLen+2*frameLen:]...)
+	if _, err := decrypt(swapped); err == nil {
+		t.Fatal("expected error decrypting reordered stream")
+	}
+	if _, err := decrypt(append(ciphertext, 0)); err == nil {
+		t.Fatal("expected error decrypting stream with trailing data")
+	}
+
+	// Streams remain readable after rotation
+	if err := p.Rotate(ctx, storage, rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := decrypt(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, decrypted) {
+		t.Fatal("decrypted plaintext does not match after rotation")
+	}
+}
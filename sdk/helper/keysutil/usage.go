@@ -0,0 +1,268 @@
+package keysutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// KeyVersionUsage holds how often a key version has been used and when it
+// was last used.
+type KeyVersionUsage struct {
+	Count    uint64    `json:"count"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// usagePersistInterval bounds how far the persisted usage of a key may lag
+// behind its use: the last use of a version is persisted, or the request
+// forwarded to a node that can persist it, once the persisted last use of the
+// version is older than this.
+const usagePersistInterval = time.Minute
+
+// keyUsage tracks the usage of the versions of a policy. Usage is counted in
+// memory, so that recording it does not require a write lock on the policy,
+// and persisted by LockManager.SyncUsage and LockManager.PersistUsage.
+type keyUsage struct {
+	l     sync.Mutex
+	dirty bool
+
+	// stale is set when the persisted usage was changed by another node,
+	// so that it is loaded again before being used
+	stale bool
+
+	// lastPersisted is when the usage was last persisted by this node
+	lastPersisted time.Time
+
+	versions map[int]KeyVersionUsage
+
+	// persisted holds the last use of each version, as persisted
+	persisted map[int]time.Time
+}
+
+func (u *keyUsage) record(version int) {
+	u.l.Lock()
+	defer u.l.Unlock()
+
+	usage := u.versions[version]
+	usage.Count++
+	usage.LastUsed = time.Now().UTC()
+	u.versions[version] = usage
+	u.dirty = true
+}
+
+// unpersisted returns whether a version was used more than
+// usagePersistInterval after its persisted last use. It must be called with
+// the lock held.
+func (u *keyUsage) unpersisted() bool {
+	for version, usage := range u.versions {
+		if usage.LastUsed.Sub(u.persisted[version]) > usagePersistInterval {
+			return true
+		}
+	}
+	return false
+}
+
+// load replaces the counts with the given persisted usage. The last uses
+// recorded locally are kept if more recent, so that uses not reflected by
+// the persisted usage are not lost. It must be called with the lock held.
+func (u *keyUsage) load(persisted map[int]KeyVersionUsage) {
+	u.persisted = make(map[int]time.Time, len(persisted))
+	for version, usage := range persisted {
+		u.persisted[version] = usage.LastUsed
+	}
+
+	for version, usage := range u.versions {
+		p := persisted[version]
+		if usage.LastUsed.After(p.LastUsed) {
+			p.LastUsed = usage.LastUsed
+			persisted[version] = p
+		}
+	}
+	u.versions = persisted
+	u.stale = false
+}
+
+// recordUsage records a use of the given version of the policy.
+func (p *Policy) recordUsage(version int) {
+	if p.usage != nil {
+		p.usage.record(version)
+	}
+}
+
+// Usage returns the usage of each version of the policy that has been used.
+// Usage is only tracked for policies obtained from a LockManager.
+func (p *Policy) Usage() map[int]KeyVersionUsage {
+	ret := map[int]KeyVersionUsage{}
+	if p.usage == nil {
+		return ret
+	}
+
+	p.usage.l.Lock()
+	defer p.usage.l.Unlock()
+	for version, usage := range p.usage.versions {
+		if version >= p.MinAvailableVersion {
+			ret[version] = usage
+		}
+	}
+
+	return ret
+}
+
+// attachUsage sets the usage tracker of the policy, loading the persisted
+// usage of the policy on first use.
+func (lm *LockManager) attachUsage(ctx context.Context, storage logical.Storage, p *Policy) error {
+	if usageRaw, ok := lm.usage.Load(p.Name); ok {
+		p.usage = usageRaw.(*keyUsage)
+		return nil
+	}
+
+	persisted, err := readUsage(ctx, storage, p.Name)
+	if err != nil {
+		return err
+	}
+	usage := &keyUsage{}
+	usage.load(persisted)
+
+	usageRaw, _ := lm.usage.LoadOrStore(p.Name, usage)
+	p.usage = usageRaw.(*keyUsage)
+	return nil
+}
+
+func readUsage(ctx context.Context, storage logical.Storage, name string) (map[int]KeyVersionUsage, error) {
+	usage := map[int]KeyVersionUsage{}
+	entry, err := storage.Get(ctx, "usage/"+name)
+	if err != nil {
+		return nil, errwrap.Wrapf("error loading key usage: {{err}}", err)
+	}
+	if entry != nil {
+		if err := entry.DecodeJSON(&usage); err != nil {
+			return nil, errwrap.Wrapf("error decoding key usage: {{err}}", err)
+		}
+	}
+	return usage, nil
+}
+
+// InvalidateUsage marks the usage of the named policy as changed in storage,
+// so that it is loaded again by the next call to SyncUsage.
+func (lm *LockManager) InvalidateUsage(name string) {
+	if usageRaw, ok := lm.usage.Load(name); ok {
+		usage := usageRaw.(*keyUsage)
+		usage.l.Lock()
+		usage.stale = true
+		usage.l.Unlock()
+	}
+}
+
+// SyncUsage reconciles the usage of the named policy recorded by this node
+// with its persisted usage, which is first loaded again if it was
+// invalidated. If readOnly is set, as on performance standbys, and a version
+// was used without the persisted usage reflecting it, logical.ErrReadOnly is
+// returned so that the request can be forwarded to a node that records and
+// persists the use. Otherwise the usage is persisted if the persisted usage
+// lags behind.
+func (lm *LockManager) SyncUsage(ctx context.Context, storage logical.Storage, name string, readOnly bool) error {
+	usageRaw, ok := lm.usage.Load(name)
+	if !ok {
+		return nil
+	}
+	usage := usageRaw.(*keyUsage)
+
+	usage.l.Lock()
+	stale := usage.stale
+	usage.stale = false
+	usage.l.Unlock()
+	if stale {
+		persisted, err := readUsage(ctx, storage, name)
+		if err != nil {
+			usage.l.Lock()
+			usage.stale = true
+			usage.l.Unlock()
+			return err
+		}
+		usage.l.Lock()
+		usage.load(persisted)
+		usage.l.Unlock()
+	}
+
+	usage.l.Lock()
+	unpersisted := usage.unpersisted()
+	due := usage.dirty && (unpersisted || time.Since(usage.lastPersisted) > usagePersistInterval)
+	usage.l.Unlock()
+
+	switch {
+	case readOnly && unpersisted:
+		return logical.ErrReadOnly
+	case readOnly || !due:
+		return nil
+	}
+	return lm.persistUsage(ctx, storage, name, usage)
+}
+
+// PersistUsage writes the usage of policies that has been recorded since it
+// was last persisted to storage.
+func (lm *LockManager) PersistUsage(ctx context.Context, storage logical.Storage) error {
+	var retErr error
+	lm.usage.Range(func(k, v interface{}) bool {
+		if err := lm.persistUsage(ctx, storage, k.(string), v.(*keyUsage)); err != nil {
+			retErr = err
+			return false
+		}
+		return true
+	})
+
+	return retErr
+}
+
+func (lm *LockManager) persistUsage(ctx context.Context, storage logical.Storage, name string, usage *keyUsage) error {
+	usage.l.Lock()
+	if !usage.dirty {
+		usage.l.Unlock()
+		return nil
+	}
+	buf, err := json.Marshal(usage.versions)
+	lastUsed := make(map[int]time.Time, len(usage.versions))
+	for version, versionUsage := range usage.versions {
+		lastUsed[version] = versionUsage.LastUsed
+	}
+	usage.dirty = false
+	usage.l.Unlock()
+	if err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("error encoding usage of key %q: {{err}}", name), err)
+	}
+
+	if err := storage.Put(ctx, &logical.StorageEntry{
+		Key:   "usage/" + name,
+		Value: buf,
+	}); err != nil {
+		// Retry on the next call
+		usage.l.Lock()
+		usage.dirty = true
+		usage.l.Unlock()
+		return errwrap.Wrapf(fmt.Sprintf("error persisting usage of key %q: {{err}}", name), err)
+	}
+
+	usage.l.Lock()
+	for version, t := range lastUsed {
+		if t.After(usage.persisted[version]) {
+			usage.persisted[version] = t
+		}
+	}
+	usage.lastPersisted = time.Now()
+	usage.l.Unlock()
+
+	return nil
+}
+
+// deleteUsage removes the recorded usage of the named policy.
+func (lm *LockManager) deleteUsage(ctx context.Context, storage logical.Storage, name string) error {
+	lm.usage.Delete(name)
+	if err := storage.Delete(ctx, "usage/"+name); err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("error deleting key %q usage: {{err}}", name), err)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package keysutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func Test_KeyUsage(t *testing.T) {
+	lockManagerWithCache, _ := NewLockManager(true, 0)
+	lockManagerWithoutCache, _ := NewLockManager(false, 0)
+	testKeyUsageCommon(t, lockManagerWithCache)
+	testKeyUsageCommon(t, lockManagerWithoutCache)
+}
+
+func testKeyUsageCommon(t *testing.T, lm *LockManager) {
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+
+	getPolicy := func(upsert bool) *Policy {
+		t.Helper()
+		p, _, err := lm.GetPolicy(ctx, PolicyRequest{
+			Upsert:  upsert,
+			Storage: storage,
+			KeyType: KeyType_AES256_GCM96,
+			Name:    "test",
+		}, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p == nil {
+			t.Fatal("nil policy")
+		}
+		if !lm.useCache {
+			p.Unlock()
+		}
+		return p
+	}
+
+	p := getPolicy(true)
+	if len(p.Usage()) != 0 {
+		t.Fatalf("expected no usage of a new key: %#v", p.Usage())
+	}
+
+	plaintext := base64.StdEncoding.EncodeToString([]byte("usage"))
+	ciphertext, err := p.Encrypt(0, nil, nil, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Rotate(ctx, storage, rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+
+	// Usage is shared by every load of the policy
+	p = getPolicy(false)
+	if _, err := p.Decrypt(nil, nil, ciphertext); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.HMACKey(2); err != nil {
+		t.Fatal(err)
+	}
+
+	usage := p.Usage()
+	if len(usage) != 2 || usage[1].Count != 2 || usage[2].Count != 1 {
+		t.Fatalf("unexpected usage: %#v", usage)
+	}
+	if usage[1].LastUsed.IsZero() || usage[2].LastUsed.IsZero() {
+		t.Fatalf("unexpected last used times: %#v", usage)
+	}
+
+	// Failed operations are not counted
+	if _, err := p.Encrypt(5, nil, nil, plaintext); err == nil {
+		t.Fatal("expected error encrypting with a missing version")
+	}
+	if p.Usage()[1].Count != 2 {
+		t.Fatalf("unexpected usage: %#v", p.Usage())
+	}
+
+	// Persisted usage is loaded by other lock managers
+	if err := lm.PersistUsage(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	otherLM, _ := NewLockManager(lm.useCache, 0)
+	otherP, _, err := otherLM.GetPolicy(ctx, PolicyRequest{
+		Storage: storage,
+		Name:    "test",
+	}, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !otherLM.useCache {
+		otherP.Unlock()
+	}
+	otherUsage := otherP.Usage()
+	if otherUsage[1].Count != 2 || otherUsage[2].Count != 1 || !otherUsage[1].LastUsed.Equal(usage[1].LastUsed) {
+		t.Fatalf("unexpected persisted usage: %#v", otherUsage)
+	}
+
+	// Usage is removed along with the policy
+	p.DeletionAllowed = true
+	if err := p.Persist(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	if err := lm.DeletePolicy(ctx, storage, "test"); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := storage.Get(ctx, "usage/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry != nil {
+		t.Fatal("expected usage to be deleted")
+	}
+	if p = getPolicy(true); len(p.Usage()) != 0 {
+		t.Fatalf("expected no usage of a new key: %#v", p.Usage())
+	}
+}
+
+func Test_KeyUsageSync(t *testing.T) {
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+	active, _ := NewLockManager(true, 0)
+	standby, _ := NewLockManager(true, 0)
+
+	getPolicy := func(lm *LockManager) *Policy {
+		t.Helper()
+		p, _, err := lm.GetPolicy(ctx, PolicyRequest{
+			Upsert:  true,
+			Storage: storage,
+			KeyType: KeyType_AES256_GCM96,
+			Name:    "test",
+		}, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p == nil {
+			t.Fatal("nil policy")
+		}
+		return p
+	}
+	readPersisted := func() map[int]KeyVersionUsage {
+		t.Helper()
+		persisted, err := readUsage(ctx, storage, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return persisted
+	}
+	// backdate moves the persisted last use of the first version of p back,
+	// as if it had been persisted more than usagePersistInterval ago
+	backdate := func(p *Policy) {
+		p.usage.l.Lock()
+		p.usage.persisted[1] = p.usage.persisted[1].Add(-2 * usagePersistInterval)
+		p.usage.l.Unlock()
+	}
+
+	plaintext := base64.StdEncoding.EncodeToString([]byte("usage"))
+	activeP := getPolicy(active)
+	if _, err := activeP.Encrypt(0, nil, nil, plaintext); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first use of a version is persisted right away
+	if err := active.SyncUsage(ctx, storage, "test", false); err != nil {
+		t.Fatal(err)
+	}
+	if persisted := readPersisted(); persisted[1].Count != 1 {
+		t.Fatalf("unexpected persisted usage: %#v", persisted)
+	}
+
+	// Further uses are only persisted once the persisted usage lags behind
+	if _, err := activeP.Encrypt(0, nil, nil, plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := active.SyncUsage(ctx, storage, "test", false); err != nil {
+		t.Fatal(err)
+	}
+	if persisted := readPersisted(); persisted[1].Count != 1 {
+		t.Fatalf("unexpected persisted usage: %#v", persisted)
+	}
+	backdate(activeP)
+	if err := active.SyncUsage(ctx, storage, "test", false); err != nil {
+		t.Fatal(err)
+	}
+	if persisted := readPersisted(); persisted[1].Count != 2 {
+		t.Fatalf("unexpected persisted usage: %#v", persisted)
+	}
+
+	// A read-only node serves uses covered by the persisted usage
+	standbyP := getPolicy(standby)
+	if _, err := standbyP.Encrypt(0, nil, nil, plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := standby.SyncUsage(ctx, storage, "test", true); err != nil {
+		t.Fatal(err)
+	}
+
+	// ...but not uses the persisted usage does not reflect, which are
+	// forwarded
+	backdate(standbyP)
+	if err := standby.SyncUsage(ctx, storage, "test", true); err != logical.ErrReadOnly {
+		t.Fatalf("expected a read-only error, got: %v", err)
+	}
+
+	// Once the active node has persisted a more recent use, the standby
+	// loads it on invalidation and serves the version again
+	if _, err := activeP.Encrypt(0, nil, nil, plaintext); err != nil {
+		t.Fatal(err)
+	}
+	backdate(activeP)
+	if err := active.SyncUsage(ctx, storage, "test", false); err != nil {
+		t.Fatal(err)
+	}
+	standby.InvalidateUsage("test")
+	if err := standby.SyncUsage(ctx, storage, "test", true); err != nil {
+		t.Fatal(err)
+	}
+	if usage := standbyP.Usage(); usage[1].Count != 3 {
+		t.Fatalf("unexpected usage on the standby: %#v", usage)
+	}
+}
@@ -84,6 +84,25 @@ type PasswordPolicy interface {
 type ExtendedSystemView interface {
 	Auditor() Auditor
 	ForwardGenericRequest(context.Context, *Request) (*Response, error)
+
+	// DelegatedLogin logs a client of the mount in against the auth mount
+	// with the given accessor, handling login, whose path is relative to the
+	// auth mount, as the login request of the client. The resulting token
+	// must be allowed to perform req on the mount, and is revoked before
+	// returning. The returned auth identifies the entity and policies of the
+	// client; ErrPermissionDenied is returned if either the login or the
+	// policy check fails.
+	DelegatedLogin(ctx context.Context, mountAccessor string, login *Request, req *Request) (*Auth, error)
+
+	// AllowOperations reports, for each of reqs, whether the policies of the
+	// client of the request being handled allow it to perform the operation
+	// of the request on its path, relative to the mount. It lets mounts
+	// authorize the parts of a request which act on other paths.
+	AllowOperations(ctx context.Context, reqs []*Request) ([]bool, error)
+
+	// PKCS11Libraries returns the paths of the PKCS#11 libraries of the
+	// server configuration, keyed by name.
+	PKCS11Libraries() map[string]string
 }
 
 type PasswordGenerator func() (password string, err error)
@@ -104,6 +123,7 @@ type StaticSystemView struct {
 	VaultVersion        string
 	PluginEnvironment   *PluginEnvironment
 	PasswordPolicies    map[string]PasswordGenerator
+	PKCS11LibrariesVal  map[string]string
 }
 
 type noopAuditor struct{}
@@ -124,6 +144,18 @@ func (d StaticSystemView) ForwardGenericRequest(ctx context.Context, req *Reques
 	return nil, errors.New("ForwardGenericRequest is not implemented in StaticSystemView")
 }
 
+func (d StaticSystemView) DelegatedLogin(ctx context.Context, mountAccessor string, login *Request, req *Request) (*Auth, error) {
+	return nil, errors.New("DelegatedLogin is not implemented in StaticSystemView")
+}
+
+func (d StaticSystemView) AllowOperations(ctx context.Context, reqs []*Request) ([]bool, error) {
+	return nil, errors.New("AllowOperations is not implemented in StaticSystemView")
+}
+
+func (d StaticSystemView) PKCS11Libraries() map[string]string {
+	return d.PKCS11LibrariesVal
+}
+
 func (d StaticSystemView) DefaultLeaseTTL() time.Duration {
 	return d.DefaultLeaseTTLVal
 }
@@ -2,12 +2,15 @@ package vault
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/hashicorp/vault/command/server"
 	"github.com/hashicorp/vault/helper/identity"
 	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/helper/random"
+	"github.com/hashicorp/vault/internalshared/configutil"
 	"github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/hashicorp/vault/sdk/helper/license"
 	"github.com/hashicorp/vault/sdk/helper/pluginutil"
@@ -18,6 +21,21 @@ import (
 
 type ctxKeyForwardedRequestMountAccessor struct{}
 
+// ctxKeyRequestClient holds the requestClient of the request being routed
+type ctxKeyRequestClient struct{}
+
+func (c ctxKeyRequestClient) String() string {
+	return "request-client"
+}
+
+// requestClient identifies the client of a request, so that mounts may check
+// its policies against the parts of the request acting on other paths
+type requestClient struct {
+	token      string
+	tokenEntry *logical.TokenEntry
+	connection *logical.Connection
+}
+
 func (c ctxKeyForwardedRequestMountAccessor) String() string {
 	return "forwarded-req-mount-accessor"
 }
@@ -59,6 +77,111 @@ func (e extendedSystemViewImpl) ForwardGenericRequest(ctx context.Context, req *
 	return nil, logical.ErrReadOnly
 }
 
+func (e extendedSystemViewImpl) DelegatedLogin(ctx context.Context, mountAccessor string, login *logical.Request, req *logical.Request) (*logical.Auth, error) {
+	authMount := e.core.router.MatchingMountByAccessor(mountAccessor)
+	if authMount == nil || authMount.Table != credentialTableType {
+		return nil, fmt.Errorf("no auth mount found with accessor %q", mountAccessor)
+	}
+
+	// The login happens while handling a request to this mount, which holds
+	// the state lock already
+	loginCtx := namespace.ContextWithNamespace(ctx, authMount.Namespace())
+	login.Path = credentialRoutePrefix + authMount.Path + login.Path
+	resp, err := e.core.switchedLockHandleRequest(loginCtx, login, false)
+	if errors.Is(err, logical.ErrPermissionDenied) || errors.Is(err, logical.ErrInvalidRequest) || (resp != nil && resp.IsError()) {
+		return nil, logical.ErrPermissionDenied
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return nil, logical.ErrPermissionDenied
+	}
+	auth := resp.Auth
+
+	if auth.TokenType != logical.TokenTypeBatch {
+		defer func() {
+			_, err := e.core.switchedLockHandleRequest(loginCtx, &logical.Request{
+				Operation:   logical.UpdateOperation,
+				Path:        "auth/token/revoke-self",
+				ClientToken: auth.ClientToken,
+			}, false)
+			if err != nil {
+				e.core.logger.Error("failed to revoke the token of a delegated login", "error", err)
+			}
+		}()
+	}
+
+	// Check the policies of the client against the request it is making,
+	// as if it had been made with the token
+	ctx = namespace.ContextWithNamespace(ctx, e.mountEntry.Namespace())
+	aclReq := &logical.Request{
+		Operation:   req.Operation,
+		Path:        e.mountEntry.Path + req.Path,
+		ClientToken: auth.ClientToken,
+	}
+	acl, _, entity, _, err := e.core.fetchACLTokenEntryAndEntity(ctx, aclReq)
+	if err != nil {
+		return nil, err
+	}
+	if entity != nil && entity.Disabled {
+		return nil, logical.ErrPermissionDenied
+	}
+	if !acl.AllowOperation(ctx, aclReq, false).Allowed {
+		return nil, logical.ErrPermissionDenied
+	}
+
+	return auth, nil
+}
+
+func (e extendedSystemViewImpl) AllowOperations(ctx context.Context, reqs []*logical.Request) ([]bool, error) {
+	client, ok := ctx.Value(ctxKeyRequestClient{}).(*requestClient)
+	if !ok {
+		return nil, logical.ErrPermissionDenied
+	}
+
+	ctx = namespace.ContextWithNamespace(ctx, e.mountEntry.Namespace())
+	tokenReq := &logical.Request{
+		ClientToken: client.token,
+		Connection:  client.connection,
+	}
+	tokenReq.SetTokenEntry(client.tokenEntry)
+	acl, _, entity, _, err := e.core.fetchACLTokenEntryAndEntity(ctx, tokenReq)
+	if err != nil {
+		return nil, err
+	}
+	if entity != nil && entity.Disabled {
+		return nil, logical.ErrPermissionDenied
+	}
+
+	allowed := make([]bool, len(reqs))
+	for i, req := range reqs {
+		aclReq := &logical.Request{
+			Operation:   req.Operation,
+			Path:        e.mountEntry.Path + req.Path,
+			Data:        req.Data,
+			ClientToken: client.token,
+		}
+		allowed[i] = acl.AllowOperation(ctx, aclReq, false).Allowed
+	}
+	return allowed, nil
+}
+
+func (e extendedSystemViewImpl) PKCS11Libraries() map[string]string {
+	conf := e.core.rawConfig.Load()
+	if conf == nil || conf.(*server.Config).SharedConfig == nil {
+		return nil
+	}
+
+	libraries := make(map[string]string)
+	for name, library := range conf.(*server.Config).KMSLibraries {
+		if library.Type == configutil.KMSLibraryTypePKCS11 {
+			libraries[name] = library.Library
+		}
+	}
+	return libraries
+}
+
 // SudoPrivilege returns true if given path has sudo privileges
 // for the given client token
 func (e extendedSystemViewImpl) SudoPrivilege(ctx context.Context, path string, token string) bool {
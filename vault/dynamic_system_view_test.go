@@ -11,8 +11,10 @@ import (
 
 	log "github.com/hashicorp/go-hclog"
 	ldapcred "github.com/hashicorp/vault/builtin/credential/ldap"
+	credUserpass "github.com/hashicorp/vault/builtin/credential/userpass"
 	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
@@ -318,3 +320,74 @@ func (b fakeBarrier) Put(context.Context, *logical.StorageEntry) error {
 func (b fakeBarrier) Delete(context.Context, string) error {
 	return fmt.Errorf("not implemented")
 }
+
+func TestDynamicSystemView_DelegatedLogin(t *testing.T) {
+	core, _, root := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	core.credentialBackends["userpass"] = credUserpass.Factory
+	for _, req := range []*logical.Request{
+		{
+			Path: "sys/auth/userpass",
+			Data: map[string]interface{}{"type": "userpass"},
+		},
+		{
+			Path: "sys/policy/est",
+			Data: map[string]interface{}{"policy": `path "secret/est/*" { capabilities = ["update"] }`},
+		},
+		{
+			Path: "auth/userpass/users/device",
+			Data: map[string]interface{}{"password": "foo", "policies": "est"},
+		},
+		{
+			Path: "auth/userpass/users/other",
+			Data: map[string]interface{}{"password": "foo", "policies": "default"},
+		},
+	} {
+		req.Operation = logical.UpdateOperation
+		req.ClientToken = root
+		resp, err := core.HandleRequest(ctx, req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %s: err: %v resp: %#v", req.Path, err, resp)
+		}
+	}
+	accessor := core.router.MatchingMountEntry(ctx, "auth/userpass/").Accessor
+	sysView := core.mountEntrySysView(core.router.MatchingMountEntry(ctx, "secret/"))
+
+	login := func(username, password string) (*logical.Auth, error) {
+		return sysView.DelegatedLogin(ctx, accessor, &logical.Request{
+			Operation:  logical.UpdateOperation,
+			Path:       "login/" + username,
+			Data:       map[string]interface{}{"password": password},
+			Connection: &logical.Connection{},
+		}, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "est/simpleenroll",
+		})
+	}
+
+	auth, err := login("device", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.EntityID == "" || !strutil.StrListContains(auth.Policies, "est") {
+		t.Fatalf("expected the entity and policies of the user: %#v", auth)
+	}
+	te, err := core.tokenStore.Lookup(ctx, auth.ClientToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if te != nil {
+		t.Fatal("expected the token of the login to be revoked")
+	}
+
+	if _, err := login("device", "bar"); err != logical.ErrPermissionDenied {
+		t.Fatalf("expected a wrong password to be denied, got %v", err)
+	}
+	if _, err := login("other", "foo"); err != logical.ErrPermissionDenied {
+		t.Fatalf("expected a user without the policy to be denied, got %v", err)
+	}
+	if _, err := sysView.DelegatedLogin(ctx, "auth_userpass_unknown", &logical.Request{}, &logical.Request{}); err == nil {
+		t.Fatal("expected an unknown accessor to fail")
+	}
+}
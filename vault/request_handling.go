@@ -913,6 +913,16 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 		}
 	}()
 
+	// Let the mount check the policies of the client against the parts of
+	// the request acting on other paths
+	if te != nil {
+		ctx = context.WithValue(ctx, ctxKeyRequestClient{}, &requestClient{
+			token:      req.ClientToken,
+			tokenEntry: te,
+			connection: req.Connection,
+		})
+	}
+
 	// Route the request
 	resp, routeErr := c.doRouting(ctx, req)
 	if resp != nil {